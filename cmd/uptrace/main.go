@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"net"
 	"net/http"
@@ -19,15 +21,19 @@ import (
 	"github.com/uptrace/opentelemetry-go-extra/otelzap"
 	"github.com/uptrace/uptrace"
 	"github.com/uptrace/uptrace/pkg"
+	_ "github.com/uptrace/uptrace/pkg/alerting"
 	"github.com/uptrace/uptrace/pkg/bunapp"
 	"github.com/uptrace/uptrace/pkg/bunapp/migrations"
+	"github.com/uptrace/uptrace/pkg/chadmin"
 	"github.com/uptrace/uptrace/pkg/httputil"
+	_ "github.com/uptrace/uptrace/pkg/profiling"
 	_ "github.com/uptrace/uptrace/pkg/tracing"
 	"github.com/urfave/cli/v2"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 func main() {
@@ -47,6 +53,7 @@ func main() {
 		Commands: []*cli.Command{
 			versionCommand,
 			serveCommand,
+			encryptCommand,
 			newCHCommand(migrations.Migrations),
 		},
 	}
@@ -65,6 +72,31 @@ var versionCommand = &cli.Command{
 	},
 }
 
+var encryptCommand = &cli.Command{
+	Name:      "encrypt",
+	Usage:     "encrypt a secret, for example, a project token, to store it in the config",
+	ArgsUsage: "VALUE",
+	Action: func(c *cli.Context) error {
+		value := c.Args().First()
+		if value == "" {
+			return fmt.Errorf("value is required")
+		}
+
+		cfg, err := bunapp.ReadConfig(c.String("config"), c.Command.Name)
+		if err != nil {
+			return err
+		}
+
+		encrypted, err := cfg.EncryptSecret(value)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(encrypted)
+		return nil
+	},
+}
+
 var serveCommand = &cli.Command{
 	Name:  "serve",
 	Usage: "run HTTP and gRPC APIs",
@@ -81,6 +113,18 @@ var serveCommand = &cli.Command{
 		fmt.Printf("reading YAML config from    %s\n", cfg.Filepath)
 		fmt.Printf("OTLP/gRPC (listen.grpc)     %s\n", cfg.GRPCDsn(project))
 		fmt.Printf("OTLP/HTTP (listen.http)     %s\n", cfg.HTTPDsn(project))
+		if cfg.Listen.XRay != "" {
+			fmt.Printf("X-Ray (listen.xray)         udp://%s\n", cfg.Listen.XRay)
+		}
+		if cfg.Listen.SyslogUDP != "" {
+			fmt.Printf("Syslog (listen.syslog_udp)  udp://%s\n", cfg.Listen.SyslogUDP)
+		}
+		if cfg.Listen.SyslogTCP != "" {
+			fmt.Printf("Syslog (listen.syslog_tcp)  tcp://%s\n", cfg.Listen.SyslogTCP)
+		}
+		if cfg.Listen.Statsd != "" {
+			fmt.Printf("StatsD (listen.statsd)      udp://%s\n", cfg.Listen.Statsd)
+		}
 		fmt.Println()
 
 		fmt.Printf("read the docs at            https://docs.uptrace.dev/guide/os.html#otlp\n")
@@ -97,6 +141,10 @@ var serveCommand = &cli.Command{
 			return err
 		}
 
+		if len(cfg.Listen.ACME.Domains) > 0 {
+			httpLn = tls.NewListener(httpLn, acmeTLSConfig(cfg))
+		}
+
 		grpcLn, err := net.Listen("tcp", cfg.Listen.GRPC)
 		if err != nil {
 			otelzap.L().Error("net.Listen failed (edit listen.grpc YAML option)",
@@ -109,19 +157,30 @@ var serveCommand = &cli.Command{
 				zap.Error(err), zap.String("dsn", app.Config().CH.DSN))
 		}
 
-		serveVueApp(app)
+		if err := serveVueApp(app); err != nil {
+			return err
+		}
 		handler := app.HTTPHandler()
+		if prefix := cfg.Site.URLPrefix; prefix != "" {
+			handler = http.StripPrefix(prefix, handler)
+		}
 		handler = gzhttp.GzipHandler(handler)
-		handler = httputil.DecompressHandler{Next: handler}
+		handler = httputil.DecompressHandler{
+			Next:    handler,
+			MaxSize: cfg.IngestLimits.MaxBodySize,
+		}
 		handler = otelhttp.NewHandler(handler, "")
 		handler = cors.AllowAll().Handler(handler)
+		handler = httputil.StreamHandler{Next: handler, Suffixes: []string{"/export"}}
 		handler = httputil.PanicHandler{Next: handler}
 
 		httpServer := &http.Server{
-			ReadTimeout:  5 * time.Second,
-			WriteTimeout: 5 * time.Second,
-			IdleTimeout:  60 * time.Second,
-			Handler:      handler,
+			ReadHeaderTimeout: cfg.Listen.ReadTimeout,
+			ReadTimeout:       cfg.Listen.ReadTimeout,
+			WriteTimeout:      cfg.Listen.WriteTimeout,
+			IdleTimeout:       60 * time.Second,
+			Handler:           handler,
+			ConnContext:       httputil.ConnContext,
 		}
 
 		var wg sync.WaitGroup
@@ -141,6 +200,10 @@ var serveCommand = &cli.Command{
 			}
 		}()
 
+		if err := app.RunServeHooks(ctx); err != nil {
+			return err
+		}
+
 		genSampleTrace()
 
 		fmt.Println(bunapp.WaitExitSignal())
@@ -154,15 +217,37 @@ var serveCommand = &cli.Command{
 	},
 }
 
-func serveVueApp(app *bunapp.App) {
+// acmeTLSConfig obtains and renews certificates using the TLS-ALPN-01 challenge
+// so the HTTP listener must be reachable on port 443.
+func acmeTLSConfig(cfg *bunapp.AppConfig) *tls.Config {
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.Listen.ACME.Domains...),
+		Cache:      autocert.DirCache(cfg.Listen.ACME.CacheDir),
+		Email:      cfg.Listen.ACME.Email,
+	}
+	return manager.TLSConfig()
+}
+
+func serveVueApp(app *bunapp.App) error {
 	router := app.Router()
 	fsys := http.FS(uptrace.DistFS())
 	fileServer := http.FileServer(fsys)
 
+	indexHTML, err := vueIndexHTML(app.Config().Site.URLPrefix)
+	if err != nil {
+		return err
+	}
+
 	notFoundMiddleware := func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
 		return func(w http.ResponseWriter, req bunrouter.Request) error {
 			path := req.URL.Path
-			if path == "/" || strings.Contains(path, "/api/") {
+			if path == "/" || path == "/index.html" {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				_, err := w.Write(indexHTML)
+				return err
+			}
+			if strings.Contains(path, "/api/") {
 				return next(w, req)
 			}
 
@@ -181,6 +266,27 @@ func serveVueApp(app *bunapp.App) {
 		bunrouter.WithGroup(func(group *bunrouter.Group) {
 			group.GET("", bunrouter.HTTPHandler(fileServer))
 		}))
+
+	return nil
+}
+
+// vueIndexHTML returns index.html that loads assets and makes API requests
+// using the URL prefix.
+func vueIndexHTML(prefix string) ([]byte, error) {
+	b, err := fs.ReadFile(uptrace.DistFS(), "index.html")
+	if err != nil {
+		return nil, err
+	}
+	if prefix == "" {
+		return b, nil
+	}
+
+	s := string(b)
+	s = strings.ReplaceAll(s, `href="/`, `href="`+prefix+`/`)
+	s = strings.ReplaceAll(s, `src="/`, `src="`+prefix+`/`)
+	script := fmt.Sprintf(`<script>window.UPTRACE_URL_PREFIX = %q</script>`, prefix)
+	s = strings.Replace(s, "</head>", script+"</head>", 1)
+	return []byte(s), nil
 }
 
 func newCHCommand(migrations *migrate.Migrations) *cli.Command {
@@ -394,6 +500,76 @@ func newCHCommand(migrations *migrate.Migrations) *cli.Command {
 					return nil
 				},
 			},
+			{
+				Name:  "backup",
+				Usage: "back up ClickHouse database and the config",
+				Action: func(c *cli.Context) error {
+					ctx, app, err := bunapp.StartCLI(c)
+					if err != nil {
+						return err
+					}
+					defer app.Stop()
+
+					backups, err := chadmin.NewBackupManager(app)
+					if err != nil {
+						return err
+					}
+
+					backup, err := backups.Create(ctx)
+					if err != nil {
+						return err
+					}
+
+					fmt.Printf("created backup %s\n", backup.Name)
+					return nil
+				},
+			},
+			{
+				Name:      "restore",
+				Usage:     "restore ClickHouse database and the config from a backup",
+				ArgsUsage: "BACKUP_NAME",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "database",
+						Usage: "restore into `DATABASE` instead of the current database",
+					},
+					&cli.StringFlag{
+						Name:  "config-out",
+						Usage: "write the config file saved with the backup to `FILE`",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					ctx, app, err := bunapp.StartCLI(c)
+					if err != nil {
+						return err
+					}
+					defer app.Stop()
+
+					name := c.Args().First()
+					if name == "" {
+						return fmt.Errorf("backup name is required")
+					}
+
+					backups, err := chadmin.NewBackupManager(app)
+					if err != nil {
+						return err
+					}
+
+					config, err := backups.Restore(ctx, name, c.String("database"))
+					if err != nil {
+						return err
+					}
+
+					if path := c.String("config-out"); path != "" {
+						if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+							return err
+						}
+					}
+
+					fmt.Printf("restored backup %s\n", name)
+					return nil
+				},
+			},
 			{
 				Name:  "status",
 				Usage: "print migrations status",
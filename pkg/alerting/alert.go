@@ -0,0 +1,432 @@
+package alerting
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"go.uber.org/zap"
+)
+
+type AlertState string
+
+const (
+	AlertPending  AlertState = "pending"
+	AlertFiring   AlertState = "firing"
+	AlertAcked    AlertState = "acked"
+	AlertResolved AlertState = "resolved"
+)
+
+type Alert struct {
+	ProjectID uint32 `json:"projectId"`
+	// Key uniquely identifies the alert within the project and is used to deduplicate
+	// notifications, for example, "heartbeat:nightly-backup".
+	Key     string            `json:"key"`
+	Name    string            `json:"name"`
+	Message string            `json:"message"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Service string            `json:"service,omitempty"`
+	// Link to the page that explains the alert. Defaults to the alert timeline.
+	URL string `json:"url"`
+
+	// Keys of the alerts this alert depends on. Notifications are suppressed
+	// while any of them is firing.
+	DependsOn  []string `json:"dependsOn,omitempty"`
+	Suppressed bool     `json:"suppressed"`
+
+	IncidentID uint64 `json:"incidentId,omitempty"`
+	// Key of the alert that opened the incident. Notifications about other alerts
+	// in the incident are posted to the same recipients instead of being escalated.
+	IncidentLead string `json:"incidentLead,omitempty"`
+	incident     *Incident
+
+	State      AlertState `json:"state"`
+	FiredAt    time.Time  `json:"firedAt"`
+	AckedAt    time.Time  `json:"ackedAt,omitempty"`
+	AckedBy    string     `json:"ackedBy,omitempty"`
+	ResolvedAt time.Time  `json:"resolvedAt,omitempty"`
+	ResolvedBy string     `json:"resolvedBy,omitempty"`
+
+	// Number of escalation steps that were notified.
+	EscalationStep int `json:"escalationStep"`
+	notifiedAt     time.Time
+}
+
+// threaded reports whether the alert joined an incident opened by another alert.
+func (a *Alert) threaded() bool {
+	return a.IncidentLead != "" && a.IncidentLead != a.Key
+}
+
+type alertKey struct {
+	projectID uint32
+	key       string
+}
+
+// AlertManager keeps track of firing alerts and notifies about state changes.
+type AlertManager struct {
+	*bunapp.App
+
+	notifiers  []Notifier
+	policies   []*EscalationPolicy
+	composites []*CompositeRule
+
+	incidentWindow time.Duration
+
+	mu      sync.Mutex
+	alerts  map[alertKey]*Alert
+	pending map[alertKey]*Alert
+
+	graphs         map[uint32]serviceGraph
+	incidents      []*Incident
+	lastIncidentID uint64
+}
+
+func NewAlertManager(app *bunapp.App) (*AlertManager, error) {
+	conf := app.Config().Alerting
+
+	notifiers, err := newNotifiers(conf.Notifiers)
+	if err != nil {
+		return nil, err
+	}
+
+	policies, err := newEscalationPolicies(conf.EscalationPolicies, notifiers, conf.OnCall)
+	if err != nil {
+		return nil, err
+	}
+
+	composites := make([]*CompositeRule, 0, len(conf.CompositeRules))
+	for i := range conf.CompositeRules {
+		composite, err := newCompositeRule(&conf.CompositeRules[i])
+		if err != nil {
+			return nil, err
+		}
+		composites = append(composites, composite)
+	}
+
+	return &AlertManager{
+		App:        app,
+		notifiers:  notifiers,
+		policies:   policies,
+		composites: composites,
+
+		incidentWindow: conf.IncidentWindow,
+
+		alerts:  make(map[alertKey]*Alert),
+		pending: make(map[alertKey]*Alert),
+		graphs:  make(map[uint32]serviceGraph),
+	}, nil
+}
+
+// Pending records that the alert condition matches, but the alert is not firing yet
+// because the condition must hold for some time. A firing alert is resolved.
+func (m *AlertManager) Pending(ctx context.Context, alert *Alert) {
+	key := alertKey{projectID: alert.ProjectID, key: alert.Key}
+
+	m.mu.Lock()
+	_, firing := m.alerts[key]
+	m.mu.Unlock()
+
+	if firing {
+		m.Resolve(ctx, alert.ProjectID, alert.Key)
+	}
+
+	m.mu.Lock()
+	if _, ok := m.pending[key]; ok {
+		m.mu.Unlock()
+		return
+	}
+	alert.State = AlertPending
+	m.pending[key] = alert
+	m.mu.Unlock()
+
+	m.record(ctx, alert, AlertPending, "")
+}
+
+// Fire marks the alert as firing. Notifications are sent only once until the alert
+// is resolved.
+func (m *AlertManager) Fire(ctx context.Context, alert *Alert) {
+	key := alertKey{projectID: alert.ProjectID, key: alert.Key}
+
+	m.mu.Lock()
+	if _, ok := m.alerts[key]; ok {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.pending, key)
+	alert.State = AlertFiring
+	if alert.FiredAt.IsZero() {
+		alert.FiredAt = time.Now()
+	}
+	if alert.URL == "" {
+		alert.URL = m.Config().AlertURL(alert.ProjectID, alert.Key, alert.FiredAt)
+	}
+	alert.Suppressed = m.hasFiringDeps(alert)
+	if !alert.Suppressed {
+		m.group(alert)
+	}
+	m.alerts[key] = alert
+	m.mu.Unlock()
+
+	m.record(ctx, alert, AlertFiring, "")
+	if !alert.Suppressed {
+		m.notify(ctx, alert)
+	}
+	m.stateChanged(ctx, alert.ProjectID)
+}
+
+// Resolve resolves the firing or pending alert with the key, if any.
+func (m *AlertManager) Resolve(ctx context.Context, projectID uint32, key string) {
+	m.ResolveBy(ctx, projectID, key, "")
+}
+
+// ResolveBy resolves the alert on behalf of the actor, for example, a user.
+// It returns false if the alert is not firing.
+func (m *AlertManager) ResolveBy(ctx context.Context, projectID uint32, key, actor string) bool {
+	akey := alertKey{projectID: projectID, key: key}
+
+	m.mu.Lock()
+	alert, ok := m.alerts[akey]
+	if !ok {
+		pending, ok := m.pending[akey]
+		delete(m.pending, akey)
+		m.mu.Unlock()
+
+		if ok {
+			m.record(ctx, pending, AlertResolved, actor)
+		}
+		return false
+	}
+	delete(m.alerts, akey)
+	m.ungroup(alert)
+	resolved := *alert
+	m.mu.Unlock()
+
+	resolved.State = AlertResolved
+	resolved.ResolvedAt = time.Now()
+	resolved.ResolvedBy = actor
+
+	m.record(ctx, &resolved, AlertResolved, actor)
+	// Suppressed alerts were never notified about.
+	if !resolved.Suppressed {
+		m.notify(ctx, &resolved)
+	}
+	m.stateChanged(ctx, projectID)
+	return true
+}
+
+// Ack acknowledges the firing alert which stops the escalation.
+// It returns false if the alert is not firing.
+func (m *AlertManager) Ack(ctx context.Context, projectID uint32, key, actor string) bool {
+	m.mu.Lock()
+	alert, ok := m.alerts[alertKey{projectID: projectID, key: key}]
+	if !ok || !alert.AckedAt.IsZero() {
+		m.mu.Unlock()
+		return ok
+	}
+	alert.AckedAt = time.Now()
+	alert.AckedBy = actor
+	acked := *alert
+	m.mu.Unlock()
+
+	acked.State = AlertAcked
+
+	m.record(ctx, &acked, AlertAcked, actor)
+	if !acked.Suppressed {
+		m.notify(ctx, &acked)
+	}
+	return true
+}
+
+// Firing returns firing alerts for the project sorted by time.
+func (m *AlertManager) Firing(projectID uint32) []*Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alerts := make([]*Alert, 0)
+	for key, alert := range m.alerts {
+		if key.projectID == projectID {
+			clone := *alert
+			alerts = append(alerts, &clone)
+		}
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].FiredAt.Before(alerts[j].FiredAt)
+	})
+	return alerts
+}
+
+func (m *AlertManager) hasFiringDeps(alert *Alert) bool {
+	for _, dep := range alert.DependsOn {
+		if _, ok := m.alerts[alertKey{projectID: alert.ProjectID, key: dep}]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// stateChanged notifies about alerts that are no longer suppressed and
+// re-evaluates composite rules.
+func (m *AlertManager) stateChanged(ctx context.Context, projectID uint32) {
+	var unsuppressed []*Alert
+	firing := make(map[string]*Alert)
+
+	m.mu.Lock()
+	for key, alert := range m.alerts {
+		if key.projectID != projectID {
+			continue
+		}
+		firing[key.key] = alert
+		if alert.Suppressed && !m.hasFiringDeps(alert) {
+			alert.Suppressed = false
+			m.group(alert)
+			unsuppressed = append(unsuppressed, alert)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, alert := range unsuppressed {
+		m.notify(ctx, alert)
+	}
+
+	for _, composite := range m.composites {
+		if composite.ProjectID != projectID {
+			continue
+		}
+
+		if composite.matches(firing) {
+			m.Fire(ctx, composite.alert(firing))
+		} else {
+			m.Resolve(ctx, projectID, composite.alertKey())
+		}
+	}
+}
+
+func (m *AlertManager) notify(ctx context.Context, alert *Alert) {
+	m.Zap(ctx).Info("alert state changed",
+		zap.Uint32("project_id", alert.ProjectID),
+		zap.String("key", alert.Key),
+		zap.String("state", string(alert.State)))
+
+	policy := m.policy(alert.ProjectID)
+	if policy == nil {
+		m.send(ctx, alert, m.notifiers)
+		return
+	}
+
+	if alert.threaded() {
+		m.mu.Lock()
+		numStep := alert.incident.lead.EscalationStep
+		m.mu.Unlock()
+
+		for _, step := range policy.steps[:numStep] {
+			m.send(ctx, step.alert(alert), step.notifiers)
+		}
+		return
+	}
+
+	switch alert.State {
+	case AlertFiring:
+		m.mu.Lock()
+		alert.notifiedAt = time.Now()
+		m.mu.Unlock()
+
+		m.escalate(ctx, policy, alert)
+	case AlertAcked, AlertResolved:
+		// Only notify the steps that were notified about the firing alert.
+		for _, step := range policy.steps[:alert.EscalationStep] {
+			m.send(ctx, step.alert(alert), step.notifiers)
+		}
+	}
+}
+
+func (m *AlertManager) policy(projectID uint32) *EscalationPolicy {
+	for _, policy := range m.policies {
+		if policy.hasProject(projectID) {
+			return policy
+		}
+	}
+	return nil
+}
+
+// escalate notifies the escalation steps whose delay has passed.
+func (m *AlertManager) escalate(ctx context.Context, policy *EscalationPolicy, alert *Alert) {
+	var steps []*escalationStep
+
+	m.mu.Lock()
+	for alert.AckedAt.IsZero() && alert.EscalationStep < len(policy.steps) {
+		step := policy.steps[alert.EscalationStep]
+		if time.Since(alert.notifiedAt) < step.Delay {
+			break
+		}
+		steps = append(steps, step)
+		alert.EscalationStep++
+	}
+	m.mu.Unlock()
+
+	for _, step := range steps {
+		m.send(ctx, step.alert(alert), step.notifiers)
+	}
+}
+
+func (m *AlertManager) send(ctx context.Context, alert *Alert, notifiers []Notifier) {
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(ctx, alert); err != nil {
+			m.Zap(ctx).Error("notifier failed",
+				zap.String("notifier", notifier.Name()), zap.Error(err))
+		}
+	}
+}
+
+// Run escalates unacknowledged alerts and refreshes service graphs
+// until the app is stopped.
+func (m *AlertManager) Run(ctx context.Context, app *bunapp.App) error {
+	app.WaitGroup().Add(1)
+	go func() {
+		defer app.WaitGroup().Done()
+
+		m.refreshGraphs(app.Context())
+
+		escalation := time.NewTicker(10 * time.Second)
+		defer escalation.Stop()
+
+		graphs := time.NewTicker(5 * time.Minute)
+		defer graphs.Stop()
+
+		for {
+			select {
+			case <-app.Done():
+				return
+			case <-escalation.C:
+				if len(m.policies) > 0 {
+					m.escalateAll(app.Context())
+				}
+			case <-graphs.C:
+				m.refreshGraphs(app.Context())
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (m *AlertManager) escalateAll(ctx context.Context) {
+	var alerts []*Alert
+
+	m.mu.Lock()
+	for _, alert := range m.alerts {
+		if !alert.Suppressed && !alert.threaded() &&
+			alert.AckedAt.IsZero() && !alert.notifiedAt.IsZero() {
+			alerts = append(alerts, alert)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, alert := range alerts {
+		if policy := m.policy(alert.ProjectID); policy != nil {
+			m.escalate(ctx, policy, alert)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/org"
+	"github.com/uptrace/uptrace/pkg/tracing"
+)
+
+type AlertEventFilter struct {
+	*bunapp.App `urlstruct:"-"`
+
+	tracing.TimeFilter
+
+	ProjectID uint32
+	Key       string
+}
+
+func DecodeAlertEventFilter(app *bunapp.App, req bunrouter.Request) (*AlertEventFilter, error) {
+	f := &AlertEventFilter{App: app}
+	if err := bunapp.UnmarshalValues(req, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *AlertEventFilter) whereClause(q *ch.SelectQuery) *ch.SelectQuery {
+	q = q.Where("project_id = ?", f.ProjectID).
+		Where("time >= ?", f.TimeGTE).
+		Where("time < ?", f.TimeLT)
+	if f.Key != "" {
+		q = q.Where("alert_key = ?", f.Key)
+	}
+	return q
+}
+
+//------------------------------------------------------------------------------
+
+type AlertHandler struct {
+	*bunapp.App
+
+	alerts *AlertManager
+}
+
+func NewAlertHandler(app *bunapp.App, alerts *AlertManager) *AlertHandler {
+	return &AlertHandler{
+		App:    app,
+		alerts: alerts,
+	}
+}
+
+func (h *AlertHandler) List(w http.ResponseWriter, req bunrouter.Request) error {
+	projectID, err := req.Params().Uint32("project_id")
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"alerts": h.alerts.Firing(projectID),
+	})
+}
+
+func (h *AlertHandler) Ack(w http.ResponseWriter, req bunrouter.Request) error {
+	return h.changeState(w, req, h.alerts.Ack)
+}
+
+func (h *AlertHandler) Resolve(w http.ResponseWriter, req bunrouter.Request) error {
+	return h.changeState(w, req, h.alerts.ResolveBy)
+}
+
+func (h *AlertHandler) changeState(
+	w http.ResponseWriter,
+	req bunrouter.Request,
+	fn func(ctx context.Context, projectID uint32, key, actor string) bool,
+) error {
+	ctx := req.Context()
+
+	user, err := org.UserFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	projectID, err := req.Params().Uint32("project_id")
+	if err != nil {
+		return err
+	}
+
+	var in struct {
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&in); err != nil {
+		return err
+	}
+
+	if !fn(ctx, projectID, in.Key, user.Username) {
+		return httperror.NotFound("firing alert %q not found", in.Key)
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"alerts": h.alerts.Firing(projectID),
+	})
+}
+
+func (h *AlertHandler) Incidents(w http.ResponseWriter, req bunrouter.Request) error {
+	projectID, err := req.Params().Uint32("project_id")
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"incidents": h.alerts.Incidents(projectID),
+	})
+}
+
+// Timeline returns alert state changes, for example, for incident postmortems.
+func (h *AlertHandler) Timeline(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	f, err := DecodeAlertEventFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+
+	events := make([]AlertEvent, 0)
+
+	if err := h.CH().NewSelect().
+		Model(&events).
+		Apply(f.whereClause).
+		OrderExpr("time ASC").
+		Limit(10000).
+		Scan(ctx); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"events": events,
+	})
+}
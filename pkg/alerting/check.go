@@ -0,0 +1,214 @@
+package alerting
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+)
+
+type CheckResult struct {
+	ch.CHModel `ch:"table:check_results,alias:r"`
+
+	ProjectID  uint32        `json:"projectId"`
+	Name       string        `json:"name" ch:",lc"`
+	Type       string        `json:"type" ch:",lc"`
+	Time       time.Time     `json:"time"`
+	Duration   time.Duration `json:"duration"`
+	Success    bool          `json:"success"`
+	StatusCode int32         `json:"statusCode"`
+	Error      string        `json:"error"`
+
+	// Earliest expiration date in the TLS certificate chain.
+	TLSExpiresAt time.Time `json:"tlsExpiresAt,omitempty"`
+	TLSChain     []string  `json:"tlsChain,omitempty"`
+}
+
+func (res *CheckResult) setTLS(certs []*x509.Certificate) {
+	res.TLSChain = make([]string, len(certs))
+	for i, cert := range certs {
+		if res.TLSExpiresAt.IsZero() || cert.NotAfter.Before(res.TLSExpiresAt) {
+			res.TLSExpiresAt = cert.NotAfter
+		}
+		res.TLSChain[i] = fmt.Sprintf("subject=%s; issuer=%s; expires=%s",
+			cert.Subject, cert.Issuer, cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+}
+
+type prober interface {
+	probe(ctx context.Context, res *CheckResult) error
+}
+
+type Check struct {
+	*bunapp.Check
+
+	prober prober
+}
+
+func newCheck(cfg *bunapp.Check) (*Check, error) {
+	check := &Check{
+		Check: cfg,
+	}
+
+	switch cfg.Type {
+	case "http", "":
+		check.prober = &httpProber{check: cfg}
+	case "tcp":
+		check.prober = &tcpProber{check: cfg}
+	case "grpc":
+		check.prober = &grpcProber{check: cfg}
+	default:
+		return nil, fmt.Errorf("check %q has unsupported type %q", cfg.Name, cfg.Type)
+	}
+
+	return check, nil
+}
+
+func (c *Check) alertKey() string {
+	return "check:" + c.Name
+}
+
+func (c *Check) Run(ctx context.Context) *CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	res := &CheckResult{
+		ProjectID: c.ProjectID,
+		Name:      c.Name,
+		Type:      c.Type,
+		Time:      time.Now(),
+	}
+	if res.Type == "" {
+		res.Type = "http"
+	}
+
+	err := c.prober.probe(ctx, res)
+	res.Duration = time.Since(res.Time)
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		res.Success = true
+	}
+
+	return res
+}
+
+//------------------------------------------------------------------------------
+
+type httpProber struct {
+	check *bunapp.Check
+}
+
+var _ prober = (*httpProber)(nil)
+
+func (p *httpProber) probe(ctx context.Context, res *CheckResult) error {
+	method := p.check.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.check.Target, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	res.StatusCode = int32(resp.StatusCode)
+	if resp.TLS != nil {
+		res.setTLS(resp.TLS.PeerCertificates)
+	}
+
+	if expected := p.check.ExpectedStatus; expected != 0 {
+		if resp.StatusCode != expected {
+			return fmt.Errorf("got status %d, wanted %d", resp.StatusCode, expected)
+		}
+	} else if resp.StatusCode >= 400 {
+		return fmt.Errorf("got status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type tcpProber struct {
+	check *bunapp.Check
+}
+
+var _ prober = (*tcpProber)(nil)
+
+func (p *tcpProber) probe(ctx context.Context, res *CheckResult) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", p.check.Target)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if !p.check.TLS {
+		return nil
+	}
+
+	host, _, _ := net.SplitHostPort(p.check.Target)
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return err
+	}
+
+	res.setTLS(tlsConn.ConnectionState().PeerCertificates)
+	return nil
+}
+
+// grpcProber uses the standard gRPC health checking protocol.
+type grpcProber struct {
+	check *bunapp.Check
+}
+
+var _ prober = (*grpcProber)(nil)
+
+func (p *grpcProber) probe(ctx context.Context, res *CheckResult) error {
+	creds := insecure.NewCredentials()
+	if p.check.TLS {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+
+	conn, err := grpc.DialContext(ctx, p.check.Target,
+		grpc.WithTransportCredentials(creds), grpc.WithBlock())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var remote peer.Peer
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(
+		ctx, &grpc_health_v1.HealthCheckRequest{}, grpc.Peer(&remote))
+	if err != nil {
+		return err
+	}
+
+	if info, ok := remote.AuthInfo.(credentials.TLSInfo); ok {
+		res.setTLS(info.State.PeerCertificates)
+	}
+
+	res.StatusCode = int32(resp.Status)
+	if resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		return fmt.Errorf("got status %s", resp.Status)
+	}
+	return nil
+}
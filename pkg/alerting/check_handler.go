@@ -0,0 +1,126 @@
+package alerting
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/tracing"
+)
+
+type CheckResultFilter struct {
+	*bunapp.App `urlstruct:"-"`
+
+	tracing.TimeFilter
+
+	ProjectID uint32
+	Name      string
+}
+
+func DecodeCheckResultFilter(app *bunapp.App, req bunrouter.Request) (*CheckResultFilter, error) {
+	f := &CheckResultFilter{App: app}
+	if err := bunapp.UnmarshalValues(req, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *CheckResultFilter) whereClause(q *ch.SelectQuery) *ch.SelectQuery {
+	return q.Where("project_id = ?", f.ProjectID).
+		Where("name = ?", f.Name).
+		Where("time >= ?", f.TimeGTE).
+		Where("time < ?", f.TimeLT)
+}
+
+//------------------------------------------------------------------------------
+
+type CheckHandler struct {
+	*bunapp.App
+
+	monitor *CheckMonitor
+}
+
+func NewCheckHandler(app *bunapp.App, monitor *CheckMonitor) *CheckHandler {
+	return &CheckHandler{
+		App:     app,
+		monitor: monitor,
+	}
+}
+
+type checkStatus struct {
+	*bunapp.Check
+	LastResult *CheckResult `json:"lastResult"`
+}
+
+func (h *CheckHandler) List(w http.ResponseWriter, req bunrouter.Request) error {
+	projectID, err := req.Params().Uint32("project_id")
+	if err != nil {
+		return err
+	}
+
+	checks := h.monitor.Checks(projectID)
+	statuses := make([]checkStatus, len(checks))
+	for i, check := range checks {
+		statuses[i] = checkStatus{
+			Check:      check.Check,
+			LastResult: h.monitor.LastResult(check),
+		}
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"checks": statuses,
+	})
+}
+
+func (h *CheckHandler) Results(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	f, err := DecodeCheckResultFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+	if h.monitor.Check(f.ProjectID, f.Name) == nil {
+		return httperror.NotFound("check %q not found", f.Name)
+	}
+
+	results := make([]CheckResult, 0)
+
+	if err := h.CH().NewSelect().
+		Model(&results).
+		Apply(f.whereClause).
+		OrderExpr("time DESC").
+		Limit(1000).
+		Scan(ctx); err != nil {
+		return err
+	}
+
+	var stats struct {
+		Count  uint64
+		Uptime float64
+		P50    time.Duration
+		P99    time.Duration
+	}
+
+	if err := h.CH().NewSelect().
+		Model((*CheckResult)(nil)).
+		ColumnExpr("count() AS count").
+		ColumnExpr("avg(success) AS uptime").
+		ColumnExpr("toInt64(quantile(0.5)(duration)) AS p50").
+		ColumnExpr("toInt64(quantile(0.99)(duration)) AS p99").
+		Apply(f.whereClause).
+		Scan(ctx, &stats); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"results": results,
+		"count":   stats.Count,
+		"uptime":  stats.Uptime,
+		"p50":     stats.P50,
+		"p99":     stats.P99,
+	})
+}
@@ -0,0 +1,172 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"go.uber.org/zap"
+)
+
+// CheckMonitor periodically runs synthetic checks, records the results,
+// and alerts on failures and high latency.
+type CheckMonitor struct {
+	*bunapp.App
+
+	alerts *AlertManager
+	checks []*Check
+
+	mu          sync.Mutex
+	lastResults map[*Check]*CheckResult
+}
+
+func NewCheckMonitor(app *bunapp.App, alerts *AlertManager) (*CheckMonitor, error) {
+	m := &CheckMonitor{
+		App:         app,
+		alerts:      alerts,
+		lastResults: make(map[*Check]*CheckResult),
+	}
+
+	cfgs := app.Config().Checks
+	for i := range cfgs {
+		check, err := newCheck(&cfgs[i])
+		if err != nil {
+			return nil, err
+		}
+		m.checks = append(m.checks, check)
+	}
+
+	return m, nil
+}
+
+func (m *CheckMonitor) Check(projectID uint32, name string) *Check {
+	for _, check := range m.checks {
+		if check.ProjectID == projectID && check.Name == name {
+			return check
+		}
+	}
+	return nil
+}
+
+func (m *CheckMonitor) Checks(projectID uint32) []*Check {
+	var checks []*Check
+	for _, check := range m.checks {
+		if check.ProjectID == projectID {
+			checks = append(checks, check)
+		}
+	}
+	return checks
+}
+
+func (m *CheckMonitor) LastResult(check *Check) *CheckResult {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastResults[check]
+}
+
+func (m *CheckMonitor) Run(ctx context.Context, app *bunapp.App) error {
+	for _, check := range m.checks {
+		check := check
+
+		app.WaitGroup().Add(1)
+		go func() {
+			defer app.WaitGroup().Done()
+
+			m.runLoop(app.Context(), check)
+		}()
+	}
+	return nil
+}
+
+func (m *CheckMonitor) runLoop(ctx context.Context, check *Check) {
+	// Spread checks over the interval.
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(check.Interval))))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-m.Done():
+			return
+		case <-timer.C:
+		}
+
+		m.runCheck(ctx, check)
+		timer.Reset(check.Interval)
+	}
+}
+
+func (m *CheckMonitor) runCheck(ctx context.Context, check *Check) {
+	res := check.Run(ctx)
+
+	m.mu.Lock()
+	m.lastResults[check] = res
+	m.mu.Unlock()
+
+	if _, err := m.CH().NewInsert().Model(res).Exec(ctx); err != nil {
+		m.Zap(ctx).Error("can't insert check result", zap.Error(err))
+	}
+
+	if !res.Success {
+		m.alerts.Fire(ctx, &Alert{
+			ProjectID: check.ProjectID,
+			DependsOn: check.DependsOn,
+			Service:   check.Service,
+			Key:       check.alertKey(),
+			Name:      fmt.Sprintf("Check %q is failing", check.Name),
+			Message:   fmt.Sprintf("%s %s: %s", res.Type, check.Target, res.Error),
+		})
+		return
+	}
+	m.alerts.Resolve(ctx, check.ProjectID, check.alertKey())
+
+	m.checkTLSExpiry(ctx, check, res)
+	m.checkLatency(ctx, check, res)
+}
+
+func (m *CheckMonitor) checkTLSExpiry(ctx context.Context, check *Check, res *CheckResult) {
+	if res.TLSExpiresAt.IsZero() {
+		return
+	}
+
+	tlsKey := check.alertKey() + ":tls"
+	timeLeft := time.Until(res.TLSExpiresAt)
+
+	if timeLeft > time.Duration(check.TLSExpiryDays)*24*time.Hour {
+		m.alerts.Resolve(ctx, check.ProjectID, tlsKey)
+		return
+	}
+
+	m.alerts.Fire(ctx, &Alert{
+		ProjectID: check.ProjectID,
+		DependsOn: check.DependsOn,
+		Service:   check.Service,
+		Key:       tlsKey,
+		Name:      fmt.Sprintf("TLS certificate for %q expires soon", check.Name),
+		Message: fmt.Sprintf("%s: the certificate chain expires in %d days (%s)",
+			check.Target, int(timeLeft.Hours()/24), res.TLSExpiresAt.Format(time.RFC3339)),
+	})
+}
+
+func (m *CheckMonitor) checkLatency(ctx context.Context, check *Check, res *CheckResult) {
+	if check.MaxLatency == 0 {
+		return
+	}
+
+	latencyKey := check.alertKey() + ":latency"
+	if res.Duration > check.MaxLatency {
+		m.alerts.Fire(ctx, &Alert{
+			ProjectID: check.ProjectID,
+			DependsOn: check.DependsOn,
+			Service:   check.Service,
+			Key:       latencyKey,
+			Name:      fmt.Sprintf("Check %q is slow", check.Name),
+			Message: fmt.Sprintf("%s %s took %s (max %s)",
+				res.Type, check.Target, res.Duration, check.MaxLatency),
+		})
+	} else {
+		m.alerts.Resolve(ctx, check.ProjectID, latencyKey)
+	}
+}
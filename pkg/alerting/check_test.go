@@ -0,0 +1,43 @@
+package alerting
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+func TestCheckRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		cfg     bunapp.Check
+		success bool
+	}{
+		{cfg: bunapp.Check{Type: "http", Target: srv.URL + "/up"}, success: true},
+		{cfg: bunapp.Check{Type: "http", Target: srv.URL + "/down"}, success: false},
+		{cfg: bunapp.Check{Type: "http", Target: srv.URL + "/up", ExpectedStatus: 204}, success: false},
+		{cfg: bunapp.Check{Type: "tcp", Target: strings.TrimPrefix(srv.URL, "http://")}, success: true},
+	} {
+		test.cfg.Name = "test"
+		test.cfg.Timeout = time.Second
+
+		check, err := newCheck(&test.cfg)
+		require.NoError(t, err)
+
+		res := check.Run(ctx)
+		require.Equal(t, test.success, res.Success, res.Error)
+	}
+}
@@ -0,0 +1,80 @@
+package alerting
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+type CompositeRule struct {
+	*bunapp.CompositeRule
+}
+
+func newCompositeRule(cfg *bunapp.CompositeRule) (*CompositeRule, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("composite rule does not have a name")
+	}
+	if len(cfg.Alerts) == 0 {
+		return nil, fmt.Errorf("composite rule %q does not have alerts", cfg.Name)
+	}
+	switch cfg.Op {
+	case "":
+		cfg.Op = "and"
+	case "and", "or":
+	default:
+		return nil, fmt.Errorf("composite rule %q has unsupported op %q", cfg.Name, cfg.Op)
+	}
+	return &CompositeRule{CompositeRule: cfg}, nil
+}
+
+func (r *CompositeRule) alertKey() string {
+	return "composite:" + r.Name
+}
+
+// matches reports whether the composite condition holds for the firing alerts.
+// With the and op, all alerts must fire within the configured duration of each other.
+func (r *CompositeRule) matches(firing map[string]*Alert) bool {
+	if r.Op == "or" {
+		for _, key := range r.Alerts {
+			if _, ok := firing[key]; ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	var minTime, maxTime time.Time
+	for _, key := range r.Alerts {
+		alert, ok := firing[key]
+		if !ok {
+			return false
+		}
+		if minTime.IsZero() || alert.FiredAt.Before(minTime) {
+			minTime = alert.FiredAt
+		}
+		if alert.FiredAt.After(maxTime) {
+			maxTime = alert.FiredAt
+		}
+	}
+
+	return r.Within == 0 || maxTime.Sub(minTime) <= r.Within
+}
+
+func (r *CompositeRule) alert(firing map[string]*Alert) *Alert {
+	var names []string
+	for _, key := range r.Alerts {
+		if alert, ok := firing[key]; ok {
+			names = append(names, alert.Name)
+		}
+	}
+
+	return &Alert{
+		ProjectID: r.ProjectID,
+		Key:       r.alertKey(),
+		Name:      r.Name,
+		Message:   "Firing alerts: " + strings.Join(names, ", "),
+		DependsOn: r.DependsOn,
+	}
+}
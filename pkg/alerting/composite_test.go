@@ -0,0 +1,49 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+func TestCompositeRuleMatches(t *testing.T) {
+	now := time.Now()
+	firing := map[string]*Alert{
+		"rule:errors":  {Key: "rule:errors", FiredAt: now},
+		"rule:latency": {Key: "rule:latency", FiredAt: now.Add(3 * time.Minute)},
+		"check:db":     {Key: "check:db", FiredAt: now.Add(time.Hour)},
+	}
+
+	for _, test := range []struct {
+		cfg     bunapp.CompositeRule
+		matches bool
+	}{
+		{cfg: bunapp.CompositeRule{Alerts: []string{"rule:errors", "rule:latency"}}, matches: true},
+		{
+			cfg: bunapp.CompositeRule{
+				Alerts: []string{"rule:errors", "rule:latency"},
+				Within: 5 * time.Minute,
+			},
+			matches: true,
+		},
+		{
+			cfg: bunapp.CompositeRule{
+				Alerts: []string{"rule:errors", "check:db"},
+				Within: 5 * time.Minute,
+			},
+			matches: false,
+		},
+		{cfg: bunapp.CompositeRule{Alerts: []string{"rule:errors", "check:web"}}, matches: false},
+		{
+			cfg:     bunapp.CompositeRule{Alerts: []string{"rule:errors", "check:web"}, Op: "or"},
+			matches: true,
+		},
+	} {
+		test.cfg.Name = "test"
+		rule, err := newCompositeRule(&test.cfg)
+		require.NoError(t, err)
+		require.Equal(t, test.matches, rule.matches(firing), test.cfg)
+	}
+}
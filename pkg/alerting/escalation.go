@@ -0,0 +1,133 @@
+package alerting
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+type OnCallSchedule struct {
+	*bunapp.OnCallSchedule
+}
+
+func newOnCallSchedule(cfg *bunapp.OnCallSchedule) (*OnCallSchedule, error) {
+	if len(cfg.Members) == 0 {
+		return nil, fmt.Errorf("on-call schedule %q does not have members", cfg.Name)
+	}
+	if cfg.Rotation == 0 {
+		cfg.Rotation = 7 * 24 * time.Hour
+	}
+	return &OnCallSchedule{OnCallSchedule: cfg}, nil
+}
+
+// Member returns the member that is on call at the time.
+func (s *OnCallSchedule) Member(tm time.Time) string {
+	d := tm.Sub(s.Start)
+	rotations := int(d / s.Rotation)
+	if d < 0 && d%s.Rotation != 0 {
+		rotations-- // round towards negative infinity
+	}
+
+	n := len(s.Members)
+	idx := rotations % n
+	if idx < 0 {
+		idx += n
+	}
+	return s.Members[idx]
+}
+
+//------------------------------------------------------------------------------
+
+type EscalationPolicy struct {
+	*bunapp.EscalationPolicy
+
+	steps []*escalationStep
+}
+
+type escalationStep struct {
+	*bunapp.EscalationStep
+
+	notifiers []Notifier
+	oncall    *OnCallSchedule
+}
+
+func newEscalationPolicies(
+	conf []bunapp.EscalationPolicy, notifiers []Notifier, schedules []bunapp.OnCallSchedule,
+) ([]*EscalationPolicy, error) {
+	notifierMap := make(map[string]Notifier, len(notifiers))
+	for _, notifier := range notifiers {
+		notifierMap[notifier.Name()] = notifier
+	}
+
+	scheduleMap := make(map[string]*OnCallSchedule, len(schedules))
+	for i := range schedules {
+		schedule, err := newOnCallSchedule(&schedules[i])
+		if err != nil {
+			return nil, err
+		}
+		scheduleMap[schedule.Name] = schedule
+	}
+
+	policies := make([]*EscalationPolicy, 0, len(conf))
+	for i := range conf {
+		cfg := &conf[i]
+		if len(cfg.Steps) == 0 {
+			return nil, fmt.Errorf("escalation policy %q does not have steps", cfg.Name)
+		}
+
+		policy := &EscalationPolicy{EscalationPolicy: cfg}
+		for j := range cfg.Steps {
+			stepCfg := &cfg.Steps[j]
+			step := &escalationStep{EscalationStep: stepCfg}
+
+			for _, name := range stepCfg.Notifiers {
+				notifier, ok := notifierMap[name]
+				if !ok {
+					return nil, fmt.Errorf("escalation policy %q: notifier %q not found",
+						cfg.Name, name)
+				}
+				step.notifiers = append(step.notifiers, notifier)
+			}
+
+			if stepCfg.OnCall != "" {
+				schedule, ok := scheduleMap[stepCfg.OnCall]
+				if !ok {
+					return nil, fmt.Errorf("escalation policy %q: on-call schedule %q not found",
+						cfg.Name, stepCfg.OnCall)
+				}
+				step.oncall = schedule
+			}
+
+			policy.steps = append(policy.steps, step)
+		}
+
+		policies = append(policies, policy)
+	}
+
+	return policies, nil
+}
+
+func (p *EscalationPolicy) hasProject(projectID uint32) bool {
+	for _, id := range p.ProjectIDs {
+		if id == projectID {
+			return true
+		}
+	}
+	return false
+}
+
+// alert returns a copy of the alert labeled with the current on-call member.
+func (s *escalationStep) alert(alert *Alert) *Alert {
+	if s.oncall == nil {
+		return alert
+	}
+
+	labeled := *alert
+	labeled.Labels = make(map[string]string, len(alert.Labels)+1)
+	for k, v := range alert.Labels {
+		labeled.Labels[k] = v
+	}
+	labeled.Labels["oncall"] = s.oncall.Member(time.Now())
+	return &labeled
+}
@@ -0,0 +1,79 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+type testNotifier struct {
+	name   string
+	alerts []*Alert
+}
+
+func (n *testNotifier) Name() string {
+	return n.name
+}
+
+func (n *testNotifier) Notify(ctx context.Context, alert *Alert) error {
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+func TestOnCallSchedule(t *testing.T) {
+	start := time.Date(2022, time.January, 3, 9, 0, 0, 0, time.UTC)
+	schedule, err := newOnCallSchedule(&bunapp.OnCallSchedule{
+		Name:    "backend",
+		Members: []string{"alice", "bob", "carol"},
+		Start:   start,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, "alice", schedule.Member(start))
+	require.Equal(t, "bob", schedule.Member(start.Add(8*24*time.Hour)))
+	require.Equal(t, "alice", schedule.Member(start.Add(21*24*time.Hour)))
+	require.Equal(t, "carol", schedule.Member(start.Add(-time.Hour)))
+}
+
+func TestEscalate(t *testing.T) {
+	slack := &testNotifier{name: "slack"}
+	pagerduty := &testNotifier{name: "pagerduty"}
+
+	policies, err := newEscalationPolicies([]bunapp.EscalationPolicy{{
+		Name:       "default",
+		ProjectIDs: []uint32{1},
+		Steps: []bunapp.EscalationStep{
+			{Notifiers: []string{"slack"}},
+			{Delay: 15 * time.Minute, Notifiers: []string{"pagerduty"}, OnCall: "backend"},
+		},
+	}}, []Notifier{slack, pagerduty}, []bunapp.OnCallSchedule{{
+		Name:    "backend",
+		Members: []string{"alice"},
+	}})
+	require.NoError(t, err)
+
+	m := &AlertManager{
+		policies: policies,
+		alerts:   make(map[alertKey]*Alert),
+	}
+	ctx := context.Background()
+
+	alert := &Alert{ProjectID: 1, Key: "check:web", notifiedAt: time.Now()}
+	m.escalate(ctx, policies[0], alert)
+	require.Equal(t, 1, alert.EscalationStep)
+	require.Len(t, slack.alerts, 1)
+	require.Len(t, pagerduty.alerts, 0)
+
+	alert.notifiedAt = time.Now().Add(-20 * time.Minute)
+	m.escalate(ctx, policies[0], alert)
+	require.Equal(t, 2, alert.EscalationStep)
+	require.Len(t, pagerduty.alerts, 1)
+	require.Equal(t, "alice", pagerduty.alerts[0].Labels["oncall"])
+
+	acked := &Alert{ProjectID: 1, Key: "check:db", notifiedAt: time.Now(), AckedAt: time.Now()}
+	m.escalate(ctx, policies[0], acked)
+	require.Equal(t, 0, acked.EscalationStep)
+}
@@ -0,0 +1,240 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"go.uber.org/zap"
+)
+
+const (
+	CheckinOK   = "ok"
+	CheckinFail = "fail"
+)
+
+type Checkin struct {
+	ch.CHModel `ch:"table:heartbeat_checkins,alias:c"`
+
+	ProjectID uint32        `json:"projectId"`
+	Name      string        `json:"name" ch:",lc"`
+	Time      time.Time     `json:"time"`
+	Status    string        `json:"status" ch:",lc"`
+	Duration  time.Duration `json:"duration"`
+}
+
+type Heartbeat struct {
+	*bunapp.Heartbeat
+
+	schedule cron.Schedule
+
+	mu          sync.Mutex
+	lastCheckin time.Time
+	lastStatus  string
+}
+
+func newHeartbeat(cfg *bunapp.Heartbeat) (*Heartbeat, error) {
+	hb := &Heartbeat{
+		Heartbeat: cfg,
+		// Jobs that never checked in are expected to check in after the start.
+		lastCheckin: time.Now(),
+	}
+	if cfg.Schedule != "" {
+		schedule, err := cron.ParseStandard(cfg.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("heartbeat %q has invalid schedule: %w", cfg.Name, err)
+		}
+		hb.schedule = schedule
+	}
+	return hb, nil
+}
+
+func (hb *Heartbeat) alertKey() string {
+	return "heartbeat:" + hb.Name
+}
+
+// deadline returns the time of the next expected check-in plus the grace period.
+func (hb *Heartbeat) deadline(lastCheckin time.Time) time.Time {
+	var next time.Time
+	if hb.schedule != nil {
+		next = hb.schedule.Next(lastCheckin)
+	} else {
+		next = lastCheckin.Add(hb.Interval)
+	}
+	return next.Add(hb.Grace)
+}
+
+type HeartbeatStatus struct {
+	*bunapp.Heartbeat
+
+	LastCheckin time.Time `json:"lastCheckin"`
+	LastStatus  string    `json:"lastStatus"`
+	Deadline    time.Time `json:"deadline"`
+}
+
+func (hb *Heartbeat) Status() *HeartbeatStatus {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+
+	return &HeartbeatStatus{
+		Heartbeat:   hb.Heartbeat,
+		LastCheckin: hb.lastCheckin,
+		LastStatus:  hb.lastStatus,
+		Deadline:    hb.deadline(hb.lastCheckin),
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// HeartbeatMonitor alerts when a job reports a failure or does not check in on time.
+type HeartbeatMonitor struct {
+	*bunapp.App
+
+	alerts     *AlertManager
+	heartbeats []*Heartbeat
+}
+
+func NewHeartbeatMonitor(app *bunapp.App, alerts *AlertManager) (*HeartbeatMonitor, error) {
+	m := &HeartbeatMonitor{
+		App:    app,
+		alerts: alerts,
+	}
+
+	cfgs := app.Config().Heartbeats
+	for i := range cfgs {
+		hb, err := newHeartbeat(&cfgs[i])
+		if err != nil {
+			return nil, err
+		}
+		m.heartbeats = append(m.heartbeats, hb)
+	}
+
+	return m, nil
+}
+
+func (m *HeartbeatMonitor) Heartbeat(projectID uint32, name string) *Heartbeat {
+	for _, hb := range m.heartbeats {
+		if hb.ProjectID == projectID && hb.Name == name {
+			return hb
+		}
+	}
+	return nil
+}
+
+func (m *HeartbeatMonitor) Heartbeats(projectID uint32) []*Heartbeat {
+	var heartbeats []*Heartbeat
+	for _, hb := range m.heartbeats {
+		if hb.ProjectID == projectID {
+			heartbeats = append(heartbeats, hb)
+		}
+	}
+	return heartbeats
+}
+
+func (m *HeartbeatMonitor) Checkin(ctx context.Context, hb *Heartbeat, checkin *Checkin) error {
+	if _, err := m.CH().NewInsert().Model(checkin).Exec(ctx); err != nil {
+		return err
+	}
+
+	hb.mu.Lock()
+	hb.lastCheckin = checkin.Time
+	hb.lastStatus = checkin.Status
+	hb.mu.Unlock()
+
+	if checkin.Status == CheckinFail {
+		m.alerts.Fire(ctx, &Alert{
+			ProjectID: hb.ProjectID,
+			DependsOn: hb.DependsOn,
+			Service:   hb.Service,
+			Key:       hb.alertKey(),
+			Name:      fmt.Sprintf("Heartbeat %q failed", hb.Name),
+			Message:   "The job checked in with a failure status.",
+		})
+	} else {
+		m.alerts.Resolve(ctx, hb.ProjectID, hb.alertKey())
+	}
+
+	return nil
+}
+
+// Run loads the last check-ins and checks deadlines until the app is stopped.
+func (m *HeartbeatMonitor) Run(ctx context.Context, app *bunapp.App) error {
+	if len(m.heartbeats) == 0 {
+		return nil
+	}
+
+	if err := m.loadCheckins(ctx); err != nil {
+		app.Zap(ctx).Error("loadCheckins failed", zap.Error(err))
+	}
+
+	app.WaitGroup().Add(1)
+	go func() {
+		defer app.WaitGroup().Done()
+
+		ticker := time.NewTicker(15 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-app.Done():
+				return
+			case <-ticker.C:
+				m.checkDeadlines(app.Context())
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (m *HeartbeatMonitor) loadCheckins(ctx context.Context) error {
+	var checkins []Checkin
+
+	if err := m.CH().NewSelect().
+		Model(&checkins).
+		ColumnExpr("project_id, name").
+		ColumnExpr("max(time) AS time").
+		ColumnExpr("argMax(status, time) AS status").
+		GroupExpr("project_id, name").
+		Scan(ctx); err != nil {
+		return err
+	}
+
+	for i := range checkins {
+		checkin := &checkins[i]
+		if hb := m.Heartbeat(checkin.ProjectID, checkin.Name); hb != nil {
+			hb.mu.Lock()
+			hb.lastCheckin = checkin.Time
+			hb.lastStatus = checkin.Status
+			hb.mu.Unlock()
+		}
+	}
+
+	return nil
+}
+
+func (m *HeartbeatMonitor) checkDeadlines(ctx context.Context) {
+	now := time.Now()
+	for _, hb := range m.heartbeats {
+		hb.mu.Lock()
+		lastCheckin := hb.lastCheckin
+		hb.mu.Unlock()
+
+		if now.Before(hb.deadline(lastCheckin)) {
+			continue
+		}
+
+		m.alerts.Fire(ctx, &Alert{
+			ProjectID: hb.ProjectID,
+			DependsOn: hb.DependsOn,
+			Service:   hb.Service,
+			Key:       hb.alertKey(),
+			Name:      fmt.Sprintf("Heartbeat %q is missing", hb.Name),
+			Message:   fmt.Sprintf("The job did not check in since %s.", lastCheckin.Format(time.RFC3339)),
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package alerting
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/org"
+)
+
+type HeartbeatHandler struct {
+	*bunapp.App
+
+	monitor *HeartbeatMonitor
+}
+
+func NewHeartbeatHandler(app *bunapp.App, monitor *HeartbeatMonitor) *HeartbeatHandler {
+	return &HeartbeatHandler{
+		App:     app,
+		monitor: monitor,
+	}
+}
+
+// Checkin records a check-in, for example:
+//
+//	curl -X POST -H 'uptrace-dsn: http://token@localhost:14318/1' \
+//	  'http://localhost:14318/api/v1/checkins/nightly-backup?status=ok&duration=90s'
+func (h *HeartbeatHandler) Checkin(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+	query := req.URL.Query()
+
+	dsn := org.IngestDSN(req.Request)
+	if dsn == "" {
+		return org.ErrDSNRequired
+	}
+
+	project, err := org.SelectProjectByDSN(ctx, h.App, dsn)
+	if err != nil {
+		return err
+	}
+
+	hb := h.monitor.Heartbeat(project.ID, req.Param("monitor"))
+	if hb == nil {
+		return httperror.NotFound("heartbeat %q not found", req.Param("monitor"))
+	}
+
+	checkin := &Checkin{
+		ProjectID: project.ID,
+		Name:      hb.Name,
+		Time:      time.Now(),
+		Status:    CheckinOK,
+	}
+
+	switch status := query.Get("status"); status {
+	case "", CheckinOK:
+	case CheckinFail:
+		checkin.Status = status
+	default:
+		return httperror.BadRequest("status", "status must be either ok or fail")
+	}
+
+	if s := query.Get("duration"); s != "" {
+		dur, err := time.ParseDuration(s)
+		if err != nil {
+			return httperror.BadRequest("duration", err.Error())
+		}
+		checkin.Duration = dur
+	}
+
+	if err := h.monitor.Checkin(ctx, hb, checkin); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+func (h *HeartbeatHandler) List(w http.ResponseWriter, req bunrouter.Request) error {
+	projectID, err := req.Params().Uint32("project_id")
+	if err != nil {
+		return err
+	}
+
+	heartbeats := h.monitor.Heartbeats(projectID)
+	statuses := make([]*HeartbeatStatus, len(heartbeats))
+	for i, hb := range heartbeats {
+		statuses[i] = hb.Status()
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"heartbeats": statuses,
+	})
+}
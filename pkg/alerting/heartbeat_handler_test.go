@@ -0,0 +1,44 @@
+package alerting
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/org"
+	"google.golang.org/grpc/peer"
+)
+
+func TestCheckinAuthThrottle(t *testing.T) {
+	conf := &bunapp.AppConfig{
+		Projects: []bunapp.Project{{ID: 1, Token: "secret"}},
+	}
+	conf.CH.DSN = "clickhouse://default:@localhost:9000/uptrace?sslmode=disable"
+	conf.AuthThrottle.MaxFailures = 2
+	conf.AuthThrottle.Window = time.Minute
+	conf.AuthThrottle.Lockout = time.Hour
+
+	app := bunapp.New(context.Background(), conf)
+	defer app.Stop()
+
+	h := NewHeartbeatHandler(app, &HeartbeatMonitor{App: app})
+	checkin := func(dsn string) error {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{
+			Addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.1")},
+		})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/checkins/backup", nil)
+		req.Header.Set("Authorization", "Bearer "+dsn)
+		return h.Checkin(httptest.NewRecorder(), bunrouter.NewRequest(req.WithContext(ctx)))
+	}
+
+	require.Error(t, checkin("wrong"))
+	require.NotEqual(t, org.ErrAuthLockedOut, checkin("wrong"))
+	// The client is locked out even with the right token.
+	require.Equal(t, org.ErrAuthLockedOut, checkin("secret"))
+}
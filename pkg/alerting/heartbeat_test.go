@@ -0,0 +1,33 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+func TestHeartbeatDeadline(t *testing.T) {
+	lastCheckin := time.Date(2022, time.February, 1, 3, 5, 0, 0, time.UTC)
+
+	hb, err := newHeartbeat(&bunapp.Heartbeat{
+		Name:     "nightly-backup",
+		Schedule: "0 3 * * *",
+		Grace:    30 * time.Minute,
+	})
+	require.NoError(t, err)
+	require.Equal(t,
+		time.Date(2022, time.February, 2, 3, 30, 0, 0, time.UTC), hb.deadline(lastCheckin))
+
+	hb, err = newHeartbeat(&bunapp.Heartbeat{
+		Name:     "queue-worker",
+		Interval: time.Hour,
+		Grace:    5 * time.Minute,
+	})
+	require.NoError(t, err)
+	require.Equal(t, lastCheckin.Add(time.Hour+5*time.Minute), hb.deadline(lastCheckin))
+
+	_, err = newHeartbeat(&bunapp.Heartbeat{Name: "invalid", Schedule: "every day"})
+	require.Error(t, err)
+}
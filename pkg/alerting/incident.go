@@ -0,0 +1,205 @@
+package alerting
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/tracing"
+	"go.uber.org/zap"
+)
+
+// Incident groups alerts that fire close together and belong to the same
+// or connected services. Alerts in the incident are notified in a single thread
+// that is started by the first alert.
+type Incident struct {
+	ID        uint64    `json:"id"`
+	ProjectID uint32    `json:"projectId"`
+	Services  []string  `json:"services"`
+	Alerts    []string  `json:"alerts"`
+	OpenedAt  time.Time `json:"openedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	lead      *Alert
+	dependsOn []string
+}
+
+// related reports whether the alert fired within the window since the last alert in
+// the incident and shares a service, a service graph edge, or a dependency with it.
+func (inc *Incident) related(alert *Alert, graph serviceGraph, window time.Duration) bool {
+	if inc.ProjectID != alert.ProjectID || alert.FiredAt.Sub(inc.UpdatedAt) > window {
+		return false
+	}
+
+	if alert.Service != "" {
+		for _, service := range inc.Services {
+			if graph.connected(service, alert.Service) {
+				return true
+			}
+		}
+	}
+
+	for _, dep := range alert.DependsOn {
+		if contains(inc.Alerts, dep) {
+			return true
+		}
+	}
+	return contains(inc.dependsOn, alert.Key)
+}
+
+func (inc *Incident) add(alert *Alert) {
+	inc.Alerts = append(inc.Alerts, alert.Key)
+	if alert.Service != "" && !contains(inc.Services, alert.Service) {
+		inc.Services = append(inc.Services, alert.Service)
+	}
+	inc.dependsOn = append(inc.dependsOn, alert.DependsOn...)
+	if alert.FiredAt.After(inc.UpdatedAt) {
+		inc.UpdatedAt = alert.FiredAt
+	}
+
+	alert.IncidentID = inc.ID
+	alert.IncidentLead = inc.lead.Key
+	alert.incident = inc
+}
+
+func (inc *Incident) remove(key string) {
+	for i, k := range inc.Alerts {
+		if k == key {
+			inc.Alerts = append(inc.Alerts[:i], inc.Alerts[i+1:]...)
+			return
+		}
+	}
+}
+
+func contains(ss []string, s string) bool {
+	for _, el := range ss {
+		if el == s {
+			return true
+		}
+	}
+	return false
+}
+
+//------------------------------------------------------------------------------
+
+// serviceGraph is an undirected graph of calls between services.
+type serviceGraph map[string]map[string]struct{}
+
+func newServiceGraph(edges []tracing.ServiceEdge) serviceGraph {
+	g := make(serviceGraph)
+	for _, edge := range edges {
+		g.add(edge.Client, edge.Server)
+		g.add(edge.Server, edge.Client)
+	}
+	return g
+}
+
+func (g serviceGraph) add(from, to string) {
+	m, ok := g[from]
+	if !ok {
+		m = make(map[string]struct{})
+		g[from] = m
+	}
+	m[to] = struct{}{}
+}
+
+func (g serviceGraph) connected(a, b string) bool {
+	if a == b {
+		return true
+	}
+	_, ok := g[a][b]
+	return ok
+}
+
+//------------------------------------------------------------------------------
+
+// group adds the alert to a related open incident or opens a new one.
+// The caller must hold the lock.
+func (m *AlertManager) group(alert *Alert) {
+	graph := m.graphs[alert.ProjectID]
+
+	for _, inc := range m.incidents {
+		if inc.related(alert, graph, m.incidentWindow) {
+			inc.add(alert)
+			return
+		}
+	}
+
+	id := uint64(time.Now().UnixNano())
+	if id <= m.lastIncidentID {
+		id = m.lastIncidentID + 1
+	}
+	m.lastIncidentID = id
+
+	inc := &Incident{
+		ID:        id,
+		ProjectID: alert.ProjectID,
+		OpenedAt:  alert.FiredAt,
+		UpdatedAt: alert.FiredAt,
+		lead:      alert,
+	}
+	inc.add(alert)
+	m.incidents = append(m.incidents, inc)
+}
+
+// ungroup removes the resolved alert from its incident and closes the incident
+// when it does not have any alerts left. The caller must hold the lock.
+func (m *AlertManager) ungroup(alert *Alert) {
+	inc := alert.incident
+	if inc == nil {
+		return
+	}
+
+	inc.remove(alert.Key)
+	if len(inc.Alerts) > 0 {
+		return
+	}
+
+	for i, el := range m.incidents {
+		if el == inc {
+			m.incidents = append(m.incidents[:i], m.incidents[i+1:]...)
+			break
+		}
+	}
+}
+
+// Incidents returns open incidents for the project sorted by time.
+func (m *AlertManager) Incidents(projectID uint32) []*Incident {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	incidents := make([]*Incident, 0)
+	for _, inc := range m.incidents {
+		if inc.ProjectID == projectID {
+			clone := *inc
+			clone.Services = append([]string(nil), inc.Services...)
+			clone.Alerts = append([]string(nil), inc.Alerts...)
+			incidents = append(incidents, &clone)
+		}
+	}
+
+	sort.Slice(incidents, func(i, j int) bool {
+		return incidents[i].OpenedAt.Before(incidents[j].OpenedAt)
+	})
+	return incidents
+}
+
+// refreshGraphs loads service graphs that are used to find related alerts.
+func (m *AlertManager) refreshGraphs(ctx context.Context) {
+	lt := time.Now()
+	gte := lt.Add(-time.Hour)
+
+	for _, project := range m.Config().Projects {
+		edges, err := tracing.SelectServiceGraph(ctx, m.App, project.ID, gte, lt)
+		if err != nil {
+			m.Zap(ctx).Error("SelectServiceGraph failed",
+				zap.Uint32("project_id", project.ID), zap.Error(err))
+			continue
+		}
+		graph := newServiceGraph(edges)
+
+		m.mu.Lock()
+		m.graphs[project.ID] = graph
+		m.mu.Unlock()
+	}
+}
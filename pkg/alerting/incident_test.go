@@ -0,0 +1,57 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/tracing"
+)
+
+func TestIncidentGrouping(t *testing.T) {
+	now := time.Now()
+	m := &AlertManager{
+		incidentWindow: 10 * time.Minute,
+		graphs: map[uint32]serviceGraph{
+			1: newServiceGraph([]tracing.ServiceEdge{
+				{Client: "frontend", Server: "checkout"},
+				{Client: "checkout", Server: "postgresql"},
+			}),
+		},
+	}
+
+	db := &Alert{ProjectID: 1, Key: "check:postgres", Service: "postgresql", FiredAt: now}
+	checkout := &Alert{ProjectID: 1, Key: "rule:checkout", Service: "checkout", FiredAt: now.Add(time.Minute)}
+	backup := &Alert{
+		ProjectID: 1,
+		Key:       "heartbeat:backup",
+		DependsOn: []string{"check:postgres"},
+		FiredAt:   now.Add(2 * time.Minute),
+	}
+	billing := &Alert{ProjectID: 1, Key: "rule:billing", Service: "billing", FiredAt: now.Add(2 * time.Minute)}
+	late := &Alert{ProjectID: 1, Key: "rule:frontend", Service: "frontend", FiredAt: now.Add(time.Hour)}
+	other := &Alert{ProjectID: 2, Key: "rule:checkout", Service: "checkout", FiredAt: now.Add(time.Minute)}
+
+	for _, alert := range []*Alert{db, checkout, backup, billing, late, other} {
+		m.group(alert)
+	}
+
+	require.False(t, db.threaded())
+	require.Equal(t, db.IncidentID, checkout.IncidentID)
+	require.Equal(t, "check:postgres", checkout.IncidentLead)
+	require.True(t, checkout.threaded())
+	require.Equal(t, db.IncidentID, backup.IncidentID)
+	require.NotEqual(t, db.IncidentID, billing.IncidentID)
+	require.NotEqual(t, db.IncidentID, late.IncidentID)
+	require.NotEqual(t, db.IncidentID, other.IncidentID)
+
+	incidents := m.Incidents(1)
+	require.Len(t, incidents, 3)
+	require.Equal(t, []string{"check:postgres", "rule:checkout", "heartbeat:backup"}, incidents[0].Alerts)
+	require.Equal(t, []string{"postgresql", "checkout"}, incidents[0].Services)
+
+	for _, alert := range []*Alert{db, checkout, backup} {
+		m.ungroup(alert)
+	}
+	require.Len(t, m.Incidents(1), 2)
+}
@@ -0,0 +1,127 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"go.uber.org/zap"
+)
+
+type projectWatchdog struct {
+	projectID uint32
+	watchdog  *bunapp.IngestWatchdog
+}
+
+type serviceLastSeen struct {
+	Service  string
+	LastSeen time.Time
+}
+
+func ingestAlertKey(service string) string {
+	return "ingest:" + service
+}
+
+// IngestWatchdogMonitor alerts when a previously active service stops sending spans.
+type IngestWatchdogMonitor struct {
+	*bunapp.App
+
+	alerts   *AlertManager
+	projects []projectWatchdog
+}
+
+func NewIngestWatchdogMonitor(app *bunapp.App, alerts *AlertManager) *IngestWatchdogMonitor {
+	m := &IngestWatchdogMonitor{
+		App:    app,
+		alerts: alerts,
+	}
+
+	conf := app.Config()
+	for i := range conf.Projects {
+		project := &conf.Projects[i]
+		if project.IngestWatchdog != nil {
+			m.projects = append(m.projects, projectWatchdog{
+				projectID: project.ID,
+				watchdog:  project.IngestWatchdog,
+			})
+		}
+	}
+
+	return m
+}
+
+func (m *IngestWatchdogMonitor) Run(ctx context.Context, app *bunapp.App) error {
+	if len(m.projects) == 0 {
+		return nil
+	}
+
+	app.WaitGroup().Add(1)
+	go func() {
+		defer app.WaitGroup().Done()
+
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-app.Done():
+				return
+			case <-ticker.C:
+			}
+
+			for i := range m.projects {
+				if err := m.check(app.Context(), &m.projects[i], time.Now()); err != nil {
+					app.Zap(ctx).Error("IngestWatchdogMonitor.check failed", zap.Error(err))
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (m *IngestWatchdogMonitor) check(ctx context.Context, p *projectWatchdog, now time.Time) error {
+	var services []serviceLastSeen
+
+	if err := m.CH().NewSelect().
+		ColumnExpr("`service.name` AS service").
+		ColumnExpr("max(`span.time`) AS last_seen").
+		TableExpr("spans_index").
+		Where("project_id = ?", p.projectID).
+		Where("`span.time` >= ?", now.Add(-p.watchdog.ActiveWithin)).
+		Where("`service.name` != ''").
+		GroupExpr("service").
+		Limit(1000).
+		Scan(ctx, &services); err != nil {
+		return err
+	}
+
+	for _, svc := range services {
+		if !silentService(p.watchdog, &svc, now) {
+			m.alerts.Resolve(ctx, p.projectID, ingestAlertKey(svc.Service))
+			continue
+		}
+
+		m.alerts.Fire(ctx, &Alert{
+			ProjectID: p.projectID,
+			Service:   svc.Service,
+			Key:       ingestAlertKey(svc.Service),
+			Name:      fmt.Sprintf("Service %q stopped sending spans", svc.Service),
+			Message: fmt.Sprintf("The service did not send spans since %s.",
+				svc.LastSeen.Format(time.RFC3339)),
+		})
+	}
+
+	return nil
+}
+
+// silentService reports whether the watched service did not send spans for
+// the watchdog duration.
+func silentService(w *bunapp.IngestWatchdog, svc *serviceLastSeen, now time.Time) bool {
+	for _, ignored := range w.IgnoreServices {
+		if svc.Service == ignored {
+			return false
+		}
+	}
+	return now.Sub(svc.LastSeen) >= w.After
+}
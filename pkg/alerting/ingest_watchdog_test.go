@@ -0,0 +1,27 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+func TestSilentService(t *testing.T) {
+	w := &bunapp.IngestWatchdog{
+		After:          10 * time.Minute,
+		IgnoreServices: []string{"cron"},
+	}
+	now := time.Date(2022, time.February, 1, 3, 0, 0, 0, time.UTC)
+
+	require.False(t, silentService(w, &serviceLastSeen{
+		Service: "api", LastSeen: now.Add(-5 * time.Minute),
+	}, now))
+	require.True(t, silentService(w, &serviceLastSeen{
+		Service: "api", LastSeen: now.Add(-10 * time.Minute),
+	}, now))
+	require.False(t, silentService(w, &serviceLastSeen{
+		Service: "cron", LastSeen: now.Add(-time.Hour),
+	}, now))
+}
@@ -0,0 +1,67 @@
+package alerting
+
+import (
+	"context"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/org"
+)
+
+func init() {
+	bunapp.OnStart("alerting.init", initAlerting)
+}
+
+func initAlerting(ctx context.Context, app *bunapp.App) error {
+	alerts, err := NewAlertManager(app)
+	if err != nil {
+		return err
+	}
+	app.OnServe("alerting.escalation", alerts.Run)
+
+	heartbeats, err := NewHeartbeatMonitor(app, alerts)
+	if err != nil {
+		return err
+	}
+	app.OnServe("alerting.heartbeats", heartbeats.Run)
+
+	checks, err := NewCheckMonitor(app, alerts)
+	if err != nil {
+		return err
+	}
+	app.OnServe("alerting.checks", checks.Run)
+
+	rules, err := NewRuleMonitor(app, alerts)
+	if err != nil {
+		return err
+	}
+	app.OnServe("alerting.rules", rules.Run)
+
+	watchdog := NewIngestWatchdogMonitor(app, alerts)
+	app.OnServe("alerting.ingest_watchdog", watchdog.Run)
+
+	alertHandler := NewAlertHandler(app, alerts)
+	heartbeatHandler := NewHeartbeatHandler(app, heartbeats)
+	checkHandler := NewCheckHandler(app, checks)
+	ruleHandler := NewRuleHandler(app, rules)
+
+	app.APIGroup().POST("/v1/checkins/:monitor", heartbeatHandler.Checkin)
+
+	g := app.APIGroup().
+		Use(org.NewAuthMiddleware(app)).
+		NewGroup("/alerting/:project_id")
+
+	g.GET("/alerts", alertHandler.List)
+	g.POST("/alerts/ack", alertHandler.Ack)
+	g.POST("/alerts/resolve", alertHandler.Resolve)
+	g.GET("/alerts/timeline", alertHandler.Timeline)
+	g.GET("/incidents", alertHandler.Incidents)
+	g.GET("/heartbeats", heartbeatHandler.List)
+	g.GET("/checks", checkHandler.List)
+	g.GET("/checks/:name/results", checkHandler.Results)
+	g.GET("/rules", ruleHandler.List)
+	g.POST("/rules/backtest", ruleHandler.Backtest)
+	g.GET("/rule-templates", ruleHandler.Templates)
+	g.POST("/rule-templates", ruleHandler.CreateFromTemplates)
+
+	return nil
+}
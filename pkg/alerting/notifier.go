@@ -0,0 +1,194 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, alert *Alert) error
+}
+
+func newNotifiers(configs []bunapp.Notifier) ([]Notifier, error) {
+	notifiers := make([]Notifier, 0, len(configs))
+	for i := range configs {
+		cfg := &configs[i]
+		if cfg.URL == "" && cfg.Type != "pagerduty" {
+			return nil, fmt.Errorf("notifier %q does not have a url", cfg.Name)
+		}
+
+		switch cfg.Type {
+		case "webhook":
+			notifiers = append(notifiers, &WebhookNotifier{name: cfg.Name, url: cfg.URL})
+		case "slack":
+			notifiers = append(notifiers, &SlackNotifier{name: cfg.Name, url: cfg.URL})
+		case "pagerduty":
+			if cfg.RoutingKey == "" {
+				return nil, fmt.Errorf("notifier %q does not have a routing_key", cfg.Name)
+			}
+			url := cfg.URL
+			if url == "" {
+				url = pagerDutyURL
+			}
+			notifiers = append(notifiers, &PagerDutyNotifier{
+				name:       cfg.Name,
+				url:        url,
+				routingKey: cfg.RoutingKey,
+			})
+		default:
+			return nil, fmt.Errorf("notifier %q has unsupported type %q", cfg.Name, cfg.Type)
+		}
+	}
+	return notifiers, nil
+}
+
+var httpClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+func postJSON(ctx context.Context, url string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+// WebhookNotifier posts alerts as JSON.
+type WebhookNotifier struct {
+	name string
+	url  string
+}
+
+var _ Notifier = (*WebhookNotifier)(nil)
+
+func (n *WebhookNotifier) Name() string {
+	return n.name
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, alert *Alert) error {
+	return postJSON(ctx, n.url, alert)
+}
+
+//------------------------------------------------------------------------------
+
+// SlackNotifier posts alerts to a Slack incoming webhook.
+type SlackNotifier struct {
+	name string
+	url  string
+}
+
+var _ Notifier = (*SlackNotifier)(nil)
+
+func (n *SlackNotifier) Name() string {
+	return n.name
+}
+
+func (n *SlackNotifier) Notify(ctx context.Context, alert *Alert) error {
+	var b strings.Builder
+
+	switch alert.State {
+	case AlertFiring:
+		b.WriteString(":red_circle: *[FIRING]* ")
+	case AlertAcked:
+		b.WriteString(":large_yellow_circle: *[ACKED by " + alert.AckedBy + "]* ")
+	case AlertResolved:
+		b.WriteString(":large_green_circle: *[RESOLVED]* ")
+	}
+	if alert.URL != "" {
+		b.WriteString("<" + alert.URL + "|" + alert.Name + ">")
+	} else {
+		b.WriteString(alert.Name)
+	}
+	if alert.threaded() {
+		fmt.Fprintf(&b, " (incident #%d, related to %q)", alert.IncidentID, alert.IncidentLead)
+	}
+	if alert.Message != "" {
+		b.WriteByte('\n')
+		b.WriteString(alert.Message)
+	}
+
+	return postJSON(ctx, n.url, map[string]string{
+		"text": b.String(),
+	})
+}
+
+//------------------------------------------------------------------------------
+
+const pagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutyNotifier sends alerts using PagerDuty Events API v2.
+type PagerDutyNotifier struct {
+	name       string
+	url        string
+	routingKey string
+}
+
+var _ Notifier = (*PagerDutyNotifier)(nil)
+
+func (n *PagerDutyNotifier) Name() string {
+	return n.name
+}
+
+func (n *PagerDutyNotifier) Notify(ctx context.Context, alert *Alert) error {
+	action := "trigger"
+	switch alert.State {
+	case AlertAcked:
+		action = "acknowledge"
+	case AlertResolved:
+		action = "resolve"
+	}
+
+	dedupKey := alert.Key
+	if alert.threaded() {
+		// Related alerts are added to the incident opened by the lead alert
+		// which is acknowledged and resolved together with the lead alert.
+		if action != "trigger" {
+			return nil
+		}
+		dedupKey = alert.IncidentLead
+	}
+
+	event := map[string]any{
+		"routing_key":  n.routingKey,
+		"event_action": action,
+		"dedup_key":    fmt.Sprintf("%d:%s", alert.ProjectID, dedupKey),
+		"payload": map[string]any{
+			"summary":        alert.Name,
+			"source":         "uptrace",
+			"severity":       "error",
+			"timestamp":      alert.FiredAt.Format(time.RFC3339),
+			"custom_details": alert,
+		},
+	}
+	if alert.URL != "" {
+		event["links"] = []map[string]string{{"href": alert.URL, "text": "Open in Uptrace"}}
+	}
+	return postJSON(ctx, n.url, event)
+}
@@ -0,0 +1,137 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/tracing"
+)
+
+type Rule struct {
+	*bunapp.AlertRule
+}
+
+func newRule(cfg *bunapp.AlertRule) (*Rule, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("rule does not have a name")
+	}
+	if cfg.Metric == "" {
+		return nil, fmt.Errorf("rule %q does not have a metric", cfg.Name)
+	}
+	switch cfg.Op {
+	case ">", ">=", "<", "<=":
+	default:
+		return nil, fmt.Errorf("rule %q has unsupported op %q", cfg.Name, cfg.Op)
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.Interval%time.Minute != 0 {
+		return nil, fmt.Errorf("rule %q interval must be a whole number of minutes", cfg.Name)
+	}
+	return &Rule{AlertRule: cfg}, nil
+}
+
+func (r *Rule) alertKey() string {
+	return "rule:" + r.Name
+}
+
+// numPoints returns the number of consecutive points that must match the condition.
+func (r *Rule) numPoints() int {
+	if n := int(r.For / r.Interval); n > 1 {
+		return n
+	}
+	return 1
+}
+
+func (r *Rule) matches(value float64) bool {
+	switch r.Op {
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "<":
+		return value < r.Threshold
+	case "<=":
+		return value <= r.Threshold
+	}
+	return false
+}
+
+func (r *Rule) selectMetric(
+	ctx context.Context, app *bunapp.App, gte, lt time.Time,
+) ([]tracing.MetricPoint, error) {
+	f := &tracing.SpanFilter{
+		App:       app,
+		ProjectID: r.ProjectID,
+		System:    r.System,
+		Query:     r.Query,
+	}
+	f.TimeGTE = gte
+	f.TimeLT = lt
+	return tracing.SelectSpanMetric(ctx, f, r.Metric, r.Interval)
+}
+
+// RuleAlert is a period when the rule fires.
+type RuleAlert struct {
+	FiredAt    time.Time `json:"firedAt"`
+	ResolvedAt time.Time `json:"resolvedAt,omitempty"`
+	// The value that triggered the alert.
+	Value float64 `json:"value"`
+	// The worst value during the period.
+	MaxValue float64 `json:"maxValue"`
+}
+
+// evalRule replays the rule against the points and returns when it would have fired.
+// A point becomes known at the end of its interval.
+// The last alert is not resolved if it is still firing at the last point.
+func evalRule(r *Rule, points []tracing.MetricPoint) []RuleAlert {
+	var alerts []RuleAlert
+	var firing *RuleAlert
+
+	numPoints := r.numPoints()
+	matched := 0
+
+	for _, point := range points {
+		if !r.matches(point.Value) {
+			matched = 0
+			if firing != nil {
+				firing.ResolvedAt = point.Time.Add(r.Interval)
+				alerts = append(alerts, *firing)
+				firing = nil
+			}
+			continue
+		}
+
+		matched++
+		if firing != nil {
+			if r.worse(point.Value, firing.MaxValue) {
+				firing.MaxValue = point.Value
+			}
+			continue
+		}
+		if matched >= numPoints {
+			firing = &RuleAlert{
+				FiredAt:  point.Time.Add(r.Interval),
+				Value:    point.Value,
+				MaxValue: point.Value,
+			}
+		}
+	}
+
+	if firing != nil {
+		alerts = append(alerts, *firing)
+	}
+	return alerts
+}
+
+func (r *Rule) worse(a, b float64) bool {
+	switch r.Op {
+	case "<", "<=":
+		return a < b
+	default:
+		return a > b
+	}
+}
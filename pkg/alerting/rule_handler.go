@@ -0,0 +1,167 @@
+package alerting
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/org"
+	"github.com/uptrace/uptrace/pkg/tracing"
+)
+
+type RuleHandler struct {
+	*bunapp.App
+
+	monitor *RuleMonitor
+}
+
+func NewRuleHandler(app *bunapp.App, monitor *RuleMonitor) *RuleHandler {
+	return &RuleHandler{
+		App:     app,
+		monitor: monitor,
+	}
+}
+
+func (h *RuleHandler) List(w http.ResponseWriter, req bunrouter.Request) error {
+	projectID, err := req.Params().Uint32("project_id")
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"rules": h.monitor.Rules(projectID),
+	})
+}
+
+type BacktestFilter struct {
+	*bunapp.App `urlstruct:"-"`
+
+	tracing.TimeFilter
+
+	ProjectID uint32
+}
+
+// Backtest replays the rule from the request body against historical spans
+// and returns when the rule would have fired.
+func (h *RuleHandler) Backtest(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	f := &BacktestFilter{App: h.App}
+	if err := bunapp.UnmarshalValues(req, f); err != nil {
+		return err
+	}
+
+	cfg := new(bunapp.AlertRule)
+	if err := json.NewDecoder(req.Body).Decode(cfg); err != nil {
+		return httperror.BadRequest("rule", err.Error())
+	}
+	cfg.ProjectID = f.ProjectID
+	if cfg.Name == "" {
+		cfg.Name = "backtest"
+	}
+
+	rule, err := newRule(cfg)
+	if err != nil {
+		return httperror.BadRequest("rule", err.Error())
+	}
+
+	if n := f.Duration() / rule.Interval; n > 10000 {
+		return httperror.BadRequest("time_range",
+			"time range contains too many intervals (%d > 10000)", n)
+	}
+
+	points, err := rule.selectMetric(ctx, h.App, f.TimeGTE, f.TimeLT)
+	if err != nil {
+		return err
+	}
+
+	alerts := evalRule(rule, points)
+	if alerts == nil {
+		alerts = make([]RuleAlert, 0)
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"rule":   rule,
+		"points": points,
+		"alerts": alerts,
+	})
+}
+
+func (h *RuleHandler) Templates(w http.ResponseWriter, req bunrouter.Request) error {
+	return httputil.JSON(w, bunrouter.H{
+		"templates": ruleTemplates,
+	})
+}
+
+type createFromTemplatesIn struct {
+	// Template names. All templates are used when empty.
+	Templates []string `json:"templates"`
+	// Optional service the rules are created for.
+	Service string `json:"service"`
+	// Thresholds that override the template defaults by template name.
+	Thresholds map[string]float64 `json:"thresholds"`
+}
+
+// CreateFromTemplates creates rules for the project from the templates. Rules that
+// already exist are skipped so the call can be repeated.
+func (h *RuleHandler) CreateFromTemplates(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	projectID, err := req.Params().Uint32("project_id")
+	if err != nil {
+		return err
+	}
+
+	project, err := org.SelectProjectByID(ctx, h.App, projectID)
+	if err != nil {
+		return err
+	}
+
+	in := new(createFromTemplatesIn)
+	if err := json.NewDecoder(req.Body).Decode(in); err != nil {
+		return httperror.BadRequest("templates", err.Error())
+	}
+
+	names := in.Templates
+	if len(names) == 0 {
+		for i := range ruleTemplates {
+			names = append(names, ruleTemplates[i].Name)
+		}
+	}
+
+	cfgs := make([]*bunapp.AlertRule, 0, len(names))
+	for _, name := range names {
+		tmpl := ruleTemplate(name)
+		if tmpl == nil {
+			return httperror.BadRequest("templates", "unknown rule template %q", name)
+		}
+		cfg := tmpl.alertRule(project.ID, in.Service)
+		if threshold, ok := in.Thresholds[name]; ok {
+			cfg.Threshold = threshold
+		}
+		cfgs = append(cfgs, cfg)
+	}
+
+	rules := make([]*Rule, 0, len(cfgs))
+	skipped := make([]string, 0)
+
+	for _, cfg := range cfgs {
+		rule, err := h.monitor.AddRule(cfg)
+		if err == errRuleExists {
+			skipped = append(skipped, cfg.Name)
+			continue
+		}
+		if err != nil {
+			return httperror.BadRequest("rule", err.Error())
+		}
+		rules = append(rules, rule)
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"rules":   rules,
+		"skipped": skipped,
+	})
+}
@@ -0,0 +1,161 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"go.uber.org/zap"
+)
+
+// RuleMonitor evaluates alert rules against recent spans.
+type RuleMonitor struct {
+	*bunapp.App
+
+	alerts *AlertManager
+
+	mu      sync.RWMutex
+	rules   []*Rule
+	running bool
+}
+
+func NewRuleMonitor(app *bunapp.App, alerts *AlertManager) (*RuleMonitor, error) {
+	m := &RuleMonitor{
+		App:    app,
+		alerts: alerts,
+	}
+
+	cfgs := app.Config().Alerting.Rules
+	for i := range cfgs {
+		rule, err := newRule(&cfgs[i])
+		if err != nil {
+			return nil, err
+		}
+		m.rules = append(m.rules, rule)
+	}
+
+	return m, nil
+}
+
+func (m *RuleMonitor) Rules(projectID uint32) []*Rule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rules []*Rule
+	for _, rule := range m.rules {
+		if rule.ProjectID == projectID {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func (m *RuleMonitor) Run(ctx context.Context, app *bunapp.App) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, rule := range m.rules {
+		m.start(rule)
+	}
+	m.running = true
+	return nil
+}
+
+var errRuleExists = errors.New("rule already exists")
+
+// AddRule starts evaluating the rule. Rules added at runtime are not saved
+// in the config so they are lost when the app restarts.
+func (m *RuleMonitor) AddRule(cfg *bunapp.AlertRule) (*Rule, error) {
+	rule, err := newRule(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, other := range m.rules {
+		if other.ProjectID == rule.ProjectID && other.Name == rule.Name {
+			return nil, errRuleExists
+		}
+	}
+
+	m.rules = append(m.rules, rule)
+	if m.running {
+		m.start(rule)
+	}
+	return rule, nil
+}
+
+func (m *RuleMonitor) start(rule *Rule) {
+	m.WaitGroup().Add(1)
+	go func() {
+		defer m.WaitGroup().Done()
+
+		m.runLoop(m.Context(), rule)
+	}()
+}
+
+func (m *RuleMonitor) runLoop(ctx context.Context, rule *Rule) {
+	for {
+		// Wait until the current interval is complete and the spans are flushed.
+		next := time.Now().Truncate(rule.Interval).Add(rule.Interval + 10*time.Second)
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-m.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := m.evalRule(ctx, rule); err != nil {
+			m.Zap(ctx).Error("evalRule failed",
+				zap.String("rule", rule.Name), zap.Error(err))
+		}
+	}
+}
+
+func (m *RuleMonitor) evalRule(ctx context.Context, rule *Rule) error {
+	lt := time.Now().Truncate(rule.Interval)
+	gte := lt.Add(-time.Duration(rule.numPoints()) * rule.Interval)
+
+	points, err := rule.selectMetric(ctx, m.App, gte, lt)
+	if err != nil {
+		return err
+	}
+
+	alerts := evalRule(rule, points)
+	if len(alerts) == 0 || !alerts[len(alerts)-1].ResolvedAt.IsZero() {
+		if len(points) > 0 && rule.matches(points[len(points)-1].Value) {
+			m.alerts.Pending(ctx, &Alert{
+				ProjectID: rule.ProjectID,
+				Service:   rule.Service,
+				Key:       rule.alertKey(),
+				Name:      rule.Name,
+				Message: fmt.Sprintf("%s %s %g (current value is %g)",
+					rule.Metric, rule.Op, rule.Threshold, points[len(points)-1].Value),
+			})
+			return nil
+		}
+
+		m.alerts.Resolve(ctx, rule.ProjectID, rule.alertKey())
+		return nil
+	}
+
+	alert := alerts[len(alerts)-1]
+	m.alerts.Fire(ctx, &Alert{
+		ProjectID: rule.ProjectID,
+		Service:   rule.Service,
+		DependsOn: rule.DependsOn,
+		Key:       rule.alertKey(),
+		Name:      rule.Name,
+		Message: fmt.Sprintf("%s %s %g (current value is %g)",
+			rule.Metric, rule.Op, rule.Threshold, alert.Value),
+		URL: m.Config().ExploreURL(rule.ProjectID, rule.System, rule.Query),
+	})
+	return nil
+}
@@ -0,0 +1,80 @@
+package alerting
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+// RuleTemplate is a recommended alert rule that can be created for a project
+// with one API call.
+type RuleTemplate struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	Metric    string        `json:"metric"`
+	Op        string        `json:"op"`
+	Threshold float64       `json:"threshold"`
+	Interval  time.Duration `json:"interval"`
+	For       time.Duration `json:"for"`
+}
+
+var ruleTemplates = []RuleTemplate{
+	{
+		Name:        "p99 regression",
+		Description: "The p99 span duration is above the threshold (1s by default) for 10 minutes.",
+		Metric:      "p99(span.duration)",
+		Op:          ">",
+		Threshold:   float64(time.Second),
+		Interval:    time.Minute,
+		For:         10 * time.Minute,
+	},
+	{
+		Name:        "error spike",
+		Description: "More than 5% of spans are errors for 5 minutes.",
+		Metric:      "span.error_pct",
+		Op:          ">",
+		Threshold:   0.05,
+		Interval:    time.Minute,
+		For:         5 * time.Minute,
+	},
+	{
+		Name:        "ingest stopped",
+		Description: "No spans are received for 10 minutes.",
+		Metric:      "span.count_per_min",
+		Op:          "<",
+		Threshold:   1,
+		Interval:    time.Minute,
+		For:         10 * time.Minute,
+	},
+}
+
+func ruleTemplate(name string) *RuleTemplate {
+	for i := range ruleTemplates {
+		if ruleTemplates[i].Name == name {
+			return &ruleTemplates[i]
+		}
+	}
+	return nil
+}
+
+// alertRule returns the rule config for the project. When the service is set,
+// the rule only selects spans of the service.
+func (t *RuleTemplate) alertRule(projectID uint32, service string) *bunapp.AlertRule {
+	rule := &bunapp.AlertRule{
+		Name:      t.Name,
+		ProjectID: projectID,
+		Metric:    t.Metric,
+		Op:        t.Op,
+		Threshold: t.Threshold,
+		Interval:  t.Interval,
+		For:       t.For,
+	}
+	if service != "" {
+		rule.Name += ": " + service
+		rule.Query = "where service.name = " + strconv.Quote(service)
+		rule.Service = service
+	}
+	return rule
+}
@@ -0,0 +1,59 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/tracing"
+)
+
+func TestEvalRule(t *testing.T) {
+	rule, err := newRule(&bunapp.AlertRule{
+		Name:      "errors",
+		Metric:    "span.error_pct",
+		Op:        ">",
+		Threshold: 0.1,
+		For:       2 * time.Minute,
+	})
+	require.NoError(t, err)
+
+	start := time.Date(2022, time.February, 1, 0, 0, 0, 0, time.UTC)
+	values := []float64{0, 0.2, 0, 0.2, 0.3, 0.5, 0, 0.2, 0.2}
+
+	points := make([]tracing.MetricPoint, len(values))
+	for i, value := range values {
+		points[i] = tracing.MetricPoint{
+			Time:  start.Add(time.Duration(i) * time.Minute),
+			Value: value,
+		}
+	}
+
+	alerts := evalRule(rule, points)
+	require.Equal(t, []RuleAlert{{
+		FiredAt:    start.Add(5 * time.Minute),
+		ResolvedAt: start.Add(7 * time.Minute),
+		Value:      0.3,
+		MaxValue:   0.5,
+	}, {
+		FiredAt:  start.Add(9 * time.Minute),
+		Value:    0.2,
+		MaxValue: 0.2,
+	}}, alerts)
+}
+
+func TestRuleTemplates(t *testing.T) {
+	for i := range ruleTemplates {
+		tmpl := &ruleTemplates[i]
+
+		rule, err := newRule(tmpl.alertRule(1, ""))
+		require.NoError(t, err, tmpl.Name)
+		require.Equal(t, tmpl.Name, rule.Name)
+	}
+
+	cfg := ruleTemplate("error spike").alertRule(2, "checkout")
+	require.Equal(t, "error spike: checkout", cfg.Name)
+	require.Equal(t, `where service.name = "checkout"`, cfg.Query)
+	require.Equal(t, "checkout", cfg.Service)
+}
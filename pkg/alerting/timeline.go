@@ -0,0 +1,41 @@
+package alerting
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/go-clickhouse/ch"
+	"go.uber.org/zap"
+)
+
+// AlertEvent is a state change in the alert timeline.
+type AlertEvent struct {
+	ch.CHModel `ch:"table:alert_events,alias:e"`
+
+	ProjectID uint32     `json:"projectId"`
+	AlertKey  string     `json:"alertKey" ch:",lc"`
+	AlertName string     `json:"alertName"`
+	State     AlertState `json:"state" ch:",lc"`
+	// User that changed the state or an empty string.
+	Actor      string    `json:"actor"`
+	Message    string    `json:"message"`
+	IncidentID uint64    `json:"incidentId"`
+	Time       time.Time `json:"time"`
+}
+
+func (m *AlertManager) record(ctx context.Context, alert *Alert, state AlertState, actor string) {
+	event := &AlertEvent{
+		ProjectID:  alert.ProjectID,
+		AlertKey:   alert.Key,
+		AlertName:  alert.Name,
+		State:      state,
+		Actor:      actor,
+		Message:    alert.Message,
+		IncidentID: alert.IncidentID,
+		Time:       time.Now(),
+	}
+
+	if _, err := m.CH().NewInsert().Model(event).Exec(ctx); err != nil {
+		m.Zap(ctx).Error("can't insert alert event", zap.Error(err))
+	}
+}
@@ -2,9 +2,11 @@ package bunapp
 
 import (
 	"context"
+	"math"
 	"math/rand"
 	"net/http"
 	"net/http/pprof"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -22,6 +24,7 @@ import (
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
 )
 
 type appCtxKey struct{}
@@ -71,6 +74,7 @@ type App struct {
 	startTime time.Time
 	cfg       *AppConfig
 
+	onServe   appHooks
 	onStop    appHooks
 	onStopped appHooks
 
@@ -81,6 +85,10 @@ type App struct {
 
 	grpcServer *grpc.Server
 
+	authThrottle  *AuthThrottle
+	blobStorage   BlobStorage
+	memoryLimiter *MemoryLimiter
+
 	chdb *ch.DB
 }
 
@@ -94,10 +102,15 @@ func New(ctx context.Context, cfg *AppConfig) *App {
 	app.ctx, app.ctxCancel = context.WithCancel(app.undoneCtx)
 
 	app.initZap()
+	app.initMemoryLimiter()
 	app.initRouter()
 	app.initGRPC()
 	app.initCH()
 
+	conf := &cfg.AuthThrottle
+	app.authThrottle = NewAuthThrottle(conf.MaxFailures, conf.Window, conf.Lockout)
+	app.blobStorage = newBlobStorage(cfg)
+
 	return app
 }
 
@@ -110,6 +123,16 @@ func (app *App) Stop() {
 	_ = app.onStopped.Run(app.undoneCtx, app)
 }
 
+// OnServe registers a hook that is called by the serve command after the HTTP and gRPC
+// servers are started, for example, to open additional listeners.
+func (app *App) OnServe(name string, fn HookFunc) {
+	app.onServe.Add(newHook(name, fn))
+}
+
+func (app *App) RunServeHooks(ctx context.Context) error {
+	return app.onServe.Run(ctx, app)
+}
+
 func (app *App) OnStop(name string, fn HookFunc) {
 	app.onStop.Add(newHook(name, fn))
 }
@@ -165,8 +188,13 @@ func (app *App) ZapLogger() *otelzap.Logger {
 	return app.logger
 }
 
+// Zap returns a logger that adds the trace and the request id from the context.
 func (app *App) Zap(ctx context.Context) otelzap.LoggerWithCtx {
-	return app.logger.Ctx(ctx)
+	log := app.logger.Ctx(ctx)
+	if id := RequestIDFromContext(ctx); id != "" {
+		log = log.WithOptions(zap.Fields(zap.String(requestIDAttr, id)))
+	}
+	return log
 }
 
 //------------------------------------------------------------------------------
@@ -224,9 +252,19 @@ func (app *App) httpErrorHandler(next bunrouter.HandlerFunc) bunrouter.HandlerFu
 		if statusCode >= 400 {
 			trace.SpanFromContext(req.Context()).RecordError(err)
 		}
+		if statusCode >= 500 {
+			app.Zap(req.Context()).Error("request failed",
+				zap.String("path", req.URL.Path), zap.Error(err))
+		}
 
+		if httpErr.RetryAfter > 0 {
+			seconds := int(math.Ceil(httpErr.RetryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		}
+		resp := *httpErr
+		resp.RequestID = RequestIDFromContext(req.Context())
 		w.WriteHeader(statusCode)
-		_ = bunrouter.JSON(w, httpErr)
+		_ = bunrouter.JSON(w, &resp)
 
 		return err
 	}
@@ -240,18 +278,80 @@ func (app *App) APIGroup() *bunrouter.Group {
 	return app.apiGroup
 }
 
+// BlobStorage returns nil when the blob storage is not configured.
+func (app *App) BlobStorage() BlobStorage {
+	return app.blobStorage
+}
+
+func (app *App) AuthThrottle() *AuthThrottle {
+	return app.authThrottle
+}
+
+func (app *App) initMemoryLimiter() {
+	app.memoryLimiter = newMemoryLimiter(app)
+	if !app.memoryLimiter.Enabled() {
+		return
+	}
+
+	app.WaitGroup().Add(1)
+	go func() {
+		defer app.WaitGroup().Done()
+		app.memoryLimiter.run(app.Context())
+	}()
+}
+
+func (app *App) MemoryLimiter() *MemoryLimiter {
+	return app.memoryLimiter
+}
+
 func (app *App) HTTPHandler() http.Handler {
-	return app.router
+	handler := app.ingestLimitHandler(app.router)
+	handler = app.memoryLimitHandler(handler)
+	handler = app.netPolicyHandler(handler)
+	handler = clientIPHandler(app, handler)
+	handler = requestIDHandler(handler)
+	return handler
 }
 
 //------------------------------------------------------------------------------
 
 func (app *App) initGRPC() {
-	app.grpcServer = grpc.NewServer(
-		grpc.UnaryInterceptor(otelgrpc.UnaryServerInterceptor()),
-		grpc.StreamInterceptor(otelgrpc.StreamServerInterceptor()),
-		grpc.ReadBufferSize(512<<10),
-	)
+	var keepaliveParams keepalive.ServerParameters
+	if age := app.cfg.Listen.GRPCMaxConnectionAge; age > 0 {
+		keepaliveParams.MaxConnectionAge = age
+		// Give in-flight exports time to complete.
+		keepaliveParams.MaxConnectionAgeGrace = 30 * time.Second
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.KeepaliveParams(keepaliveParams),
+		grpc.ChainUnaryInterceptor(
+			grpcRequestIDUnaryInterceptor,
+			app.grpcNetPolicyUnaryInterceptor,
+			app.grpcMemoryLimitUnaryInterceptor,
+			otelgrpc.UnaryServerInterceptor(),
+		),
+		grpc.ChainStreamInterceptor(
+			grpcRequestIDStreamInterceptor,
+			app.grpcNetPolicyStreamInterceptor,
+			app.grpcMemoryLimitStreamInterceptor,
+			otelgrpc.StreamServerInterceptor(),
+		),
+		grpc.ReadBufferSize(512 << 10),
+	}
+
+	conf := &app.cfg.Listen
+	if conf.GRPCInitialWindowSize > 0 {
+		opts = append(opts, grpc.InitialWindowSize(conf.GRPCInitialWindowSize))
+	}
+	if conf.GRPCInitialConnWindowSize > 0 {
+		opts = append(opts, grpc.InitialConnWindowSize(conf.GRPCInitialConnWindowSize))
+	}
+	if conf.GRPCMaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(conf.GRPCMaxConcurrentStreams))
+	}
+
+	app.grpcServer = grpc.NewServer(opts...)
 }
 
 func (app *App) GRPCServer() *grpc.Server {
@@ -272,10 +372,18 @@ func (app *App) initCH() {
 		WithNamedArg("TTL", ch.Safe(app.cfg.Retention.TTL))
 	db = db.WithFormatter(fmter)
 
+	if conf := app.cfg.CHQueryScheduler; conf.MaxConcurrent > 0 ||
+		conf.MaxConcurrentPerProject > 0 || conf.MaxConcurrentPerUser > 0 {
+		db.AddQueryHook(&querySchedulerHook{
+			scheduler: NewQueryScheduler(
+				conf.MaxConcurrent, conf.MaxConcurrentPerProject, conf.MaxConcurrentPerUser),
+		})
+	}
 	db.AddQueryHook(chdebug.NewQueryHook(
 		chdebug.WithVerbose(app.Debug()),
 		chdebug.FromEnv("DEBUG"),
 	))
+	db.AddQueryHook(&requestIDQueryHook{})
 	db.AddQueryHook(chotel.NewQueryHook())
 
 	app.chdb = db
@@ -0,0 +1,133 @@
+package bunapp
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/peer"
+)
+
+// AuthThrottle counts failed authentication attempts per client IP and temporarily
+// locks out clients that fail too often.
+type AuthThrottle struct {
+	maxFailures int
+	window      time.Duration
+	lockout     time.Duration
+
+	mu      sync.Mutex
+	clients map[string]*authClient
+}
+
+type authClient struct {
+	failures    int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+func NewAuthThrottle(maxFailures int, window, lockout time.Duration) *AuthThrottle {
+	return &AuthThrottle{
+		maxFailures: maxFailures,
+		window:      window,
+		lockout:     lockout,
+		clients:     make(map[string]*authClient),
+	}
+}
+
+// Locked reports whether the client is locked out.
+func (t *AuthThrottle) Locked(ip string) bool {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	client, ok := t.clients[ip]
+	return ok && now.Before(client.lockedUntil)
+}
+
+// Fail records a failed attempt and reports whether the client has been locked out.
+func (t *AuthThrottle) Fail(ip string) bool {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.removeExpired(now)
+
+	client, ok := t.clients[ip]
+	if !ok || now.Sub(client.windowStart) > t.window {
+		client = &authClient{windowStart: now}
+		t.clients[ip] = client
+	}
+
+	client.failures++
+	if client.failures < t.maxFailures {
+		return false
+	}
+
+	client.failures = 0
+	client.windowStart = now
+	client.lockedUntil = now.Add(t.lockout)
+	return true
+}
+
+func (t *AuthThrottle) removeExpired(now time.Time) {
+	for ip, client := range t.clients {
+		if now.Sub(client.windowStart) > t.window && !now.Before(client.lockedUntil) {
+			delete(t.clients, ip)
+		}
+	}
+}
+
+type AuthLockout struct {
+	IP          string    `json:"ip"`
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
+// Lockouts returns clients that are currently locked out.
+func (t *AuthThrottle) Lockouts() []AuthLockout {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	lockouts := make([]AuthLockout, 0)
+	for ip, client := range t.clients {
+		if now.Before(client.lockedUntil) {
+			lockouts = append(lockouts, AuthLockout{
+				IP:          ip,
+				LockedUntil: client.lockedUntil,
+			})
+		}
+	}
+
+	sort.Slice(lockouts, func(i, j int) bool {
+		return lockouts[i].LockedUntil.After(lockouts[j].LockedUntil)
+	})
+	return lockouts
+}
+
+//------------------------------------------------------------------------------
+
+type clientIPCtxKey struct{}
+
+func clientIPHandler(app *App, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(req.Context(), clientIPCtxKey{}, app.clientIP(req))
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// ClientIPFromContext returns the IP address of the HTTP or gRPC client.
+func ClientIPFromContext(ctx context.Context) net.IP {
+	if ip, ok := ctx.Value(clientIPCtxKey{}).(net.IP); ok {
+		return ip
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return parseAddrIP(p.Addr.String())
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package bunapp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthThrottle(t *testing.T) {
+	throttle := NewAuthThrottle(3, time.Minute, time.Hour)
+
+	require.False(t, throttle.Fail("1.2.3.4"))
+	require.False(t, throttle.Fail("1.2.3.4"))
+	require.False(t, throttle.Locked("1.2.3.4"))
+	require.True(t, throttle.Fail("1.2.3.4"))
+	require.True(t, throttle.Locked("1.2.3.4"))
+	require.False(t, throttle.Locked("5.6.7.8"))
+
+	lockouts := throttle.Lockouts()
+	require.Len(t, lockouts, 1)
+	require.Equal(t, "1.2.3.4", lockouts[0].IP)
+}
@@ -0,0 +1,228 @@
+package bunapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+var blobKeyRE = regexp.MustCompile(`^[\w-]+(/[\w-]+)*$`)
+
+// BlobStorage stores values that are too large for ClickHouse.
+type BlobStorage interface {
+	Put(ctx context.Context, key string, data []byte) error
+	// Get returns ErrBlobNotFound when the blob does not exist.
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+func newBlobStorage(cfg *AppConfig) BlobStorage {
+	conf := &cfg.BlobStorage
+	switch {
+	case conf.S3.URL != "":
+		return NewS3BlobStorage(
+			conf.S3.URL, conf.S3.Region, conf.S3.AccessKeyID, conf.S3.SecretAccessKey)
+	case conf.Disk != "":
+		return NewDiskBlobStorage(conf.Disk)
+	default:
+		return nil
+	}
+}
+
+func checkBlobKey(key string) error {
+	if !blobKeyRE.MatchString(key) {
+		return fmt.Errorf("invalid blob key: %q", key)
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+// DiskBlobStorage stores blobs as files in the directory.
+type DiskBlobStorage struct {
+	dir string
+}
+
+var _ BlobStorage = (*DiskBlobStorage)(nil)
+
+func NewDiskBlobStorage(dir string) *DiskBlobStorage {
+	return &DiskBlobStorage{
+		dir: dir,
+	}
+}
+
+func (s *DiskBlobStorage) Put(ctx context.Context, key string, data []byte) error {
+	if err := checkBlobKey(key); err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Write a temp file first so readers never see partial blobs.
+	f, err := ioutil.TempFile(filepath.Dir(path), ".blob-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (s *DiskBlobStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := checkBlobKey(key); err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	return b, err
+}
+
+//------------------------------------------------------------------------------
+
+// S3BlobStorage stores blobs in an S3 bucket using requests signed with AWS
+// Signature Version 4.
+type S3BlobStorage struct {
+	url             string
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+
+	client *http.Client
+}
+
+var _ BlobStorage = (*S3BlobStorage)(nil)
+
+func NewS3BlobStorage(url, region, accessKeyID, secretAccessKey string) *S3BlobStorage {
+	return &S3BlobStorage{
+		url:             strings.TrimSuffix(url, "/") + "/",
+		region:          region,
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *S3BlobStorage) Put(ctx context.Context, key string, data []byte) error {
+	if err := checkBlobKey(key); err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("s3: PUT %s failed: %s: %s", key, resp.Status, body)
+	}
+	return nil
+}
+
+func (s *S3BlobStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := checkBlobKey(key); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return ioutil.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, ErrBlobNotFound
+	default:
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("s3: GET %s failed: %s: %s", key, resp.Status, body)
+	}
+}
+
+func (s *S3BlobStorage) do(
+	ctx context.Context, method, key string, body []byte,
+) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.url+key, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, body, time.Now())
+	return s.client.Do(req)
+}
+
+// sign signs the request with AWS Signature Version 4 using the host,
+// x-amz-content-sha256, and x-amz-date headers.
+func (s *S3BlobStorage) sign(req *http.Request, body []byte, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payloadHash := sha256Hex(body)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	req.Header.Set("x-amz-date", amzDate)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" +
+		sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.secretAccessKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.accessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
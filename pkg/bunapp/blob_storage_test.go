@@ -0,0 +1,42 @@
+package bunapp
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskBlobStorage(t *testing.T) {
+	ctx := context.Background()
+	storage := NewDiskBlobStorage(t.TempDir())
+
+	require.NoError(t, storage.Put(ctx, "spans/ab/abcd", []byte("hello")))
+
+	b, err := storage.Get(ctx, "spans/ab/abcd")
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(b))
+
+	_, err = storage.Get(ctx, "spans/ab/missing")
+	require.Equal(t, ErrBlobNotFound, err)
+
+	require.Error(t, storage.Put(ctx, "../etc/passwd", nil))
+}
+
+func TestS3BlobStorageSign(t *testing.T) {
+	storage := NewS3BlobStorage(
+		"https://bucket.s3.amazonaws.com/blobs", "us-east-1", "AKID", "SECRET")
+
+	req, err := http.NewRequest(http.MethodGet, storage.url+"spans/ab/abcd", nil)
+	require.NoError(t, err)
+	storage.sign(req, nil, time.Date(2022, time.February, 10, 12, 0, 0, 0, time.UTC))
+
+	require.Equal(t, "20220210T120000Z", req.Header.Get("x-amz-date"))
+	auth := req.Header.Get("Authorization")
+	require.True(t, strings.HasPrefix(auth,
+		"AWS4-HMAC-SHA256 Credential=AKID/20220210/us-east-1/s3/aws4_request, "+
+			"SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="), auth)
+}
@@ -0,0 +1,103 @@
+package bunapp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// BodyCapture keeps HTTP bodies with allowed content types, redacts them, and
+// truncates them to MaxSize bytes.
+type BodyCapture struct {
+	Enabled bool `yaml:"enabled"`
+	MaxSize int  `yaml:"max_size"`
+	// Media types of captured bodies, for example, application/json.
+	// Bodies without a content type or with other types are dropped.
+	ContentTypes []string `yaml:"content_types"`
+	// Rules that are applied after the built-in rules.
+	RedactRules []RedactRule `yaml:"redact_rules"`
+
+	rules []redactRule
+}
+
+// RedactRule replaces matches of the regexp pattern. The replacement can refer to
+// submatches, for example, ${1}.
+type RedactRule struct {
+	Pattern string `yaml:"pattern"`
+	Replace string `yaml:"replace"`
+}
+
+type redactRule struct {
+	re      *regexp.Regexp
+	replace string
+}
+
+const redactedValue = "[REDACTED]"
+
+// defaultRedactRules can't be disabled. They redact common credential fields in JSON
+// and form bodies and bearer tokens.
+var defaultRedactRules = []redactRule{
+	{
+		re: regexp.MustCompile(`(?i)("(?:password|passwd|secret|token|api[_-]?key|authorization|` +
+			`access[_-]?token|refresh[_-]?token|client[_-]?secret)"\s*:\s*)"(?:[^"\\]|\\.)*"`),
+		replace: `${1}"` + redactedValue + `"`,
+	},
+	{
+		re: regexp.MustCompile(`(?i)((?:^|&)(?:password|passwd|secret|token|api[_-]?key|` +
+			`access[_-]?token|refresh[_-]?token|client[_-]?secret)=)[^&]*`),
+		replace: "${1}" + redactedValue,
+	},
+	{
+		re:      regexp.MustCompile(`(?i)(bearer\s+)[\w.~+/-]+=*`),
+		replace: "${1}" + redactedValue,
+	},
+}
+
+func (c *BodyCapture) init() error {
+	if c.MaxSize < 0 {
+		return fmt.Errorf("max_size must not be negative, got %d", c.MaxSize)
+	}
+	if c.MaxSize == 0 {
+		c.MaxSize = 64 << 10
+	}
+	if len(c.ContentTypes) == 0 {
+		c.ContentTypes = []string{
+			"application/json",
+			"application/x-www-form-urlencoded",
+			"text/plain",
+		}
+	}
+
+	c.rules = append([]redactRule(nil), defaultRedactRules...)
+	for i, rule := range c.RedactRules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("redact rule #%d: %w", i, err)
+		}
+		replace := rule.Replace
+		if replace == "" {
+			replace = redactedValue
+		}
+		c.rules = append(c.rules, redactRule{re: re, replace: replace})
+	}
+	return nil
+}
+
+// AllowsContentType reports whether bodies with the media type are captured.
+func (c *BodyCapture) AllowsContentType(mediaType string) bool {
+	for _, s := range c.ContentTypes {
+		if strings.EqualFold(s, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact applies the built-in and the configured redaction rules.
+func (c *BodyCapture) Redact(body string) string {
+	for i := range c.rules {
+		rule := &c.rules[i]
+		body = rule.re.ReplaceAllString(body, rule.replace)
+	}
+	return body
+}
@@ -0,0 +1,29 @@
+package bunapp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBodyCaptureRedact(t *testing.T) {
+	conf := &BodyCapture{
+		RedactRules: []RedactRule{{Pattern: `\d{4}-\d{4}-\d{4}-\d{4}`}},
+	}
+	require.NoError(t, conf.init())
+	require.Equal(t, 64<<10, conf.MaxSize)
+	require.True(t, conf.AllowsContentType("application/json"))
+	require.False(t, conf.AllowsContentType("image/png"))
+
+	require.Equal(t,
+		`{"user":"joe","password":"[REDACTED]","Access_Token" : "[REDACTED]"}`,
+		conf.Redact(`{"user":"joe","password":"p\"ss","Access_Token" : "abc"}`))
+	require.Equal(t,
+		"user=joe&password=[REDACTED]&client_secret=[REDACTED]",
+		conf.Redact("user=joe&password=pass&client_secret=xyz"))
+	require.Equal(t, "Authorization: Bearer [REDACTED]", conf.Redact("Authorization: Bearer eyJ.abc="))
+	require.Equal(t, `{"card":"[REDACTED]"}`, conf.Redact(`{"card":"1234-5678-9012-3456"}`))
+
+	conf.RedactRules = []RedactRule{{Pattern: `(`}}
+	require.Error(t, conf.init())
+}
@@ -1,10 +1,15 @@
 package bunapp
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -28,12 +33,88 @@ func ReadConfig(configFile, service string) (*AppConfig, error) {
 	cfg.Filepath = configFile
 	cfg.Service = service
 
+	if err := cfg.decryptSecrets(); err != nil {
+		return nil, err
+	}
+	cfg.Site.URLPrefix = normURLPrefix(cfg.Site.URLPrefix)
+
 	if len(cfg.Users) == 0 {
 		return nil, fmt.Errorf("config must contain at least one user")
 	}
 	if len(cfg.Projects) == 0 {
 		return nil, fmt.Errorf("config must contain at least one project")
 	}
+	if err := cfg.Retention.Sampling.validate(); err != nil {
+		return nil, fmt.Errorf("retention.sampling: %w", err)
+	}
+	if err := cfg.SpanLimits.init(&defaultSpanLimits); err != nil {
+		return nil, fmt.Errorf("span_limits: %w", err)
+	}
+	for i := range cfg.Projects {
+		project := &cfg.Projects[i]
+		if project.SpanLimits != nil {
+			if err := project.SpanLimits.init(&cfg.SpanLimits); err != nil {
+				return nil, fmt.Errorf("project %d: span_limits: %w", project.ID, err)
+			}
+		}
+		if project.RetentionSampling != nil {
+			if err := project.RetentionSampling.validate(); err != nil {
+				return nil, fmt.Errorf("project %d: retention_sampling: %w", project.ID, err)
+			}
+		}
+		if project.Archive != nil {
+			if err := project.Archive.validate(); err != nil {
+				return nil, fmt.Errorf("project %d: archive: %w", project.ID, err)
+			}
+		}
+		if project.IngestQuota != nil {
+			if err := project.IngestQuota.init(); err != nil {
+				return nil, fmt.Errorf("project %d: ingest_quota: %w", project.ID, err)
+			}
+		}
+		if project.IngestWatchdog != nil {
+			if err := project.IngestWatchdog.init(); err != nil {
+				return nil, fmt.Errorf("project %d: ingest_watchdog: %w", project.ID, err)
+			}
+		}
+		for j := range project.DerivedAttrs {
+			if err := project.DerivedAttrs[j].init(); err != nil {
+				return nil, fmt.Errorf("derived attr #%d of project %d: %w", j, project.ID, err)
+			}
+		}
+		for j := range project.RoutingRules {
+			rule := &project.RoutingRules[j]
+			if len(rule.Attrs) == 0 {
+				return nil, fmt.Errorf("routing rule #%d of project %d does not have attrs",
+					j, project.ID)
+			}
+			if !cfg.hasProject(rule.ProjectID) {
+				return nil, fmt.Errorf("routing rule #%d of project %d: project %d does not exist",
+					j, project.ID, rule.ProjectID)
+			}
+		}
+		for j := range project.StatusRules {
+			rule := &project.StatusRules[j]
+			if len(rule.Attrs) == 0 {
+				return nil, fmt.Errorf("status rule #%d of project %d does not have attrs",
+					j, project.ID)
+			}
+			switch rule.Status {
+			case "ok", "error":
+			default:
+				return nil, fmt.Errorf("status rule #%d of project %d must have status ok or error, got %q",
+					j, project.ID, rule.Status)
+			}
+		}
+	}
+
+	for i := range cfg.Users {
+		user := &cfg.Users[i]
+		if user.Role != "" && cfg.AttrPolicy(user.Role) == nil {
+			return nil, fmt.Errorf("user %q has role %q without an attr policy",
+				user.Username, user.Role)
+		}
+	}
 
 	httpHost, httpPort, err := net.SplitHostPort(cfg.Listen.HTTP)
 	if err != nil {
@@ -55,63 +136,1066 @@ func ReadConfig(configFile, service string) (*AppConfig, error) {
 	cfg.Listen.GRPCHost = grpcHost
 	cfg.Listen.GRPCPort = grpcPort
 
+	for _, opt := range []struct {
+		name  string
+		value int32
+	}{
+		{"listen.grpc_initial_window_size", cfg.Listen.GRPCInitialWindowSize},
+		{"listen.grpc_initial_conn_window_size", cfg.Listen.GRPCInitialConnWindowSize},
+	} {
+		// gRPC ignores windows smaller than the HTTP/2 default.
+		if opt.value != 0 && opt.value < 64<<10 {
+			return nil, fmt.Errorf("%s must be at least 65536 bytes", opt.name)
+		}
+	}
+
+	if len(cfg.Listen.ACME.Domains) > 0 {
+		if cfg.Listen.ACME.CacheDir == "" {
+			return nil, fmt.Errorf("listen.acme.cache_dir is required when ACME is enabled")
+		}
+		cfg.Site.Scheme = "https"
+	}
+
+	if cfg.Site.trustedProxies, err = parseCIDRs(cfg.Site.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("site.trusted_proxies: %w", err)
+	}
+	if err := cfg.NetworkPolicies.Ingest.init("network_policies.ingest"); err != nil {
+		return nil, err
+	}
+	if err := cfg.NetworkPolicies.API.init("network_policies.api"); err != nil {
+		return nil, err
+	}
+
+	if cfg.Listen.ReadTimeout == 0 {
+		cfg.Listen.ReadTimeout = 5 * time.Second
+	}
+	if cfg.Listen.WriteTimeout == 0 {
+		cfg.Listen.WriteTimeout = 5 * time.Second
+	}
+	if cfg.IngestLimits.MaxBodySize == 0 {
+		cfg.IngestLimits.MaxBodySize = 32 << 20
+	}
+	if cfg.IngestLimits.MaxConcurrentRequests == 0 {
+		cfg.IngestLimits.MaxConcurrentRequests = 512
+	}
+
+	if conf := &cfg.MemoryLimiter; conf.Limit > 0 {
+		if conf.SpikeLimit == 0 {
+			conf.SpikeLimit = conf.Limit / 5
+		}
+		if conf.SpikeLimit < 0 || conf.SpikeLimit >= conf.Limit {
+			return nil, fmt.Errorf("memory_limiter: spike_limit must be less than limit")
+		}
+		if conf.CheckInterval == 0 {
+			conf.CheckInterval = time.Second
+		}
+		if conf.RetryAfter == 0 {
+			conf.RetryAfter = 5 * time.Second
+		}
+	}
+
+	if cfg.Ingest.BatchSize < 0 || cfg.Ingest.FlushInterval < 0 || cfg.Ingest.MaxConcurrency < 0 {
+		return nil, fmt.Errorf("ingest: options must not be negative")
+	}
+	if cfg.Ingest.BatchSize == 0 {
+		cfg.Ingest.BatchSize = runtime.GOMAXPROCS(0) * 2000
+		if cfg.Ingest.BatchSize > 32000 {
+			cfg.Ingest.BatchSize = 32000
+		}
+	}
+	if cfg.Ingest.FlushInterval == 0 {
+		cfg.Ingest.FlushInterval = time.Second
+	}
+	if cfg.Ingest.MaxConcurrency == 0 {
+		cfg.Ingest.MaxConcurrency = runtime.GOMAXPROCS(0)
+	}
+	if err := cfg.Ingest.Kafka.init(); err != nil {
+		return nil, fmt.Errorf("ingest: kafka: %w", err)
+	}
+
+	if cfg.SpanFlush.Workers == 0 {
+		cfg.SpanFlush.Workers = cfg.Ingest.MaxConcurrency
+	}
+	if cfg.SpanFlush.QueueSize == 0 {
+		cfg.SpanFlush.QueueSize = cfg.SpanFlush.Workers
+	}
+	switch cfg.SpanFlush.Overflow {
+	case "":
+		cfg.SpanFlush.Overflow = SpanFlushBlock
+	case SpanFlushBlock, SpanFlushDrop:
+	default:
+		return nil, fmt.Errorf("span_flush: unsupported overflow: %q", cfg.SpanFlush.Overflow)
+	}
+
+	switch cfg.SpanBackpressure.Policy {
+	case "":
+		cfg.SpanBackpressure.Policy = SpanBackpressureBlock
+	case SpanBackpressureBlock, SpanBackpressureReject, SpanBackpressureDrop:
+	default:
+		return nil, fmt.Errorf("span_backpressure: unsupported policy: %q",
+			cfg.SpanBackpressure.Policy)
+	}
+	if cfg.SpanBackpressure.RetryAfter == 0 {
+		cfg.SpanBackpressure.RetryAfter = 5 * time.Second
+	}
+
+	if cfg.Statsd.FlushInterval == 0 {
+		cfg.Statsd.FlushInterval = 10 * time.Second
+	}
+
+	if cfg.SpanStorage.Backend == "" {
+		cfg.SpanStorage.Backend = "clickhouse"
+	}
+	if err := cfg.SpanStorage.Faults.validate(); err != nil {
+		return nil, fmt.Errorf("span_storage: faults: %w", err)
+	}
+	if err := cfg.SpanStorage.Retry.init(); err != nil {
+		return nil, fmt.Errorf("span_storage: retry: %w", err)
+	}
+	if cfg.SpanWAL.MaxSize == 0 {
+		cfg.SpanWAL.MaxSize = 1 << 30
+	}
+	if cfg.SpanWAL.ReplayInterval == 0 {
+		cfg.SpanWAL.ReplayInterval = 10 * time.Second
+	}
+	if cfg.SpanDedup.Disabled {
+		cfg.SpanDedup.Window = 0
+	} else if cfg.SpanDedup.Window == 0 {
+		cfg.SpanDedup.Window = 10 * time.Second
+	}
+
+	if cfg.Backup.S3.AccessKeyID != "" || cfg.Backup.S3.SecretAccessKey != "" {
+		return nil, fmt.Errorf("backup.s3: access_key_id and secret_access_key are not supported " +
+			"because they end up in query logs, use named_collection or ClickHouse s3 settings")
+	}
+
+	if cfg.BlobStorage.Disk != "" && cfg.BlobStorage.S3.URL != "" {
+		return nil, fmt.Errorf("blob_storage: disk and s3 can't be used together")
+	}
+	if cfg.BlobStorage.MinSize == 0 {
+		cfg.BlobStorage.MinSize = 8 << 10
+	}
+	if cfg.BlobStorage.PreviewSize == 0 {
+		cfg.BlobStorage.PreviewSize = 1 << 10
+	}
+	if cfg.BlobStorage.PreviewSize >= cfg.BlobStorage.MinSize {
+		return nil, fmt.Errorf("blob_storage: preview_size must be smaller than min_size")
+	}
+	if cfg.BlobStorage.S3.Region == "" {
+		cfg.BlobStorage.S3.Region = "us-east-1"
+	}
+	if err := cfg.BodyCapture.init(); err != nil {
+		return nil, fmt.Errorf("body_capture: %w", err)
+	}
+
+	if cfg.AuthThrottle.MaxFailures == 0 {
+		cfg.AuthThrottle.MaxFailures = 10
+	}
+	if cfg.AuthThrottle.Window == 0 {
+		cfg.AuthThrottle.Window = time.Minute
+	}
+	if cfg.AuthThrottle.Lockout == 0 {
+		cfg.AuthThrottle.Lockout = 15 * time.Minute
+	}
+
+	if cfg.Alerting.IncidentWindow == 0 {
+		cfg.Alerting.IncidentWindow = 10 * time.Minute
+	}
+	if cfg.Apdex.Threshold == 0 {
+		cfg.Apdex.Threshold = 500 * time.Millisecond
+	}
+
+	for _, opt := range []struct {
+		name  string
+		value *string
+	}{
+		{"ch_query_accuracy.distinct", &cfg.CHQueryAccuracy.Distinct},
+		{"ch_query_accuracy.quantiles", &cfg.CHQueryAccuracy.Quantiles},
+	} {
+		switch *opt.value {
+		case "":
+			*opt.value = AccuracyApprox
+		case AccuracyApprox, AccuracyExact:
+		default:
+			return nil, fmt.Errorf("%s must be %q or %q, got %q",
+				opt.name, AccuracyApprox, AccuracyExact, *opt.value)
+		}
+	}
+
+	for i := range cfg.Heartbeats {
+		hb := &cfg.Heartbeats[i]
+		if hb.Name == "" {
+			return nil, fmt.Errorf("heartbeat #%d does not have a name", i)
+		}
+		if hb.Schedule == "" && hb.Interval == 0 {
+			return nil, fmt.Errorf("heartbeat %q must have a schedule or an interval", hb.Name)
+		}
+	}
+
+	for i := range cfg.Checks {
+		check := &cfg.Checks[i]
+		if check.Name == "" {
+			return nil, fmt.Errorf("check #%d does not have a name", i)
+		}
+		if check.Target == "" {
+			return nil, fmt.Errorf("check %q does not have a target", check.Name)
+		}
+		if check.Interval == 0 {
+			check.Interval = time.Minute
+		}
+		if check.Timeout == 0 {
+			check.Timeout = 10 * time.Second
+		}
+		if check.TLSExpiryDays == 0 {
+			check.TLSExpiryDays = 14
+		}
+	}
+
 	return cfg, nil
 }
 
+const (
+	AccuracyApprox = "approx"
+	AccuracyExact  = "exact"
+)
+
+const (
+	SpanFlushBlock = "block"
+	SpanFlushDrop  = "drop"
+)
+
+const (
+	SpanBackpressureBlock  = "block"
+	SpanBackpressureReject = "reject"
+	SpanBackpressureDrop   = "drop"
+)
+
 type AppConfig struct {
 	Filepath string `yaml:"-"`
 	Service  string `yaml:"service"`
 
 	Debug     bool   `yaml:"debug"`
 	SecretKey string `yaml:"secret_key"`
+	// Previous secret keys that are only used to decrypt config values
+	// after the secret key is rotated.
+	OldSecretKeys []string `yaml:"old_secret_keys"`
 
 	Site struct {
 		Scheme string `yaml:"scheme"`
 		Host   string `yaml:"host"`
+		// Path prefix for deployments behind a reverse proxy, for example, /uptrace.
+		URLPrefix string `yaml:"url_prefix"`
+		// Use X-Forwarded-Proto and X-Forwarded-Host headers set by a reverse proxy
+		// to build links and DSNs.
+		TrustProxy bool `yaml:"trust_proxy"`
+		// Addresses of reverse proxies which X-Forwarded-For header is used to find
+		// the client IP address for network_policies and the auth throttle.
+		TrustedProxies []string `yaml:"trusted_proxies"`
+
+		trustedProxies []*net.IPNet
 	} `yaml:"site"`
 
 	Listen struct {
 		HTTP string `yaml:"http"`
 		GRPC string `yaml:"grpc"`
+		XRay string `yaml:"xray"`
+		// Syslog listeners for RFC 5424 and RFC 3164 messages.
+		SyslogUDP string `yaml:"syslog_udp"`
+		SyslogTCP string `yaml:"syslog_tcp"`
+		// StatsD and DogStatsD UDP listener.
+		Statsd string `yaml:"statsd"`
 
 		HTTPHost string `yaml:"-"`
 		HTTPPort string `yaml:"-"`
 
 		GRPCHost string `yaml:"-"`
 		GRPCPort string `yaml:"-"`
+
+		// Close gRPC connections after that duration so clients that keep long-lived
+		// connections, for example, the OpenTelemetry Collector loadbalancing exporter,
+		// reconnect and spread the load across new Uptrace instances.
+		GRPCMaxConnectionAge time.Duration `yaml:"grpc_max_connection_age"`
+
+		// HTTP/2 flow control windows in bytes. Larger windows let high-throughput
+		// collectors send more data without waiting for acknowledgements.
+		GRPCInitialWindowSize     int32 `yaml:"grpc_initial_window_size"`
+		GRPCInitialConnWindowSize int32 `yaml:"grpc_initial_conn_window_size"`
+		// Max number of concurrent exports per connection so a few busy collectors
+		// can't take all workers from smaller agents.
+		GRPCMaxConcurrentStreams uint32 `yaml:"grpc_max_concurrent_streams"`
+
+		// Timeouts for reading requests and writing responses by the HTTP listener.
+		ReadTimeout  time.Duration `yaml:"read_timeout"`
+		WriteTimeout time.Duration `yaml:"write_timeout"`
+
+		// Obtain TLS certificates for the HTTP listener from Let's Encrypt.
+		ACME struct {
+			Domains []string `yaml:"domains"`
+			Email   string   `yaml:"email"`
+			// Certificates are stored in the dir and reused after restarts.
+			CacheDir string `yaml:"cache_dir"`
+		} `yaml:"acme"`
 	} `yaml:"listen"`
 
+	// Client networks that can connect to the ingest endpoints (OTLP, X-Ray, Sentry,
+	// and heartbeats) and to the API and UI.
+	NetworkPolicies struct {
+		Ingest NetPolicy `yaml:"ingest"`
+		API    NetPolicy `yaml:"api"`
+	} `yaml:"network_policies"`
+
+	// Limits for the HTTP ingest endpoints.
+	IngestLimits struct {
+		// Max size of a decompressed request body in bytes.
+		MaxBodySize int64 `yaml:"max_body_size"`
+		// Requests over the limit are rejected with 429 Too Many Requests.
+		MaxConcurrentRequests int `yaml:"max_concurrent_requests"`
+	} `yaml:"ingest_limits"`
+
+	// Ingest requests are refused while the heap is over limit minus spike_limit.
+	MemoryLimiter struct {
+		// Max heap size in bytes. The limiter is disabled when it is zero.
+		Limit int64 `yaml:"limit"`
+		// Defaults to 20% of the limit.
+		SpikeLimit    int64         `yaml:"spike_limit"`
+		CheckInterval time.Duration `yaml:"check_interval"`
+		// Retry-After hint for refused requests.
+		RetryAfter time.Duration `yaml:"retry_after"`
+	} `yaml:"memory_limiter"`
+
+	// Batching of received spans, logs, and metrics before they are inserted.
+	Ingest struct {
+		// Max number of spans, logs, or measures in a batch.
+		BatchSize int `yaml:"batch_size"`
+		// Incomplete batches are inserted after the interval.
+		FlushInterval time.Duration `yaml:"flush_interval"`
+		// Max number of concurrent inserts of logs and metrics and the default
+		// number of span_flush workers.
+		MaxConcurrency int `yaml:"max_concurrency"`
+		// Consumes OTLP trace requests from a Kafka topic. Disabled when brokers is empty.
+		Kafka IngestKafka `yaml:"kafka"`
+	} `yaml:"ingest"`
+
+	// Workers that insert batches of spans and the queue of batches waiting for them.
+	SpanFlush struct {
+		Workers   int `yaml:"workers"`
+		QueueSize int `yaml:"queue_size"`
+		// What to do with a batch when the queue is full: block waits for a worker
+		// and slows down receivers, drop discards the batch.
+		Overflow string `yaml:"overflow"`
+	} `yaml:"span_flush"`
+
+	// What receivers do when spans, logs, or metrics arrive faster than they are processed.
+	SpanBackpressure struct {
+		// block waits until the spans are queued, reject fails requests with
+		// RESOURCE_EXHAUSTED or 429 Too Many Requests so exporters retry later,
+		// drop discards the spans.
+		Policy string `yaml:"policy"`
+		// Retry-After hint for rejected requests.
+		RetryAfter time.Duration `yaml:"retry_after"`
+	} `yaml:"span_backpressure"`
+
+	// Limits that are applied to received spans like OpenTelemetry SDKs do.
+	// Projects can override them with the span_limits option.
+	SpanLimits SpanLimits `yaml:"span_limits"`
+
+	// Resource attributes that identify a service in span groups and service analytics.
+	ServiceGrouping ServiceGrouping `yaml:"service_grouping"`
+
+	// Clients that fail to authenticate with a DSN or a project token max_failures
+	// times within the window are rejected for the lockout duration.
+	AuthThrottle struct {
+		MaxFailures int           `yaml:"max_failures"`
+		Window      time.Duration `yaml:"window"`
+		Lockout     time.Duration `yaml:"lockout"`
+	} `yaml:"auth_throttle"`
+
 	DB BunConfig `yaml:"db"`
 	CH CHConfig  `yaml:"ch"`
 
+	SpanStorage struct {
+		// Backend that stores spans. Backends other than clickhouse are registered
+		// with tracing.RegisterSpanStorage.
+		Backend string `yaml:"backend"`
+		// Injects insert failures to test retries and backpressure. Don't use in production.
+		Faults SpanStorageFaults `yaml:"faults"`
+		// Retries of failed inserts before the spans are dropped.
+		Retry SpanStorageRetry `yaml:"retry"`
+	} `yaml:"span_storage"`
+
+	// Directory where batches that failed to insert are stored until ClickHouse
+	// is available again. Failed batches are dropped when dir is empty.
+	SpanWAL struct {
+		Dir string `yaml:"dir"`
+		// Max size of the stored batches in bytes. Batches are dropped when the
+		// directory is full.
+		MaxSize        int64         `yaml:"max_size"`
+		ReplayInterval time.Duration `yaml:"replay_interval"`
+	} `yaml:"span_wal"`
+
+	// Spans that were received within the window are dropped so exports that are
+	// retried by collectors don't insert the same spans twice.
+	SpanDedup struct {
+		Disabled bool          `yaml:"disabled"`
+		Window   time.Duration `yaml:"window"`
+	} `yaml:"span_dedup"`
+
 	Retention struct {
 		TTL string `yaml:"ttl"`
+		// Per-table TTLs that cap the TTL of the table, for example, spans_data: 7 DAY.
+		Tables   map[string]string `yaml:"tables"`
+		Sampling RetentionSampling `yaml:"sampling"`
 	} `yaml:"retention"`
 
+	Apdex struct {
+		// Spans that take up to the threshold are satisfied, up to 4 thresholds
+		// are tolerating, and slower or failed spans are frustrated.
+		Threshold time.Duration `yaml:"threshold"`
+	} `yaml:"apdex"`
+
+	Backup struct {
+		// Cron expression, for example, "0 2 * * *". Scheduled backups are disabled
+		// when it is empty.
+		Schedule string `yaml:"schedule"`
+		// ClickHouse disk configured as a backup destination.
+		Disk string `yaml:"disk"`
+		// S3 bucket used instead of the disk. Credentials are not passed in the BACKUP
+		// query because queries are logged and traced; they are configured in ClickHouse.
+		S3 struct {
+			// Bucket URL, for example, https://bucket.s3.amazonaws.com/uptrace/, that
+			// matches an endpoint with credentials in the ClickHouse s3 settings.
+			URL string `yaml:"url"`
+			// ClickHouse named collection with the url and the credentials that is used
+			// instead of the url.
+			NamedCollection string `yaml:"named_collection"`
+
+			// Not supported, ReadConfig returns an error when they are set.
+			AccessKeyID     string `yaml:"access_key_id"`
+			SecretAccessKey string `yaml:"secret_access_key"`
+		} `yaml:"s3"`
+	} `yaml:"backup"`
+
+	// Span names and attribute values larger than min_size are stored in the blob
+	// storage and ClickHouse keeps a preview of preview_size characters.
+	BlobStorage struct {
+		// Directory that stores the values.
+		Disk string `yaml:"disk"`
+		// S3 bucket URL used instead of the disk, for example,
+		// https://bucket.s3.amazonaws.com/uptrace/blobs/.
+		S3 struct {
+			URL             string `yaml:"url"`
+			Region          string `yaml:"region"`
+			AccessKeyID     string `yaml:"access_key_id"`
+			SecretAccessKey string `yaml:"secret_access_key"`
+		} `yaml:"s3"`
+		MinSize     int `yaml:"min_size"`
+		PreviewSize int `yaml:"preview_size"`
+	} `yaml:"blob_storage"`
+
+	// Capture of request and response bodies that instrumentations record in the
+	// http.request.body and http.response.body attributes. The attributes are
+	// dropped unless the capture is enabled.
+	BodyCapture BodyCapture `yaml:"body_capture"`
+
+	XRay struct {
+		// Project that receives segments sent via the X-Ray daemon UDP protocol.
+		ProjectID uint32 `yaml:"project_id"`
+	} `yaml:"xray"`
+
+	Syslog struct {
+		// Project that receives messages sent to listen.syslog_udp and listen.syslog_tcp.
+		ProjectID uint32 `yaml:"project_id"`
+	} `yaml:"syslog"`
+
+	Statsd struct {
+		// Project that receives metrics sent to listen.statsd.
+		ProjectID uint32 `yaml:"project_id"`
+		// How often aggregated counters, gauges, timers, and sets are stored.
+		FlushInterval time.Duration `yaml:"flush_interval"`
+	} `yaml:"statsd"`
+
+	Jaeger struct {
+		// Project that receives spans from Jaeger clients and jaeger-agent
+		// when the uptrace-dsn header is not set.
+		ProjectID uint32 `yaml:"project_id"`
+	} `yaml:"jaeger"`
+
+	Datadog struct {
+		// Project that receives spans from dd-trace libraries when the uptrace-dsn
+		// header is not set.
+		ProjectID uint32 `yaml:"project_id"`
+	} `yaml:"datadog"`
+
+	Alerting struct {
+		// Notifiers receive notifications about firing and resolved alerts.
+		Notifiers      []Notifier      `yaml:"notifiers"`
+		Rules          []AlertRule     `yaml:"rules"`
+		CompositeRules []CompositeRule `yaml:"composite_rules"`
+
+		OnCall             []OnCallSchedule   `yaml:"oncall"`
+		EscalationPolicies []EscalationPolicy `yaml:"escalation_policies"`
+
+		// Alerts that fire within that duration of each other and belong to
+		// the same or connected services are grouped into one incident.
+		IncidentWindow time.Duration `yaml:"incident_window"`
+	} `yaml:"alerting"`
+
+	Heartbeats []Heartbeat `yaml:"heartbeats"`
+	Checks     []Check     `yaml:"checks"`
+
 	Users    []User    `yaml:"users"`
 	Projects []Project `yaml:"projects"`
 
-	CHSelectLimits struct {
-		SampleRows     int64 `yaml:"sample_rows"`
-		MaxRowsToRead  int64 `yaml:"max_rows_to_read"`
-		MaxBytesToRead int64 `yaml:"max_bytes_to_read"`
-	} `yaml:"ch_select_limits"`
+	// Policies that hide or mask span attributes from users with the role.
+	AttrPolicies []AttrPolicy `yaml:"attr_policies"`
+
+	CHSelectLimits CHSelectLimits `yaml:"ch_select_limits"`
+
+	// Limits on concurrent queries from the UI and the API. Queries over the limits wait
+	// in a queue that is shared fairly between users.
+	CHQueryScheduler struct {
+		MaxConcurrent           int `yaml:"max_concurrent"`
+		MaxConcurrentPerProject int `yaml:"max_concurrent_per_project"`
+		MaxConcurrentPerUser    int `yaml:"max_concurrent_per_user"`
+	} `yaml:"ch_query_scheduler"`
+
+	// Default accuracy of distinct counts and quantiles: approx or exact.
+	CHQueryAccuracy struct {
+		Distinct  string `yaml:"distinct"`
+		Quantiles string `yaml:"quantiles"`
+	} `yaml:"ch_query_accuracy"`
+}
+
+// CHSelectLimits limit the rows read by queries on spans_index. Queries stop reading
+// when they hit a limit and return partial results.
+type CHSelectLimits struct {
+	SampleRows     int64 `yaml:"sample_rows"`
+	MaxRowsToRead  int64 `yaml:"max_rows_to_read"`
+	MaxBytesToRead int64 `yaml:"max_bytes_to_read"`
 }
 
 type User struct {
 	ID       uint64 `yaml:"id" json:"id"`
 	Username string `yaml:"username" json:"username"`
 	Password string `yaml:"password" json:"-"`
+	// Admins can manage ClickHouse tables, for example, drop partitions.
+	Admin bool `yaml:"admin" json:"admin"`
+	// Role selects the attribute policy that applies to the user.
+	Role string `yaml:"role" json:"role,omitempty"`
+}
+
+// AttrPolicy hides or masks span attributes in query results for users with the role.
+// Attribute keys can end with * to match all keys with the prefix,
+// for example, http.request.header.*.
+type AttrPolicy struct {
+	Role string   `yaml:"role"`
+	Hide []string `yaml:"hide"`
+	Mask []string `yaml:"mask"`
+}
+
+// Hidden reports whether the attribute must be removed from results.
+func (p *AttrPolicy) Hidden(key string) bool {
+	return p != nil && matchAttrKey(p.Hide, key)
+}
+
+// Masked reports whether the attribute value must be replaced in results.
+func (p *AttrPolicy) Masked(key string) bool {
+	return p != nil && matchAttrKey(p.Mask, key)
+}
+
+// Restricted reports whether the attribute can't be used to filter and group spans.
+func (p *AttrPolicy) Restricted(key string) bool {
+	return p.Hidden(key) || p.Masked(key)
+}
+
+func matchAttrKey(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(key, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+			continue
+		}
+		if key == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// AttrPolicy returns the attribute policy for the role or nil.
+func (c *AppConfig) AttrPolicy(role string) *AttrPolicy {
+	if role == "" {
+		return nil
+	}
+	for i := range c.AttrPolicies {
+		if policy := &c.AttrPolicies[i]; policy.Role == role {
+			return policy
+		}
+	}
+	return nil
 }
 
 type Project struct {
 	ID    uint32 `yaml:"id" json:"id"`
 	Name  string `yaml:"name" json:"name"`
 	Token string `yaml:"token" json:"token"`
+	// Overrides Retention.TTL for the project, for example, 7 DAY.
+	TTL string `yaml:"ttl" json:"ttl,omitempty"`
+	// Override Apdex.Threshold for the project and for span groups.
+	ApdexThreshold time.Duration            `yaml:"apdex_threshold" json:"-"`
+	ApdexGroups    map[uint64]time.Duration `yaml:"apdex_groups" json:"-"`
+	// Rules that override span status codes set by SDKs.
+	StatusRules []StatusRule `yaml:"status_rules" json:"-"`
+	// Overrides Retention.Sampling for the project.
+	RetentionSampling *RetentionSampling `yaml:"retention_sampling" json:"-"`
+	// Rules that move spans received with the project DSN to other projects.
+	RoutingRules []RoutingRule `yaml:"routing_rules" json:"-"`
+	// Overrides SpanLimits for the project.
+	SpanLimits *SpanLimits `yaml:"span_limits" json:"-"`
+	// Alerts when a service that sent spans recently stops sending them.
+	IngestWatchdog *IngestWatchdog `yaml:"ingest_watchdog" json:"-"`
+	// Archived projects reject new data and are shown read-only.
+	Archive *ProjectArchive `yaml:"archive" json:"archive,omitempty"`
+	// Limits spans received with the project DSN.
+	IngestQuota *IngestQuota `yaml:"ingest_quota" json:"-"`
+	// Resource attributes added to spans and logs that don't have them.
+	ResourceAttrs map[string]string `yaml:"resource_attrs" json:"-"`
+	// Attributes computed from other attributes when spans are received.
+	DerivedAttrs []DerivedAttr `yaml:"derived_attrs" json:"-"`
+}
+
+func (p *Project) Archived() bool {
+	return p.Archive != nil
+}
+
+// ProjectArchive is the archive date and when to delete the project data.
+type ProjectArchive struct {
+	Date time.Time `yaml:"date" json:"date"`
+	// Data is deleted purge_after the archive date. It is kept when purge_after is 0.
+	PurgeAfter time.Duration `yaml:"purge_after" json:"purgeAfter"`
+}
+
+// IngestQuota limits the rate of received spans and the size of received requests
+// per UTC day. Requests over the limits are rejected with RESOURCE_EXHAUSTED or
+// 429 Too Many Requests.
+type IngestQuota struct {
+	SpansPerSecond float64 `yaml:"spans_per_second"`
+	// Max spans that are accepted at once. Defaults to spans_per_second.
+	Burst       int   `yaml:"burst"`
+	BytesPerDay int64 `yaml:"bytes_per_day"`
+}
+
+func (q *IngestQuota) init() error {
+	if q.SpansPerSecond < 0 || q.Burst < 0 || q.BytesPerDay < 0 {
+		return fmt.Errorf("options must not be negative")
+	}
+	if q.SpansPerSecond == 0 && q.BytesPerDay == 0 {
+		return fmt.Errorf("spans_per_second or bytes_per_day is required")
+	}
+	if q.Burst == 0 {
+		q.Burst = int(math.Ceil(q.SpansPerSecond))
+	}
+	return nil
+}
+
+// PurgeTime returns the zero time when the data is kept.
+func (a *ProjectArchive) PurgeTime() time.Time {
+	if a.PurgeAfter == 0 {
+		return time.Time{}
+	}
+	return a.Date.Add(a.PurgeAfter)
+}
+
+func (a *ProjectArchive) validate() error {
+	if a.Date.IsZero() {
+		return errors.New("date is required, for example, 2022-03-01")
+	}
+	if a.PurgeAfter < 0 {
+		return fmt.Errorf("purge_after must not be negative, got %s", a.PurgeAfter)
+	}
+	return nil
+}
+
+// IngestWatchdog fires an alert for each service that did not send spans for
+// the After duration. Only services that sent spans within ActiveWithin are watched.
+type IngestWatchdog struct {
+	After        time.Duration `yaml:"after"`
+	ActiveWithin time.Duration `yaml:"active_within"`
+	// Services that are not watched, for example, cron jobs.
+	IgnoreServices []string `yaml:"ignore_services"`
+}
+
+func (w *IngestWatchdog) init() error {
+	if w.After == 0 {
+		w.After = 10 * time.Minute
+	}
+	if w.After < time.Minute {
+		return fmt.Errorf("after must be at least 1m, got %s", w.After)
+	}
+	if w.ActiveWithin == 0 {
+		w.ActiveWithin = 24 * time.Hour
+	}
+	if w.ActiveWithin <= w.After {
+		return fmt.Errorf("active_within must be greater than after (%s), got %s",
+			w.After, w.ActiveWithin)
+	}
+	return nil
+}
+
+// RoutingRule sends spans whose resource has all the attributes to the project.
+type RoutingRule struct {
+	// Resource attribute values, for example, k8s.namespace.name: payments.
+	Attrs     map[string]string `yaml:"attrs"`
+	ProjectID uint32            `yaml:"project_id"`
+}
+
+func (c *AppConfig) hasProject(id uint32) bool {
+	for i := range c.Projects {
+		if c.Projects[i].ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// RetentionSampling deletes spans of traces that are older than AfterDays except
+// error traces and KeepPct percent of other traces.
+type RetentionSampling struct {
+	// Sampling is disabled when it is zero.
+	AfterDays int     `yaml:"after_days"`
+	KeepPct   float64 `yaml:"keep_pct"`
+}
+
+func (s *RetentionSampling) validate() error {
+	if s.AfterDays < 0 {
+		return fmt.Errorf("after_days must not be negative, got %d", s.AfterDays)
+	}
+	if s.KeepPct < 0 || s.KeepPct > 100 {
+		return fmt.Errorf("keep_pct must be between 0 and 100, got %g", s.KeepPct)
+	}
+	return nil
+}
+
+// RetentionSampling returns the retention sampling of the project or nil
+// if sampling is disabled.
+func (c *AppConfig) RetentionSampling(project *Project) *RetentionSampling {
+	sampling := &c.Retention.Sampling
+	if project.RetentionSampling != nil {
+		sampling = project.RetentionSampling
+	}
+	if sampling.AfterDays == 0 {
+		return nil
+	}
+	return sampling
+}
+
+// SpanStorageFaults makes the clickhouse span storage inserts fail or slow down.
+// error_rate is the share of table inserts that fail without storing anything and
+// partial_rate is the share of inserts that store half of the rows before failing.
+// Both are retried with span_storage.retry.
+type SpanStorageFaults struct {
+	ErrorRate   float64       `yaml:"error_rate"`
+	PartialRate float64       `yaml:"partial_rate"`
+	Latency     time.Duration `yaml:"latency"`
+}
+
+func (f *SpanStorageFaults) Enabled() bool {
+	return f.ErrorRate > 0 || f.PartialRate > 0 || f.Latency > 0
+}
+
+func (f *SpanStorageFaults) validate() error {
+	if f.ErrorRate < 0 || f.PartialRate < 0 || f.ErrorRate+f.PartialRate > 1 {
+		return fmt.Errorf("error_rate and partial_rate must be between 0 and 1 in total, got %g and %g",
+			f.ErrorRate, f.PartialRate)
+	}
+	if f.Latency < 0 {
+		return fmt.Errorf("latency must not be negative, got %s", f.Latency)
+	}
+	return nil
+}
+
+// SpanStorageRetry retries inserts that fail with network errors and ClickHouse
+// errors that are likely temporary, for example, TOO_MANY_PARTS. The backoff is
+// doubled after each attempt up to max_backoff and randomized by up to 50%.
+type SpanStorageRetry struct {
+	MaxAttempts int `yaml:"max_attempts"`
+	// Inserts are not retried after max_age since the first attempt.
+	MaxAge     time.Duration `yaml:"max_age"`
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+}
+
+func (r *SpanStorageRetry) init() error {
+	if r.MaxAttempts < 0 || r.MaxAge < 0 || r.Backoff < 0 || r.MaxBackoff < 0 {
+		return fmt.Errorf("options must not be negative")
+	}
+	if r.MaxAttempts == 0 {
+		r.MaxAttempts = 5
+	}
+	if r.MaxAge == 0 {
+		r.MaxAge = time.Minute
+	}
+	if r.Backoff == 0 {
+		r.Backoff = 100 * time.Millisecond
+	}
+	if r.MaxBackoff == 0 {
+		r.MaxBackoff = 10 * time.Second
+	}
+	return nil
+}
+
+// IngestKafka consumes ExportTraceServiceRequest messages, for example, produced by
+// the OpenTelemetry Collector kafka exporter. The project is selected using the
+// uptrace-dsn message header or the dsn option.
+type IngestKafka struct {
+	Brokers []string `yaml:"brokers"`
+	Topic   string   `yaml:"topic"`
+	// Consumer group that stores the committed offsets.
+	Group string `yaml:"group"`
+	DSN   string `yaml:"dsn"`
+	// Either otlp_proto (default) or otlp_json.
+	Encoding string `yaml:"encoding"`
+}
+
+const (
+	KafkaEncodingProto = "otlp_proto"
+	KafkaEncodingJSON  = "otlp_json"
+)
+
+func (k *IngestKafka) init() error {
+	if len(k.Brokers) == 0 {
+		return nil
+	}
+	if k.Topic == "" || k.Group == "" {
+		return fmt.Errorf("topic and group are required")
+	}
+	switch k.Encoding {
+	case "":
+		k.Encoding = KafkaEncodingProto
+	case KafkaEncodingProto, KafkaEncodingJSON:
+	default:
+		return fmt.Errorf("unsupported encoding %q", k.Encoding)
+	}
+	return nil
+}
+
+// ServiceGrouping builds the service key from resource attributes. By default services
+// with the same service.name in different service.namespace are different services,
+// for example, shop/api and billing/api.
+type ServiceGrouping struct {
+	Attrs []string `yaml:"attrs"`
+}
+
+var defaultServiceGroupingAttrs = []string{"service.namespace", "service.name"}
+
+// Key joins the non-empty attribute values with a slash.
+func (g *ServiceGrouping) Key(attrs map[string]any) string {
+	keys := g.Attrs
+	if len(keys) == 0 {
+		keys = defaultServiceGroupingAttrs
+	}
+
+	var b strings.Builder
+	for _, key := range keys {
+		value, _ := attrs[key].(string)
+		if value == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('/')
+		}
+		b.WriteString(value)
+	}
+	return b.String()
+}
+
+// SpanLimits mirror the OpenTelemetry SDK span limits, for example,
+// OTEL_SPAN_ATTRIBUTE_COUNT_LIMIT. Attributes, events, and links over the limits
+// are dropped and counted in the span.
+type SpanLimits struct {
+	AttrCountLimit         int `yaml:"attribute_count_limit"`
+	AttrValueLengthLimit   int `yaml:"attribute_value_length_limit"`
+	EventCountLimit        int `yaml:"event_count_limit"`
+	LinkCountLimit         int `yaml:"link_count_limit"`
+	AttrPerEventCountLimit int `yaml:"attribute_per_event_count_limit"`
+	AttrPerLinkCountLimit  int `yaml:"attribute_per_link_count_limit"`
+}
+
+// defaultSpanLimits are the OpenTelemetry SDK defaults. Attribute values are not
+// truncated by default.
+var defaultSpanLimits = SpanLimits{
+	AttrCountLimit:         128,
+	EventCountLimit:        128,
+	LinkCountLimit:         128,
+	AttrPerEventCountLimit: 128,
+	AttrPerLinkCountLimit:  128,
+}
+
+// init validates the limits and sets unset limits from the defaults.
+func (l *SpanLimits) init(defaults *SpanLimits) error {
+	for _, limit := range []struct {
+		name  string
+		value *int
+		def   int
+	}{
+		{"attribute_count_limit", &l.AttrCountLimit, defaults.AttrCountLimit},
+		{"attribute_value_length_limit", &l.AttrValueLengthLimit, defaults.AttrValueLengthLimit},
+		{"event_count_limit", &l.EventCountLimit, defaults.EventCountLimit},
+		{"link_count_limit", &l.LinkCountLimit, defaults.LinkCountLimit},
+		{"attribute_per_event_count_limit", &l.AttrPerEventCountLimit, defaults.AttrPerEventCountLimit},
+		{"attribute_per_link_count_limit", &l.AttrPerLinkCountLimit, defaults.AttrPerLinkCountLimit},
+	} {
+		if *limit.value < 0 {
+			return fmt.Errorf("%s must not be negative, got %d", limit.name, *limit.value)
+		}
+		if *limit.value == 0 {
+			*limit.value = limit.def
+		}
+	}
+	return nil
+}
+
+// ProjectSpanLimits returns the span limits of the project.
+func (c *AppConfig) ProjectSpanLimits(project *Project) *SpanLimits {
+	if project.SpanLimits != nil {
+		return project.SpanLimits
+	}
+	return &c.SpanLimits
+}
+
+// StatusRule sets the status code of spans that have all the attributes.
+type StatusRule struct {
+	Name string `yaml:"name"`
+	// Attribute values, for example, http.status_code: 404.
+	Attrs map[string]string `yaml:"attrs"`
+	// Either ok or error.
+	Status string `yaml:"status"`
+}
+
+type Notifier struct {
+	Name string `yaml:"name"`
+	// Either webhook, slack, or pagerduty.
+	Type string `yaml:"type"`
+	URL  string `yaml:"url"`
+	// PagerDuty integration key.
+	RoutingKey string `yaml:"routing_key"`
+}
+
+// OnCallSchedule rotates members every rotation period starting from the start time.
+type OnCallSchedule struct {
+	Name     string        `yaml:"name" json:"name"`
+	Members  []string      `yaml:"members" json:"members"`
+	Rotation time.Duration `yaml:"rotation" json:"rotation"`
+	Start    time.Time     `yaml:"start" json:"start"`
+}
+
+// EscalationPolicy notifies each step after its delay until the alert is
+// acknowledged or resolved.
+type EscalationPolicy struct {
+	Name string `yaml:"name" json:"name"`
+	// Projects that use the policy. Other projects notify all notifiers at once.
+	ProjectIDs []uint32         `yaml:"project_ids" json:"projectIds"`
+	Steps      []EscalationStep `yaml:"steps" json:"steps"`
+}
+
+type EscalationStep struct {
+	// Delay since the alert started firing.
+	Delay     time.Duration `yaml:"delay" json:"delay"`
+	Notifiers []string      `yaml:"notifiers" json:"notifiers"`
+	// On-call schedule whose current member is added to the alert labels.
+	OnCall string `yaml:"oncall" json:"oncall,omitempty"`
+}
+
+// AlertRule fires when a span metric crosses the threshold for the duration.
+type AlertRule struct {
+	Name      string `yaml:"name" json:"name"`
+	ProjectID uint32 `yaml:"project_id" json:"projectId"`
+
+	// Span system and UQL query that select spans, for example,
+	// "where service.name = 'api'".
+	System string `yaml:"system" json:"system"`
+	Query  string `yaml:"query" json:"query"`
+
+	// For example, span.error_pct, span.count_per_min, or p99(span.duration).
+	Metric string `yaml:"metric" json:"metric"`
+	// One of >, >=, <, <=.
+	Op        string  `yaml:"op" json:"op"`
+	Threshold float64 `yaml:"threshold" json:"threshold"`
+
+	// How often the rule is evaluated. Must be a whole number of minutes.
+	Interval time.Duration `yaml:"interval" json:"interval"`
+	// How long the condition must hold before the alert fires.
+	For time.Duration `yaml:"for" json:"for"`
+
+	// Service the alert is about. Used to group related alerts into incidents.
+	Service string `yaml:"service" json:"service,omitempty"`
+
+	DependsOn []string `yaml:"depends_on" json:"dependsOn"`
+}
+
+// CompositeRule fires when other alerts fire together.
+type CompositeRule struct {
+	Name      string `yaml:"name" json:"name"`
+	ProjectID uint32 `yaml:"project_id" json:"projectId"`
+
+	// Alert keys, for example, "rule:checkout errors", "check:website", or "heartbeat:backup".
+	Alerts []string `yaml:"alerts" json:"alerts"`
+	// Either and (default) or or.
+	Op string `yaml:"op" json:"op"`
+	// With the and op, alerts must fire within that duration of each other.
+	Within time.Duration `yaml:"within" json:"within"`
+
+	DependsOn []string `yaml:"depends_on" json:"dependsOn"`
+}
+
+// Heartbeat is a cron or batch job that is expected to check in on a schedule.
+type Heartbeat struct {
+	Name      string `yaml:"name" json:"name"`
+	ProjectID uint32 `yaml:"project_id" json:"projectId"`
+
+	// Cron expression, for example, "0 3 * * *". Takes precedence over the interval.
+	Schedule string        `yaml:"schedule" json:"schedule"`
+	Interval time.Duration `yaml:"interval" json:"interval"`
+	// How long to wait for a late check-in before alerting.
+	Grace time.Duration `yaml:"grace" json:"grace"`
+
+	// Service the alert is about. Used to group related alerts into incidents.
+	Service string `yaml:"service" json:"service,omitempty"`
+
+	DependsOn []string `yaml:"depends_on" json:"dependsOn"`
+}
+
+// Check is a synthetic probe that periodically checks that an endpoint is up.
+type Check struct {
+	Name      string `yaml:"name" json:"name"`
+	ProjectID uint32 `yaml:"project_id" json:"projectId"`
+
+	// Either http, tcp, or grpc.
+	Type string `yaml:"type" json:"type"`
+	// URL for HTTP checks and host:port for TCP and gRPC checks.
+	Target string `yaml:"target" json:"target"`
+	// Whether TCP and gRPC checks use TLS.
+	TLS bool `yaml:"tls" json:"tls"`
+	// Alert that many days before the TLS certificate expires.
+	TLSExpiryDays int `yaml:"tls_expiry_days" json:"tlsExpiryDays"`
+
+	Interval time.Duration `yaml:"interval" json:"interval"`
+	Timeout  time.Duration `yaml:"timeout" json:"timeout"`
+	// Alert when the probe takes longer than that.
+	MaxLatency time.Duration `yaml:"max_latency" json:"maxLatency"`
+
+	Method         string `yaml:"method" json:"method,omitempty"`
+	ExpectedStatus int    `yaml:"expected_status" json:"expectedStatus,omitempty"`
+
+	// Service the alert is about. Used to group related alerts into incidents.
+	Service string `yaml:"service" json:"service,omitempty"`
+
+	DependsOn []string `yaml:"depends_on" json:"dependsOn"`
 }
 
 func (c *AppConfig) SiteAddr() string {
-	return fmt.Sprintf("%s://%s:%s/", c.Site.Scheme, c.Listen.HTTPHost, c.Listen.HTTPPort)
+	return c.SiteURL("/")
 }
 
 func (c *AppConfig) GRPCEndpoint(project *Project) string {
@@ -119,7 +1203,8 @@ func (c *AppConfig) GRPCEndpoint(project *Project) string {
 }
 
 func (c *AppConfig) HTTPEndpoint(project *Project) string {
-	return fmt.Sprintf("%s://%s:%s", c.Site.Scheme, c.Listen.HTTPHost, c.Listen.HTTPPort)
+	return fmt.Sprintf("%s://%s:%s%s",
+		c.Site.Scheme, c.Listen.HTTPHost, c.Listen.HTTPPort, c.Site.URLPrefix)
 }
 
 func (c *AppConfig) GRPCDsn(project *Project) string {
@@ -0,0 +1,146 @@
+package bunapp
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DerivedAttrURLHost = "url_host"
+	DerivedAttrURLPath = "url_path"
+	DerivedAttrLower   = "lower"
+	DerivedAttrRegexp  = "regexp"
+	DerivedAttrBucket  = "bucket"
+)
+
+// DerivedAttr computes the attribute Name from the attribute or the span field From
+// when spans are received, for example, url.domain from http.url. Spans that already
+// have the attribute are not changed.
+type DerivedAttr struct {
+	Name string `yaml:"name"`
+	// Span attribute or one of span.name, span.kind, and span.duration.
+	From string `yaml:"from"`
+	// Either url_host, url_path, lower, regexp, or bucket.
+	Func string `yaml:"func"`
+	// The regexp func replaces the first match with Replace that can refer to
+	// submatches, for example, ${1}. Values that don't match are skipped.
+	Pattern string `yaml:"pattern"`
+	Replace string `yaml:"replace"`
+	// The bucket func returns the first bound that is greater than or equal to the value,
+	// for example, <=100ms. Bounds of span.duration are durations, other bounds are
+	// numbers. Bounds must be ascending.
+	Buckets []string `yaml:"buckets"`
+
+	re     *regexp.Regexp
+	bounds []float64
+}
+
+func (a *DerivedAttr) init() error {
+	if a.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if a.From == "" {
+		return fmt.Errorf("from is required")
+	}
+
+	switch a.Func {
+	case DerivedAttrURLHost, DerivedAttrURLPath, DerivedAttrLower:
+	case DerivedAttrRegexp:
+		re, err := regexp.Compile(a.Pattern)
+		if err != nil {
+			return err
+		}
+		a.re = re
+	case DerivedAttrBucket:
+		if len(a.Buckets) == 0 {
+			return fmt.Errorf("buckets are required")
+		}
+		a.bounds = make([]float64, len(a.Buckets))
+		for i, s := range a.Buckets {
+			bound, err := a.parseBound(s)
+			if err != nil {
+				return fmt.Errorf("bucket %q: %w", s, err)
+			}
+			if i > 0 && bound <= a.bounds[i-1] {
+				return fmt.Errorf("buckets must be ascending, got %q after %q",
+					s, a.Buckets[i-1])
+			}
+			a.bounds[i] = bound
+		}
+	default:
+		return fmt.Errorf("unsupported func: %q", a.Func)
+	}
+	return nil
+}
+
+func (a *DerivedAttr) parseBound(s string) (float64, error) {
+	if a.From == "span.duration" {
+		dur, err := time.ParseDuration(s)
+		return float64(dur), err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// Eval returns the attribute value computed from the source value. The source is
+// a string, a number, or a time.Duration for span.duration.
+func (a *DerivedAttr) Eval(value any) (string, bool) {
+	if a.Func == DerivedAttrBucket {
+		num, ok := derivedAttrNumber(value)
+		if !ok {
+			return "", false
+		}
+		for i, bound := range a.bounds {
+			if num <= bound {
+				return "<=" + a.Buckets[i], true
+			}
+		}
+		return ">" + a.Buckets[len(a.Buckets)-1], true
+	}
+
+	s, ok := value.(string)
+	if !ok || s == "" {
+		return "", false
+	}
+
+	switch a.Func {
+	case DerivedAttrURLHost, DerivedAttrURLPath:
+		u, err := url.Parse(s)
+		if err != nil {
+			return "", false
+		}
+		if a.Func == DerivedAttrURLHost {
+			return u.Hostname(), u.Hostname() != ""
+		}
+		return u.Path, u.Path != ""
+	case DerivedAttrLower:
+		return strings.ToLower(s), true
+	case DerivedAttrRegexp:
+		m := a.re.FindStringSubmatchIndex(s)
+		if m == nil {
+			return "", false
+		}
+		return string(a.re.ExpandString(nil, a.Replace, s, m)), true
+	default:
+		return "", false
+	}
+}
+
+func derivedAttrNumber(value any) (float64, bool) {
+	switch v := value.(type) {
+	case time.Duration:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		num, err := strconv.ParseFloat(v, 64)
+		return num, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,54 @@
+package bunapp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDerivedAttrEval(t *testing.T) {
+	attr := &DerivedAttr{Name: "url.domain", From: "http.url", Func: DerivedAttrURLHost}
+	require.NoError(t, attr.init())
+	value, ok := attr.Eval("https://api.example.com:8443/users?id=1")
+	require.True(t, ok)
+	require.Equal(t, "api.example.com", value)
+	_, ok = attr.Eval(int64(1))
+	require.False(t, ok)
+
+	attr = &DerivedAttr{
+		Name: "api.version", From: "http.target", Func: DerivedAttrRegexp,
+		Pattern: `^/api/(v\d+)/`, Replace: "${1}",
+	}
+	require.NoError(t, attr.init())
+	value, ok = attr.Eval("/api/v2/users")
+	require.True(t, ok)
+	require.Equal(t, "v2", value)
+	_, ok = attr.Eval("/health")
+	require.False(t, ok)
+
+	attr = &DerivedAttr{
+		Name: "duration_bucket", From: "span.duration", Func: DerivedAttrBucket,
+		Buckets: []string{"10ms", "100ms", "1s"},
+	}
+	require.NoError(t, attr.init())
+	value, _ = attr.Eval(50 * time.Millisecond)
+	require.Equal(t, "<=100ms", value)
+	value, _ = attr.Eval(100 * time.Millisecond)
+	require.Equal(t, "<=100ms", value)
+	value, _ = attr.Eval(2 * time.Second)
+	require.Equal(t, ">1s", value)
+
+	attr = &DerivedAttr{
+		Name: "size_bucket", From: "http.response_content_length", Func: DerivedAttrBucket,
+		Buckets: []string{"1024", "65536"},
+	}
+	require.NoError(t, attr.init())
+	value, _ = attr.Eval(int64(2048))
+	require.Equal(t, "<=65536", value)
+
+	attr.Buckets = []string{"10", "1"}
+	require.Error(t, attr.init())
+	require.Error(t, (&DerivedAttr{Name: "x", From: "y", Func: "eval"}).init())
+	require.Error(t, (&DerivedAttr{Name: "x", Func: DerivedAttrLower}).init())
+}
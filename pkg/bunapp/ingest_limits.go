@@ -0,0 +1,47 @@
+package bunapp
+
+import (
+	"net/http"
+)
+
+// ingestLimitHandler limits the size of request bodies and the number of requests
+// that are processed concurrently by the ingest endpoints.
+func (app *App) ingestLimitHandler(next http.Handler) http.Handler {
+	conf := &app.cfg.IngestLimits
+
+	var sem chan struct{}
+	if conf.MaxConcurrentRequests > 0 {
+		sem = make(chan struct{}, conf.MaxConcurrentRequests)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !isIngestPath(req.URL.Path) {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		if conf.MaxBodySize > 0 {
+			if req.ContentLength > conf.MaxBodySize {
+				http.Error(w, "HTTP request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			// Bodies are decompressed at this point so the limit also protects
+			// against compression bombs.
+			req.Body = http.MaxBytesReader(w, req.Body, conf.MaxBodySize)
+		}
+
+		if sem != nil {
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			default:
+				// OTLP exporters retry such requests after a delay.
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "too many concurrent requests", http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,168 @@
+package bunapp
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// MemoryLimiter refuses ingest requests while the heap is over the soft limit, that is,
+// memory_limiter.limit minus spike_limit, so spikes don't get the process killed.
+// Exporters retry the refused requests. The heap is checked every check_interval
+// and garbage is collected when the heap is over the hard limit.
+type MemoryLimiter struct {
+	app *App
+
+	hardLimit uint64
+	softLimit uint64
+
+	// Updated atomically.
+	heapAlloc       uint64
+	refusing        uint32
+	refusedRequests int64
+}
+
+func newMemoryLimiter(app *App) *MemoryLimiter {
+	conf := &app.cfg.MemoryLimiter
+	return &MemoryLimiter{
+		app:       app,
+		hardLimit: uint64(conf.Limit),
+		softLimit: uint64(conf.Limit - conf.SpikeLimit),
+	}
+}
+
+func (l *MemoryLimiter) Enabled() bool {
+	return l.hardLimit > 0
+}
+
+func (l *MemoryLimiter) run(ctx context.Context) {
+	ticker := time.NewTicker(l.app.cfg.MemoryLimiter.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.check(readHeapAlloc)
+		}
+	}
+}
+
+func readHeapAlloc() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+func (l *MemoryLimiter) check(readHeap func() uint64) {
+	heap := readHeap()
+	if heap > l.hardLimit {
+		runtime.GC()
+		heap = readHeap()
+	}
+	atomic.StoreUint64(&l.heapAlloc, heap)
+
+	refusing := heap > l.softLimit
+	if refusing == l.Refusing() {
+		return
+	}
+
+	if refusing {
+		atomic.StoreUint32(&l.refusing, 1)
+		l.app.Zap(l.app.Context()).Warn("heap is over memory_limiter soft limit, refusing ingest requests",
+			zap.Uint64("heap_alloc", heap), zap.Uint64("soft_limit", l.softLimit))
+	} else {
+		atomic.StoreUint32(&l.refusing, 0)
+		l.app.Zap(l.app.Context()).Info("heap is under memory_limiter soft limit, accepting ingest requests",
+			zap.Uint64("heap_alloc", heap))
+	}
+}
+
+// Refusing reports whether ingest requests are refused.
+func (l *MemoryLimiter) Refusing() bool {
+	return atomic.LoadUint32(&l.refusing) == 1
+}
+
+func (l *MemoryLimiter) HeapAlloc() uint64 {
+	return atomic.LoadUint64(&l.heapAlloc)
+}
+
+func (l *MemoryLimiter) RefusedRequests() int64 {
+	return atomic.LoadInt64(&l.refusedRequests)
+}
+
+// refuse counts the request if it must be refused.
+func (l *MemoryLimiter) refuse() bool {
+	if !l.Refusing() {
+		return false
+	}
+	atomic.AddInt64(&l.refusedRequests, 1)
+	return true
+}
+
+const memoryLimitMessage = "memory usage is over the limit, retry later"
+
+func (app *App) memoryLimitHandler(next http.Handler) http.Handler {
+	if !app.memoryLimiter.Enabled() {
+		return next
+	}
+
+	retryAfter := strconv.Itoa(int(app.cfg.MemoryLimiter.RetryAfter.Seconds()))
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if isIngestPath(req.URL.Path) && app.memoryLimiter.refuse() {
+			w.Header().Set("Retry-After", retryAfter)
+			http.Error(w, memoryLimitMessage, http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (app *App) grpcMemoryLimitError() error {
+	if !app.memoryLimiter.refuse() {
+		return nil
+	}
+
+	st := status.New(codes.Unavailable, memoryLimitMessage)
+	if withInfo, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(app.cfg.MemoryLimiter.RetryAfter),
+	}); err == nil {
+		st = withInfo
+	}
+	return st.Err()
+}
+
+func (app *App) grpcMemoryLimitUnaryInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	if err := app.grpcMemoryLimitError(); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (app *App) grpcMemoryLimitStreamInterceptor(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if err := app.grpcMemoryLimitError(); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
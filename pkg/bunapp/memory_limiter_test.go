@@ -0,0 +1,61 @@
+package bunapp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	cfg := new(AppConfig)
+	cfg.CH.DSN = "clickhouse://default:@localhost:9000/uptrace?sslmode=disable"
+	cfg.MemoryLimiter.Limit = 1000
+	cfg.MemoryLimiter.SpikeLimit = 200
+	cfg.MemoryLimiter.CheckInterval = time.Hour
+	cfg.MemoryLimiter.RetryAfter = 5 * time.Second
+
+	app := New(context.Background(), cfg)
+	defer app.Stop()
+
+	limiter := app.MemoryLimiter()
+	handler := app.memoryLimitHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		return w
+	}
+
+	limiter.check(func() uint64 { return 700 })
+	require.False(t, limiter.Refusing())
+	require.Equal(t, http.StatusOK, serve("/v1/traces").Code)
+
+	// The heap is over the hard limit and stays over the soft limit after GC.
+	heaps := []uint64{1200, 900}
+	limiter.check(func() uint64 {
+		heap := heaps[0]
+		heaps = heaps[1:]
+		return heap
+	})
+	require.True(t, limiter.Refusing())
+	require.Equal(t, uint64(900), limiter.HeapAlloc())
+
+	w := serve("/v1/traces")
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, "5", w.Header().Get("Retry-After"))
+	require.Equal(t, http.StatusOK, serve("/api/v1/projects").Code)
+
+	st := status.Convert(app.grpcMemoryLimitError())
+	require.Equal(t, codes.Unavailable, st.Code())
+	require.Len(t, st.Details(), 1)
+	require.Equal(t, int64(2), limiter.RefusedRequests())
+
+	limiter.check(func() uint64 { return 500 })
+	require.False(t, limiter.Refusing())
+	require.NoError(t, app.grpcMemoryLimitError())
+}
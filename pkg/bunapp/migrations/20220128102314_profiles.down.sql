@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS profile_samples_buffer;
+
+--migrate:split
+
+DROP TABLE IF EXISTS profile_samples;
+
+--migrate:split
+
+DROP TABLE IF EXISTS profiles;
@@ -0,0 +1,44 @@
+CREATE TABLE profiles (
+  project_id UInt32 Codec(DoubleDelta, Default),
+  id UInt64,
+  type LowCardinality(String),
+  unit LowCardinality(String),
+  time DateTime Codec(Delta, Default),
+  duration Int64 Codec(Delta, Default),
+  period Int64,
+  sample_count UInt32,
+
+  "service.name" LowCardinality(String),
+  "host.name" LowCardinality(String)
+)
+ENGINE = MergeTree()
+ORDER BY (project_id, type, "service.name", time)
+PARTITION BY toDate(time)
+TTL toDate(time) + INTERVAL ?TTL DELETE
+
+--migrate:split
+
+CREATE TABLE profile_samples (
+  project_id UInt32 Codec(DoubleDelta, Default),
+  profile_id UInt64,
+  type LowCardinality(String),
+  time DateTime Codec(Delta, Default),
+
+  "service.name" LowCardinality(String),
+
+  trace_id UUID,
+  span_id UInt64,
+
+  stack Array(String),
+  value Int64
+)
+ENGINE = MergeTree()
+ORDER BY (project_id, type, "service.name", time)
+PARTITION BY toDate(time)
+TTL toDate(time) + INTERVAL ?TTL DELETE
+SETTINGS index_granularity = 1024
+
+--migrate:split
+
+CREATE TABLE profile_samples_buffer AS profile_samples
+ENGINE = Buffer(currentDatabase(), profile_samples, 5, 10, 15, 10000, 1000000, 10000000, 100000000)
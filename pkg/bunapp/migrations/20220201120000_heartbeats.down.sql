@@ -0,0 +1 @@
+DROP TABLE IF EXISTS heartbeat_checkins
@@ -0,0 +1,11 @@
+CREATE TABLE heartbeat_checkins (
+  project_id UInt32 Codec(DoubleDelta, Default),
+  name LowCardinality(String),
+  time DateTime Codec(Delta, Default),
+  status LowCardinality(String),
+  duration Int64
+)
+ENGINE = MergeTree()
+ORDER BY (project_id, name, time)
+PARTITION BY toDate(time)
+TTL toDate(time) + INTERVAL ?TTL DELETE
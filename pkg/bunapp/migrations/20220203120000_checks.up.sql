@@ -0,0 +1,14 @@
+CREATE TABLE check_results (
+  project_id UInt32 Codec(DoubleDelta, Default),
+  name LowCardinality(String),
+  type LowCardinality(String),
+  time DateTime Codec(Delta, Default),
+  duration Int64 Codec(Delta, Default),
+  success UInt8,
+  status_code Int32,
+  error String
+)
+ENGINE = MergeTree()
+ORDER BY (project_id, name, time)
+PARTITION BY toDate(time)
+TTL toDate(time) + INTERVAL ?TTL DELETE
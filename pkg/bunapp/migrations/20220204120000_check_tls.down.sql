@@ -0,0 +1,3 @@
+ALTER TABLE check_results
+  DROP COLUMN tls_expires_at,
+  DROP COLUMN tls_chain
@@ -0,0 +1,3 @@
+ALTER TABLE check_results
+  ADD COLUMN tls_expires_at DateTime,
+  ADD COLUMN tls_chain Array(String)
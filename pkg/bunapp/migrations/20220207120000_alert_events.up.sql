@@ -0,0 +1,13 @@
+CREATE TABLE alert_events (
+  project_id UInt32 Codec(DoubleDelta, Default),
+  alert_key LowCardinality(String),
+  alert_name String,
+  state LowCardinality(String),
+  actor String,
+  message String,
+  time DateTime Codec(Delta, Default)
+)
+ENGINE = MergeTree()
+ORDER BY (project_id, alert_key, time)
+PARTITION BY toDate(time)
+TTL toDate(time) + INTERVAL ?TTL DELETE
@@ -0,0 +1,2 @@
+ALTER TABLE alert_events
+  DROP COLUMN incident_id
@@ -0,0 +1,2 @@
+ALTER TABLE alert_events
+  ADD COLUMN incident_id UInt64
@@ -0,0 +1,7 @@
+CREATE TABLE table_ttls (
+  name String,
+  ttl String,
+  time DateTime
+)
+ENGINE = ReplacingMergeTree(time)
+ORDER BY name
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS backups
+
+--migrate:split
+
+DROP TABLE IF EXISTS backup_configs
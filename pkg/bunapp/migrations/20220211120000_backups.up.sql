@@ -0,0 +1,20 @@
+CREATE TABLE backups (
+  name String,
+  status LowCardinality(String),
+  error String,
+  started_at DateTime,
+  finished_at DateTime,
+  time DateTime
+)
+ENGINE = ReplacingMergeTree(time)
+ORDER BY name
+
+--migrate:split
+
+CREATE TABLE backup_configs (
+  name String,
+  config String,
+  time DateTime
+)
+ENGINE = MergeTree()
+ORDER BY name
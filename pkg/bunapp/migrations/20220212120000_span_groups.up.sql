@@ -0,0 +1,75 @@
+CREATE TABLE span_group_minutes (
+  project_id UInt32,
+  system LowCardinality(String),
+  service LowCardinality(String),
+  group_id UInt64,
+  time DateTime Codec(Delta, Default),
+  name SimpleAggregateFunction(any, String),
+  event_name SimpleAggregateFunction(any, String),
+  tdigest AggregateFunction(quantilesTDigestWeighted(0.5, 0.9, 0.99), Float32, UInt32),
+  count UInt64 Codec(Delta, Default),
+  error_count UInt64 Codec(Delta, Default)
+)
+ENGINE = SummingMergeTree()
+PARTITION BY toDate(time)
+ORDER BY (project_id, system, group_id, service, time)
+TTL toDate(time) + INTERVAL ?TTL DELETE
+SETTINGS index_granularity = 128;
+
+--migrate:split
+
+CREATE MATERIALIZED VIEW span_group_minutes_mv
+TO span_group_minutes AS
+SELECT
+  project_id,
+  "span.system" AS system,
+  "service.name" AS service,
+  "span.group_id" AS group_id,
+  toStartOfMinute("span.time") AS time,
+  any("span.name") AS name,
+  any("span.event_name") AS event_name,
+  quantilesTDigestWeightedState(0.5, 0.9, 0.99)(toFloat32("span.duration"), toUInt32("span.count")) AS tdigest,
+  toUInt64(sum("span.count")) AS count,
+  toUInt64(sumIf("span.count", "span.status_code" = 'error')) AS error_count
+FROM spans_index
+GROUP BY project_id, system, service, group_id, time
+SETTINGS prefer_column_name_to_alias = 1
+
+--migrate:split
+
+CREATE TABLE span_group_hours (
+  project_id UInt32,
+  system LowCardinality(String),
+  service LowCardinality(String),
+  group_id UInt64,
+  time DateTime Codec(Delta, Default),
+  name SimpleAggregateFunction(any, String),
+  event_name SimpleAggregateFunction(any, String),
+  tdigest AggregateFunction(quantilesTDigestWeighted(0.5, 0.9, 0.99), Float32, UInt32),
+  count UInt64 Codec(Delta, Default),
+  error_count UInt64 Codec(Delta, Default)
+)
+ENGINE = SummingMergeTree()
+PARTITION BY toDate(time)
+ORDER BY (project_id, system, group_id, service, time)
+TTL toDate(time) + INTERVAL ?TTL DELETE
+SETTINGS index_granularity = 128;
+
+--migrate:split
+
+CREATE MATERIALIZED VIEW span_group_hours_mv
+TO span_group_hours AS
+SELECT
+  project_id,
+  system,
+  service,
+  group_id,
+  toStartOfHour(time) AS time,
+  any(name) AS name,
+  any(event_name) AS event_name,
+  quantilesTDigestWeightedMergeState(0.5, 0.9, 0.99)(tdigest) AS tdigest,
+  sum(count) AS count,
+  sum(error_count) AS error_count
+FROM span_group_minutes
+GROUP BY project_id, system, service, group_id, toStartOfHour(time)
+SETTINGS prefer_column_name_to_alias = 1
@@ -0,0 +1,78 @@
+DROP TABLE IF EXISTS spans_index_buffer
+
+--migrate:split
+
+ALTER TABLE spans_index
+  ADD COLUMN "span.apdex_level" LowCardinality(String) AFTER "span.event_log_count"
+
+--migrate:split
+
+CREATE TABLE spans_index_buffer AS spans_index
+ENGINE = Buffer(currentDatabase(), spans_index, 5, 10, 15, 10000, 1000000, 10000000, 100000000)
+
+--------------------------------------------------------------------------------
+--migrate:split
+
+ALTER TABLE span_group_minutes
+  ADD COLUMN satisfied_count UInt64 Codec(Delta, Default),
+  ADD COLUMN tolerating_count UInt64 Codec(Delta, Default),
+  ADD COLUMN frustrated_count UInt64 Codec(Delta, Default)
+
+--migrate:split
+
+ALTER TABLE span_group_hours
+  ADD COLUMN satisfied_count UInt64 Codec(Delta, Default),
+  ADD COLUMN tolerating_count UInt64 Codec(Delta, Default),
+  ADD COLUMN frustrated_count UInt64 Codec(Delta, Default)
+
+--migrate:split
+
+DROP VIEW IF EXISTS span_group_minutes_mv
+
+--migrate:split
+
+CREATE MATERIALIZED VIEW span_group_minutes_mv
+TO span_group_minutes AS
+SELECT
+  project_id,
+  "span.system" AS system,
+  "service.name" AS service,
+  "span.group_id" AS group_id,
+  toStartOfMinute("span.time") AS time,
+  any("span.name") AS name,
+  any("span.event_name") AS event_name,
+  quantilesTDigestWeightedState(0.5, 0.9, 0.99)(toFloat32("span.duration"), toUInt32("span.count")) AS tdigest,
+  toUInt64(sum("span.count")) AS count,
+  toUInt64(sumIf("span.count", "span.status_code" = 'error')) AS error_count,
+  toUInt64(sumIf("span.count", "span.apdex_level" = 'satisfied')) AS satisfied_count,
+  toUInt64(sumIf("span.count", "span.apdex_level" = 'tolerating')) AS tolerating_count,
+  toUInt64(sumIf("span.count", "span.apdex_level" = 'frustrated')) AS frustrated_count
+FROM spans_index
+GROUP BY project_id, system, service, group_id, time
+SETTINGS prefer_column_name_to_alias = 1
+
+--migrate:split
+
+DROP VIEW IF EXISTS span_group_hours_mv
+
+--migrate:split
+
+CREATE MATERIALIZED VIEW span_group_hours_mv
+TO span_group_hours AS
+SELECT
+  project_id,
+  system,
+  service,
+  group_id,
+  toStartOfHour(time) AS time,
+  any(name) AS name,
+  any(event_name) AS event_name,
+  quantilesTDigestWeightedMergeState(0.5, 0.9, 0.99)(tdigest) AS tdigest,
+  sum(count) AS count,
+  sum(error_count) AS error_count,
+  sum(satisfied_count) AS satisfied_count,
+  sum(tolerating_count) AS tolerating_count,
+  sum(frustrated_count) AS frustrated_count
+FROM span_group_minutes
+GROUP BY project_id, system, service, group_id, toStartOfHour(time)
+SETTINGS prefer_column_name_to_alias = 1
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS spans_index_buffer
+
+--migrate:split
+
+ALTER TABLE spans_index
+  DROP COLUMN "otel.library.name",
+  DROP COLUMN "otel.library.version"
+
+--migrate:split
+
+CREATE TABLE spans_index_buffer AS spans_index
+ENGINE = Buffer(currentDatabase(), spans_index, 5, 10, 15, 10000, 1000000, 10000000, 100000000)
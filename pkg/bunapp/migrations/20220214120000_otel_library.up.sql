@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS spans_index_buffer
+
+--migrate:split
+
+ALTER TABLE spans_index
+  ADD COLUMN "otel.library.name" LowCardinality(String) AFTER "host.name",
+  ADD COLUMN "otel.library.version" LowCardinality(String) AFTER "otel.library.name"
+
+--migrate:split
+
+CREATE TABLE spans_index_buffer AS spans_index
+ENGINE = Buffer(currentDatabase(), spans_index, 5, 10, 15, 10000, 1000000, 10000000, 100000000)
@@ -0,0 +1,81 @@
+CREATE TABLE span_http_minutes (
+  project_id UInt32,
+  system LowCardinality(String),
+  service LowCardinality(String),
+  group_id UInt64,
+  http_method LowCardinality(String),
+  status_class LowCardinality(String),
+  time DateTime Codec(Delta, Default),
+  name SimpleAggregateFunction(any, String),
+  tdigest AggregateFunction(quantilesTDigestWeighted(0.5, 0.9, 0.99), Float32, UInt32),
+  count UInt64 Codec(Delta, Default),
+  error_count UInt64 Codec(Delta, Default)
+)
+ENGINE = SummingMergeTree()
+PARTITION BY toDate(time)
+ORDER BY (project_id, system, group_id, service, http_method, status_class, time)
+TTL toDate(time) + INTERVAL ?TTL DELETE
+SETTINGS index_granularity = 128;
+
+--migrate:split
+
+CREATE MATERIALIZED VIEW span_http_minutes_mv
+TO span_http_minutes AS
+SELECT
+  project_id,
+  "span.system" AS system,
+  "service.name" AS service,
+  "span.group_id" AS group_id,
+  attr_values[indexOf(attr_keys, 'http.method')] AS http_method,
+  if(attr_values[indexOf(attr_keys, 'http.status_code')] = '', '',
+    concat(substring(attr_values[indexOf(attr_keys, 'http.status_code')], 1, 1), 'xx')) AS status_class,
+  toStartOfMinute("span.time") AS time,
+  any("span.name") AS name,
+  quantilesTDigestWeightedState(0.5, 0.9, 0.99)(toFloat32("span.duration"), toUInt32("span.count")) AS tdigest,
+  toUInt64(sum("span.count")) AS count,
+  toUInt64(sumIf("span.count", "span.status_code" = 'error')) AS error_count
+FROM spans_index
+WHERE "span.system" LIKE 'http:%'
+GROUP BY project_id, system, service, group_id, http_method, status_class, time
+SETTINGS prefer_column_name_to_alias = 1
+
+--migrate:split
+
+CREATE TABLE span_http_hours (
+  project_id UInt32,
+  system LowCardinality(String),
+  service LowCardinality(String),
+  group_id UInt64,
+  http_method LowCardinality(String),
+  status_class LowCardinality(String),
+  time DateTime Codec(Delta, Default),
+  name SimpleAggregateFunction(any, String),
+  tdigest AggregateFunction(quantilesTDigestWeighted(0.5, 0.9, 0.99), Float32, UInt32),
+  count UInt64 Codec(Delta, Default),
+  error_count UInt64 Codec(Delta, Default)
+)
+ENGINE = SummingMergeTree()
+PARTITION BY toDate(time)
+ORDER BY (project_id, system, group_id, service, http_method, status_class, time)
+TTL toDate(time) + INTERVAL ?TTL DELETE
+SETTINGS index_granularity = 128;
+
+--migrate:split
+
+CREATE MATERIALIZED VIEW span_http_hours_mv
+TO span_http_hours AS
+SELECT
+  project_id,
+  system,
+  service,
+  group_id,
+  http_method,
+  status_class,
+  toStartOfHour(time) AS time,
+  any(name) AS name,
+  quantilesTDigestWeightedMergeState(0.5, 0.9, 0.99)(tdigest) AS tdigest,
+  sum(count) AS count,
+  sum(error_count) AS error_count
+FROM span_http_minutes
+GROUP BY project_id, system, service, group_id, http_method, status_class, toStartOfHour(time)
+SETTINGS prefer_column_name_to_alias = 1
@@ -0,0 +1,13 @@
+DROP VIEW IF EXISTS span_rpc_hours_mv;
+
+--migrate:split
+
+DROP TABLE IF EXISTS span_rpc_hours;
+
+--migrate:split
+
+DROP VIEW IF EXISTS span_rpc_minutes_mv;
+
+--migrate:split
+
+DROP TABLE IF EXISTS span_rpc_minutes;
@@ -0,0 +1,84 @@
+CREATE TABLE span_rpc_minutes (
+  project_id UInt32,
+  system LowCardinality(String),
+  service LowCardinality(String),
+  group_id UInt64,
+  rpc_service LowCardinality(String),
+  rpc_method LowCardinality(String),
+  grpc_status_code LowCardinality(String),
+  time DateTime Codec(Delta, Default),
+  name SimpleAggregateFunction(any, String),
+  tdigest AggregateFunction(quantilesTDigestWeighted(0.5, 0.9, 0.99), Float32, UInt32),
+  count UInt64 Codec(Delta, Default),
+  error_count UInt64 Codec(Delta, Default)
+)
+ENGINE = SummingMergeTree()
+PARTITION BY toDate(time)
+ORDER BY (project_id, system, group_id, service, rpc_service, rpc_method, grpc_status_code, time)
+TTL toDate(time) + INTERVAL ?TTL DELETE
+SETTINGS index_granularity = 128;
+
+--migrate:split
+
+CREATE MATERIALIZED VIEW span_rpc_minutes_mv
+TO span_rpc_minutes AS
+SELECT
+  project_id,
+  "span.system" AS system,
+  "service.name" AS service,
+  "span.group_id" AS group_id,
+  attr_values[indexOf(attr_keys, 'rpc.service')] AS rpc_service,
+  attr_values[indexOf(attr_keys, 'rpc.method')] AS rpc_method,
+  attr_values[indexOf(attr_keys, 'rpc.grpc.status_code')] AS grpc_status_code,
+  toStartOfMinute("span.time") AS time,
+  any("span.name") AS name,
+  quantilesTDigestWeightedState(0.5, 0.9, 0.99)(toFloat32("span.duration"), toUInt32("span.count")) AS tdigest,
+  toUInt64(sum("span.count")) AS count,
+  toUInt64(sumIf("span.count", "span.status_code" = 'error')) AS error_count
+FROM spans_index
+WHERE "span.system" LIKE 'rpc:%'
+GROUP BY project_id, system, service, group_id, rpc_service, rpc_method, grpc_status_code, time
+SETTINGS prefer_column_name_to_alias = 1
+
+--migrate:split
+
+CREATE TABLE span_rpc_hours (
+  project_id UInt32,
+  system LowCardinality(String),
+  service LowCardinality(String),
+  group_id UInt64,
+  rpc_service LowCardinality(String),
+  rpc_method LowCardinality(String),
+  grpc_status_code LowCardinality(String),
+  time DateTime Codec(Delta, Default),
+  name SimpleAggregateFunction(any, String),
+  tdigest AggregateFunction(quantilesTDigestWeighted(0.5, 0.9, 0.99), Float32, UInt32),
+  count UInt64 Codec(Delta, Default),
+  error_count UInt64 Codec(Delta, Default)
+)
+ENGINE = SummingMergeTree()
+PARTITION BY toDate(time)
+ORDER BY (project_id, system, group_id, service, rpc_service, rpc_method, grpc_status_code, time)
+TTL toDate(time) + INTERVAL ?TTL DELETE
+SETTINGS index_granularity = 128;
+
+--migrate:split
+
+CREATE MATERIALIZED VIEW span_rpc_hours_mv
+TO span_rpc_hours AS
+SELECT
+  project_id,
+  system,
+  service,
+  group_id,
+  rpc_service,
+  rpc_method,
+  grpc_status_code,
+  toStartOfHour(time) AS time,
+  any(name) AS name,
+  quantilesTDigestWeightedMergeState(0.5, 0.9, 0.99)(tdigest) AS tdigest,
+  sum(count) AS count,
+  sum(error_count) AS error_count
+FROM span_rpc_minutes
+GROUP BY project_id, system, service, group_id, rpc_service, rpc_method, grpc_status_code, toStartOfHour(time)
+SETTINGS prefer_column_name_to_alias = 1
@@ -0,0 +1,18 @@
+CREATE TABLE service_health (
+  project_id UInt32,
+  service LowCardinality(String),
+  time DateTime Codec(Delta, Default),
+  score Float32,
+  error_rate Float32,
+  baseline_error_rate Float32,
+  p99 Float32,
+  baseline_p99 Float32,
+  rate Float32,
+  baseline_rate Float32,
+  apdex Float32
+)
+ENGINE = ReplacingMergeTree()
+PARTITION BY toDate(time)
+ORDER BY (project_id, service, time)
+TTL toDate(time) + INTERVAL ?TTL DELETE
+SETTINGS index_granularity = 128
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS sampled_days
@@ -0,0 +1,8 @@
+CREATE TABLE sampled_days (
+  project_id UInt32,
+  date Date,
+  keep_pct Float32,
+  time DateTime
+)
+ENGINE = ReplacingMergeTree()
+ORDER BY (project_id, date)
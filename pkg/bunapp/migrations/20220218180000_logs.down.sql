@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS logs_data_buffer;
+
+--migrate:split
+
+DROP TABLE IF EXISTS logs_index_buffer;
+
+--migrate:split
+
+DROP TABLE IF EXISTS logs_data;
+
+--migrate:split
+
+DROP TABLE IF EXISTS logs_index;
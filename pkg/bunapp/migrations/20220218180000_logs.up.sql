@@ -0,0 +1,46 @@
+CREATE TABLE logs_index (
+  project_id UInt32 Codec(DoubleDelta, Default),
+  "log.severity" LowCardinality(String),
+  "log.time" DateTime Codec(Delta, Default),
+  "log.id" UInt64,
+  "log.trace_id" UUID,
+  "log.span_id" UInt64,
+  "log.message" String,
+
+  attr_keys Array(LowCardinality(String)),
+  attr_values Array(String),
+
+  "service.name" LowCardinality(String),
+  "host.name" LowCardinality(String),
+
+  INDEX idx_attr_keys attr_keys TYPE bloom_filter(0.01) GRANULARITY 64,
+  INDEX idx_trace_id "log.trace_id" TYPE bloom_filter(0.01) GRANULARITY 64
+)
+ENGINE = MergeTree()
+ORDER BY (project_id, "service.name", "log.severity", "log.time")
+PARTITION BY toDate("log.time")
+TTL toDate("log.time") + INTERVAL ?TTL DELETE
+
+--migrate:split
+
+CREATE TABLE logs_data (
+  project_id UInt32 Codec(DoubleDelta, Default),
+  id UInt64,
+  time DateTime Codec(Delta, Default),
+  data String
+)
+ENGINE = MergeTree()
+ORDER BY (project_id, id)
+PARTITION BY toDate(time)
+TTL toDate(time) + INTERVAL ?TTL DELETE
+SETTINGS index_granularity = 128
+
+--migrate:split
+
+CREATE TABLE logs_index_buffer AS logs_index
+ENGINE = Buffer(currentDatabase(), logs_index, 5, 10, 15, 10000, 1000000, 10000000, 100000000)
+
+--migrate:split
+
+CREATE TABLE logs_data_buffer AS logs_data
+ENGINE = Buffer(currentDatabase(), logs_data, 5, 10, 15, 10000, 1000000, 10000000, 100000000)
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS measures_buffer;
+
+--migrate:split
+
+DROP TABLE IF EXISTS measures;
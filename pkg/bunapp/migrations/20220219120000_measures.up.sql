@@ -0,0 +1,39 @@
+CREATE TABLE measures (
+  project_id UInt32 Codec(DoubleDelta, Default),
+  metric LowCardinality(String),
+  -- gauge, counter, additive, histogram, or summary
+  instrument LowCardinality(String),
+  unit LowCardinality(String),
+  -- delta, cumulative, or empty for gauges and summaries
+  temporality LowCardinality(String),
+  time DateTime Codec(Delta, Default),
+  start_time DateTime Codec(Delta, Default),
+
+  attr_keys Array(LowCardinality(String)),
+  attr_values Array(String),
+
+  "service.name" LowCardinality(String),
+  "host.name" LowCardinality(String),
+
+  -- Value of gauges and sums.
+  value Float64,
+
+  -- Histograms and summaries.
+  sum Float64,
+  count UInt64,
+  bounds Array(Float64),
+  bucket_counts Array(UInt64),
+  quantiles Array(Float64),
+  quantile_values Array(Float64),
+
+  INDEX idx_attr_keys attr_keys TYPE bloom_filter(0.01) GRANULARITY 64
+)
+ENGINE = MergeTree()
+ORDER BY (project_id, metric, "service.name", time)
+PARTITION BY toDate(time)
+TTL toDate(time) + INTERVAL ?TTL DELETE
+
+--migrate:split
+
+CREATE TABLE measures_buffer AS measures
+ENGINE = Buffer(currentDatabase(), measures, 5, 10, 15, 10000, 1000000, 10000000, 100000000)
@@ -0,0 +1,8 @@
+CREATE TABLE project_audit (
+  project_id UInt32,
+  action LowCardinality(String),
+  message String,
+  time DateTime
+)
+ENGINE = MergeTree()
+ORDER BY (project_id, time)
@@ -0,0 +1,118 @@
+DROP TABLE IF EXISTS spans_index_buffer
+
+--migrate:split
+
+ALTER TABLE spans_index
+  ADD COLUMN "service.key" LowCardinality(String) AFTER "service.name"
+
+--migrate:split
+
+ALTER TABLE spans_index
+  UPDATE "service.key" = "service.name" WHERE 1
+
+--migrate:split
+
+CREATE TABLE spans_index_buffer AS spans_index
+ENGINE = Buffer(currentDatabase(), spans_index, 5, 10, 15, 10000, 1000000, 10000000, 100000000)
+
+--------------------------------------------------------------------------------
+--migrate:split
+
+DROP VIEW IF EXISTS span_service_minutes_mv
+
+--migrate:split
+
+CREATE MATERIALIZED VIEW span_service_minutes_mv
+TO span_service_minutes AS
+SELECT
+  project_id,
+  "span.system" AS system,
+  "service.key" AS service,
+  toStartOfMinute("span.time") AS time,
+  quantilesTDigestWeightedState(0.5, 0.9, 0.99)(toFloat32("span.duration"), toUInt32("span.count")) AS tdigest,
+  toUInt64(sum("span.count")) AS count,
+  countIf("span.status_code" = 'error') AS error_count
+FROM spans_index
+GROUP BY project_id, time, system, service
+SETTINGS prefer_column_name_to_alias = 1
+
+--------------------------------------------------------------------------------
+--migrate:split
+
+DROP VIEW IF EXISTS span_group_minutes_mv
+
+--migrate:split
+
+CREATE MATERIALIZED VIEW span_group_minutes_mv
+TO span_group_minutes AS
+SELECT
+  project_id,
+  "span.system" AS system,
+  "service.key" AS service,
+  "span.group_id" AS group_id,
+  toStartOfMinute("span.time") AS time,
+  any("span.name") AS name,
+  any("span.event_name") AS event_name,
+  quantilesTDigestWeightedState(0.5, 0.9, 0.99)(toFloat32("span.duration"), toUInt32("span.count")) AS tdigest,
+  toUInt64(sum("span.count")) AS count,
+  toUInt64(sumIf("span.count", "span.status_code" = 'error')) AS error_count,
+  toUInt64(sumIf("span.count", "span.apdex_level" = 'satisfied')) AS satisfied_count,
+  toUInt64(sumIf("span.count", "span.apdex_level" = 'tolerating')) AS tolerating_count,
+  toUInt64(sumIf("span.count", "span.apdex_level" = 'frustrated')) AS frustrated_count
+FROM spans_index
+GROUP BY project_id, system, service, group_id, time
+SETTINGS prefer_column_name_to_alias = 1
+
+--------------------------------------------------------------------------------
+--migrate:split
+
+DROP VIEW IF EXISTS span_http_minutes_mv
+
+--migrate:split
+
+CREATE MATERIALIZED VIEW span_http_minutes_mv
+TO span_http_minutes AS
+SELECT
+  project_id,
+  "span.system" AS system,
+  "service.key" AS service,
+  "span.group_id" AS group_id,
+  attr_values[indexOf(attr_keys, 'http.method')] AS http_method,
+  if(attr_values[indexOf(attr_keys, 'http.status_code')] = '', '',
+    concat(substring(attr_values[indexOf(attr_keys, 'http.status_code')], 1, 1), 'xx')) AS status_class,
+  toStartOfMinute("span.time") AS time,
+  any("span.name") AS name,
+  quantilesTDigestWeightedState(0.5, 0.9, 0.99)(toFloat32("span.duration"), toUInt32("span.count")) AS tdigest,
+  toUInt64(sum("span.count")) AS count,
+  toUInt64(sumIf("span.count", "span.status_code" = 'error')) AS error_count
+FROM spans_index
+WHERE "span.system" LIKE 'http:%'
+GROUP BY project_id, system, service, group_id, http_method, status_class, time
+SETTINGS prefer_column_name_to_alias = 1
+
+--------------------------------------------------------------------------------
+--migrate:split
+
+DROP VIEW IF EXISTS span_rpc_minutes_mv
+
+--migrate:split
+
+CREATE MATERIALIZED VIEW span_rpc_minutes_mv
+TO span_rpc_minutes AS
+SELECT
+  project_id,
+  "span.system" AS system,
+  "service.key" AS service,
+  "span.group_id" AS group_id,
+  attr_values[indexOf(attr_keys, 'rpc.service')] AS rpc_service,
+  attr_values[indexOf(attr_keys, 'rpc.method')] AS rpc_method,
+  attr_values[indexOf(attr_keys, 'rpc.grpc.status_code')] AS grpc_status_code,
+  toStartOfMinute("span.time") AS time,
+  any("span.name") AS name,
+  quantilesTDigestWeightedState(0.5, 0.9, 0.99)(toFloat32("span.duration"), toUInt32("span.count")) AS tdigest,
+  toUInt64(sum("span.count")) AS count,
+  toUInt64(sumIf("span.count", "span.status_code" = 'error')) AS error_count
+FROM spans_index
+WHERE "span.system" LIKE 'rpc:%'
+GROUP BY project_id, system, service, group_id, rpc_service, rpc_method, grpc_status_code, time
+SETTINGS prefer_column_name_to_alias = 1
@@ -0,0 +1,207 @@
+package bunapp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// NetPolicy allows or denies connections by the client IP address.
+// Denied networks take precedence over allowed ones; an empty allow list
+// allows all networks.
+type NetPolicy struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+func (p *NetPolicy) init(name string) error {
+	var err error
+	if p.allow, err = parseCIDRs(p.Allow); err != nil {
+		return fmt.Errorf("%s.allow: %w", name, err)
+	}
+	if p.deny, err = parseCIDRs(p.Deny); err != nil {
+		return fmt.Errorf("%s.deny: %w", name, err)
+	}
+	return nil
+}
+
+func (p *NetPolicy) empty() bool {
+	return len(p.allow) == 0 && len(p.deny) == 0
+}
+
+func (p *NetPolicy) Allowed(ip net.IP) bool {
+	if ip == nil {
+		return p.empty()
+	}
+	if containsIP(p.deny, ip) {
+		return false
+	}
+	return len(p.allow) == 0 || containsIP(p.allow, ip)
+}
+
+// parseCIDRs parses networks in the CIDR notation and single IP addresses.
+func parseCIDRs(ss []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(ss))
+	for _, s := range ss {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address: %q", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipnet := range nets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseAddrIP(addr string) net.IP {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(addr)
+}
+
+//------------------------------------------------------------------------------
+
+// ingestPaths are HTTP endpoints that receive telemetry. They are checked against
+// the ingest policy and the rest of the HTTP API and UI against the API policy.
+var ingestPaths = []string{
+	"/v1/",
+	"/TraceSegments",
+	"/v0.3/",
+	"/v0.4/",
+	"/intake/v2/",
+	"/api/v1/checkins/",
+}
+
+// ingestEndpoints are ingest endpoints under /api that are matched exactly.
+var ingestEndpoints = []string{
+	"/api/traces",    // Jaeger Thrift over HTTP
+	"/api/logs/json", // JSON logs
+}
+
+func isIngestPath(path string) bool {
+	for _, prefix := range ingestPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	for _, endpoint := range ingestEndpoints {
+		if path == endpoint {
+			return true
+		}
+	}
+	// Sentry endpoints: /api/:project_id/envelope/ and /api/:project_id/store/.
+	return strings.HasPrefix(path, "/api/") &&
+		(strings.HasSuffix(path, "/envelope/") || strings.HasSuffix(path, "/store/"))
+}
+
+func (app *App) netPolicyHandler(next http.Handler) http.Handler {
+	conf := &app.cfg.NetworkPolicies
+	if conf.Ingest.empty() && conf.API.empty() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		policy := &conf.API
+		if isIngestPath(req.URL.Path) {
+			policy = &conf.Ingest
+		}
+
+		if !policy.Allowed(app.clientIP(req)) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (app *App) clientIP(req *http.Request) net.IP {
+	return clientIP(req, app.cfg.Site.trustedProxies)
+}
+
+// clientIP returns the IP address of the client. X-Forwarded-For is used only when
+// the request comes from a trusted proxy. Clients can put any addresses in the header,
+// so it is read from the right and the first address that is not a trusted proxy
+// is the client.
+func clientIP(req *http.Request, trustedProxies []*net.IPNet) net.IP {
+	ip := parseAddrIP(req.RemoteAddr)
+	if ip == nil || !containsIP(trustedProxies, ip) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseAddrIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !containsIP(trustedProxies, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+func (app *App) grpcNetPolicyAllowed(ctx context.Context) error {
+	policy := &app.cfg.NetworkPolicies.Ingest
+
+	if !policy.Allowed(ClientIPFromContext(ctx)) {
+		return status.Error(codes.PermissionDenied, "client address is not allowed")
+	}
+	return nil
+}
+
+func (app *App) grpcNetPolicyUnaryInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	if err := app.grpcNetPolicyAllowed(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (app *App) grpcNetPolicyStreamInterceptor(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if err := app.grpcNetPolicyAllowed(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,65 @@
+package bunapp
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetPolicy(t *testing.T) {
+	policy := &NetPolicy{
+		Allow: []string{"10.8.0.0/16", "127.0.0.1"},
+		Deny:  []string{"10.8.1.0/24"},
+	}
+	require.NoError(t, policy.init("api"))
+
+	require.True(t, policy.Allowed(net.ParseIP("10.8.0.1")))
+	require.True(t, policy.Allowed(net.ParseIP("127.0.0.1")))
+	require.False(t, policy.Allowed(net.ParseIP("10.8.1.1")))
+	require.False(t, policy.Allowed(net.ParseIP("192.168.0.1")))
+	require.False(t, policy.Allowed(nil))
+
+	require.True(t, new(NetPolicy).Allowed(net.ParseIP("192.168.0.1")))
+	require.Error(t, (&NetPolicy{Allow: []string{"10.8.0.0/33"}}).init("api"))
+}
+
+func TestIsIngestPath(t *testing.T) {
+	require.True(t, isIngestPath("/v1/traces"))
+	require.True(t, isIngestPath("/v0.4/traces"))
+	require.True(t, isIngestPath("/intake/v2/events"))
+	require.True(t, isIngestPath("/api/1/envelope/"))
+	require.True(t, isIngestPath("/api/1/store/"))
+	require.True(t, isIngestPath("/api/v1/checkins/backup"))
+	require.True(t, isIngestPath("/api/traces"))
+	require.False(t, isIngestPath("/api/traces/1"))
+	require.True(t, isIngestPath("/api/logs/json"))
+	require.False(t, isIngestPath("/api/tracing/1/spans"))
+	require.False(t, isIngestPath("/"))
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := parseCIDRs([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+
+	clientIPOf := func(remoteAddr string, xff ...string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		for _, s := range xff {
+			req.Header.Add("X-Forwarded-For", s)
+		}
+		return clientIP(req, trusted).String()
+	}
+
+	// The header is ignored when the request does not come from a trusted proxy.
+	require.Equal(t, "203.0.113.1", clientIPOf("203.0.113.1:1234", "10.8.0.1"))
+	require.Equal(t, "10.0.0.1", clientIPOf("10.0.0.1:1234"))
+
+	require.Equal(t, "203.0.113.1", clientIPOf("10.0.0.1:1234", "203.0.113.1"))
+	// Spoofed addresses on the left are skipped.
+	require.Equal(t, "203.0.113.1", clientIPOf("10.0.0.1:1234", "10.8.0.1, 203.0.113.1, 10.0.0.2"))
+	require.Equal(t, "203.0.113.1", clientIPOf("10.0.0.1:1234", "127.0.0.1", "203.0.113.1"))
+	require.Equal(t, "10.0.0.2", clientIPOf("10.0.0.1:1234", "garbage, 10.0.0.2"))
+}
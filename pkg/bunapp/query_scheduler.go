@@ -0,0 +1,228 @@
+package bunapp
+
+import (
+	"context"
+	"sync"
+
+	"github.com/uptrace/go-clickhouse/ch"
+)
+
+// QueryTenant identifies who runs a ClickHouse query.
+type QueryTenant struct {
+	ProjectID uint32
+	UserID    uint64
+}
+
+type queryTenantCtxKey struct{}
+
+// ContextWithQueryTenant returns a context with the tenant that is used to schedule
+// ClickHouse queries made with the context.
+func ContextWithQueryTenant(ctx context.Context, tenant QueryTenant) context.Context {
+	return context.WithValue(ctx, queryTenantCtxKey{}, tenant)
+}
+
+func QueryTenantFromContext(ctx context.Context) (QueryTenant, bool) {
+	tenant, ok := ctx.Value(queryTenantCtxKey{}).(QueryTenant)
+	return tenant, ok
+}
+
+//------------------------------------------------------------------------------
+
+type queryWaiter struct {
+	tenant QueryTenant
+	ready  chan struct{}
+}
+
+// QueryScheduler limits the number of concurrent queries per project and per user.
+// Queries that exceed the limits wait in per-user queues that are served in turns
+// so a user that runs many slow queries does not starve other users.
+type QueryScheduler struct {
+	maxQueries int
+	maxProject int
+	maxUser    int
+
+	mu        sync.Mutex
+	running   int
+	byProject map[uint32]int
+	byUser    map[uint64]int
+	queues    map[QueryTenant][]*queryWaiter
+	// Tenants with waiting queries in round-robin order.
+	order []QueryTenant
+}
+
+func NewQueryScheduler(maxQueries, maxProject, maxUser int) *QueryScheduler {
+	return &QueryScheduler{
+		maxQueries: maxQueries,
+		maxProject: maxProject,
+		maxUser:    maxUser,
+		byProject:  make(map[uint32]int),
+		byUser:     make(map[uint64]int),
+		queues:     make(map[QueryTenant][]*queryWaiter),
+	}
+}
+
+// Acquire waits until the tenant can run a query. The caller must call Release
+// after the query is finished.
+func (s *QueryScheduler) Acquire(ctx context.Context, tenant QueryTenant) error {
+	s.mu.Lock()
+
+	if len(s.queues[tenant]) == 0 && s.canRun(tenant) {
+		s.start(tenant)
+		s.mu.Unlock()
+		return nil
+	}
+
+	w := &queryWaiter{tenant: tenant, ready: make(chan struct{})}
+	if len(s.queues[tenant]) == 0 {
+		s.order = append(s.order, tenant)
+	}
+	s.queues[tenant] = append(s.queues[tenant], w)
+
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		// The query was started while the context was being canceled.
+		s.finish(tenant)
+		s.dispatch()
+	default:
+		s.remove(w)
+	}
+	return ctx.Err()
+}
+
+func (s *QueryScheduler) Release(tenant QueryTenant) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.finish(tenant)
+	s.dispatch()
+}
+
+func (s *QueryScheduler) canRun(tenant QueryTenant) bool {
+	if s.maxQueries > 0 && s.running >= s.maxQueries {
+		return false
+	}
+	if s.maxProject > 0 && s.byProject[tenant.ProjectID] >= s.maxProject {
+		return false
+	}
+	if s.maxUser > 0 && s.byUser[tenant.UserID] >= s.maxUser {
+		return false
+	}
+	return true
+}
+
+func (s *QueryScheduler) start(tenant QueryTenant) {
+	s.running++
+	s.byProject[tenant.ProjectID]++
+	s.byUser[tenant.UserID]++
+}
+
+func (s *QueryScheduler) finish(tenant QueryTenant) {
+	s.running--
+	s.byProject[tenant.ProjectID]--
+	if s.byProject[tenant.ProjectID] == 0 {
+		delete(s.byProject, tenant.ProjectID)
+	}
+	s.byUser[tenant.UserID]--
+	if s.byUser[tenant.UserID] == 0 {
+		delete(s.byUser, tenant.UserID)
+	}
+}
+
+// dispatch starts waiting queries taking one query from each tenant in turn.
+func (s *QueryScheduler) dispatch() {
+	for i := 0; i < len(s.order); {
+		tenant := s.order[i]
+		if !s.canRun(tenant) {
+			i++
+			continue
+		}
+
+		queue := s.queues[tenant]
+		w := queue[0]
+		s.start(tenant)
+		close(w.ready)
+
+		if len(queue) == 1 {
+			delete(s.queues, tenant)
+			s.order = append(s.order[:i], s.order[i+1:]...)
+		} else {
+			s.queues[tenant] = queue[1:]
+			// Move the tenant to the end of the line.
+			s.order = append(append(s.order[:i], s.order[i+1:]...), tenant)
+		}
+
+		if s.maxQueries > 0 && s.running >= s.maxQueries {
+			return
+		}
+		i = 0
+	}
+}
+
+func (s *QueryScheduler) remove(w *queryWaiter) {
+	queue := s.queues[w.tenant]
+	for i, el := range queue {
+		if el == w {
+			queue = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+
+	if len(queue) > 0 {
+		s.queues[w.tenant] = queue
+		return
+	}
+
+	delete(s.queues, w.tenant)
+	for i, tenant := range s.order {
+		if tenant == w.tenant {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
+
+//------------------------------------------------------------------------------
+
+type querySchedulerHook struct {
+	scheduler *QueryScheduler
+}
+
+var _ ch.QueryHook = (*querySchedulerHook)(nil)
+
+type querySchedulerStashKey struct{}
+
+// BeforeQuery blocks SELECT queries made on behalf of a tenant until the scheduler
+// allows them. Queries whose context is canceled while waiting fail with the context error.
+func (h *querySchedulerHook) BeforeQuery(ctx context.Context, evt *ch.QueryEvent) context.Context {
+	tenant, ok := QueryTenantFromContext(ctx)
+	if !ok || evt.Operation() != "SELECT" {
+		return ctx
+	}
+
+	if err := h.scheduler.Acquire(ctx, tenant); err != nil {
+		return ctx
+	}
+
+	if evt.Stash == nil {
+		evt.Stash = make(map[any]any)
+	}
+	evt.Stash[querySchedulerStashKey{}] = tenant
+	return ctx
+}
+
+func (h *querySchedulerHook) AfterQuery(ctx context.Context, evt *ch.QueryEvent) {
+	if tenant, ok := evt.Stash[querySchedulerStashKey{}].(QueryTenant); ok {
+		h.scheduler.Release(tenant)
+	}
+}
@@ -0,0 +1,65 @@
+package bunapp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuerySchedulerFairness(t *testing.T) {
+	ctx := context.Background()
+	s := NewQueryScheduler(1, 0, 0)
+
+	alice := QueryTenant{ProjectID: 1, UserID: 1}
+	bob := QueryTenant{ProjectID: 1, UserID: 2}
+
+	require.NoError(t, s.Acquire(ctx, alice))
+
+	started := make(chan QueryTenant, 3)
+	acquire := func(tenant QueryTenant, queued int) {
+		go func() {
+			require.NoError(t, s.Acquire(ctx, tenant))
+			started <- tenant
+		}()
+		require.Eventually(t, func() bool {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			n := 0
+			for _, queue := range s.queues {
+				n += len(queue)
+			}
+			return n == queued
+		}, time.Second, time.Millisecond)
+	}
+
+	acquire(alice, 1)
+	acquire(alice, 2)
+	acquire(bob, 3)
+
+	// Alice queued first, but then users take turns.
+	running := alice
+	for _, want := range []QueryTenant{alice, bob, alice} {
+		s.Release(running)
+		running = <-started
+		require.Equal(t, want, running)
+	}
+	s.Release(running)
+	require.Equal(t, 0, s.running)
+}
+
+func TestQuerySchedulerCanceled(t *testing.T) {
+	s := NewQueryScheduler(0, 0, 1)
+	tenant := QueryTenant{ProjectID: 1, UserID: 1}
+
+	require.NoError(t, s.Acquire(context.Background(), tenant))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, s.Acquire(ctx, tenant), context.DeadlineExceeded)
+	require.Empty(t, s.queues)
+
+	// Other users are not limited.
+	require.NoError(t, s.Acquire(context.Background(), QueryTenant{ProjectID: 1, UserID: 2}))
+}
@@ -0,0 +1,151 @@
+package bunapp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/uptrace/go-clickhouse/ch"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDHeader carries the request id in HTTP requests and responses and, in lower
+// case, in gRPC metadata. Clients and proxies can set it to correlate their logs;
+// otherwise an id is generated.
+const RequestIDHeader = "X-Request-Id"
+
+const requestIDAttr = "request_id"
+
+type requestIDCtxKey struct{}
+
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDCtxKey{}, id)
+}
+
+// RequestIDFromContext returns the id of the HTTP or gRPC request or an empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey{}).(string)
+	return id
+}
+
+// requestID returns the id sent by the client when it is short and printable
+// so it is safe to log, or a new random id.
+func requestID(id string) string {
+	if id != "" && len(id) <= 64 && strings.IndexFunc(id, invalidRequestIDRune) == -1 {
+		return id
+	}
+
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func invalidRequestIDRune(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return false
+	case r == '-', r == '_', r == '.', r == ':':
+		return false
+	}
+	return true
+}
+
+func requestIDHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := requestID(req.Header.Get(RequestIDHeader))
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := req.Context()
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String(requestIDAttr, id))
+		next.ServeHTTP(w, req.WithContext(ContextWithRequestID(ctx, id)))
+	})
+}
+
+//------------------------------------------------------------------------------
+
+var grpcRequestIDKey = strings.ToLower(RequestIDHeader)
+
+func grpcRequestIDContext(ctx context.Context) context.Context {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ss := md.Get(grpcRequestIDKey); len(ss) > 0 {
+			id = ss[0]
+		}
+	}
+	id = requestID(id)
+
+	_ = grpc.SetHeader(ctx, metadata.Pairs(grpcRequestIDKey, id))
+	return ContextWithRequestID(ctx, id)
+}
+
+// withRequestInfo adds the request id to the error status as RequestInfo.
+func withRequestInfo(ctx context.Context, err error) error {
+	st := status.Convert(err)
+	if withInfo, err := st.WithDetails(&errdetails.RequestInfo{
+		RequestId: RequestIDFromContext(ctx),
+	}); err == nil {
+		st = withInfo
+	}
+	return st.Err()
+}
+
+func grpcRequestIDUnaryInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	ctx = grpcRequestIDContext(ctx)
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return nil, withRequestInfo(ctx, err)
+	}
+	return resp, nil
+}
+
+type requestIDServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *requestIDServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func grpcRequestIDStreamInterceptor(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	ctx := grpcRequestIDContext(ss.Context())
+	if err := handler(srv, &requestIDServerStream{ServerStream: ss, ctx: ctx}); err != nil {
+		return withRequestInfo(ctx, err)
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+// requestIDQueryHook records the request id on ClickHouse query spans. It must be
+// added before the chotel hook that ends the spans.
+type requestIDQueryHook struct{}
+
+var _ ch.QueryHook = (*requestIDQueryHook)(nil)
+
+func (h *requestIDQueryHook) BeforeQuery(ctx context.Context, evt *ch.QueryEvent) context.Context {
+	return ctx
+}
+
+func (h *requestIDQueryHook) AfterQuery(ctx context.Context, evt *ch.QueryEvent) {
+	if id := RequestIDFromContext(ctx); id != "" {
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String(requestIDAttr, id))
+	}
+}
@@ -0,0 +1,62 @@
+package bunapp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRequestIDHandler(t *testing.T) {
+	var ctxID string
+	handler := requestIDHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctxID = RequestIDFromContext(req.Context())
+	}))
+	serve := func(id string) string {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/projects", nil)
+		if id != "" {
+			req.Header.Set(RequestIDHeader, id)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		require.Equal(t, ctxID, w.Header().Get(RequestIDHeader))
+		return ctxID
+	}
+
+	require.Len(t, serve(""), 16)
+	require.NotEqual(t, serve(""), serve(""))
+	require.Equal(t, "lb-1234:abcd", serve("lb-1234:abcd"))
+	require.Len(t, serve("bad id\n"), 16)
+}
+
+func TestGRPCRequestID(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs("x-request-id", "client-id"))
+
+	_, err := grpcRequestIDUnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{},
+		func(ctx context.Context, req any) (any, error) {
+			require.Equal(t, "client-id", RequestIDFromContext(ctx))
+			return nil, status.Error(codes.InvalidArgument, "bad request")
+		})
+
+	st := status.Convert(err)
+	require.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 1)
+	require.Equal(t, "client-id", st.Details()[0].(*errdetails.RequestInfo).RequestId)
+
+	_, err = grpcRequestIDUnaryInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{},
+		func(ctx context.Context, req any) (any, error) {
+			return nil, errors.New("internal")
+		})
+	st = status.Convert(err)
+	require.Equal(t, codes.Unknown, st.Code())
+	require.Len(t, st.Details()[0].(*errdetails.RequestInfo).RequestId, 16)
+}
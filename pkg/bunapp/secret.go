@@ -0,0 +1,216 @@
+package bunapp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+	"gopkg.in/yaml.v3"
+)
+
+// Encrypted config values have the form enc:v1:<key id>:<base64 nonce and ciphertext>.
+// The key id selects the secret key the value was encrypted with so secret keys
+// can be rotated without re-encrypting all values at once.
+const encryptedPrefix = "enc:v1:"
+
+var errNoSecretKey = errors.New("secret_key is required to encrypt config values")
+
+type secretCipher struct {
+	id   string
+	aead cipher.AEAD
+}
+
+func newSecretCipher(secretKey string) (*secretCipher, error) {
+	key := make([]byte, 32)
+	kdf := hkdf.New(sha256.New, []byte(secretKey), nil, []byte("uptrace config encryption"))
+	if _, err := io.ReadFull(kdf, key); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(key)
+	return &secretCipher{
+		id:   hex.EncodeToString(sum[:4]),
+		aead: aead,
+	}, nil
+}
+
+func (c *secretCipher) encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	b := c.aead.Seal(nonce, nonce, []byte(plaintext), []byte(c.id))
+	return encryptedPrefix + c.id + ":" + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (c *secretCipher) decrypt(b []byte) (string, error) {
+	size := c.aead.NonceSize()
+	if len(b) < size {
+		return "", errors.New("encrypted value is too short")
+	}
+
+	plaintext, err := c.aead.Open(nil, b[:size], b[size:], []byte(c.id))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// EncryptSecret encrypts the value using the current secret key so it can be
+// stored in the config file instead of the plaintext.
+func (c *AppConfig) EncryptSecret(value string) (string, error) {
+	if c.SecretKey == "" {
+		return "", errNoSecretKey
+	}
+	sc, err := newSecretCipher(c.SecretKey)
+	if err != nil {
+		return "", err
+	}
+	return sc.encrypt(value)
+}
+
+// decryptSecret decrypts the value using the current or one of the old secret keys.
+// Plaintext values are returned as is.
+func (c *AppConfig) decryptSecret(value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+
+	keyID, encoded, ok := strings.Cut(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if !ok {
+		return "", errors.New("invalid encrypted value")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+
+	for _, secretKey := range append([]string{c.SecretKey}, c.OldSecretKeys...) {
+		if secretKey == "" {
+			continue
+		}
+
+		sc, err := newSecretCipher(secretKey)
+		if err != nil {
+			return "", err
+		}
+		if sc.id == keyID {
+			return sc.decrypt(b)
+		}
+	}
+
+	return "", fmt.Errorf("secret key %s is not configured (add it to old_secret_keys)", keyID)
+}
+
+type configSecret struct {
+	name  string
+	value *string
+}
+
+// decryptSecrets decrypts project tokens and other secrets stored in the config.
+func (c *AppConfig) decryptSecrets() error {
+	secrets := []configSecret{
+		{"db.dsn", &c.DB.DSN},
+		{"ch.dsn", &c.CH.DSN},
+		{"blob_storage.s3.secret_access_key", &c.BlobStorage.S3.SecretAccessKey},
+		{"ingest.kafka.dsn", &c.Ingest.Kafka.DSN},
+	}
+	for i := range c.Users {
+		secrets = append(secrets,
+			configSecret{fmt.Sprintf("users[%d].password", i), &c.Users[i].Password})
+	}
+	for i := range c.Projects {
+		secrets = append(secrets,
+			configSecret{fmt.Sprintf("projects[%d].token", i), &c.Projects[i].Token})
+	}
+	for i := range c.Alerting.Notifiers {
+		notifier := &c.Alerting.Notifiers[i]
+		secrets = append(secrets,
+			configSecret{fmt.Sprintf("alerting.notifiers[%d].url", i), &notifier.URL},
+			configSecret{fmt.Sprintf("alerting.notifiers[%d].routing_key", i), &notifier.RoutingKey})
+	}
+
+	for _, secret := range secrets {
+		value, err := c.decryptSecret(*secret.value)
+		if err != nil {
+			return fmt.Errorf("can't decrypt %s: %w", secret.name, err)
+		}
+		*secret.value = value
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+// secretConfigKeys are config keys which plaintext values are secrets.
+var secretConfigKeys = map[string]bool{
+	"secret_key":        true,
+	"old_secret_keys":   true,
+	"dsn":               true,
+	"password":          true,
+	"token":             true,
+	"secret_access_key": true,
+	"routing_key":       true,
+}
+
+// RedactConfig replaces plaintext secrets in the YAML config file with [REDACTED].
+// Encrypted values are kept because they can't be read without the secret key.
+func RedactConfig(b []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	redactConfigNode(&doc, "")
+	return yaml.Marshal(&doc)
+}
+
+func redactConfigNode(node *yaml.Node, parent string) {
+	if node.Kind != yaml.MappingNode {
+		for _, child := range node.Content {
+			redactConfigNode(child, parent)
+		}
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		// Webhook and Slack URLs contain the credentials.
+		if secretConfigKeys[key] || (parent == "notifiers" && key == "url") {
+			redactConfigValue(value)
+			continue
+		}
+		redactConfigNode(value, key)
+	}
+}
+
+func redactConfigValue(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.Value != "" && !strings.HasPrefix(node.Value, encryptedPrefix) {
+			node.Value = redactedValue
+			node.Style = 0
+		}
+	case yaml.SequenceNode:
+		for _, child := range node.Content {
+			redactConfigValue(child)
+		}
+	}
+}
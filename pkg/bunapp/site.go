@@ -0,0 +1,117 @@
+package bunapp
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ForRequest returns a copy of the config that uses the scheme and the host the client
+// used to reach Uptrace through a reverse proxy. It returns the config itself when
+// site.trust_proxy is disabled or the request does not have forwarded headers.
+func (c *AppConfig) ForRequest(req *http.Request) *AppConfig {
+	if !c.Site.TrustProxy {
+		return c
+	}
+
+	scheme := firstHeaderValue(req.Header.Get("X-Forwarded-Proto"))
+	host := firstHeaderValue(req.Header.Get("X-Forwarded-Host"))
+	if scheme == "" && host == "" {
+		return c
+	}
+
+	clone := *c
+	if scheme != "" {
+		clone.Site.Scheme = scheme
+	}
+	if host != "" {
+		hostname, port, err := net.SplitHostPort(host)
+		if err != nil {
+			hostname = host
+			port = firstHeaderValue(req.Header.Get("X-Forwarded-Port"))
+		}
+		if port == "" {
+			port = "80"
+			if clone.Site.Scheme == "https" {
+				port = "443"
+			}
+		}
+		clone.Listen.HTTPHost = hostname
+		clone.Listen.HTTPPort = port
+		clone.Listen.GRPCHost = hostname
+	}
+	return &clone
+}
+
+// firstHeaderValue returns the value set by the proxy closest to the client.
+func firstHeaderValue(s string) string {
+	if i := strings.IndexByte(s, ','); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// SiteURL returns the absolute URL of the UI or API path, for example, "/traces/1/...".
+func (c *AppConfig) SiteURL(path string) string {
+	return fmt.Sprintf("%s://%s:%s%s%s",
+		c.Site.Scheme, c.Listen.HTTPHost, c.Listen.HTTPPort, c.Site.URLPrefix, path)
+}
+
+// TraceURL returns the link to the trace or, if the span id is not zero, to the span.
+func (c *AppConfig) TraceURL(projectID uint32, traceID string, spanID uint64) string {
+	path := fmt.Sprintf("/traces/%d/%s", projectID, traceID)
+	if spanID != 0 {
+		path += fmt.Sprintf("/%d", spanID)
+	}
+	return c.SiteURL(path)
+}
+
+// ExploreURL returns the link to span groups of the system filtered by the UQL query.
+func (c *AppConfig) ExploreURL(projectID uint32, system, query string) string {
+	values := make(url.Values)
+	if system != "" {
+		values.Set("system", system)
+	}
+	if query != "" {
+		values.Set("query", query)
+	}
+	return c.siteURLWithValues(fmt.Sprintf("/explore/%d", projectID), values)
+}
+
+// SpanGroupURL returns the link to the span group.
+func (c *AppConfig) SpanGroupURL(projectID uint32, system string, groupID uint64) string {
+	values := url.Values{
+		"system": {system},
+		"where":  {fmt.Sprintf(`span.group_id = "%d"`, groupID)},
+	}
+	return c.siteURLWithValues(fmt.Sprintf("/explore/%d", projectID), values)
+}
+
+// AlertURL returns the link to the alert timeline around the time the alert fired.
+func (c *AppConfig) AlertURL(projectID uint32, key string, firedAt time.Time) string {
+	values := url.Values{
+		"key":      {key},
+		"time_gte": {firedAt.Add(-time.Hour).UTC().Format(time.RFC3339)},
+		"time_lt":  {firedAt.Add(24 * time.Hour).UTC().Format(time.RFC3339)},
+	}
+	return c.siteURLWithValues(fmt.Sprintf("/api/alerting/%d/alerts/timeline", projectID), values)
+}
+
+func (c *AppConfig) siteURLWithValues(path string, values url.Values) string {
+	if len(values) == 0 {
+		return c.SiteURL(path)
+	}
+	return c.SiteURL(path + "?" + values.Encode())
+}
+
+// normURLPrefix converts "uptrace/" to "/uptrace".
+func normURLPrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix
+}
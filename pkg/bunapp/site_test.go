@@ -0,0 +1,41 @@
+package bunapp
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSiteURL(t *testing.T) {
+	cfg := new(AppConfig)
+	cfg.Site.Scheme = "https"
+	cfg.Listen.HTTPHost = "example.com"
+	cfg.Listen.HTTPPort = "443"
+	cfg.Site.URLPrefix = normURLPrefix("uptrace/")
+
+	require.Equal(t, "https://example.com:443/uptrace/", cfg.SiteAddr())
+	require.Equal(t, "https://example.com:443/uptrace/traces/1/abc/123", cfg.TraceURL(1, "abc", 123))
+	require.Equal(t,
+		"https://example.com:443/uptrace/explore/1?system=http&where=span.group_id+%3D+%2242%22",
+		cfg.SpanGroupURL(1, "http", 42))
+}
+
+func TestForRequest(t *testing.T) {
+	cfg := new(AppConfig)
+	cfg.Site.Scheme = "http"
+	cfg.Listen.HTTPHost = "localhost"
+	cfg.Listen.HTTPPort = "14318"
+	cfg.Site.URLPrefix = "/uptrace"
+
+	req, err := http.NewRequest("GET", "/api/conn-info", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "example.com, proxy.local")
+
+	require.Equal(t, "http://localhost:14318/uptrace/", cfg.ForRequest(req).SiteAddr())
+
+	cfg.Site.TrustProxy = true
+	require.Equal(t, "https://example.com:443/uptrace/", cfg.ForRequest(req).SiteAddr())
+	require.Equal(t, "http://localhost:14318/uptrace/", cfg.SiteAddr())
+}
@@ -0,0 +1,313 @@
+package chadmin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/go-clickhouse/ch/chschema"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"go.uber.org/zap"
+)
+
+type BackupStatus string
+
+const (
+	BackupCreating      BackupStatus = "creating"
+	BackupCreated       BackupStatus = "created"
+	BackupFailed        BackupStatus = "failed"
+	BackupRestoring     BackupStatus = "restoring"
+	BackupRestored      BackupStatus = "restored"
+	BackupRestoreFailed BackupStatus = "restore_failed"
+)
+
+var backupNameRE = regexp.MustCompile(`^[\w.-]+$`)
+
+// Backup tracks the status of a backup. The table keeps the latest status.
+type Backup struct {
+	ch.CHModel `ch:"table:backups,alias:b"`
+
+	Name       string       `json:"name"`
+	Status     BackupStatus `json:"status" ch:",lc"`
+	Error      string       `json:"error"`
+	StartedAt  time.Time    `json:"startedAt"`
+	FinishedAt time.Time    `json:"finishedAt"`
+	Time       time.Time    `json:"-"`
+}
+
+// BackupConfig is the config file that is saved together with the backup
+// so it can be restored on another server.
+type BackupConfig struct {
+	ch.CHModel `ch:"table:backup_configs,alias:c"`
+
+	Name   string
+	Config string
+	Time   time.Time
+}
+
+var ErrBackupRunning = errors.New("another backup or restore is running")
+
+// BackupManager creates backups of the ClickHouse database on schedule.
+type BackupManager struct {
+	*bunapp.App
+
+	schedule cron.Schedule
+
+	mu      sync.Mutex
+	running bool
+}
+
+func NewBackupManager(app *bunapp.App) (*BackupManager, error) {
+	conf := app.Config().Backup
+
+	m := &BackupManager{App: app}
+
+	if conf.Schedule != "" {
+		schedule, err := cron.ParseStandard(conf.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("backup.schedule: %w", err)
+		}
+		m.schedule = schedule
+	}
+	if m.schedule != nil && conf.Disk == "" && conf.S3.URL == "" && conf.S3.NamedCollection == "" {
+		return nil, errors.New("backup requires a disk or an s3 url")
+	}
+
+	return m, nil
+}
+
+// Run creates backups on schedule until the app is stopped.
+func (m *BackupManager) Run(ctx context.Context, app *bunapp.App) error {
+	if m.schedule == nil {
+		return nil
+	}
+
+	app.WaitGroup().Add(1)
+	go func() {
+		defer app.WaitGroup().Done()
+
+		for {
+			next := m.schedule.Next(time.Now())
+			timer := time.NewTimer(time.Until(next))
+
+			select {
+			case <-app.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			if _, err := m.Create(app.Context()); err != nil {
+				app.Zap(ctx).Error("backup failed", zap.Error(err))
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (m *BackupManager) destination(name string) (chschema.QueryWithArgs, error) {
+	conf := m.Config().Backup
+
+	if conf.S3.NamedCollection != "" {
+		return ch.SafeQuery("S3(?, ?)", ch.Ident(conf.S3.NamedCollection), name), nil
+	}
+	if conf.S3.URL != "" {
+		// ClickHouse takes the credentials from the s3 endpoint settings.
+		url := strings.TrimSuffix(conf.S3.URL, "/") + "/" + name
+		return ch.SafeQuery("S3(?)", url), nil
+	}
+	if conf.Disk != "" {
+		return ch.SafeQuery("Disk(?, ?)", conf.Disk, name), nil
+	}
+	return chschema.QueryWithArgs{}, errors.New("backup requires a disk or an s3 url")
+}
+
+func (m *BackupManager) lock() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.running {
+		return ErrBackupRunning
+	}
+	m.running = true
+	return nil
+}
+
+func (m *BackupManager) unlock() {
+	m.mu.Lock()
+	m.running = false
+	m.mu.Unlock()
+}
+
+// Create backs up the database together with the config file and waits
+// until the backup is finished.
+func (m *BackupManager) Create(ctx context.Context) (*Backup, error) {
+	if err := m.lock(); err != nil {
+		return nil, err
+	}
+	defer m.unlock()
+
+	name := "uptrace-" + time.Now().UTC().Format("20060102-150405")
+	dest, err := m.destination(name)
+	if err != nil {
+		return nil, err
+	}
+
+	database, err := m.database(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	backup := &Backup{
+		Name:      name,
+		Status:    BackupCreating,
+		StartedAt: time.Now(),
+	}
+	if err := m.save(ctx, backup); err != nil {
+		return nil, err
+	}
+
+	err = m.saveConfig(ctx, name)
+	if err == nil {
+		_, err = m.CH().ExecContext(ctx, "BACKUP DATABASE ? TO ?", ch.Ident(database), dest)
+	}
+
+	backup.FinishedAt = time.Now()
+	if err != nil {
+		backup.Status = BackupFailed
+		backup.Error = err.Error()
+	} else {
+		backup.Status = BackupCreated
+	}
+	if err := m.save(ctx, backup); err != nil {
+		return nil, err
+	}
+
+	m.Zap(ctx).Info("backup finished",
+		zap.String("name", backup.Name),
+		zap.String("status", string(backup.Status)),
+		zap.Duration("took", backup.FinishedAt.Sub(backup.StartedAt)))
+	return backup, err
+}
+
+// Restore restores the backup into the target database which must not contain
+// the backed up tables. It returns the config file saved with the backup;
+// secrets in the file are redacted and must be set again.
+func (m *BackupManager) Restore(ctx context.Context, name, target string) (string, error) {
+	if !backupNameRE.MatchString(name) {
+		return "", fmt.Errorf("invalid backup name: %q", name)
+	}
+
+	if err := m.lock(); err != nil {
+		return "", err
+	}
+	defer m.unlock()
+
+	dest, err := m.destination(name)
+	if err != nil {
+		return "", err
+	}
+
+	database, err := m.database(ctx)
+	if err != nil {
+		return "", err
+	}
+	if target == "" {
+		target = database
+	}
+
+	backup := &Backup{
+		Name:      name,
+		Status:    BackupRestoring,
+		StartedAt: time.Now(),
+	}
+	// The backups table does not exist when restoring into an empty database.
+	if err := m.save(ctx, backup); err != nil {
+		m.Zap(ctx).Warn("can't save backup status", zap.Error(err))
+	}
+
+	_, err = m.CH().ExecContext(ctx, "RESTORE DATABASE ? AS ? FROM ?",
+		ch.Ident(database), ch.Ident(target), dest)
+
+	backup.FinishedAt = time.Now()
+	if err != nil {
+		backup.Status = BackupRestoreFailed
+		backup.Error = err.Error()
+	} else {
+		backup.Status = BackupRestored
+	}
+	if err := m.save(ctx, backup); err != nil {
+		m.Zap(ctx).Warn("can't save backup status", zap.Error(err))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var config string
+	if err := m.CH().QueryRowContext(ctx,
+		"SELECT config FROM ?.backup_configs WHERE name = ? LIMIT 1",
+		ch.Ident(target), name).Scan(&config); err != nil {
+		return "", fmt.Errorf("can't read the backup config: %w", err)
+	}
+	return config, nil
+}
+
+// Backups returns backups sorted from newest to oldest.
+func (m *BackupManager) Backups(ctx context.Context) ([]Backup, error) {
+	backups := make([]Backup, 0)
+
+	if err := m.CH().NewSelect().
+		Model(&backups).
+		ColumnExpr("name").
+		ColumnExpr("argMax(status, time) AS status").
+		ColumnExpr("argMax(error, time) AS error").
+		ColumnExpr("argMax(started_at, time) AS started_at").
+		ColumnExpr("argMax(finished_at, time) AS finished_at").
+		GroupExpr("name").
+		OrderExpr("name DESC").
+		Limit(1000).
+		Scan(ctx); err != nil {
+		return nil, err
+	}
+
+	return backups, nil
+}
+
+func (m *BackupManager) save(ctx context.Context, backup *Backup) error {
+	backup.Time = time.Now()
+	_, err := m.CH().NewInsert().Model(backup).Exec(ctx)
+	return err
+}
+
+func (m *BackupManager) saveConfig(ctx context.Context, name string) error {
+	b, err := os.ReadFile(m.Config().Filepath)
+	if err != nil {
+		return err
+	}
+
+	b, err = bunapp.RedactConfig(b)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.CH().NewInsert().Model(&BackupConfig{
+		Name:   name,
+		Config: string(b),
+		Time:   time.Now(),
+	}).Exec(ctx)
+	return err
+}
+
+func (m *BackupManager) database(ctx context.Context) (string, error) {
+	var database string
+	err := m.CH().QueryRowContext(ctx, "SELECT currentDatabase()").Scan(&database)
+	return database, err
+}
@@ -0,0 +1,55 @@
+package chadmin
+
+import (
+	"net/http"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"go.uber.org/zap"
+)
+
+type BackupHandler struct {
+	*bunapp.App
+
+	backups *BackupManager
+}
+
+func NewBackupHandler(app *bunapp.App, backups *BackupManager) *BackupHandler {
+	return &BackupHandler{
+		App:     app,
+		backups: backups,
+	}
+}
+
+func (h *BackupHandler) List(w http.ResponseWriter, req bunrouter.Request) error {
+	backups, err := h.backups.Backups(req.Context())
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"backups": backups,
+	})
+}
+
+// Create starts a backup in the background. Use List to track its status.
+func (h *BackupHandler) Create(w http.ResponseWriter, req bunrouter.Request) error {
+	if _, err := h.backups.destination(""); err != nil {
+		return httperror.BadRequest("backup", "%s", err)
+	}
+
+	h.WaitGroup().Add(1)
+	go func() {
+		defer h.WaitGroup().Done()
+
+		ctx := h.Context()
+		if _, err := h.backups.Create(ctx); err != nil {
+			h.Zap(ctx).Error("backup failed", zap.Error(err))
+		}
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
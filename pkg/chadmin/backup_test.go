@@ -0,0 +1,30 @@
+package chadmin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+func TestBackupDestination(t *testing.T) {
+	conf := new(bunapp.AppConfig)
+	conf.CH.DSN = "clickhouse://default:@localhost:9000/uptrace?sslmode=disable"
+	app := bunapp.New(context.Background(), conf)
+	defer app.Stop()
+
+	m := &BackupManager{App: app}
+	format := func() string {
+		dest, err := m.destination("uptrace-20220301-020000")
+		require.NoError(t, err)
+		return string(app.CH().Formatter().AppendQuery(nil, dest.Query, dest.Args...))
+	}
+
+	conf.Backup.S3.URL = "https://bucket.s3.amazonaws.com/uptrace/"
+	require.Equal(t,
+		"S3('https://bucket.s3.amazonaws.com/uptrace/uptrace-20220301-020000')", format())
+
+	conf.Backup.S3.NamedCollection = "s3_backups"
+	require.Equal(t, "S3(\"s3_backups\", 'uptrace-20220301-020000')", format())
+}
@@ -0,0 +1,59 @@
+package chadmin
+
+import (
+	"context"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/org"
+)
+
+func init() {
+	bunapp.OnStart("chadmin.init", initCHAdmin)
+}
+
+func initCHAdmin(ctx context.Context, app *bunapp.App) error {
+	ttls, err := NewTTLManager(app)
+	if err != nil {
+		return err
+	}
+	app.OnServe("chadmin.ttl", ttls.Run)
+	app.OnServe("chadmin.sampling", NewRetentionSampler(app).Run)
+
+	backups, err := NewBackupManager(app)
+	if err != nil {
+		return err
+	}
+	app.OnServe("chadmin.backups", backups.Run)
+
+	archiver := NewProjectArchiver(app)
+	app.OnServe("chadmin.projects", archiver.Run)
+
+	ttlHandler := NewTTLHandler(app, ttls)
+	partitionHandler := NewPartitionHandler(app)
+	backupHandler := NewBackupHandler(app, backups)
+	regroupHandler := NewRegroupHandler(app, NewRegroupManager(app))
+	projectAuditHandler := NewProjectAuditHandler(app, archiver)
+
+	g := app.APIGroup().
+		Use(org.NewAuthMiddleware(app)).
+		Use(org.NewAdminMiddleware(app)).
+		NewGroup("/ch")
+
+	g.GET("/tables", ttlHandler.List)
+	g.POST("/tables/sync-ttl", ttlHandler.Sync)
+
+	g.GET("/partitions", partitionHandler.List)
+	g.POST("/partitions/detach", partitionHandler.Detach)
+	g.POST("/partitions/drop", partitionHandler.Drop)
+	g.POST("/partitions/freeze", partitionHandler.Freeze)
+
+	g.GET("/backups", backupHandler.List)
+	g.POST("/backups", backupHandler.Create)
+
+	g.GET("/regroup", regroupHandler.Show)
+	g.POST("/regroup", regroupHandler.Start)
+
+	g.GET("/projects/audit", projectAuditHandler.List)
+
+	return nil
+}
@@ -0,0 +1,257 @@
+package chadmin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/go-clickhouse/ch/chschema"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/tracing"
+)
+
+// spanTables are tables that store spans and span stats. All of them are
+// partitioned by day.
+var spanTables = []string{
+	"spans_index",
+	"spans_data",
+	"span_system_minutes",
+	"span_system_hours",
+	"span_service_minutes",
+	"span_service_hours",
+	"span_host_minutes",
+	"span_host_hours",
+}
+
+// deleteSpansData deletes the data of the spans selected from spans_index with
+// indexWhere. Span data does not have a project id so it is looked up using the
+// trace ids from spans_index and must be deleted first. The mutation is synchronous
+// so spans_index still has the trace ids until the function returns.
+func deleteSpansData(
+	ctx context.Context, db *ch.DB, indexWhere chschema.QueryWithArgs, dataWhere ...chschema.QueryWithArgs,
+) error {
+	query := "ALTER TABLE spans_data DELETE WHERE trace_id IN " +
+		"(SELECT `span.trace_id` FROM spans_index WHERE ?)"
+	args := []any{indexWhere}
+	for _, where := range dataWhere {
+		query += " AND ?"
+		args = append(args, where)
+	}
+	query += " SETTINGS mutations_sync = 2"
+
+	if _, err := db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("can't delete spans_data: %w", err)
+	}
+	return nil
+}
+
+type PartitionFilter struct {
+	*bunapp.App `urlstruct:"-"`
+
+	tracing.TimeFilter
+
+	// Only delete data of the project. Partitions are shared by projects so
+	// detaching and freezing do not support it.
+	ProjectID uint32
+	Table     []string
+}
+
+func DecodePartitionFilter(app *bunapp.App, req bunrouter.Request) (*PartitionFilter, error) {
+	f := &PartitionFilter{App: app}
+	if err := bunapp.UnmarshalValues(req, f); err != nil {
+		return nil, err
+	}
+
+	if len(f.Table) == 0 {
+		f.Table = spanTables
+	}
+	for _, table := range f.Table {
+		if !contains(spanTables, table) {
+			return nil, httperror.BadRequest("table", "unsupported table %q", table)
+		}
+	}
+
+	return f, nil
+}
+
+// whereClause selects partitions that are fully in the time range.
+func (f *PartitionFilter) whereClause(q *ch.SelectQuery) *ch.SelectQuery {
+	return q.Where("database = currentDatabase()").
+		Where("active").
+		Where("table IN (?)", ch.In(f.Table)).
+		Where("min_date >= toDate(?)", f.TimeGTE).
+		Where("max_date < toDate(?)", f.TimeLT)
+}
+
+type Partition struct {
+	Table       string    `json:"table"`
+	Partition   string    `json:"partition"`
+	PartitionID string    `json:"partitionId"`
+	MinDate     time.Time `json:"minDate"`
+	MaxDate     time.Time `json:"maxDate"`
+	Rows        uint64    `json:"rows"`
+	BytesOnDisk uint64    `json:"bytesOnDisk"`
+}
+
+func selectPartitions(ctx context.Context, f *PartitionFilter) ([]Partition, error) {
+	partitions := make([]Partition, 0)
+
+	if err := f.CH().NewSelect().
+		ColumnExpr("table").
+		ColumnExpr("partition").
+		ColumnExpr("partition_id").
+		ColumnExpr("min(min_date) AS min_date").
+		ColumnExpr("max(max_date) AS max_date").
+		ColumnExpr("sum(rows) AS rows").
+		ColumnExpr("sum(bytes_on_disk) AS bytes_on_disk").
+		TableExpr("system.parts").
+		Apply(f.whereClause).
+		GroupExpr("table, partition, partition_id").
+		OrderExpr("table ASC, partition_id ASC").
+		Scan(ctx, &partitions); err != nil {
+		return nil, err
+	}
+
+	return partitions, nil
+}
+
+//------------------------------------------------------------------------------
+
+type PartitionHandler struct {
+	*bunapp.App
+}
+
+func NewPartitionHandler(app *bunapp.App) *PartitionHandler {
+	return &PartitionHandler{
+		App: app,
+	}
+}
+
+func (h *PartitionHandler) List(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	f, err := DecodePartitionFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+
+	partitions, err := selectPartitions(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"partitions": partitions,
+	})
+}
+
+// Detach detaches partitions. Detached data stays on disk in the detached directory
+// and can be attached back using ALTER TABLE ATTACH PARTITION.
+func (h *PartitionHandler) Detach(w http.ResponseWriter, req bunrouter.Request) error {
+	return h.alter(w, req, func(ctx context.Context, p *Partition) error {
+		_, err := h.CH().ExecContext(ctx, "ALTER TABLE ? DETACH PARTITION ID ?",
+			ch.Ident(p.Table), p.PartitionID)
+		return err
+	})
+}
+
+// Freeze creates a local backup of partitions in the shadow directory.
+func (h *PartitionHandler) Freeze(w http.ResponseWriter, req bunrouter.Request) error {
+	name := "uptrace_" + time.Now().UTC().Format("20060102150405")
+
+	return h.alter(w, req, func(ctx context.Context, p *Partition) error {
+		_, err := h.CH().ExecContext(ctx, "ALTER TABLE ? FREEZE PARTITION ID ? WITH NAME ?",
+			ch.Ident(p.Table), p.PartitionID, name)
+		return err
+	})
+}
+
+// Drop drops partitions or, when the project is specified, deletes the project data
+// in the time range.
+func (h *PartitionHandler) Drop(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	f, err := DecodePartitionFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+
+	if f.ProjectID == 0 {
+		return h.alter(w, req, func(ctx context.Context, p *Partition) error {
+			_, err := h.CH().ExecContext(ctx, "ALTER TABLE ? DROP PARTITION ID ?",
+				ch.Ident(p.Table), p.PartitionID)
+			return err
+		})
+	}
+
+	var tables []string
+	for _, table := range f.Table {
+		timeColumn := "time"
+		switch table {
+		case "spans_index":
+			timeColumn = "span.time"
+		case "spans_data":
+			// Span data is looked up by trace id and expires with the TTL.
+			continue
+		}
+
+		if _, err := h.CH().ExecContext(ctx,
+			"ALTER TABLE ? DELETE WHERE project_id = ? AND ? >= ? AND ? < ?",
+			ch.Ident(table), f.ProjectID,
+			ch.Ident(timeColumn), f.TimeGTE, ch.Ident(timeColumn), f.TimeLT); err != nil {
+			return fmt.Errorf("can't delete data from %s: %w", table, err)
+		}
+		tables = append(tables, table)
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"tables": tables,
+	})
+}
+
+func (h *PartitionHandler) alter(
+	w http.ResponseWriter,
+	req bunrouter.Request,
+	fn func(ctx context.Context, p *Partition) error,
+) error {
+	ctx := req.Context()
+
+	f, err := DecodePartitionFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+	if f.ProjectID != 0 {
+		return httperror.BadRequest("project_id",
+			"partitions contain data of all projects and can't be filtered by project")
+	}
+
+	partitions, err := selectPartitions(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	for i := range partitions {
+		p := &partitions[i]
+		if err := fn(ctx, p); err != nil {
+			return fmt.Errorf("can't alter partition %s of %s: %w", p.Partition, p.Table, err)
+		}
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"partitions": partitions,
+	})
+}
+
+func contains(ss []string, s string) bool {
+	for _, el := range ss {
+		if el == s {
+			return true
+		}
+	}
+	return false
+}
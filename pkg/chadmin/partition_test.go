@@ -0,0 +1,75 @@
+package chadmin
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+func TestPartitionFilter(t *testing.T) {
+	conf := new(bunapp.AppConfig)
+	conf.CH.DSN = "clickhouse://default:@localhost:9000/uptrace?sslmode=disable"
+	app := bunapp.New(context.Background(), conf)
+	defer app.Stop()
+
+	const timeRange = "time_gte=2022-02-01T00:00:00Z&time_lt=2022-02-03T00:00:00Z"
+	const timeWhere = "(min_date >= toDate('2022-02-01 00:00:00')) " +
+		"AND (max_date < toDate('2022-02-03 00:00:00'))"
+
+	tests := []struct {
+		query string
+		where string
+		err   string
+	}{
+		{
+			query: timeRange,
+			where: "(table IN ('spans_index', 'spans_data', 'span_system_minutes', " +
+				"'span_system_hours', 'span_service_minutes', 'span_service_hours', " +
+				"'span_host_minutes', 'span_host_hours')) AND " + timeWhere,
+		},
+		{
+			query: timeRange + "&table=spans_index",
+			where: "(table IN ('spans_index')) AND " + timeWhere,
+		},
+		{
+			query: timeRange + "&table=spans_index&table=spans_data",
+			where: "(table IN ('spans_index', 'spans_data')) AND " + timeWhere,
+		},
+		{
+			// The project does not change the selected partitions.
+			query: timeRange + "&project_id=1&table=span_host_hours",
+			where: "(table IN ('span_host_hours')) AND " + timeWhere,
+		},
+		{
+			query: timeRange + "&table=logs_index",
+			err:   `unsupported table "logs_index"`,
+		},
+		{
+			query: "time_gte=2022-02-01T00:00:00Z",
+			err:   "time_lt is required",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/partitions?"+test.query, nil)
+			f, err := DecodePartitionFilter(app, bunrouter.NewRequest(req))
+			if test.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.err)
+				return
+			}
+			require.NoError(t, err)
+
+			q := app.CH().NewSelect().TableExpr("system.parts").Apply(f.whereClause)
+			require.Equal(t,
+				"SELECT * FROM system.parts WHERE (database = currentDatabase()) "+
+					"AND (active) AND "+test.where,
+				q.String())
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package chadmin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"go.uber.org/zap"
+)
+
+type ProjectAction string
+
+const (
+	ProjectArchived   ProjectAction = "archived"
+	ProjectUnarchived ProjectAction = "unarchived"
+	ProjectPurged     ProjectAction = "purged"
+	// The project was removed from the config, but its data is still stored.
+	ProjectRemoved ProjectAction = "removed"
+)
+
+// ProjectAuditEvent is a change in the project lifecycle. The table keeps all events.
+type ProjectAuditEvent struct {
+	ch.CHModel `ch:"table:project_audit,alias:a"`
+
+	ProjectID uint32        `json:"projectId"`
+	Action    ProjectAction `json:"action" ch:",lc"`
+	Message   string        `json:"message"`
+	Time      time.Time     `json:"time"`
+}
+
+// ProjectArchiver records archived and removed projects in the audit table and
+// deletes the data of archived projects after purge_after.
+type ProjectArchiver struct {
+	*bunapp.App
+}
+
+func NewProjectArchiver(app *bunapp.App) *ProjectArchiver {
+	return &ProjectArchiver{App: app}
+}
+
+// Run syncs projects when the app starts and then every hour.
+func (a *ProjectArchiver) Run(ctx context.Context, app *bunapp.App) error {
+	app.WaitGroup().Add(1)
+	go func() {
+		defer app.WaitGroup().Done()
+
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			if err := a.Sync(app.Context(), time.Now()); err != nil {
+				app.Zap(ctx).Error("ProjectArchiver.Sync failed", zap.Error(err))
+			}
+
+			select {
+			case <-app.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+func (a *ProjectArchiver) Sync(ctx context.Context, now time.Time) error {
+	lastActions, err := a.lastActions(ctx)
+	if err != nil {
+		return err
+	}
+
+	projects := a.Config().Projects
+	configured := make(map[uint32]bool, len(projects))
+
+	for i := range projects {
+		project := &projects[i]
+		configured[project.ID] = true
+		last := lastActions[project.ID]
+
+		if !project.Archived() {
+			if last == ProjectArchived || last == ProjectPurged {
+				if err := a.record(ctx, project.ID, ProjectUnarchived, "removed from the archive"); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if last != ProjectArchived && last != ProjectPurged {
+			if err := a.record(ctx, project.ID, ProjectArchived,
+				archiveMessage(project.Archive)); err != nil {
+				return err
+			}
+			last = ProjectArchived
+		}
+
+		purgeTime := project.Archive.PurgeTime()
+		if last == ProjectPurged || purgeTime.IsZero() || now.Before(purgeTime) {
+			continue
+		}
+
+		a.Zap(ctx).Info("purging archived project", zap.Uint32("project_id", project.ID))
+		if err := a.purge(ctx, project.ID); err != nil {
+			return fmt.Errorf("can't purge project %d: %w", project.ID, err)
+		}
+		if err := a.record(ctx, project.ID, ProjectPurged, "deleted the project data"); err != nil {
+			return err
+		}
+	}
+
+	return a.recordRemoved(ctx, now, configured, lastActions)
+}
+
+func archiveMessage(archive *bunapp.ProjectArchive) string {
+	msg := "archived on " + archive.Date.Format("2006-01-02")
+	if purgeTime := archive.PurgeTime(); !purgeTime.IsZero() {
+		msg += ", data is deleted after " + purgeTime.Format("2006-01-02 15:04")
+	}
+	return msg
+}
+
+// removedLookback is how far back recordRemoved looks for spans. Projects stop
+// receiving spans when they are removed from the config, so only the partitions
+// of the last days are scanned instead of the whole table every hour.
+const removedLookback = 2 * 24 * time.Hour
+
+// recordRemoved records projects that recently had spans, but are not in the config,
+// so their data does not go unnoticed.
+func (a *ProjectArchiver) recordRemoved(
+	ctx context.Context,
+	now time.Time,
+	configured map[uint32]bool,
+	lastActions map[uint32]ProjectAction,
+) error {
+	var projectIDs []uint32
+
+	if err := a.CH().NewSelect().
+		ColumnExpr("DISTINCT project_id").
+		TableExpr("spans_index").
+		Where("toDate(`span.time`) >= toDate(?)", now.Add(-removedLookback)).
+		Scan(ctx, &projectIDs); err != nil {
+		return err
+	}
+
+	for _, projectID := range projectIDs {
+		if configured[projectID] || lastActions[projectID] == ProjectRemoved {
+			continue
+		}
+
+		a.Zap(ctx).Warn("project is not in the config, but has data "+
+			"(archive it with purge_after to delete the data)",
+			zap.Uint32("project_id", projectID))
+		if err := a.record(ctx, projectID, ProjectRemoved,
+			"removed from the config, data is kept until it expires"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purge deletes the project rows from tables with a project_id column.
+func (a *ProjectArchiver) purge(ctx context.Context, projectID uint32) error {
+	if err := deleteSpansData(ctx, a.CH(), ch.SafeQuery("project_id = ?", projectID)); err != nil {
+		return err
+	}
+
+	var tables []string
+
+	if err := a.CH().NewSelect().
+		ColumnExpr("t.name").
+		TableExpr("system.tables AS t").
+		Join("JOIN system.columns AS c").
+		JoinOn("c.database = t.database").
+		JoinOn("c.table = t.name").
+		Where("t.database = currentDatabase()").
+		Where("t.engine LIKE '%MergeTree'").
+		Where("c.name = 'project_id'").
+		Where("t.name != 'project_audit'").
+		OrderExpr("t.name ASC").
+		Scan(ctx, &tables); err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		if _, err := a.CH().ExecContext(ctx, "ALTER TABLE ? DELETE WHERE project_id = ?",
+			ch.Ident(table), projectID); err != nil {
+			return fmt.Errorf("can't purge %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+func (a *ProjectArchiver) lastActions(ctx context.Context) (map[uint32]ProjectAction, error) {
+	var events []ProjectAuditEvent
+
+	if err := a.CH().NewSelect().
+		Model(&events).
+		ColumnExpr("project_id").
+		ColumnExpr("argMax(action, time) AS action").
+		GroupExpr("project_id").
+		Scan(ctx); err != nil {
+		return nil, err
+	}
+
+	actions := make(map[uint32]ProjectAction, len(events))
+	for i := range events {
+		actions[events[i].ProjectID] = events[i].Action
+	}
+	return actions, nil
+}
+
+func (a *ProjectArchiver) record(
+	ctx context.Context, projectID uint32, action ProjectAction, msg string,
+) error {
+	_, err := a.CH().NewInsert().Model(&ProjectAuditEvent{
+		ProjectID: projectID,
+		Action:    action,
+		Message:   msg,
+		Time:      time.Now(),
+	}).Exec(ctx)
+	return err
+}
+
+// Events returns the audit events of all projects, newest first.
+func (a *ProjectArchiver) Events(ctx context.Context) ([]ProjectAuditEvent, error) {
+	events := make([]ProjectAuditEvent, 0)
+
+	if err := a.CH().NewSelect().
+		Model(&events).
+		OrderExpr("time DESC").
+		Limit(1000).
+		Scan(ctx); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -0,0 +1,33 @@
+package chadmin
+
+import (
+	"net/http"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httputil"
+)
+
+type ProjectAuditHandler struct {
+	*bunapp.App
+
+	archiver *ProjectArchiver
+}
+
+func NewProjectAuditHandler(app *bunapp.App, archiver *ProjectArchiver) *ProjectAuditHandler {
+	return &ProjectAuditHandler{
+		App:      app,
+		archiver: archiver,
+	}
+}
+
+func (h *ProjectAuditHandler) List(w http.ResponseWriter, req bunrouter.Request) error {
+	events, err := h.archiver.Events(req.Context())
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"events": events,
+	})
+}
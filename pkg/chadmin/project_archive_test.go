@@ -0,0 +1,20 @@
+package chadmin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+func TestArchiveMessage(t *testing.T) {
+	archive := &bunapp.ProjectArchive{
+		Date: time.Date(2022, time.March, 1, 0, 0, 0, 0, time.UTC),
+	}
+	require.Equal(t, "archived on 2022-03-01", archiveMessage(archive))
+
+	archive.PurgeAfter = 30 * 24 * time.Hour
+	require.Equal(t, "archived on 2022-03-01, data is deleted after 2022-03-31 00:00",
+		archiveMessage(archive))
+}
@@ -0,0 +1,384 @@
+package chadmin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/org"
+	"github.com/uptrace/uptrace/pkg/tracing"
+	"go.uber.org/zap"
+)
+
+type RegroupStatus string
+
+const (
+	RegroupRunning  RegroupStatus = "running"
+	RegroupFinished RegroupStatus = "finished"
+	RegroupFailed   RegroupStatus = "failed"
+)
+
+// RegroupJob recalculates span group ids of a project using the current grouping
+// rules. Only the latest job is kept in memory.
+type RegroupJob struct {
+	ProjectID uint32        `json:"projectId"`
+	TimeGTE   time.Time     `json:"timeGte"`
+	TimeLT    time.Time     `json:"timeLt"`
+	Status    RegroupStatus `json:"status"`
+	Error     string        `json:"error"`
+
+	// The day that is being regrouped.
+	Date         time.Time `json:"date"`
+	NumSpan      uint64    `json:"numSpan"`
+	NumRegrouped uint64    `json:"numRegrouped"`
+
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// spanRegroup maps span ids to the new system, group id, and service key. The Join
+// engine keeps the table in memory so spans_index can be rewritten using joinGet.
+type spanRegroup struct {
+	ch.CHModel `ch:"table:span_regroups"`
+
+	ID      uint64
+	System  string `ch:",lc"`
+	GroupID uint64
+	Service string `ch:",lc"`
+}
+
+type regroupSpanData struct {
+	ch.CHModel `ch:"table:spans_data,alias:s"`
+
+	Data []byte
+}
+
+var ErrRegroupRunning = errors.New("another regroup job is running")
+
+// RegroupManager rewrites span group ids in spans_index after grouping rules change
+// so history stays coherent with new spans.
+//
+// Span system and group id are part of the spans_index sorting key and can't be
+// updated with a mutation. Instead, the regrouped spans of the project are copied
+// into a staging table with the new ids, the staging partition is attached to
+// spans_index, and the rows with the old ids are deleted. Other rows are not touched
+// so spans that are inserted meanwhile, for example, by span_wal replay, are kept.
+// Copying does not trigger materialized views so span stats are not counted twice,
+// but it also means that span stats, for example, span_group_minutes, and
+// spans_data keep old ids.
+//
+// Events and database spans are skipped because their names are replaced during
+// ingestion and the group id can't be recalculated.
+type RegroupManager struct {
+	*bunapp.App
+
+	mu  sync.Mutex
+	job *RegroupJob
+}
+
+func NewRegroupManager(app *bunapp.App) *RegroupManager {
+	return &RegroupManager{
+		App: app,
+	}
+}
+
+// Job returns a copy of the latest job or nil.
+func (m *RegroupManager) Job() *RegroupJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.job == nil {
+		return nil
+	}
+	job := *m.job
+	return &job
+}
+
+func (m *RegroupManager) update(fn func(job *RegroupJob)) {
+	m.mu.Lock()
+	fn(m.job)
+	m.mu.Unlock()
+}
+
+// Start starts regrouping project spans in the time range in the background.
+func (m *RegroupManager) Start(projectID uint32, gte, lt time.Time) (*RegroupJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.job != nil && m.job.Status == RegroupRunning {
+		return nil, ErrRegroupRunning
+	}
+
+	m.job = &RegroupJob{
+		ProjectID: projectID,
+		TimeGTE:   gte,
+		TimeLT:    lt,
+		Status:    RegroupRunning,
+		StartedAt: time.Now(),
+	}
+	job := *m.job
+
+	m.WaitGroup().Add(1)
+	go func() {
+		defer m.WaitGroup().Done()
+
+		ctx := m.Context()
+		err := m.run(ctx, projectID, regroupDays(gte, lt, time.Now()))
+
+		m.update(func(job *RegroupJob) {
+			job.FinishedAt = time.Now()
+			if err != nil {
+				job.Status = RegroupFailed
+				job.Error = err.Error()
+			} else {
+				job.Status = RegroupFinished
+			}
+		})
+
+		job := m.Job()
+		m.Zap(ctx).Info("regroup finished",
+			zap.Uint32("project_id", job.ProjectID),
+			zap.String("status", string(job.Status)),
+			zap.Uint64("num_regrouped", job.NumRegrouped),
+			zap.Duration("took", job.FinishedAt.Sub(job.StartedAt)))
+	}()
+
+	return &job, nil
+}
+
+// regroupDays returns days that overlap with the time range and are not in the future.
+func regroupDays(gte, lt, now time.Time) []time.Time {
+	if lt.After(now) {
+		lt = now
+	}
+
+	gte = gte.UTC()
+	day := time.Date(gte.Year(), gte.Month(), gte.Day(), 0, 0, 0, 0, time.UTC)
+
+	var days []time.Time
+	for ; day.Before(lt); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	return days
+}
+
+func (m *RegroupManager) run(ctx context.Context, projectID uint32, days []time.Time) error {
+	if len(days) == 0 {
+		return nil
+	}
+
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS span_regroups",
+		"CREATE TABLE span_regroups (id UInt64, system LowCardinality(String), group_id UInt64, " +
+			"service LowCardinality(String)) ENGINE = Join(ANY, LEFT, id)",
+		"DROP TABLE IF EXISTS spans_index_regroup",
+		"CREATE TABLE spans_index_regroup AS spans_index",
+	} {
+		if _, err := m.CH().ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	defer func() {
+		for _, table := range []string{"span_regroups", "spans_index_regroup"} {
+			if _, err := m.CH().ExecContext(ctx, "DROP TABLE IF EXISTS ?", ch.Ident(table)); err != nil {
+				m.Zap(ctx).Error("can't drop regroup table", zap.Error(err))
+			}
+		}
+	}()
+
+	regrouper := tracing.NewSpanRegrouper(ctx, &m.Config().ServiceGrouping)
+	for _, day := range days {
+		m.update(func(job *RegroupJob) {
+			job.Date = day
+		})
+
+		if err := m.regroupDay(ctx, regrouper, projectID, day); err != nil {
+			return fmt.Errorf("can't regroup %s: %w", day.Format("2006-01-02"), err)
+		}
+	}
+	return nil
+}
+
+func (m *RegroupManager) regroupDay(
+	ctx context.Context, regrouper *tracing.SpanRegrouper, projectID uint32, day time.Time,
+) error {
+	if _, err := m.CH().ExecContext(ctx, "TRUNCATE TABLE span_regroups"); err != nil {
+		return err
+	}
+
+	var numRegrouped int
+
+	// Spans are selected by the hour to limit memory usage.
+	for hour := day; hour.Before(day.AddDate(0, 0, 1)); hour = hour.Add(time.Hour) {
+		gte, lt := hour, hour.Add(time.Hour)
+
+		// Span data does not have a project id so spans are selected using the
+		// trace ids from spans_index.
+		var data []regroupSpanData
+		if err := m.CH().NewSelect().
+			Model(&data).
+			Column("data").
+			Where("time >= ? AND time < ?", gte, lt).
+			Where("trace_id IN (SELECT `span.trace_id` FROM spans_index "+
+				"WHERE project_id = ? AND `span.time` >= ? AND `span.time` < ?)",
+				projectID, gte, lt).
+			Scan(ctx); err != nil {
+			return err
+		}
+
+		regroups := make([]spanRegroup, 0)
+		for i := range data {
+			regroup, err := regrouper.Regroup(projectID, data[i].Data)
+			if err != nil {
+				return err
+			}
+			if regroup != nil {
+				regroups = append(regroups, spanRegroup{
+					ID:      regroup.ID,
+					System:  regroup.System,
+					GroupID: regroup.GroupID,
+					Service: regroup.Service,
+				})
+			}
+		}
+
+		if len(regroups) > 0 {
+			if _, err := m.CH().NewInsert().Model(&regroups).Exec(ctx); err != nil {
+				return err
+			}
+		}
+
+		numRegrouped += len(regroups)
+		m.update(func(job *RegroupJob) {
+			job.NumSpan += uint64(len(data))
+			job.NumRegrouped += uint64(len(regroups))
+		})
+	}
+
+	if numRegrouped == 0 {
+		return nil
+	}
+
+	if err := copyRegroupedSpans(ctx, m.CH(), "spans_index", projectID, day); err != nil {
+		return fmt.Errorf("can't copy spans_index: %w", err)
+	}
+	if err := swapRegroupedSpans(ctx, m.CH(), "spans_index", projectID, day); err != nil {
+		return fmt.Errorf("can't swap spans_index rows: %w", err)
+	}
+	return nil
+}
+
+// regroupedSpansCond matches the project rows that are in span_regroups and
+// still have the old system, group id, or service key.
+const regroupedSpansCond = "project_id = ? AND toDate(`span.time`) = toDate(?) " +
+	"AND joinHas('span_regroups', `span.id`) " +
+	"AND (`span.system` != joinGet('span_regroups', 'system', `span.id`) " +
+	"OR `span.group_id` != joinGet('span_regroups', 'group_id', `span.id`) " +
+	"OR `service.key` != joinGet('span_regroups', 'service', `span.id`))"
+
+// copyRegroupedSpans copies the regrouped rows with the new ids to the <table>_regroup
+// staging table.
+func copyRegroupedSpans(
+	ctx context.Context, db *ch.DB, table string, projectID uint32, day time.Time,
+) error {
+	staging := ch.Ident(table + "_regroup")
+
+	if _, err := db.ExecContext(ctx, "TRUNCATE TABLE ?", staging); err != nil {
+		return err
+	}
+
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO ? SELECT * REPLACE ("+
+			"joinGet('span_regroups', 'system', `span.id`) AS `span.system`, "+
+			"joinGet('span_regroups', 'group_id', `span.id`) AS `span.group_id`, "+
+			"joinGet('span_regroups', 'service', `span.id`) AS `service.key`"+
+			") FROM ? WHERE "+regroupedSpansCond,
+		staging, ch.Ident(table), projectID, day)
+	return err
+}
+
+// swapRegroupedSpans attaches the staging partition to the table and then deletes
+// the rows with the old ids. The rows with the new ids don't match the condition
+// so they are kept.
+func swapRegroupedSpans(
+	ctx context.Context, db *ch.DB, table string, projectID uint32, day time.Time,
+) error {
+	if _, err := db.ExecContext(ctx, "ALTER TABLE ? ATTACH PARTITION ID ? FROM ?",
+		ch.Ident(table), day.Format("20060102"), ch.Ident(table+"_regroup")); err != nil {
+		return err
+	}
+
+	_, err := db.ExecContext(ctx,
+		"ALTER TABLE ? DELETE WHERE "+regroupedSpansCond+" SETTINGS mutations_sync = 2",
+		ch.Ident(table), projectID, day)
+	return err
+}
+
+//------------------------------------------------------------------------------
+
+type RegroupFilter struct {
+	*bunapp.App `urlstruct:"-"`
+
+	tracing.TimeFilter
+
+	ProjectID uint32
+}
+
+func DecodeRegroupFilter(app *bunapp.App, req bunrouter.Request) (*RegroupFilter, error) {
+	f := &RegroupFilter{App: app}
+	if err := bunapp.UnmarshalValues(req, f); err != nil {
+		return nil, err
+	}
+
+	if _, err := org.SelectProjectByID(req.Context(), app, f.ProjectID); err != nil {
+		return nil, httperror.BadRequest("project_id", "project %d does not exist", f.ProjectID)
+	}
+
+	return f, nil
+}
+
+type RegroupHandler struct {
+	*bunapp.App
+
+	regroups *RegroupManager
+}
+
+func NewRegroupHandler(app *bunapp.App, regroups *RegroupManager) *RegroupHandler {
+	return &RegroupHandler{
+		App:      app,
+		regroups: regroups,
+	}
+}
+
+func (h *RegroupHandler) Show(w http.ResponseWriter, req bunrouter.Request) error {
+	return httputil.JSON(w, bunrouter.H{
+		"job": h.regroups.Job(),
+	})
+}
+
+// Start starts regrouping in the background. Use Show to track its progress.
+func (h *RegroupHandler) Start(w http.ResponseWriter, req bunrouter.Request) error {
+	f, err := DecodeRegroupFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+
+	job, err := h.regroups.Start(f.ProjectID, f.TimeGTE, f.TimeLT)
+	if err != nil {
+		return httperror.BadRequest("regroup", "%s", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	return httputil.JSON(w, bunrouter.H{
+		"job": job,
+	})
+}
@@ -0,0 +1,123 @@
+package chadmin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+func TestRegroupDays(t *testing.T) {
+	now := time.Date(2022, time.February, 10, 15, 30, 0, 0, time.UTC)
+
+	days := regroupDays(
+		time.Date(2022, time.February, 7, 12, 0, 0, 0, time.UTC),
+		time.Date(2022, time.February, 9, 0, 0, 0, 0, time.UTC),
+		now,
+	)
+	require.Equal(t, []time.Time{
+		time.Date(2022, time.February, 7, 0, 0, 0, 0, time.UTC),
+		time.Date(2022, time.February, 8, 0, 0, 0, 0, time.UTC),
+	}, days)
+
+	days = regroupDays(
+		time.Date(2022, time.February, 9, 0, 0, 0, 0, time.UTC),
+		time.Date(2022, time.February, 11, 0, 0, 0, 0, time.UTC),
+		now,
+	)
+	require.Equal(t, []time.Time{
+		time.Date(2022, time.February, 9, 0, 0, 0, 0, time.UTC),
+		time.Date(2022, time.February, 10, 0, 0, 0, 0, time.UTC),
+	}, days)
+}
+
+type regroupTestSpan struct {
+	ch.CHModel `ch:"table:regroup_test_spans"`
+
+	ProjectID uint32
+	System    string    `ch:"span.system,lc"`
+	GroupID   uint64    `ch:"span.group_id"`
+	ID        uint64    `ch:"span.id"`
+	Service   string    `ch:"service.key,lc"`
+	Time      time.Time `ch:"span.time"`
+}
+
+func TestSwapRegroupedSpans(t *testing.T) {
+	ctx := context.Background()
+
+	conf := new(bunapp.AppConfig)
+	conf.CH.DSN = "clickhouse://default:@localhost:9000/uptrace?sslmode=disable"
+	app := bunapp.New(ctx, conf)
+	defer app.Stop()
+
+	db := app.CH()
+	pingCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := db.Ping(pingCtx); err != nil {
+		t.Skipf("ClickHouse is not available: %s", err)
+	}
+
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS regroup_test_spans",
+		"CREATE TABLE regroup_test_spans (project_id UInt32, " +
+			"`span.system` LowCardinality(String), `span.group_id` UInt64, " +
+			"`span.id` UInt64, `service.key` LowCardinality(String), `span.time` DateTime) " +
+			"ENGINE = MergeTree() " +
+			"ORDER BY (project_id, `span.system`, `span.group_id`) " +
+			"PARTITION BY toDate(`span.time`)",
+		"DROP TABLE IF EXISTS regroup_test_spans_regroup",
+		"CREATE TABLE regroup_test_spans_regroup AS regroup_test_spans",
+		"DROP TABLE IF EXISTS span_regroups",
+		"CREATE TABLE span_regroups (id UInt64, system LowCardinality(String), group_id UInt64, " +
+			"service LowCardinality(String)) ENGINE = Join(ANY, LEFT, id)",
+		"INSERT INTO span_regroups VALUES (1, 'new', 2, 'shop/api')",
+	} {
+		_, err := db.ExecContext(ctx, query)
+		require.NoError(t, err)
+	}
+	defer func() {
+		for _, table := range []string{
+			"regroup_test_spans", "regroup_test_spans_regroup", "span_regroups",
+		} {
+			_, _ = db.ExecContext(ctx, "DROP TABLE IF EXISTS ?", ch.Ident(table))
+		}
+	}()
+
+	day := time.Date(2022, time.February, 7, 0, 0, 0, 0, time.UTC)
+	tm := day.Add(12 * time.Hour)
+	insert := func(spans ...regroupTestSpan) {
+		_, err := db.NewInsert().Model(&spans).Exec(ctx)
+		require.NoError(t, err)
+	}
+
+	insert(
+		regroupTestSpan{ProjectID: 1, System: "old", GroupID: 1, ID: 1, Time: tm},
+		regroupTestSpan{ProjectID: 1, System: "old", GroupID: 1, ID: 2, Time: tm},
+		// Other projects are not regrouped even if the span id matches.
+		regroupTestSpan{ProjectID: 2, System: "old", GroupID: 1, ID: 1, Time: tm},
+	)
+
+	require.NoError(t, copyRegroupedSpans(ctx, db, "regroup_test_spans", 1, day))
+	// Spans that are inserted between the copy and the swap are kept.
+	insert(
+		regroupTestSpan{ProjectID: 1, System: "old", GroupID: 1, ID: 3, Time: tm},
+		regroupTestSpan{ProjectID: 2, System: "old", GroupID: 1, ID: 4, Time: tm},
+	)
+	require.NoError(t, swapRegroupedSpans(ctx, db, "regroup_test_spans", 1, day))
+
+	var spans []regroupTestSpan
+	require.NoError(t, db.NewSelect().Model(&spans).OrderExpr("project_id, `span.id`").Scan(ctx))
+	for i := range spans {
+		spans[i].Time = time.Time{}
+	}
+	require.Equal(t, []regroupTestSpan{
+		{ProjectID: 1, System: "new", GroupID: 2, ID: 1, Service: "shop/api"},
+		{ProjectID: 1, System: "old", GroupID: 1, ID: 2},
+		{ProjectID: 1, System: "old", GroupID: 1, ID: 3},
+		{ProjectID: 2, System: "old", GroupID: 1, ID: 1},
+		{ProjectID: 2, System: "old", GroupID: 1, ID: 4},
+	}, spans)
+}
@@ -0,0 +1,206 @@
+package chadmin
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/tracing"
+	"go.uber.org/zap"
+)
+
+// SampledDay is a day of project spans that was down-sampled.
+type SampledDay struct {
+	ch.CHModel `ch:"table:sampled_days,alias:d"`
+
+	ProjectID uint32
+	Date      time.Time `ch:"type:Date"`
+	KeepPct   float32
+	Time      time.Time
+}
+
+type projectSampling struct {
+	projectID uint32
+	sampling  *bunapp.RetentionSampling
+}
+
+// errorTraceWindow extends the time range used to find error traces of a day so
+// traces that cross midnight are kept together with their spans on the other day.
+const errorTraceWindow = time.Hour
+
+// RetentionSampler deletes old spans of normal traces keeping error traces and
+// a percentage of other traces. Traces are selected using a hash of the trace id
+// so spans of the same trace are kept or deleted together.
+type RetentionSampler struct {
+	*bunapp.App
+
+	projects []projectSampling
+}
+
+func NewRetentionSampler(app *bunapp.App) *RetentionSampler {
+	conf := app.Config()
+
+	var projects []projectSampling
+	for i := range conf.Projects {
+		project := &conf.Projects[i]
+		if sampling := conf.RetentionSampling(project); sampling != nil {
+			projects = append(projects, projectSampling{
+				projectID: project.ID,
+				sampling:  sampling,
+			})
+		}
+	}
+
+	return &RetentionSampler{
+		App:      app,
+		projects: projects,
+	}
+}
+
+// Run samples days that became older than after_days when the app starts and then
+// every hour.
+func (s *RetentionSampler) Run(ctx context.Context, app *bunapp.App) error {
+	if len(s.projects) == 0 {
+		return nil
+	}
+
+	app.WaitGroup().Add(1)
+	go func() {
+		defer app.WaitGroup().Done()
+
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			if err := s.Sample(app.Context(), time.Now()); err != nil {
+				app.Zap(ctx).Error("RetentionSampler.Sample failed", zap.Error(err))
+			}
+
+			select {
+			case <-app.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *RetentionSampler) Sample(ctx context.Context, now time.Time) error {
+	for i := range s.projects {
+		p := &s.projects[i]
+
+		days, err := s.pendingDays(ctx, p.projectID, sampleCutoff(now, p.sampling.AfterDays))
+		if err != nil {
+			return err
+		}
+
+		for _, day := range days {
+			if err := s.sampleDay(ctx, p, day); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sampleCutoff returns the start of the first day that must not be sampled yet.
+func sampleCutoff(now time.Time, afterDays int) time.Time {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return today.AddDate(0, 0, -afterDays)
+}
+
+// keepThreshold returns the threshold of cityHash64(trace_id) % 10000 below which
+// traces are kept.
+func keepThreshold(keepPct float64) uint64 {
+	return uint64(math.Round(keepPct * 100))
+}
+
+// sampleWeight returns the count of a kept span of a normal trace.
+func sampleWeight(threshold uint64) float32 {
+	if threshold == 0 {
+		return 1
+	}
+	return float32(10000 / float64(threshold))
+}
+
+func (s *RetentionSampler) pendingDays(
+	ctx context.Context, projectID uint32, cutoff time.Time,
+) ([]time.Time, error) {
+	var sampled []SampledDay
+
+	if err := s.CH().NewSelect().
+		ColumnExpr("DISTINCT toDate(`span.time`) AS date").
+		TableExpr("spans_index").
+		Where("project_id = ?", projectID).
+		Where("`span.time` < ?", cutoff).
+		Where("toDate(`span.time`) NOT IN (SELECT date FROM sampled_days WHERE project_id = ?)",
+			projectID).
+		OrderExpr("date ASC").
+		Scan(ctx, &sampled); err != nil {
+		return nil, err
+	}
+
+	days := make([]time.Time, len(sampled))
+	for i := range sampled {
+		days[i] = sampled[i].Date
+	}
+	return days, nil
+}
+
+func (s *RetentionSampler) sampleDay(ctx context.Context, p *projectSampling, day time.Time) error {
+	gte := day
+	lt := day.AddDate(0, 0, 1)
+	threshold := keepThreshold(p.sampling.KeepPct)
+
+	s.Zap(ctx).Info("sampling project spans",
+		zap.Uint32("project_id", p.projectID),
+		zap.Time("date", day),
+		zap.Float64("keep_pct", p.sampling.KeepPct))
+
+	if threshold < 10000 {
+		errorTraces := ch.SafeQuery(
+			"SELECT `span.trace_id` FROM spans_index "+
+				"WHERE project_id = ? AND `span.time` >= ? AND `span.time` < ? "+
+				"AND (`span.status_code` = 'error' OR `span.system` IN (?))",
+			p.projectID, gte.Add(-errorTraceWindow), lt.Add(errorTraceWindow),
+			ch.In(tracing.ErrorSystems()))
+
+		if err := deleteSpansData(ctx, s.CH(),
+			ch.SafeQuery("project_id = ? AND `span.time` >= ? AND `span.time` < ?",
+				p.projectID, gte, lt),
+			ch.SafeQuery("time >= ? AND time < ?", gte, lt),
+			ch.SafeQuery("cityHash64(trace_id) % 10000 >= ? AND trace_id NOT IN (?)",
+				threshold, errorTraces)); err != nil {
+			return err
+		}
+
+		// Kept spans of normal traces represent the deleted ones, so their count is
+		// adjusted like the count of sampled spans at ingest. Mutations of the table
+		// are applied in order, so the deleted spans are not updated.
+		if _, err := s.CH().ExecContext(ctx,
+			"ALTER TABLE spans_index "+
+				"DELETE WHERE project_id = ? "+
+				"AND `span.time` >= ? AND `span.time` < ? "+
+				"AND cityHash64(`span.trace_id`) % 10000 >= ? AND `span.trace_id` NOT IN (?), "+
+				"UPDATE `span.count` = `span.count` * ? WHERE project_id = ? "+
+				"AND `span.time` >= ? AND `span.time` < ? "+
+				"AND cityHash64(`span.trace_id`) % 10000 < ? AND `span.trace_id` NOT IN (?)",
+			p.projectID, gte, lt, threshold, errorTraces,
+			sampleWeight(threshold), p.projectID, gte, lt, threshold, errorTraces); err != nil {
+			return fmt.Errorf("can't sample spans_index: %w", err)
+		}
+	}
+
+	_, err := s.CH().NewInsert().Model(&SampledDay{
+		ProjectID: p.projectID,
+		Date:      day,
+		KeepPct:   float32(p.sampling.KeepPct),
+		Time:      time.Now(),
+	}).Exec(ctx)
+	return err
+}
@@ -0,0 +1,26 @@
+package chadmin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampleCutoff(t *testing.T) {
+	now := time.Date(2022, time.February, 10, 15, 30, 0, 0, time.UTC)
+	require.Equal(t, time.Date(2022, time.February, 3, 0, 0, 0, 0, time.UTC), sampleCutoff(now, 7))
+}
+
+func TestKeepThreshold(t *testing.T) {
+	require.Equal(t, uint64(1000), keepThreshold(10))
+	require.Equal(t, uint64(50), keepThreshold(0.5))
+	require.Equal(t, uint64(10000), keepThreshold(100))
+}
+
+func TestSampleWeight(t *testing.T) {
+	require.Equal(t, float32(10), sampleWeight(1000))
+	require.Equal(t, float32(200), sampleWeight(50))
+	require.Equal(t, float32(1), sampleWeight(10000))
+	require.Equal(t, float32(1), sampleWeight(0))
+}
@@ -0,0 +1,364 @@
+package chadmin
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"go.uber.org/zap"
+)
+
+var intervalRE = regexp.MustCompile(`(?i)^\s*(\d+)\s+(SECOND|MINUTE|HOUR|DAY|WEEK|MONTH|QUARTER|YEAR)S?\s*$`)
+
+var intervalUnits = map[string]time.Duration{
+	"SECOND":  time.Second,
+	"MINUTE":  time.Minute,
+	"HOUR":    time.Hour,
+	"DAY":     24 * time.Hour,
+	"WEEK":    7 * 24 * time.Hour,
+	"MONTH":   30 * 24 * time.Hour,
+	"QUARTER": 91 * 24 * time.Hour,
+	"YEAR":    365 * 24 * time.Hour,
+}
+
+// Interval is a ClickHouse interval, for example, 30 DAY.
+type Interval struct {
+	Num  int
+	Unit string
+}
+
+func ParseInterval(s string) (Interval, error) {
+	m := intervalRE.FindStringSubmatch(s)
+	if m == nil {
+		return Interval{}, fmt.Errorf("can't parse interval %q (expected, for example, 30 DAY)", s)
+	}
+	num, err := strconv.Atoi(m[1])
+	if err != nil {
+		return Interval{}, err
+	}
+	return Interval{Num: num, Unit: strings.ToUpper(m[2])}, nil
+}
+
+func (i Interval) String() string {
+	return fmt.Sprintf("%d %s", i.Num, i.Unit)
+}
+
+// Duration approximates the interval assuming that months have 30 days.
+func (i Interval) Duration() time.Duration {
+	return time.Duration(i.Num) * intervalUnits[i.Unit]
+}
+
+// chFormat returns the interval as ClickHouse formats it in table definitions,
+// for example, toIntervalDay(30).
+func (i Interval) chFormat() string {
+	unit := strings.ToLower(i.Unit)
+	return fmt.Sprintf("toInterval%s%s(%d)", strings.ToUpper(unit[:1]), unit[1:], i.Num)
+}
+
+//------------------------------------------------------------------------------
+
+type projectTTL struct {
+	projectID uint32
+	ttl       Interval
+}
+
+// ttlExpr returns the TTL clause for a table. Projects with their own retention get
+// separate delete rules. Tables without a project_id column use the longest
+// retention so they don't lose data that is still referenced.
+func ttlExpr(timeColumn string, defaultTTL Interval, projects []projectTTL, hasProjectID bool) string {
+	date := fmt.Sprintf("toDate(%q)", timeColumn)
+
+	if len(projects) == 0 {
+		return fmt.Sprintf("%s + INTERVAL %s DELETE", date, defaultTTL)
+	}
+
+	if !hasProjectID {
+		longest := defaultTTL
+		for _, p := range projects {
+			if p.ttl.Duration() > longest.Duration() {
+				longest = p.ttl
+			}
+		}
+		return fmt.Sprintf("%s + INTERVAL %s DELETE", date, longest)
+	}
+
+	var b strings.Builder
+	ids := make([]string, 0, len(projects))
+	for _, p := range projects {
+		id := strconv.FormatUint(uint64(p.projectID), 10)
+		ids = append(ids, id)
+		fmt.Fprintf(&b, "%s + INTERVAL %s DELETE WHERE project_id = %s, ", date, p.ttl, id)
+	}
+	fmt.Fprintf(&b, "%s + INTERVAL %s DELETE WHERE project_id NOT IN (%s)",
+		date, defaultTTL, strings.Join(ids, ", "))
+	return b.String()
+}
+
+// capTTL limits the default and project TTLs by the table TTL.
+func capTTL(defaultTTL Interval, projects []projectTTL, max Interval) (Interval, []projectTTL) {
+	if defaultTTL.Duration() > max.Duration() {
+		defaultTTL = max
+	}
+	capped := make([]projectTTL, len(projects))
+	for i, p := range projects {
+		if p.ttl.Duration() > max.Duration() {
+			p.ttl = max
+		}
+		capped[i] = p
+	}
+	return defaultTTL, capped
+}
+
+//------------------------------------------------------------------------------
+
+// TableTTL is the last TTL that was applied to a table.
+type TableTTL struct {
+	ch.CHModel `ch:"table:table_ttls,alias:t"`
+
+	Name string
+	TTL  string
+	Time time.Time
+}
+
+type Table struct {
+	Name         string    `json:"name"`
+	TimeColumn   string    `json:"timeColumn"`
+	HasProjectID bool      `json:"hasProjectId"`
+	EngineFull   string    `json:"engineFull"`
+	ExpectedTTL  string    `json:"expectedTtl"`
+	AppliedTTL   string    `json:"appliedTtl"`
+	AppliedAt    time.Time `json:"appliedAt"`
+	OldestDate   time.Time `json:"oldestDate"`
+	Rows         uint64    `json:"rows"`
+	BytesOnDisk  uint64    `json:"bytesOnDisk"`
+}
+
+func (t *Table) upToDate() bool {
+	return t.AppliedTTL == t.ExpectedTTL
+}
+
+type tablePart struct {
+	Table       string
+	OldestDate  time.Time
+	Rows        uint64
+	BytesOnDisk uint64
+}
+
+// TTLManager keeps table TTLs in sync with the retention config.
+type TTLManager struct {
+	*bunapp.App
+
+	defaultTTL Interval
+	projects   []projectTTL
+	tables     map[string]Interval
+}
+
+func NewTTLManager(app *bunapp.App) (*TTLManager, error) {
+	conf := app.Config()
+
+	defaultTTL, err := ParseInterval(conf.Retention.TTL)
+	if err != nil {
+		return nil, fmt.Errorf("retention.ttl: %w", err)
+	}
+
+	var projects []projectTTL
+	for _, project := range conf.Projects {
+		if project.TTL == "" {
+			continue
+		}
+		ttl, err := ParseInterval(project.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("project %d: ttl: %w", project.ID, err)
+		}
+		projects = append(projects, projectTTL{projectID: project.ID, ttl: ttl})
+	}
+	sort.Slice(projects, func(i, j int) bool {
+		return projects[i].projectID < projects[j].projectID
+	})
+
+	tables := make(map[string]Interval, len(conf.Retention.Tables))
+	for table, s := range conf.Retention.Tables {
+		ttl, err := ParseInterval(s)
+		if err != nil {
+			return nil, fmt.Errorf("retention.tables: %s: %w", table, err)
+		}
+		tables[table] = ttl
+	}
+
+	return &TTLManager{
+		App:        app,
+		defaultTTL: defaultTTL,
+		projects:   projects,
+		tables:     tables,
+	}, nil
+}
+
+// Run verifies table TTLs when the app starts and then every hour.
+func (m *TTLManager) Run(ctx context.Context, app *bunapp.App) error {
+	app.WaitGroup().Add(1)
+	go func() {
+		defer app.WaitGroup().Done()
+
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			if err := m.Sync(app.Context()); err != nil {
+				app.Zap(ctx).Error("TTLManager.Sync failed", zap.Error(err))
+			}
+
+			select {
+			case <-app.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// Sync alters the tables whose TTL does not match the config.
+func (m *TTLManager) Sync(ctx context.Context) error {
+	tables, err := m.Tables(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range tables {
+		table := &tables[i]
+		if table.upToDate() {
+			continue
+		}
+
+		if table.AppliedTTL == "" && m.createdWithDefaultTTL(table) {
+			// The table was created by migrations and was never altered.
+			if err := m.recordTTL(ctx, table); err != nil {
+				return err
+			}
+			continue
+		}
+
+		m.Zap(ctx).Info("changing table TTL",
+			zap.String("table", table.Name),
+			zap.String("old", table.AppliedTTL),
+			zap.String("new", table.ExpectedTTL))
+
+		if _, err := m.CH().ExecContext(ctx, "ALTER TABLE ? MODIFY TTL ?",
+			ch.Ident(table.Name), ch.Safe(table.ExpectedTTL)); err != nil {
+			return fmt.Errorf("can't change TTL of %s: %w", table.Name, err)
+		}
+		if err := m.recordTTL(ctx, table); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *TTLManager) expectedTTL(table *Table) string {
+	defaultTTL, projects := m.defaultTTL, m.projects
+	if max, ok := m.tables[table.Name]; ok {
+		defaultTTL, projects = capTTL(defaultTTL, projects, max)
+	}
+	return ttlExpr(table.TimeColumn, defaultTTL, projects, table.HasProjectID)
+}
+
+func (m *TTLManager) createdWithDefaultTTL(table *Table) bool {
+	if len(m.projects) > 0 {
+		return false
+	}
+	if _, ok := m.tables[table.Name]; ok {
+		return false
+	}
+	engine := strings.ReplaceAll(table.EngineFull, " ", "")
+	return strings.Contains(engine, "TTLtoDate") &&
+		strings.Contains(engine, m.defaultTTL.chFormat()) &&
+		!strings.Contains(engine, "WHERE")
+}
+
+func (m *TTLManager) recordTTL(ctx context.Context, table *Table) error {
+	_, err := m.CH().NewInsert().Model(&TableTTL{
+		Name: table.Name,
+		TTL:  table.ExpectedTTL,
+		Time: time.Now(),
+	}).Exec(ctx)
+	return err
+}
+
+// Tables returns MergeTree tables with a TTL together with the expected TTL
+// and the oldest data in the table.
+func (m *TTLManager) Tables(ctx context.Context) ([]Table, error) {
+	tables := make([]Table, 0)
+
+	if err := m.CH().NewSelect().
+		ColumnExpr("t.name AS name").
+		ColumnExpr("t.engine_full AS engine_full").
+		ColumnExpr(`if(has(groupArray(c.name), 'span.time'), 'span.time', 'time') AS time_column`).
+		ColumnExpr("has(groupArray(c.name), 'project_id') AS has_project_id").
+		TableExpr("system.tables AS t").
+		Join("JOIN system.columns AS c").
+		JoinOn("c.database = t.database").
+		JoinOn("c.table = t.name").
+		Where("t.database = currentDatabase()").
+		Where("t.engine LIKE '%MergeTree'").
+		Where("t.engine_full LIKE '% TTL %'").
+		GroupExpr("t.name, t.engine_full").
+		OrderExpr("t.name ASC").
+		Scan(ctx, &tables); err != nil {
+		return nil, err
+	}
+
+	var applied []TableTTL
+
+	if err := m.CH().NewSelect().
+		Model(&applied).
+		ColumnExpr("name").
+		ColumnExpr("argMax(ttl, time) AS ttl").
+		ColumnExpr("max(time) AS time").
+		GroupExpr("name").
+		Scan(ctx); err != nil {
+		return nil, err
+	}
+
+	var parts []tablePart
+
+	if err := m.CH().NewSelect().
+		ColumnExpr("table").
+		ColumnExpr("min(min_date) AS oldest_date").
+		ColumnExpr("sum(rows) AS rows").
+		ColumnExpr("sum(bytes_on_disk) AS bytes_on_disk").
+		TableExpr("system.parts").
+		Where("database = currentDatabase()").
+		Where("active").
+		GroupExpr("table").
+		Scan(ctx, &parts); err != nil {
+		return nil, err
+	}
+
+	for i := range tables {
+		table := &tables[i]
+		table.ExpectedTTL = m.expectedTTL(table)
+
+		for _, ttl := range applied {
+			if ttl.Name == table.Name {
+				table.AppliedTTL = ttl.TTL
+				table.AppliedAt = ttl.Time
+			}
+		}
+		for _, part := range parts {
+			if part.Table == table.Name {
+				table.OldestDate = part.OldestDate
+				table.Rows = part.Rows
+				table.BytesOnDisk = part.BytesOnDisk
+			}
+		}
+	}
+
+	return tables, nil
+}
@@ -0,0 +1,52 @@
+package chadmin
+
+import (
+	"net/http"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httputil"
+)
+
+type TTLHandler struct {
+	*bunapp.App
+
+	ttls *TTLManager
+}
+
+func NewTTLHandler(app *bunapp.App, ttls *TTLManager) *TTLHandler {
+	return &TTLHandler{
+		App:  app,
+		ttls: ttls,
+	}
+}
+
+// List returns tables with their TTLs and the oldest data.
+func (h *TTLHandler) List(w http.ResponseWriter, req bunrouter.Request) error {
+	tables, err := h.ttls.Tables(req.Context())
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"tables": tables,
+	})
+}
+
+// Sync applies the configured TTLs without waiting for the background job.
+func (h *TTLHandler) Sync(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	if err := h.ttls.Sync(ctx); err != nil {
+		return err
+	}
+
+	tables, err := h.ttls.Tables(ctx)
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"tables": tables,
+	})
+}
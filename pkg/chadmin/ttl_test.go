@@ -0,0 +1,54 @@
+package chadmin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInterval(t *testing.T) {
+	interval, err := ParseInterval("30 day")
+	require.NoError(t, err)
+	require.Equal(t, Interval{Num: 30, Unit: "DAY"}, interval)
+	require.Equal(t, "toIntervalDay(30)", interval.chFormat())
+
+	interval, err = ParseInterval("2 WEEKS")
+	require.NoError(t, err)
+	require.Equal(t, "2 WEEK", interval.String())
+
+	_, err = ParseInterval("30d")
+	require.Error(t, err)
+}
+
+func TestTTLExpr(t *testing.T) {
+	month := Interval{Num: 30, Unit: "DAY"}
+	projects := []projectTTL{
+		{projectID: 2, ttl: Interval{Num: 7, Unit: "DAY"}},
+		{projectID: 3, ttl: Interval{Num: 1, Unit: "YEAR"}},
+	}
+
+	require.Equal(t, `toDate("time") + INTERVAL 30 DAY DELETE`,
+		ttlExpr("time", month, nil, true))
+	require.Equal(t, `toDate("span.time") + INTERVAL 7 DAY DELETE WHERE project_id = 2, `+
+		`toDate("span.time") + INTERVAL 1 YEAR DELETE WHERE project_id = 3, `+
+		`toDate("span.time") + INTERVAL 30 DAY DELETE WHERE project_id NOT IN (2, 3)`,
+		ttlExpr("span.time", month, projects, true))
+	require.Equal(t, `toDate("time") + INTERVAL 1 YEAR DELETE`,
+		ttlExpr("time", month, projects, false))
+}
+
+func TestCapTTL(t *testing.T) {
+	week := Interval{Num: 7, Unit: "DAY"}
+	projects := []projectTTL{
+		{projectID: 2, ttl: Interval{Num: 3, Unit: "DAY"}},
+		{projectID: 3, ttl: Interval{Num: 1, Unit: "YEAR"}},
+	}
+
+	defaultTTL, capped := capTTL(Interval{Num: 30, Unit: "DAY"}, projects, week)
+	require.Equal(t, week, defaultTTL)
+	require.Equal(t, []projectTTL{
+		{projectID: 2, ttl: Interval{Num: 3, Unit: "DAY"}},
+		{projectID: 3, ttl: week},
+	}, capped)
+	require.Equal(t, Interval{Num: 1, Unit: "YEAR"}, projects[1].ttl)
+}
@@ -9,6 +9,12 @@ import (
 	"net/http"
 	"reflect"
 	"strconv"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 type Error struct {
@@ -16,6 +22,12 @@ type Error struct {
 
 	Code    string `json:"code"`
 	Message string `json:"message"`
+
+	// RequestID is set by the HTTP error handler so users can report it.
+	RequestID string `json:"requestId,omitempty"`
+
+	// RetryAfter is sent as the Retry-After header when it is set.
+	RetryAfter time.Duration `json:"-"`
 }
 
 func (e *Error) StatusCode() int {
@@ -26,6 +38,33 @@ func (e *Error) Error() string {
 	return e.Message
 }
 
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:      codes.InvalidArgument,
+	http.StatusUnauthorized:    codes.Unauthenticated,
+	http.StatusForbidden:       codes.PermissionDenied,
+	http.StatusNotFound:        codes.NotFound,
+	http.StatusTooManyRequests: codes.ResourceExhausted,
+}
+
+// GRPCStatus lets gRPC servers return the error. RetryAfter is sent as RetryInfo
+// that OTLP exporters use to delay retries.
+func (e *Error) GRPCStatus() *status.Status {
+	code, ok := grpcCodes[e.Status]
+	if !ok {
+		code = codes.Unknown
+	}
+
+	st := status.New(code, e.Message)
+	if e.RetryAfter > 0 {
+		if withInfo, err := st.WithDetails(&errdetails.RetryInfo{
+			RetryDelay: durationpb.New(e.RetryAfter),
+		}); err == nil {
+			st = withInfo
+		}
+	}
+	return st
+}
+
 //------------------------------------------------------------------------------
 
 func New(status int, code, msg string, args ...any) *Error {
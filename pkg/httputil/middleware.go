@@ -3,11 +3,17 @@ package httputil
 import (
 	"compress/gzip"
 	"compress/zlib"
+	"context"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"runtime"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 type PanicHandler struct {
@@ -29,12 +35,17 @@ func (h PanicHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 //------------------------------------------------------------------------------
 
+// DecompressHandler decompresses request bodies with Content-Encoding gzip, zstd,
+// or deflate. OTel Collector otlphttp exporters compress requests with gzip by default.
 type DecompressHandler struct {
 	Next http.Handler
+	// Max memory used by zstd decoders. Zstd frames can require large windows,
+	// so it protects against compression bombs before the body size is checked.
+	MaxSize int64
 }
 
 func (h DecompressHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	newBody, err := newBodyReader(req)
+	newBody, err := h.newBodyReader(req)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -49,20 +60,64 @@ func (h DecompressHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	h.Next.ServeHTTP(w, req)
 }
 
-func newBodyReader(req *http.Request) (io.ReadCloser, error) {
-	switch req.Header.Get("Content-Encoding") {
+func (h DecompressHandler) newBodyReader(req *http.Request) (io.ReadCloser, error) {
+	switch encoding := req.Header.Get("Content-Encoding"); encoding {
+	case "", "identity":
+		return nil, nil
 	case "gzip":
 		gr, err := gzip.NewReader(req.Body)
 		if err != nil {
 			return nil, err
 		}
 		return gr, nil
+	case "zstd":
+		opts := []zstd.DOption{zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true)}
+		if h.MaxSize > 0 {
+			opts = append(opts, zstd.WithDecoderMaxMemory(uint64(h.MaxSize)))
+		}
+		zr, err := zstd.NewReader(req.Body, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
 	case "deflate", "zlib":
 		zr, err := zlib.NewReader(req.Body)
 		if err != nil {
 			return nil, err
 		}
 		return zr, nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding: %q", encoding)
+	}
+}
+
+//------------------------------------------------------------------------------
+
+type connCtxKey struct{}
+
+// ConnContext is used as http.Server.ConnContext to make the connection available
+// to StreamHandler.
+func ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connCtxKey{}, conn)
+}
+
+// StreamHandler removes the server write timeout for requests with the path suffix
+// so handlers can stream large responses. The server must use ConnContext.
+// The deadline is reset by the server when it reads the next request.
+type StreamHandler struct {
+	Next     http.Handler
+	Suffixes []string
+}
+
+func (h StreamHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	for _, suffix := range h.Suffixes {
+		if !strings.HasSuffix(req.URL.Path, suffix) {
+			continue
+		}
+		if conn, ok := req.Context().Value(connCtxKey{}).(net.Conn); ok {
+			_ = conn.SetWriteDeadline(time.Time{})
+		}
+		break
 	}
-	return nil, nil
+	h.Next.ServeHTTP(w, req)
 }
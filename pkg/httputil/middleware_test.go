@@ -0,0 +1,43 @@
+package httputil
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamHandler(t *testing.T) {
+	srv := httptest.NewUnstartedServer(StreamHandler{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+			_, _ = io.WriteString(w, "ok")
+		}),
+		Suffixes: []string{"/export"},
+	})
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Config.ConnContext = ConnContext
+	srv.Start()
+	defer srv.Close()
+
+	get := func(path string) (string, error) {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+
+		b, err := io.ReadAll(resp.Body)
+		return string(b), err
+	}
+
+	body, err := get("/api/spans/export")
+	require.NoError(t, err)
+	require.Equal(t, "ok", body)
+
+	_, err = get("/api/spans")
+	require.Error(t, err)
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -41,6 +42,14 @@ func NewAuthMiddleware(app *bunapp.App) bunrouter.MiddlewareFunc {
 		return func(w http.ResponseWriter, req bunrouter.Request) error {
 			if user := userFromRequest(app, req); user != nil {
 				ctx := context.WithValue(req.Context(), userCtxKey{}, user)
+
+				// Project id is zero for routes without a project.
+				projectID, _ := req.Params().Uint32("project_id")
+				ctx = bunapp.ContextWithQueryTenant(ctx, bunapp.QueryTenant{
+					ProjectID: projectID,
+					UserID:    user.ID,
+				})
+
 				return next(w, req.WithContext(ctx))
 			}
 			return ErrUnauthorized
@@ -48,6 +57,59 @@ func NewAuthMiddleware(app *bunapp.App) bunrouter.MiddlewareFunc {
 	}
 }
 
+// NewAdminMiddleware allows only admins. It must be used after NewAuthMiddleware.
+func NewAdminMiddleware(app *bunapp.App) bunrouter.MiddlewareFunc {
+	return func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+		return func(w http.ResponseWriter, req bunrouter.Request) error {
+			user, err := UserFromContext(req.Context())
+			if err != nil {
+				return err
+			}
+			if !user.Admin {
+				return ErrAccessedDenied
+			}
+			return next(w, req)
+		}
+	}
+}
+
+// NewProjectTokenMiddleware authenticates machine clients, for example, Prometheus,
+// using the project token from the Authorization header or the token query param.
+func NewProjectTokenMiddleware(app *bunapp.App) bunrouter.MiddlewareFunc {
+	return func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+		return func(w http.ResponseWriter, req bunrouter.Request) error {
+			ctx := req.Context()
+
+			if err := CheckAuthThrottle(ctx, app); err != nil {
+				return err
+			}
+
+			projectID, err := req.Params().Uint32("project_id")
+			if err != nil {
+				return err
+			}
+
+			project, err := SelectProjectByID(ctx, app, projectID)
+			if err != nil {
+				return ErrUnauthorized
+			}
+
+			token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+			if token == "" {
+				token = req.URL.Query().Get("token")
+			}
+			if token == "" ||
+				subtle.ConstantTimeCompare([]byte(token), []byte(project.Token)) != 1 {
+				AuthFailed(ctx, app, "invalid project token")
+				return ErrUnauthorized
+			}
+
+			ctx = bunapp.ContextWithQueryTenant(ctx, bunapp.QueryTenant{ProjectID: projectID})
+			return next(w, req.WithContext(ctx))
+		}
+	}
+}
+
 func findUserByPassword(app *bunapp.App, username string, password string) *bunapp.User {
 	users := app.Config().Users
 	for i := range users {
@@ -0,0 +1,67 @@
+package org
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"go.uber.org/zap"
+)
+
+var ErrAuthLockedOut = httperror.New(http.StatusTooManyRequests, "auth_locked_out",
+	"too many failed authentication attempts, try again later")
+
+// CheckAuthThrottle rejects clients that are locked out after failed
+// authentication attempts.
+func CheckAuthThrottle(ctx context.Context, app *bunapp.App) error {
+	ip := bunapp.ClientIPFromContext(ctx)
+	if ip == nil {
+		return nil
+	}
+	if app.AuthThrottle().Locked(ip.String()) {
+		return ErrAuthLockedOut
+	}
+	return nil
+}
+
+// AuthFailed records a failed authentication attempt using a DSN or a project token.
+func AuthFailed(ctx context.Context, app *bunapp.App, reason string) {
+	ip := bunapp.ClientIPFromContext(ctx)
+	if ip == nil {
+		return
+	}
+
+	if app.AuthThrottle().Fail(ip.String()) {
+		app.Zap(ctx).Warn("client is locked out after failed authentication attempts",
+			zap.String("client_ip", ip.String()),
+			zap.String("reason", reason),
+			zap.Duration("lockout", app.Config().AuthThrottle.Lockout))
+		return
+	}
+
+	app.Zap(ctx).Info("authentication failed",
+		zap.String("client_ip", ip.String()),
+		zap.String("reason", reason))
+}
+
+//------------------------------------------------------------------------------
+
+type AuthThrottleHandler struct {
+	*bunapp.App
+}
+
+func NewAuthThrottleHandler(app *bunapp.App) *AuthThrottleHandler {
+	return &AuthThrottleHandler{
+		App: app,
+	}
+}
+
+// Lockouts returns clients that are locked out after failed authentication attempts.
+func (h *AuthThrottleHandler) Lockouts(w http.ResponseWriter, req bunrouter.Request) error {
+	return httputil.JSON(w, bunrouter.H{
+		"lockouts": h.AuthThrottle().Lockouts(),
+	})
+}
@@ -0,0 +1,63 @@
+package org
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+var ErrDSNRequired = errors.New(
+	"uptrace-dsn header, Authorization header, or dsn query parameter is required")
+
+// IngestDSN returns the DSN that an exporter sent with the uptrace-dsn header,
+// the Authorization header with a bearer token or basic auth credentials,
+// or the dsn query parameter for proxies that strip custom headers.
+// The DSN may also be just the project token.
+func IngestDSN(req *http.Request) string {
+	if dsn := req.Header.Get("uptrace-dsn"); dsn != "" {
+		return dsn
+	}
+	if dsn := authorizationDSN(req.Header.Get("Authorization")); dsn != "" {
+		return dsn
+	}
+	return req.URL.Query().Get("dsn")
+}
+
+// IngestDSNFromMetadata is like IngestDSN, but for gRPC metadata.
+func IngestDSNFromMetadata(md metadata.MD) string {
+	if values := md.Get("uptrace-dsn"); len(values) > 0 && values[0] != "" {
+		return values[0]
+	}
+	if values := md.Get("authorization"); len(values) > 0 {
+		return authorizationDSN(values[0])
+	}
+	return ""
+}
+
+// authorizationDSN returns the bearer token or the basic auth password,
+// falling back to the username when the password is empty.
+func authorizationDSN(header string) string {
+	scheme, credentials, ok := strings.Cut(header, " ")
+	if !ok {
+		return ""
+	}
+
+	switch strings.ToLower(scheme) {
+	case "bearer":
+		return strings.TrimSpace(credentials)
+	case "basic":
+		req := http.Request{Header: http.Header{"Authorization": {header}}}
+		username, password, ok := req.BasicAuth()
+		if !ok {
+			return ""
+		}
+		if password != "" {
+			return password
+		}
+		return username
+	default:
+		return ""
+	}
+}
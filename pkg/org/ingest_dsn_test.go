@@ -0,0 +1,66 @@
+package org
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestIngestDSN(t *testing.T) {
+	const dsn = "http://project1_secret_token@localhost:14317/1"
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/traces", nil)
+	require.Equal(t, "", IngestDSN(req))
+
+	req.Header.Set("Authorization", "Bearer "+dsn)
+	require.Equal(t, dsn, IngestDSN(req))
+
+	req.SetBasicAuth("uptrace", "project1_secret_token")
+	require.Equal(t, "project1_secret_token", IngestDSN(req))
+
+	req.SetBasicAuth("uptrace", dsn)
+	require.Equal(t, dsn, IngestDSN(req))
+
+	req.SetBasicAuth("project1_secret_token", "")
+	require.Equal(t, "project1_secret_token", IngestDSN(req))
+
+	req.Header.Set("uptrace-dsn", "header")
+	require.Equal(t, "header", IngestDSN(req))
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/traces?dsn=http%3A%2F%2Ftoken%40localhost%2F1", nil)
+	require.Equal(t, "http://token@localhost/1", IngestDSN(req))
+
+	md := metadata.Pairs("authorization", "Bearer "+dsn)
+	require.Equal(t, dsn, IngestDSNFromMetadata(md))
+	md.Set("uptrace-dsn", "header")
+	require.Equal(t, "header", IngestDSNFromMetadata(md))
+}
+
+func TestSelectProjectByDSN(t *testing.T) {
+	ctx := context.Background()
+
+	conf := &bunapp.AppConfig{
+		Projects: []bunapp.Project{{ID: 1, Token: "project1_secret_token"}},
+	}
+	conf.CH.DSN = "clickhouse://default:@localhost:9000/uptrace?sslmode=disable"
+	app := bunapp.New(ctx, conf)
+	defer app.Stop()
+
+	project, err := SelectProjectByDSN(ctx, app, "http://project1_secret_token@localhost:14317/1")
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), project.ID)
+
+	project, err = SelectProjectByDSN(ctx, app, "project1_secret_token")
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), project.ID)
+
+	// Errors don't echo the submitted token.
+	_, err = SelectProjectByDSN(ctx, app, "project1_secret_tokeX")
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "project1_secret_tokeX")
+}
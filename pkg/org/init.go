@@ -13,6 +13,7 @@ func init() {
 
 func registerRoutes(ctx context.Context, app *bunapp.App) error {
 	userHandler := NewUserHandler(app)
+	throttleHandler := NewAuthThrottleHandler(app)
 
 	g := app.APIGroup()
 
@@ -22,5 +23,12 @@ func registerRoutes(ctx context.Context, app *bunapp.App) error {
 		g.GET("/current", userHandler.Current)
 	})
 
+	adminGroup := g.
+		Use(NewAuthMiddleware(app)).
+		Use(NewAdminMiddleware(app)).
+		NewGroup("/auth")
+
+	adminGroup.GET("/lockouts", throttleHandler.Lockouts)
+
 	return nil
 }
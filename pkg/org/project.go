@@ -2,9 +2,15 @@ package org
 
 import (
 	"context"
+	"crypto/subtle"
 	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
 
 	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
 )
 
 func SelectProjectByID(
@@ -19,3 +25,64 @@ func SelectProjectByID(
 	}
 	return nil, sql.ErrNoRows
 }
+
+// SelectIngestProjectByID is like SelectProjectByID, but rejects archived projects.
+func SelectIngestProjectByID(
+	ctx context.Context, app *bunapp.App, projectID uint32,
+) (*bunapp.Project, error) {
+	project, err := SelectProjectByID(ctx, app, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckIngestProject(project); err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+// CheckIngestProject returns an error if the project does not accept new data.
+func CheckIngestProject(project *bunapp.Project) error {
+	if !project.Archived() {
+		return nil
+	}
+	return httperror.New(http.StatusForbidden, "project_archived",
+		"project %d is archived since %s and does not accept new data",
+		project.ID, project.Archive.Date.Format("2006-01-02"))
+}
+
+func SelectProjectByDSN(
+	ctx context.Context, app *bunapp.App, dsnStr string,
+) (*bunapp.Project, error) {
+	if err := CheckAuthThrottle(ctx, app); err != nil {
+		return nil, err
+	}
+
+	// Exporters that use the Authorization header may send just the token.
+	token := dsnStr
+	if strings.Contains(dsnStr, "://") {
+		dsn, err := ParseDSN(dsnStr)
+		if err != nil {
+			return nil, err
+		}
+		token = dsn.Token
+	}
+
+	if token == "" {
+		AuthFailed(ctx, app, "dsn without a token")
+		return nil, fmt.Errorf("dsn %q does not contain a token", dsnStr)
+	}
+
+	projects := app.Config().Projects
+	for i := range projects {
+		project := &projects[i]
+		if subtle.ConstantTimeCompare([]byte(token), []byte(project.Token)) == 1 {
+			if err := CheckIngestProject(project); err != nil {
+				return nil, err
+			}
+			return project, nil
+		}
+	}
+	AuthFailed(ctx, app, "unknown dsn token")
+	// The token is not included in the error that clients and logs see.
+	return nil, errors.New("project with the dsn token not found")
+}
@@ -0,0 +1,67 @@
+package profiling
+
+import (
+	"net/http"
+
+	"github.com/google/pprof/profile"
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	"github.com/uptrace/uptrace/pkg/org"
+)
+
+type IngestHandler struct {
+	*bunapp.App
+}
+
+func NewIngestHandler(app *bunapp.App) *IngestHandler {
+	return &IngestHandler{
+		App: app,
+	}
+}
+
+// Ingest accepts a pprof profile (gzipped or not), for example,
+// the output of /debug/pprof/profile.
+func (h *IngestHandler) Ingest(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	dsn := org.IngestDSN(req.Request)
+	if dsn == "" {
+		return org.ErrDSNRequired
+	}
+
+	project, err := org.SelectProjectByDSN(ctx, h.App, dsn)
+	if err != nil {
+		return err
+	}
+
+	src, err := profile.Parse(req.Body)
+	if err != nil {
+		return httperror.BadRequest("pprof", err.Error())
+	}
+
+	query := req.URL.Query()
+	meta := &profileMeta{
+		ProjectID:   project.ID,
+		ServiceName: query.Get("service"),
+		HostName:    query.Get("host"),
+	}
+	profiles, samples := convertProfile(meta, src)
+
+	if len(profiles) == 0 {
+		return nil
+	}
+
+	if _, err := h.CH().NewInsert().Model(&profiles).Exec(ctx); err != nil {
+		return err
+	}
+
+	if len(samples) > 0 {
+		if _, err := h.CH().NewInsert().Model(&samples).Exec(ctx); err != nil {
+			return err
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
@@ -0,0 +1,29 @@
+package profiling
+
+import (
+	"context"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/org"
+)
+
+func init() {
+	bunapp.OnStart("profiling.registerRoutes", registerRoutes)
+}
+
+func registerRoutes(ctx context.Context, app *bunapp.App) error {
+	ingestHandler := NewIngestHandler(app)
+	profileHandler := NewProfileHandler(app)
+
+	router := app.Router()
+	router.POST("/v1/profiles", ingestHandler.Ingest)
+
+	g := app.APIGroup().
+		Use(org.NewAuthMiddleware(app)).
+		NewGroup("/profiling/:project_id")
+
+	g.GET("/profiles", profileHandler.List)
+	g.GET("/flamegraph", profileHandler.Flamegraph)
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package profiling
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/google/uuid"
+	"github.com/uptrace/go-clickhouse/ch"
+)
+
+type Profile struct {
+	ch.CHModel `ch:"table:profiles,alias:p"`
+
+	ProjectID   uint32        `json:"projectId"`
+	ID          uint64        `json:"id,string"`
+	Type        string        `json:"type" ch:",lc"`
+	Unit        string        `json:"unit" ch:",lc"`
+	Time        time.Time     `json:"time"`
+	Duration    time.Duration `json:"duration"`
+	Period      int64         `json:"period"`
+	SampleCount uint32        `json:"sampleCount"`
+
+	ServiceName string `json:"serviceName" ch:"service.name,lc"`
+	HostName    string `json:"hostName" ch:"host.name,lc"`
+}
+
+type ProfileSample struct {
+	ch.CHModel `ch:"table:profile_samples_buffer,alias:s"`
+
+	ProjectID uint32
+	ProfileID uint64
+	Type      string `ch:",lc"`
+	Time      time.Time
+
+	ServiceName string `ch:"service.name,lc"`
+
+	TraceID uuid.UUID `ch:"type:UUID"`
+	SpanID  uint64
+
+	Stack []string
+	Value int64
+}
+
+type profileMeta struct {
+	ProjectID   uint32
+	ServiceName string
+	HostName    string
+}
+
+// convertProfile converts a pprof profile into a row per sample type and a row per
+// (sample, sample type) pair. Samples with a zero value are skipped.
+func convertProfile(meta *profileMeta, src *profile.Profile) ([]Profile, []ProfileSample) {
+	tm := time.Unix(0, src.TimeNanos)
+	if src.TimeNanos == 0 {
+		tm = time.Now()
+	}
+
+	profiles := make([]Profile, len(src.SampleType))
+	for i, typ := range src.SampleType {
+		profiles[i] = Profile{
+			ProjectID:   meta.ProjectID,
+			ID:          rand.Uint64(),
+			Type:        typ.Type,
+			Unit:        typ.Unit,
+			Time:        tm,
+			Duration:    time.Duration(src.DurationNanos),
+			Period:      src.Period,
+			SampleCount: uint32(len(src.Sample)),
+			ServiceName: meta.ServiceName,
+			HostName:    meta.HostName,
+		}
+	}
+
+	samples := make([]ProfileSample, 0, len(src.Sample)*len(src.SampleType))
+	for _, sample := range src.Sample {
+		stack := sampleStack(sample)
+		traceID, spanID := sampleTraceContext(sample)
+
+		for i, value := range sample.Value {
+			if value == 0 || i >= len(profiles) {
+				continue
+			}
+			samples = append(samples, ProfileSample{
+				ProjectID:   meta.ProjectID,
+				ProfileID:   profiles[i].ID,
+				Type:        profiles[i].Type,
+				Time:        tm,
+				ServiceName: meta.ServiceName,
+				TraceID:     traceID,
+				SpanID:      spanID,
+				Stack:       stack,
+				Value:       value,
+			})
+		}
+	}
+
+	return profiles, samples
+}
+
+// sampleStack returns function names ordered from the root frame to the leaf frame.
+// pprof stores locations and inlined lines leaf-first.
+func sampleStack(sample *profile.Sample) []string {
+	stack := make([]string, 0, len(sample.Location))
+	for i := len(sample.Location) - 1; i >= 0; i-- {
+		loc := sample.Location[i]
+		for j := len(loc.Line) - 1; j >= 0; j-- {
+			if fn := loc.Line[j].Function; fn != nil {
+				stack = append(stack, fn.Name)
+			}
+		}
+	}
+	return stack
+}
+
+// sampleTraceContext extracts trace and span ids from pprof labels that are set by
+// OpenTelemetry-aware profilers, for example, via pprof.Do.
+func sampleTraceContext(sample *profile.Sample) (uuid.UUID, uint64) {
+	var traceID uuid.UUID
+	var spanID uint64
+
+	if s := sampleLabel(sample, "trace_id", "otel.trace_id"); s != "" {
+		if b, err := hex.DecodeString(s); err == nil && len(b) == 16 {
+			copy(traceID[:], b)
+		}
+	}
+	if s := sampleLabel(sample, "span_id", "otel.span_id"); s != "" {
+		// Same byte order as the span ids stored by the tracing package.
+		if b, err := hex.DecodeString(s); err == nil && len(b) == 8 {
+			spanID = binary.LittleEndian.Uint64(b)
+		}
+	}
+
+	return traceID, spanID
+}
+
+func sampleLabel(sample *profile.Sample, keys ...string) string {
+	for _, key := range keys {
+		if vs := sample.Label[key]; len(vs) > 0 {
+			return vs[0]
+		}
+	}
+	return ""
+}
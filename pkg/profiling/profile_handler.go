@@ -0,0 +1,192 @@
+package profiling
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/tracing"
+	"github.com/uptrace/uptrace/pkg/urlstruct"
+)
+
+type ProfileFilter struct {
+	*bunapp.App `urlstruct:"-"`
+
+	tracing.TimeFilter
+
+	ProjectID uint32
+	Type      string
+	Service   string
+	TraceID   string
+
+	traceID uuid.UUID
+}
+
+func DecodeProfileFilter(app *bunapp.App, req bunrouter.Request) (*ProfileFilter, error) {
+	f := &ProfileFilter{App: app}
+	if err := bunapp.UnmarshalValues(req, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+var _ urlstruct.ValuesUnmarshaler = (*ProfileFilter)(nil)
+
+func (f *ProfileFilter) UnmarshalValues(ctx context.Context, values url.Values) error {
+	if err := f.TimeFilter.UnmarshalValues(ctx, values); err != nil {
+		return err
+	}
+	if f.TraceID != "" {
+		traceID, err := uuid.Parse(f.TraceID)
+		if err != nil {
+			return err
+		}
+		f.traceID = traceID
+	}
+	return nil
+}
+
+func (f *ProfileFilter) whereClause(q *ch.SelectQuery) *ch.SelectQuery {
+	q = q.Where("project_id = ?", f.ProjectID).
+		Where("time >= ?", f.TimeGTE).
+		Where("time < ?", f.TimeLT)
+
+	if f.Type != "" {
+		q = q.Where("type = ?", f.Type)
+	}
+	if f.Service != "" {
+		q = q.Where("`service.name` = ?", f.Service)
+	}
+	if f.TraceID != "" {
+		q = q.Where("trace_id = ?", f.traceID)
+	}
+
+	return q
+}
+
+//------------------------------------------------------------------------------
+
+type ProfileHandler struct {
+	*bunapp.App
+}
+
+func NewProfileHandler(app *bunapp.App) *ProfileHandler {
+	return &ProfileHandler{
+		App: app,
+	}
+}
+
+func (h *ProfileHandler) List(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	f, err := DecodeProfileFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+	f.TraceID = ""
+
+	profiles := make([]Profile, 0)
+
+	if err := h.CH().NewSelect().
+		Model(&profiles).
+		Apply(f.whereClause).
+		OrderExpr("time DESC").
+		Limit(1000).
+		Scan(ctx); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"profiles": profiles,
+	})
+}
+
+func (h *ProfileHandler) Flamegraph(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	f, err := DecodeProfileFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+	if f.Type == "" {
+		return errors.New("'type' query param is required")
+	}
+
+	var stacks []struct {
+		Stack []string
+		Value int64
+	}
+
+	if err := h.CH().NewSelect().
+		Model((*ProfileSample)(nil)).
+		ColumnExpr("stack").
+		ColumnExpr("sum(value) AS value").
+		Apply(f.whereClause).
+		GroupExpr("stack").
+		OrderExpr("value DESC").
+		Limit(10000).
+		Scan(ctx, &stacks); err != nil {
+		return err
+	}
+
+	root := newFrame("root")
+	for _, stack := range stacks {
+		root.Add(stack.Stack, stack.Value)
+	}
+
+	traceIDs := make([]uuid.UUID, 0)
+
+	if err := h.CH().NewSelect().
+		Model((*ProfileSample)(nil)).
+		ColumnExpr("topK(10)(trace_id)").
+		Apply(f.whereClause).
+		Where("trace_id != ?", uuid.UUID{}).
+		Scan(ctx, &traceIDs); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"flamegraph": root,
+		"traceIds":   traceIDs,
+	})
+}
+
+//------------------------------------------------------------------------------
+
+type Frame struct {
+	Name     string   `json:"name"`
+	Value    int64    `json:"value"`
+	Children []*Frame `json:"children,omitempty"`
+
+	childMap map[string]*Frame
+}
+
+func newFrame(name string) *Frame {
+	return &Frame{
+		Name: name,
+	}
+}
+
+func (f *Frame) Add(stack []string, value int64) {
+	f.Value += value
+	if len(stack) == 0 {
+		return
+	}
+
+	child, ok := f.childMap[stack[0]]
+	if !ok {
+		if f.childMap == nil {
+			f.childMap = make(map[string]*Frame)
+		}
+		child = newFrame(stack[0])
+		f.childMap[stack[0]] = child
+		f.Children = append(f.Children, child)
+	}
+	child.Add(stack[1:], value)
+}
@@ -0,0 +1,86 @@
+package profiling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertProfile(t *testing.T) {
+	mainFn := &profile.Function{ID: 1, Name: "main.main"}
+	handlerFn := &profile.Function{ID: 2, Name: "main.handler"}
+	inlinedFn := &profile.Function{ID: 3, Name: "main.inlined"}
+
+	src := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "samples", Unit: "count"},
+			{Type: "cpu", Unit: "nanoseconds"},
+		},
+		TimeNanos:     time.Date(2022, time.January, 28, 12, 0, 0, 0, time.UTC).UnixNano(),
+		DurationNanos: int64(10 * time.Second),
+		Period:        10000000,
+		Sample: []*profile.Sample{
+			{
+				// Locations are leaf-first and so are inlined lines.
+				Location: []*profile.Location{
+					{Line: []profile.Line{{Function: inlinedFn}, {Function: handlerFn}}},
+					{Line: []profile.Line{{Function: mainFn}}},
+				},
+				Value: []int64{2, 20000000},
+				Label: map[string][]string{
+					"trace_id": {"0102030405060708090a0b0c0d0e0f10"},
+					"span_id":  {"0102030405060708"},
+				},
+			},
+			{
+				Location: []*profile.Location{{Line: []profile.Line{{Function: mainFn}}}},
+				// Zero values are skipped.
+				Value: []int64{1, 0},
+				Label: map[string][]string{"otel.trace_id": {"bad"}},
+			},
+		},
+	}
+
+	meta := &profileMeta{ProjectID: 1, ServiceName: "api", HostName: "host-1"}
+	profiles, samples := convertProfile(meta, src)
+
+	require.Len(t, profiles, 2)
+	for i, typ := range []string{"samples", "cpu"} {
+		p := profiles[i]
+		require.Equal(t, uint32(1), p.ProjectID)
+		require.Equal(t, typ, p.Type)
+		require.Equal(t, src.SampleType[i].Unit, p.Unit)
+		require.Equal(t, src.TimeNanos, p.Time.UnixNano())
+		require.Equal(t, 10*time.Second, p.Duration)
+		require.Equal(t, int64(10000000), p.Period)
+		require.Equal(t, uint32(2), p.SampleCount)
+		require.Equal(t, "api", p.ServiceName)
+		require.Equal(t, "host-1", p.HostName)
+	}
+	require.NotEqual(t, profiles[0].ID, profiles[1].ID)
+
+	require.Len(t, samples, 3)
+
+	traceID := uuid.UUID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	stack := []string{"main.main", "main.handler", "main.inlined"}
+
+	require.Equal(t, profiles[0].ID, samples[0].ProfileID)
+	require.Equal(t, "samples", samples[0].Type)
+	require.Equal(t, int64(2), samples[0].Value)
+	require.Equal(t, stack, samples[0].Stack)
+	require.Equal(t, traceID, samples[0].TraceID)
+	require.Equal(t, uint64(0x0807060504030201), samples[0].SpanID)
+
+	require.Equal(t, profiles[1].ID, samples[1].ProfileID)
+	require.Equal(t, "cpu", samples[1].Type)
+	require.Equal(t, int64(20000000), samples[1].Value)
+	require.Equal(t, stack, samples[1].Stack)
+
+	require.Equal(t, profiles[0].ID, samples[2].ProfileID)
+	require.Equal(t, []string{"main.main"}, samples[2].Stack)
+	require.Equal(t, uuid.UUID{}, samples[2].TraceID)
+	require.Equal(t, uint64(0), samples[2].SpanID)
+}
@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+const (
+	apdexSatisfied  = "satisfied"
+	apdexTolerating = "tolerating"
+	apdexFrustrated = "frustrated"
+)
+
+func apdexThreshold(conf *bunapp.AppConfig, project *bunapp.Project, groupID uint64) time.Duration {
+	if threshold, ok := project.ApdexGroups[groupID]; ok {
+		return threshold
+	}
+	if project.ApdexThreshold != 0 {
+		return project.ApdexThreshold
+	}
+	return conf.Apdex.Threshold
+}
+
+func apdexLevel(span *Span, threshold time.Duration) string {
+	switch {
+	case span.StatusCode == errorStatusCode:
+		return apdexFrustrated
+	case span.Duration <= threshold:
+		return apdexSatisfied
+	case span.Duration <= 4*threshold:
+		return apdexTolerating
+	default:
+		return apdexFrustrated
+	}
+}
@@ -52,6 +52,25 @@ func (m AttrMap) Uint64(key string) uint64 {
 	}
 }
 
+func (m AttrMap) Float64(key string) float64 {
+	switch v := m[key].(type) {
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case json.Number:
+		n, _ := v.Float64()
+		return n
+	case string:
+		n, _ := strconv.ParseFloat(v, 64)
+		return n
+	default:
+		return 0
+	}
+}
+
 func (m AttrMap) Time(key string) time.Time {
 	switch v := m[key].(type) {
 	case time.Time:
@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/org"
+	"github.com/uptrace/uptrace/pkg/uql"
+)
+
+const maskedAttrValue = "***"
+
+// attrPolicyFromContext returns the attribute policy of the current user or nil.
+func attrPolicyFromContext(ctx context.Context, app *bunapp.App) *bunapp.AttrPolicy {
+	user, err := org.UserFromContext(ctx)
+	if err != nil {
+		return nil
+	}
+	return app.Config().AttrPolicy(user.Role)
+}
+
+func applyAttrPolicy(policy *bunapp.AttrPolicy, attrs AttrMap) {
+	if policy == nil {
+		return
+	}
+	for key := range attrs {
+		switch {
+		case policy.Hidden(key):
+			delete(attrs, key)
+		case policy.Masked(key):
+			attrs[key] = maskedAttrValue
+		}
+	}
+}
+
+func applySpanAttrPolicy(policy *bunapp.AttrPolicy, span *Span) {
+	if policy == nil {
+		return
+	}
+	applyAttrPolicy(policy, span.Attrs)
+	for _, event := range span.Events {
+		applyAttrPolicy(policy, event.Attrs)
+	}
+}
+
+// restrictString returns the value of the attribute allowed by the policy.
+func restrictString(policy *bunapp.AttrPolicy, key, value string) string {
+	switch {
+	case value == "":
+		return value
+	case policy.Hidden(key):
+		return ""
+	case policy.Masked(key):
+		return maskedAttrValue
+	}
+	return value
+}
+
+// restrictUQL reports an error for query parts that use restricted attributes
+// because filtering or grouping by them reveals their values.
+func restrictUQL(parts []*uql.Part, policy *bunapp.AttrPolicy) {
+	if policy == nil {
+		return
+	}
+
+	for _, part := range parts {
+		if part.Disabled || part.Error != "" {
+			continue
+		}
+
+		var names []uql.Name
+		switch ast := part.AST.(type) {
+		case *uql.Columns:
+			names = ast.Names
+		case *uql.Group:
+			names = ast.Names
+		case *uql.Where:
+			for _, cond := range ast.Conds {
+				names = append(names, cond.Left)
+			}
+		}
+
+		for _, name := range names {
+			if policy.Restricted(name.AttrKey) {
+				part.SetError("access to %q is restricted", name.AttrKey)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/uql"
+)
+
+func TestAttrPolicy(t *testing.T) {
+	policy := &bunapp.AttrPolicy{
+		Role: "support",
+		Hide: []string{"enduser.email"},
+		Mask: []string{"http.request.header.*"},
+	}
+
+	attrs := AttrMap{
+		"enduser.email":                     "john@example.com",
+		"http.request.header.authorization": "Bearer secret",
+		"http.method":                       "GET",
+	}
+	applyAttrPolicy(policy, attrs)
+	require.Equal(t, AttrMap{
+		"http.request.header.authorization": maskedAttrValue,
+		"http.method":                       "GET",
+	}, attrs)
+
+	parts := uql.Parse("where enduser.email = 'john@example.com' | group by http.method")
+	restrictUQL(parts, policy)
+	require.Equal(t, `access to "enduser.email" is restricted`, parts[0].Error)
+	require.Empty(t, parts[1].Error)
+}
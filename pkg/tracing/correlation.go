@@ -0,0 +1,257 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	"github.com/uptrace/uptrace/pkg/urlstruct"
+	"go4.org/syncutil"
+)
+
+type CorrelationFilter struct {
+	*bunapp.App `urlstruct:"-"`
+
+	TimeFilter
+
+	ProjectID uint32
+	Service   string
+}
+
+func DecodeCorrelationFilter(app *bunapp.App, req bunrouter.Request) (*CorrelationFilter, error) {
+	f := &CorrelationFilter{App: app}
+	if err := bunapp.UnmarshalValues(req, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+var _ urlstruct.ValuesUnmarshaler = (*CorrelationFilter)(nil)
+
+func (f *CorrelationFilter) UnmarshalValues(ctx context.Context, values url.Values) error {
+	if err := f.TimeFilter.UnmarshalValues(ctx, values); err != nil {
+		return err
+	}
+	if f.Service == "" {
+		return errors.New("'service' query param is required")
+	}
+	return nil
+}
+
+func (f *CorrelationFilter) whereClause(q *ch.SelectQuery) *ch.SelectQuery {
+	return q.Where("project_id = ?", f.ProjectID).
+		Where("`service.name` = ?", f.Service).
+		Where("`span.time` >= ?", f.TimeGTE).
+		Where("`span.time` < ?", f.TimeLT)
+}
+
+//------------------------------------------------------------------------------
+
+type CorrelatedTrace struct {
+	TraceID    uuid.UUID     `json:"traceId" ch:"span.trace_id,type:UUID"`
+	SpanID     uint64        `json:"spanId,string" ch:"span.id"`
+	Name       string        `json:"name" ch:"span.name"`
+	Time       time.Time     `json:"time" ch:"span.time"`
+	Duration   time.Duration `json:"duration" ch:"span.duration"`
+	StatusCode string        `json:"statusCode" ch:"span.status_code"`
+}
+
+// selectCorrelatedTraces returns failed and then the slowest spans of the service.
+func selectCorrelatedTraces(ctx context.Context, f *CorrelationFilter) ([]CorrelatedTrace, error) {
+	traces := make([]CorrelatedTrace, 0)
+
+	if err := f.CH().NewSelect().
+		ColumnExpr("`span.trace_id`, `span.id`, `span.name`, `span.time`").
+		ColumnExpr("`span.duration`, `span.status_code`").
+		Model((*SpanIndex)(nil)).
+		Apply(f.whereClause).
+		Where("`span.event_name` = ''").
+		OrderExpr("`span.status_code` = ? DESC, `span.duration` DESC", errorStatusCode).
+		Limit(20).
+		Scan(ctx, &traces); err != nil {
+		return nil, err
+	}
+
+	return traces, nil
+}
+
+type CorrelatedLog struct {
+	TraceID          uuid.UUID `json:"traceId" ch:"span.trace_id,type:UUID"`
+	System           string    `json:"system" ch:"span.system"`
+	Time             time.Time `json:"time" ch:"span.time"`
+	LogSeverity      string    `json:"logSeverity,omitempty" ch:"log.severity"`
+	LogMessage       string    `json:"logMessage,omitempty" ch:"log.message"`
+	ExceptionType    string    `json:"exceptionType,omitempty" ch:"exception.type"`
+	ExceptionMessage string    `json:"exceptionMessage,omitempty" ch:"exception.message"`
+}
+
+// selectCorrelatedLogs returns the latest logs and exceptions of the service.
+func selectCorrelatedLogs(ctx context.Context, f *CorrelationFilter) ([]CorrelatedLog, error) {
+	logs := make([]CorrelatedLog, 0)
+
+	if err := f.CH().NewSelect().
+		ColumnExpr("`span.trace_id`, `span.system`, `span.time`").
+		ColumnExpr("`log.severity`, `log.message`, `exception.type`, `exception.message`").
+		Model((*SpanIndex)(nil)).
+		Apply(f.whereClause).
+		Where("(startsWith(`span.system`, 'log:') OR `span.system` = ?)", exceptionEventType).
+		OrderExpr("`span.time` DESC").
+		Limit(50).
+		Scan(ctx, &logs); err != nil {
+		return nil, err
+	}
+
+	return logs, nil
+}
+
+type MetricAnomaly struct {
+	System  string `json:"system"`
+	GroupID uint64 `json:"groupId,string"`
+	Name    string `json:"name"`
+
+	ErrorPct         float64 `json:"errorPct"`
+	BaselineErrorPct float64 `json:"baselineErrorPct"`
+	P99              float64 `json:"p99"`
+	BaselineP99      float64 `json:"baselineP99"`
+}
+
+// selectMetricAnomalies compares span groups of the service with the same period
+// before the time range and returns groups with more errors or higher latency.
+func selectMetricAnomalies(ctx context.Context, f *CorrelationFilter) ([]MetricAnomaly, error) {
+	baselineGTE := f.TimeGTE.Add(-f.Duration())
+	anomalies := make([]MetricAnomaly, 0)
+
+	if err := f.CH().NewSelect().
+		ColumnExpr("system, group_id, any(name) AS name").
+		ColumnExpr("sumIf(error_count, time >= ?) / sumIf(count, time >= ?) AS error_pct",
+			f.TimeGTE, f.TimeGTE).
+		ColumnExpr("sumIf(error_count, time < ?) / sumIf(count, time < ?) AS baseline_error_pct",
+			f.TimeGTE, f.TimeGTE).
+		ColumnExpr("toFloat64(quantilesTDigestWeightedMergeIf(0.5, 0.9, 0.99)"+
+			"(tdigest, time >= ?)[3]) AS p99", f.TimeGTE).
+		ColumnExpr("toFloat64(quantilesTDigestWeightedMergeIf(0.5, 0.9, 0.99)"+
+			"(tdigest, time < ?)[3]) AS baseline_p99", f.TimeGTE).
+		TableExpr(spanGroupTable(tablePeriod(&f.TimeFilter))).
+		Where("project_id = ?", f.ProjectID).
+		Where("service = ?", f.Service).
+		Where("time >= ?", baselineGTE).
+		Where("time < ?", f.TimeLT).
+		GroupExpr("system, group_id").
+		Having("error_pct > baseline_error_pct + 0.05 OR p99 > baseline_p99 * 2").
+		OrderExpr("error_pct - baseline_error_pct DESC").
+		Limit(20).
+		Scan(ctx, &anomalies); err != nil {
+		return nil, err
+	}
+
+	for i := range anomalies {
+		anomaly := &anomalies[i]
+		// There were no spans in one of the periods.
+		anomaly.ErrorPct = zeroNaN(anomaly.ErrorPct)
+		anomaly.BaselineErrorPct = zeroNaN(anomaly.BaselineErrorPct)
+		anomaly.P99 = zeroNaN(anomaly.P99)
+		anomaly.BaselineP99 = zeroNaN(anomaly.BaselineP99)
+	}
+
+	return anomalies, nil
+}
+
+type DeployMarker struct {
+	Version   string    `json:"version"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// selectDeployMarkers returns service versions that started sending spans
+// in the time range.
+func selectDeployMarkers(ctx context.Context, f *CorrelationFilter) ([]DeployMarker, error) {
+	markers := make([]DeployMarker, 0)
+
+	if err := f.CH().NewSelect().
+		ColumnExpr("? AS version", chColumn(xattr.ServiceVersion)).
+		ColumnExpr("min(`span.time`) AS first_seen").
+		ColumnExpr("max(`span.time`) AS last_seen").
+		Model((*SpanIndex)(nil)).
+		Apply(f.whereClause).
+		Where("has(attr_keys, ?)", xattr.ServiceVersion).
+		GroupExpr("version").
+		Having("first_seen >= ?", f.TimeGTE.Add(time.Minute)).
+		OrderExpr("first_seen ASC").
+		Limit(20).
+		Scan(ctx, &markers); err != nil {
+		return nil, err
+	}
+
+	return markers, nil
+}
+
+func zeroNaN(n float64) float64 {
+	if math.IsNaN(n) {
+		return 0
+	}
+	return n
+}
+
+//------------------------------------------------------------------------------
+
+// Correlate returns traces, logs, metric anomalies, and deploys of the service
+// in the time range.
+func (h *ServiceHandler) Correlate(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	f, err := DecodeCorrelationFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+
+	var traces []CorrelatedTrace
+	var logs []CorrelatedLog
+	var anomalies []MetricAnomaly
+	var deploys []DeployMarker
+
+	var group syncutil.Group
+
+	group.Go(func() (err error) {
+		traces, err = selectCorrelatedTraces(ctx, f)
+		return err
+	})
+	group.Go(func() (err error) {
+		logs, err = selectCorrelatedLogs(ctx, f)
+		return err
+	})
+	group.Go(func() (err error) {
+		anomalies, err = selectMetricAnomalies(ctx, f)
+		return err
+	})
+	group.Go(func() (err error) {
+		deploys, err = selectDeployMarkers(ctx, f)
+		return err
+	})
+
+	if err := group.Err(); err != nil {
+		return err
+	}
+
+	policy := attrPolicyFromContext(ctx, h.App)
+	for i := range logs {
+		log := &logs[i]
+		log.LogMessage = restrictString(policy, xattr.LogMessage, log.LogMessage)
+		log.ExceptionMessage = restrictString(policy, xattr.ExceptionMessage, log.ExceptionMessage)
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"traces":    traces,
+		"logs":      logs,
+		"anomalies": anomalies,
+		"deploys":   deploys,
+	})
+}
@@ -0,0 +1,203 @@
+package tracing
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"golang.org/x/exp/maps"
+)
+
+// datadogSpan is a span of the Datadog trace agent v0.4 API. Payloads are arrays
+// of traces and each trace is an array of spans.
+type datadogSpan struct {
+	Service  string             `msgpack:"service" json:"service"`
+	Name     string             `msgpack:"name" json:"name"`
+	Resource string             `msgpack:"resource" json:"resource"`
+	TraceID  uint64             `msgpack:"trace_id" json:"trace_id"`
+	SpanID   uint64             `msgpack:"span_id" json:"span_id"`
+	ParentID uint64             `msgpack:"parent_id" json:"parent_id"`
+	Start    int64              `msgpack:"start" json:"start"`
+	Duration int64              `msgpack:"duration" json:"duration"`
+	Error    int32              `msgpack:"error" json:"error"`
+	Meta     map[string]string  `msgpack:"meta" json:"meta"`
+	Metrics  map[string]float64 `msgpack:"metrics" json:"metrics"`
+	Type     string             `msgpack:"type" json:"type"`
+}
+
+// datadogResourceMeta are meta keys that describe the service.
+var datadogResourceMeta = map[string]string{
+	"env":      xattr.DeploymentEnvironment,
+	"version":  xattr.ServiceVersion,
+	"language": "telemetry.sdk.language",
+}
+
+// datadogMetaKeys maps Datadog tags to OpenTelemetry semantic conventions.
+var datadogMetaKeys = map[string]string{
+	"sql.query":     xattr.DBStatement,
+	"db.type":       xattr.DBSystem,
+	"db.instance":   "db.name",
+	"db.user":       "db.user",
+	"out.host":      "net.peer.name",
+	"out.port":      "net.peer.port",
+	"error.msg":     xattr.ExceptionMessage,
+	"error.message": xattr.ExceptionMessage,
+	"error.type":    xattr.ExceptionType,
+	"error.stack":   xattr.ExceptionStacktrace,
+}
+
+// datadogResourceSpans converts the traces to OTLP grouping spans by the service,
+// env, and version.
+func datadogResourceSpans(traces [][]*datadogSpan) []*tracepb.ResourceSpans {
+	var resourceSpans []*tracepb.ResourceSpans
+	index := make(map[string]int)
+
+	for _, trace := range traces {
+		for _, src := range trace {
+			resource := datadogResource(src)
+
+			var key strings.Builder
+			for _, kv := range resource.Attributes {
+				key.WriteString(kv.Key + "=" + kv.Value.GetStringValue() + "\n")
+			}
+
+			idx, ok := index[key.String()]
+			if !ok {
+				idx = len(resourceSpans)
+				index[key.String()] = idx
+				resourceSpans = append(resourceSpans, &tracepb.ResourceSpans{
+					Resource:                    resource,
+					InstrumentationLibrarySpans: []*tracepb.InstrumentationLibrarySpans{{}},
+				})
+			}
+
+			ils := resourceSpans[idx].InstrumentationLibrarySpans[0]
+			ils.Spans = append(ils.Spans, datadogOTLPSpan(src))
+		}
+	}
+
+	return resourceSpans
+}
+
+func datadogResource(src *datadogSpan) *resourcepb.Resource {
+	attrs := make([]*commonpb.KeyValue, 0, 1+len(datadogResourceMeta))
+	if src.Service != "" {
+		attrs = append(attrs, otlpStringAttr(xattr.ServiceName, src.Service))
+	}
+	for _, metaKey := range []string{"env", "version", "language"} {
+		if value := src.Meta[metaKey]; value != "" {
+			attrs = append(attrs, otlpStringAttr(datadogResourceMeta[metaKey], value))
+		}
+	}
+	return &resourcepb.Resource{Attributes: attrs}
+}
+
+func datadogOTLPSpan(src *datadogSpan) *tracepb.Span {
+	span := &tracepb.Span{
+		TraceId:           datadogTraceID(src.TraceID, src.Meta["_dd.p.tid"]),
+		SpanId:            datadogSpanID(src.SpanID),
+		Name:              src.Resource,
+		Kind:              datadogSpanKind(src),
+		StartTimeUnixNano: uint64(src.Start),
+		EndTimeUnixNano:   uint64(src.Start + src.Duration),
+		Status:            &tracepb.Status{},
+	}
+	if span.Name == "" {
+		span.Name = src.Name
+	}
+	if src.ParentID != 0 {
+		span.ParentSpanId = datadogSpanID(src.ParentID)
+	}
+	if src.Error != 0 {
+		span.Status.Code = tracepb.Status_STATUS_CODE_ERROR
+		span.Status.Message = src.Meta["error.msg"]
+	}
+
+	span.Attributes = make([]*commonpb.KeyValue, 0, 2+len(src.Meta)+len(src.Metrics))
+	if src.Name != "" {
+		span.Attributes = append(span.Attributes, otlpStringAttr("dd.operation_name", src.Name))
+	}
+	if src.Type != "" {
+		span.Attributes = append(span.Attributes, otlpStringAttr("dd.span_type", src.Type))
+	}
+
+	// Sort keys so attributes don't depend on the map order.
+	metaKeys := maps.Keys(src.Meta)
+	sort.Strings(metaKeys)
+	for _, key := range metaKeys {
+		value := src.Meta[key]
+		if strings.HasPrefix(key, "_") || key == "span.kind" {
+			continue
+		}
+		if _, ok := datadogResourceMeta[key]; ok {
+			continue
+		}
+		if attrKey, ok := datadogMetaKeys[key]; ok {
+			key = attrKey
+		}
+		if key == xattr.HTTPStatusCode || key == "net.peer.port" {
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+				span.Attributes = append(span.Attributes, otlpIntAttr(key, n))
+				continue
+			}
+		}
+		span.Attributes = append(span.Attributes, otlpStringAttr(key, value))
+	}
+
+	metricKeys := maps.Keys(src.Metrics)
+	sort.Strings(metricKeys)
+	for _, key := range metricKeys {
+		value := src.Metrics[key]
+		// Internal metrics, for example, _sampling_priority_v1 and _dd.measured.
+		if strings.HasPrefix(key, "_") {
+			continue
+		}
+		if value == float64(int64(value)) {
+			span.Attributes = append(span.Attributes, otlpIntAttr(key, int64(value)))
+			continue
+		}
+		span.Attributes = append(span.Attributes, otlpDoubleAttr(key, value))
+	}
+
+	return span
+}
+
+// datadogTraceID uses _dd.p.tid as the high 64 bits of 128-bit trace ids.
+func datadogTraceID(low uint64, tid string) []byte {
+	b := make([]byte, 16)
+	if high, err := hex.DecodeString(tid); err == nil && len(high) == 8 {
+		copy(b, high)
+	}
+	binary.BigEndian.PutUint64(b[8:], low)
+	return b
+}
+
+func datadogSpanID(id uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, id)
+	return b
+}
+
+func datadogSpanKind(src *datadogSpan) tracepb.Span_SpanKind {
+	if kind := src.Meta["span.kind"]; kind != "" {
+		return jaegerSpanKind(kind)
+	}
+
+	switch src.Type {
+	case "web":
+		return tracepb.Span_SPAN_KIND_SERVER
+	case "http", "grpc", "sql", "db", "cache", "redis", "memcached", "mongodb",
+		"cassandra", "elasticsearch":
+		return tracepb.Span_SPAN_KIND_CLIENT
+	case "worker", "queue":
+		return tracepb.Span_SPAN_KIND_CONSUMER
+	default:
+		return tracepb.Span_SPAN_KIND_INTERNAL
+	}
+}
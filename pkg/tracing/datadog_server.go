@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/org"
+	"github.com/vmihailenco/msgpack"
+)
+
+// DatadogServer implements the trace endpoints of the Datadog agent so dd-trace
+// libraries can send spans to Uptrace by setting DD_TRACE_AGENT_URL.
+type DatadogServer struct {
+	*bunapp.App
+
+	traceService *TraceServiceServer
+}
+
+func NewDatadogServer(app *bunapp.App, traceService *TraceServiceServer) *DatadogServer {
+	return &DatadogServer{
+		App:          app,
+		traceService: traceService,
+	}
+}
+
+// project uses the uptrace-dsn header when it is set, because dd-trace libraries
+// don't send custom headers.
+func (s *DatadogServer) project(ctx context.Context, dsn string) (*bunapp.Project, error) {
+	if dsn != "" {
+		return org.SelectProjectByDSN(ctx, s.App, dsn)
+	}
+	projectID := s.Config().Datadog.ProjectID
+	if projectID == 0 {
+		return nil, errors.New("uptrace-dsn header or datadog.project_id option is required")
+	}
+	return org.SelectIngestProjectByID(ctx, s.App, projectID)
+}
+
+// Traces accepts v0.3 and v0.4 payloads encoded with MessagePack or JSON.
+func (s *DatadogServer) Traces(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	project, err := s.project(ctx, org.IngestDSN(req.Request))
+	if err != nil {
+		return err
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+
+	var traces [][]*datadogSpan
+
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch contentType {
+	case "application/json", "text/json":
+		if err := json.Unmarshal(body, &traces); err != nil {
+			return err
+		}
+	default:
+		if err := msgpack.Unmarshal(body, &traces); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.traceService.process(project, datadogResourceSpans(traces)); err != nil {
+		return err
+	}
+
+	// Clients use the rates to adjust sampling. Empty rates keep the defaults.
+	return httputil.JSON(w, bunrouter.H{
+		"rate_by_service": bunrouter.H{},
+	})
+}
@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func TestDatadogResourceSpans(t *testing.T) {
+	b, err := msgpack.Marshal([][]map[string]any{{
+		{
+			"service":   "web",
+			"name":      "http.request",
+			"resource":  "GET /users/:id",
+			"trace_id":  uint64(0x0102030405060708),
+			"span_id":   uint64(1),
+			"parent_id": uint64(0),
+			"start":     int64(1e18),
+			"duration":  int64(5e6),
+			"error":     int32(1),
+			"type":      "web",
+			"meta": map[string]string{
+				"env":              "prod",
+				"http.status_code": "500",
+				"error.msg":        "boom",
+				"_dd.p.tid":        "640cfd8d00000000",
+			},
+			"metrics": map[string]any{
+				"_sampling_priority_v1": 1,
+				"rows":                  int64(3),
+				"ratio":                 0.5,
+			},
+		},
+		{
+			"service":   "postgres",
+			"name":      "postgres.query",
+			"resource":  "SELECT 1",
+			"trace_id":  uint64(0x0102030405060708),
+			"span_id":   uint64(2),
+			"parent_id": uint64(1),
+			"start":     int64(1e18 + 1e6),
+			"duration":  int64(1e6),
+			"type":      "sql",
+			"meta":      map[string]string{"sql.query": "SELECT 1", "out.port": "5432"},
+		},
+	}})
+	require.NoError(t, err)
+
+	var traces [][]*datadogSpan
+	require.NoError(t, msgpack.Unmarshal(b, &traces))
+
+	rss := datadogResourceSpans(traces)
+	require.Len(t, rss, 2)
+
+	resource := otlpAttrs(rss[0].Resource.Attributes)
+	require.Equal(t, "web", resource.ServiceName())
+	require.Equal(t, "prod", resource.Text("deployment.environment"))
+
+	span := rss[0].InstrumentationLibrarySpans[0].Spans[0]
+	require.Equal(t, "GET /users/:id", span.Name)
+	require.Equal(t, tracepb.Span_SPAN_KIND_SERVER, span.Kind)
+	require.Equal(t, "640cfd8d-0000-0000-0102-030405060708", otlpTraceID(span.TraceId).String())
+	require.Nil(t, span.ParentSpanId)
+	require.Equal(t, uint64(1e18+5e6), span.EndTimeUnixNano)
+	require.Equal(t, tracepb.Status_STATUS_CODE_ERROR, span.Status.Code)
+	require.Equal(t, "boom", span.Status.Message)
+
+	attrs := otlpAttrs(span.Attributes)
+	require.Equal(t, "http.request", attrs.Text("dd.operation_name"))
+	require.Equal(t, int64(500), attrs["http.status_code"])
+	require.Equal(t, "boom", attrs.Text("exception.message"))
+	require.Equal(t, int64(3), attrs["rows"])
+	require.Equal(t, 0.5, attrs["ratio"])
+	require.False(t, attrs.Has("_sampling_priority_v1"))
+	require.False(t, attrs.Has("_dd.p.tid"))
+	require.False(t, attrs.Has("env"))
+
+	span = rss[1].InstrumentationLibrarySpans[0].Spans[0]
+	require.Equal(t, tracepb.Span_SPAN_KIND_CLIENT, span.Kind)
+	require.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 1}, span.ParentSpanId)
+	attrs = otlpAttrs(span.Attributes)
+	require.Equal(t, "SELECT 1", attrs.Text("db.statement"))
+	require.Equal(t, int64(5432), attrs["net.peer.port"])
+}
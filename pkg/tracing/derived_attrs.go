@@ -0,0 +1,38 @@
+package tracing
+
+import (
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+// applyDerivedAttrs computes the project derived_attrs before the span is indexed.
+// Attributes derived earlier can be used as the source of later ones.
+func applyDerivedAttrs(project *bunapp.Project, span *Span) {
+	for i := range project.DerivedAttrs {
+		attr := &project.DerivedAttrs[i]
+		if span.Attrs.Has(attr.Name) {
+			continue
+		}
+
+		src, ok := derivedAttrSource(span, attr.From)
+		if !ok {
+			continue
+		}
+		if value, ok := attr.Eval(src); ok {
+			span.Attrs[attr.Name] = value
+		}
+	}
+}
+
+func derivedAttrSource(span *Span, from string) (any, bool) {
+	switch from {
+	case "span.name":
+		return span.Name, true
+	case "span.kind":
+		return span.Kind, true
+	case "span.duration":
+		return span.Duration, true
+	default:
+		value, ok := span.Attrs[from]
+		return value, ok
+	}
+}
@@ -0,0 +1,560 @@
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// Elastic APM intake v2 events. Requests are newline-delimited JSON objects where
+// the first object is the metadata and each following object holds one of
+// transaction, span, or error. Times are microseconds since the epoch and durations
+// are milliseconds.
+
+type elasticEvent struct {
+	Metadata    *elasticMetadata    `json:"metadata"`
+	Transaction *elasticTransaction `json:"transaction"`
+	Span        *elasticSpan        `json:"span"`
+	Error       *elasticError       `json:"error"`
+}
+
+type elasticMetadata struct {
+	Service struct {
+		Name        string `json:"name"`
+		Version     string `json:"version"`
+		Environment string `json:"environment"`
+		Language    struct {
+			Name string `json:"name"`
+		} `json:"language"`
+		Agent struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"agent"`
+	} `json:"service"`
+	System struct {
+		Hostname           string `json:"hostname"`
+		DetectedHostname   string `json:"detected_hostname"`
+		ConfiguredHostname string `json:"configured_hostname"`
+	} `json:"system"`
+	Process struct {
+		Pid int64 `json:"pid"`
+	} `json:"process"`
+	Labels map[string]any `json:"labels"`
+}
+
+type elasticTransaction struct {
+	ID        string          `json:"id"`
+	TraceID   string          `json:"trace_id"`
+	ParentID  string          `json:"parent_id"`
+	Name      string          `json:"name"`
+	Type      string          `json:"type"`
+	Timestamp int64           `json:"timestamp"`
+	Duration  float64         `json:"duration"`
+	Result    string          `json:"result"`
+	Outcome   string          `json:"outcome"`
+	Context   *elasticContext `json:"context"`
+}
+
+type elasticSpan struct {
+	ID            string  `json:"id"`
+	TraceID       string  `json:"trace_id"`
+	ParentID      string  `json:"parent_id"`
+	TransactionID string  `json:"transaction_id"`
+	Name          string  `json:"name"`
+	Type          string  `json:"type"`
+	Subtype       string  `json:"subtype"`
+	Action        string  `json:"action"`
+	Timestamp     int64   `json:"timestamp"`
+	Start         float64 `json:"start"`
+	Duration      float64 `json:"duration"`
+	Outcome       string  `json:"outcome"`
+	Context       *struct {
+		DB *struct {
+			Instance  string `json:"instance"`
+			Statement string `json:"statement"`
+			Type      string `json:"type"`
+			User      string `json:"user"`
+		} `json:"db"`
+		HTTP *struct {
+			URL        string `json:"url"`
+			Method     string `json:"method"`
+			StatusCode int64  `json:"status_code"`
+		} `json:"http"`
+		Destination *struct {
+			Address string `json:"address"`
+			Port    int64  `json:"port"`
+		} `json:"destination"`
+		Message *struct {
+			Queue *struct {
+				Name string `json:"name"`
+			} `json:"queue"`
+		} `json:"message"`
+		Tags map[string]any `json:"tags"`
+	} `json:"context"`
+}
+
+type elasticContext struct {
+	Request *struct {
+		Method string `json:"method"`
+		URL    struct {
+			Full     string `json:"full"`
+			Pathname string `json:"pathname"`
+		} `json:"url"`
+	} `json:"request"`
+	Response *struct {
+		StatusCode int64 `json:"status_code"`
+	} `json:"response"`
+	User *struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Tags map[string]any `json:"tags"`
+}
+
+type elasticError struct {
+	ID            string          `json:"id"`
+	TraceID       string          `json:"trace_id"`
+	ParentID      string          `json:"parent_id"`
+	TransactionID string          `json:"transaction_id"`
+	Timestamp     int64           `json:"timestamp"`
+	Culprit       string          `json:"culprit"`
+	Context       *elasticContext `json:"context"`
+	Exception     *struct {
+		Message    string              `json:"message"`
+		Type       string              `json:"type"`
+		Module     string              `json:"module"`
+		Stacktrace []elasticStackFrame `json:"stacktrace"`
+	} `json:"exception"`
+	Log *struct {
+		Message string `json:"message"`
+		Level   string `json:"level"`
+	} `json:"log"`
+}
+
+type elasticStackFrame struct {
+	Filename string `json:"filename"`
+	AbsPath  string `json:"abs_path"`
+	Function string `json:"function"`
+	Module   string `json:"module"`
+	Lineno   int    `json:"lineno"`
+}
+
+// parseElasticEvents decodes the ndjson body. Unknown events, for example,
+// metricsets, are skipped.
+func parseElasticEvents(b []byte) (*elasticMetadata, []*elasticEvent, error) {
+	var metadata *elasticMetadata
+	var events []*elasticEvent
+
+	for len(b) > 0 {
+		var line []byte
+		line, b = readLine(b)
+		if line = bytes.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+
+		event := new(elasticEvent)
+		if err := json.Unmarshal(line, event); err != nil {
+			return nil, nil, fmt.Errorf("elastic: event #%d: %w", len(events), err)
+		}
+
+		if event.Metadata != nil {
+			metadata = event.Metadata
+			continue
+		}
+		events = append(events, event)
+	}
+
+	if metadata == nil {
+		return nil, nil, errors.New("elastic: metadata is missing")
+	}
+	return metadata, events, nil
+}
+
+//------------------------------------------------------------------------------
+
+func elasticResourceSpans(
+	metadata *elasticMetadata, events []*elasticEvent,
+) (*tracepb.ResourceSpans, error) {
+	// Span start offsets are relative to the transaction.
+	txTimes := make(map[string]int64)
+	for _, event := range events {
+		if tx := event.Transaction; tx != nil {
+			txTimes[tx.ID] = tx.Timestamp
+		}
+	}
+
+	spans := make([]*tracepb.Span, 0, len(events))
+	for _, event := range events {
+		var span *tracepb.Span
+		var err error
+
+		switch {
+		case event.Transaction != nil:
+			span, err = elasticTransactionSpan(event.Transaction)
+		case event.Span != nil:
+			span, err = elasticSpanSpan(event.Span, txTimes)
+		case event.Error != nil:
+			span, err = elasticErrorSpan(event.Error)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		spans = append(spans, span)
+	}
+
+	lib := &commonpb.InstrumentationLibrary{
+		Name:    metadata.Service.Agent.Name,
+		Version: metadata.Service.Agent.Version,
+	}
+	return &tracepb.ResourceSpans{
+		Resource: elasticResource(metadata),
+		InstrumentationLibrarySpans: []*tracepb.InstrumentationLibrarySpans{{
+			InstrumentationLibrary: lib,
+			Spans:                  spans,
+		}},
+	}, nil
+}
+
+func elasticResource(metadata *elasticMetadata) *resourcepb.Resource {
+	service := &metadata.Service
+	attrs := []*commonpb.KeyValue{
+		otlpStringAttr(xattr.ServiceName, service.Name),
+	}
+	if service.Version != "" {
+		attrs = append(attrs, otlpStringAttr(xattr.ServiceVersion, service.Version))
+	}
+	if service.Environment != "" {
+		attrs = append(attrs, otlpStringAttr(xattr.DeploymentEnvironment, service.Environment))
+	}
+	if service.Language.Name != "" {
+		attrs = append(attrs, otlpStringAttr(xattr.TelemetrySDKLanguage,
+			strings.ToLower(service.Language.Name)))
+	}
+
+	system := &metadata.System
+	for _, hostname := range []string{
+		system.ConfiguredHostname, system.DetectedHostname, system.Hostname,
+	} {
+		if hostname != "" {
+			attrs = append(attrs, otlpStringAttr(xattr.HostName, hostname))
+			break
+		}
+	}
+	if metadata.Process.Pid != 0 {
+		attrs = append(attrs, otlpIntAttr("process.pid", metadata.Process.Pid))
+	}
+	for key, value := range metadata.Labels {
+		attrs = append(attrs, otlpAnyAttr(key, value))
+	}
+
+	return &resourcepb.Resource{Attributes: attrs}
+}
+
+func elasticTransactionSpan(tx *elasticTransaction) (*tracepb.Span, error) {
+	span, err := newElasticSpan(tx.TraceID, tx.ID, tx.ParentID)
+	if err != nil {
+		return nil, err
+	}
+
+	span.Name = tx.Name
+	span.StartTimeUnixNano = elasticTime(tx.Timestamp)
+	span.EndTimeUnixNano = span.StartTimeUnixNano + elasticDuration(tx.Duration)
+	span.Status = elasticStatus(tx.Outcome)
+
+	switch tx.Type {
+	case "request":
+		span.Kind = tracepb.Span_SPAN_KIND_SERVER
+	case "messaging":
+		span.Kind = tracepb.Span_SPAN_KIND_CONSUMER
+	default:
+		span.Kind = tracepb.Span_SPAN_KIND_INTERNAL
+	}
+
+	span.Attributes = append(span.Attributes, otlpStringAttr("elastic.transaction.type", tx.Type))
+	if tx.Result != "" {
+		span.Attributes = append(span.Attributes, otlpStringAttr("elastic.transaction.result", tx.Result))
+	}
+	span.Attributes = elasticContextAttrs(span.Attributes, tx.Context)
+
+	return span, nil
+}
+
+func elasticSpanSpan(src *elasticSpan, txTimes map[string]int64) (*tracepb.Span, error) {
+	parentID := src.ParentID
+	if parentID == "" {
+		parentID = src.TransactionID
+	}
+
+	span, err := newElasticSpan(src.TraceID, src.ID, parentID)
+	if err != nil {
+		return nil, err
+	}
+
+	span.Name = src.Name
+	if src.Timestamp != 0 {
+		span.StartTimeUnixNano = elasticTime(src.Timestamp)
+	} else if txTime, ok := txTimes[src.TransactionID]; ok {
+		span.StartTimeUnixNano = elasticTime(txTime) + elasticDuration(src.Start)
+	} else {
+		return nil, fmt.Errorf("elastic: span %s does not have a timestamp", src.ID)
+	}
+	span.EndTimeUnixNano = span.StartTimeUnixNano + elasticDuration(src.Duration)
+	span.Status = elasticStatus(src.Outcome)
+
+	// Older agents send the type as "db.postgresql.query".
+	typ, subtype, action := src.Type, src.Subtype, src.Action
+	if parts := strings.SplitN(typ, ".", 3); len(parts) > 1 && subtype == "" {
+		typ, subtype = parts[0], parts[1]
+		if len(parts) == 3 {
+			action = parts[2]
+		}
+	}
+
+	switch {
+	case typ == "db" || typ == "external" || typ == "cache" || typ == "storage":
+		span.Kind = tracepb.Span_SPAN_KIND_CLIENT
+	case typ == "messaging" && action == "send":
+		span.Kind = tracepb.Span_SPAN_KIND_PRODUCER
+	case typ == "messaging":
+		span.Kind = tracepb.Span_SPAN_KIND_CONSUMER
+	default:
+		span.Kind = tracepb.Span_SPAN_KIND_INTERNAL
+	}
+
+	attrs := span.Attributes
+	attrs = append(attrs, otlpStringAttr("elastic.span.type", typ))
+	if subtype != "" {
+		attrs = append(attrs, otlpStringAttr("elastic.span.subtype", subtype))
+	}
+	if action != "" {
+		attrs = append(attrs, otlpStringAttr("elastic.span.action", action))
+	}
+
+	if ctx := src.Context; ctx != nil {
+		if db := ctx.DB; db != nil {
+			if typ == "db" && subtype != "" {
+				attrs = append(attrs, otlpStringAttr(xattr.DBSystem, subtype))
+			}
+			if db.Statement != "" {
+				attrs = append(attrs, otlpStringAttr(xattr.DBStatement, db.Statement))
+			}
+			if db.Instance != "" {
+				attrs = append(attrs, otlpStringAttr("db.name", db.Instance))
+			}
+			if db.User != "" {
+				attrs = append(attrs, otlpStringAttr("db.user", db.User))
+			}
+		}
+		if http := ctx.HTTP; http != nil {
+			if http.Method != "" {
+				attrs = append(attrs, otlpStringAttr(xattr.HTTPMethod, http.Method))
+			}
+			if http.URL != "" {
+				attrs = append(attrs, otlpStringAttr(xattr.HTTPURL, http.URL))
+			}
+			if http.StatusCode != 0 {
+				attrs = append(attrs, otlpIntAttr(xattr.HTTPStatusCode, http.StatusCode))
+			}
+		}
+		if dest := ctx.Destination; dest != nil {
+			if dest.Address != "" {
+				attrs = append(attrs, otlpStringAttr("net.peer.name", dest.Address))
+			}
+			if dest.Port != 0 {
+				attrs = append(attrs, otlpIntAttr("net.peer.port", dest.Port))
+			}
+		}
+		if msg := ctx.Message; msg != nil && msg.Queue != nil && msg.Queue.Name != "" {
+			attrs = append(attrs, otlpStringAttr(xattr.MessagingDestination, msg.Queue.Name))
+		}
+		for key, value := range ctx.Tags {
+			attrs = append(attrs, otlpAnyAttr(key, value))
+		}
+	}
+	span.Attributes = attrs
+
+	return span, nil
+}
+
+// elasticErrorSpan converts the error to a span with an exception or a log event
+// like Sentry events.
+func elasticErrorSpan(src *elasticError) (*tracepb.Span, error) {
+	parentID := src.ParentID
+	if parentID == "" {
+		parentID = src.TransactionID
+	}
+
+	traceID := src.TraceID
+	if traceID == "" {
+		// Errors outside of transactions become single-span traces.
+		traceID = src.ID
+	}
+
+	span, err := newElasticSpan(traceID, "", parentID)
+	if err != nil {
+		return nil, err
+	}
+
+	tm := elasticTime(src.Timestamp)
+	span.Name = src.Culprit
+	if span.Name == "" {
+		span.Name = "elastic.error"
+	}
+	span.Kind = tracepb.Span_SPAN_KIND_INTERNAL
+	span.StartTimeUnixNano = tm
+	span.EndTimeUnixNano = tm
+	span.Status = &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR}
+	span.Attributes = append(span.Attributes, otlpStringAttr("elastic.error.id", src.ID))
+	span.Attributes = elasticContextAttrs(span.Attributes, src.Context)
+
+	if exc := src.Exception; exc != nil {
+		typ := exc.Type
+		if exc.Module != "" && !strings.Contains(typ, ".") {
+			typ = exc.Module + "." + typ
+		}
+		span.Events = append(span.Events, &tracepb.Span_Event{
+			Name:         exceptionEventType,
+			TimeUnixNano: tm,
+			Attributes: []*commonpb.KeyValue{
+				otlpStringAttr(xattr.ExceptionType, typ),
+				otlpStringAttr(xattr.ExceptionMessage, exc.Message),
+				otlpStringAttr(xattr.ExceptionStacktrace, elasticStacktrace(exc.Stacktrace)),
+			},
+		})
+	} else if log := src.Log; log != nil {
+		span.Events = append(span.Events, &tracepb.Span_Event{
+			Name:         logEventType,
+			TimeUnixNano: tm,
+			Attributes: []*commonpb.KeyValue{
+				otlpStringAttr(xattr.LogSeverity, sentryLevel(log.Level)),
+				otlpStringAttr(xattr.LogMessage, log.Message),
+			},
+		})
+	}
+
+	return span, nil
+}
+
+// newElasticSpan creates a span with the decoded ids. A random span id is used
+// when id is empty.
+func newElasticSpan(traceID, id, parentID string) (*tracepb.Span, error) {
+	span := new(tracepb.Span)
+
+	var err error
+	if span.TraceId, err = elasticID(traceID, 16); err != nil {
+		return nil, err
+	}
+	if id != "" {
+		if span.SpanId, err = elasticID(id, 8); err != nil {
+			return nil, err
+		}
+	} else {
+		span.SpanId = make([]byte, 8)
+		_, _ = rand.Read(span.SpanId)
+	}
+	if parentID != "" {
+		if span.ParentSpanId, err = elasticID(parentID, 8); err != nil {
+			return nil, err
+		}
+	}
+
+	return span, nil
+}
+
+// elasticID decodes hex ids truncating ids that are longer than size.
+func elasticID(s string, size int) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) < size {
+		return nil, fmt.Errorf("elastic: invalid id: %q", s)
+	}
+	return b[:size], nil
+}
+
+func elasticTime(us int64) uint64 {
+	if us <= 0 {
+		return uint64(time.Now().UnixNano())
+	}
+	return uint64(us) * uint64(time.Microsecond)
+}
+
+func elasticDuration(ms float64) uint64 {
+	if ms <= 0 {
+		return 0
+	}
+	return uint64(ms * float64(time.Millisecond))
+}
+
+func elasticStatus(outcome string) *tracepb.Status {
+	switch outcome {
+	case "failure":
+		return &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR}
+	case "success":
+		return &tracepb.Status{Code: tracepb.Status_STATUS_CODE_OK}
+	default:
+		return &tracepb.Status{}
+	}
+}
+
+func elasticContextAttrs(attrs []*commonpb.KeyValue, ctx *elasticContext) []*commonpb.KeyValue {
+	if ctx == nil {
+		return attrs
+	}
+	if req := ctx.Request; req != nil {
+		if req.Method != "" {
+			attrs = append(attrs, otlpStringAttr(xattr.HTTPMethod, req.Method))
+		}
+		if req.URL.Full != "" {
+			attrs = append(attrs, otlpStringAttr(xattr.HTTPURL, req.URL.Full))
+		}
+		if req.URL.Pathname != "" {
+			attrs = append(attrs, otlpStringAttr(xattr.HTTPTarget, req.URL.Pathname))
+		}
+	}
+	if resp := ctx.Response; resp != nil && resp.StatusCode != 0 {
+		attrs = append(attrs, otlpIntAttr(xattr.HTTPStatusCode, resp.StatusCode))
+	}
+	if user := ctx.User; user != nil && user.ID != "" {
+		attrs = append(attrs, otlpStringAttr(xattr.EnduserID, user.ID))
+	}
+	for key, value := range ctx.Tags {
+		attrs = append(attrs, otlpAnyAttr(key, value))
+	}
+	return attrs
+}
+
+// elasticStacktrace formats frames that are sorted from the most recent call.
+func elasticStacktrace(frames []elasticStackFrame) string {
+	var b strings.Builder
+	for i := range frames {
+		frame := &frames[i]
+
+		fn := frame.Function
+		if frame.Module != "" {
+			fn = frame.Module + "." + fn
+		}
+		filename := frame.AbsPath
+		if filename == "" {
+			filename = frame.Filename
+		}
+
+		b.WriteString(fn)
+		b.WriteString("\n\t")
+		b.WriteString(filename)
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(frame.Lineno))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/org"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// ElasticServer implements the Elastic APM intake v2 API so Elastic APM agents
+// can send transactions, spans, and errors to Uptrace by setting the server URL
+// to listen.http and the secret token to the project DSN.
+type ElasticServer struct {
+	*bunapp.App
+
+	traceService *TraceServiceServer
+}
+
+func NewElasticServer(app *bunapp.App, traceService *TraceServiceServer) *ElasticServer {
+	return &ElasticServer{
+		App:          app,
+		traceService: traceService,
+	}
+}
+
+// project uses the uptrace-dsn header or the secret token that agents send
+// as "Authorization: Bearer <token>".
+func (s *ElasticServer) project(ctx context.Context, req bunrouter.Request) (*bunapp.Project, error) {
+	dsn := org.IngestDSN(req.Request)
+	if dsn == "" {
+		return nil, errors.New("uptrace-dsn header or secret token is required")
+	}
+	return org.SelectProjectByDSN(ctx, s.App, dsn)
+}
+
+func (s *ElasticServer) Events(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	project, err := s.project(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+
+	metadata, events, err := parseElasticEvents(body)
+	if err != nil {
+		return err
+	}
+
+	rs, err := elasticResourceSpans(metadata, events)
+	if err != nil {
+		return err
+	}
+	if _, err := s.traceService.process(project, []*tracepb.ResourceSpans{rs}); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
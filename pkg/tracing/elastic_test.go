@@ -0,0 +1,63 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func TestElasticResourceSpans(t *testing.T) {
+	body := `{"metadata":{"service":{"name":"orders","version":"1.2.0","environment":"prod","language":{"name":"Java"},"agent":{"name":"java","version":"1.30.0"}},"system":{"detected_hostname":"host-1"},"process":{"pid":42}}}
+{"transaction":{"id":"945254c567a5417e","trace_id":"0123456789abcdef0123456789abcdef","name":"GET /orders","type":"request","timestamp":1496170407154000,"duration":32.5,"result":"HTTP 2xx","outcome":"success","context":{"request":{"method":"GET","url":{"full":"http://localhost/orders","pathname":"/orders"}},"response":{"status_code":200}}}}
+{"span":{"id":"0aaaaaaaaaaaaaaa","transaction_id":"945254c567a5417e","trace_id":"0123456789abcdef0123456789abcdef","name":"SELECT FROM orders","type":"db.postgresql.query","start":2.5,"duration":3,"context":{"db":{"statement":"SELECT * FROM orders","instance":"shop"},"destination":{"address":"db","port":5432}}}}
+{"metricset":{"samples":{}}}
+{"error":{"id":"9876543210abcdef9876543210abcdef","transaction_id":"945254c567a5417e","trace_id":"0123456789abcdef0123456789abcdef","parent_id":"945254c567a5417e","timestamp":1496170407155000,"culprit":"OrderController.list","exception":{"message":"boom","type":"IllegalStateException","module":"java.lang","stacktrace":[{"function":"list","module":"OrderController","filename":"OrderController.java","lineno":10}]}}}
+`
+	metadata, events, err := parseElasticEvents([]byte(body))
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+
+	rs, err := elasticResourceSpans(metadata, events)
+	require.NoError(t, err)
+
+	resource := otlpAttrs(rs.Resource.Attributes)
+	require.Equal(t, "orders", resource.ServiceName())
+	require.Equal(t, "host-1", resource.Text("host.name"))
+	require.Equal(t, "java", resource.Text("telemetry.sdk.language"))
+	require.Equal(t, "java", rs.InstrumentationLibrarySpans[0].InstrumentationLibrary.Name)
+
+	spans := rs.InstrumentationLibrarySpans[0].Spans
+	require.Len(t, spans, 3)
+
+	tx := spans[0]
+	require.Equal(t, "GET /orders", tx.Name)
+	require.Equal(t, tracepb.Span_SPAN_KIND_SERVER, tx.Kind)
+	require.Equal(t, uint64(1496170407154000000), tx.StartTimeUnixNano)
+	require.Equal(t, uint64(1496170407154000000+32500000), tx.EndTimeUnixNano)
+	require.Equal(t, tracepb.Status_STATUS_CODE_OK, tx.Status.Code)
+	require.Equal(t, int64(200), otlpAttrs(tx.Attributes)["http.status_code"])
+
+	span := spans[1]
+	require.Equal(t, tracepb.Span_SPAN_KIND_CLIENT, span.Kind)
+	require.Equal(t, tx.SpanId, span.ParentSpanId)
+	require.Equal(t, tx.StartTimeUnixNano+2500000, span.StartTimeUnixNano)
+	attrs := otlpAttrs(span.Attributes)
+	require.Equal(t, "postgresql", attrs.Text("db.system"))
+	require.Equal(t, "SELECT * FROM orders", attrs.Text("db.statement"))
+	require.Equal(t, int64(5432), attrs["net.peer.port"])
+
+	errSpan := spans[2]
+	require.Equal(t, "OrderController.list", errSpan.Name)
+	require.Equal(t, tx.SpanId, errSpan.ParentSpanId)
+	require.Equal(t, tracepb.Status_STATUS_CODE_ERROR, errSpan.Status.Code)
+	require.Len(t, errSpan.Events, 1)
+	event := otlpAttrs(errSpan.Events[0].Attributes)
+	require.Equal(t, "java.lang.IllegalStateException", event.Text("exception.type"))
+	require.Equal(t, "OrderController.list\n\tOrderController.java:10\n", event.Text("exception.stacktrace"))
+}
+
+func TestParseElasticEventsWithoutMetadata(t *testing.T) {
+	_, _, err := parseElasticEvents([]byte(`{"transaction":{"id":"945254c567a5417e"}}`))
+	require.Error(t, err)
+}
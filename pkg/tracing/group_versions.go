@@ -0,0 +1,199 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	"github.com/uptrace/uptrace/pkg/urlstruct"
+	"go4.org/syncutil"
+)
+
+type GroupVersionsFilter struct {
+	*bunapp.App `urlstruct:"-"`
+
+	TimeFilter
+
+	ProjectID uint32
+	GroupID   uint64
+	System    string
+}
+
+func DecodeGroupVersionsFilter(app *bunapp.App, req bunrouter.Request) (*GroupVersionsFilter, error) {
+	f := &GroupVersionsFilter{App: app}
+	if err := bunapp.UnmarshalValues(req, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+var _ urlstruct.ValuesUnmarshaler = (*GroupVersionsFilter)(nil)
+
+func (f *GroupVersionsFilter) UnmarshalValues(ctx context.Context, values url.Values) error {
+	if err := f.TimeFilter.UnmarshalValues(ctx, values); err != nil {
+		return err
+	}
+	return nil
+}
+
+// groupClause selects spans of the group ignoring the time range.
+func (f *GroupVersionsFilter) groupClause(q *ch.SelectQuery) *ch.SelectQuery {
+	q = q.Where("project_id = ?", f.ProjectID)
+	if f.System != "" {
+		q = q.Where("`span.system` = ?", f.System)
+	}
+	return q.Where("`span.group_id` = ?", f.GroupID)
+}
+
+func (f *GroupVersionsFilter) whereClause(q *ch.SelectQuery) *ch.SelectQuery {
+	return f.groupClause(q).
+		Where("`span.time` >= ?", f.TimeGTE).
+		Where("`span.time` < ?", f.TimeLT)
+}
+
+//------------------------------------------------------------------------------
+
+// GroupVersion contains occurrences of a span group in a service.version.
+type GroupVersion struct {
+	Version string `json:"version"`
+
+	// Count is the number of occurrences in the time range and Counts are the
+	// same occurrences bucketed by time.
+	Count  float64     `json:"count"`
+	Counts []float64   `json:"counts"`
+	Time   []time.Time `json:"-"`
+
+	// FirstSeen and LastSeen are not limited by the time range so they show
+	// the release that introduced or fixed the error.
+	FirstSeen time.Time `json:"firstSeen" ch:"-"`
+	LastSeen  time.Time `json:"lastSeen" ch:"-"`
+}
+
+type groupVersionSeen struct {
+	Version   string
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+func selectGroupVersions(
+	ctx context.Context, f *GroupVersionsFilter, groupPeriod time.Duration,
+) ([]GroupVersion, error) {
+	versions := make([]GroupVersion, 0)
+
+	subq := f.CH().NewSelect().
+		Model((*SpanIndex)(nil)).
+		ColumnExpr("? AS version", chColumn(xattr.ServiceVersion)).
+		ColumnExpr("toFloat64(sum(`span.count`)) AS count").
+		ColumnExpr("toStartOfInterval(`span.time`, INTERVAL ? minute) AS time",
+			groupPeriod.Minutes()).
+		Apply(f.whereClause).
+		GroupExpr("version, time").
+		OrderExpr("version ASC, time ASC").
+		Limit(100000)
+
+	if err := f.CH().NewSelect().
+		ColumnExpr("s.version AS version").
+		ColumnExpr("sum(s.count) AS count").
+		ColumnExpr("groupArray(s.count) AS counts").
+		ColumnExpr("groupArray(s.time) AS time").
+		TableExpr("(?) AS s", subq).
+		GroupExpr("version").
+		OrderExpr("count DESC").
+		Limit(100).
+		Scan(ctx, &versions); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+func selectGroupVersionsSeen(
+	ctx context.Context, f *GroupVersionsFilter,
+) ([]groupVersionSeen, error) {
+	var seen []groupVersionSeen
+
+	if err := f.CH().NewSelect().
+		Model((*SpanIndex)(nil)).
+		ColumnExpr("? AS version", chColumn(xattr.ServiceVersion)).
+		ColumnExpr("min(`span.time`) AS first_seen").
+		ColumnExpr("max(`span.time`) AS last_seen").
+		Apply(f.groupClause).
+		GroupExpr("version").
+		Limit(1000).
+		Scan(ctx, &seen); err != nil {
+		return nil, err
+	}
+
+	return seen, nil
+}
+
+// mergeGroupVersions fills holes in the time series and orders versions by the
+// time they were first seen.
+func mergeGroupVersions(
+	versions []GroupVersion,
+	seen []groupVersionSeen,
+	gte, lt time.Time,
+	groupPeriod time.Duration,
+) {
+	seenMap := make(map[string]*groupVersionSeen, len(seen))
+	for i := range seen {
+		seenMap[seen[i].Version] = &seen[i]
+	}
+
+	for i := range versions {
+		v := &versions[i]
+		v.Counts = fillOrdered(v.Counts, v.Time, gte, lt, groupPeriod)
+		if s, ok := seenMap[v.Version]; ok {
+			v.FirstSeen = s.FirstSeen
+			v.LastSeen = s.LastSeen
+		}
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].FirstSeen.Before(versions[j].FirstSeen)
+	})
+}
+
+// GroupVersions returns occurrences of the span group, for example, an error,
+// bucketed by time and split by service.version.
+func (h *SpanHandler) GroupVersions(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	f, err := DecodeGroupVersionsFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+
+	groupPeriod := calcGroupPeriod(&f.TimeFilter, 300)
+
+	var versions []GroupVersion
+	var seen []groupVersionSeen
+	var group syncutil.Group
+
+	group.Go(func() (err error) {
+		versions, err = selectGroupVersions(ctx, f, groupPeriod)
+		return err
+	})
+	group.Go(func() (err error) {
+		seen, err = selectGroupVersionsSeen(ctx, f)
+		return err
+	})
+
+	if err := group.Err(); err != nil {
+		return err
+	}
+
+	mergeGroupVersions(versions, seen, f.TimeGTE, f.TimeLT, groupPeriod)
+
+	return httputil.JSON(w, bunrouter.H{
+		"versions": versions,
+		"time":     fillTime(nil, f.TimeGTE, f.TimeLT, groupPeriod),
+	})
+}
@@ -0,0 +1,42 @@
+package tracing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeGroupVersions(t *testing.T) {
+	gte := time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)
+	lt := gte.Add(4 * time.Minute)
+
+	versions := []GroupVersion{
+		{
+			Version: "1.1.0",
+			Count:   3,
+			Counts:  []float64{1, 2},
+			Time:    []time.Time{gte.Add(2 * time.Minute), gte.Add(3 * time.Minute)},
+		},
+		{
+			Version: "1.0.0",
+			Count:   1,
+			Counts:  []float64{1},
+			Time:    []time.Time{gte},
+		},
+	}
+	seen := []groupVersionSeen{
+		{Version: "1.0.0", FirstSeen: gte.Add(-time.Hour), LastSeen: gte},
+		{Version: "1.1.0", FirstSeen: gte.Add(2 * time.Minute), LastSeen: lt},
+	}
+
+	mergeGroupVersions(versions, seen, gte, lt, time.Minute)
+
+	require.Equal(t, "1.0.0", versions[0].Version)
+	require.Equal(t, []float64{1, 0, 0, 0}, versions[0].Counts)
+	require.Equal(t, gte.Add(-time.Hour), versions[0].FirstSeen)
+
+	require.Equal(t, "1.1.0", versions[1].Version)
+	require.Equal(t, []float64{0, 0, 1, 2}, versions[1].Counts)
+	require.Equal(t, lt, versions[1].LastSeen)
+}
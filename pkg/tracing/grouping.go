@@ -0,0 +1,185 @@
+package tracing
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+)
+
+// Attributes that are hashed together with the span system, kind, and name
+// to calculate group ids. See assignSpanSystemAndGroupID and
+// assignEventSystemAndGroupID.
+var (
+	rpcGroupingAttrs = []string{
+		xattr.RPCSystem,
+		xattr.RPCService,
+		xattr.RPCMethod,
+	}
+	messagingGroupingAttrs = []string{
+		xattr.MessagingSystem,
+		xattr.MessagingOperation,
+		xattr.MessagingDestination,
+		xattr.MessagingDestinationKind,
+	}
+	dbGroupingAttrs   = []string{xattr.DBOperation, xattr.DBSqlTable}
+	httpGroupingAttrs = []string{xattr.HTTPMethod, xattr.HTTPRoute}
+	logGroupingAttrs  = []string{
+		xattr.LogSeverity,
+		xattr.LogSource,
+		xattr.LogFilepath,
+	}
+	exceptionGroupingAttrs = []string{xattr.ExceptionType}
+	messageGroupingAttrs   = []string{
+		xattr.RPCSystem,
+		xattr.RPCService,
+		xattr.RPCMethod,
+		"message.type",
+	}
+)
+
+// SpanGrouping explains how the group id of a span was calculated.
+type SpanGrouping struct {
+	// Rule that set the span system and group id, for example, db.
+	Rule        string `json:"rule"`
+	Description string `json:"description"`
+	// Fields that were hashed to calculate the group id. Spans with different
+	// values end up in different groups.
+	Fields []GroupingField `json:"fields"`
+}
+
+type GroupingField struct {
+	Key string `json:"key"`
+	// Value is empty when the hashed value is not stored with the span,
+	// for example, the original name of a log event.
+	Value string `json:"value,omitempty"`
+	Note  string `json:"note,omitempty"`
+}
+
+// spanGrouping reconstructs the grouping rule using the system of the stored span.
+func spanGrouping(span *Span) *SpanGrouping {
+	g := new(SpanGrouping)
+	var attrKeys []string
+	nameStored := true
+
+	typ := span.System
+	if i := strings.IndexByte(typ, ':'); i >= 0 {
+		typ = typ[:i]
+	}
+
+	switch typ {
+	case rpcSpanType:
+		g.Rule = rpcSpanType
+		g.Description = "The span has the rpc.system attribute."
+		attrKeys = rpcGroupingAttrs
+	case messagingSpanType:
+		g.Rule = messagingSpanType
+		g.Description = "The span has the messaging.system attribute."
+		attrKeys = messagingGroupingAttrs
+	case dbSpanType:
+		g.Rule = dbSpanType
+		g.Description = "The span has the db.system attribute."
+		attrKeys = dbGroupingAttrs
+		// The span name is replaced with the statement.
+		nameStored = !span.Attrs.Has(xattr.DBStatement)
+	case httpSpanType:
+		g.Rule = httpSpanType
+		g.Description = "The span has the http.route or http.target attribute."
+		attrKeys = httpGroupingAttrs
+	case serviceSpanType:
+		g.Rule = serviceSpanType
+		g.Description = "The span is a root span or its kind is not internal."
+	case internalSpanType:
+		g.Rule = internalSpanType
+		g.Description = "The span is an internal span with a parent."
+	case logEventType:
+		g.Rule = logEventType
+		g.Description = "The event is a log event."
+		attrKeys = logGroupingAttrs
+		nameStored = false
+	case exceptionEventType:
+		g.Rule = exceptionEventType
+		g.Description = "The event is an exception or error event."
+		attrKeys = exceptionGroupingAttrs
+		nameStored = false
+	case crashEventType, anrEventType:
+		g.Rule = typ
+		g.Description = "The event is a crash or ANR of a mobile app."
+		attrKeys = exceptionGroupingAttrs
+		nameStored = false
+	case messageEventType:
+		g.Rule = messageEventType
+		g.Description = "The event is a message event of an RPC or messaging system."
+		attrKeys = messageGroupingAttrs
+		nameStored = false
+	default:
+		g.Rule = eventType
+		g.Description = "The event does not match any other rule."
+	}
+
+	g.Fields = append(g.Fields,
+		GroupingField{Key: "span.system", Value: span.System},
+		GroupingField{Key: "span.kind", Value: span.Kind},
+	)
+
+	name := GroupingField{Key: "span.name"}
+	if span.EventName != "" {
+		name.Key = "span.event_name"
+	}
+	switch {
+	case !nameStored:
+		name.Note = "the original name is not stored"
+	case span.EventName != "":
+		name.Value = span.EventName
+	default:
+		name.Value = span.Name
+	}
+	g.Fields = append(g.Fields, name)
+
+	if env, _ := span.Attrs[xattr.DeploymentEnvironment].(string); env != "" {
+		g.Fields = append(g.Fields, GroupingField{Key: xattr.DeploymentEnvironment, Value: env})
+	}
+
+	for _, key := range attrKeys {
+		if value, ok := span.Attrs[key]; ok {
+			g.Fields = append(g.Fields, GroupingField{Key: key, Value: fmt.Sprint(value)})
+		}
+	}
+
+	switch g.Rule {
+	case dbSpanType:
+		if s := span.Attrs.Text(xattr.DBStatement); s != "" {
+			g.Fields = append(g.Fields, GroupingField{
+				Key:   xattr.DBStatement,
+				Value: s,
+				Note:  "only SQL keywords are hashed",
+			})
+		}
+	case logEventType:
+		g.appendMessage(span, xattr.LogMessage)
+	case exceptionEventType:
+		g.appendMessage(span, xattr.ExceptionMessage)
+	case crashEventType, anrEventType:
+		if frame := topStackFrame(span.Attrs.Text(xattr.ExceptionStacktrace)); frame != "" {
+			g.Fields = append(g.Fields, GroupingField{
+				Key:   xattr.ExceptionStacktrace,
+				Value: frame,
+				Note:  "only the top stack frame is hashed",
+			})
+		} else {
+			g.appendMessage(span, xattr.ExceptionMessage)
+		}
+	}
+
+	return g
+}
+
+func (g *SpanGrouping) appendMessage(span *Span, key string) {
+	if s := span.Attrs.Text(key); s != "" {
+		g.Fields = append(g.Fields, GroupingField{
+			Key:   key,
+			Value: s,
+			Note:  "only words are hashed, numbers and ids are ignored",
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+)
+
+func TestSpanGrouping(t *testing.T) {
+	g := spanGrouping(&Span{
+		System: "db:postgresql",
+		Kind:   clientSpanKind,
+		Name:   "SELECT * FROM users WHERE id = 1",
+		Attrs: AttrMap{
+			xattr.DBSystem:    "postgresql",
+			xattr.DBStatement: "SELECT * FROM users WHERE id = 1",
+			xattr.DBSqlTable:  "users",
+		},
+	})
+	require.Equal(t, dbSpanType, g.Rule)
+	require.Equal(t, []GroupingField{
+		{Key: "span.system", Value: "db:postgresql"},
+		{Key: "span.kind", Value: clientSpanKind},
+		{Key: "span.name", Note: "the original name is not stored"},
+		{Key: xattr.DBSqlTable, Value: "users"},
+		{
+			Key:   xattr.DBStatement,
+			Value: "SELECT * FROM users WHERE id = 1",
+			Note:  "only SQL keywords are hashed",
+		},
+	}, g.Fields)
+
+	g = spanGrouping(&Span{
+		System: "http:api",
+		Kind:   serverSpanKind,
+		Name:   "GET /users/:id",
+		Attrs: AttrMap{
+			xattr.DeploymentEnvironment: "prod",
+			xattr.HTTPMethod:            "GET",
+			xattr.HTTPRoute:             "/users/:id",
+			xattr.HTTPTarget:            "/users/123",
+		},
+	})
+	require.Equal(t, httpSpanType, g.Rule)
+	require.Equal(t, []GroupingField{
+		{Key: "span.system", Value: "http:api"},
+		{Key: "span.kind", Value: serverSpanKind},
+		{Key: "span.name", Value: "GET /users/:id"},
+		{Key: xattr.DeploymentEnvironment, Value: "prod"},
+		{Key: xattr.HTTPMethod, Value: "GET"},
+		{Key: xattr.HTTPRoute, Value: "/users/:id"},
+	}, g.Fields)
+
+	g = spanGrouping(&Span{System: eventType, EventName: "cache.miss", Attrs: AttrMap{}})
+	require.Equal(t, eventType, g.Rule)
+	require.Equal(t, GroupingField{Key: "span.event_name", Value: "cache.miss"}, g.Fields[2])
+}
+
+func TestSpanRegrouper(t *testing.T) {
+	regrouper := NewSpanRegrouper(context.Background(), new(bunapp.ServiceGrouping))
+
+	span := &Span{
+		ProjectID: 1,
+		ID:        123,
+		Kind:      serverSpanKind,
+		Name:      "GET /users/:id",
+		Attrs: AttrMap{
+			xattr.ServiceName: "api",
+			xattr.HTTPRoute:   "/users/:id",
+		},
+	}
+	assignSpanSystemAndGroupID(regrouper.ctx, span)
+	groupID := span.GroupID
+
+	regroup, err := regrouper.Regroup(1, marshalSpan(span))
+	require.NoError(t, err)
+	require.Nil(t, regroup)
+
+	span.GroupID = 1
+	regroup, err = regrouper.Regroup(1, marshalSpan(span))
+	require.NoError(t, err)
+	require.Equal(t, &SpanRegroup{
+		ID: 123, System: "http:api", GroupID: groupID, Service: "api",
+	}, regroup)
+
+	regroup, err = regrouper.Regroup(2, marshalSpan(span))
+	require.NoError(t, err)
+	require.Nil(t, regroup)
+
+	span.Attrs[xattr.DBSystem] = "postgresql"
+	span.Attrs[xattr.DBStatement] = "SELECT 1"
+	regroup, err = regrouper.Regroup(1, marshalSpan(span))
+	require.NoError(t, err)
+	require.Nil(t, regroup)
+}
+
+func TestServiceGrouping(t *testing.T) {
+	newHTTPSpan := func(namespace string) *Span {
+		span := &Span{
+			Kind: serverSpanKind,
+			Name: "GET /users/:id",
+			Attrs: AttrMap{
+				xattr.ServiceName: "api",
+				xattr.HTTPRoute:   "/users/:id",
+			},
+		}
+		if namespace != "" {
+			span.Attrs[xattr.ServiceNamespace] = namespace
+		}
+		return span
+	}
+
+	ctx := newSpanContext(context.Background(), new(bunapp.ServiceGrouping))
+	shop, billing, plain := newHTTPSpan("shop"), newHTTPSpan("billing"), newHTTPSpan("")
+	for _, span := range []*Span{shop, billing, plain} {
+		assignSpanSystemAndGroupID(ctx, span)
+	}
+	require.Equal(t, "http:shop/api", shop.System)
+	require.Equal(t, "http:billing/api", billing.System)
+	require.Equal(t, "http:api", plain.System)
+	require.NotEqual(t, shop.GroupID, billing.GroupID)
+
+	ctx = newSpanContext(context.Background(), &bunapp.ServiceGrouping{
+		Attrs: []string{xattr.ServiceName},
+	})
+	shop, billing = newHTTPSpan("shop"), newHTTPSpan("billing")
+	assignSpanSystemAndGroupID(ctx, shop)
+	assignSpanSystemAndGroupID(ctx, billing)
+	require.Equal(t, "http:api", shop.System)
+	require.Equal(t, shop.GroupID, billing.GroupID)
+}
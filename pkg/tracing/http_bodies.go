@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"mime"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+)
+
+var httpBodies = []struct {
+	attr         string
+	contentTypes []string
+}{
+	{xattr.HTTPRequestBody, []string{
+		"http.request.header.content-type", "http.request.header.content_type",
+	}},
+	{xattr.HTTPResponseBody, []string{
+		"http.response.header.content-type", "http.response.header.content_type",
+	}},
+}
+
+// captureHTTPBodies drops the body attributes unless the capture is enabled and the
+// content type is allowed. Captured bodies are redacted and truncated to max_size.
+func captureHTTPBodies(conf *bunapp.BodyCapture, span *Span) {
+	for _, body := range httpBodies {
+		value, ok := span.Attrs[body.attr]
+		if !ok {
+			continue
+		}
+
+		s, ok := value.(string)
+		if !ok || !conf.Enabled || !conf.AllowsContentType(spanContentType(span, body.contentTypes)) {
+			delete(span.Attrs, body.attr)
+			continue
+		}
+
+		// Redact before truncating so truncated secrets still match the rules.
+		s = conf.Redact(s)
+		if len(s) > conf.MaxSize {
+			s = truncate(s, conf.MaxSize)
+		}
+		span.Attrs[body.attr] = s
+	}
+}
+
+func spanContentType(span *Span, keys []string) string {
+	for _, key := range keys {
+		var s string
+		switch value := span.Attrs[key].(type) {
+		case string:
+			s = value
+		case []string:
+			if len(value) > 0 {
+				s = value[0]
+			}
+		}
+		if s == "" {
+			continue
+		}
+
+		mediaType, _, err := mime.ParseMediaType(s)
+		if err != nil {
+			return ""
+		}
+		return mediaType
+	}
+	return ""
+}
+
+func isHTTPBodyAttr(key string) bool {
+	return key == xattr.HTTPRequestBody || key == xattr.HTTPResponseBody
+}
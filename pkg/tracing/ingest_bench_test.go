@@ -0,0 +1,242 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// The benchmarks cover the ingest path from TraceServiceServer.process to
+// SpanStorage.InsertSpans with ClickHouse replaced by countingSpanStorage. Use
+//
+//	make bench
+//
+// and compare the spans/s and allocs/span metrics with benchstat.
+
+const benchSpansPerRequest = 100
+
+type countingSpanStorage struct {
+	spans int64
+}
+
+var _ SpanStorage = (*countingSpanStorage)(nil)
+
+func (s *countingSpanStorage) InsertSpans(
+	ctx context.Context, index []SpanIndex, data []SpanData,
+) error {
+	atomic.AddInt64(&s.spans, int64(len(index)))
+	return nil
+}
+
+func (s *countingSpanStorage) SelectSpan(ctx context.Context, span *Span) error {
+	return nil
+}
+
+func (s *countingSpanStorage) SelectTraceSpans(
+	ctx context.Context, traceID uuid.UUID, limit int,
+) ([]*Span, error) {
+	return nil, nil
+}
+
+func newBenchTraceServer(b *testing.B) (*TraceServiceServer, *countingSpanStorage) {
+	conf := &bunapp.AppConfig{
+		Projects: []bunapp.Project{{ID: 1}},
+	}
+	// The connection is never used, but the DSN must be valid.
+	conf.CH.DSN = "clickhouse://default:@localhost:9000/uptrace?sslmode=disable"
+	conf.Ingest.BatchSize = scaleWithCPU(2000, 32000)
+	conf.Ingest.FlushInterval = time.Second
+	conf.SpanFlush.Workers = runtime.GOMAXPROCS(0)
+	conf.SpanFlush.QueueSize = conf.SpanFlush.Workers
+	conf.SpanFlush.Overflow = bunapp.SpanFlushBlock
+
+	app := bunapp.New(context.Background(), conf)
+	b.Cleanup(func() {
+		app.Stop()
+		app.WaitGroup().Wait()
+	})
+
+	storage := new(countingSpanStorage)
+	return NewTraceServiceServer(app, storage), storage
+}
+
+// benchResourceSpans returns a request that resembles an instrumented HTTP server:
+// a server span with database client spans, one of them with an exception event.
+func benchResourceSpans(numSpan int) []*tracepb.ResourceSpans {
+	now := uint64(time.Now().UnixNano())
+	spans := make([]*tracepb.Span, 0, numSpan)
+
+	for i := 0; i < numSpan; i++ {
+		span := &tracepb.Span{
+			TraceId:           []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, byte(i)},
+			SpanId:            []byte{1, 2, 3, 4, 5, 6, 7, byte(i + 1)},
+			StartTimeUnixNano: now,
+			EndTimeUnixNano:   now + uint64(time.Millisecond),
+		}
+		if i%10 == 0 {
+			span.Name = "GET /users/:id"
+			span.Kind = tracepb.Span_SPAN_KIND_SERVER
+			span.Attributes = []*commonpb.KeyValue{
+				benchStringAttr("http.method", "GET"),
+				benchStringAttr("http.route", "/users/:id"),
+				benchStringAttr("http.target", fmt.Sprintf("/users/%d", i)),
+				benchIntAttr("http.status_code", 200),
+			}
+		} else {
+			span.Name = "SELECT users"
+			span.Kind = tracepb.Span_SPAN_KIND_CLIENT
+			span.ParentSpanId = []byte{1, 2, 3, 4, 5, 6, 7, byte(i/10*10 + 1)}
+			span.Attributes = []*commonpb.KeyValue{
+				benchStringAttr("db.system", "postgresql"),
+				benchStringAttr("db.statement", fmt.Sprintf("SELECT * FROM users WHERE id = %d", i)),
+			}
+		}
+		if i%25 == 1 {
+			span.Events = []*tracepb.Span_Event{{
+				Name:         "exception",
+				TimeUnixNano: now,
+				Attributes: []*commonpb.KeyValue{
+					benchStringAttr("exception.type", "*net.OpError"),
+					benchStringAttr("exception.message", "connection reset by peer"),
+				},
+			}}
+		}
+		spans = append(spans, span)
+	}
+
+	return []*tracepb.ResourceSpans{{
+		Resource: &resourcepb.Resource{
+			Attributes: []*commonpb.KeyValue{
+				benchStringAttr("service.name", "users"),
+				benchStringAttr("host.name", "web-1"),
+				benchStringAttr("telemetry.sdk.language", "go"),
+			},
+		},
+		InstrumentationLibrarySpans: []*tracepb.InstrumentationLibrarySpans{{
+			InstrumentationLibrary: &commonpb.InstrumentationLibrary{Name: "otelhttp"},
+			Spans:                  spans,
+		}},
+	}}
+}
+
+func benchStringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+func benchIntAttr(key string, value int64) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: value}},
+	}
+}
+
+// reportIngestMetrics reports the throughput and the allocations per inserted span,
+// including spans created from events.
+func reportIngestMetrics(b *testing.B, spans int64, elapsed time.Duration, mallocs uint64) {
+	if spans == 0 {
+		b.Fatal("no spans were inserted")
+	}
+	b.ReportMetric(float64(spans)/elapsed.Seconds(), "spans/s")
+	b.ReportMetric(float64(mallocs)/float64(spans), "allocs/span")
+}
+
+func readMallocs() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.Mallocs
+}
+
+// BenchmarkIngest measures a single client sending requests and waiting for them to be
+// inserted. Requests are created outside of the timer because the OTLP decoder owns
+// them in production.
+func BenchmarkIngest(b *testing.B) {
+	s, storage := newBenchTraceServer(b)
+	project := &s.Config().Projects[0]
+	ctx := context.Background()
+
+	reqs := make([][]*tracepb.ResourceSpans, b.N)
+	for i := range reqs {
+		reqs[i] = benchResourceSpans(benchSpansPerRequest)
+	}
+
+	b.ReportAllocs()
+	mallocs := readMallocs()
+	start := time.Now()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s.process(project, reqs[i])
+		if err := s.Flush(ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.StopTimer()
+	reportIngestMetrics(b, atomic.LoadInt64(&storage.spans), time.Since(start),
+		readMallocs()-mallocs)
+}
+
+// BenchmarkIngestParallel is the load harness: concurrent clients send requests
+// and spans are flushed in batches, like under production load.
+func BenchmarkIngestParallel(b *testing.B) {
+	s, storage := newBenchTraceServer(b)
+	project := &s.Config().Projects[0]
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	mallocs := readMallocs()
+	start := time.Now()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.process(project, benchResourceSpans(benchSpansPerRequest))
+		}
+	})
+	if err := s.Flush(ctx); err != nil {
+		b.Fatal(err)
+	}
+
+	b.StopTimer()
+	reportIngestMetrics(b, atomic.LoadInt64(&storage.spans), time.Since(start),
+		readMallocs()-mallocs)
+}
+
+// BenchmarkConvertSpans measures the conversion of a flushed batch to ClickHouse rows.
+func BenchmarkConvertSpans(b *testing.B) {
+	s, _ := newBenchTraceServer(b)
+	project := &s.Config().Projects[0]
+	ctx := context.Background()
+
+	var otlpSpans []otlpSpan
+	var numSpan int
+	walkOTLPSpans(s.Config(), project, benchResourceSpans(benchSpansPerRequest),
+		func(span otlpSpan) {
+			otlpSpans = append(otlpSpans, span)
+			numSpan += 1 + len(span.Events)
+		})
+
+	b.ReportAllocs()
+	mallocs := readMallocs()
+	start := time.Now()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s.convertSpans(ctx, otlpSpans, numSpan, nil)
+	}
+
+	b.StopTimer()
+	reportIngestMetrics(b, int64(b.N*numSpan), time.Since(start), readMallocs()-mallocs)
+}
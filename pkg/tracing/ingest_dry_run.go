@@ -0,0 +1,104 @@
+package tracing
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/org"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// DryRunSpan is a span or an event as it would be stored.
+type DryRunSpan struct {
+	*Span
+
+	ApdexLevel string `json:"apdexLevel,omitempty"`
+	// Attributes that are stored in spans_index columns.
+	Columns map[string]string `json:"columns"`
+	// Other attributes that are stored in spans_index attr_keys and attr_values.
+	IndexedAttrs map[string]string `json:"indexedAttrs"`
+}
+
+func newDryRunSpan(index *SpanIndex) *DryRunSpan {
+	span := &DryRunSpan{
+		Span:         index.Span,
+		ApdexLevel:   index.ApdexLevel,
+		Columns:      make(map[string]string),
+		IndexedAttrs: make(map[string]string, len(index.AttrKeys)),
+	}
+
+	for _, key := range indexedAttrs {
+		if value, ok := index.Attrs[key]; ok {
+			span.Columns[key] = truncate(asString(value), 200)
+		}
+	}
+	for i, key := range index.AttrKeys {
+		span.IndexedAttrs[key] = index.AttrValues[i]
+	}
+
+	return span
+}
+
+// DryRun processes the OTLP payload like the OTLP/HTTP endpoint does, but returns
+// the spans instead of storing them. It helps to debug grouping and ingest rules.
+func (h *IngestHandler) DryRun(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	dsn := org.IngestDSN(req.Request)
+	if dsn == "" {
+		return org.ErrDSNRequired
+	}
+
+	project, err := org.SelectProjectByDSN(ctx, h.App, dsn)
+	if err != nil {
+		return err
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+
+	td := new(collectortrace.ExportTraceServiceRequest)
+	switch contentType := otlpContentType(req); contentType {
+	case jsonContentType:
+		if err := unmarshalOTLPJSON(body, td); err != nil {
+			return err
+		}
+	case pbContentType:
+		if err := proto.Unmarshal(body, td); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported content type: %q", contentType)
+	}
+
+	var otlpSpans []otlpSpan
+	var numSpan int
+	rejected := walkOTLPSpans(h.Config(), project, td.ResourceSpans, func(span otlpSpan) {
+		otlpSpans = append(otlpSpans, span)
+		numSpan += 1 + len(span.Events)
+	})
+
+	// Values are not moved to the blob storage.
+	indexedSpans, _ := h.traceService.convertSpans(ctx, otlpSpans, numSpan, nil)
+
+	spans := make([]*DryRunSpan, len(indexedSpans))
+	for i := range indexedSpans {
+		spans[i] = newDryRunSpan(&indexedSpans[i])
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"project": bunrouter.H{
+			"id":   project.ID,
+			"name": project.Name,
+		},
+		"spans":         spans,
+		"rejectedSpans": rejected.count,
+		"errorMessage":  rejected.message(),
+	})
+}
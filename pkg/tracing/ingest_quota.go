@@ -0,0 +1,242 @@
+package tracing
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// ingestQuotas enforces the project ingest_quota options and counts usage of the
+// projects that have them. The zero value is ready to use.
+type ingestQuotas struct {
+	mu       sync.Mutex
+	projects map[uint32]*projectQuota
+}
+
+type projectQuota struct {
+	// Token bucket of spans_per_second.
+	tokens  float64
+	updated time.Time
+
+	// UTC day of the bytes counter.
+	day   time.Time
+	bytes int64
+
+	spans            int64
+	rejectedSpans    int64
+	rejectedRequests int64
+}
+
+// IngestQuotaUsage is the usage of a project with ingest_quota.
+type IngestQuotaUsage struct {
+	ProjectID uint32 `json:"projectId"`
+	// Spans accepted since the start and bytes accepted today (UTC).
+	Spans      int64 `json:"spans"`
+	BytesToday int64 `json:"bytesToday"`
+	// Spans of requests that were rejected because the quota was exceeded.
+	RejectedSpans    int64 `json:"rejectedSpans"`
+	RejectedRequests int64 `json:"rejectedRequests"`
+}
+
+// quotaCharge is the number of spans and their size routed to a project with
+// ingest_quota. Receivers of other signals, for example, logs, count their records
+// as spans.
+type quotaCharge struct {
+	project *bunapp.Project
+	numSpan int
+	size    int64
+}
+
+// addQuotaCharge adds numSpan spans of msg to the charge of the project.
+func addQuotaCharge(
+	charges []quotaCharge, project *bunapp.Project, numSpan int, msg proto.Message,
+) []quotaCharge {
+	if project.IngestQuota == nil {
+		return charges
+	}
+
+	var size int64
+	if project.IngestQuota.BytesPerDay > 0 {
+		size = int64(proto.Size(msg))
+	}
+
+	for i := range charges {
+		if charges[i].project.ID == project.ID {
+			charges[i].numSpan += numSpan
+			charges[i].size += size
+			return charges
+		}
+	}
+	return append(charges, quotaCharge{project: project, numSpan: numSpan, size: size})
+}
+
+// spanQuotaCharges returns the charges of the spans in the projects selected by
+// the routing rules.
+func spanQuotaCharges(
+	conf *bunapp.AppConfig, project *bunapp.Project, resourceSpans []*tracepb.ResourceSpans,
+) []quotaCharge {
+	if project.IngestQuota == nil && len(project.RoutingRules) == 0 {
+		return nil
+	}
+
+	var charges []quotaCharge
+	for _, rss := range resourceSpans {
+		project := routeProject(conf, project, otlpSpanResource(rss))
+		if project.IngestQuota == nil {
+			continue
+		}
+		for _, ils := range rss.InstrumentationLibrarySpans {
+			for _, span := range ils.Spans {
+				charges = addQuotaCharge(charges, project, 1, span)
+			}
+		}
+	}
+	return charges
+}
+
+// check returns a 429 error that receivers send as RESOURCE_EXHAUSTED when one of
+// the projects can't accept its charge. Requests are accepted or rejected as a whole.
+// Only the project that is over its quota counts the rejection.
+//
+// check doesn't charge the quotas, so receivers call commit with the accepted spans
+// once they are queued. Concurrent requests can exceed the quota by the spans that
+// are checked but not committed yet.
+func (q *ingestQuotas) check(charges []quotaCharge, now time.Time) error {
+	if len(charges) == 0 {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := range charges {
+		charge := &charges[i]
+		pq := q.project(charge.project.ID, charge.project.IngestQuota, now)
+		if err := pq.check(charge, now); err != nil {
+			pq.reject(charge.numSpan)
+			return err
+		}
+	}
+	return nil
+}
+
+// commit charges the projects for the accepted spans.
+func (q *ingestQuotas) commit(charges []quotaCharge, now time.Time) {
+	if len(charges) == 0 {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := range charges {
+		charge := &charges[i]
+		q.project(charge.project.ID, charge.project.IngestQuota, now).charge(charge)
+	}
+}
+
+func (q *ingestQuotas) project(
+	projectID uint32, conf *bunapp.IngestQuota, now time.Time,
+) *projectQuota {
+	if q.projects == nil {
+		q.projects = make(map[uint32]*projectQuota)
+	}
+
+	pq, ok := q.projects[projectID]
+	if !ok {
+		pq = &projectQuota{
+			tokens:  float64(conf.Burst),
+			updated: now,
+			day:     utcDay(now),
+		}
+		q.projects[projectID] = pq
+	}
+	return pq
+}
+
+// check refills the token bucket and reports whether the charge fits the quota.
+func (pq *projectQuota) check(charge *quotaCharge, now time.Time) error {
+	project := charge.project
+	conf := project.IngestQuota
+
+	if day := utcDay(now); !day.Equal(pq.day) {
+		pq.day = day
+		pq.bytes = 0
+	}
+	if conf.BytesPerDay > 0 && pq.bytes+charge.size > conf.BytesPerDay {
+		return &httperror.Error{
+			Status: http.StatusTooManyRequests,
+			Code:   "ingest_quota_exceeded",
+			Message: fmt.Sprintf("project %d exceeded ingest_quota.bytes_per_day (%d bytes)",
+				project.ID, conf.BytesPerDay),
+			RetryAfter: pq.day.AddDate(0, 0, 1).Sub(now),
+		}
+	}
+
+	if conf.SpansPerSecond > 0 {
+		burst := float64(conf.Burst)
+		pq.tokens = math.Min(burst, pq.tokens+now.Sub(pq.updated).Seconds()*conf.SpansPerSecond)
+		pq.updated = now
+
+		// Requests larger than the burst are accepted when the bucket is full
+		// and leave it in debt.
+		need := math.Min(float64(charge.numSpan), burst)
+		if pq.tokens < need {
+			wait := time.Duration((need - pq.tokens) / conf.SpansPerSecond * float64(time.Second))
+			return &httperror.Error{
+				Status: http.StatusTooManyRequests,
+				Code:   "ingest_rate_limited",
+				Message: fmt.Sprintf("project %d exceeded ingest_quota.spans_per_second (%g)",
+					project.ID, conf.SpansPerSecond),
+				RetryAfter: wait.Truncate(time.Millisecond) + time.Millisecond,
+			}
+		}
+	}
+
+	return nil
+}
+
+func (pq *projectQuota) charge(charge *quotaCharge) {
+	if charge.project.IngestQuota.SpansPerSecond > 0 {
+		pq.tokens -= float64(charge.numSpan)
+	}
+	pq.spans += int64(charge.numSpan)
+	pq.bytes += charge.size
+}
+
+func (pq *projectQuota) reject(numSpan int) {
+	pq.rejectedSpans += int64(numSpan)
+	pq.rejectedRequests++
+}
+
+func (q *ingestQuotas) usage() []IngestQuotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	usage := make([]IngestQuotaUsage, 0, len(q.projects))
+	for projectID, pq := range q.projects {
+		usage = append(usage, IngestQuotaUsage{
+			ProjectID:        projectID,
+			Spans:            pq.spans,
+			BytesToday:       pq.bytes,
+			RejectedSpans:    pq.rejectedSpans,
+			RejectedRequests: pq.rejectedRequests,
+		})
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].ProjectID < usage[j].ProjectID
+	})
+	return usage
+}
+
+func utcDay(tm time.Time) time.Time {
+	return tm.UTC().Truncate(24 * time.Hour)
+}
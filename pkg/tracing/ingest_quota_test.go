@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestIngestQuotas(t *testing.T) {
+	var quotas ingestQuotas
+	conf := new(bunapp.AppConfig)
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	req := benchResourceSpans(10)
+	allow := func(project *bunapp.Project, req []*tracepb.ResourceSpans, now time.Time) error {
+		charges := spanQuotaCharges(conf, project, req)
+		if err := quotas.check(charges, now); err != nil {
+			return err
+		}
+		quotas.commit(charges, now)
+		return nil
+	}
+
+	project := &bunapp.Project{
+		ID:          1,
+		IngestQuota: &bunapp.IngestQuota{SpansPerSecond: 10, Burst: 20},
+	}
+	require.NoError(t, allow(project, req, now))
+	require.NoError(t, allow(project, req, now))
+
+	err := allow(project, req, now)
+	require.Equal(t, http.StatusTooManyRequests, httperror.From(err).Status)
+	require.Equal(t, "ingest_rate_limited", httperror.From(err).Code)
+	require.Equal(t, time.Second+time.Millisecond, httperror.From(err).RetryAfter)
+
+	// A request larger than the burst is accepted once the bucket is full.
+	require.NoError(t, allow(project, benchResourceSpans(50), now.Add(2*time.Second)))
+	require.Error(t, allow(project, req, now.Add(3*time.Second)))
+
+	var size int64
+	for _, span := range req[0].InstrumentationLibrarySpans[0].Spans {
+		size += int64(proto.Size(span))
+	}
+	other := &bunapp.Project{
+		ID:          2,
+		IngestQuota: &bunapp.IngestQuota{BytesPerDay: 2 * size},
+	}
+	require.NoError(t, allow(other, req, now))
+	require.NoError(t, allow(other, req, now))
+	err = allow(other, req, now)
+	require.Equal(t, "ingest_quota_exceeded", httperror.From(err).Code)
+	require.Equal(t, 12*time.Hour, httperror.From(err).RetryAfter)
+	require.NoError(t, allow(other, req, now.Add(12*time.Hour)))
+
+	require.NoError(t, allow(&bunapp.Project{ID: 3}, req, now))
+
+	require.Equal(t, []IngestQuotaUsage{
+		{ProjectID: 1, Spans: 70, RejectedSpans: 20, RejectedRequests: 2},
+		{ProjectID: 2, Spans: 30, BytesToday: size, RejectedSpans: 10, RejectedRequests: 1},
+	}, quotas.usage())
+}
+
+func TestIngestQuotasRouting(t *testing.T) {
+	var quotas ingestQuotas
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	conf := &bunapp.AppConfig{
+		Projects: []bunapp.Project{{
+			ID: 1,
+			RoutingRules: []bunapp.RoutingRule{{
+				Attrs:     map[string]string{"service.name": "billing"},
+				ProjectID: 2,
+			}},
+			IngestQuota: &bunapp.IngestQuota{SpansPerSecond: 100, Burst: 100},
+		}, {
+			ID:          2,
+			IngestQuota: &bunapp.IngestQuota{SpansPerSecond: 10, Burst: 10},
+		}},
+	}
+	project := &conf.Projects[0]
+
+	billing := benchResourceSpans(10)
+	billing[0].Resource = &resourcepb.Resource{
+		Attributes: []*commonpb.KeyValue{benchStringAttr("service.name", "billing")},
+	}
+	req := append(benchResourceSpans(10), billing...)
+
+	// Routed spans are charged to the target project.
+	require.Equal(t, []quotaCharge{
+		{project: &conf.Projects[0], numSpan: 10},
+		{project: &conf.Projects[1], numSpan: 10},
+	}, spanQuotaCharges(conf, project, req))
+	charges := spanQuotaCharges(conf, project, req)
+	require.NoError(t, quotas.check(charges, now))
+	quotas.commit(charges, now)
+
+	// The request is rejected as a whole. Only the project over its quota
+	// counts the rejection.
+	err := quotas.check(spanQuotaCharges(conf, project, req), now)
+	require.Equal(t, "ingest_rate_limited", httperror.From(err).Code)
+	require.Contains(t, httperror.From(err).Message, "project 2")
+
+	require.Equal(t, []IngestQuotaUsage{
+		{ProjectID: 1, Spans: 10},
+		{ProjectID: 2, Spans: 10, RejectedSpans: 10, RejectedRequests: 1},
+	}, quotas.usage())
+}
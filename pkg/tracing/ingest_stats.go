@@ -0,0 +1,120 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httputil"
+)
+
+// IngestStats describes spans that were received but are not inserted yet.
+type IngestStats struct {
+	// Spans waiting in the channel to be added to the batch.
+	ChannelDepth    int `json:"channelDepth"`
+	ChannelCapacity int `json:"channelCapacity"`
+	// Spans and events in the batch that is not flushed yet.
+	PendingSpans int `json:"pendingSpans"`
+	BatchSize    int `json:"batchSize"`
+	// Batches that are being inserted into ClickHouse.
+	InFlightFlushes int `json:"inFlightFlushes"`
+	// Batches waiting for a flush worker.
+	QueuedFlushes      int `json:"queuedFlushes"`
+	FlushQueueCapacity int `json:"flushQueueCapacity"`
+	// Spans that were dropped because the flush queue or the channel was full,
+	// or because the insert failed.
+	DroppedSpans int `json:"droppedSpans"`
+	// Requests that were rejected because the channel was full.
+	RejectedRequests int `json:"rejectedRequests"`
+	// Spans that were dropped by span_dedup because they were already received.
+	DuplicateSpans int `json:"duplicateSpans"`
+
+	// Batches stored in span_wal because they failed to insert, and spans that were
+	// dropped because span_wal was full.
+	WALBatches      int   `json:"walBatches"`
+	WALSize         int64 `json:"walSize"`
+	WALDroppedSpans int   `json:"walDroppedSpans"`
+
+	LastFlushTime  *time.Time `json:"lastFlushTime"`
+	LastFlushSpans int        `json:"lastFlushSpans"`
+
+	// Requests refused by memory_limiter and the heap size of the last check.
+	MemoryRefusedRequests int    `json:"memoryRefusedRequests"`
+	HeapAlloc             uint64 `json:"heapAlloc"`
+
+	// Usage of projects with ingest_quota.
+	Quotas []IngestQuotaUsage `json:"quotas"`
+}
+
+func (s *TraceServiceServer) Stats() *IngestStats {
+	stats := &IngestStats{
+		ChannelDepth:    len(s.ch),
+		ChannelCapacity: cap(s.ch),
+		PendingSpans:    int(atomic.LoadInt64(&s.pendingSpans)),
+		BatchSize:       s.batchSize,
+		InFlightFlushes: int(atomic.LoadInt64(&s.flushing)),
+		LastFlushSpans:  int(atomic.LoadInt64(&s.lastFlushSpans)),
+
+		QueuedFlushes:      len(s.flushQueue),
+		FlushQueueCapacity: cap(s.flushQueue),
+		DroppedSpans:       int(atomic.LoadInt64(&s.droppedSpans)),
+		RejectedRequests:   int(atomic.LoadInt64(&s.rejectedRequests)),
+		DuplicateSpans:     int(atomic.LoadInt64(&s.duplicateSpans)),
+
+		MemoryRefusedRequests: int(s.MemoryLimiter().RefusedRequests()),
+		HeapAlloc:             s.MemoryLimiter().HeapAlloc(),
+
+		Quotas: s.quotas.usage(),
+	}
+	if wal, ok := s.storage.(*walSpanStorage); ok {
+		walStats := wal.stats()
+		stats.WALBatches = walStats.batches
+		stats.WALSize = walStats.size
+		stats.WALDroppedSpans = walStats.droppedSpans
+	}
+	if n := atomic.LoadInt64(&s.lastFlushTime); n > 0 {
+		tm := time.Unix(0, n)
+		stats.LastFlushTime = &tm
+	}
+	return stats
+}
+
+//------------------------------------------------------------------------------
+
+type IngestHandler struct {
+	*bunapp.App
+
+	traceService *TraceServiceServer
+}
+
+func NewIngestHandler(app *bunapp.App, traceService *TraceServiceServer) *IngestHandler {
+	return &IngestHandler{
+		App:          app,
+		traceService: traceService,
+	}
+}
+
+// Stats returns the state of the ingest pipeline of this server.
+func (h *IngestHandler) Stats(w http.ResponseWriter, req bunrouter.Request) error {
+	return httputil.JSON(w, bunrouter.H{
+		"ingest": h.traceService.Stats(),
+	})
+}
+
+// Flush flushes pending spans without waiting for the timer and returns
+// when the spans are inserted.
+func (h *IngestHandler) Flush(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx, cancel := context.WithTimeout(req.Context(), time.Minute)
+	defer cancel()
+
+	if err := h.traceService.Flush(ctx); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"ingest": h.traceService.Stats(),
+	})
+}
@@ -8,31 +8,117 @@ import (
 	"github.com/uptrace/uptrace/pkg/bunapp"
 	"github.com/uptrace/uptrace/pkg/httputil"
 	"github.com/uptrace/uptrace/pkg/org"
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
 )
 
 func init() {
 	bunapp.OnStart("tracing.initGRPC", initGRPC)
 	bunapp.OnStart("tracing.registerRoutes", registerRoutes)
+	bunapp.OnStart("tracing.initHealth", initHealth)
+}
+
+func initHealth(ctx context.Context, app *bunapp.App) error {
+	app.OnServe("tracing.health", NewHealthMonitor(app).Run)
+	return nil
 }
 
 func initGRPC(ctx context.Context, app *bunapp.App) error {
-	traceService := NewTraceServiceServer(app)
+	storage, err := NewSpanStorage(app)
+	if err != nil {
+		return err
+	}
+	if app.Config().SpanWAL.Dir != "" {
+		wal, err := newWALSpanStorage(app, storage)
+		if err != nil {
+			return err
+		}
+		app.OnServe("tracing.span_wal", wal.Run)
+		storage = wal
+	}
+
+	traceService := NewTraceServiceServer(app, storage)
 	collectortrace.RegisterTraceServiceServer(app.GRPCServer(), traceService)
 
 	router := app.Router()
 	router.POST("/v1/traces", traceService.httpTraces)
 
+	kafkaConsumer := NewKafkaConsumer(app, traceService)
+	app.OnServe("tracing.kafka", kafkaConsumer.Run)
+
+	logsService := NewLogsServiceServer(app, &traceService.quotas)
+	collectorlogs.RegisterLogsServiceServer(app.GRPCServer(), logsService)
+	router.POST("/v1/logs", logsService.httpLogs)
+	router.POST("/api/logs/json", logsService.httpJSONLogs)
+
+	syslogServer := NewSyslogServer(app, logsService)
+	app.OnServe("tracing.syslog", syslogServer.Listen)
+
+	metricsService := NewMetricsServiceServer(app)
+	collectormetrics.RegisterMetricsServiceServer(app.GRPCServer(), metricsService)
+	router.POST("/v1/metrics", metricsService.httpMetrics)
+
+	statsdServer := NewStatsdServer(app, metricsService)
+	app.OnServe("tracing.statsd", statsdServer.ListenUDP)
+
+	xrayServer := NewXRayServer(app, traceService)
+	router.POST("/TraceSegments", xrayServer.PutTraceSegments)
+	app.OnServe("tracing.xray", xrayServer.ListenUDP)
+
+	jaegerServer := NewJaegerServer(app, traceService)
+	jaegerServer.Register(app.GRPCServer())
+	router.POST("/api/traces", jaegerServer.HTTPThrift)
+
+	datadogServer := NewDatadogServer(app, traceService)
+	for _, path := range []string{"/v0.3/traces", "/v0.4/traces"} {
+		router.PUT(path, datadogServer.Traces)
+		router.POST(path, datadogServer.Traces)
+	}
+
+	elasticServer := NewElasticServer(app, traceService)
+	router.POST("/intake/v2/events", elasticServer.Events)
+
+	sentryServer := NewSentryServer(app, traceService)
+	app.APIGroup().POST("/:project_id/envelope/", sentryServer.Envelope)
+	app.APIGroup().POST("/:project_id/store/", sentryServer.Store)
+
+	ingestHandler := NewIngestHandler(app, traceService)
+	app.APIGroup().
+		Use(org.NewAuthMiddleware(app)).
+		Use(org.NewAdminMiddleware(app)).
+		WithGroup("/tracing/ingest", func(g *bunrouter.Group) {
+			g.GET("", ingestHandler.Stats)
+			g.POST("/flush", ingestHandler.Flush)
+			g.POST("/dry-run", ingestHandler.DryRun)
+		})
+
 	return nil
 }
 
 func registerRoutes(ctx context.Context, app *bunapp.App) error {
+	storage, err := NewSpanStorage(app)
+	if err != nil {
+		return err
+	}
+
 	sysHandler := NewSystemHandler(app)
 	serviceHandler := NewServiceHandler(app)
 	hostHandler := NewHostHandler(app)
-	spanHandler := NewSpanHandler(app)
-	traceHandler := NewTraceHandler(app)
+	spanHandler := NewSpanHandler(app, storage)
+	traceHandler := NewTraceHandler(app, storage)
 	suggestionHandler := NewSuggestionHandler(app)
+	messagingHandler := NewMessagingHandler(app)
+
+	spanGroupMetricsHandler := NewSpanGroupMetricsHandler(app)
+	app.APIGroup().
+		Use(org.NewProjectTokenMiddleware(app)).
+		GET("/metrics/:project_id/span-groups", spanGroupMetricsHandler.Prometheus)
+
+	app.APIGroup().
+		Use(org.NewAuthMiddleware(app)).
+		Use(org.NewAdminMiddleware(app)).
+		GET("/tracing/traces/:trace_id/projects", traceHandler.SearchProjects)
 
 	g := app.APIGroup().
 		Use(org.NewAuthMiddleware(app)).
@@ -41,9 +127,23 @@ func registerRoutes(ctx context.Context, app *bunapp.App) error {
 	g.GET("/systems", sysHandler.List)
 	g.GET("/systems-stats", sysHandler.Stats)
 	g.GET("/services", serviceHandler.List)
+	g.GET("/service-graph", serviceHandler.Graph)
+	g.GET("/correlate", serviceHandler.Correlate)
+	g.GET("/libraries", serviceHandler.Libraries)
+	g.GET("/http-stats", serviceHandler.HTTPStats)
+	g.GET("/rpc-stats", serviceHandler.RPCStats)
+	g.GET("/web-vitals", serviceHandler.WebVitals)
+	g.GET("/mobile-crashes", serviceHandler.MobileCrashes)
+	g.GET("/service-health", serviceHandler.ServiceHealthList)
+	g.GET("/service-health/:service", serviceHandler.ServiceHealthHistory)
+	g.GET("/messaging/destinations", messagingHandler.Destinations)
 	g.GET("/hosts", hostHandler.List)
 	g.GET("/groups", spanHandler.ListGroups)
+	g.GET("/groups/:group_id/events", spanHandler.EventTimeline)
+	g.GET("/groups/:group_id/versions", spanHandler.GroupVersions)
 	g.GET("/spans", spanHandler.ListSpans)
+	g.GET("/spans/export", spanHandler.ExportSpans)
+	g.GET("/facets", spanHandler.Facets)
 	g.GET("/percentiles", spanHandler.Percentiles)
 	g.GET("/stats", spanHandler.Stats)
 
@@ -66,14 +166,15 @@ func registerRoutes(ctx context.Context, app *bunapp.App) error {
 			return err
 		}
 
+		conf := app.Config().ForRequest(req.Request)
 		return httputil.JSON(w, bunrouter.H{
 			"grpc": map[string]any{
-				"endpoint": app.Config().GRPCEndpoint(project),
-				"dsn":      app.Config().GRPCDsn(project),
+				"endpoint": conf.GRPCEndpoint(project),
+				"dsn":      conf.GRPCDsn(project),
 			},
 			"http": map[string]any{
-				"endpoint": app.Config().HTTPEndpoint(project),
-				"dsn":      app.Config().HTTPDsn(project),
+				"endpoint": conf.HTTPEndpoint(project),
+				"dsn":      conf.HTTPDsn(project),
 			},
 		})
 	})
@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+// retryableCHErrors are ClickHouse error codes that don't depend on the inserted data
+// or the schema so the same insert can succeed later.
+var retryableCHErrors = map[int32]bool{
+	159: true, // TIMEOUT_EXCEEDED
+	164: true, // READONLY
+	202: true, // TOO_MANY_SIMULTANEOUS_QUERIES
+	203: true, // NO_FREE_CONNECTION
+	209: true, // SOCKET_TIMEOUT
+	210: true, // NETWORK_ERROR
+	241: true, // MEMORY_LIMIT_EXCEEDED
+	242: true, // TABLE_IS_READ_ONLY
+	252: true, // TOO_MANY_PARTS
+	319: true, // UNKNOWN_STATUS_OF_INSERT
+	425: true, // SYSTEM_ERROR
+	999: true, // KEEPER_EXCEPTION
+}
+
+// isRetryableInsertError reports whether the insert failed because ClickHouse is
+// unavailable or overloaded. Other errors, for example, a missing column, fail
+// again on retry.
+func isRetryableInsertError(err error) bool {
+	if errors.Is(err, errInjectedFault) {
+		return true
+	}
+
+	var chErr *ch.Error
+	if errors.As(err, &chErr) {
+		return retryableCHErrors[chErr.Code]
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// retryInsert calls fn until it succeeds, fails with an error that is not retryable,
+// or the attempts and the max age are used up.
+func retryInsert(
+	ctx context.Context, conf *bunapp.SpanStorageRetry, fn func(ctx context.Context) error,
+) error {
+	deadline := time.Now().Add(conf.MaxAge)
+	backoff := conf.Backoff
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if !isRetryableInsertError(err) {
+			return err
+		}
+		if attempt >= conf.MaxAttempts {
+			return fmt.Errorf("failed after %d attempts: %w", attempt, err)
+		}
+
+		// Jitter keeps flush workers from retrying at the same time.
+		sleep := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		if time.Now().Add(sleep).After(deadline) {
+			return fmt.Errorf("failed after %d attempts in %s: %w",
+				attempt, conf.MaxAge, err)
+		}
+
+		timer := time.NewTimer(sleep)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+
+		backoff *= 2
+		if backoff > conf.MaxBackoff {
+			backoff = conf.MaxBackoff
+		}
+	}
+}
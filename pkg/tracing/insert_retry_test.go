@@ -0,0 +1,61 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+func TestRetryInsert(t *testing.T) {
+	ctx := context.Background()
+	conf := &bunapp.SpanStorageRetry{
+		MaxAttempts: 3,
+		MaxAge:      time.Minute,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+	}
+
+	var attempts int
+	err := retryInsert(ctx, conf, func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return &ch.Error{Code: 252, Name: "DB::Exception", Message: "Too many parts"}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, attempts)
+
+	attempts = 0
+	err = retryInsert(ctx, conf, func(ctx context.Context) error {
+		attempts++
+		return fmt.Errorf("dial tcp: %w", syscall.ECONNREFUSED)
+	})
+	require.True(t, errors.Is(err, syscall.ECONNREFUSED))
+	require.EqualError(t, err, "failed after 3 attempts: dial tcp: connection refused")
+	require.Equal(t, 3, attempts)
+
+	attempts = 0
+	err = retryInsert(ctx, conf, func(ctx context.Context) error {
+		attempts++
+		return &ch.Error{Code: 16, Name: "DB::Exception", Message: "No such column"}
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, attempts)
+
+	conf.MaxAge = time.Nanosecond
+	attempts = 0
+	err = retryInsert(ctx, conf, func(ctx context.Context) error {
+		attempts++
+		return syscall.ECONNRESET
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, attempts)
+}
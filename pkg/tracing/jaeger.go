@@ -0,0 +1,176 @@
+package tracing
+
+import (
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// Jaeger model that is decoded from jaeger.thrift batches and api_v2 protobuf
+// messages and converted to OTLP.
+
+type jaegerBatch struct {
+	Spans   []*jaegerSpan
+	Process *jaegerProcess
+}
+
+type jaegerProcess struct {
+	ServiceName string
+	Tags        []*commonpb.KeyValue
+}
+
+type jaegerSpan struct {
+	TraceID       []byte
+	SpanID        []byte
+	OperationName string
+	References    []jaegerSpanRef
+	StartTime     time.Time
+	Duration      time.Duration
+	Tags          []*commonpb.KeyValue
+	Logs          []jaegerLog
+	Process       *jaegerProcess
+}
+
+// Reference types other than child-of, for example, follows-from, become links.
+const jaegerChildOf = 0
+
+type jaegerSpanRef struct {
+	TraceID []byte
+	SpanID  []byte
+	RefType uint64
+}
+
+type jaegerLog struct {
+	Time   time.Time
+	Fields []*commonpb.KeyValue
+}
+
+//------------------------------------------------------------------------------
+
+// jaegerResourceSpans converts the batch to OTLP. Spans with their own process
+// get a separate resource.
+func jaegerResourceSpans(batch *jaegerBatch) []*tracepb.ResourceSpans {
+	resourceSpans := make([]*tracepb.ResourceSpans, 0, 1)
+	var batchSpans []*tracepb.Span
+
+	for _, span := range batch.Spans {
+		if span.Process != nil {
+			resourceSpans = append(resourceSpans, &tracepb.ResourceSpans{
+				Resource: jaegerResource(span.Process),
+				InstrumentationLibrarySpans: []*tracepb.InstrumentationLibrarySpans{{
+					Spans: []*tracepb.Span{jaegerOTLPSpan(span)},
+				}},
+			})
+			continue
+		}
+		batchSpans = append(batchSpans, jaegerOTLPSpan(span))
+	}
+
+	if len(batchSpans) > 0 {
+		resourceSpans = append(resourceSpans, &tracepb.ResourceSpans{
+			Resource: jaegerResource(batch.Process),
+			InstrumentationLibrarySpans: []*tracepb.InstrumentationLibrarySpans{{
+				Spans: batchSpans,
+			}},
+		})
+	}
+
+	return resourceSpans
+}
+
+func jaegerResource(process *jaegerProcess) *resourcepb.Resource {
+	if process == nil {
+		return &resourcepb.Resource{}
+	}
+
+	attrs := make([]*commonpb.KeyValue, 0, len(process.Tags)+1)
+	if process.ServiceName != "" {
+		attrs = append(attrs, otlpStringAttr(xattr.ServiceName, process.ServiceName))
+	}
+	attrs = append(attrs, process.Tags...)
+	return &resourcepb.Resource{Attributes: attrs}
+}
+
+func jaegerOTLPSpan(src *jaegerSpan) *tracepb.Span {
+	span := &tracepb.Span{
+		TraceId:           src.TraceID,
+		SpanId:            src.SpanID,
+		Name:              src.OperationName,
+		StartTimeUnixNano: uint64(src.StartTime.UnixNano()),
+		EndTimeUnixNano:   uint64(src.StartTime.Add(src.Duration).UnixNano()),
+		Status:            &tracepb.Status{},
+	}
+
+	// The first child-of reference is the parent and other references are links.
+	for _, ref := range src.References {
+		if span.ParentSpanId == nil && ref.RefType == jaegerChildOf {
+			span.ParentSpanId = ref.SpanID
+			continue
+		}
+		span.Links = append(span.Links, &tracepb.Span_Link{
+			TraceId: ref.TraceID,
+			SpanId:  ref.SpanID,
+		})
+	}
+
+	span.Attributes = make([]*commonpb.KeyValue, 0, len(src.Tags))
+	for _, kv := range src.Tags {
+		switch kv.Key {
+		case "span.kind":
+			span.Kind = jaegerSpanKind(kv.Value.GetStringValue())
+		case "error":
+			if kv.Value.GetBoolValue() || kv.Value.GetStringValue() == "true" {
+				span.Status.Code = tracepb.Status_STATUS_CODE_ERROR
+			}
+		case "otel.status_code":
+			switch kv.Value.GetStringValue() {
+			case "ERROR":
+				span.Status.Code = tracepb.Status_STATUS_CODE_ERROR
+			case "OK":
+				span.Status.Code = tracepb.Status_STATUS_CODE_OK
+			}
+		case "otel.status_description":
+			span.Status.Message = kv.Value.GetStringValue()
+		case "internal.span.format":
+		default:
+			span.Attributes = append(span.Attributes, kv)
+		}
+	}
+
+	for _, log := range src.Logs {
+		event := &tracepb.Span_Event{
+			TimeUnixNano: uint64(log.Time.UnixNano()),
+			Attributes:   make([]*commonpb.KeyValue, 0, len(log.Fields)),
+		}
+		for _, kv := range log.Fields {
+			if kv.Key == "event" && event.Name == "" {
+				event.Name = kv.Value.GetStringValue()
+				continue
+			}
+			event.Attributes = append(event.Attributes, kv)
+		}
+		span.Events = append(span.Events, event)
+	}
+
+	return span
+}
+
+func jaegerSpanKind(kind string) tracepb.Span_SpanKind {
+	switch kind {
+	case "client":
+		return tracepb.Span_SPAN_KIND_CLIENT
+	case "server":
+		return tracepb.Span_SPAN_KIND_SERVER
+	case "producer":
+		return tracepb.Span_SPAN_KIND_PRODUCER
+	case "consumer":
+		return tracepb.Span_SPAN_KIND_CONSUMER
+	case "internal":
+		return tracepb.Span_SPAN_KIND_INTERNAL
+	default:
+		return tracepb.Span_SPAN_KIND_UNSPECIFIED
+	}
+}
@@ -0,0 +1,250 @@
+package tracing
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"time"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Decoder of jaeger-idl/proto/api_v2/model.proto messages. Messages are decoded by hand
+// because Jaeger uses gogo/protobuf generated code.
+
+type jaegerField struct {
+	num     protowire.Number
+	typ     protowire.Type
+	varint  uint64
+	fixed64 uint64
+	bytes   []byte
+}
+
+func (f *jaegerField) string() string {
+	return string(f.bytes)
+}
+
+func parseJaegerFields(b []byte, fn func(f *jaegerField) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		f := jaegerField{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			f.fixed64, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if err := fn(&f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseJaegerPostSpansRequest parses jaeger.api_v2.PostSpansRequest.
+func parseJaegerPostSpansRequest(b []byte) (*jaegerBatch, error) {
+	batch := new(jaegerBatch)
+	if err := parseJaegerFields(b, func(f *jaegerField) error {
+		if f.num == 1 && f.typ == protowire.BytesType {
+			return parseJaegerBatch(batch, f.bytes)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("jaeger: can't parse PostSpansRequest: %w", err)
+	}
+	return batch, nil
+}
+
+func parseJaegerBatch(batch *jaegerBatch, b []byte) error {
+	return parseJaegerFields(b, func(f *jaegerField) error {
+		if f.typ != protowire.BytesType {
+			return nil
+		}
+		switch f.num {
+		case 1:
+			span, err := parseJaegerSpan(f.bytes)
+			if err != nil {
+				return err
+			}
+			batch.Spans = append(batch.Spans, span)
+		case 2:
+			process, err := parseJaegerProcess(f.bytes)
+			if err != nil {
+				return err
+			}
+			batch.Process = process
+		}
+		return nil
+	})
+}
+
+func parseJaegerSpan(b []byte) (*jaegerSpan, error) {
+	span := new(jaegerSpan)
+	if err := parseJaegerFields(b, func(f *jaegerField) error {
+		var err error
+		switch f.num {
+		case 1:
+			span.TraceID = f.bytes
+		case 2:
+			span.SpanID = f.bytes
+		case 3:
+			span.OperationName = f.string()
+		case 4:
+			var ref jaegerSpanRef
+			err = parseJaegerFields(f.bytes, func(f *jaegerField) error {
+				switch f.num {
+				case 1:
+					ref.TraceID = f.bytes
+				case 2:
+					ref.SpanID = f.bytes
+				case 3:
+					ref.RefType = f.varint
+				}
+				return nil
+			})
+			span.References = append(span.References, ref)
+		case 6:
+			span.StartTime, err = parseJaegerTimestamp(f.bytes)
+		case 7:
+			var tm time.Time
+			tm, err = parseJaegerTimestamp(f.bytes)
+			span.Duration = time.Duration(tm.UnixNano())
+		case 8:
+			var kv *commonpb.KeyValue
+			kv, err = parseJaegerKeyValue(f.bytes)
+			span.Tags = append(span.Tags, kv)
+		case 9:
+			var log jaegerLog
+			err = parseJaegerFields(f.bytes, func(f *jaegerField) error {
+				switch f.num {
+				case 1:
+					tm, err := parseJaegerTimestamp(f.bytes)
+					if err != nil {
+						return err
+					}
+					log.Time = tm
+				case 2:
+					kv, err := parseJaegerKeyValue(f.bytes)
+					if err != nil {
+						return err
+					}
+					log.Fields = append(log.Fields, kv)
+				}
+				return nil
+			})
+			span.Logs = append(span.Logs, log)
+		case 10:
+			span.Process, err = parseJaegerProcess(f.bytes)
+		}
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return span, nil
+}
+
+func parseJaegerProcess(b []byte) (*jaegerProcess, error) {
+	process := new(jaegerProcess)
+	if err := parseJaegerFields(b, func(f *jaegerField) error {
+		switch f.num {
+		case 1:
+			process.ServiceName = f.string()
+		case 2:
+			kv, err := parseJaegerKeyValue(f.bytes)
+			if err != nil {
+				return err
+			}
+			process.Tags = append(process.Tags, kv)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return process, nil
+}
+
+const (
+	jaegerStringType  = 0
+	jaegerBoolType    = 1
+	jaegerInt64Type   = 2
+	jaegerFloat64Type = 3
+	jaegerBinaryType  = 4
+)
+
+func parseJaegerKeyValue(b []byte) (*commonpb.KeyValue, error) {
+	var key string
+	var vtype uint64
+	var vstr string
+	var vbool bool
+	var vint int64
+	var vfloat float64
+	var vbinary []byte
+
+	if err := parseJaegerFields(b, func(f *jaegerField) error {
+		switch f.num {
+		case 1:
+			key = f.string()
+		case 2:
+			vtype = f.varint
+		case 3:
+			vstr = f.string()
+		case 4:
+			vbool = f.varint != 0
+		case 5:
+			vint = int64(f.varint)
+		case 6:
+			vfloat = math.Float64frombits(f.fixed64)
+		case 7:
+			vbinary = f.bytes
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	switch vtype {
+	case jaegerBoolType:
+		return otlpBoolAttr(key, vbool), nil
+	case jaegerInt64Type:
+		return otlpIntAttr(key, vint), nil
+	case jaegerFloat64Type:
+		return otlpDoubleAttr(key, vfloat), nil
+	case jaegerBinaryType:
+		return otlpStringAttr(key, base64.StdEncoding.EncodeToString(vbinary)), nil
+	default:
+		return otlpStringAttr(key, vstr), nil
+	}
+}
+
+// parseJaegerTimestamp parses google.protobuf.Timestamp and google.protobuf.Duration
+// that have the same fields.
+func parseJaegerTimestamp(b []byte) (time.Time, error) {
+	var sec, nsec int64
+	if err := parseJaegerFields(b, func(f *jaegerField) error {
+		switch f.num {
+		case 1:
+			sec = int64(f.varint)
+		case 2:
+			nsec = int64(int32(f.varint))
+		}
+		return nil
+	}); err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, nsec), nil
+}
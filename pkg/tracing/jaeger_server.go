@@ -0,0 +1,176 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/org"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// JaegerServer accepts spans from Jaeger clients over HTTP and implements
+// jaeger.api_v2.CollectorService so jaeger-agent can forward spans to the gRPC listener.
+type JaegerServer struct {
+	*bunapp.App
+
+	traceService *TraceServiceServer
+}
+
+func NewJaegerServer(app *bunapp.App, traceService *TraceServiceServer) *JaegerServer {
+	return &JaegerServer{
+		App:          app,
+		traceService: traceService,
+	}
+}
+
+func (s *JaegerServer) Register(server *grpc.Server) {
+	server.RegisterService(&jaegerCollectorServiceDesc, s)
+}
+
+// project uses the uptrace-dsn header when it is set, because Jaeger clients and
+// jaeger-agent can't always be configured to send headers.
+func (s *JaegerServer) project(ctx context.Context, dsn string) (*bunapp.Project, error) {
+	if dsn != "" {
+		return org.SelectProjectByDSN(ctx, s.App, dsn)
+	}
+	projectID := s.Config().Jaeger.ProjectID
+	if projectID == 0 {
+		return nil, errors.New("uptrace-dsn header or jaeger.project_id option is required")
+	}
+	return org.SelectIngestProjectByID(ctx, s.App, projectID)
+}
+
+// HTTPThrift implements the Jaeger collector /api/traces endpoint that accepts
+// jaeger.thrift batches.
+func (s *JaegerServer) HTTPThrift(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch contentType {
+	case "application/x-thrift", "application/vnd.apache.thrift.binary":
+	default:
+		return fmt.Errorf("unsupported content type: %q", contentType)
+	}
+
+	project, err := s.project(ctx, org.IngestDSN(req.Request))
+	if err != nil {
+		return err
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+
+	batch, err := parseJaegerThriftBatch(body)
+	if err != nil {
+		return err
+	}
+	if _, err := s.traceService.process(project, jaegerResourceSpans(batch)); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+func (s *JaegerServer) PostSpans(
+	ctx context.Context, req *jaegerPostSpansRequest,
+) (*jaegerPostSpansResponse, error) {
+	var dsn string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		dsn = org.IngestDSNFromMetadata(md)
+	}
+
+	project, err := s.project(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.batch != nil {
+		if _, err := s.traceService.process(project, jaegerResourceSpans(req.batch)); err != nil {
+			return nil, err
+		}
+	}
+
+	return new(jaegerPostSpansResponse), nil
+}
+
+//------------------------------------------------------------------------------
+
+// The messages implement the legacy Marshal and Unmarshal methods that are used
+// by the gRPC proto codec, like gogo/protobuf messages do.
+
+type jaegerPostSpansRequest struct {
+	batch *jaegerBatch
+}
+
+func (r *jaegerPostSpansRequest) Reset()         { r.batch = nil }
+func (r *jaegerPostSpansRequest) String() string { return "jaeger.api_v2.PostSpansRequest" }
+func (r *jaegerPostSpansRequest) ProtoMessage()  {}
+
+func (r *jaegerPostSpansRequest) Unmarshal(b []byte) error {
+	batch, err := parseJaegerPostSpansRequest(b)
+	if err != nil {
+		return err
+	}
+	r.batch = batch
+	return nil
+}
+
+type jaegerPostSpansResponse struct{}
+
+func (r *jaegerPostSpansResponse) Reset()         {}
+func (r *jaegerPostSpansResponse) String() string { return "jaeger.api_v2.PostSpansResponse" }
+func (r *jaegerPostSpansResponse) ProtoMessage()  {}
+
+func (r *jaegerPostSpansResponse) Marshal() ([]byte, error) {
+	return nil, nil
+}
+
+type jaegerCollectorServer interface {
+	PostSpans(context.Context, *jaegerPostSpansRequest) (*jaegerPostSpansResponse, error)
+}
+
+var jaegerCollectorServiceDesc = grpc.ServiceDesc{
+	ServiceName: "jaeger.api_v2.CollectorService",
+	HandlerType: (*jaegerCollectorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PostSpans",
+			Handler:    jaegerPostSpansHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "collector.proto",
+}
+
+func jaegerPostSpansHandler(
+	srv interface{},
+	ctx context.Context,
+	dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (interface{}, error) {
+	in := new(jaegerPostSpansRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(jaegerCollectorServer).PostSpans(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/jaeger.api_v2.CollectorService/PostSpans",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(jaegerCollectorServer).PostSpans(ctx, req.(*jaegerPostSpansRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
@@ -0,0 +1,219 @@
+package tracing
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func appendThriftField(b []byte, typ byte, id int16) []byte {
+	return append(b, typ, byte(id>>8), byte(id))
+}
+
+func appendThriftUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendThriftI64(b []byte, id int16, v int64) []byte {
+	b = appendThriftField(b, thriftI64, id)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(v))
+	return append(b, buf[:]...)
+}
+
+func appendThriftI32(b []byte, id int16, v int32) []byte {
+	b = appendThriftField(b, thriftI32, id)
+	return appendThriftUint32(b, uint32(v))
+}
+
+func appendThriftString(b []byte, id int16, s string) []byte {
+	b = appendThriftField(b, thriftString, id)
+	b = appendThriftUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+func appendThriftList(b []byte, id int16, elems ...[]byte) []byte {
+	b = appendThriftField(b, thriftList, id)
+	b = append(b, thriftStruct)
+	b = appendThriftUint32(b, uint32(len(elems)))
+	for _, elem := range elems {
+		b = append(b, elem...)
+		b = append(b, thriftStop)
+	}
+	return b
+}
+
+func thriftStringTag(key, value string) []byte {
+	b := appendThriftString(nil, 1, key)
+	b = appendThriftI32(b, 2, jaegerThriftStringTag)
+	return appendThriftString(b, 3, value)
+}
+
+func TestJaegerThriftBatch(t *testing.T) {
+	tm := time.UnixMicro(1640000000000123)
+
+	errorTag := appendThriftString(nil, 1, "error")
+	errorTag = appendThriftI32(errorTag, 2, jaegerThriftBoolTag)
+	errorTag = appendThriftField(errorTag, thriftBool, 5)
+	errorTag = append(errorTag, 1)
+
+	var span []byte
+	span = appendThriftI64(span, 1, 0x0910111213141516)
+	span = appendThriftI64(span, 2, 0x0102030405060708)
+	span = appendThriftI64(span, 3, 0x0101010101010101)
+	span = appendThriftI64(span, 4, 0x0202020202020202)
+	span = appendThriftString(span, 5, "GET /users")
+	span = appendThriftI32(span, 7, 1)
+	span = appendThriftI64(span, 8, tm.UnixMicro())
+	span = appendThriftI64(span, 9, 1000)
+	span = appendThriftList(span, 10,
+		thriftStringTag("span.kind", "server"),
+		thriftStringTag("http.method", "GET"),
+		errorTag,
+	)
+	span = appendThriftList(span, 11, appendThriftList(
+		appendThriftI64(nil, 1, tm.UnixMicro()), 2, thriftStringTag("event", "retry")))
+
+	var process []byte
+	process = appendThriftString(process, 1, "api")
+	process = appendThriftList(process, 2, thriftStringTag("hostname", "host1"))
+
+	var batch []byte
+	batch = appendThriftField(batch, thriftStruct, 1)
+	batch = append(batch, process...)
+	batch = append(batch, thriftStop)
+	batch = appendThriftList(batch, 2, span)
+	batch = appendThriftI64(batch, 3, 42)
+	batch = append(batch, thriftStop)
+
+	parsed, err := parseJaegerThriftBatch(batch)
+	require.NoError(t, err)
+
+	resourceSpans := jaegerResourceSpans(parsed)
+	require.Len(t, resourceSpans, 1)
+
+	attrs := otlpAttrs(resourceSpans[0].Resource.Attributes)
+	require.Equal(t, AttrMap{"service.name": "api", "hostname": "host1"}, attrs)
+
+	spans := resourceSpans[0].InstrumentationLibrarySpans[0].Spans
+	require.Len(t, spans, 1)
+
+	got := spans[0]
+	require.Equal(t, []byte{
+		1, 2, 3, 4, 5, 6, 7, 8, 9, 0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16,
+	}, got.TraceId)
+	require.Equal(t, []byte{1, 1, 1, 1, 1, 1, 1, 1}, got.SpanId)
+	require.Equal(t, []byte{2, 2, 2, 2, 2, 2, 2, 2}, got.ParentSpanId)
+	require.Equal(t, "GET /users", got.Name)
+	require.Equal(t, tracepb.Span_SPAN_KIND_SERVER, got.Kind)
+	require.Equal(t, tracepb.Status_STATUS_CODE_ERROR, got.Status.Code)
+	require.Equal(t, uint64(tm.UnixNano()), got.StartTimeUnixNano)
+	require.Equal(t, uint64(tm.Add(time.Millisecond).UnixNano()), got.EndTimeUnixNano)
+	require.Equal(t, AttrMap{"http.method": "GET"}, otlpAttrs(got.Attributes))
+	require.Len(t, got.Events, 1)
+	require.Equal(t, "retry", got.Events[0].Name)
+
+	_, err = parseJaegerThriftBatch(batch[:len(batch)-10])
+	require.Error(t, err)
+}
+
+func appendJaegerBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendJaegerVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func jaegerStringTag(key, value string) []byte {
+	b := appendJaegerBytes(nil, 1, []byte(key))
+	return appendJaegerBytes(b, 3, []byte(value))
+}
+
+func TestJaegerServerRegister(t *testing.T) {
+	server := grpc.NewServer()
+	NewJaegerServer(nil, nil).Register(server)
+	require.Contains(t, server.GetServiceInfo(), "jaeger.api_v2.CollectorService")
+}
+
+func TestJaegerPostSpans(t *testing.T) {
+	traceID := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	spanID := []byte{1, 1, 1, 1, 1, 1, 1, 1}
+	parentID := []byte{2, 2, 2, 2, 2, 2, 2, 2}
+	tm := time.Unix(1640000000, 500)
+
+	var ref []byte
+	ref = appendJaegerBytes(ref, 1, traceID)
+	ref = appendJaegerBytes(ref, 2, parentID)
+	ref = appendJaegerVarint(ref, 3, jaegerChildOf)
+
+	var start []byte
+	start = appendJaegerVarint(start, 1, uint64(tm.Unix()))
+	start = appendJaegerVarint(start, 2, uint64(tm.Nanosecond()))
+
+	dur := appendJaegerVarint(nil, 2, uint64(time.Millisecond))
+
+	errorTag := appendJaegerBytes(nil, 1, []byte("error"))
+	errorTag = appendJaegerVarint(errorTag, 2, jaegerBoolType)
+	errorTag = appendJaegerVarint(errorTag, 4, 1)
+
+	var span []byte
+	span = appendJaegerBytes(span, 1, traceID)
+	span = appendJaegerBytes(span, 2, spanID)
+	span = appendJaegerBytes(span, 3, []byte("GET /users"))
+	span = appendJaegerBytes(span, 4, ref)
+	span = appendJaegerBytes(span, 6, start)
+	span = appendJaegerBytes(span, 7, dur)
+	span = appendJaegerBytes(span, 8, jaegerStringTag("span.kind", "server"))
+	span = appendJaegerBytes(span, 8, jaegerStringTag("http.method", "GET"))
+	span = appendJaegerBytes(span, 8, errorTag)
+	span = appendJaegerBytes(span, 9, appendJaegerBytes(
+		appendJaegerBytes(nil, 1, start), 2, jaegerStringTag("event", "retry")))
+
+	var process []byte
+	process = appendJaegerBytes(process, 1, []byte("api"))
+	process = appendJaegerBytes(process, 2, jaegerStringTag("hostname", "host1"))
+
+	var batch []byte
+	batch = appendJaegerBytes(batch, 1, span)
+	batch = appendJaegerBytes(batch, 2, process)
+
+	req := new(jaegerPostSpansRequest)
+	codec := encoding.GetCodec("proto")
+	require.NoError(t, codec.Unmarshal(appendJaegerBytes(nil, 1, batch), req))
+
+	_, err := codec.Marshal(new(jaegerPostSpansResponse))
+	require.NoError(t, err)
+
+	resourceSpans := jaegerResourceSpans(req.batch)
+	require.Len(t, resourceSpans, 1)
+
+	attrs := otlpAttrs(resourceSpans[0].Resource.Attributes)
+	require.Equal(t, AttrMap{"service.name": "api", "hostname": "host1"}, attrs)
+
+	spans := resourceSpans[0].InstrumentationLibrarySpans[0].Spans
+	require.Len(t, spans, 1)
+
+	got := spans[0]
+	require.Equal(t, traceID, got.TraceId)
+	require.Equal(t, spanID, got.SpanId)
+	require.Equal(t, parentID, got.ParentSpanId)
+	require.Equal(t, "GET /users", got.Name)
+	require.Equal(t, tracepb.Span_SPAN_KIND_SERVER, got.Kind)
+	require.Equal(t, tracepb.Status_STATUS_CODE_ERROR, got.Status.Code)
+	require.Equal(t, uint64(tm.UnixNano()), got.StartTimeUnixNano)
+	require.Equal(t, uint64(tm.Add(time.Millisecond).UnixNano()), got.EndTimeUnixNano)
+	require.Equal(t, AttrMap{"http.method": "GET"}, otlpAttrs(got.Attributes))
+	require.Len(t, got.Events, 1)
+	require.Equal(t, "retry", got.Events[0].Name)
+}
@@ -0,0 +1,491 @@
+package tracing
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+)
+
+// Decoder of jaeger.thrift batches encoded with the Thrift binary protocol that is
+// used by the Jaeger clients HTTP sender. Only the fields of jaeger.thrift are
+// decoded so the Thrift library is not needed.
+
+const (
+	thriftStop   = 0
+	thriftBool   = 2
+	thriftByte   = 3
+	thriftDouble = 4
+	thriftI16    = 6
+	thriftI32    = 8
+	thriftI64    = 10
+	thriftString = 11
+	thriftStruct = 12
+	thriftMap    = 13
+	thriftSet    = 14
+	thriftList   = 15
+)
+
+// thriftMaxDepth limits nesting of skipped structs and containers.
+const thriftMaxDepth = 64
+
+var errThriftShortBuffer = errors.New("thrift: unexpected end of data")
+
+type thriftDecoder struct {
+	b []byte
+}
+
+func (d *thriftDecoder) next(n int) ([]byte, error) {
+	if n < 0 || n > len(d.b) {
+		return nil, errThriftShortBuffer
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b, nil
+}
+
+func (d *thriftDecoder) byte() (byte, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *thriftDecoder) bool() (bool, error) {
+	c, err := d.byte()
+	return c != 0, err
+}
+
+func (d *thriftDecoder) i16() (int16, error) {
+	b, err := d.next(2)
+	if err != nil {
+		return 0, err
+	}
+	return int16(binary.BigEndian.Uint16(b)), nil
+}
+
+func (d *thriftDecoder) i32() (int32, error) {
+	b, err := d.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return int32(binary.BigEndian.Uint32(b)), nil
+}
+
+func (d *thriftDecoder) i64() (int64, error) {
+	b, err := d.next(8)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(b)), nil
+}
+
+func (d *thriftDecoder) double() (float64, error) {
+	n, err := d.i64()
+	return math.Float64frombits(uint64(n)), err
+}
+
+func (d *thriftDecoder) bytes() ([]byte, error) {
+	n, err := d.i32()
+	if err != nil {
+		return nil, err
+	}
+	return d.next(int(n))
+}
+
+func (d *thriftDecoder) string() (string, error) {
+	b, err := d.bytes()
+	return string(b), err
+}
+
+// readStruct calls fn for each field. fn must read the field value or skip it.
+func (d *thriftDecoder) readStruct(fn func(id int16, typ byte) error) error {
+	for {
+		typ, err := d.byte()
+		if err != nil {
+			return err
+		}
+		if typ == thriftStop {
+			return nil
+		}
+
+		id, err := d.i16()
+		if err != nil {
+			return err
+		}
+
+		if err := fn(id, typ); err != nil {
+			return err
+		}
+	}
+}
+
+// readList calls fn for each element of the list.
+func (d *thriftDecoder) readList(elemType byte, fn func() error) error {
+	typ, size, err := d.listHeader()
+	if err != nil {
+		return err
+	}
+	if typ != elemType {
+		return fmt.Errorf("thrift: got list of type %d, wanted %d", typ, elemType)
+	}
+
+	for i := 0; i < size; i++ {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *thriftDecoder) listHeader() (byte, int, error) {
+	typ, err := d.byte()
+	if err != nil {
+		return 0, 0, err
+	}
+	size, err := d.i32()
+	if err != nil {
+		return 0, 0, err
+	}
+	// Each element takes at least one byte.
+	if size < 0 || int(size) > len(d.b) {
+		return 0, 0, errThriftShortBuffer
+	}
+	return typ, int(size), nil
+}
+
+func (d *thriftDecoder) skip(typ byte) error {
+	return d.skipDepth(typ, 0)
+}
+
+func (d *thriftDecoder) skipDepth(typ byte, depth int) error {
+	if depth > thriftMaxDepth {
+		return errors.New("thrift: max depth exceeded")
+	}
+
+	var err error
+	switch typ {
+	case thriftBool, thriftByte:
+		_, err = d.next(1)
+	case thriftI16:
+		_, err = d.next(2)
+	case thriftI32:
+		_, err = d.next(4)
+	case thriftI64, thriftDouble:
+		_, err = d.next(8)
+	case thriftString:
+		_, err = d.bytes()
+	case thriftStruct:
+		err = d.readStruct(func(id int16, typ byte) error {
+			return d.skipDepth(typ, depth+1)
+		})
+	case thriftMap:
+		var keyType, valueType byte
+		var size int32
+		if keyType, err = d.byte(); err != nil {
+			return err
+		}
+		if valueType, err = d.byte(); err != nil {
+			return err
+		}
+		if size, err = d.i32(); err != nil {
+			return err
+		}
+		if size < 0 || int(size) > len(d.b) {
+			return errThriftShortBuffer
+		}
+		for i := 0; i < int(size); i++ {
+			if err := d.skipDepth(keyType, depth+1); err != nil {
+				return err
+			}
+			if err := d.skipDepth(valueType, depth+1); err != nil {
+				return err
+			}
+		}
+	case thriftSet, thriftList:
+		elemType, size, err := d.listHeader()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < size; i++ {
+			if err := d.skipDepth(elemType, depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("thrift: unsupported type %d", typ)
+	}
+	return err
+}
+
+//------------------------------------------------------------------------------
+
+// parseJaegerThriftBatch parses jaeger.thrift Batch.
+func parseJaegerThriftBatch(b []byte) (*jaegerBatch, error) {
+	d := &thriftDecoder{b: b}
+	batch := new(jaegerBatch)
+
+	if err := d.readStruct(func(id int16, typ byte) error {
+		switch {
+		case id == 1 && typ == thriftStruct:
+			process, err := d.readJaegerProcess()
+			if err != nil {
+				return err
+			}
+			batch.Process = process
+			return nil
+		case id == 2 && typ == thriftList:
+			return d.readList(thriftStruct, func() error {
+				span, err := d.readJaegerSpan()
+				if err != nil {
+					return err
+				}
+				batch.Spans = append(batch.Spans, span)
+				return nil
+			})
+		default:
+			return d.skip(typ)
+		}
+	}); err != nil {
+		return nil, fmt.Errorf("jaeger: can't parse Batch: %w", err)
+	}
+
+	return batch, nil
+}
+
+func (d *thriftDecoder) readJaegerProcess() (*jaegerProcess, error) {
+	process := new(jaegerProcess)
+	if err := d.readStruct(func(id int16, typ byte) error {
+		var err error
+		switch {
+		case id == 1 && typ == thriftString:
+			process.ServiceName, err = d.string()
+		case id == 2 && typ == thriftList:
+			process.Tags, err = d.readJaegerTags()
+		default:
+			err = d.skip(typ)
+		}
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return process, nil
+}
+
+func (d *thriftDecoder) readJaegerSpan() (*jaegerSpan, error) {
+	span := new(jaegerSpan)
+	var traceIDLow, traceIDHigh, spanID, parentSpanID int64
+
+	if err := d.readStruct(func(id int16, typ byte) error {
+		var err error
+		switch {
+		case id == 1 && typ == thriftI64:
+			traceIDLow, err = d.i64()
+		case id == 2 && typ == thriftI64:
+			traceIDHigh, err = d.i64()
+		case id == 3 && typ == thriftI64:
+			spanID, err = d.i64()
+		case id == 4 && typ == thriftI64:
+			parentSpanID, err = d.i64()
+		case id == 5 && typ == thriftString:
+			span.OperationName, err = d.string()
+		case id == 6 && typ == thriftList:
+			err = d.readList(thriftStruct, func() error {
+				ref, err := d.readJaegerSpanRef()
+				if err != nil {
+					return err
+				}
+				span.References = append(span.References, ref)
+				return nil
+			})
+		case id == 8 && typ == thriftI64:
+			var us int64
+			us, err = d.i64()
+			span.StartTime = time.UnixMicro(us)
+		case id == 9 && typ == thriftI64:
+			var us int64
+			us, err = d.i64()
+			span.Duration = time.Duration(us) * time.Microsecond
+		case id == 10 && typ == thriftList:
+			span.Tags, err = d.readJaegerTags()
+		case id == 11 && typ == thriftList:
+			err = d.readList(thriftStruct, func() error {
+				log, err := d.readJaegerLog()
+				if err != nil {
+					return err
+				}
+				span.Logs = append(span.Logs, log)
+				return nil
+			})
+		default:
+			err = d.skip(typ)
+		}
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	span.TraceID = jaegerThriftTraceID(traceIDHigh, traceIDLow)
+	span.SpanID = jaegerThriftSpanID(spanID)
+
+	// Old clients only set the parent span id without a reference.
+	if parentSpanID != 0 {
+		parentID := jaegerThriftSpanID(parentSpanID)
+		if !hasJaegerChildOf(span.References, parentID) {
+			span.References = append([]jaegerSpanRef{{
+				TraceID: span.TraceID,
+				SpanID:  parentID,
+				RefType: jaegerChildOf,
+			}}, span.References...)
+		}
+	}
+
+	return span, nil
+}
+
+func hasJaegerChildOf(refs []jaegerSpanRef, spanID []byte) bool {
+	for i := range refs {
+		ref := &refs[i]
+		if ref.RefType == jaegerChildOf && string(ref.SpanID) == string(spanID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *thriftDecoder) readJaegerSpanRef() (jaegerSpanRef, error) {
+	var ref jaegerSpanRef
+	var traceIDLow, traceIDHigh, spanID int64
+
+	if err := d.readStruct(func(id int16, typ byte) error {
+		var err error
+		switch {
+		case id == 1 && typ == thriftI32:
+			var refType int32
+			refType, err = d.i32()
+			ref.RefType = uint64(refType)
+		case id == 2 && typ == thriftI64:
+			traceIDLow, err = d.i64()
+		case id == 3 && typ == thriftI64:
+			traceIDHigh, err = d.i64()
+		case id == 4 && typ == thriftI64:
+			spanID, err = d.i64()
+		default:
+			err = d.skip(typ)
+		}
+		return err
+	}); err != nil {
+		return ref, err
+	}
+
+	ref.TraceID = jaegerThriftTraceID(traceIDHigh, traceIDLow)
+	ref.SpanID = jaegerThriftSpanID(spanID)
+	return ref, nil
+}
+
+func (d *thriftDecoder) readJaegerLog() (jaegerLog, error) {
+	var log jaegerLog
+	err := d.readStruct(func(id int16, typ byte) error {
+		var err error
+		switch {
+		case id == 1 && typ == thriftI64:
+			var us int64
+			us, err = d.i64()
+			log.Time = time.UnixMicro(us)
+		case id == 2 && typ == thriftList:
+			log.Fields, err = d.readJaegerTags()
+		default:
+			err = d.skip(typ)
+		}
+		return err
+	})
+	return log, err
+}
+
+func (d *thriftDecoder) readJaegerTags() ([]*commonpb.KeyValue, error) {
+	var tags []*commonpb.KeyValue
+	err := d.readList(thriftStruct, func() error {
+		kv, err := d.readJaegerTag()
+		if err != nil {
+			return err
+		}
+		tags = append(tags, kv)
+		return nil
+	})
+	return tags, err
+}
+
+// TagType values from jaeger.thrift.
+const (
+	jaegerThriftStringTag = 0
+	jaegerThriftDoubleTag = 1
+	jaegerThriftBoolTag   = 2
+	jaegerThriftLongTag   = 3
+	jaegerThriftBinaryTag = 4
+)
+
+func (d *thriftDecoder) readJaegerTag() (*commonpb.KeyValue, error) {
+	var key string
+	var vtype int32
+	var vstr string
+	var vdouble float64
+	var vbool bool
+	var vlong int64
+	var vbinary []byte
+
+	if err := d.readStruct(func(id int16, typ byte) error {
+		var err error
+		switch {
+		case id == 1 && typ == thriftString:
+			key, err = d.string()
+		case id == 2 && typ == thriftI32:
+			vtype, err = d.i32()
+		case id == 3 && typ == thriftString:
+			vstr, err = d.string()
+		case id == 4 && typ == thriftDouble:
+			vdouble, err = d.double()
+		case id == 5 && typ == thriftBool:
+			vbool, err = d.bool()
+		case id == 6 && typ == thriftI64:
+			vlong, err = d.i64()
+		case id == 7 && typ == thriftString:
+			vbinary, err = d.bytes()
+		default:
+			err = d.skip(typ)
+		}
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	switch vtype {
+	case jaegerThriftDoubleTag:
+		return otlpDoubleAttr(key, vdouble), nil
+	case jaegerThriftBoolTag:
+		return otlpBoolAttr(key, vbool), nil
+	case jaegerThriftLongTag:
+		return otlpIntAttr(key, vlong), nil
+	case jaegerThriftBinaryTag:
+		return otlpStringAttr(key, base64.StdEncoding.EncodeToString(vbinary)), nil
+	default:
+		return otlpStringAttr(key, vstr), nil
+	}
+}
+
+func jaegerThriftTraceID(high, low int64) []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b[:8], uint64(high))
+	binary.BigEndian.PutUint64(b[8:], uint64(low))
+	return b
+}
+
+func jaegerThriftSpanID(id int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+	return b
+}
@@ -0,0 +1,269 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/org"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+// httpJSONLogs accepts JSON records sent by Fluent Bit and Vector HTTP sinks, for example,
+// Fluent Bit http output with format json_lines or Vector http sink with the json codec.
+// Records are newline-delimited JSON objects or a JSON array of objects.
+func (s *LogsServiceServer) httpJSONLogs(w http.ResponseWriter, req bunrouter.Request) error {
+	dsn := org.IngestDSN(req.Request)
+	if dsn == "" {
+		return org.ErrDSNRequired
+	}
+
+	project, err := org.SelectProjectByDSN(req.Context(), s.App, dsn)
+	if err != nil {
+		return err
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+
+	records, err := parseJSONLogRecords(body)
+	if err != nil {
+		return err
+	}
+	if err := s.process(project, jsonResourceLogs(records)); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+func parseJSONLogRecords(b []byte) ([]map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '[' {
+		var records []map[string]any
+		if err := dec.Decode(&records); err != nil {
+			return nil, fmt.Errorf("json logs: %w", err)
+		}
+		return records, nil
+	}
+
+	var records []map[string]any
+	for {
+		var record map[string]any
+		if err := dec.Decode(&record); err != nil {
+			if err == io.EOF {
+				return records, nil
+			}
+			return nil, fmt.Errorf("json logs: record #%d: %w", len(records), err)
+		}
+		records = append(records, record)
+	}
+}
+
+var (
+	jsonLogMessageKeys  = []string{"message", "log", "msg"}
+	jsonLogTimeKeys     = []string{"timestamp", "@timestamp", "date", "time"}
+	jsonLogSeverityKeys = []string{"level", "severity", "log.level"}
+)
+
+// jsonLogResourceKeys maps the fields set by shippers and their Kubernetes filters
+// to resource attributes.
+var jsonLogResourceKeys = map[string]string{
+	"service":      xattr.ServiceName,
+	"service_name": xattr.ServiceName,
+	"service.name": xattr.ServiceName,
+	"host":         xattr.HostName,
+	"hostname":     xattr.HostName,
+
+	"kubernetes.pod_name":       "k8s.pod.name",
+	"kubernetes.pod_id":         "k8s.pod.uid",
+	"kubernetes.pod_uid":        "k8s.pod.uid",
+	"kubernetes.namespace_name": "k8s.namespace.name",
+	"kubernetes.pod_namespace":  "k8s.namespace.name",
+	"kubernetes.container_name": "k8s.container.name",
+	"kubernetes.host":           xattr.K8sNodeName,
+	"kubernetes.pod_node_name":  xattr.K8sNodeName,
+}
+
+// jsonResourceLogs converts the records to OTLP logs grouping records with the
+// same resource.
+func jsonResourceLogs(records []map[string]any) []*logspb.ResourceLogs {
+	var resourceLogs []*logspb.ResourceLogs
+	index := make(map[string]int)
+
+	for _, record := range records {
+		fields := make(map[string]any, len(record))
+		flattenJSONLogFields(fields, "", record)
+
+		var resource []*commonpb.KeyValue
+		logRecord := &logspb.LogRecord{
+			TimeUnixNano: jsonLogTime(popJSONLogField(fields, jsonLogTimeKeys)),
+			SeverityText: jsonLogSeverity(popJSONLogField(fields, jsonLogSeverityKeys)),
+		}
+		if msg := popJSONLogField(fields, jsonLogMessageKeys); msg != nil {
+			logRecord.Body = &commonpb.AnyValue{
+				Value: &commonpb.AnyValue_StringValue{StringValue: asString(msg)},
+			}
+		}
+		if b := jsonLogID(fields["trace_id"], 16); b != nil {
+			logRecord.TraceId = b
+			delete(fields, "trace_id")
+		}
+		if b := jsonLogID(fields["span_id"], 8); b != nil {
+			logRecord.SpanId = b
+			delete(fields, "span_id")
+		}
+
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var resourceKey strings.Builder
+		for _, key := range keys {
+			value := fields[key]
+			if attrKey, ok := jsonLogResourceKeys[key]; ok {
+				resource = append(resource, otlpAnyAttr(attrKey, value))
+				resourceKey.WriteString(attrKey + "=" + asString(value) + "\n")
+				continue
+			}
+			logRecord.Attributes = append(logRecord.Attributes, otlpAnyAttr(key, value))
+		}
+
+		idx, ok := index[resourceKey.String()]
+		if !ok {
+			idx = len(resourceLogs)
+			index[resourceKey.String()] = idx
+			resourceLogs = append(resourceLogs, &logspb.ResourceLogs{
+				Resource:                   &resourcepb.Resource{Attributes: resource},
+				InstrumentationLibraryLogs: []*logspb.InstrumentationLibraryLogs{{}},
+			})
+		}
+
+		ill := resourceLogs[idx].InstrumentationLibraryLogs[0]
+		ill.LogRecords = append(ill.LogRecords, logRecord)
+	}
+
+	return resourceLogs
+}
+
+// flattenJSONLogFields joins the keys of nested objects with dots, for example,
+// kubernetes.pod_name, and converts JSON numbers to int64 or float64.
+func flattenJSONLogFields(dest map[string]any, prefix string, m map[string]any) {
+	for key, value := range m {
+		key = prefix + key
+		switch value := value.(type) {
+		case map[string]any:
+			flattenJSONLogFields(dest, key+".", value)
+		case json.Number:
+			if n, err := value.Int64(); err == nil {
+				dest[key] = n
+			} else if f, err := value.Float64(); err == nil {
+				dest[key] = f
+			}
+		case []any:
+			b, _ := json.Marshal(value)
+			dest[key] = string(b)
+		case nil:
+		default:
+			dest[key] = value
+		}
+	}
+}
+
+func popJSONLogField(fields map[string]any, keys []string) any {
+	for _, key := range keys {
+		if value, ok := fields[key]; ok {
+			delete(fields, key)
+			return value
+		}
+	}
+	return nil
+}
+
+// jsonLogTime accepts RFC 3339 strings and Unix timestamps in seconds, milliseconds,
+// microseconds, or nanoseconds. Zero means the time is unknown.
+func jsonLogTime(value any) uint64 {
+	switch value := value.(type) {
+	case string:
+		tm, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return 0
+		}
+		return uint64(tm.UnixNano())
+	case int64:
+		switch {
+		case value <= 0:
+			return 0
+		case value >= 1e17:
+			return uint64(value)
+		case value >= 1e14:
+			return uint64(value) * 1e3
+		case value >= 1e11:
+			return uint64(value) * 1e6
+		default:
+			return uint64(value) * 1e9
+		}
+	case float64:
+		if value <= 0 || value >= 1e11 {
+			return jsonLogTime(int64(value))
+		}
+		// Fluent Bit sends fractional seconds with microsecond precision.
+		whole, frac := math.Modf(value)
+		return uint64(whole)*1e9 + uint64(math.Round(frac*1e6))*1e3
+	default:
+		return 0
+	}
+}
+
+func jsonLogSeverity(value any) string {
+	s, _ := value.(string)
+	switch strings.ToLower(s) {
+	case "":
+		return ""
+	case "trace":
+		return "TRACE"
+	case "debug":
+		return "DEBUG"
+	case "info", "information", "notice":
+		return "INFO"
+	case "warn", "warning":
+		return "WARN"
+	case "error", "err":
+		return "ERROR"
+	case "fatal", "panic", "crit", "critical", "alert", "emerg":
+		return "FATAL"
+	default:
+		return strings.ToUpper(s)
+	}
+}
+
+func jsonLogID(value any, size int) []byte {
+	s, _ := value.(string)
+	if len(s) != 2*size {
+		return nil
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil
+	}
+	return b
+}
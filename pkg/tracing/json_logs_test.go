@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+)
+
+func TestJSONResourceLogs(t *testing.T) {
+	body := []byte(`
+{"date":1640000000.5,"log":"GET /users","stream":"stdout","kubernetes":{"pod_name":"api-1","namespace_name":"prod"}}
+{"timestamp":"2021-12-20T11:33:20Z","message":"db timeout","level":"warning","host":"host1","trace_id":"0102030405060708090a0b0c0d0e0f10"}
+{"date":1640000001,"log":"POST /users","kubernetes":{"namespace_name":"prod","pod_name":"api-1"}}
+`)
+	records, err := parseJSONLogRecords(body)
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+
+	resourceLogs := jsonResourceLogs(records)
+	require.Len(t, resourceLogs, 2)
+
+	require.Equal(t, AttrMap{"k8s.namespace.name": "prod", "k8s.pod.name": "api-1"},
+		otlpAttrs(resourceLogs[0].Resource.Attributes))
+	logs := resourceLogs[0].InstrumentationLibraryLogs[0].LogRecords
+	require.Len(t, logs, 2)
+	require.Equal(t, "GET /users", logs[0].Body.GetStringValue())
+	require.Equal(t, uint64(time.Unix(1640000000, 5e8).UnixNano()), logs[0].TimeUnixNano)
+	require.Equal(t, AttrMap{"stream": "stdout"}, otlpAttrs(logs[0].Attributes))
+	require.Equal(t, uint64(time.Unix(1640000001, 0).UnixNano()), logs[1].TimeUnixNano)
+
+	require.Equal(t, AttrMap{xattr.HostName: "host1"}, otlpAttrs(resourceLogs[1].Resource.Attributes))
+	log := resourceLogs[1].InstrumentationLibraryLogs[0].LogRecords[0]
+	require.Equal(t, "db timeout", log.Body.GetStringValue())
+	require.Equal(t, "WARN", log.SeverityText)
+	require.Equal(t, uint64(time.Unix(1640000000, 0).UnixNano()), log.TimeUnixNano)
+	require.Len(t, log.TraceId, 16)
+
+	records, err = parseJSONLogRecords([]byte(`[{"message":"a"},{"message":"b"}]`))
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	_, err = parseJSONLogRecords([]byte(`{"message":"a"}` + "\n" + `"b"`))
+	require.Error(t, err)
+}
@@ -0,0 +1,176 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	"github.com/uptrace/uptrace/pkg/org"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+// KafkaConsumer consumes OTLP trace requests from the ingest.kafka topic and passes
+// the spans to the trace service like the other receivers. Offsets are committed
+// after the spans are accepted, so requests that are rejected by span_backpressure
+// or ingest_quota wait in the topic and are retried.
+type KafkaConsumer struct {
+	*bunapp.App
+
+	traceService *TraceServiceServer
+}
+
+func NewKafkaConsumer(app *bunapp.App, traceService *TraceServiceServer) *KafkaConsumer {
+	return &KafkaConsumer{
+		App:          app,
+		traceService: traceService,
+	}
+}
+
+func (c *KafkaConsumer) Run(ctx context.Context, app *bunapp.App) error {
+	conf := &app.Config().Ingest.Kafka
+	if len(conf.Brokers) == 0 {
+		return nil
+	}
+
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:        conf.Brokers,
+		Topic:          conf.Topic,
+		GroupID:        conf.Group,
+		CommitInterval: time.Second,
+		ErrorLogger: kafka.LoggerFunc(func(msg string, args ...any) {
+			app.Zap(ctx).Error("kafka: " + fmt.Sprintf(msg, args...))
+		}),
+	})
+
+	app.WaitGroup().Add(1)
+	go func() {
+		defer app.WaitGroup().Done()
+		defer r.Close()
+
+		c.consume(app.Context(), r)
+	}()
+
+	return nil
+}
+
+func (c *KafkaConsumer) consume(ctx context.Context, r *kafka.Reader) {
+	for {
+		msg, err := r.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.Zap(ctx).Error("kafka: FetchMessage failed", zap.Error(err))
+			if !sleepContext(ctx, time.Second) {
+				return
+			}
+			continue
+		}
+
+		if err := c.process(ctx, &msg); err != nil {
+			// The app is stopped and the message is consumed again after restart.
+			return
+		}
+		if err := r.CommitMessages(ctx, msg); err != nil && ctx.Err() == nil {
+			c.Zap(ctx).Error("kafka: CommitMessages failed", zap.Error(err))
+		}
+	}
+}
+
+// process waits until the spans are accepted. Invalid messages are skipped.
+// It returns an error only when the context is done.
+func (c *KafkaConsumer) process(ctx context.Context, msg *kafka.Message) error {
+	conf := &c.Config().Ingest.Kafka
+
+	dsn := kafkaMessageDSN(msg, conf.DSN)
+	if dsn == "" {
+		c.skip(ctx, msg, errors.New("uptrace-dsn header or ingest.kafka.dsn option is required"))
+		return nil
+	}
+
+	project, err := org.SelectProjectByDSN(ctx, c.App, dsn)
+	if err != nil {
+		c.skip(ctx, msg, err)
+		return nil
+	}
+
+	req, err := decodeKafkaTraces(conf.Encoding, msg.Value)
+	if err != nil {
+		c.skip(ctx, msg, err)
+		return nil
+	}
+
+	for {
+		_, err := c.traceService.process(project, req.ResourceSpans)
+		if err == nil {
+			return nil
+		}
+
+		httpErr := httperror.From(err)
+		if httpErr.Status != http.StatusTooManyRequests {
+			c.skip(ctx, msg, err)
+			return nil
+		}
+
+		wait := httpErr.RetryAfter
+		if wait <= 0 {
+			wait = time.Second
+		}
+		if !sleepContext(ctx, wait) {
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *KafkaConsumer) skip(ctx context.Context, msg *kafka.Message, err error) {
+	c.Zap(ctx).Error("kafka: skipping message",
+		zap.Int("partition", msg.Partition),
+		zap.Int64("offset", msg.Offset),
+		zap.Error(err))
+}
+
+// kafkaMessageDSN returns the uptrace-dsn header or the default DSN.
+func kafkaMessageDSN(msg *kafka.Message, defaultDSN string) string {
+	for _, h := range msg.Headers {
+		if h.Key == "uptrace-dsn" && len(h.Value) > 0 {
+			return string(h.Value)
+		}
+	}
+	return defaultDSN
+}
+
+func decodeKafkaTraces(encoding string, b []byte) (*collectortrace.ExportTraceServiceRequest, error) {
+	req := new(collectortrace.ExportTraceServiceRequest)
+
+	var err error
+	switch encoding {
+	case bunapp.KafkaEncodingJSON:
+		err = unmarshalOTLPJSON(b, req)
+	default:
+		err = proto.Unmarshal(b, req)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't decode %s message: %w", encoding, err)
+	}
+	return req, nil
+}
+
+// sleepContext reports whether it slept for the duration before the context was done.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,51 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestKafkaMessageDSN(t *testing.T) {
+	msg := new(kafka.Message)
+	require.Equal(t, "default", kafkaMessageDSN(msg, "default"))
+
+	msg.Headers = []kafka.Header{
+		{Key: "traceparent", Value: []byte("00-01")},
+		{Key: "uptrace-dsn", Value: []byte("http://token@localhost:14317/1")},
+	}
+	require.Equal(t, "http://token@localhost:14317/1", kafkaMessageDSN(msg, "default"))
+
+	msg.Headers = []kafka.Header{{Key: "uptrace-dsn"}}
+	require.Equal(t, "default", kafkaMessageDSN(msg, "default"))
+}
+
+func TestDecodeKafkaTraces(t *testing.T) {
+	b, err := proto.Marshal(&collectortrace.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource: &resourcepb.Resource{},
+			InstrumentationLibrarySpans: []*tracepb.InstrumentationLibrarySpans{{
+				Spans: []*tracepb.Span{{Name: "GET /users"}},
+			}},
+		}},
+	})
+	require.NoError(t, err)
+
+	req, err := decodeKafkaTraces(bunapp.KafkaEncodingProto, b)
+	require.NoError(t, err)
+	require.Equal(t, "GET /users", req.ResourceSpans[0].InstrumentationLibrarySpans[0].Spans[0].Name)
+
+	req, err = decodeKafkaTraces(bunapp.KafkaEncodingJSON,
+		[]byte(`{"resourceSpans":[{"scopeSpans":[{"spans":[{"name":"GET /users"}]}]}]}`))
+	require.NoError(t, err)
+	require.Equal(t, "GET /users", req.ResourceSpans[0].InstrumentationLibrarySpans[0].Spans[0].Name)
+
+	_, err = decodeKafkaTraces(bunapp.KafkaEncodingJSON, b)
+	require.Error(t, err)
+}
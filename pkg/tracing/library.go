@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/urlstruct"
+)
+
+type LibraryFilter struct {
+	*bunapp.App `urlstruct:"-"`
+
+	TimeFilter
+
+	ProjectID uint32
+	// Optional service name.
+	Service string
+}
+
+func DecodeLibraryFilter(app *bunapp.App, req bunrouter.Request) (*LibraryFilter, error) {
+	f := &LibraryFilter{App: app}
+	if err := bunapp.UnmarshalValues(req, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+var _ urlstruct.ValuesUnmarshaler = (*LibraryFilter)(nil)
+
+func (f *LibraryFilter) UnmarshalValues(ctx context.Context, values url.Values) error {
+	if err := f.TimeFilter.UnmarshalValues(ctx, values); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (f *LibraryFilter) whereClause(q *ch.SelectQuery) *ch.SelectQuery {
+	q = q.Where("project_id = ?", f.ProjectID).
+		Where("`span.time` >= ?", f.TimeGTE).
+		Where("`span.time` < ?", f.TimeLT).
+		Where("`span.event_name` = ''")
+	if f.Service != "" {
+		q = q.Where("`service.name` = ?", f.Service)
+	}
+	return q
+}
+
+//------------------------------------------------------------------------------
+
+// InstrumentationLibrary is an instrumentation library used by a service.
+// Spans without a library have an empty name.
+type InstrumentationLibrary struct {
+	Service  string    `json:"service" ch:"service.name"`
+	Name     string    `json:"name" ch:"otel.library.name"`
+	Version  string    `json:"version" ch:"otel.library.version"`
+	Count    float64   `json:"count"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+func selectLibraries(ctx context.Context, f *LibraryFilter) ([]InstrumentationLibrary, error) {
+	libs := make([]InstrumentationLibrary, 0)
+
+	if err := f.CH().NewSelect().
+		ColumnExpr("`service.name`, `otel.library.name`, `otel.library.version`").
+		ColumnExpr("sum(`span.count`) AS count").
+		ColumnExpr("max(`span.time`) AS last_seen").
+		Model((*SpanIndex)(nil)).
+		Apply(f.whereClause).
+		GroupExpr("`service.name`, `otel.library.name`, `otel.library.version`").
+		OrderExpr("`service.name` ASC, `otel.library.name` ASC, `otel.library.version` ASC").
+		Limit(1000).
+		Scan(ctx, &libs); err != nil {
+		return nil, err
+	}
+
+	return libs, nil
+}
+
+// Libraries returns instrumentation libraries that services use to create spans.
+func (h *ServiceHandler) Libraries(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	f, err := DecodeLibraryFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+
+	libs, err := selectLibraries(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"libraries": libs,
+	})
+}
@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	"github.com/vmihailenco/msgpack"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+)
+
+// Log is an OTLP log record.
+type Log struct {
+	ProjectID uint32    `json:"projectId"`
+	ID        uint64    `json:"id,string"`
+	TraceID   uuid.UUID `json:"traceId"`
+	SpanID    uint64    `json:"spanId,string,omitempty"`
+	Time      time.Time `json:"time"`
+	Severity  string    `json:"severity"`
+	Message   string    `json:"message"`
+	Attrs     AttrMap   `json:"attrs"`
+}
+
+type LogIndex struct {
+	ch.CHModel `ch:"table:logs_index_buffer,alias:l"`
+
+	ProjectID uint32
+	Severity  string    `ch:"log.severity,lc"`
+	Time      time.Time `ch:"log.time"`
+	ID        uint64    `ch:"log.id"`
+	TraceID   uuid.UUID `ch:"log.trace_id,type:UUID"`
+	SpanID    uint64    `ch:"log.span_id"`
+	Message   string    `ch:"log.message"`
+
+	AttrKeys   []string `ch:",lc"`
+	AttrValues []string
+
+	ServiceName string `ch:"service.name,lc"`
+	HostName    string `ch:"host.name,lc"`
+}
+
+type LogData struct {
+	ch.CHModel `ch:"table:logs_data_buffer,alias:l"`
+
+	ProjectID uint32
+	ID        uint64
+	Time      time.Time
+	Data      []byte
+}
+
+func newLog(dest *Log, projectID uint32, resource AttrMap, src *logspb.LogRecord) {
+	dest.ProjectID = projectID
+	dest.ID = rand.Uint64()
+	dest.TraceID = otlpTraceID(src.TraceId)
+	dest.SpanID = otlpSpanID(src.SpanId)
+
+	if src.TimeUnixNano != 0 {
+		dest.Time = time.Unix(0, int64(src.TimeUnixNano))
+	} else {
+		dest.Time = time.Now()
+	}
+
+	dest.Severity = src.SeverityText
+	if dest.Severity == "" {
+		dest.Severity = otlpLogSeverity(src.SeverityNumber)
+	}
+
+	if v, ok := otlpValue(src.Body); ok {
+		dest.Message = asString(v)
+	}
+
+	dest.Attrs = make(AttrMap, len(resource)+len(src.Attributes))
+	for k, v := range resource {
+		dest.Attrs[k] = v
+	}
+	otlpSetAttrs(dest.Attrs, src.Attributes)
+	canonicalizeAttrs(dest.Attrs)
+}
+
+// otlpLogSeverity returns the short name of the severity number range.
+func otlpLogSeverity(num logspb.SeverityNumber) string {
+	switch {
+	case num == logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED:
+		return "INFO"
+	case num <= logspb.SeverityNumber_SEVERITY_NUMBER_TRACE4:
+		return "TRACE"
+	case num <= logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG4:
+		return "DEBUG"
+	case num <= logspb.SeverityNumber_SEVERITY_NUMBER_INFO4:
+		return "INFO"
+	case num <= logspb.SeverityNumber_SEVERITY_NUMBER_WARN4:
+		return "WARN"
+	case num <= logspb.SeverityNumber_SEVERITY_NUMBER_ERROR4:
+		return "ERROR"
+	default:
+		return "FATAL"
+	}
+}
+
+func newLogIndex(index *LogIndex, log *Log) {
+	index.ProjectID = log.ProjectID
+	index.Severity = log.Severity
+	index.Time = log.Time
+	index.ID = log.ID
+	index.TraceID = log.TraceID
+	index.SpanID = log.SpanID
+	index.Message = log.Message
+
+	index.ServiceName, _ = log.Attrs[xattr.ServiceName].(string)
+	index.HostName, _ = log.Attrs[xattr.HostName].(string)
+
+	index.AttrKeys, index.AttrValues = attrKeysAndValues(log.Attrs)
+}
+
+func newLogData(data *LogData, log *Log) {
+	data.ProjectID = log.ProjectID
+	data.ID = log.ID
+	data.Time = log.Time
+
+	b, err := msgpack.Marshal(log)
+	if err != nil {
+		panic(err)
+	}
+	data.Data = b
+}
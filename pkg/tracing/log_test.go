@@ -0,0 +1,96 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+)
+
+func TestNewLog(t *testing.T) {
+	resource := AttrMap{xattr.ServiceName: "api"}
+	record := &logspb.LogRecord{
+		TimeUnixNano:   1643673600000000000,
+		SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_WARN2,
+		Body: &commonpb.AnyValue{
+			Value: &commonpb.AnyValue_StringValue{StringValue: "disk is almost full"},
+		},
+		Attributes: []*commonpb.KeyValue{otlpStringAttr("disk", "/dev/sda1")},
+	}
+
+	log := new(Log)
+	newLog(log, 1, resource, record)
+	require.Equal(t, uint32(1), log.ProjectID)
+	require.Equal(t, "WARN", log.Severity)
+	require.Equal(t, "disk is almost full", log.Message)
+	require.Equal(t, int64(1643673600), log.Time.Unix())
+	require.Equal(t, "/dev/sda1", log.Attrs["disk"])
+
+	index := new(LogIndex)
+	newLogIndex(index, log)
+	require.Equal(t, "api", index.ServiceName)
+	require.Equal(t, []string{"disk"}, index.AttrKeys)
+}
+
+func TestOTLPLogSeverity(t *testing.T) {
+	require.Equal(t, "INFO", otlpLogSeverity(logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED))
+	require.Equal(t, "TRACE", otlpLogSeverity(logspb.SeverityNumber_SEVERITY_NUMBER_TRACE))
+	require.Equal(t, "DEBUG", otlpLogSeverity(logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG4))
+	require.Equal(t, "ERROR", otlpLogSeverity(logspb.SeverityNumber_SEVERITY_NUMBER_ERROR))
+	require.Equal(t, "FATAL", otlpLogSeverity(logspb.SeverityNumber_SEVERITY_NUMBER_FATAL3))
+}
+
+func TestProcessLogsBackpressure(t *testing.T) {
+	conf := &bunapp.AppConfig{
+		Projects: []bunapp.Project{{
+			ID:          1,
+			IngestQuota: &bunapp.IngestQuota{SpansPerSecond: 1, Burst: 3},
+		}},
+	}
+	conf.CH.DSN = "clickhouse://default:@localhost:9000/uptrace?sslmode=disable"
+	conf.SpanBackpressure.RetryAfter = 3 * time.Second
+
+	app := bunapp.New(context.Background(), conf)
+	defer app.Stop()
+
+	// The channel is never drained, so the second request does not fit.
+	s := &LogsServiceServer{App: app, ch: make(chan []Log, 1), quotas: new(ingestQuotas)}
+	project := &conf.Projects[0]
+	resourceLogs := []*logspb.ResourceLogs{{
+		InstrumentationLibraryLogs: []*logspb.InstrumentationLibraryLogs{{
+			LogRecords: []*logspb.LogRecord{{
+				TimeUnixNano: 1643673600000000000,
+				Body: &commonpb.AnyValue{
+					Value: &commonpb.AnyValue_StringValue{StringValue: "disk is almost full"},
+				},
+			}},
+		}},
+	}}
+
+	conf.SpanBackpressure.Policy = bunapp.SpanBackpressureDrop
+	require.NoError(t, s.process(project, resourceLogs))
+	require.NoError(t, s.process(project, resourceLogs))
+	require.Len(t, s.ch, 1)
+
+	conf.SpanBackpressure.Policy = bunapp.SpanBackpressureReject
+	err := s.process(project, resourceLogs)
+	require.Equal(t, "log_queue_full", httperror.From(err).Code)
+	require.Equal(t, 3*time.Second, httperror.From(err).RetryAfter)
+
+	// Only the queued log records are charged to the project quota.
+	for i := 0; i < 2; i++ {
+		<-s.ch
+		require.NoError(t, s.process(project, resourceLogs))
+	}
+	<-s.ch
+	err = s.process(project, resourceLogs)
+	require.Equal(t, http.StatusTooManyRequests, httperror.From(err).Status)
+	require.Equal(t, "ingest_rate_limited", httperror.From(err).Code)
+}
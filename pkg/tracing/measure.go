@@ -0,0 +1,199 @@
+package tracing
+
+import (
+	"math"
+	"time"
+
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+const (
+	gaugeInstrument     = "gauge"
+	counterInstrument   = "counter"  // monotonic sum
+	additiveInstrument  = "additive" // non-monotonic sum
+	histogramInstrument = "histogram"
+	summaryInstrument   = "summary"
+)
+
+// Measure is an OTLP data point.
+type Measure struct {
+	ch.CHModel `ch:"table:measures_buffer,alias:m"`
+
+	ProjectID   uint32
+	Metric      string `ch:",lc"`
+	Instrument  string `ch:",lc"`
+	Unit        string `ch:",lc"`
+	Temporality string `ch:",lc"`
+	Time        time.Time
+	StartTime   time.Time
+
+	AttrKeys   []string `ch:",lc"`
+	AttrValues []string
+
+	ServiceName string `ch:"service.name,lc"`
+	HostName    string `ch:"host.name,lc"`
+
+	Value float64
+
+	Sum            float64
+	Count          uint64
+	Bounds         []float64
+	BucketCounts   []uint64
+	Quantiles      []float64
+	QuantileValues []float64
+}
+
+// appendMeasures converts the data points of the metric to measures.
+// Data points without a recorded value are skipped.
+func appendMeasures(
+	dest []Measure, projectID uint32, resource AttrMap, metric *metricspb.Metric,
+) []Measure {
+	newMeasure := func(
+		instrument string,
+		temporality metricspb.AggregationTemporality,
+		kvs []*commonpb.KeyValue,
+		startTime, tm uint64,
+	) *Measure {
+		attrs := resource.Clone()
+		otlpSetAttrs(attrs, kvs)
+
+		dest = append(dest, Measure{
+			ProjectID:   projectID,
+			Metric:      metric.Name,
+			Instrument:  instrument,
+			Unit:        metric.Unit,
+			Temporality: otlpTemporality(temporality),
+			Time:        time.Unix(0, int64(tm)),
+			StartTime:   time.Unix(0, int64(startTime)),
+		})
+		m := &dest[len(dest)-1]
+		m.ServiceName, _ = attrs[xattr.ServiceName].(string)
+		m.HostName, _ = attrs[xattr.HostName].(string)
+		m.AttrKeys, m.AttrValues = attrKeysAndValues(attrs)
+		return m
+	}
+
+	switch data := metric.Data.(type) {
+	case *metricspb.Metric_Gauge:
+		for _, dp := range data.Gauge.DataPoints {
+			if noRecordedValue(dp.Flags) {
+				continue
+			}
+			m := newMeasure(gaugeInstrument, 0, dp.Attributes, dp.StartTimeUnixNano, dp.TimeUnixNano)
+			m.Value = numberValue(dp)
+		}
+	case *metricspb.Metric_Sum:
+		instrument := additiveInstrument
+		if data.Sum.IsMonotonic {
+			instrument = counterInstrument
+		}
+		for _, dp := range data.Sum.DataPoints {
+			if noRecordedValue(dp.Flags) {
+				continue
+			}
+			m := newMeasure(instrument, data.Sum.AggregationTemporality,
+				dp.Attributes, dp.StartTimeUnixNano, dp.TimeUnixNano)
+			m.Value = numberValue(dp)
+		}
+	case *metricspb.Metric_Histogram:
+		for _, dp := range data.Histogram.DataPoints {
+			if noRecordedValue(dp.Flags) {
+				continue
+			}
+			m := newMeasure(histogramInstrument, data.Histogram.AggregationTemporality,
+				dp.Attributes, dp.StartTimeUnixNano, dp.TimeUnixNano)
+			m.Sum = dp.Sum
+			m.Count = dp.Count
+			m.Bounds = dp.ExplicitBounds
+			m.BucketCounts = dp.BucketCounts
+		}
+	case *metricspb.Metric_ExponentialHistogram:
+		for _, dp := range data.ExponentialHistogram.DataPoints {
+			if noRecordedValue(dp.Flags) {
+				continue
+			}
+			m := newMeasure(histogramInstrument, data.ExponentialHistogram.AggregationTemporality,
+				dp.Attributes, dp.StartTimeUnixNano, dp.TimeUnixNano)
+			m.Sum = dp.Sum
+			m.Count = dp.Count
+			m.Bounds, m.BucketCounts = expHistogramBuckets(dp)
+		}
+	case *metricspb.Metric_Summary:
+		for _, dp := range data.Summary.DataPoints {
+			if noRecordedValue(dp.Flags) {
+				continue
+			}
+			m := newMeasure(summaryInstrument, 0, dp.Attributes, dp.StartTimeUnixNano, dp.TimeUnixNano)
+			m.Sum = dp.Sum
+			m.Count = dp.Count
+			m.Quantiles = make([]float64, len(dp.QuantileValues))
+			m.QuantileValues = make([]float64, len(dp.QuantileValues))
+			for i, q := range dp.QuantileValues {
+				m.Quantiles[i] = q.Quantile
+				m.QuantileValues[i] = q.Value
+			}
+		}
+	}
+
+	return dest
+}
+
+func otlpTemporality(temporality metricspb.AggregationTemporality) string {
+	switch temporality {
+	case metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA:
+		return "delta"
+	case metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE:
+		return "cumulative"
+	default:
+		return ""
+	}
+}
+
+func noRecordedValue(flags uint32) bool {
+	return flags&uint32(metricspb.DataPointFlags_FLAG_NO_RECORDED_VALUE) != 0
+}
+
+func numberValue(dp *metricspb.NumberDataPoint) float64 {
+	switch v := dp.Value.(type) {
+	case *metricspb.NumberDataPoint_AsDouble:
+		return v.AsDouble
+	case *metricspb.NumberDataPoint_AsInt:
+		return float64(v.AsInt)
+	default:
+		return 0
+	}
+}
+
+// expHistogramBuckets converts an exponential histogram to explicit upper bounds
+// so all histograms can be queried the same way. Like in OTLP histograms, there is
+// one more bucket count than bounds.
+func expHistogramBuckets(dp *metricspb.ExponentialHistogramDataPoint) ([]float64, []uint64) {
+	base := math.Exp2(math.Exp2(-float64(dp.Scale)))
+
+	var bounds []float64
+	var counts []uint64
+
+	// Bucket at index i contains values in (base^i, base^(i+1)].
+	if neg := dp.Negative; neg != nil {
+		for i := len(neg.BucketCounts) - 1; i >= 0; i-- {
+			bounds = append(bounds, -math.Pow(base, float64(int(neg.Offset)+i)))
+			counts = append(counts, neg.BucketCounts[i])
+		}
+	}
+	if dp.ZeroCount > 0 {
+		bounds = append(bounds, 0)
+		counts = append(counts, dp.ZeroCount)
+	}
+	if pos := dp.Positive; pos != nil {
+		for i, count := range pos.BucketCounts {
+			bounds = append(bounds, math.Pow(base, float64(int(pos.Offset)+i+1)))
+			counts = append(counts, count)
+		}
+	}
+
+	counts = append(counts, 0)
+	return bounds, counts
+}
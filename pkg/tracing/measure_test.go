@@ -0,0 +1,118 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+func TestAppendMeasures(t *testing.T) {
+	resource := AttrMap{xattr.ServiceName: "api", xattr.HostName: "host1"}
+
+	measures := appendMeasures(nil, 1, resource, &metricspb.Metric{
+		Name: "http.requests",
+		Unit: "1",
+		Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			IsMonotonic:            true,
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+			DataPoints: []*metricspb.NumberDataPoint{
+				{
+					Attributes: []*commonpb.KeyValue{otlpStringAttr("http.method", "GET")},
+					Value:      &metricspb.NumberDataPoint_AsInt{AsInt: 10},
+				},
+				{
+					Flags: uint32(metricspb.DataPointFlags_FLAG_NO_RECORDED_VALUE),
+				},
+			},
+		}},
+	})
+	require.Len(t, measures, 1)
+
+	m := &measures[0]
+	require.Equal(t, "http.requests", m.Metric)
+	require.Equal(t, counterInstrument, m.Instrument)
+	require.Equal(t, "delta", m.Temporality)
+	require.Equal(t, "api", m.ServiceName)
+	require.Equal(t, "host1", m.HostName)
+	require.Equal(t, []string{"http.method"}, m.AttrKeys)
+	require.Equal(t, []string{"GET"}, m.AttrValues)
+	require.Equal(t, 10.0, m.Value)
+
+	measures = appendMeasures(measures[:0], 1, resource, &metricspb.Metric{
+		Name: "rpc.latencies",
+		Data: &metricspb.Metric_Summary{Summary: &metricspb.Summary{
+			DataPoints: []*metricspb.SummaryDataPoint{{
+				Count: 3,
+				Sum:   6,
+				QuantileValues: []*metricspb.SummaryDataPoint_ValueAtQuantile{
+					{Quantile: 0.5, Value: 2},
+					{Quantile: 0.99, Value: 3},
+				},
+			}},
+		}},
+	})
+	require.Len(t, measures, 1)
+	require.Equal(t, summaryInstrument, measures[0].Instrument)
+	require.Equal(t, []float64{0.5, 0.99}, measures[0].Quantiles)
+	require.Equal(t, []float64{2, 3}, measures[0].QuantileValues)
+}
+
+func TestExpHistogramBuckets(t *testing.T) {
+	bounds, counts := expHistogramBuckets(&metricspb.ExponentialHistogramDataPoint{
+		Scale:     0,
+		ZeroCount: 1,
+		Positive: &metricspb.ExponentialHistogramDataPoint_Buckets{
+			Offset:       1,
+			BucketCounts: []uint64{2, 3},
+		},
+		Negative: &metricspb.ExponentialHistogramDataPoint_Buckets{
+			BucketCounts: []uint64{4},
+		},
+	})
+	require.Equal(t, []float64{-1, 0, 4, 8}, bounds)
+	require.Equal(t, []uint64{4, 1, 2, 3, 0}, counts)
+}
+
+func TestProcessMetricsBackpressure(t *testing.T) {
+	conf := &bunapp.AppConfig{
+		Projects: []bunapp.Project{{ID: 1}},
+	}
+	conf.CH.DSN = "clickhouse://default:@localhost:9000/uptrace?sslmode=disable"
+	conf.SpanBackpressure.RetryAfter = 3 * time.Second
+
+	app := bunapp.New(context.Background(), conf)
+	defer app.Stop()
+
+	// The channel is never drained, so the second request does not fit.
+	s := &MetricsServiceServer{App: app, ch: make(chan []Measure, 1)}
+	project := &conf.Projects[0]
+	resourceMetrics := []*metricspb.ResourceMetrics{{
+		InstrumentationLibraryMetrics: []*metricspb.InstrumentationLibraryMetrics{{
+			Metrics: []*metricspb.Metric{{
+				Name: "queue.length",
+				Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+					DataPoints: []*metricspb.NumberDataPoint{{
+						Value: &metricspb.NumberDataPoint_AsInt{AsInt: 10},
+					}},
+				}},
+			}},
+		}},
+	}}
+
+	conf.SpanBackpressure.Policy = bunapp.SpanBackpressureDrop
+	require.NoError(t, s.process(project, resourceMetrics))
+	require.NoError(t, s.process(project, resourceMetrics))
+	require.Len(t, s.ch, 1)
+
+	conf.SpanBackpressure.Policy = bunapp.SpanBackpressureReject
+	err := s.process(project, resourceMetrics)
+	require.Equal(t, "metric_queue_full", httperror.From(err).Code)
+	require.Equal(t, 3*time.Second, httperror.From(err).RetryAfter)
+}
@@ -0,0 +1,254 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	"github.com/uptrace/uptrace/pkg/urlstruct"
+)
+
+var (
+	// Boolean attributes that messaging systems use to mark redelivered messages.
+	redeliveredAttrs = []string{
+		xattr.MessagingRedelivered,
+		"messaging.rabbitmq.redelivered",
+	}
+	// Delivery counters that start at 1 for the first delivery.
+	deliveryCountAttrs = []string{
+		"messaging.message.delivery_count",
+		"messaging.servicebus.message.delivery_count",
+		"messaging.attempt",
+	}
+	// Retry counters that start at 0 for the first delivery.
+	retryCountAttrs = []string{
+		xattr.MessagingRetryCount,
+		"messaging.kafka.retry_count",
+	}
+)
+
+// normalizeMessagingRetry sets messaging.retry_count and messaging.redelivered
+// from the system-specific attributes so retries can be counted with the same
+// attributes regardless of the messaging system.
+func normalizeMessagingRetry(attrs AttrMap) {
+	if !attrs.Has(xattr.MessagingSystem) {
+		return
+	}
+
+	var retryCount int64
+	for _, key := range retryCountAttrs {
+		if n := attrs.Int64(key); n > retryCount {
+			retryCount = n
+		}
+	}
+	for _, key := range deliveryCountAttrs {
+		if n := attrs.Int64(key) - 1; n > retryCount {
+			retryCount = n
+		}
+	}
+
+	redelivered := retryCount > 0
+	for _, key := range redeliveredAttrs {
+		if v, _ := attrs[key].(bool); v {
+			redelivered = true
+		}
+	}
+
+	if retryCount > 0 {
+		attrs[xattr.MessagingRetryCount] = retryCount
+	}
+	if redelivered {
+		attrs[xattr.MessagingRedelivered] = true
+	}
+}
+
+// isDeadLetterDestination reports whether the destination is a dead letter queue,
+// for example, orders.dlq, orders-dead-letter, or orders/$DeadLetterQueue.
+func isDeadLetterDestination(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range []string{"dlq", "deadletter", "dead-letter", "dead_letter", "dead.letter"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+//------------------------------------------------------------------------------
+
+type MessagingFilter struct {
+	*bunapp.App `urlstruct:"-"`
+
+	TimeFilter
+
+	ProjectID uint32
+	// Optional service name.
+	Service string
+}
+
+func DecodeMessagingFilter(app *bunapp.App, req bunrouter.Request) (*MessagingFilter, error) {
+	f := &MessagingFilter{App: app}
+	if err := bunapp.UnmarshalValues(req, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+var _ urlstruct.ValuesUnmarshaler = (*MessagingFilter)(nil)
+
+func (f *MessagingFilter) UnmarshalValues(ctx context.Context, values url.Values) error {
+	if err := f.TimeFilter.UnmarshalValues(ctx, values); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (f *MessagingFilter) whereClause(q *ch.SelectQuery) *ch.SelectQuery {
+	q = q.Where("project_id = ?", f.ProjectID).
+		Where("`span.time` >= ?", f.TimeGTE).
+		Where("`span.time` < ?", f.TimeLT).
+		Where("startsWith(`span.system`, ?)", messagingSpanType+":").
+		Where("`span.event_name` = ''")
+	if f.Service != "" {
+		q = q.Where("`service.name` = ?", f.Service)
+	}
+	return q
+}
+
+//------------------------------------------------------------------------------
+
+// MessagingDestination contains message rates of a queue or topic. Messages sent
+// to a dead letter queue are counted as dead lettered messages of the system.
+type MessagingDestination struct {
+	System      string `json:"system"`
+	Destination string `json:"destination"`
+	Operation   string `json:"operation"`
+	DeadLetter  bool   `json:"deadLetter"`
+
+	Count      float64 `json:"count"`
+	Rate       float64 `json:"rate"`
+	ErrorCount float64 `json:"errorCount"`
+	RetryCount float64 `json:"retryCount"`
+	RetryPct   float64 `json:"retryPct"`
+	// Max number of retries of a message.
+	MaxRetries float64 `json:"maxRetries"`
+}
+
+func selectMessagingDestinations(
+	ctx context.Context, f *MessagingFilter,
+) ([]MessagingDestination, error) {
+	dests := make([]MessagingDestination, 0)
+
+	if err := f.CH().NewSelect().
+		ColumnExpr("`span.system` AS system").
+		ColumnExpr("? AS destination", chColumn(xattr.MessagingDestination)).
+		ColumnExpr("? AS operation", chColumn(xattr.MessagingOperation)).
+		ColumnExpr("toFloat64(sum(`span.count`)) AS count").
+		ColumnExpr("count / ? AS rate", f.Duration().Minutes()).
+		ColumnExpr("toFloat64(sumIf(`span.count`, `span.status_code` = ?)) AS error_count",
+			errorStatusCode).
+		ColumnExpr("toFloat64(sumIf(`span.count`, ? = 'true')) AS retry_count",
+			chColumn(xattr.MessagingRedelivered)).
+		ColumnExpr("toFloat64(max(toUInt64OrZero(?))) AS max_retries",
+			chColumn(xattr.MessagingRetryCount)).
+		Model((*SpanIndex)(nil)).
+		Apply(f.whereClause).
+		GroupExpr("system, destination, operation").
+		OrderExpr("count DESC").
+		Limit(1000).
+		Scan(ctx, &dests); err != nil {
+		return nil, err
+	}
+
+	for i := range dests {
+		dest := &dests[i]
+		dest.DeadLetter = isDeadLetterDestination(dest.Destination)
+		if dest.Count > 0 {
+			dest.RetryPct = dest.RetryCount / dest.Count
+		}
+	}
+
+	return dests, nil
+}
+
+type MessagingSystemStats struct {
+	System          string  `json:"system"`
+	Count           float64 `json:"count"`
+	RetryCount      float64 `json:"retryCount"`
+	DeadLetterCount float64 `json:"deadLetterCount"`
+	DeadLetterPct   float64 `json:"deadLetterPct"`
+}
+
+// messagingSystemStats sums destinations by the system. Dead letter destinations
+// are not included in the total so the percent shows the share of messages that
+// were dead lettered.
+func messagingSystemStats(dests []MessagingDestination) []MessagingSystemStats {
+	index := make(map[string]int)
+	stats := make([]MessagingSystemStats, 0)
+
+	for i := range dests {
+		dest := &dests[i]
+
+		idx, ok := index[dest.System]
+		if !ok {
+			idx = len(stats)
+			index[dest.System] = idx
+			stats = append(stats, MessagingSystemStats{System: dest.System})
+		}
+
+		sys := &stats[idx]
+		if dest.DeadLetter {
+			sys.DeadLetterCount += dest.Count
+			continue
+		}
+		sys.Count += dest.Count
+		sys.RetryCount += dest.RetryCount
+	}
+
+	for i := range stats {
+		sys := &stats[i]
+		if sys.Count > 0 {
+			sys.DeadLetterPct = sys.DeadLetterCount / sys.Count
+		}
+	}
+
+	return stats
+}
+
+//------------------------------------------------------------------------------
+
+type MessagingHandler struct {
+	*bunapp.App
+}
+
+func NewMessagingHandler(app *bunapp.App) *MessagingHandler {
+	return &MessagingHandler{
+		App: app,
+	}
+}
+
+// Destinations returns message, retry, and dead letter rates of messaging destinations.
+func (h *MessagingHandler) Destinations(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	f, err := DecodeMessagingFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+
+	dests, err := selectMessagingDestinations(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"destinations": dests,
+		"systems":      messagingSystemStats(dests),
+	})
+}
@@ -0,0 +1,47 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+)
+
+func TestNormalizeMessagingRetry(t *testing.T) {
+	type Test struct {
+		attrs       AttrMap
+		retryCount  int64
+		redelivered bool
+	}
+
+	tests := []Test{
+		{AttrMap{xattr.MessagingSystem: "kafka"}, 0, false},
+		{AttrMap{xattr.MessagingSystem: "rabbitmq", "messaging.rabbitmq.redelivered": true}, 0, true},
+		{AttrMap{xattr.MessagingSystem: "servicebus", "messaging.message.delivery_count": int64(1)}, 0, false},
+		{AttrMap{xattr.MessagingSystem: "servicebus", "messaging.message.delivery_count": int64(3)}, 2, true},
+		{AttrMap{xattr.MessagingSystem: "kafka", "messaging.kafka.retry_count": int64(1)}, 1, true},
+		{AttrMap{"messaging.retry_count": int64(1)}, 1, false},
+	}
+	for i, test := range tests {
+		normalizeMessagingRetry(test.attrs)
+		require.Equal(t, test.retryCount, test.attrs.Int64(xattr.MessagingRetryCount), "#%d", i)
+		redelivered, _ := test.attrs[xattr.MessagingRedelivered].(bool)
+		require.Equal(t, test.redelivered, redelivered, "#%d", i)
+	}
+}
+
+func TestMessagingSystemStats(t *testing.T) {
+	dests := []MessagingDestination{
+		{System: "messaging:kafka", Destination: "orders", Count: 90, RetryCount: 9},
+		{System: "messaging:kafka", Destination: "orders.DLQ", Count: 9},
+		{System: "messaging:sqs", Destination: "emails", Count: 10},
+	}
+	for i := range dests {
+		dests[i].DeadLetter = isDeadLetterDestination(dests[i].Destination)
+	}
+
+	require.Equal(t, []MessagingSystemStats{
+		{System: "messaging:kafka", Count: 90, RetryCount: 9, DeadLetterCount: 9, DeadLetterPct: 0.1},
+		{System: "messaging:sqs", Count: 10},
+	}, messagingSystemStats(dests))
+}
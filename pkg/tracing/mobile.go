@@ -0,0 +1,276 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	"github.com/uptrace/uptrace/pkg/urlstruct"
+	"go4.org/syncutil"
+)
+
+// Attributes that mobile instrumentations use for the app lifecycle state,
+// for example, foreground or background.
+var appStateAttrs = []string{
+	"android.app.state",
+	"ios.app.state",
+}
+
+// mobileCrashType returns crashEventType or anrEventType if the event is a crash or
+// an ANR (Application Not Responding) of a mobile app.
+func mobileCrashType(span *Span) string {
+	switch strings.ToLower(span.EventName) {
+	case "crash", "app.crash", "device.crash":
+		return crashEventType
+	case "anr", "app.anr", "device.anr":
+		return anrEventType
+	case exceptionEventType, errorEventType:
+	default:
+		return ""
+	}
+
+	typ := span.Attrs.Text(xattr.ExceptionType)
+	if strings.Contains(typ, "ApplicationNotResponding") || strings.Contains(typ, "AppHang") {
+		return anrEventType
+	}
+	if exceptionEscaped(span.Attrs) && isMobileApp(span.Attrs) {
+		return crashEventType
+	}
+	return ""
+}
+
+func exceptionEscaped(attrs AttrMap) bool {
+	switch v := attrs[xattr.ExceptionEscaped].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	default:
+		return false
+	}
+}
+
+func isMobileApp(attrs AttrMap) bool {
+	switch strings.ToLower(attrs.Text(xattr.OSName)) {
+	case "android", "ios", "ipados":
+		return true
+	}
+	return attrs.Has(xattr.DeviceModelIdentifier)
+}
+
+func assignMobileCrashSystemAndGroupID(ctx *spanContext, span *Span, system string) {
+	if !span.Attrs.Has(xattr.AppState) {
+		for _, key := range appStateAttrs {
+			if s := span.Attrs.Text(key); s != "" {
+				span.Attrs[xattr.AppState] = s
+				break
+			}
+		}
+	}
+
+	span.System = system
+	span.GroupID = spanHash(ctx.digest, func(digest *xxhash.Digest) {
+		hashSpan(digest, span, exceptionGroupingAttrs...)
+		// Crash messages often contain addresses and ids so the crashing frame
+		// is used instead when there is one.
+		if frame := topStackFrame(span.Attrs.Text(xattr.ExceptionStacktrace)); frame != "" {
+			digest.WriteString(frame)
+		} else if s := span.Attrs.Text(xattr.ExceptionMessage); s != "" {
+			hashMessage(digest, s)
+		}
+	})
+
+	span.EventName = joinTypeMessage(
+		span.Attrs.Text(xattr.ExceptionType),
+		span.Attrs.Text(xattr.ExceptionMessage),
+	)
+	if span.EventName == "" {
+		span.EventName = system
+	}
+}
+
+// appleFrameRe matches frames of Apple crash reports, for example,
+// "3   MyApp   0x0000000100a1c2d4 -[ViewController load] + 52".
+var appleFrameRe = regexp.MustCompile(`^\d+\s+(\S+)\s+0x[0-9a-fA-F]+\s+(.+?)(?:\s+\+\s+\d+)?$`)
+
+// topStackFrame returns the first frame of a JVM or Apple stack trace without line
+// numbers and addresses that change between builds.
+func topStackFrame(stack string) string {
+	for _, line := range strings.Split(stack, "\n") {
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "at ") {
+			frame := strings.TrimPrefix(line, "at ")
+			if i := strings.IndexByte(frame, '('); i >= 0 {
+				frame = frame[:i]
+			}
+			return frame
+		}
+
+		if m := appleFrameRe.FindStringSubmatch(line); m != nil {
+			return m[1] + " " + m[2]
+		}
+	}
+	return ""
+}
+
+//------------------------------------------------------------------------------
+
+type MobileCrashFilter struct {
+	*bunapp.App `urlstruct:"-"`
+
+	TimeFilter
+
+	ProjectID uint32
+	Service   string
+}
+
+func DecodeMobileCrashFilter(app *bunapp.App, req bunrouter.Request) (*MobileCrashFilter, error) {
+	f := &MobileCrashFilter{App: app}
+	if err := bunapp.UnmarshalValues(req, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+var _ urlstruct.ValuesUnmarshaler = (*MobileCrashFilter)(nil)
+
+func (f *MobileCrashFilter) UnmarshalValues(ctx context.Context, values url.Values) error {
+	if err := f.TimeFilter.UnmarshalValues(ctx, values); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (f *MobileCrashFilter) whereClause(q *ch.SelectQuery) *ch.SelectQuery {
+	q = q.Where("project_id = ?", f.ProjectID).
+		Where("`span.time` >= ?", f.TimeGTE).
+		Where("`span.time` < ?", f.TimeLT)
+	if f.Service != "" {
+		q = q.Where("`service.name` = ?", f.Service)
+	}
+	return q
+}
+
+//------------------------------------------------------------------------------
+
+// AppVersionCrashes contains crash and ANR rates of an app version. Rates are
+// calculated using sessions so spans without session.id are not counted.
+type AppVersionCrashes struct {
+	Version string `json:"version"`
+
+	Sessions        float64 `json:"sessions"`
+	CrashedSessions float64 `json:"crashedSessions"`
+	CrashCount      float64 `json:"crashCount"`
+	ANRCount        float64 `json:"anrCount" ch:"anr_count"`
+	CrashRate       float64 `json:"crashRate" ch:"-"`
+}
+
+func selectAppVersionCrashes(ctx context.Context, f *MobileCrashFilter) ([]AppVersionCrashes, error) {
+	versions := make([]AppVersionCrashes, 0)
+
+	sessionID := chColumn(xattr.SessionID)
+	if err := f.CH().NewSelect().
+		ColumnExpr("? AS version", chColumn(xattr.ServiceVersion)).
+		ColumnExpr("toFloat64(uniqIf(?, ? != '')) AS sessions", sessionID, sessionID).
+		ColumnExpr("toFloat64(uniqIf(?, ? != '' AND `span.system` IN (?, ?))) AS crashed_sessions",
+			sessionID, sessionID, crashEventType, anrEventType).
+		ColumnExpr("toFloat64(sumIf(`span.count`, `span.system` = ?)) AS crash_count",
+			crashEventType).
+		ColumnExpr("toFloat64(sumIf(`span.count`, `span.system` = ?)) AS anr_count",
+			anrEventType).
+		Model((*SpanIndex)(nil)).
+		Apply(f.whereClause).
+		GroupExpr("version").
+		Having("crash_count > 0 OR anr_count > 0 OR sessions > 0").
+		OrderExpr("version DESC").
+		Limit(100).
+		Scan(ctx, &versions); err != nil {
+		return nil, err
+	}
+
+	for i := range versions {
+		v := &versions[i]
+		if v.Sessions > 0 {
+			v.CrashRate = v.CrashedSessions / v.Sessions
+		}
+	}
+
+	return versions, nil
+}
+
+type MobileCrashGroup struct {
+	System   string   `json:"system"`
+	GroupID  uint64   `json:"groupId,string"`
+	Name     string   `json:"name"`
+	Count    float64  `json:"count"`
+	Versions []string `json:"versions"`
+	OSNames  []string `json:"osNames" ch:"os_names"`
+	// App lifecycle states, for example, foreground or background.
+	AppStates []string `json:"appStates"`
+}
+
+func selectMobileCrashGroups(ctx context.Context, f *MobileCrashFilter) ([]MobileCrashGroup, error) {
+	groups := make([]MobileCrashGroup, 0)
+
+	if err := f.CH().NewSelect().
+		ColumnExpr("`span.system` AS system, `span.group_id` AS group_id").
+		ColumnExpr("any(`span.event_name`) AS name").
+		ColumnExpr("toFloat64(sum(`span.count`)) AS count").
+		ColumnExpr("groupUniqArray(10)(?) AS versions", chColumn(xattr.ServiceVersion)).
+		ColumnExpr("groupUniqArray(10)(?) AS os_names", chColumn(xattr.OSName)).
+		ColumnExpr("groupUniqArray(10)(?) AS app_states", chColumn(xattr.AppState)).
+		Model((*SpanIndex)(nil)).
+		Apply(f.whereClause).
+		Where("`span.system` IN (?, ?)", crashEventType, anrEventType).
+		GroupExpr("system, group_id").
+		OrderExpr("count DESC").
+		Limit(100).
+		Scan(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+//------------------------------------------------------------------------------
+
+// MobileCrashes returns crash and ANR rates by app version and crash groups.
+func (h *ServiceHandler) MobileCrashes(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	f, err := DecodeMobileCrashFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+
+	var versions []AppVersionCrashes
+	var groups []MobileCrashGroup
+	var group syncutil.Group
+
+	group.Go(func() (err error) {
+		versions, err = selectAppVersionCrashes(ctx, f)
+		return err
+	})
+	group.Go(func() (err error) {
+		groups, err = selectMobileCrashGroups(ctx, f)
+		return err
+	})
+
+	if err := group.Err(); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"versions": versions,
+		"groups":   groups,
+	})
+}
@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+)
+
+func TestMobileCrashType(t *testing.T) {
+	type Test struct {
+		span *Span
+		typ  string
+	}
+
+	tests := []Test{
+		{&Span{EventName: "device.crash", Attrs: AttrMap{}}, crashEventType},
+		{&Span{EventName: "exception", Attrs: AttrMap{
+			xattr.ExceptionEscaped: true,
+			xattr.OSName:           "Android",
+		}}, crashEventType},
+		{&Span{EventName: "exception", Attrs: AttrMap{
+			xattr.ExceptionEscaped: true,
+		}}, ""},
+		{&Span{EventName: "exception", Attrs: AttrMap{
+			xattr.ExceptionType: "io.opentelemetry.android.anr.ApplicationNotResponding",
+		}}, anrEventType},
+		{&Span{EventName: "log", Attrs: AttrMap{xattr.OSName: "iOS"}}, ""},
+	}
+	for i, test := range tests {
+		require.Equal(t, test.typ, mobileCrashType(test.span), "#%d", i)
+	}
+}
+
+func TestTopStackFrame(t *testing.T) {
+	require.Equal(t, "com.example.MainActivity.onCreate", topStackFrame(
+		"java.lang.IllegalStateException: boom\n"+
+			"\tat com.example.MainActivity.onCreate(MainActivity.kt:42)\n"+
+			"\tat android.app.Activity.performCreate(Activity.java:8000)\n"))
+	require.Equal(t, "MyApp -[ViewController load]", topStackFrame(
+		"0   MyApp   0x0000000100a1c2d4 -[ViewController load] + 52\n"+
+			"1   UIKitCore   0x00000001b2c3d4e5 -[UIViewController loadViewIfRequired] + 100\n"))
+	require.Equal(t, "", topStackFrame("something went wrong"))
+}
@@ -79,6 +79,10 @@ const (
 	consumerSpanKind = "consumer"
 )
 
+var spanKindSet = listToSet([]string{
+	internalSpanKind, serverSpanKind, clientSpanKind, producerSpanKind, consumerSpanKind,
+})
+
 func otlpSpanKind(kind tracepb.Span_SpanKind) string {
 	switch kind {
 	case tracepb.Span_SPAN_KIND_SERVER:
@@ -98,6 +102,8 @@ const (
 	errorStatusCode = "error"
 )
 
+var statusCodeSet = listToSet([]string{okStatusCode, errorStatusCode})
+
 func otlpStatusCode(code tracepb.Status_StatusCode) string {
 	switch code {
 	case tracepb.Status_STATUS_CODE_ERROR:
@@ -118,13 +124,13 @@ func otlpSetAttrs(dest AttrMap, kvs []*commonpb.KeyValue) {
 		if kv == nil || kv.Value == nil {
 			continue
 		}
-		if value, ok := otlpValue(*kv.Value); ok {
+		if value, ok := otlpValue(kv.Value); ok {
 			dest[kv.Key] = value
 		}
 	}
 }
 
-func otlpValue(v commonpb.AnyValue) (any, bool) {
+func otlpValue(v *commonpb.AnyValue) (any, bool) {
 	switch v := v.Value.(type) {
 	case *commonpb.AnyValue_StringValue:
 		return v.StringValue, true
@@ -199,3 +205,54 @@ func otlpArray(vs []*commonpb.AnyValue) ([]string, bool) {
 		return nil, false
 	}
 }
+
+//------------------------------------------------------------------------------
+
+// The following helpers are used by receivers that convert foreign formats to OTLP.
+
+func otlpStringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+func otlpIntAttr(key string, value int64) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: value}},
+	}
+}
+
+func otlpDoubleAttr(key string, value float64) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: value}},
+	}
+}
+
+func otlpBoolAttr(key string, value bool) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: value}},
+	}
+}
+
+// otlpAnyAttr converts a decoded JSON value to an OTLP attribute.
+func otlpAnyAttr(key string, value any) *commonpb.KeyValue {
+	switch value := value.(type) {
+	case string:
+		return otlpStringAttr(key, value)
+	case bool:
+		return otlpBoolAttr(key, value)
+	case int64:
+		return otlpIntAttr(key, value)
+	case float64:
+		if value == float64(int64(value)) {
+			return otlpIntAttr(key, int64(value))
+		}
+		return otlpDoubleAttr(key, value)
+	default:
+		return otlpStringAttr(key, asString(value))
+	}
+}
@@ -3,17 +3,17 @@ package tracing
 import (
 	"context"
 	"errors"
-	"fmt"
-	"runtime"
+	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
 	"github.com/uptrace/uptrace/pkg/org"
 	"github.com/uptrace/uptrace/pkg/tracing/xattr"
 	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
 	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
 	"go.uber.org/zap"
-	"go4.org/syncutil"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
@@ -24,9 +24,24 @@ type TraceServiceServer struct {
 
 	*bunapp.App
 
-	batchSize int
-	ch        chan otlpSpan
-	gate      *syncutil.Gate
+	storage SpanStorage
+
+	batchSize  int
+	ch         chan otlpSpan
+	flushCh    chan chan struct{}
+	flushQueue chan spanBatch
+
+	// Updated atomically.
+	pendingSpans   int64
+	flushing       int64
+	lastFlushTime  int64
+	lastFlushSpans int64
+	droppedSpans   int64
+	duplicateSpans int64
+	// Requests rejected by the span_backpressure policy.
+	rejectedRequests int64
+
+	quotas ingestQuotas
 }
 
 type otlpSpan struct {
@@ -37,23 +52,37 @@ type otlpSpan struct {
 
 var _ collectortrace.TraceServiceServer = (*TraceServiceServer)(nil)
 
-func NewTraceServiceServer(app *bunapp.App) *TraceServiceServer {
-	batchSize := scaleWithCPU(2000, 32000)
+func NewTraceServiceServer(app *bunapp.App, storage SpanStorage) *TraceServiceServer {
+	conf := &app.Config().SpanFlush
+	batchSize := app.Config().Ingest.BatchSize
 	s := &TraceServiceServer{
-		App: app,
+		App:     app,
+		storage: storage,
 
-		batchSize: batchSize,
-		ch:        make(chan otlpSpan, batchSize),
-		gate:      syncutil.NewGate(runtime.GOMAXPROCS(0)),
+		batchSize:  batchSize,
+		ch:         make(chan otlpSpan, batchSize),
+		flushCh:    make(chan chan struct{}),
+		flushQueue: make(chan spanBatch, conf.QueueSize),
 	}
 
 	app.WaitGroup().Add(1)
 	go func() {
 		defer app.WaitGroup().Done()
+		// Workers stop after inserting the queued batches.
+		defer close(s.flushQueue)
 
 		s.processLoop(app.Context())
 	}()
 
+	for i := 0; i < conf.Workers; i++ {
+		app.WaitGroup().Add(1)
+		go func() {
+			defer app.WaitGroup().Done()
+
+			s.flushWorker()
+		}()
+	}
+
 	return s
 }
 
@@ -69,48 +98,117 @@ func (s *TraceServiceServer) Export(
 		return nil, errors.New("metadata is empty")
 	}
 
-	dsn := md.Get("uptrace-dsn")
-	if len(dsn) == 0 {
-		return nil, errors.New("uptrace-dsn header is required")
+	dsn := org.IngestDSNFromMetadata(md)
+	if dsn == "" {
+		return nil, org.ErrDSNRequired
 	}
 
-	project, err := s.findProjectByDSN(dsn[0])
+	project, err := org.SelectProjectByDSN(ctx, s.App, dsn)
 	if err != nil {
 		return nil, err
 	}
 
-	s.process(project, req.ResourceSpans)
+	rejected, err := s.process(project, req.ResourceSpans)
+	if err != nil {
+		return nil, err
+	}
 
-	return &collectortrace.ExportTraceServiceResponse{}, nil
+	resp := new(collectortrace.ExportTraceServiceResponse)
+	resp.ProtoReflect().SetUnknown(rejected.partialSuccess())
+	return resp, nil
 }
 
-func (s *TraceServiceServer) findProjectByDSN(dsnStr string) (*bunapp.Project, error) {
-	dsn, err := org.ParseDSN(dsnStr)
-	if err != nil {
+// process queues valid spans for insertion and returns the spans that were rejected.
+// Requests over the ingest_quota of the projects the spans are routed to are rejected.
+// When the channel is full, the span_backpressure policy decides whether to wait,
+// to reject the whole request, or to drop spans.
+func (s *TraceServiceServer) process(
+	project *bunapp.Project, resourceSpans []*tracepb.ResourceSpans,
+) (*rejectedSpans, error) {
+	// Only the queued spans are charged, so requests rejected by span_backpressure
+	// and spans rejected by validation don't use the quota.
+	now := time.Now()
+	if err := s.quotas.check(spanQuotaCharges(s.Config(), project, resourceSpans), now); err != nil {
 		return nil, err
 	}
-
-	if dsn.Token == "" {
-		return nil, fmt.Errorf("dsn %q does not contain a token", dsnStr)
+	var charges []quotaCharge
+
+	conf := &s.Config().SpanBackpressure
+
+	switch conf.Policy {
+	case bunapp.SpanBackpressureReject:
+		// Requests are rejected before any span is queued so retries don't create
+		// duplicates. Once a request is accepted, the rest of its spans wait.
+		if len(s.ch) == cap(s.ch) {
+			atomic.AddInt64(&s.rejectedRequests, 1)
+			return nil, &httperror.Error{
+				Status:     http.StatusTooManyRequests,
+				Code:       "span_queue_full",
+				Message:    "span queue is full, retry later",
+				RetryAfter: conf.RetryAfter,
+			}
+		}
+	case bunapp.SpanBackpressureDrop:
+		var dropped int
+		rejected := walkOTLPSpans(s.Config(), project, resourceSpans, func(span otlpSpan) {
+			select {
+			case s.ch <- span:
+				charges = addQuotaCharge(charges, span.project, 1, span.Span)
+			default:
+				dropped += 1 + len(span.Events)
+			}
+		})
+		s.quotas.commit(charges, now)
+		if dropped > 0 {
+			atomic.AddInt64(&s.droppedSpans, int64(dropped))
+			s.Zap(s.Context()).Warn("span queue is full, dropping spans (edit span_backpressure YAML option)",
+				zap.Int("spans", dropped))
+		}
+		return rejected, nil
 	}
 
-	projects := s.Config().Projects
-	for i := range projects {
-		project := &projects[i]
-		if project.Token == dsn.Token {
-			return project, nil
-		}
+	rejected := walkOTLPSpans(s.Config(), project, resourceSpans, func(span otlpSpan) {
+		s.ch <- span
+		charges = addQuotaCharge(charges, span.project, 1, span.Span)
+	})
+	s.quotas.commit(charges, now)
+	return rejected, nil
+}
+
+// otlpSpanResource returns the normalized resource attributes used for routing.
+func otlpSpanResource(rss *tracepb.ResourceSpans) AttrMap {
+	resource := otlpAttrs(rss.GetResource().GetAttributes())
+	normalizeResource(resource)
+	if rss.SchemaUrl != "" {
+		resource[xattr.OtelSchemaURL] = rss.SchemaUrl
 	}
-	return nil, fmt.Errorf("project with token %q not found", dsn.Token)
+	return resource
 }
 
-func (s *TraceServiceServer) process(
-	project *bunapp.Project, resourceSpans []*tracepb.ResourceSpans,
-) {
+// walkOTLPSpans calls fn for each valid span with the attributes of its resource and scope
+// and the project selected by the routing rules. Spans are cut to the project span limits.
+func walkOTLPSpans(
+	conf *bunapp.AppConfig,
+	project *bunapp.Project,
+	resourceSpans []*tracepb.ResourceSpans,
+	fn func(span otlpSpan),
+) *rejectedSpans {
+	rejected := new(rejectedSpans)
+
 	for _, rss := range resourceSpans {
-		resource := otlpAttrs(rss.Resource.Attributes)
+		resource := otlpSpanResource(rss)
+		project := routeProject(conf, project, resource)
+		applyProjectResourceAttrs(project, resource)
+		limits := conf.ProjectSpanLimits(project)
 
 		for _, ils := range rss.InstrumentationLibrarySpans {
+			// Each scope has its own library and schema attributes.
+			resource := resource.Clone()
+			if ils.SchemaUrl != "" {
+				// Scope schema takes precedence over the resource schema.
+				resource[xattr.OtelSchemaURL] = ils.SchemaUrl
+			}
+
 			lib := ils.InstrumentationLibrary
 			if lib != nil {
 				resource[xattr.OtelLibraryName] = lib.Name
@@ -120,120 +218,236 @@ func (s *TraceServiceServer) process(
 			}
 
 			for _, span := range ils.Spans {
-				s.ch <- otlpSpan{
+				applySpanLimits(span, limits)
+				if err := validateSpan(span); err != nil {
+					rejected.add(span, err)
+					continue
+				}
+				fn(otlpSpan{
 					project:  project,
 					Span:     span,
 					resource: resource,
-				}
+				})
 			}
 		}
 	}
+
+	return rejected
 }
 
 func (s *TraceServiceServer) processLoop(ctx context.Context) {
-	const timeout = time.Second
+	timeout := s.Config().Ingest.FlushInterval
 
 	timer := time.NewTimer(timeout)
 	defer timer.Stop()
 
-	spans := make([]otlpSpan, 0, s.batchSize)
+	spans := getSpanBatch(s.batchSize)
 	var numSpan int
 
+	var dedup *spanDedup
+	if window := s.Config().SpanDedup.Window; window > 0 {
+		dedup = newSpanDedup(window)
+	}
+
+	appendSpan := func(span otlpSpan) {
+		if dedup != nil && dedup.seen(&span, time.Now()) {
+			atomic.AddInt64(&s.duplicateSpans, 1)
+			return
+		}
+		spans = append(spans, span)
+		numSpan += 1 + len(span.Events)
+		atomic.StoreInt64(&s.pendingSpans, int64(numSpan))
+	}
+	flush := func(done chan struct{}) {
+		if len(spans) > 0 {
+			s.flushSpans(ctx, spans, numSpan, done)
+			spans = getSpanBatch(len(spans))
+			numSpan = 0
+			atomic.StoreInt64(&s.pendingSpans, 0)
+		} else if done != nil {
+			close(done)
+		}
+	}
+
 loop:
 	for {
 		select {
 		case span := <-s.ch:
-			spans = append(spans, span)
-			numSpan += 1 + len(span.Events)
-		case <-timer.C:
-			if len(spans) > 0 {
-				s.flushSpans(ctx, spans, numSpan)
-				spans = make([]otlpSpan, 0, len(spans))
+			appendSpan(span)
+		case done := <-s.flushCh:
+			// Also flush spans that are waiting in the channel.
+			for n := len(s.ch); n > 0; n-- {
+				appendSpan(<-s.ch)
 			}
+			flush(done)
+		case <-timer.C:
+			flush(nil)
 			timer.Reset(timeout)
 		case <-s.Done():
 			break loop
 		}
 
-		if numSpan == s.batchSize {
-			s.flushSpans(ctx, spans, numSpan)
-			spans = make([]otlpSpan, 0, len(spans))
+		if numSpan >= s.batchSize {
+			flush(nil)
 		}
 	}
 
-	if len(spans) > 0 {
-		s.flushSpans(ctx, spans, numSpan)
-	}
+	flush(nil)
 }
 
-func (s *TraceServiceServer) flushSpans(ctx context.Context, otlpSpans []otlpSpan, numSpan int) {
-	ctx, span := bunapp.Tracer.Start(ctx, "flush-spans")
+// Flush flushes pending spans and waits until they are inserted.
+func (s *TraceServiceServer) Flush(ctx context.Context) error {
+	done := make(chan struct{})
 
-	s.WaitGroup().Add(1)
-	s.gate.Start()
+	select {
+	case s.flushCh <- done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 
-	go func() {
-		defer span.End()
-		defer s.gate.Done()
-		defer s.WaitGroup().Done()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-		spans := make([]Span, 0, numSpan)
-		indexedSpans := make([]SpanIndex, 0, numSpan)
-		dataSpans := make([]SpanData, 0, numSpan)
+type spanBatch struct {
+	ctx       context.Context
+	otlpSpans []otlpSpan
+	numSpan   int
+	done      chan struct{}
+}
 
-		ctx := newSpanContext(ctx)
-		for i := range otlpSpans {
-			otlpSpan := &otlpSpans[i]
+// flushSpans queues the spans for the flush workers and closes done, if any,
+// when the spans are inserted or dropped. When the queue is full, it waits
+// for a worker or drops the batch depending on the span_flush.overflow option.
+func (s *TraceServiceServer) flushSpans(
+	ctx context.Context, otlpSpans []otlpSpan, numSpan int, done chan struct{},
+) {
+	batch := spanBatch{
+		ctx:       ctx,
+		otlpSpans: otlpSpans,
+		numSpan:   numSpan,
+		done:      done,
+	}
 
-			spans = append(spans, Span{})
-			span := &spans[len(spans)-1]
+	if s.Config().SpanFlush.Overflow == bunapp.SpanFlushDrop {
+		select {
+		case s.flushQueue <- batch:
+		default:
+			atomic.AddInt64(&s.droppedSpans, int64(numSpan))
+			putSpanBatch(otlpSpans)
+			s.Zap(ctx).Warn("flush queue is full, dropping spans (edit span_flush YAML option)",
+				zap.Int("spans", numSpan))
+			if done != nil {
+				close(done)
+			}
+		}
+		return
+	}
 
-			span.ProjectID = otlpSpan.project.ID
-			newSpan(ctx, span, otlpSpan)
+	s.flushQueue <- batch
+}
 
-			indexedSpans = append(indexedSpans, SpanIndex{})
-			index := &indexedSpans[len(indexedSpans)-1]
-			newSpanIndex(index, span)
+func (s *TraceServiceServer) flushWorker() {
+	for batch := range s.flushQueue {
+		s.insertSpans(batch)
+	}
+}
 
-			dataSpans = append(dataSpans, SpanData{})
-			newSpanData(&dataSpans[len(dataSpans)-1], span)
+func (s *TraceServiceServer) insertSpans(batch spanBatch) {
+	ctx, span := bunapp.Tracer.Start(batch.ctx, "flush-spans")
+	defer span.End()
+
+	atomic.AddInt64(&s.flushing, 1)
+	defer func() {
+		atomic.StoreInt64(&s.lastFlushTime, time.Now().UnixNano())
+		atomic.StoreInt64(&s.lastFlushSpans, int64(batch.numSpan))
+		atomic.AddInt64(&s.flushing, -1)
+		if batch.done != nil {
+			close(batch.done)
+		}
+	}()
 
-			var errorCount int
-			var logCount int
+	indexedSpans, dataSpans := s.convertSpans(
+		ctx, batch.otlpSpans, batch.numSpan, s.BlobStorage())
+	putSpanBatch(batch.otlpSpans)
 
-			for _, otlpEvent := range otlpSpan.Events {
-				spans = append(spans, Span{})
-				eventSpan := &spans[len(spans)-1]
-				newSpanFromEvent(ctx, eventSpan, span, otlpEvent)
+	if err := s.storage.InsertSpans(ctx, indexedSpans, dataSpans); err != nil {
+		atomic.AddInt64(&s.droppedSpans, int64(len(indexedSpans)))
+		s.Zap(ctx).Error("SpanStorage.InsertSpans failed", zap.Error(err))
+	}
+}
 
-				indexedSpans = append(indexedSpans, SpanIndex{})
-				newSpanIndex(&indexedSpans[len(indexedSpans)-1], eventSpan)
+// convertSpans converts OTLP spans and their events to rows of spans_index and spans_data.
+// Large values are moved to the blob storage unless it is nil.
+func (s *TraceServiceServer) convertSpans(
+	ctx context.Context, otlpSpans []otlpSpan, numSpan int, blobs bunapp.BlobStorage,
+) ([]SpanIndex, []SpanData) {
+	spans := make([]Span, 0, numSpan)
+	indexedSpans := make([]SpanIndex, 0, numSpan)
+	dataSpans := make([]SpanData, 0, numSpan)
+
+	spanCtx := newSpanContext(ctx, &s.Config().ServiceGrouping)
+	for i := range otlpSpans {
+		otlpSpan := &otlpSpans[i]
+
+		spans = append(spans, Span{})
+		span := &spans[len(spans)-1]
+
+		span.ProjectID = otlpSpan.project.ID
+		newSpan(spanCtx, span, otlpSpan)
+		applyDerivedAttrs(otlpSpan.project, span)
+		applyStatusRules(otlpSpan.project, span)
+		captureHTTPBodies(&s.Config().BodyCapture, span)
+		if blobs != nil {
+			offloadSpanBlobs(ctx, s.App, blobs, span)
+		}
 
-				dataSpans = append(dataSpans, SpanData{})
-				newSpanData(&dataSpans[len(dataSpans)-1], eventSpan)
+		indexedSpans = append(indexedSpans, SpanIndex{})
+		index := &indexedSpans[len(indexedSpans)-1]
+		newSpanIndex(index, span)
+		index.ServiceKey = spanCtx.service(span)
+		index.ApdexLevel = apdexLevel(span,
+			apdexThreshold(s.Config(), otlpSpan.project, span.GroupID))
 
-				if isErrorSystem(eventSpan.System) {
-					errorCount++
-				}
-				if isLogSystem(eventSpan.System) {
-					logCount++
-				}
+		dataSpans = append(dataSpans, SpanData{})
+		newSpanData(&dataSpans[len(dataSpans)-1], span)
+
+		var errorCount int
+		var logCount int
+
+		for _, otlpEvent := range otlpSpan.Events {
+			spans = append(spans, Span{})
+			eventSpan := &spans[len(spans)-1]
+			newSpanFromEvent(spanCtx, eventSpan, span, otlpEvent)
+			if blobs != nil {
+				offloadSpanBlobs(ctx, s.App, blobs, eventSpan)
 			}
 
-			index.LinkCount = uint8(len(otlpSpan.Links))
-			index.EventCount = uint8(len(otlpSpan.Events))
-			index.EventErrorCount = uint8(errorCount)
-			index.EventLogCount = uint8(logCount)
-		}
+			indexedSpans = append(indexedSpans, SpanIndex{})
+			eventIndex := &indexedSpans[len(indexedSpans)-1]
+			newSpanIndex(eventIndex, eventSpan)
+			eventIndex.ServiceKey = spanCtx.service(eventSpan)
 
-		if _, err := s.CH().NewInsert().Model(&dataSpans).Exec(ctx); err != nil {
-			s.Zap(ctx).Error("ch.Insert failed",
-				zap.Error(err), zap.String("table", "spans_data"))
-		}
+			dataSpans = append(dataSpans, SpanData{})
+			newSpanData(&dataSpans[len(dataSpans)-1], eventSpan)
 
-		if _, err := s.CH().NewInsert().Model(&indexedSpans).Exec(ctx); err != nil {
-			s.Zap(ctx).Error("ch.Insert failed",
-				zap.Error(err), zap.String("table", "spans_index"))
+			if isErrorSystem(eventSpan.System) {
+				errorCount++
+			}
+			if isLogSystem(eventSpan.System) {
+				logCount++
+			}
 		}
-	}()
+
+		index.LinkCount = uint8(len(otlpSpan.Links))
+		index.EventCount = uint8(len(otlpSpan.Events))
+		index.EventErrorCount = uint8(errorCount)
+		index.EventLogCount = uint8(logCount)
+	}
+
+	return indexedSpans, dataSpans
 }
@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestProcessBackpressure(t *testing.T) {
+	conf := &bunapp.AppConfig{
+		Projects: []bunapp.Project{{
+			ID:          1,
+			IngestQuota: &bunapp.IngestQuota{SpansPerSecond: 10, Burst: 10},
+		}},
+	}
+	conf.CH.DSN = "clickhouse://default:@localhost:9000/uptrace?sslmode=disable"
+	conf.SpanBackpressure.RetryAfter = 3 * time.Second
+
+	app := bunapp.New(context.Background(), conf)
+	defer app.Stop()
+
+	// The channel is never drained, so the second span does not fit.
+	s := &TraceServiceServer{App: app, ch: make(chan otlpSpan, 1)}
+	project := &conf.Projects[0]
+	resourceSpans := benchResourceSpans(2)
+
+	conf.SpanBackpressure.Policy = bunapp.SpanBackpressureDrop
+	_, err := s.process(project, resourceSpans)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), s.droppedSpans)
+	require.Len(t, s.ch, 1)
+
+	conf.SpanBackpressure.Policy = bunapp.SpanBackpressureReject
+	_, err = s.process(project, []*tracepb.ResourceSpans{})
+	require.Equal(t, http.StatusTooManyRequests, httperror.From(err).Status)
+	require.Equal(t, 3*time.Second, httperror.From(err).RetryAfter)
+	require.Equal(t, int64(1), s.rejectedRequests)
+
+	st := status.Convert(err)
+	require.Equal(t, codes.ResourceExhausted, st.Code())
+	require.Len(t, st.Details(), 1)
+	info := st.Details()[0].(*errdetails.RetryInfo)
+	require.Equal(t, 3*time.Second, info.RetryDelay.AsDuration())
+
+	// Only the queued span is charged to the quota. Dropped spans and requests
+	// rejected because the queue is full are not.
+	_, err = s.process(project, resourceSpans)
+	require.Equal(t, "span_queue_full", httperror.From(err).Code)
+	require.Equal(t, []IngestQuotaUsage{{ProjectID: 1, Spans: 1}}, s.quotas.usage())
+}
@@ -1,14 +1,17 @@
 package tracing
 
 import (
-	"errors"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"mime"
 	"net/http"
 
 	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/org"
 	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
-	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 )
@@ -18,61 +21,75 @@ const (
 	jsonContentType = "application/json"
 )
 
+// httpTraces implements OTLP/HTTP. Compressed requests are decompressed by
+// httputil.DecompressHandler.
 func (s *TraceServiceServer) httpTraces(w http.ResponseWriter, req bunrouter.Request) error {
-	dsn := req.Header.Get("uptrace-dsn")
+	dsn := org.IngestDSN(req.Request)
 	if dsn == "" {
-		return errors.New("uptrace-dsn header is required")
+		return org.ErrDSNRequired
 	}
 
-	project, err := s.findProjectByDSN(dsn)
+	project, err := org.SelectProjectByDSN(req.Context(), s.App, dsn)
 	if err != nil {
 		return err
 	}
 
-	switch contentType := req.Header.Get("content-type"); contentType {
+	switch contentType := otlpContentType(req); contentType {
 	case jsonContentType:
-		body, err := ioutil.ReadAll(req.Body)
+		body, err := readOTLPBody(req)
 		if err != nil {
 			return err
 		}
 
-		td := new(tracepb.TracesData)
-		if err := protojson.Unmarshal(body, td); err != nil {
+		td := new(collectortrace.ExportTraceServiceRequest)
+		err = unmarshalOTLPJSON(body.Bytes(), td)
+		putOTLPBody(body)
+		if err != nil {
 			return err
 		}
 
-		s.process(project, td.ResourceSpans)
+		rejected, err := s.process(project, td.ResourceSpans)
+		if err != nil {
+			return err
+		}
 
-		resp := new(collectortrace.ExportTraceServiceResponse)
-		b, err := protojson.Marshal(resp)
+		b, err := json.Marshal(rejected.partialSuccessJSON())
 		if err != nil {
 			return err
 		}
 
+		w.Header().Set("content-type", jsonContentType)
 		if _, err := w.Write(b); err != nil {
 			return err
 		}
 
 		return nil
 	case pbContentType:
-		body, err := ioutil.ReadAll(req.Body)
+		body, err := readOTLPBody(req)
 		if err != nil {
 			return err
 		}
 
 		td := new(collectortrace.ExportTraceServiceRequest)
-		if err := proto.Unmarshal(body, td); err != nil {
+		err = proto.Unmarshal(body.Bytes(), td)
+		putOTLPBody(body)
+		if err != nil {
 			return err
 		}
 
-		s.process(project, td.ResourceSpans)
+		rejected, err := s.process(project, td.ResourceSpans)
+		if err != nil {
+			return err
+		}
 
 		resp := new(collectortrace.ExportTraceServiceResponse)
+		resp.ProtoReflect().SetUnknown(rejected.partialSuccess())
 		b, err := proto.Marshal(resp)
 		if err != nil {
 			return err
 		}
 
+		w.Header().Set("content-type", pbContentType)
 		if _, err := w.Write(b); err != nil {
 			return err
 		}
@@ -82,3 +99,80 @@ func (s *TraceServiceServer) httpTraces(w http.ResponseWriter, req bunrouter.Req
 		return fmt.Errorf("unsupported content type: %q", contentType)
 	}
 }
+
+// otlpContentType returns the media type without parameters that exporters may add,
+// for example, "application/json; charset=utf-8".
+func otlpContentType(req bunrouter.Request) string {
+	contentType := req.Header.Get("content-type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	return contentType
+}
+
+// unmarshalOTLPJSON decodes the OTLP JSON encoding. Unlike the canonical protobuf JSON
+// mapping, OTLP JSON uses hex strings for trace and span ids, so the ids are converted
+// to base64 before protojson decodes the message. Newer exporters send scopeSpans and
+// similar fields that are renamed to the instrumentationLibrary fields of this OTLP version.
+func unmarshalOTLPJSON(b []byte, msg proto.Message) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(normalizeOTLPJSON(v))
+	if err != nil {
+		return err
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(b, msg)
+}
+
+var otlpJSONIDSizes = map[string]int{
+	"traceId":        16,
+	"trace_id":       16,
+	"spanId":         8,
+	"span_id":        8,
+	"parentSpanId":   8,
+	"parent_span_id": 8,
+}
+
+var otlpJSONRenames = map[string]string{
+	"scopeSpans":    "instrumentationLibrarySpans",
+	"scope_spans":   "instrumentationLibrarySpans",
+	"scopeLogs":     "instrumentationLibraryLogs",
+	"scope_logs":    "instrumentationLibraryLogs",
+	"scopeMetrics":  "instrumentationLibraryMetrics",
+	"scope_metrics": "instrumentationLibraryMetrics",
+	"scope":         "instrumentationLibrary",
+}
+
+func normalizeOTLPJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			if newKey, ok := otlpJSONRenames[key]; ok {
+				key = newKey
+			}
+			if size, ok := otlpJSONIDSizes[key]; ok {
+				if s, ok := value.(string); ok && len(s) == 2*size {
+					if id, err := hex.DecodeString(s); err == nil {
+						value = base64.StdEncoding.EncodeToString(id)
+					}
+				}
+			}
+			m[key] = normalizeOTLPJSON(value)
+		}
+		return m
+	case []any:
+		for i, el := range v {
+			v[i] = normalizeOTLPJSON(el)
+		}
+		return v
+	default:
+		return v
+	}
+}
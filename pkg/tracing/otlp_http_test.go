@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+)
+
+func TestUnmarshalOTLPJSON(t *testing.T) {
+	body := []byte(`{"resourceSpans":[{
+  "resource":{"attributes":[{"key":"service.name","value":{"stringValue":"web"}}]},
+  "scopeSpans":[{
+    "scope":{"name":"fetch"},
+    "spans":[{
+      "traceId":"0102030405060708090a0b0c0d0e0f10",
+      "spanId":"0102030405060708",
+      "parentSpanId":"AQEBAQEBAQE=",
+      "name":"GET /users",
+      "kind":3,
+      "startTimeUnixNano":"1640000000000000123",
+      "endTimeUnixNano":1640000000001000123,
+      "links":[{"traceId":"0102030405060708090a0b0c0d0e0f10","spanId":"0808080808080808"}]
+    }]
+  }]
+}]}`)
+
+	td := new(collectortrace.ExportTraceServiceRequest)
+	require.NoError(t, unmarshalOTLPJSON(body, td))
+
+	ils := td.ResourceSpans[0].InstrumentationLibrarySpans
+	require.Len(t, ils, 1)
+	require.Equal(t, "fetch", ils[0].InstrumentationLibrary.Name)
+
+	span := ils[0].Spans[0]
+	require.Equal(t, []byte{
+		1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16,
+	}, span.TraceId)
+	require.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8}, span.SpanId)
+	require.Equal(t, []byte{1, 1, 1, 1, 1, 1, 1, 1}, span.ParentSpanId)
+	require.Equal(t, uint64(1640000000000000123), span.StartTimeUnixNano)
+	require.Equal(t, uint64(1640000000001000123), span.EndTimeUnixNano)
+	require.Equal(t, []byte{8, 8, 8, 8, 8, 8, 8, 8}, span.Links[0].SpanId)
+
+	require.Error(t, unmarshalOTLPJSON([]byte(`{"resourceSpans":`), td))
+}
@@ -0,0 +1,286 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	"github.com/uptrace/uptrace/pkg/org"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"go.uber.org/zap"
+	"go4.org/syncutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// LogsServiceServer receives OTLP logs and inserts them in batches into
+// logs_index and logs_data like TraceServiceServer does with spans.
+type LogsServiceServer struct {
+	collectorlogs.UnimplementedLogsServiceServer
+
+	*bunapp.App
+
+	batchSize int
+	ch        chan []Log
+	gate      *syncutil.Gate
+
+	// Shared with the trace service so logs and spans use the same project quota.
+	quotas *ingestQuotas
+}
+
+var _ collectorlogs.LogsServiceServer = (*LogsServiceServer)(nil)
+
+func NewLogsServiceServer(app *bunapp.App, quotas *ingestQuotas) *LogsServiceServer {
+	conf := &app.Config().Ingest
+	s := &LogsServiceServer{
+		App: app,
+
+		batchSize: conf.BatchSize,
+		ch:        make(chan []Log, runtime.GOMAXPROCS(0)),
+		gate:      syncutil.NewGate(conf.MaxConcurrency),
+		quotas:    quotas,
+	}
+
+	app.WaitGroup().Add(1)
+	go func() {
+		defer app.WaitGroup().Done()
+
+		s.processLoop(app.Context())
+	}()
+
+	return s
+}
+
+func (s *LogsServiceServer) Export(
+	ctx context.Context, req *collectorlogs.ExportLogsServiceRequest,
+) (*collectorlogs.ExportLogsServiceResponse, error) {
+	if ctx.Err() == context.Canceled {
+		return nil, status.Error(codes.Canceled, "Client cancelled, abandoning.")
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, errors.New("metadata is empty")
+	}
+
+	dsn := org.IngestDSNFromMetadata(md)
+	if dsn == "" {
+		return nil, org.ErrDSNRequired
+	}
+
+	project, err := org.SelectProjectByDSN(ctx, s.App, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.process(project, req.ResourceLogs); err != nil {
+		return nil, err
+	}
+
+	return &collectorlogs.ExportLogsServiceResponse{}, nil
+}
+
+func (s *LogsServiceServer) httpLogs(w http.ResponseWriter, req bunrouter.Request) error {
+	dsn := org.IngestDSN(req.Request)
+	if dsn == "" {
+		return org.ErrDSNRequired
+	}
+
+	project, err := org.SelectProjectByDSN(req.Context(), s.App, dsn)
+	if err != nil {
+		return err
+	}
+
+	buf, err := readOTLPBody(req)
+	if err != nil {
+		return err
+	}
+	defer putOTLPBody(buf)
+	body := buf.Bytes()
+
+	td := new(collectorlogs.ExportLogsServiceRequest)
+	resp := new(collectorlogs.ExportLogsServiceResponse)
+	var b []byte
+
+	switch contentType := otlpContentType(req); contentType {
+	case jsonContentType:
+		if err := unmarshalOTLPJSON(body, td); err != nil {
+			return err
+		}
+		if err := s.process(project, td.ResourceLogs); err != nil {
+			return err
+		}
+
+		b, err = protojson.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("content-type", jsonContentType)
+	case pbContentType:
+		if err := proto.Unmarshal(body, td); err != nil {
+			return err
+		}
+		if err := s.process(project, td.ResourceLogs); err != nil {
+			return err
+		}
+
+		b, err = proto.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("content-type", pbContentType)
+	default:
+		return fmt.Errorf("unsupported content type: %q", contentType)
+	}
+
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	return nil
+}
+
+// process charges the logs to the quota of the projects they are routed to and queues
+// them using the span_backpressure policy.
+func (s *LogsServiceServer) process(
+	project *bunapp.Project, resourceLogs []*logspb.ResourceLogs,
+) error {
+	var logs []Log
+	var charges []quotaCharge
+
+	for _, rls := range resourceLogs {
+		resource := otlpAttrs(rls.GetResource().GetAttributes())
+		normalizeResource(resource)
+		project := routeProject(s.Config(), project, resource)
+		applyProjectResourceAttrs(project, resource)
+		first := len(logs)
+
+		for _, ill := range rls.InstrumentationLibraryLogs {
+			resource := resource
+			if lib := ill.InstrumentationLibrary; lib != nil {
+				resource = resource.Clone()
+				resource[xattr.OtelLibraryName] = lib.Name
+				if lib.Version != "" {
+					resource[xattr.OtelLibraryVersion] = lib.Version
+				}
+			}
+
+			for _, record := range ill.LogRecords {
+				logs = append(logs, Log{})
+				newLog(&logs[len(logs)-1], project.ID, resource, record)
+			}
+		}
+		charges = addQuotaCharge(charges, project, len(logs)-first, rls)
+	}
+
+	if len(logs) == 0 {
+		return nil
+	}
+
+	// The quota is charged only when the logs are queued.
+	now := time.Now()
+	if err := s.quotas.check(charges, now); err != nil {
+		return err
+	}
+
+	conf := &s.Config().SpanBackpressure
+
+	switch conf.Policy {
+	case bunapp.SpanBackpressureReject:
+		if len(s.ch) == cap(s.ch) {
+			return &httperror.Error{
+				Status:     http.StatusTooManyRequests,
+				Code:       "log_queue_full",
+				Message:    "log queue is full, retry later",
+				RetryAfter: conf.RetryAfter,
+			}
+		}
+	case bunapp.SpanBackpressureDrop:
+		select {
+		case s.ch <- logs:
+			s.quotas.commit(charges, now)
+		default:
+			s.Zap(s.Context()).Warn("log queue is full, dropping logs (edit span_backpressure YAML option)",
+				zap.Int("logs", len(logs)))
+		}
+		return nil
+	}
+
+	s.ch <- logs
+	s.quotas.commit(charges, now)
+	return nil
+}
+
+func (s *LogsServiceServer) processLoop(ctx context.Context) {
+	timeout := s.Config().Ingest.FlushInterval
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	logs := make([]Log, 0, s.batchSize)
+
+loop:
+	for {
+		select {
+		case batch := <-s.ch:
+			logs = append(logs, batch...)
+		case <-timer.C:
+			if len(logs) > 0 {
+				s.flushLogs(ctx, logs)
+				logs = make([]Log, 0, len(logs))
+			}
+			timer.Reset(timeout)
+		case <-s.Done():
+			break loop
+		}
+
+		if len(logs) >= s.batchSize {
+			s.flushLogs(ctx, logs)
+			logs = make([]Log, 0, len(logs))
+		}
+	}
+
+	if len(logs) > 0 {
+		s.flushLogs(ctx, logs)
+	}
+}
+
+func (s *LogsServiceServer) flushLogs(ctx context.Context, logs []Log) {
+	ctx, span := bunapp.Tracer.Start(ctx, "flush-logs")
+
+	s.WaitGroup().Add(1)
+	s.gate.Start()
+
+	go func() {
+		defer span.End()
+		defer s.gate.Done()
+		defer s.WaitGroup().Done()
+
+		indexedLogs := make([]LogIndex, len(logs))
+		dataLogs := make([]LogData, len(logs))
+		for i := range logs {
+			newLogIndex(&indexedLogs[i], &logs[i])
+			newLogData(&dataLogs[i], &logs[i])
+		}
+
+		if _, err := s.CH().NewInsert().Model(&dataLogs).Exec(ctx); err != nil {
+			s.Zap(ctx).Error("ch.Insert failed",
+				zap.Error(err), zap.String("table", "logs_data"))
+		}
+
+		if _, err := s.CH().NewInsert().Model(&indexedLogs).Exec(ctx); err != nil {
+			s.Zap(ctx).Error("ch.Insert failed",
+				zap.Error(err), zap.String("table", "logs_index"))
+		}
+	}()
+}
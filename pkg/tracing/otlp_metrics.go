@@ -0,0 +1,256 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	"github.com/uptrace/uptrace/pkg/org"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"go.uber.org/zap"
+	"go4.org/syncutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// MetricsServiceServer receives OTLP metrics and inserts the data points in batches
+// like TraceServiceServer does with spans.
+type MetricsServiceServer struct {
+	collectormetrics.UnimplementedMetricsServiceServer
+
+	*bunapp.App
+
+	batchSize int
+	ch        chan []Measure
+	gate      *syncutil.Gate
+}
+
+var _ collectormetrics.MetricsServiceServer = (*MetricsServiceServer)(nil)
+
+func NewMetricsServiceServer(app *bunapp.App) *MetricsServiceServer {
+	conf := &app.Config().Ingest
+	s := &MetricsServiceServer{
+		App: app,
+
+		batchSize: conf.BatchSize,
+		ch:        make(chan []Measure, runtime.GOMAXPROCS(0)),
+		gate:      syncutil.NewGate(conf.MaxConcurrency),
+	}
+
+	app.WaitGroup().Add(1)
+	go func() {
+		defer app.WaitGroup().Done()
+
+		s.processLoop(app.Context())
+	}()
+
+	return s
+}
+
+func (s *MetricsServiceServer) Export(
+	ctx context.Context, req *collectormetrics.ExportMetricsServiceRequest,
+) (*collectormetrics.ExportMetricsServiceResponse, error) {
+	if ctx.Err() == context.Canceled {
+		return nil, status.Error(codes.Canceled, "Client cancelled, abandoning.")
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, errors.New("metadata is empty")
+	}
+
+	dsn := org.IngestDSNFromMetadata(md)
+	if dsn == "" {
+		return nil, org.ErrDSNRequired
+	}
+
+	project, err := org.SelectProjectByDSN(ctx, s.App, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.process(project, req.ResourceMetrics); err != nil {
+		return nil, err
+	}
+
+	return &collectormetrics.ExportMetricsServiceResponse{}, nil
+}
+
+func (s *MetricsServiceServer) httpMetrics(w http.ResponseWriter, req bunrouter.Request) error {
+	dsn := org.IngestDSN(req.Request)
+	if dsn == "" {
+		return org.ErrDSNRequired
+	}
+
+	project, err := org.SelectProjectByDSN(req.Context(), s.App, dsn)
+	if err != nil {
+		return err
+	}
+
+	buf, err := readOTLPBody(req)
+	if err != nil {
+		return err
+	}
+	defer putOTLPBody(buf)
+	body := buf.Bytes()
+
+	td := new(collectormetrics.ExportMetricsServiceRequest)
+	resp := new(collectormetrics.ExportMetricsServiceResponse)
+	var b []byte
+
+	switch contentType := otlpContentType(req); contentType {
+	case jsonContentType:
+		if err := unmarshalOTLPJSON(body, td); err != nil {
+			return err
+		}
+		if err := s.process(project, td.ResourceMetrics); err != nil {
+			return err
+		}
+
+		b, err = protojson.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("content-type", jsonContentType)
+	case pbContentType:
+		if err := proto.Unmarshal(body, td); err != nil {
+			return err
+		}
+		if err := s.process(project, td.ResourceMetrics); err != nil {
+			return err
+		}
+
+		b, err = proto.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("content-type", pbContentType)
+	default:
+		return fmt.Errorf("unsupported content type: %q", contentType)
+	}
+
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	return nil
+}
+
+// process queues the data points using the span_backpressure policy.
+func (s *MetricsServiceServer) process(
+	project *bunapp.Project, resourceMetrics []*metricspb.ResourceMetrics,
+) error {
+	var measures []Measure
+
+	for _, rms := range resourceMetrics {
+		resource := otlpAttrs(rms.GetResource().GetAttributes())
+		normalizeResource(resource)
+		project := routeProject(s.Config(), project, resource)
+
+		for _, ilm := range rms.InstrumentationLibraryMetrics {
+			resource := resource
+			if lib := ilm.InstrumentationLibrary; lib != nil {
+				resource = resource.Clone()
+				resource[xattr.OtelLibraryName] = lib.Name
+				if lib.Version != "" {
+					resource[xattr.OtelLibraryVersion] = lib.Version
+				}
+			}
+
+			for _, metric := range ilm.Metrics {
+				measures = appendMeasures(measures, project.ID, resource, metric)
+			}
+		}
+	}
+
+	if len(measures) == 0 {
+		return nil
+	}
+
+	conf := &s.Config().SpanBackpressure
+
+	switch conf.Policy {
+	case bunapp.SpanBackpressureReject:
+		if len(s.ch) == cap(s.ch) {
+			return &httperror.Error{
+				Status:     http.StatusTooManyRequests,
+				Code:       "metric_queue_full",
+				Message:    "metric queue is full, retry later",
+				RetryAfter: conf.RetryAfter,
+			}
+		}
+	case bunapp.SpanBackpressureDrop:
+		select {
+		case s.ch <- measures:
+		default:
+			s.Zap(s.Context()).Warn("metric queue is full, dropping data points (edit span_backpressure YAML option)",
+				zap.Int("measures", len(measures)))
+		}
+		return nil
+	}
+
+	s.ch <- measures
+	return nil
+}
+
+func (s *MetricsServiceServer) processLoop(ctx context.Context) {
+	timeout := s.Config().Ingest.FlushInterval
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	measures := make([]Measure, 0, s.batchSize)
+
+loop:
+	for {
+		select {
+		case batch := <-s.ch:
+			measures = append(measures, batch...)
+		case <-timer.C:
+			if len(measures) > 0 {
+				s.flushMeasures(ctx, measures)
+				measures = make([]Measure, 0, len(measures))
+			}
+			timer.Reset(timeout)
+		case <-s.Done():
+			break loop
+		}
+
+		if len(measures) >= s.batchSize {
+			s.flushMeasures(ctx, measures)
+			measures = make([]Measure, 0, len(measures))
+		}
+	}
+
+	if len(measures) > 0 {
+		s.flushMeasures(ctx, measures)
+	}
+}
+
+func (s *MetricsServiceServer) flushMeasures(ctx context.Context, measures []Measure) {
+	ctx, span := bunapp.Tracer.Start(ctx, "flush-measures")
+
+	s.WaitGroup().Add(1)
+	s.gate.Start()
+
+	go func() {
+		defer span.End()
+		defer s.gate.Done()
+		defer s.WaitGroup().Done()
+
+		if _, err := s.CH().NewInsert().Model(&measures).Exec(ctx); err != nil {
+			s.Zap(ctx).Error("ch.Insert failed",
+				zap.Error(err), zap.String("table", "measures"))
+		}
+	}()
+}
@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/uptrace/bunrouter"
+)
+
+// Request bodies and span batches are reused because they are the largest
+// allocations of the ingest path after the protobuf messages. The messages
+// themselves are not pooled: Reset discards nested messages, so a pooled
+// message saves only the top-level allocation.
+
+// maxPooledBodySize keeps a few large requests from pinning memory in the pool.
+const maxPooledBodySize = 4 << 20
+
+var otlpBodyPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+// readOTLPBody reads the request body into a pooled buffer. The caller must call
+// putOTLPBody when the body is unmarshaled. Unmarshaled messages don't reference
+// the buffer because protobuf copies strings and bytes.
+func readOTLPBody(req bunrouter.Request) (*bytes.Buffer, error) {
+	buf := otlpBodyPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if n := req.ContentLength; n > 0 && n <= maxPooledBodySize {
+		buf.Grow(int(n))
+	}
+
+	if _, err := buf.ReadFrom(req.Body); err != nil {
+		putOTLPBody(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+func putOTLPBody(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBodySize {
+		otlpBodyPool.Put(buf)
+	}
+}
+
+//------------------------------------------------------------------------------
+
+var spanBatchPool sync.Pool
+
+// getSpanBatch returns an empty slice with the capacity of a previously flushed batch.
+func getSpanBatch(capacity int) []otlpSpan {
+	if v := spanBatchPool.Get(); v != nil {
+		return (*v.(*[]otlpSpan))[:0]
+	}
+	return make([]otlpSpan, 0, capacity)
+}
+
+// putSpanBatch releases the batch after the spans are converted. Elements are cleared
+// so the pool does not keep the OTLP messages alive.
+func putSpanBatch(spans []otlpSpan) {
+	for i := range spans {
+		spans[i] = otlpSpan{}
+	}
+	spans = spans[:0]
+	spanBatchPool.Put(&spans)
+}
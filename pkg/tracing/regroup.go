@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+)
+
+// SpanRegroup is a span whose system or group id changed with the current grouping rules.
+type SpanRegroup struct {
+	ID      uint64
+	System  string
+	GroupID uint64
+	Service string
+}
+
+// SpanRegrouper recalculates group ids of stored spans after the grouping
+// rules change.
+type SpanRegrouper struct {
+	ctx *spanContext
+}
+
+func NewSpanRegrouper(ctx context.Context, services *bunapp.ServiceGrouping) *SpanRegrouper {
+	return &SpanRegrouper{
+		ctx: newSpanContext(ctx, services),
+	}
+}
+
+// Regroup recalculates the system and group id of the span stored in spans_data.
+// It returns nil when nothing changed or when the group id can't be recalculated
+// because it was hashed using values that are not stored, for example, events
+// and database spans which names are replaced with statements.
+func (r *SpanRegrouper) Regroup(projectID uint32, data []byte) (*SpanRegroup, error) {
+	span := new(Span)
+	if err := unmarshalSpan(data, span); err != nil {
+		return nil, err
+	}
+
+	if span.ProjectID != projectID || span.EventName != "" {
+		return nil, nil
+	}
+	if span.Attrs.Has(xattr.DBSystem) && span.Attrs.Has(xattr.DBStatement) {
+		return nil, nil
+	}
+
+	system, groupID := span.System, span.GroupID
+	assignSpanSystemAndGroupID(r.ctx, span)
+	if span.System == system && span.GroupID == groupID {
+		return nil, nil
+	}
+
+	return &SpanRegroup{
+		ID:      span.ID,
+		System:  span.System,
+		GroupID: span.GroupID,
+		Service: r.ctx.service(span),
+	}, nil
+}
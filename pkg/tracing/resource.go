@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+)
+
+// serviceNameAttrs are used to infer service.name for resources that don't have it,
+// for example, spans produced by eBPF auto-instrumentation agents that only know
+// about containers and processes. The order is from the most specific to the least.
+var serviceNameAttrs = []string{
+	xattr.K8sDeploymentName,
+	xattr.K8sStatefulSetName,
+	xattr.K8sDaemonSetName,
+	xattr.K8sCronJobName,
+	xattr.K8sJobName,
+	xattr.ContainerName,
+	xattr.ProcessExecutableName,
+}
+
+func normalizeResource(resource AttrMap) {
+	if !hasServiceName(resource) {
+		if name := inferServiceName(resource); name != "" {
+			resource[xattr.ServiceName] = name
+		}
+	}
+	if !resource.Has(xattr.HostName) {
+		if name := resource.Text(xattr.K8sNodeName); name != "" {
+			resource[xattr.HostName] = name
+		}
+	}
+}
+
+// applyProjectResourceAttrs adds the project resource_attrs that are missing
+// in the resource.
+func applyProjectResourceAttrs(project *bunapp.Project, resource AttrMap) {
+	for key, value := range project.ResourceAttrs {
+		if !resource.Has(key) {
+			resource[key] = value
+		}
+	}
+}
+
+func hasServiceName(resource AttrMap) bool {
+	name := resource.ServiceName()
+	return name != "" && !strings.HasPrefix(name, "unknown_service")
+}
+
+func inferServiceName(resource AttrMap) string {
+	for _, key := range serviceNameAttrs {
+		if s := resource.Text(key); s != "" {
+			return s
+		}
+	}
+	if s := resource.Text(xattr.ProcessCommand); s != "" {
+		return filepath.Base(s)
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+)
+
+func TestNormalizeResource(t *testing.T) {
+	tests := []struct {
+		in   AttrMap
+		want AttrMap
+	}{
+		{
+			in:   AttrMap{xattr.ServiceName: "api", xattr.ContainerName: "api-1"},
+			want: AttrMap{xattr.ServiceName: "api", xattr.ContainerName: "api-1"},
+		},
+		{
+			in: AttrMap{
+				xattr.ServiceName:       "unknown_service:java",
+				xattr.K8sDeploymentName: "checkout",
+				xattr.ContainerName:     "checkout-1",
+			},
+			want: AttrMap{
+				xattr.ServiceName:       "checkout",
+				xattr.K8sDeploymentName: "checkout",
+				xattr.ContainerName:     "checkout-1",
+			},
+		},
+		{
+			in: AttrMap{xattr.ContainerName: "worker"},
+			want: AttrMap{
+				xattr.ServiceName:   "worker",
+				xattr.ContainerName: "worker",
+			},
+		},
+		{
+			in: AttrMap{xattr.ProcessCommand: "/usr/local/bin/worker"},
+			want: AttrMap{
+				xattr.ServiceName:    "worker",
+				xattr.ProcessCommand: "/usr/local/bin/worker",
+			},
+		},
+		{
+			in: AttrMap{xattr.ServiceName: "api", xattr.K8sNodeName: "node-1"},
+			want: AttrMap{
+				xattr.ServiceName: "api",
+				xattr.K8sNodeName: "node-1",
+				xattr.HostName:    "node-1",
+			},
+		},
+		{
+			in: AttrMap{
+				xattr.ServiceName: "api",
+				xattr.HostName:    "host-1",
+				xattr.K8sNodeName: "node-1",
+			},
+			want: AttrMap{
+				xattr.ServiceName: "api",
+				xattr.HostName:    "host-1",
+				xattr.K8sNodeName: "node-1",
+			},
+		},
+		{
+			in:   AttrMap{},
+			want: AttrMap{},
+		},
+	}
+
+	for _, test := range tests {
+		normalizeResource(test.in)
+		require.Equal(t, test.want, test.in)
+	}
+}
@@ -0,0 +1,33 @@
+package tracing
+
+import (
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+// routeProject returns the project of the first routing rule that matches the resource
+// or the project that received the data. Archived projects are never selected by rules.
+func routeProject(conf *bunapp.AppConfig, project *bunapp.Project, resource AttrMap) *bunapp.Project {
+	for i := range project.RoutingRules {
+		rule := &project.RoutingRules[i]
+		if !routingRuleMatches(rule, resource) {
+			continue
+		}
+		for j := range conf.Projects {
+			// Rules that route to archived projects are skipped.
+			if target := &conf.Projects[j]; target.ID == rule.ProjectID && !target.Archived() {
+				return target
+			}
+		}
+	}
+	return project
+}
+
+func routingRuleMatches(rule *bunapp.RoutingRule, resource AttrMap) bool {
+	for key, value := range rule.Attrs {
+		attr, ok := resource[key]
+		if !ok || asString(attr) != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func TestRouteProject(t *testing.T) {
+	conf := &bunapp.AppConfig{
+		Projects: []bunapp.Project{
+			{
+				ID: 1,
+				RoutingRules: []bunapp.RoutingRule{
+					{Attrs: map[string]string{"k8s.namespace.name": "payments"}, ProjectID: 2},
+					{Attrs: map[string]string{"k8s.namespace.name": "search"}, ProjectID: 3},
+				},
+			},
+			{ID: 2},
+			{ID: 3},
+		},
+	}
+	shared := &conf.Projects[0]
+
+	require.Equal(t, uint32(2), routeProject(conf, shared, AttrMap{
+		"k8s.namespace.name": "payments",
+	}).ID)
+	require.Equal(t, uint32(3), routeProject(conf, shared, AttrMap{
+		"k8s.namespace.name": "search",
+	}).ID)
+	require.Equal(t, uint32(1), routeProject(conf, shared, AttrMap{
+		"k8s.namespace.name": "default",
+	}).ID)
+	require.Equal(t, uint32(1), routeProject(conf, shared, AttrMap{}).ID)
+
+	conf.Projects[1].Archive = &bunapp.ProjectArchive{Date: time.Now()}
+	require.Equal(t, uint32(1), routeProject(conf, shared, AttrMap{
+		"k8s.namespace.name": "payments",
+	}).ID)
+}
+
+func TestWalkOTLPSpansAppliesProjectResourceAttrs(t *testing.T) {
+	conf := &bunapp.AppConfig{
+		Projects: []bunapp.Project{
+			{
+				ID:            1,
+				ResourceAttrs: map[string]string{"region": "eu-1", "team": "platform"},
+				RoutingRules: []bunapp.RoutingRule{
+					{Attrs: map[string]string{"k8s.namespace.name": "payments"}, ProjectID: 2},
+				},
+			},
+			{ID: 2, ResourceAttrs: map[string]string{"team": "payments"}},
+		},
+	}
+	conf.SpanLimits.AttrCountLimit = 128
+
+	var resources []AttrMap
+	walkOTLPSpans(conf, &conf.Projects[0], []*tracepb.ResourceSpans{
+		benchResourceSpans(1)[0],
+		{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+				benchStringAttr("k8s.namespace.name", "payments"),
+				benchStringAttr("region", "us-1"),
+			}},
+			InstrumentationLibrarySpans: benchResourceSpans(1)[0].InstrumentationLibrarySpans,
+		},
+	}, func(span otlpSpan) {
+		resources = append(resources, span.resource)
+	})
+
+	require.Len(t, resources, 2)
+	require.Equal(t, "eu-1", resources[0]["region"])
+	require.Equal(t, "platform", resources[0]["team"])
+	require.Equal(t, "us-1", resources[1]["region"])
+	require.Equal(t, "payments", resources[1]["team"])
+}
@@ -0,0 +1,38 @@
+package tracing
+
+import "github.com/uptrace/uptrace/pkg/tracing/xattr"
+
+// semconvRenames maps attributes renamed by newer versions of OpenTelemetry semantic
+// conventions to the names used by Uptrace so spans from SDKs that use different
+// semconv versions are grouped and queried consistently.
+var semconvRenames = map[string]string{
+	"http.request.method":         xattr.HTTPMethod,
+	"http.response.status_code":   xattr.HTTPStatusCode,
+	"http.response.body.size":     xattr.HTTPResponseContentLength,
+	"url.full":                    xattr.HTTPURL,
+	"url.scheme":                  xattr.HTTPScheme,
+	"client.address":              xattr.HTTPClientIP,
+	"user_agent.original":         xattr.HTTPUserAgent,
+	"db.system.name":              xattr.DBSystem,
+	"db.query.text":               xattr.DBStatement,
+	"db.operation.name":           xattr.DBOperation,
+	"db.collection.name":          xattr.DBSqlTable,
+	"messaging.destination.name":  xattr.MessagingDestination,
+	"messaging.operation.type":    xattr.MessagingOperation,
+	"deployment.environment.name": xattr.DeploymentEnvironment,
+}
+
+// canonicalizeAttrs renames attributes to the canonical names. When both names
+// are present, the canonical attribute wins.
+func canonicalizeAttrs(attrs AttrMap) {
+	for key, canonicalKey := range semconvRenames {
+		value, ok := attrs[key]
+		if !ok {
+			continue
+		}
+		if !attrs.Has(canonicalKey) {
+			attrs[canonicalKey] = value
+		}
+		delete(attrs, key)
+	}
+}
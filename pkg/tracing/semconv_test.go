@@ -0,0 +1,23 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+)
+
+func TestCanonicalizeAttrs(t *testing.T) {
+	attrs := AttrMap{
+		"http.request.method":       "GET",
+		"http.response.status_code": int64(200),
+		xattr.DBSystem:              "postgresql",
+		"db.system.name":            "mysql",
+	}
+	canonicalizeAttrs(attrs)
+	require.Equal(t, AttrMap{
+		xattr.HTTPMethod:     "GET",
+		xattr.HTTPStatusCode: int64(200),
+		xattr.DBSystem:       "postgresql",
+	}, attrs)
+}
@@ -0,0 +1,425 @@
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+type sentryEnvelopeItem struct {
+	Type    string
+	Payload []byte
+}
+
+// parseSentryEnvelope parses an envelope that consists of a header and a list of items,
+// see https://develop.sentry.dev/sdk/envelopes/
+func parseSentryEnvelope(b []byte) ([]sentryEnvelopeItem, error) {
+	_, b = readLine(b) // envelope header
+	if len(b) == 0 {
+		return nil, nil
+	}
+
+	var items []sentryEnvelopeItem
+
+	for len(b) > 0 {
+		var line []byte
+		line, b = readLine(b)
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var header struct {
+			Type   string `json:"type"`
+			Length int    `json:"length"`
+		}
+		if err := json.Unmarshal(line, &header); err != nil {
+			return nil, fmt.Errorf("sentry: can't parse item header: %w", err)
+		}
+
+		var payload []byte
+		if header.Length > 0 {
+			if header.Length > len(b) {
+				return nil, errors.New("sentry: item length exceeds envelope size")
+			}
+			payload, b = b[:header.Length], b[header.Length:]
+			if len(b) > 0 && b[0] == '\n' {
+				b = b[1:]
+			}
+		} else {
+			payload, b = readLine(b)
+		}
+
+		items = append(items, sentryEnvelopeItem{
+			Type:    header.Type,
+			Payload: payload,
+		})
+	}
+
+	return items, nil
+}
+
+func readLine(b []byte) (line, rest []byte) {
+	if idx := bytes.IndexByte(b, '\n'); idx >= 0 {
+		return b[:idx], b[idx+1:]
+	}
+	return b, nil
+}
+
+//------------------------------------------------------------------------------
+
+type sentryEvent struct {
+	EventID     string          `json:"event_id"`
+	Timestamp   json.RawMessage `json:"timestamp"`
+	Platform    string          `json:"platform"`
+	Level       string          `json:"level"`
+	Logger      string          `json:"logger"`
+	Transaction string          `json:"transaction"`
+	ServerName  string          `json:"server_name"`
+	Release     string          `json:"release"`
+	Environment string          `json:"environment"`
+
+	Message  json.RawMessage `json:"message"`
+	LogEntry *struct {
+		Formatted string `json:"formatted"`
+		Message   string `json:"message"`
+	} `json:"logentry"`
+
+	Exception *struct {
+		Values []sentryException `json:"values"`
+	} `json:"exception"`
+
+	Tags json.RawMessage `json:"tags"`
+
+	Contexts struct {
+		Trace *struct {
+			TraceID string `json:"trace_id"`
+			SpanID  string `json:"span_id"`
+			Op      string `json:"op"`
+		} `json:"trace"`
+	} `json:"contexts"`
+
+	User *struct {
+		ID        string `json:"id"`
+		Email     string `json:"email"`
+		IPAddress string `json:"ip_address"`
+		Username  string `json:"username"`
+	} `json:"user"`
+
+	Request *struct {
+		URL    string `json:"url"`
+		Method string `json:"method"`
+	} `json:"request"`
+
+	SDK *struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"sdk"`
+}
+
+type sentryException struct {
+	Type       string `json:"type"`
+	Value      string `json:"value"`
+	Module     string `json:"module"`
+	Stacktrace *struct {
+		Frames []struct {
+			Filename string `json:"filename"`
+			Function string `json:"function"`
+			Module   string `json:"module"`
+			Lineno   int    `json:"lineno"`
+		} `json:"frames"`
+	} `json:"stacktrace"`
+}
+
+func (e *sentryEvent) time() time.Time {
+	b := bytes.Trim(e.Timestamp, `"`)
+	if len(b) == 0 {
+		return time.Now()
+	}
+	if f, err := strconv.ParseFloat(string(b), 64); err == nil {
+		return time.Unix(0, int64(f*1e9))
+	}
+	if tm, err := time.Parse(time.RFC3339Nano, string(b)); err == nil {
+		return tm
+	}
+	// Sentry also accepts timestamps without a timezone.
+	if tm, err := time.Parse("2006-01-02T15:04:05.999999", string(b)); err == nil {
+		return tm
+	}
+	return time.Now()
+}
+
+func (e *sentryEvent) message() string {
+	if e.LogEntry != nil {
+		if e.LogEntry.Formatted != "" {
+			return e.LogEntry.Formatted
+		}
+		return e.LogEntry.Message
+	}
+
+	if len(e.Message) == 0 {
+		return ""
+	}
+
+	var s string
+	if err := json.Unmarshal(e.Message, &s); err == nil {
+		return s
+	}
+
+	var m struct {
+		Formatted string `json:"formatted"`
+		Message   string `json:"message"`
+	}
+	if err := json.Unmarshal(e.Message, &m); err == nil {
+		if m.Formatted != "" {
+			return m.Formatted
+		}
+		return m.Message
+	}
+
+	return ""
+}
+
+// tags returns event tags that are sent either as an object or as a list of pairs.
+func (e *sentryEvent) tags() map[string]string {
+	if len(e.Tags) == 0 {
+		return nil
+	}
+
+	m := make(map[string]string)
+	if err := json.Unmarshal(e.Tags, &m); err == nil {
+		return m
+	}
+
+	var pairs [][2]string
+	if err := json.Unmarshal(e.Tags, &pairs); err == nil {
+		for _, pair := range pairs {
+			m[pair[0]] = pair[1]
+		}
+	}
+	return m
+}
+
+// serviceName guesses the service name, because Sentry does not have such a concept.
+// Releases are usually named like "my-app@1.2.3".
+func (e *sentryEvent) serviceName(tags map[string]string) string {
+	if s := tags[xattr.ServiceName]; s != "" {
+		return s
+	}
+	if s := tags["service"]; s != "" {
+		return s
+	}
+	if idx := strings.IndexByte(e.Release, '@'); idx > 0 {
+		return e.Release[:idx]
+	}
+	return e.Platform
+}
+
+// sentryResourceSpans converts a Sentry event to a span that contains an exception
+// or a log event. The span is a child of the active span, if any.
+func sentryResourceSpans(event *sentryEvent) (*tracepb.ResourceSpans, error) {
+	tags := event.tags()
+
+	traceID, parentID, err := sentryTraceContext(event)
+	if err != nil {
+		return nil, err
+	}
+
+	spanID := make([]byte, 8)
+	_, _ = rand.Read(spanID)
+
+	tm := uint64(event.time().UnixNano())
+	name := event.Transaction
+	if name == "" {
+		name = "sentry.event"
+	}
+
+	span := &tracepb.Span{
+		TraceId:           traceID,
+		SpanId:            spanID,
+		ParentSpanId:      parentID,
+		Name:              name,
+		Kind:              tracepb.Span_SPAN_KIND_INTERNAL,
+		StartTimeUnixNano: tm,
+		EndTimeUnixNano:   tm,
+		Attributes:        sentryAttrs(event, tags),
+		Events:            sentryEvents(event, tm),
+		Status: &tracepb.Status{
+			Code: tracepb.Status_STATUS_CODE_ERROR,
+		},
+	}
+
+	lib := &commonpb.InstrumentationLibrary{Name: "sentry"}
+	if event.SDK != nil {
+		lib.Name = event.SDK.Name
+		lib.Version = event.SDK.Version
+	}
+
+	return &tracepb.ResourceSpans{
+		Resource: sentryResource(event, tags),
+		InstrumentationLibrarySpans: []*tracepb.InstrumentationLibrarySpans{{
+			InstrumentationLibrary: lib,
+			Spans:                  []*tracepb.Span{span},
+		}},
+	}, nil
+}
+
+func sentryTraceContext(event *sentryEvent) (traceID, parentID []byte, err error) {
+	if trace := event.Contexts.Trace; trace != nil && trace.TraceID != "" {
+		traceID, err = hex.DecodeString(trace.TraceID)
+		if err != nil || len(traceID) != 16 {
+			return nil, nil, fmt.Errorf("sentry: invalid trace_id=%q", trace.TraceID)
+		}
+		if trace.SpanID != "" {
+			parentID, err = hex.DecodeString(trace.SpanID)
+			if err != nil || len(parentID) != 8 {
+				return nil, nil, fmt.Errorf("sentry: invalid span_id=%q", trace.SpanID)
+			}
+		}
+		return traceID, parentID, nil
+	}
+
+	// Events without a trace context become single-span traces.
+	traceID, err = hex.DecodeString(strings.ReplaceAll(event.EventID, "-", ""))
+	if err != nil || len(traceID) != 16 {
+		traceID = make([]byte, 16)
+		_, _ = rand.Read(traceID)
+	}
+	return traceID, nil, nil
+}
+
+func sentryResource(event *sentryEvent, tags map[string]string) *resourcepb.Resource {
+	attrs := []*commonpb.KeyValue{
+		otlpStringAttr(xattr.ServiceName, event.serviceName(tags)),
+	}
+	if event.ServerName != "" {
+		attrs = append(attrs, otlpStringAttr(xattr.HostName, event.ServerName))
+	}
+	if event.Release != "" {
+		attrs = append(attrs, otlpStringAttr(xattr.ServiceVersion, event.Release))
+	}
+	if event.Environment != "" {
+		attrs = append(attrs, otlpStringAttr(xattr.DeploymentEnvironment, event.Environment))
+	}
+	if event.Platform != "" {
+		attrs = append(attrs, otlpStringAttr(xattr.TelemetrySDKLanguage, event.Platform))
+	}
+	return &resourcepb.Resource{Attributes: attrs}
+}
+
+func sentryAttrs(event *sentryEvent, tags map[string]string) []*commonpb.KeyValue {
+	attrs := make([]*commonpb.KeyValue, 0, len(tags)+4)
+	for key, value := range tags {
+		if key == xattr.ServiceName || key == "service" {
+			continue
+		}
+		attrs = append(attrs, otlpStringAttr(key, value))
+	}
+
+	attrs = append(attrs, otlpStringAttr("sentry.event_id", event.EventID))
+	if event.Logger != "" {
+		attrs = append(attrs, otlpStringAttr("sentry.logger", event.Logger))
+	}
+	if user := event.User; user != nil {
+		if user.ID != "" {
+			attrs = append(attrs, otlpStringAttr(xattr.EnduserID, user.ID))
+		}
+		if user.IPAddress != "" {
+			attrs = append(attrs, otlpStringAttr(xattr.HTTPClientIP, user.IPAddress))
+		}
+	}
+	if req := event.Request; req != nil {
+		if req.Method != "" {
+			attrs = append(attrs, otlpStringAttr(xattr.HTTPMethod, req.Method))
+		}
+		if req.URL != "" {
+			attrs = append(attrs, otlpStringAttr(xattr.HTTPURL, req.URL))
+		}
+	}
+	return attrs
+}
+
+func sentryEvents(event *sentryEvent, tm uint64) []*tracepb.Span_Event {
+	if event.Exception == nil || len(event.Exception.Values) == 0 {
+		return []*tracepb.Span_Event{{
+			Name:         logEventType,
+			TimeUnixNano: tm,
+			Attributes: []*commonpb.KeyValue{
+				otlpStringAttr(xattr.LogSeverity, sentryLevel(event.Level)),
+				otlpStringAttr(xattr.LogMessage, event.message()),
+			},
+		}}
+	}
+
+	values := event.Exception.Values
+	events := make([]*tracepb.Span_Event, 0, len(values))
+
+	// The most recent exception is the last one.
+	for i := len(values) - 1; i >= 0; i-- {
+		exc := &values[i]
+
+		typ := exc.Type
+		if exc.Module != "" && !strings.Contains(typ, ".") {
+			typ = exc.Module + "." + typ
+		}
+
+		events = append(events, &tracepb.Span_Event{
+			Name:         exceptionEventType,
+			TimeUnixNano: tm,
+			Attributes: []*commonpb.KeyValue{
+				otlpStringAttr(xattr.ExceptionType, typ),
+				otlpStringAttr(xattr.ExceptionMessage, exc.Value),
+				otlpStringAttr(xattr.ExceptionStacktrace, sentryStacktrace(exc)),
+			},
+		})
+	}
+
+	return events
+}
+
+// sentryStacktrace formats frames from the most recent call to the oldest one.
+func sentryStacktrace(exc *sentryException) string {
+	if exc.Stacktrace == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	frames := exc.Stacktrace.Frames
+	for i := len(frames) - 1; i >= 0; i-- {
+		frame := &frames[i]
+
+		fn := frame.Function
+		if frame.Module != "" {
+			fn = frame.Module + "." + fn
+		}
+
+		b.WriteString(fn)
+		b.WriteString("\n\t")
+		b.WriteString(frame.Filename)
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(frame.Lineno))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func sentryLevel(level string) string {
+	switch level {
+	case "", "error":
+		return "ERROR"
+	case "warning":
+		return "WARN"
+	default:
+		return strings.ToUpper(level)
+	}
+}
@@ -0,0 +1,217 @@
+package tracing
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/org"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"go.uber.org/zap"
+)
+
+// SentryServer accepts events from Sentry SDKs. SDKs are configured with a DSN like
+// http://<project_token>@localhost:14318/<project_id> which makes them send envelopes
+// to /api/<project_id>/envelope/.
+type SentryServer struct {
+	*bunapp.App
+
+	traceService *TraceServiceServer
+}
+
+func NewSentryServer(app *bunapp.App, traceService *TraceServiceServer) *SentryServer {
+	return &SentryServer{
+		App:          app,
+		traceService: traceService,
+	}
+}
+
+func (s *SentryServer) project(ctx context.Context, req bunrouter.Request) (*bunapp.Project, error) {
+	if err := org.CheckAuthThrottle(ctx, s.App); err != nil {
+		return nil, err
+	}
+
+	projectID, err := req.Params().Uint32("project_id")
+	if err != nil {
+		return nil, err
+	}
+
+	key := sentryKey(req)
+	if key == "" {
+		return nil, httperror.Unauthorized("sentry_key is required")
+	}
+
+	// Unknown projects fail like invalid keys so clients can't probe project ids.
+	project, err := org.SelectProjectByID(ctx, s.App, projectID)
+	if err != nil || subtle.ConstantTimeCompare([]byte(key), []byte(project.Token)) != 1 {
+		org.AuthFailed(ctx, s.App, "invalid sentry_key")
+		return nil, httperror.Unauthorized("sentry_key does not match the project")
+	}
+	if err := org.CheckIngestProject(project); err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+// sentryKey returns the public key from the X-Sentry-Auth header, for example,
+// "Sentry sentry_version=7, sentry_key=<key>", or from the sentry_key query param.
+func sentryKey(req bunrouter.Request) string {
+	auth := req.Header.Get("X-Sentry-Auth")
+	auth = strings.TrimPrefix(auth, "Sentry ")
+	for _, part := range strings.Split(auth, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok && key == "sentry_key" {
+			return value
+		}
+	}
+	return req.URL.Query().Get("sentry_key")
+}
+
+func (s *SentryServer) Envelope(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	project, err := s.project(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+
+	items, err := parseSentryEnvelope(body)
+	if err != nil {
+		return httperror.BadRequest("sentry", err.Error())
+	}
+
+	var eventID string
+	resourceSpans := make([]*tracepb.ResourceSpans, 0, len(items))
+
+	for _, item := range items {
+		// Sessions, transactions, and attachments are not supported.
+		if item.Type != "event" {
+			continue
+		}
+
+		event, rs, err := parseSentryEvent(item.Payload)
+		if err != nil {
+			s.Zap(ctx).Error("sentry: invalid event", zap.Error(err))
+			continue
+		}
+
+		eventID = event.EventID
+		resourceSpans = append(resourceSpans, rs)
+	}
+
+	if len(resourceSpans) > 0 {
+		if _, err := s.traceService.process(project, resourceSpans); err != nil {
+			return err
+		}
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"id": eventID,
+	})
+}
+
+// Store accepts a single event sent to the legacy /api/<project_id>/store/ endpoint
+// that is still used by older SDKs.
+func (s *SentryServer) Store(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	project, err := s.project(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+
+	body, err = decodeSentryStoreBody(body, s.Config().IngestLimits.MaxBodySize)
+	if err == errSentryBodyTooLarge {
+		return httperror.New(http.StatusRequestEntityTooLarge,
+			"request_body_too_large", "decompressed event is too large")
+	}
+	if err != nil {
+		return httperror.BadRequest("sentry", err.Error())
+	}
+
+	event, rs, err := parseSentryEvent(body)
+	if err != nil {
+		return httperror.BadRequest("sentry", err.Error())
+	}
+
+	if _, err := s.traceService.process(project, []*tracepb.ResourceSpans{rs}); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"id": event.EventID,
+	})
+}
+
+var errSentryBodyTooLarge = errors.New("sentry: decompressed event is too large")
+
+// decodeSentryStoreBody decodes base64-encoded zlib payloads of older SDKs, for example,
+// raven-python. Compressed payloads with Content-Encoding are decoded by
+// httputil.DecompressHandler. Decompressed payloads are limited to maxSize bytes,
+// that is, ingest_limits.max_body_size.
+func decodeSentryStoreBody(body []byte, maxSize int64) ([]byte, error) {
+	body = bytes.TrimSpace(body)
+	if bytes.HasPrefix(body, []byte("{")) {
+		return body, nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("can't decode event: %w", err)
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("can't decompress event: %w", err)
+	}
+	defer zr.Close()
+
+	if maxSize <= 0 {
+		return ioutil.ReadAll(zr)
+	}
+
+	b, err = ioutil.ReadAll(io.LimitReader(zr, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > maxSize {
+		return nil, errSentryBodyTooLarge
+	}
+	return b, nil
+}
+
+func parseSentryEvent(b []byte) (*sentryEvent, *tracepb.ResourceSpans, error) {
+	event := new(sentryEvent)
+	if err := json.Unmarshal(b, event); err != nil {
+		return nil, nil, fmt.Errorf("can't parse event: %w", err)
+	}
+
+	rs, err := sentryResourceSpans(event)
+	if err != nil {
+		return nil, nil, err
+	}
+	return event, rs, nil
+}
@@ -0,0 +1,151 @@
+package tracing
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	"github.com/uptrace/uptrace/pkg/org"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	"google.golang.org/grpc/peer"
+)
+
+func TestParseSentryEnvelope(t *testing.T) {
+	envelope := `{"event_id":"9ec79c33ec9942ab8353589fcb2e04dc","dsn":"http://key@localhost/1"}
+{"type":"attachment","length":10}
+helloworld
+{"type":"event"}
+{"event_id":"9ec79c33ec9942ab8353589fcb2e04dc","message":"hello"}
+`
+	items, err := parseSentryEnvelope([]byte(envelope))
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	require.Equal(t, "attachment", items[0].Type)
+	require.Equal(t, "helloworld", string(items[0].Payload))
+	require.Equal(t, "event", items[1].Type)
+	require.Contains(t, string(items[1].Payload), `"message":"hello"`)
+}
+
+func TestSentryResourceSpans(t *testing.T) {
+	event := new(sentryEvent)
+	err := json.Unmarshal([]byte(`{
+		"event_id": "9ec79c33ec9942ab8353589fcb2e04dc",
+		"timestamp": 1643366400.5,
+		"platform": "python",
+		"release": "checkout@1.2.3",
+		"environment": "production",
+		"server_name": "web-1",
+		"tags": [["browser", "Chrome"]],
+		"contexts": {
+			"trace": {"trace_id": "771a43a4192642f0b136d5159a501700", "span_id": "a1b2c3d4e5f60718"}
+		},
+		"exception": {
+			"values": [{
+				"type": "ZeroDivisionError",
+				"value": "division by zero",
+				"stacktrace": {"frames": [
+					{"function": "main", "filename": "app.py", "lineno": 10},
+					{"function": "divide", "filename": "math.py", "lineno": 3}
+				]}
+			}]
+		}
+	}`), event)
+	require.NoError(t, err)
+
+	rs, err := sentryResourceSpans(event)
+	require.NoError(t, err)
+
+	resource := otlpAttrs(rs.Resource.Attributes)
+	require.Equal(t, "checkout", resource[xattr.ServiceName])
+	require.Equal(t, "checkout@1.2.3", resource[xattr.ServiceVersion])
+	require.Equal(t, "web-1", resource[xattr.HostName])
+
+	span := rs.InstrumentationLibrarySpans[0].Spans[0]
+	require.Equal(t, "771a43a4192642f0b136d5159a501700", hex.EncodeToString(span.TraceId))
+	require.Equal(t, "a1b2c3d4e5f60718", hex.EncodeToString(span.ParentSpanId))
+	require.Equal(t, uint64(1643366400500000000), span.StartTimeUnixNano)
+	require.Equal(t, "Chrome", otlpAttrs(span.Attributes)["browser"])
+
+	require.Len(t, span.Events, 1)
+	attrs := otlpAttrs(span.Events[0].Attributes)
+	require.Equal(t, exceptionEventType, span.Events[0].Name)
+	require.Equal(t, "ZeroDivisionError", attrs[xattr.ExceptionType])
+	require.Equal(t, "divide\n\tmath.py:3\nmain\n\tapp.py:10\n", attrs[xattr.ExceptionStacktrace])
+}
+
+func TestDecodeSentryStoreBody(t *testing.T) {
+	event := `{"event_id":"9ec79c33ec9942ab8353589fcb2e04dc","message":"hello"}`
+
+	b, err := decodeSentryStoreBody([]byte(event), 1<<20)
+	require.NoError(t, err)
+	require.Equal(t, event, string(b))
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	_, err = zw.Write([]byte(event))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	compressed := []byte(base64.StdEncoding.EncodeToString(buf.Bytes()))
+	b, err = decodeSentryStoreBody(compressed, 1<<20)
+	require.NoError(t, err)
+	require.Equal(t, event, string(b))
+
+	_, err = decodeSentryStoreBody(compressed, int64(len(event)-1))
+	require.Equal(t, errSentryBodyTooLarge, err)
+
+	_, err = decodeSentryStoreBody([]byte("not an event"), 1<<20)
+	require.Error(t, err)
+}
+
+func TestSentryServerProject(t *testing.T) {
+	conf := &bunapp.AppConfig{
+		Projects: []bunapp.Project{{ID: 1, Token: "project1_secret_token"}},
+	}
+	conf.CH.DSN = "clickhouse://default:@localhost:9000/uptrace?sslmode=disable"
+	conf.AuthThrottle.MaxFailures = 2
+	conf.AuthThrottle.Window = time.Minute
+	conf.AuthThrottle.Lockout = time.Minute
+
+	app := bunapp.New(context.Background(), conf)
+	defer app.Stop()
+
+	s := NewSentryServer(app, nil)
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1234},
+	})
+
+	var err error
+	router := bunrouter.New()
+	router.POST("/api/:project_id/store/", func(w http.ResponseWriter, req bunrouter.Request) error {
+		_, err = s.project(ctx, req)
+		return nil
+	})
+	project := func(projectID string) error {
+		req := httptest.NewRequest(http.MethodPost,
+			"/api/"+projectID+"/store/?sentry_key=project1_secret_token", nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		return err
+	}
+
+	require.NoError(t, project("1"))
+
+	// Unknown projects fail like invalid keys and are throttled.
+	err1 := project("2")
+	require.Equal(t, http.StatusUnauthorized, httperror.From(err1).Status)
+	require.Equal(t, "sentry_key does not match the project", httperror.From(err1).Message)
+	require.Equal(t, err1, project("3"))
+	require.Equal(t, org.ErrAuthLockedOut, project("1"))
+}
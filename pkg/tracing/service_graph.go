@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httputil"
+)
+
+// ServiceEdge is a call from the client service to the server service
+// or to a database, for example, "postgresql".
+type ServiceEdge struct {
+	Client string `json:"client"`
+	Server string `json:"server"`
+	Count  uint64 `json:"count"`
+}
+
+const serviceGraphSpans = `SELECT
+	"span.trace_id" AS trace_id, "span.id" AS id, "span.parent_id" AS parent_id,
+	"service.key" AS service
+FROM spans_index
+WHERE project_id = ? AND "span.time" >= ? AND "span.time" < ?`
+
+// SelectServiceGraph returns calls between services by joining spans with
+// their parent spans that belong to other services.
+func SelectServiceGraph(
+	ctx context.Context, app *bunapp.App, projectID uint32, gte, lt time.Time,
+) ([]ServiceEdge, error) {
+	edges := make([]ServiceEdge, 0)
+
+	if err := app.CH().NewSelect().
+		ColumnExpr("p.service AS client").
+		ColumnExpr("s.service AS server").
+		ColumnExpr("count() AS count").
+		TableExpr("("+serviceGraphSpans+") AS s", projectID, gte, lt).
+		Join("JOIN ("+serviceGraphSpans+") AS p", projectID, gte, lt).
+		JoinOn("p.trace_id = s.trace_id").
+		JoinOn("p.id = s.parent_id").
+		Where("p.service != s.service").
+		GroupExpr("client, server").
+		Limit(1000).
+		Scan(ctx, &edges); err != nil {
+		return nil, err
+	}
+
+	var dbEdges []ServiceEdge
+
+	if err := app.CH().NewSelect().
+		ColumnExpr(`"service.key" AS client`).
+		ColumnExpr(`"db.system" AS server`).
+		ColumnExpr("count() AS count").
+		TableExpr("spans_index").
+		Where("project_id = ?", projectID).
+		Where(`"span.time" >= ?`, gte).
+		Where(`"span.time" < ?`, lt).
+		Where(`"db.system" != ''`).
+		GroupExpr("client, server").
+		Limit(1000).
+		Scan(ctx, &dbEdges); err != nil {
+		return nil, err
+	}
+
+	return append(edges, dbEdges...), nil
+}
+
+// Graph returns the service graph for the time range.
+func (h *ServiceHandler) Graph(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	f, err := DecodeServiceFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+
+	edges, err := SelectServiceGraph(ctx, h.App, f.ProjectID, f.TimeGTE, f.TimeLT)
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"edges": edges,
+	})
+}
@@ -0,0 +1,282 @@
+package tracing
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/urlstruct"
+	"go.uber.org/zap"
+)
+
+const (
+	healthInterval = time.Minute
+	// Health is calculated using the last healthWindow and compared with
+	// healthBaseline before it.
+	healthWindow   = 5 * time.Minute
+	healthBaseline = time.Hour
+)
+
+// Span types that are used to calculate health. Events and internal spans are ignored.
+var healthSpanTypes = []string{
+	httpSpanType,
+	dbSpanType,
+	rpcSpanType,
+	messagingSpanType,
+	serviceSpanType,
+}
+
+// ServiceHealth is a composite health score of a service from 0 (unhealthy)
+// to 100 (healthy).
+type ServiceHealth struct {
+	ch.CHModel `ch:"table:service_health,alias:h"`
+
+	ProjectID uint32    `json:"projectId"`
+	Service   string    `json:"service" ch:",lc"`
+	Time      time.Time `json:"time"`
+	Score     float32   `json:"score"`
+
+	ErrorRate         float32 `json:"errorRate"`
+	BaselineErrorRate float32 `json:"baselineErrorRate"`
+	P99               float32 `json:"p99"`
+	BaselineP99       float32 `json:"baselineP99"`
+	Rate              float32 `json:"rate"`
+	BaselineRate      float32 `json:"baselineRate"`
+	Apdex             float32 `json:"apdex"`
+}
+
+// healthScore weighs errors, Apdex, latency compared to the baseline, and throughput
+// anomalies. Services without a baseline are scored using errors and Apdex only.
+func healthScore(h *ServiceHealth) float32 {
+	errorScore := 1 - clamp01(float64(h.ErrorRate)/0.05)
+
+	apdex := float64(h.Apdex)
+	if math.IsNaN(apdex) {
+		apdex = 1
+	}
+
+	latencyScore := 1.0
+	throughputScore := 1.0
+	if h.BaselineRate > 0 {
+		if h.BaselineP99 > 0 {
+			// 1.2x of the baseline p99 is fine and 3x is unhealthy.
+			ratio := float64(h.P99 / h.BaselineP99)
+			latencyScore = 1 - clamp01((ratio-1.2)/1.8)
+		}
+
+		// Throughput within 2x of the baseline is fine and 8x is unhealthy.
+		ratio := float64(h.Rate / h.BaselineRate)
+		if ratio <= 0 {
+			throughputScore = 0
+		} else {
+			throughputScore = 1 - clamp01((math.Abs(math.Log2(ratio))-1)/2)
+		}
+	}
+
+	score := 0.35*errorScore + 0.25*apdex + 0.25*latencyScore + 0.15*throughputScore
+	return float32(math.Round(score * 100))
+}
+
+func clamp01(n float64) float64 {
+	switch {
+	case math.IsNaN(n), n < 0:
+		return 0
+	case n > 1:
+		return 1
+	default:
+		return n
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// HealthMonitor calculates health scores of all services once a minute.
+type HealthMonitor struct {
+	*bunapp.App
+}
+
+func NewHealthMonitor(app *bunapp.App) *HealthMonitor {
+	return &HealthMonitor{
+		App: app,
+	}
+}
+
+func (m *HealthMonitor) Run(ctx context.Context, app *bunapp.App) error {
+	app.WaitGroup().Add(1)
+	go func() {
+		defer app.WaitGroup().Done()
+
+		for {
+			// Wait until the spans of the last minute are flushed.
+			next := time.Now().Truncate(healthInterval).Add(healthInterval + 10*time.Second)
+			timer := time.NewTimer(time.Until(next))
+
+			select {
+			case <-app.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			ctx := app.Context()
+			if err := m.updateHealth(ctx, time.Now().Truncate(healthInterval)); err != nil {
+				app.Zap(ctx).Error("updateHealth failed", zap.Error(err))
+			}
+		}
+	}()
+	return nil
+}
+
+func (m *HealthMonitor) updateHealth(ctx context.Context, tm time.Time) error {
+	windowGTE := tm.Add(-healthWindow)
+	baselineGTE := windowGTE.Add(-healthBaseline)
+	healths := make([]*ServiceHealth, 0)
+
+	if err := m.CH().NewSelect().
+		ColumnExpr("project_id, service").
+		ColumnExpr("toFloat32(sumIf(error_count, time >= ?) / sumIf(count, time >= ?)) AS error_rate",
+			windowGTE, windowGTE).
+		ColumnExpr("toFloat32(sumIf(error_count, time < ?) / sumIf(count, time < ?)) AS baseline_error_rate",
+			windowGTE, windowGTE).
+		ColumnExpr("toFloat32(quantilesTDigestWeightedMergeIf(0.5, 0.9, 0.99)(tdigest, time >= ?)[3]) AS p99",
+			windowGTE).
+		ColumnExpr("toFloat32(quantilesTDigestWeightedMergeIf(0.5, 0.9, 0.99)(tdigest, time < ?)[3]) AS baseline_p99",
+			windowGTE).
+		ColumnExpr("toFloat32(sumIf(count, time >= ?) / ?) AS rate", windowGTE, healthWindow.Minutes()).
+		ColumnExpr("toFloat32(sumIf(count, time < ?) / ?) AS baseline_rate", windowGTE, healthBaseline.Minutes()).
+		ColumnExpr("toFloat32((sumIf(satisfied_count, time >= ?) + sumIf(tolerating_count, time >= ?) / 2) / "+
+			"sumIf(satisfied_count + tolerating_count + frustrated_count, time >= ?)) AS apdex",
+			windowGTE, windowGTE, windowGTE).
+		TableExpr("span_group_minutes").
+		Where("time >= ?", baselineGTE).
+		Where("time < ?", tm).
+		Where("splitByChar(':', system)[1] IN (?)", ch.In(healthSpanTypes)).
+		GroupExpr("project_id, service").
+		Having("sumIf(count, time >= ?) > 0", windowGTE).
+		Scan(ctx, &healths); err != nil {
+		return err
+	}
+	if len(healths) == 0 {
+		return nil
+	}
+
+	for _, h := range healths {
+		h.Time = tm
+		// There were no spans in the baseline period.
+		h.BaselineErrorRate = zeroNaN32(h.BaselineErrorRate)
+		h.BaselineP99 = zeroNaN32(h.BaselineP99)
+		h.Score = healthScore(h)
+		h.Apdex = zeroNaN32(h.Apdex)
+	}
+
+	if _, err := m.CH().NewInsert().Model(&healths).Exec(ctx); err != nil {
+		return err
+	}
+	return nil
+}
+
+func zeroNaN32(n float32) float32 {
+	if math.IsNaN(float64(n)) {
+		return 0
+	}
+	return n
+}
+
+//------------------------------------------------------------------------------
+
+// ServiceHealthList returns the latest health scores of services starting from
+// the least healthy one.
+func (h *ServiceHandler) ServiceHealthList(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	projectID, err := req.Params().Uint32("project_id")
+	if err != nil {
+		return err
+	}
+
+	healths := make([]ServiceHealth, 0)
+
+	if err := h.CH().NewSelect().
+		ColumnExpr("project_id, service, max(time) AS time").
+		ColumnExpr("argMax(score, h.time) AS score").
+		ColumnExpr("argMax(error_rate, h.time) AS error_rate").
+		ColumnExpr("argMax(baseline_error_rate, h.time) AS baseline_error_rate").
+		ColumnExpr("argMax(p99, h.time) AS p99").
+		ColumnExpr("argMax(baseline_p99, h.time) AS baseline_p99").
+		ColumnExpr("argMax(rate, h.time) AS rate").
+		ColumnExpr("argMax(baseline_rate, h.time) AS baseline_rate").
+		ColumnExpr("argMax(apdex, h.time) AS apdex").
+		Model(&healths).
+		Where("project_id = ?", projectID).
+		Where("h.time >= ?", time.Now().Add(-time.Hour)).
+		GroupExpr("project_id, service").
+		OrderExpr("score ASC").
+		Limit(1000).
+		Scan(ctx); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"services": healths,
+	})
+}
+
+type ServiceHealthFilter struct {
+	*bunapp.App `urlstruct:"-"`
+
+	TimeFilter
+
+	ProjectID uint32
+	Service   string
+}
+
+func DecodeServiceHealthFilter(app *bunapp.App, req bunrouter.Request) (*ServiceHealthFilter, error) {
+	f := &ServiceHealthFilter{App: app}
+	if err := bunapp.UnmarshalValues(req, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+var _ urlstruct.ValuesUnmarshaler = (*ServiceHealthFilter)(nil)
+
+func (f *ServiceHealthFilter) UnmarshalValues(ctx context.Context, values url.Values) error {
+	if err := f.TimeFilter.UnmarshalValues(ctx, values); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ServiceHealthHistory returns health scores of the service in the time range.
+func (h *ServiceHandler) ServiceHealthHistory(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	f, err := DecodeServiceHealthFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+
+	healths := make([]ServiceHealth, 0)
+
+	if err := h.CH().NewSelect().
+		Model(&healths).
+		Where("project_id = ?", f.ProjectID).
+		Where("service = ?", f.Service).
+		Where("time >= ?", f.TimeGTE).
+		Where("time < ?", f.TimeLT).
+		OrderExpr("time ASC").
+		Limit(10000).
+		Scan(ctx); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"history": healths,
+	})
+}
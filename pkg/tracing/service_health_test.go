@@ -0,0 +1,33 @@
+package tracing
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthScore(t *testing.T) {
+	type Test struct {
+		health ServiceHealth
+		score  float32
+	}
+
+	tests := []Test{
+		{ServiceHealth{Apdex: 1}, 100},
+		{ServiceHealth{Apdex: float32(math.NaN())}, 100},
+		{ServiceHealth{ErrorRate: 0.05, Apdex: 1}, 65},
+		{ServiceHealth{
+			Apdex: 1, P99: 300, BaselineP99: 100, Rate: 10, BaselineRate: 10,
+		}, 75},
+		{ServiceHealth{
+			Apdex: 1, P99: 100, BaselineP99: 100, Rate: 10, BaselineRate: 80,
+		}, 85},
+		{ServiceHealth{
+			Apdex: 1, P99: 100, BaselineP99: 100, Rate: 15, BaselineRate: 10,
+		}, 100},
+	}
+	for i, test := range tests {
+		require.Equal(t, test.score, healthScore(&test.health), "#%d", i)
+	}
+}
@@ -37,7 +37,19 @@ type Span struct {
 	Events []*Span     `json:"events,omitempty" msgpack:"-" ch:"-"`
 	Links  []*SpanLink `json:"links" ch:"-"`
 
+	// Attributes, events, and links dropped by SDKs and span limits.
+	DroppedAttrsCount  uint32 `json:"droppedAttrsCount,omitempty" msgpack:",omitempty" ch:"-"`
+	DroppedEventsCount uint32 `json:"droppedEventsCount,omitempty" msgpack:",omitempty" ch:"-"`
+	DroppedLinksCount  uint32 `json:"droppedLinksCount,omitempty" msgpack:",omitempty" ch:"-"`
+
+	// Blob keys of the span name and attributes that were moved to the blob storage
+	// and replaced with previews.
+	BlobRefs map[string]string `json:"-" msgpack:",omitempty" ch:"-"`
+
 	Children []*Span `json:"children,omitempty" msgpack:"-" ch:"-"`
+
+	// Synthetic is true for placeholder roots of traces whose root span never arrived.
+	Synthetic bool `json:"synthetic,omitempty" msgpack:"-" ch:"-"`
 }
 
 type SpanLink struct {
@@ -193,23 +205,38 @@ func BuildSpanTree(spansPtr *[]*Span) *Span {
 	return root
 }
 
+// newFakeRoot creates a synthetic root for a trace whose root span was lost, for example,
+// dropped upstream. The root covers all spans so the trace can still be displayed.
 func newFakeRoot(spans []*Span) *Span {
 	sample := spans[0]
 	minTime := time.Unix(0, math.MaxInt64)
+	var maxTime time.Time
 
 	for _, s := range spans {
 		if s.Time.Before(minTime) {
 			minTime = s.Time
 		}
+		if endTime := s.EndTime(); endTime.After(maxTime) {
+			maxTime = endTime
+		}
 	}
 
 	span := new(Span)
+	span.ProjectID = sample.ProjectID
+	span.System = internalSpanType
 	span.ID = rand.Uint64()
 	span.TraceID = sample.TraceID
+	span.Name = "missing root span"
+	span.Kind = internalSpanKind
+	span.Time = minTime
+	span.Duration = maxTime.Sub(minTime)
+	span.DurationSelf = span.Duration
+	span.StatusCode = okStatusCode
 	span.Attrs = AttrMap{
 		xattr.SpanTime:       minTime,
 		xattr.SpanStatusCode: okStatusCode,
 	}
+	span.Synthetic = true
 	return span
 }
 
@@ -223,6 +250,8 @@ func isEventSystem(s string) bool {
 	case eventType,
 		logEventType,
 		exceptionEventType,
+		crashEventType,
+		anrEventType,
 		messageEventType:
 		return true
 	default:
@@ -234,13 +263,22 @@ func isLogSystem(s string) bool {
 	return strings.HasPrefix(s, "log:")
 }
 
+var errorSystems = []string{
+	exceptionEventType, crashEventType, anrEventType, "log:error", "log:fatal", "log:panic",
+}
+
 func isErrorSystem(s string) bool {
-	switch s {
-	case exceptionEventType, "log:error", "log:fatal", "log:panic":
-		return true
-	default:
-		return false
+	for _, system := range errorSystems {
+		if s == system {
+			return true
+		}
 	}
+	return false
+}
+
+// ErrorSystems returns systems of events that report errors.
+func ErrorSystems() []string {
+	return errorSystems
 }
 
 func marshalSpan(span *Span) []byte {
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/cespare/xxhash/v2"
+	"github.com/uptrace/uptrace/pkg/bunapp"
 	"github.com/uptrace/uptrace/pkg/logparser"
 	"github.com/uptrace/uptrace/pkg/sqlparser"
 	"github.com/uptrace/uptrace/pkg/tracing/xattr"
@@ -27,6 +28,8 @@ const (
 
 	logEventType       = "log"
 	exceptionEventType = "exception"
+	crashEventType     = "crash"
+	anrEventType       = "anr"
 	errorEventType     = "error"
 	messageEventType   = "message"
 	eventType          = "event"
@@ -35,17 +38,24 @@ const (
 type spanContext struct {
 	context.Context
 
-	digest *xxhash.Digest
+	digest   *xxhash.Digest
+	services *bunapp.ServiceGrouping
 }
 
-func newSpanContext(ctx context.Context) *spanContext {
+func newSpanContext(ctx context.Context, services *bunapp.ServiceGrouping) *spanContext {
 	return &spanContext{
 		Context: ctx,
 
-		digest: xxhash.New(),
+		digest:   xxhash.New(),
+		services: services,
 	}
 }
 
+// service returns the service key, for example, shop/api.
+func (ctx *spanContext) service(span *Span) string {
+	return ctx.services.Key(span.Attrs)
+}
+
 func newSpan(ctx *spanContext, dest *Span, src *otlpSpan) {
 	dest.ID = otlpSpanID(src.SpanId)
 	dest.ParentID = otlpSpanID(src.ParentSpanId)
@@ -66,12 +76,19 @@ func newSpan(ctx *spanContext, dest *Span, src *otlpSpan) {
 		dest.Attrs[k] = v
 	}
 	otlpSetAttrs(dest.Attrs, src.Attributes)
+	canonicalizeAttrs(dest.Attrs)
+	normalizeMessagingRetry(dest.Attrs)
+	normalizeWebVitals(dest.Attrs)
 
 	dest.Links = make([]*SpanLink, len(src.Links))
 	for i, link := range src.Links {
 		dest.Links[i] = newSpanLink(link)
 	}
 
+	dest.DroppedAttrsCount = src.DroppedAttributesCount
+	dest.DroppedEventsCount = src.DroppedEventsCount
+	dest.DroppedLinksCount = src.DroppedLinksCount
+
 	assignSpanSystemAndGroupID(ctx, dest)
 }
 
@@ -110,13 +127,9 @@ func isSQLKeyword(s string) bool {
 
 func assignSpanSystemAndGroupID(ctx *spanContext, span *Span) {
 	if s := span.Attrs.Text(xattr.RPCSystem); s != "" {
-		span.System = rpcSpanType + ":" + span.Attrs.ServiceName()
+		span.System = rpcSpanType + ":" + ctx.service(span)
 		span.GroupID = spanHash(ctx.digest, func(digest *xxhash.Digest) {
-			hashSpan(digest, span,
-				xattr.RPCSystem,
-				xattr.RPCService,
-				xattr.RPCMethod,
-			)
+			hashSpan(digest, span, rpcGroupingAttrs...)
 		})
 		return
 	}
@@ -124,12 +137,7 @@ func assignSpanSystemAndGroupID(ctx *spanContext, span *Span) {
 	if s := span.Attrs.Text(xattr.MessagingSystem); s != "" {
 		span.System = messagingSpanType + ":" + s
 		span.GroupID = spanHash(ctx.digest, func(digest *xxhash.Digest) {
-			hashSpan(digest, span,
-				xattr.MessagingSystem,
-				xattr.MessagingOperation,
-				xattr.MessagingDestination,
-				xattr.MessagingDestinationKind,
-			)
+			hashSpan(digest, span, messagingGroupingAttrs...)
 		})
 		return
 	}
@@ -139,7 +147,7 @@ func assignSpanSystemAndGroupID(ctx *spanContext, span *Span) {
 		stmt, _ := span.Attrs[xattr.DBStatement].(string)
 
 		span.GroupID = spanHash(ctx.digest, func(digest *xxhash.Digest) {
-			hashSpan(digest, span, xattr.DBOperation, xattr.DBSqlTable)
+			hashSpan(digest, span, dbGroupingAttrs...)
 			if stmt != "" {
 				hashDBStmt(digest, stmt)
 			}
@@ -151,15 +159,15 @@ func assignSpanSystemAndGroupID(ctx *spanContext, span *Span) {
 	}
 
 	if span.Attrs.Has(xattr.HTTPRoute) || span.Attrs.Has(xattr.HTTPTarget) {
-		span.System = httpSpanType + ":" + span.Attrs.ServiceName()
+		span.System = httpSpanType + ":" + ctx.service(span)
 		span.GroupID = spanHash(ctx.digest, func(digest *xxhash.Digest) {
-			hashSpan(digest, span, xattr.HTTPMethod, xattr.HTTPRoute)
+			hashSpan(digest, span, httpGroupingAttrs...)
 		})
 		return
 	}
 
 	if span.ParentID == 0 || span.Kind != internalSpanKind {
-		span.System = serviceSpanType + ":" + span.Attrs.ServiceName()
+		span.System = serviceSpanType + ":" + ctx.service(span)
 		span.GroupID = spanHash(ctx.digest, func(digest *xxhash.Digest) {
 			hashSpan(digest, span)
 		})
@@ -217,12 +225,24 @@ func newSpanFromEvent(
 
 	dest.EventName = event.Name
 	otlpSetAttrs(dest.Attrs, event.Attributes)
+	dest.DroppedAttrsCount = event.DroppedAttributesCount
+	if len(hostSpan.BlobRefs) > 0 {
+		dest.BlobRefs = make(map[string]string, len(hostSpan.BlobRefs))
+		for k, v := range hostSpan.BlobRefs {
+			dest.BlobRefs[k] = v
+		}
+	}
 	dest.Time = time.Unix(0, int64(event.TimeUnixNano))
 
 	assignEventSystemAndGroupID(ctx, dest)
 }
 
 func assignEventSystemAndGroupID(ctx *spanContext, span *Span) {
+	if system := mobileCrashType(span); system != "" {
+		assignMobileCrashSystemAndGroupID(ctx, span, system)
+		return
+	}
+
 	switch span.EventName {
 	case logEventType:
 		sev, _ := span.Attrs[xattr.LogSeverity].(string)
@@ -232,11 +252,7 @@ func assignEventSystemAndGroupID(ctx *spanContext, span *Span) {
 
 		span.System = logEventType + ":" + strings.ToLower(sev)
 		span.GroupID = spanHash(ctx.digest, func(digest *xxhash.Digest) {
-			hashSpan(digest, span,
-				xattr.LogSeverity,
-				xattr.LogSource,
-				xattr.LogFilepath,
-			)
+			hashSpan(digest, span, logGroupingAttrs...)
 			if s, _ := span.Attrs[xattr.LogMessage].(string); s != "" {
 				hashMessage(ctx.digest, s)
 			}
@@ -246,7 +262,7 @@ func assignEventSystemAndGroupID(ctx *spanContext, span *Span) {
 	case exceptionEventType, errorEventType:
 		span.System = exceptionEventType
 		span.GroupID = spanHash(ctx.digest, func(digest *xxhash.Digest) {
-			hashSpan(digest, span, xattr.ExceptionType)
+			hashSpan(digest, span, exceptionGroupingAttrs...)
 			if s, _ := span.Attrs[xattr.ExceptionMessage].(string); s != "" {
 				hashMessage(ctx.digest, s)
 			}
@@ -259,12 +275,7 @@ func assignEventSystemAndGroupID(ctx *spanContext, span *Span) {
 	case messageEventType:
 		span.System = spanMessageEventType(span)
 		span.GroupID = spanHash(ctx.digest, func(digest *xxhash.Digest) {
-			hashSpan(digest, span,
-				xattr.RPCSystem,
-				xattr.RPCService,
-				xattr.RPCMethod,
-				"message.type",
-			)
+			hashSpan(digest, span, messageGroupingAttrs...)
 		})
 		span.EventName = spanMessageEventName(span)
 		return
@@ -0,0 +1,117 @@
+package tracing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"go.uber.org/zap"
+	"go4.org/syncutil"
+)
+
+// spanNameBlobRef is the key of the span name in Span.BlobRefs.
+const spanNameBlobRef = "span.name"
+
+// spanBlobKey returns the blob key of the value. Keys are content addressed so
+// repeated values, for example, SQL queries, are stored once.
+func spanBlobKey(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	s := hex.EncodeToString(sum[:])
+	return "spans/" + s[:2] + "/" + s
+}
+
+// offloadSpanBlobs moves the span name and string attributes that are larger than
+// blob_storage.min_size and HTTP bodies that are larger than blob_storage.preview_size
+// to the blob storage leaving previews in the span.
+// Values stay in the span when they can't be stored.
+func offloadSpanBlobs(
+	ctx context.Context, app *bunapp.App, storage bunapp.BlobStorage, span *Span,
+) {
+	conf := &app.Config().BlobStorage
+
+	if len(span.Name) > conf.MinSize {
+		if putSpanBlob(ctx, app, storage, span, spanNameBlobRef, span.Name) {
+			span.Name = truncate(span.Name, conf.PreviewSize)
+		}
+	}
+
+	for key, value := range span.Attrs {
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		// HTTP bodies are always stored in the blob storage to keep ClickHouse small.
+		if len(s) <= conf.MinSize && !(isHTTPBodyAttr(key) && len(s) > conf.PreviewSize) {
+			continue
+		}
+		if putSpanBlob(ctx, app, storage, span, key, s) {
+			span.Attrs[key] = truncate(s, conf.PreviewSize)
+		}
+	}
+}
+
+func putSpanBlob(
+	ctx context.Context,
+	app *bunapp.App,
+	storage bunapp.BlobStorage,
+	span *Span,
+	ref, value string,
+) bool {
+	key := spanBlobKey(value)
+	if err := storage.Put(ctx, key, []byte(value)); err != nil {
+		app.Zap(ctx).Error("BlobStorage.Put failed", zap.Error(err), zap.String("key", key))
+		return false
+	}
+
+	if span.BlobRefs == nil {
+		span.BlobRefs = make(map[string]string)
+	}
+	span.BlobRefs[ref] = key
+	return true
+}
+
+// hydrateSpanBlobs replaces previews with the full values from the blob storage.
+// Spans keep the previews when the values can't be loaded.
+func hydrateSpanBlobs(ctx context.Context, app *bunapp.App, spans []*Span) {
+	storage := app.BlobStorage()
+	if storage == nil {
+		return
+	}
+
+	var group syncutil.Group
+	gate := syncutil.NewGate(8)
+
+	for _, span := range spans {
+		if len(span.BlobRefs) == 0 {
+			continue
+		}
+
+		span := span
+		gate.Start()
+		group.Go(func() error {
+			defer gate.Done()
+
+			for ref, key := range span.BlobRefs {
+				b, err := storage.Get(ctx, key)
+				if err != nil {
+					if !errors.Is(err, bunapp.ErrBlobNotFound) {
+						app.Zap(ctx).Error("BlobStorage.Get failed",
+							zap.Error(err), zap.String("key", key))
+					}
+					continue
+				}
+
+				if ref == spanNameBlobRef {
+					span.Name = string(b)
+				} else {
+					span.Attrs[ref] = string(b)
+				}
+			}
+			return nil
+		})
+	}
+
+	_ = group.Err()
+}
@@ -0,0 +1,109 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"go.uber.org/zap"
+)
+
+// QueryBudget explains how CHSelectLimits affected a query on spans_index so clients
+// can tell users that results are partial or sampled.
+type QueryBudget struct {
+	// Rows that match the project and the time range estimated using the primary key.
+	RowsEstimate  uint64 `json:"rowsEstimate"`
+	SampleRows    int64  `json:"sampleRows,omitempty"`
+	MaxRowsToRead int64  `json:"maxRowsToRead,omitempty"`
+
+	// Sampled is true when results were calculated using a sample of rows.
+	Sampled bool `json:"sampled"`
+	// LimitHit is true when the query stopped reading at max_rows_to_read.
+	LimitHit bool `json:"limitHit"`
+
+	// Narrower time range that fits into the limits or zero.
+	SuggestedTimeGTE time.Time `json:"suggestedTimeGte,omitempty"`
+	SuggestedTimeLT  time.Time `json:"suggestedTimeLt,omitempty"`
+}
+
+// selectQueryBudget estimates the rows read by the filter using EXPLAIN ESTIMATE which
+// only analyzes the primary key. It returns nil when the limits don't affect results.
+func selectQueryBudget(ctx context.Context, f *SpanFilter) *QueryBudget {
+	limits := &f.Config().CHSelectLimits
+	if f.Sample == 0 && limits.SampleRows == 0 && limits.MaxRowsToRead == 0 {
+		return nil
+	}
+
+	q := f.CH().NewSelect().
+		Model((*SpanIndex)(nil)).
+		ColumnExpr("count()").
+		Apply(f.whereClause)
+
+	rows, err := f.CH().QueryContext(ctx, "EXPLAIN ESTIMATE ?", q)
+	if err != nil {
+		// EXPLAIN ESTIMATE requires ClickHouse 21.9.
+		f.Zap(ctx).Warn("EXPLAIN ESTIMATE failed", zap.Error(err))
+		return nil
+	}
+	defer rows.Close()
+
+	var estimate uint64
+	for rows.Next() {
+		var database, table string
+		var parts, numRow, marks uint64
+		if err := rows.Scan(&database, &table, &parts, &numRow, &marks); err != nil {
+			f.Zap(ctx).Warn("EXPLAIN ESTIMATE failed", zap.Error(err))
+			return nil
+		}
+		estimate += numRow
+	}
+
+	return newQueryBudget(&f.TimeFilter, f.Sample, limits, estimate)
+}
+
+func newQueryBudget(
+	f *TimeFilter,
+	sample float64,
+	limits *bunapp.CHSelectLimits,
+	estimate uint64,
+) *QueryBudget {
+	budget := &QueryBudget{
+		RowsEstimate:  estimate,
+		SampleRows:    limits.SampleRows,
+		MaxRowsToRead: limits.MaxRowsToRead,
+	}
+
+	rowsToRead := float64(estimate)
+	switch {
+	case sample != 0:
+		budget.Sampled = true
+		rowsToRead *= sample
+	case limits.SampleRows != 0 && estimate > uint64(limits.SampleRows):
+		budget.Sampled = true
+		rowsToRead = float64(limits.SampleRows)
+	}
+	budget.LimitHit = limits.MaxRowsToRead != 0 && rowsToRead > float64(limits.MaxRowsToRead)
+
+	if !budget.Sampled && !budget.LimitHit {
+		return nil
+	}
+
+	// Suggest the most recent part of the time range that is read without sampling
+	// and limits assuming that rows are distributed evenly.
+	var maxRows int64
+	switch {
+	case budget.LimitHit:
+		maxRows = limits.MaxRowsToRead
+	case sample == 0:
+		maxRows = limits.SampleRows
+	}
+	if maxRows > 0 && estimate > 0 {
+		dur := time.Duration(float64(f.Duration()) * float64(maxRows) / float64(estimate))
+		if dur = dur.Truncate(time.Minute); dur >= time.Minute {
+			budget.SuggestedTimeGTE = f.TimeLT.Add(-dur)
+			budget.SuggestedTimeLT = f.TimeLT
+		}
+	}
+
+	return budget
+}
@@ -0,0 +1,32 @@
+package tracing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+func TestNewQueryBudget(t *testing.T) {
+	lt := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	f := &TimeFilter{TimeGTE: lt.Add(-10 * time.Hour), TimeLT: lt}
+	limits := &bunapp.CHSelectLimits{SampleRows: 10e6, MaxRowsToRead: 12e6}
+
+	require.Nil(t, newQueryBudget(f, 0, limits, 5e6))
+
+	budget := newQueryBudget(f, 0, limits, 20e6)
+	require.True(t, budget.Sampled)
+	require.False(t, budget.LimitHit)
+	require.Equal(t, lt.Add(-5*time.Hour), budget.SuggestedTimeGTE)
+	require.Equal(t, lt, budget.SuggestedTimeLT)
+
+	budget = newQueryBudget(f, 0, &bunapp.CHSelectLimits{MaxRowsToRead: 12e6}, 24e6)
+	require.False(t, budget.Sampled)
+	require.True(t, budget.LimitHit)
+	require.Equal(t, lt.Add(-5*time.Hour), budget.SuggestedTimeGTE)
+
+	budget = newQueryBudget(f, 0.1, limits, 5e6)
+	require.True(t, budget.Sampled)
+	require.True(t, budget.SuggestedTimeGTE.IsZero())
+}
@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/go-clickhouse/ch"
+)
+
+// SpanCursor points at the last span of a page. Spans are ordered by time and
+// span id so the next page starts right after the cursor even when new spans
+// are being inserted.
+type SpanCursor struct {
+	Time time.Time
+	ID   uint64
+}
+
+func spanCursorFor(span *Span) *SpanCursor {
+	return &SpanCursor{Time: span.Time, ID: span.ID}
+}
+
+func ParseSpanCursor(s string) (*SpanCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	nanos, id, ok := strings.Cut(string(b), "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid cursor: %q", s)
+	}
+
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	spanID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	return &SpanCursor{
+		Time: time.Unix(0, unixNano),
+		ID:   spanID,
+	}, nil
+}
+
+func (c *SpanCursor) String() string {
+	s := strconv.FormatInt(c.Time.UnixNano(), 10) + "-" + strconv.FormatUint(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// whereClause selects spans that come after the cursor in the sort direction.
+func (c *SpanCursor) whereClause(q *ch.SelectQuery, sortDir string) *ch.SelectQuery {
+	if sortDir == "asc" {
+		return q.Where("(`span.time`, `span.id`) > (?, ?)", c.Time, c.ID)
+	}
+	return q.Where("(`span.time`, `span.id`) < (?, ?)", c.Time, c.ID)
+}
+
+func orderSpansByTime(q *ch.SelectQuery, sortDir string) *ch.SelectQuery {
+	if sortDir == "asc" {
+		return q.OrderExpr("`span.time` ASC, `span.id` ASC")
+	}
+	return q.OrderExpr("`span.time` DESC, `span.id` DESC")
+}
@@ -0,0 +1,20 @@
+package tracing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpanCursor(t *testing.T) {
+	cursor := &SpanCursor{Time: time.Unix(0, 1644500000123456789), ID: 18446744073709551615}
+
+	got, err := ParseSpanCursor(cursor.String())
+	require.NoError(t, err)
+	require.True(t, cursor.Time.Equal(got.Time))
+	require.Equal(t, cursor.ID, got.ID)
+
+	_, err = ParseSpanCursor("not-a-cursor")
+	require.Error(t, err)
+}
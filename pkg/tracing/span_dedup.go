@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// spanDedup remembers the spans received within the span_dedup.window so exports
+// that collectors retry after a timeout don't insert the same spans again. Keys are
+// kept in two generations, so a span is remembered for one to two windows.
+// It is used only by the process loop and is not safe for concurrent use.
+type spanDedup struct {
+	window  time.Duration
+	rotated time.Time
+
+	curr map[uint64]struct{}
+	prev map[uint64]struct{}
+
+	digest *xxhash.Digest
+	buf    [4]byte
+}
+
+func newSpanDedup(window time.Duration) *spanDedup {
+	return &spanDedup{
+		window:  window,
+		rotated: time.Now(),
+		curr:    make(map[uint64]struct{}),
+		digest:  xxhash.New(),
+	}
+}
+
+// seen reports whether the span was received before and remembers it otherwise.
+func (d *spanDedup) seen(span *otlpSpan, now time.Time) bool {
+	if elapsed := now.Sub(d.rotated); elapsed >= 2*d.window {
+		// Both generations are older than the window.
+		d.prev = nil
+		d.curr = make(map[uint64]struct{}, len(d.curr))
+		d.rotated = now
+	} else if elapsed >= d.window {
+		d.prev = d.curr
+		d.curr = make(map[uint64]struct{}, len(d.prev))
+		d.rotated = now
+	}
+
+	binary.LittleEndian.PutUint32(d.buf[:], span.project.ID)
+	d.digest.Reset()
+	_, _ = d.digest.Write(d.buf[:])
+	_, _ = d.digest.Write(span.TraceId)
+	_, _ = d.digest.Write(span.SpanId)
+	key := d.digest.Sum64()
+
+	if _, ok := d.curr[key]; ok {
+		return true
+	}
+	if _, ok := d.prev[key]; ok {
+		return true
+	}
+	d.curr[key] = struct{}{}
+	return false
+}
@@ -0,0 +1,41 @@
+package tracing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func TestSpanDedup(t *testing.T) {
+	dedup := newSpanDedup(10 * time.Second)
+	now := dedup.rotated
+
+	project1 := &bunapp.Project{ID: 1}
+	project2 := &bunapp.Project{ID: 2}
+	newSpan := func(project *bunapp.Project, spanID byte) *otlpSpan {
+		return &otlpSpan{
+			project: project,
+			Span: &tracepb.Span{
+				TraceId: []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+				SpanId:  []byte{1, 2, 3, 4, 5, 6, 7, spanID},
+			},
+		}
+	}
+
+	require.False(t, dedup.seen(newSpan(project1, 1), now))
+	require.True(t, dedup.seen(newSpan(project1, 1), now))
+	require.False(t, dedup.seen(newSpan(project1, 2), now))
+	require.False(t, dedup.seen(newSpan(project2, 1), now))
+
+	// Spans are remembered for at least the window.
+	require.True(t, dedup.seen(newSpan(project1, 1), now.Add(15*time.Second)))
+	require.False(t, dedup.seen(newSpan(project1, 2), now.Add(30*time.Second)))
+
+	// Both generations are dropped after a gap of two windows.
+	later := now.Add(time.Minute)
+	require.False(t, dedup.seen(newSpan(project2, 3), later))
+	require.False(t, dedup.seen(newSpan(project2, 3), later.Add(25*time.Second)))
+}
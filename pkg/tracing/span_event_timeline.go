@@ -0,0 +1,107 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/urlstruct"
+)
+
+type EventTimelineFilter struct {
+	*bunapp.App `urlstruct:"-"`
+
+	TimeFilter
+
+	ProjectID uint32
+	// Group of the spans that record the event.
+	GroupID   uint64
+	EventName string
+}
+
+func DecodeEventTimelineFilter(app *bunapp.App, req bunrouter.Request) (*EventTimelineFilter, error) {
+	f := &EventTimelineFilter{App: app}
+	if err := bunapp.UnmarshalValues(req, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+var _ urlstruct.ValuesUnmarshaler = (*EventTimelineFilter)(nil)
+
+func (f *EventTimelineFilter) UnmarshalValues(ctx context.Context, values url.Values) error {
+	if err := f.TimeFilter.UnmarshalValues(ctx, values); err != nil {
+		return err
+	}
+	if f.EventName == "" {
+		return errors.New("'event_name' query param is required")
+	}
+	return nil
+}
+
+// whereClause selects the events using the parent span ids of the group spans so
+// the events are counted without reading the traces.
+func (f *EventTimelineFilter) whereClause(q *ch.SelectQuery) *ch.SelectQuery {
+	groupSpans := f.CH().NewSelect().
+		Model((*SpanIndex)(nil)).
+		ColumnExpr("`span.id`").
+		Where("project_id = ?", f.ProjectID).
+		Where("`span.time` >= ?", f.TimeGTE).
+		Where("`span.time` < ?", f.TimeLT).
+		Where("`span.group_id` = ?", f.GroupID).
+		Where("`span.event_name` = ''")
+
+	return q.Where("project_id = ?", f.ProjectID).
+		Where("`span.time` >= ?", f.TimeGTE).
+		Where("`span.time` < ?", f.TimeLT).
+		Where("`span.event_name` = ?", f.EventName).
+		Where("`span.parent_id` IN (?)", groupSpans)
+}
+
+// EventTimeline returns how often the event occurs in the spans of the group, for
+// example, cache misses or retries.
+func (h *SpanHandler) EventTimeline(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	f, err := DecodeEventTimelineFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+
+	groupPeriod := calcGroupPeriod(&f.TimeFilter, 300)
+	minutes := groupPeriod.Minutes()
+
+	m := make(map[string]interface{})
+
+	subq := h.CH().NewSelect().
+		Model((*SpanIndex)(nil)).
+		ColumnExpr("count() AS count").
+		ColumnExpr("count() / ? AS rate", minutes).
+		ColumnExpr("uniq(`span.parent_id`) AS spanCount").
+		ColumnExpr("toStartOfInterval(`span.time`, INTERVAL ? minute) AS time", minutes).
+		Apply(f.whereClause).
+		GroupExpr("time").
+		OrderExpr("time ASC").
+		Limit(10000)
+
+	if err := h.CH().NewSelect().
+		ColumnExpr("groupArray(s.count) AS count").
+		ColumnExpr("groupArray(s.rate) AS rate").
+		ColumnExpr("groupArray(s.spanCount) AS spanCount").
+		ColumnExpr("groupArray(s.time) AS time").
+		TableExpr("(?) AS s", subq).
+		GroupExpr("tuple()").
+		Limit(1000).
+		Scan(ctx, &m); err != nil {
+		return err
+	}
+
+	fillHoles(m, f.TimeGTE, f.TimeLT, groupPeriod)
+
+	return httputil.JSON(w, m)
+}
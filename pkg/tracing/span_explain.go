@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/org"
+)
+
+// checkExplainAllowed allows only admins to explain queries, because the generated
+// SQL shows attributes that attribute policies may hide.
+func checkExplainAllowed(ctx context.Context) error {
+	user, err := org.UserFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !user.Admin {
+		return httperror.Forbidden("explain=true requires an admin user")
+	}
+	return nil
+}
+
+// explainQuery responds with the SQL of the query and the ClickHouse plan that shows
+// which indexes and how many granules are used.
+func explainQuery(
+	ctx context.Context, w http.ResponseWriter, app *bunapp.App, q *ch.SelectQuery,
+) error {
+	rows, err := app.CH().QueryContext(ctx, "EXPLAIN indexes = 1 ?", q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	plan := make([]string, 0)
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return err
+		}
+		plan = append(plan, line)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"query": q.String(),
+		"plan":  plan,
+	})
+}
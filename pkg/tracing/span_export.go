@@ -0,0 +1,183 @@
+package tracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	"go.uber.org/zap"
+)
+
+const (
+	exportBatchSize    = 10000
+	exportDefaultLimit = 100000
+	exportMaxLimit     = 1000000
+)
+
+// ExportSpans streams spans that match the filter as newline-delimited JSON.
+// Spans are selected in batches using keyset pagination so the memory usage
+// does not depend on the number of exported spans.
+func (h *SpanHandler) ExportSpans(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	f, err := DecodeSpanFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+	disableColumnsAndGroups(f.parts)
+	if !f.sortedByTime() {
+		return httperror.BadRequest("sort_by", "spans can only be exported sorted by span.time")
+	}
+
+	limit, err := parseExportLimit(req.URL.Query().Get("limit"))
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="spans.ndjson"`)
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+
+	cursor := f.cursor
+	for limit > 0 {
+		spans := make([]*SpanIndex, 0)
+
+		q := f.CH().NewSelect().
+			Model(&spans).
+			Apply(f.whereClause)
+		q, _ = compileUQL(q, f.parts, f.uqlContext(f.Duration().Minutes()))
+		if cursor != nil {
+			q = cursor.whereClause(q, f.SortDir)
+		}
+		q = orderSpansByTime(q, f.SortDir).
+			Limit(minInt(limit, exportBatchSize))
+
+		if err := q.Scan(ctx); err != nil {
+			// The response is already started so we can only report the error in the stream.
+			h.Zap(ctx).Error("span export failed", zap.Error(err))
+			_ = enc.Encode(map[string]string{"error": err.Error()})
+			return nil
+		}
+
+		for _, index := range spans {
+			span := exportedSpan(index)
+			applyAttrPolicy(f.attrPolicy, span.Attrs)
+			if err := enc.Encode(span); err != nil {
+				// The client has gone away.
+				return nil
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		if len(spans) < exportBatchSize {
+			break
+		}
+		limit -= len(spans)
+		cursor = spanCursorFor(spans[len(spans)-1].Span)
+	}
+
+	return nil
+}
+
+func parseExportLimit(s string) (int, error) {
+	if s == "" {
+		return exportDefaultLimit, nil
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit <= 0 {
+		return 0, httperror.BadRequest("limit", "limit must be a positive number")
+	}
+	if limit > exportMaxLimit {
+		limit = exportMaxLimit
+	}
+	return limit, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+type ExportedSpan struct {
+	ProjectID uint32 `json:"projectId"`
+	System    string `json:"system"`
+	GroupID   uint64 `json:"groupId,string"`
+
+	TraceID  string `json:"traceId"`
+	ID       uint64 `json:"id,string"`
+	ParentID uint64 `json:"parentId,string,omitempty"`
+
+	Name      string `json:"name"`
+	EventName string `json:"eventName,omitempty"`
+	Kind      string `json:"kind"`
+
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration"`
+
+	StatusCode    string `json:"statusCode"`
+	StatusMessage string `json:"statusMessage"`
+
+	Attrs AttrMap `json:"attrs"`
+}
+
+func exportedSpan(index *SpanIndex) *ExportedSpan {
+	span := index.Span
+
+	attrs := make(AttrMap, len(index.AttrKeys)+10)
+	for i, key := range index.AttrKeys {
+		if i < len(index.AttrValues) {
+			attrs[key] = index.AttrValues[i]
+		}
+	}
+	for key, value := range map[string]string{
+		xattr.ServiceName:        index.ServiceName,
+		xattr.HostName:           index.HostName,
+		xattr.OtelLibraryName:    index.OtelLibraryName,
+		xattr.OtelLibraryVersion: index.OtelLibraryVersion,
+		xattr.DBSystem:           index.DBSystem,
+		xattr.DBStatement:        index.DBStatement,
+		xattr.DBOperation:        index.DBOperation,
+		xattr.DBSqlTable:         index.DBSqlTable,
+		xattr.LogSeverity:        index.LogSeverity,
+		xattr.LogMessage:         index.LogMessage,
+		xattr.ExceptionType:      index.ExceptionType,
+		xattr.ExceptionMessage:   index.ExceptionMessage,
+	} {
+		if value != "" {
+			attrs[key] = value
+		}
+	}
+
+	return &ExportedSpan{
+		ProjectID: span.ProjectID,
+		System:    span.System,
+		GroupID:   span.GroupID,
+
+		TraceID:  span.TraceID.String(),
+		ID:       span.ID,
+		ParentID: span.ParentID,
+
+		Name:      span.Name,
+		EventName: span.EventName,
+		Kind:      span.Kind,
+
+		Time:     span.Time,
+		Duration: span.Duration,
+
+		StatusCode:    span.StatusCode,
+		StatusMessage: span.StatusMessage,
+
+		Attrs: attrs,
+	}
+}
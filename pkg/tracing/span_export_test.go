@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/httperror"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+)
+
+func TestParseExportLimit(t *testing.T) {
+	limit, err := parseExportLimit("")
+	require.NoError(t, err)
+	require.Equal(t, exportDefaultLimit, limit)
+
+	limit, err = parseExportLimit("500")
+	require.NoError(t, err)
+	require.Equal(t, 500, limit)
+
+	limit, err = parseExportLimit("100000000")
+	require.NoError(t, err)
+	require.Equal(t, exportMaxLimit, limit)
+
+	for _, s := range []string{"0", "-1", "ten"} {
+		_, err := parseExportLimit(s)
+		require.Equal(t, http.StatusBadRequest, httperror.From(err).Status, s)
+	}
+}
+
+func TestExportedSpan(t *testing.T) {
+	traceID := uuid.New()
+	span := &Span{
+		ProjectID:  1,
+		System:     "db:postgresql",
+		GroupID:    123,
+		TraceID:    traceID,
+		ID:         2,
+		ParentID:   1,
+		Name:       "SELECT users",
+		Kind:       "client",
+		Time:       time.Unix(1600000000, 0).UTC(),
+		Duration:   time.Millisecond,
+		StatusCode: "ok",
+	}
+	index := &SpanIndex{
+		Span:        span,
+		AttrKeys:    []string{"db.name", "net.peer.port"},
+		AttrValues:  []string{"app"},
+		ServiceName: "api",
+		DBSystem:    "postgresql",
+		DBStatement: "SELECT * FROM users",
+	}
+
+	require.Equal(t, &ExportedSpan{
+		ProjectID: 1,
+		System:    "db:postgresql",
+		GroupID:   123,
+
+		TraceID:  traceID.String(),
+		ID:       2,
+		ParentID: 1,
+
+		Name: "SELECT users",
+		Kind: "client",
+
+		Time:     span.Time,
+		Duration: time.Millisecond,
+
+		StatusCode: "ok",
+
+		// Keys without values are skipped and empty indexed columns are omitted.
+		Attrs: AttrMap{
+			"db.name":         "app",
+			xattr.ServiceName: "api",
+			xattr.DBSystem:    "postgresql",
+			xattr.DBStatement: "SELECT * FROM users",
+		},
+	}, exportedSpan(index))
+}
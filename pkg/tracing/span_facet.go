@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	"github.com/uptrace/uptrace/pkg/uql"
+	"go4.org/syncutil"
+)
+
+type FacetValue struct {
+	Value string  `json:"value"`
+	Count float64 `json:"count"`
+}
+
+// selectFacet counts spans by the column values. The facet's own filter is ignored
+// so the counts show how many spans each value would select.
+func selectFacet(ctx context.Context, f *SpanFilter, column string) ([]FacetValue, error) {
+	facetFilter := *f
+	switch column {
+	case xattr.SpanKind:
+		facetFilter.Kind = nil
+	case xattr.SpanStatusCode:
+		facetFilter.StatusCode = nil
+	}
+
+	minutes := f.Duration().Minutes()
+	count := appendUQLColumn(nil, uql.Name{AttrKey: xattr.SpanCount}, f.uqlContext(minutes))
+	values := make([]FacetValue, 0)
+
+	if err := buildSpanIndexQuery(&facetFilter, minutes).
+		ColumnExpr("? AS value", ch.Ident(column)).
+		ColumnExpr("? AS count", ch.Safe(count)).
+		GroupExpr("value").
+		OrderExpr("count DESC").
+		Scan(ctx, &values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func (h *SpanHandler) Facets(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	f, err := DecodeSpanFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+	disableColumnsAndGroups(f.parts)
+
+	var kinds, statusCodes, libraries []FacetValue
+	var group syncutil.Group
+
+	group.Go(func() (err error) {
+		kinds, err = selectFacet(ctx, f, xattr.SpanKind)
+		return err
+	})
+	group.Go(func() (err error) {
+		statusCodes, err = selectFacet(ctx, f, xattr.SpanStatusCode)
+		return err
+	})
+	group.Go(func() (err error) {
+		libraries, err = selectFacet(ctx, f, xattr.OtelLibraryName)
+		return err
+	})
+
+	if err := group.Err(); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"kinds":       kinds,
+		"statusCodes": statusCodes,
+		"libraries":   libraries,
+	})
+}
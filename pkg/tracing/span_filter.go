@@ -70,15 +70,27 @@ type SpanFilter struct {
 	urlstruct.Pager
 	TimeFilter
 
-	ProjectID uint32
-	System    string
-	GroupID   uint64
+	ProjectID  uint32
+	System     string
+	GroupID    uint64
+	Kind       []string
+	StatusCode []string
 
 	Query  string
 	Column string
+	Cursor string
+	// Fraction of spans to read, for example, 0.01 reads 1% of spans.
+	Sample float64
+	// Overrides the configured accuracy of uniq and percentiles: approx or exact.
+	Accuracy string
+	// Explain returns the generated SQL and the ClickHouse query plan instead of
+	// results. Only admins can use it.
+	Explain bool
 
-	parts     []*uql.Part
-	columnMap map[string]bool
+	cursor     *SpanCursor
+	parts      []*uql.Part
+	attrPolicy *bunapp.AttrPolicy
+	columnMap  map[string]bool
 }
 
 func DecodeSpanFilter(app *bunapp.App, req bunrouter.Request) (*SpanFilter, error) {
@@ -86,6 +98,13 @@ func DecodeSpanFilter(app *bunapp.App, req bunrouter.Request) (*SpanFilter, erro
 	if err := bunapp.UnmarshalValues(req, f); err != nil {
 		return nil, err
 	}
+	if f.Explain {
+		if err := checkExplainAllowed(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	f.attrPolicy = attrPolicyFromContext(req.Context(), app)
+	restrictUQL(f.parts, f.attrPolicy)
 	return f, nil
 }
 
@@ -102,11 +121,50 @@ func (f *SpanFilter) UnmarshalValues(ctx context.Context, values url.Values) err
 		return errors.New("'system' query param is required")
 	}
 
+	if f.Sample < 0 || f.Sample > 1 {
+		return errors.New("'sample' must be between 0 and 1")
+	}
+	if f.Sample == 1 {
+		f.Sample = 0
+	}
+
+	for _, kind := range f.Kind {
+		if _, ok := spanKindSet[kind]; !ok {
+			return fmt.Errorf("unsupported span kind: %q", kind)
+		}
+	}
+	for _, code := range f.StatusCode {
+		if _, ok := statusCodeSet[code]; !ok {
+			return fmt.Errorf("unsupported status code: %q", code)
+		}
+	}
+
+	switch f.Accuracy {
+	case "", bunapp.AccuracyApprox, bunapp.AccuracyExact:
+	default:
+		return fmt.Errorf("'accuracy' must be %q or %q", bunapp.AccuracyApprox, bunapp.AccuracyExact)
+	}
+
+	if f.Cursor != "" {
+		if !f.sortedByTime() {
+			return errors.New("'cursor' requires sorting by span.time")
+		}
+		cursor, err := ParseSpanCursor(f.Cursor)
+		if err != nil {
+			return err
+		}
+		f.cursor = cursor
+	}
+
 	f.parts = uql.Parse(f.Query)
 
 	return nil
 }
 
+func (f *SpanFilter) sortedByTime() bool {
+	return f.SortBy == "" || f.SortBy == xattr.SpanTime
+}
+
 func (f *SpanFilter) whereClause(q *ch.SelectQuery) *ch.SelectQuery {
 	q = q.Where("project_id = ?", f.ProjectID).
 		Where("`span.time` >= ?", f.TimeGTE).
@@ -125,6 +183,12 @@ func (f *SpanFilter) whereClause(q *ch.SelectQuery) *ch.SelectQuery {
 	if f.GroupID != 0 {
 		q = q.Where("`span.group_id` = ?", f.GroupID)
 	}
+	if len(f.Kind) > 0 {
+		q = q.Where("`span.kind` IN (?)", ch.In(f.Kind))
+	}
+	if len(f.StatusCode) > 0 {
+		q = q.Where("`span.status_code` IN (?)", ch.In(f.StatusCode))
+	}
 
 	return q
 }
@@ -185,7 +249,10 @@ func buildSpanIndexQuery(f *SpanFilter, minutes float64) *ch.SelectQuery {
 	q := f.CH().NewSelect().
 		Model((*SpanIndex)(nil)).
 		Setting("read_overflow_mode = 'break'")
-	if limits.SampleRows != 0 {
+	switch {
+	case f.Sample != 0:
+		q = q.Sample("?", f.Sample)
+	case limits.SampleRows != 0:
 		q = q.Sample("?", limits.SampleRows)
 	}
 	if limits.MaxRowsToRead != 0 {
@@ -195,12 +262,54 @@ func buildSpanIndexQuery(f *SpanFilter, minutes float64) *ch.SelectQuery {
 		q = q.Setting("max_bytes_to_read = ?", limits.MaxBytesToRead)
 	}
 	q = f.whereClause(q)
-	q, f.columnMap = compileUQL(q, f.parts, minutes)
+	q, f.columnMap = compileUQL(q, f.parts, f.uqlContext(minutes))
 	return q
 }
 
+// uqlContext holds request params that affect how UQL columns are compiled.
+type uqlContext struct {
+	minutes float64
+	// Fraction of spans read using the SAMPLE clause or 0.
+	sample float64
+
+	exactDistinct  bool
+	exactQuantiles bool
+}
+
+func (f *SpanFilter) uqlContext(minutes float64) uqlContext {
+	conf := f.Config().CHQueryAccuracy
+	return uqlContext{
+		minutes:        minutes,
+		sample:         f.Sample,
+		exactDistinct:  f.accuracy(conf.Distinct) == bunapp.AccuracyExact,
+		exactQuantiles: f.accuracy(conf.Quantiles) == bunapp.AccuracyExact,
+	}
+}
+
+func (f *SpanFilter) quantilesFunc() string {
+	if f.uqlContext(0).exactQuantiles {
+		return "quantilesExact"
+	}
+	return "quantilesTDigest"
+}
+
+func (f *SpanFilter) accuracy(defaultAccuracy string) string {
+	if f.Accuracy != "" {
+		return f.Accuracy
+	}
+	return defaultAccuracy
+}
+
+// appendScale extrapolates counts when only a sample of spans is read.
+func (uc uqlContext) appendScale(b []byte) []byte {
+	if uc.sample == 0 {
+		return b
+	}
+	return chschema.AppendQuery(b, " / ?", uc.sample)
+}
+
 func compileUQL(
-	q *ch.SelectQuery, parts []*uql.Part, minutes float64,
+	q *ch.SelectQuery, parts []*uql.Part, uc uqlContext,
 ) (*ch.SelectQuery, map[string]bool) {
 	groupSet := make(map[string]bool)
 	columnSet := make(map[string]bool)
@@ -213,7 +322,7 @@ func compileUQL(
 		switch ast := part.AST.(type) {
 		case *uql.Group:
 			for _, name := range ast.Names {
-				q = uqlColumn(q, name, minutes)
+				q = uqlColumn(q, name, uc)
 				columnSet[name.String()] = true
 
 				q = q.Group(name.String())
@@ -239,11 +348,11 @@ func compileUQL(
 					continue
 				}
 
-				q = uqlColumn(q, name, minutes)
+				q = uqlColumn(q, name, uc)
 				columnSet[name.String()] = true
 			}
 		case *uql.Where:
-			q = uqlWhere(q, ast, minutes)
+			q = uqlWhere(q, ast, uc)
 		}
 	}
 
@@ -251,7 +360,7 @@ func compileUQL(
 		for _, key := range []string{xattr.SpanSystem, xattr.SpanName, xattr.SpanEventName} {
 			name := uql.Name{FuncName: "any", AttrKey: key}
 			if !columnSet[name.String()] {
-				q = uqlColumn(q, name, minutes)
+				q = uqlColumn(q, name, uc)
 				columnSet[name.String()] = true
 			}
 		}
@@ -265,16 +374,17 @@ func isAggColumn(col uql.Name) bool {
 		return true
 	}
 	switch col.AttrKey {
-	case xattr.SpanCount, xattr.SpanCountPerMin, xattr.SpanErrorCount, xattr.SpanErrorPct:
+	case xattr.SpanCount, xattr.SpanCountPerMin, xattr.SpanErrorCount, xattr.SpanErrorPct,
+		xattr.SpanApdex:
 		return true
 	default:
 		return false
 	}
 }
 
-func uqlColumn(q *ch.SelectQuery, name uql.Name, minutes float64) *ch.SelectQuery {
+func uqlColumn(q *ch.SelectQuery, name uql.Name, uc uqlContext) *ch.SelectQuery {
 	var b []byte
-	b = appendUQLColumn(b, name, minutes)
+	b = appendUQLColumn(b, name, uc)
 	b = append(b, " AS "...)
 	b = append(b, '"')
 	b = name.Append(b)
@@ -282,11 +392,21 @@ func uqlColumn(q *ch.SelectQuery, name uql.Name, minutes float64) *ch.SelectQuer
 	return q.ColumnExpr(string(b))
 }
 
-func appendUQLColumn(b []byte, name uql.Name, minutes float64) []byte {
+func appendUQLColumn(b []byte, name uql.Name, uc uqlContext) []byte {
 	switch name.FuncName {
-	case "p50", "p75", "p90", "p99":
-		return chschema.AppendQuery(b, "quantileTDigest(?)(toFloat64OrDefault(?))",
-			quantileLevel(name.FuncName), chColumn(name.AttrKey))
+	case "p50", "p75", "p90", "p95", "p99":
+		fn := "quantileTDigest"
+		if uc.exactQuantiles {
+			fn = "quantileExact"
+		}
+		return chschema.AppendQuery(b, "?(?)(toFloat64OrDefault(?))",
+			ch.Safe(fn), quantileLevel(name.FuncName), chColumn(name.AttrKey))
+	case "uniq":
+		fn := "uniqCombined"
+		if uc.exactDistinct {
+			fn = "uniqExact"
+		}
+		return chschema.AppendQuery(b, "?(?)", ch.Safe(fn), chColumn(name.AttrKey))
 	case "top3":
 		return chschema.AppendQuery(b, "topK(3)(?)", chColumn(name.AttrKey))
 	case "top10":
@@ -295,14 +415,22 @@ func appendUQLColumn(b []byte, name uql.Name, minutes float64) []byte {
 
 	switch name.String() {
 	case xattr.SpanCount:
-		return chschema.AppendQuery(b, "sum(`span.count`)")
+		b = chschema.AppendQuery(b, "sum(`span.count`)")
+		return uc.appendScale(b)
 	case xattr.SpanCountPerMin:
-		return chschema.AppendQuery(b, "sum(`span.count`) / ?", minutes)
+		b = chschema.AppendQuery(b, "sum(`span.count`)")
+		b = uc.appendScale(b)
+		return chschema.AppendQuery(b, " / ?", uc.minutes)
 	case xattr.SpanErrorCount:
-		return chschema.AppendQuery(b, "sumIf(`span.count`, `span.status_code` = 'error')", minutes)
+		b = chschema.AppendQuery(b, "sumIf(`span.count`, `span.status_code` = 'error')")
+		return uc.appendScale(b)
 	case xattr.SpanErrorPct:
 		return chschema.AppendQuery(
-			b, "sumIf(`span.count`, `span.status_code` = 'error') / sum(`span.count`)", minutes)
+			b, "sumIf(`span.count`, `span.status_code` = 'error') / sum(`span.count`)")
+	case xattr.SpanApdex:
+		return chschema.AppendQuery(b, "(sumIf(`span.count`, `span.apdex_level` = ?) + "+
+			"sumIf(`span.count`, `span.apdex_level` = ?) / 2) / sumIf(`span.count`, `span.apdex_level` != '')",
+			apdexSatisfied, apdexTolerating)
 	default:
 		if name.FuncName != "" {
 			b = append(b, name.FuncName...)
@@ -328,7 +456,8 @@ func appendCHColumn(b []byte, key string) []byte {
 	case xattr.SpanSystem, xattr.SpanGroupID, xattr.SpanTraceID,
 		xattr.SpanName, xattr.SpanEventName, xattr.SpanKind, xattr.SpanDuration,
 		xattr.SpanStatusCode, xattr.SpanStatusMessage,
-		xattr.SpanLinkCount, xattr.SpanEventCount, xattr.SpanEventErrorCount, xattr.SpanEventLogCount:
+		xattr.SpanLinkCount, xattr.SpanEventCount, xattr.SpanEventErrorCount, xattr.SpanEventLogCount,
+		xattr.SpanApdexLevel, xattr.ServiceKey:
 		return chschema.AppendIdent(b, key)
 	default:
 		if _, ok := indexedAttrSet[key]; ok {
@@ -338,12 +467,12 @@ func appendCHColumn(b []byte, key string) []byte {
 	}
 }
 
-func uqlWhere(q *ch.SelectQuery, ast *uql.Where, minutes float64) *ch.SelectQuery {
+func uqlWhere(q *ch.SelectQuery, ast *uql.Where, uc uqlContext) *ch.SelectQuery {
 	var where []byte
 	var having []byte
 
 	for _, cond := range ast.Conds {
-		bb, isAgg := uqlWhereCond(cond, minutes)
+		bb, isAgg := uqlWhereCond(cond, uc)
 		if bb == nil {
 			continue
 		}
@@ -365,7 +494,7 @@ func uqlWhere(q *ch.SelectQuery, ast *uql.Where, minutes float64) *ch.SelectQuer
 	return q
 }
 
-func uqlWhereCond(cond uql.Cond, minutes float64) (b []byte, isAgg bool) {
+func uqlWhereCond(cond uql.Cond, uc uqlContext) (b []byte, isAgg bool) {
 	isAgg = isAggColumn(cond.Left)
 
 	switch cond.Op {
@@ -387,7 +516,7 @@ func uqlWhereCond(cond uql.Cond, minutes float64) (b []byte, isAgg bool) {
 
 		values := strings.Split(cond.Right.Text, "|")
 		b = append(b, "multiSearchAnyCaseInsensitiveUTF8("...)
-		b = appendUQLColumn(b, cond.Left, minutes)
+		b = appendUQLColumn(b, cond.Left, uc)
 		b = append(b, ", "...)
 		b = chschema.AppendQuery(b, "[?]", ch.In(values))
 		b = append(b, ")"...)
@@ -398,7 +527,7 @@ func uqlWhereCond(cond uql.Cond, minutes float64) (b []byte, isAgg bool) {
 	if cond.Right.Kind == uql.NumberValue {
 		b = append(b, "toFloat64OrDefault("...)
 	}
-	b = appendUQLColumn(b, cond.Left, minutes)
+	b = appendUQLColumn(b, cond.Left, uc)
 	if cond.Right.Kind == uql.NumberValue {
 		b = append(b, ")"...)
 	}
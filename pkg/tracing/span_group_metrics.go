@@ -0,0 +1,149 @@
+package tracing
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+// SpanGroupSLI is the rate, errors, latency, and Apdex of a span group
+// during one minute.
+type SpanGroupSLI struct {
+	System  string
+	Service string
+	GroupID uint64
+	Name    string
+
+	Count      float64
+	ErrorCount float64
+	P99        float64
+	Apdex      float64
+}
+
+func selectSpanGroupSLIs(
+	ctx context.Context, app *bunapp.App, projectID uint32, minute time.Time,
+) ([]SpanGroupSLI, error) {
+	slis := make([]SpanGroupSLI, 0)
+
+	if err := app.CH().NewSelect().
+		ColumnExpr("system, service, group_id").
+		ColumnExpr("any(name) AS name").
+		ColumnExpr("toFloat64(sum(count)) AS count").
+		ColumnExpr("toFloat64(sum(error_count)) AS error_count").
+		ColumnExpr("toFloat64(quantilesTDigestWeightedMerge(0.5, 0.9, 0.99)(tdigest)[3]) AS p99").
+		ColumnExpr("(sum(satisfied_count) + sum(tolerating_count) / 2) / "+
+			"(sum(satisfied_count) + sum(tolerating_count) + sum(frustrated_count)) AS apdex").
+		TableExpr("span_group_minutes").
+		Where("project_id = ?", projectID).
+		Where("time = ?", minute).
+		Where("system != ?", internalSpanType).
+		GroupExpr("system, service, group_id").
+		Limit(100000).
+		Scan(ctx, &slis); err != nil {
+		return nil, err
+	}
+
+	return slis, nil
+}
+
+//------------------------------------------------------------------------------
+
+type SpanGroupMetricsHandler struct {
+	*bunapp.App
+}
+
+func NewSpanGroupMetricsHandler(app *bunapp.App) *SpanGroupMetricsHandler {
+	return &SpanGroupMetricsHandler{
+		App: app,
+	}
+}
+
+// Prometheus exposes span group SLIs for the last complete minute using the Prometheus
+// text format so they can be scraped, queried with PromQL, and alerted on together
+// with other metrics.
+func (h *SpanGroupMetricsHandler) Prometheus(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	projectID, err := req.Params().Uint32("project_id")
+	if err != nil {
+		return err
+	}
+
+	minute := time.Now().Truncate(time.Minute).Add(-time.Minute)
+	slis, err := selectSpanGroupSLIs(ctx, h.App, projectID, minute)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, err = w.Write(appendPrometheusSLIs(nil, slis))
+	return err
+}
+
+var prometheusSLIs = []struct {
+	name  string
+	help  string
+	value func(sli *SpanGroupSLI) float64
+}{
+	{
+		name:  "uptrace_span_group_rate",
+		help:  "Number of spans per minute.",
+		value: func(sli *SpanGroupSLI) float64 { return sli.Count },
+	},
+	{
+		name:  "uptrace_span_group_error_rate",
+		help:  "Number of failed spans per minute.",
+		value: func(sli *SpanGroupSLI) float64 { return sli.ErrorCount },
+	},
+	{
+		name:  "uptrace_span_group_duration_p99_seconds",
+		help:  "99th percentile of span durations.",
+		value: func(sli *SpanGroupSLI) float64 { return sli.P99 / float64(time.Second) },
+	},
+	{
+		name:  "uptrace_span_group_apdex",
+		help:  "Apdex score of spans.",
+		value: func(sli *SpanGroupSLI) float64 { return sli.Apdex },
+	},
+}
+
+func appendPrometheusSLIs(b []byte, slis []SpanGroupSLI) []byte {
+	for _, metric := range prometheusSLIs {
+		b = append(b, "# HELP "+metric.name+" "+metric.help+"\n"...)
+		b = append(b, "# TYPE "+metric.name+" gauge\n"...)
+
+		for i := range slis {
+			sli := &slis[i]
+			value := metric.value(sli)
+			if math.IsNaN(value) {
+				continue
+			}
+
+			b = append(b, metric.name...)
+			b = append(b, `{system="`...)
+			b = appendPrometheusLabel(b, sli.System)
+			b = append(b, `",service="`...)
+			b = appendPrometheusLabel(b, sli.Service)
+			b = append(b, `",group_id="`...)
+			b = strconv.AppendUint(b, sli.GroupID, 10)
+			b = append(b, `",name="`...)
+			b = appendPrometheusLabel(b, sli.Name)
+			b = append(b, `"} `...)
+			b = strconv.AppendFloat(b, value, 'g', -1, 64)
+			b = append(b, '\n')
+		}
+	}
+	return b
+}
+
+var prometheusLabelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func appendPrometheusLabel(b []byte, s string) []byte {
+	return append(b, prometheusLabelReplacer.Replace(s)...)
+}
@@ -0,0 +1,34 @@
+package tracing
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendPrometheusSLIs(t *testing.T) {
+	slis := []SpanGroupSLI{{
+		System:     "http:api",
+		Service:    "api",
+		GroupID:    123,
+		Name:       `GET "/users"`,
+		Count:      60,
+		ErrorCount: 3,
+		P99:        250e6,
+		Apdex:      math.NaN(),
+	}}
+
+	require.Equal(t, `# HELP uptrace_span_group_rate Number of spans per minute.
+# TYPE uptrace_span_group_rate gauge
+uptrace_span_group_rate{system="http:api",service="api",group_id="123",name="GET \"/users\""} 60
+# HELP uptrace_span_group_error_rate Number of failed spans per minute.
+# TYPE uptrace_span_group_error_rate gauge
+uptrace_span_group_error_rate{system="http:api",service="api",group_id="123",name="GET \"/users\""} 3
+# HELP uptrace_span_group_duration_p99_seconds 99th percentile of span durations.
+# TYPE uptrace_span_group_duration_p99_seconds gauge
+uptrace_span_group_duration_p99_seconds{system="http:api",service="api",group_id="123",name="GET \"/users\""} 0.25
+# HELP uptrace_span_group_apdex Apdex score of spans.
+# TYPE uptrace_span_group_apdex gauge
+`, string(appendPrometheusSLIs(nil, slis)))
+}
@@ -0,0 +1,179 @@
+package tracing
+
+import (
+	"strings"
+	"time"
+
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/go-clickhouse/ch/chschema"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	"github.com/uptrace/uptrace/pkg/uql"
+)
+
+// Columns of span_group_minutes and span_group_hours tables that store span.* attributes.
+var spanGroupColumns = map[string]string{
+	xattr.SpanSystem:    "system",
+	xattr.ServiceKey:    "service",
+	xattr.SpanGroupID:   "group_id",
+	xattr.SpanName:      "name",
+	xattr.SpanEventName: "event_name",
+}
+
+// buildSpanGroupQuery builds the query using pre-aggregated span_group_* tables that are
+// much faster than spans_index. It returns false if the UQL query uses something that
+// is not pre-aggregated, for example, a where condition, a span kind filter,
+// or an arbitrary attribute, or if the request sets the sample or accuracy params
+// that only apply to spans_index.
+func buildSpanGroupQuery(f *SpanFilter, minutes float64) (*ch.SelectQuery, bool) {
+	if len(f.Kind) > 0 || len(f.StatusCode) > 0 {
+		return nil, false
+	}
+	if f.Sample != 0 || f.Accuracy != "" {
+		return nil, false
+	}
+
+	var groups, columns []uql.Name
+
+	for _, part := range f.parts {
+		if part.Disabled || part.Error != "" {
+			continue
+		}
+
+		switch ast := part.AST.(type) {
+		case *uql.Group:
+			groups = append(groups, ast.Names...)
+		case *uql.Columns:
+			columns = append(columns, ast.Names...)
+		default:
+			return nil, false
+		}
+	}
+
+	groupSet := make(map[string]bool)
+	for _, name := range groups {
+		if name.FuncName != "" || !isSpanGroupKey(name.AttrKey) {
+			return nil, false
+		}
+		groupSet[name.String()] = true
+	}
+	if !groupSet[xattr.SpanGroupID] {
+		return nil, false
+	}
+
+	q := f.CH().NewSelect().
+		TableExpr(spanGroupTable(tablePeriod(&f.TimeFilter))).
+		Apply(f.spanGroupWhere)
+
+	columnSet := make(map[string]bool)
+	for _, name := range groups {
+		if columnSet[name.String()] {
+			continue
+		}
+		col := spanGroupColumns[name.AttrKey]
+		q = q.ColumnExpr("? AS ?", ch.Ident(col), ch.Ident(name.String())).
+			GroupExpr(col)
+		columnSet[name.String()] = true
+	}
+
+	for _, name := range columns {
+		if columnSet[name.String()] || groupSet[name.String()] {
+			continue
+		}
+		expr, ok := appendSpanGroupColumn(nil, name, f.uqlContext(minutes))
+		if !ok {
+			return nil, false
+		}
+		q = q.ColumnExpr("? AS ?", ch.Safe(expr), ch.Ident(name.String()))
+		columnSet[name.String()] = true
+	}
+
+	for _, key := range []string{xattr.SpanSystem, xattr.SpanName, xattr.SpanEventName} {
+		name := uql.Name{FuncName: "any", AttrKey: key}
+		if !columnSet[name.String()] {
+			q = q.ColumnExpr("any(?) AS ?", ch.Ident(spanGroupColumns[key]), ch.Ident(name.String()))
+			columnSet[name.String()] = true
+		}
+	}
+
+	f.columnMap = columnSet
+	return q, true
+}
+
+func isSpanGroupKey(key string) bool {
+	switch key {
+	case xattr.SpanGroupID, xattr.SpanSystem, xattr.ServiceKey:
+		return true
+	default:
+		return false
+	}
+}
+
+func appendSpanGroupColumn(b []byte, name uql.Name, uc uqlContext) ([]byte, bool) {
+	switch name.FuncName {
+	case "":
+	case "p50", "p90", "p99":
+		// T-Digest states can't produce exact quantiles.
+		if name.AttrKey != xattr.SpanDuration || uc.exactQuantiles {
+			return nil, false
+		}
+		idx := map[string]int{"p50": 1, "p90": 2, "p99": 3}[name.FuncName]
+		return chschema.AppendQuery(b,
+			"quantilesTDigestWeightedMerge(0.5, 0.9, 0.99)(tdigest)[?]", idx), true
+	case "any":
+		col, ok := spanGroupColumns[name.AttrKey]
+		if !ok {
+			return nil, false
+		}
+		return chschema.AppendQuery(b, "any(?)", ch.Ident(col)), true
+	default:
+		return nil, false
+	}
+
+	switch name.AttrKey {
+	case xattr.SpanCount:
+		return chschema.AppendQuery(b, "sum(count)"), true
+	case xattr.SpanCountPerMin:
+		return chschema.AppendQuery(b, "sum(count) / ?", uc.minutes), true
+	case xattr.SpanErrorCount:
+		return chschema.AppendQuery(b, "sum(error_count)"), true
+	case xattr.SpanErrorPct:
+		return chschema.AppendQuery(b, "sum(error_count) / sum(count)"), true
+	case xattr.SpanApdex:
+		return chschema.AppendQuery(b, "(sum(satisfied_count) + sum(tolerating_count) / 2) / "+
+			"(sum(satisfied_count) + sum(tolerating_count) + sum(frustrated_count))"), true
+	default:
+		return nil, false
+	}
+}
+
+func (f *SpanFilter) spanGroupWhere(q *ch.SelectQuery) *ch.SelectQuery {
+	q = q.Where("project_id = ?", f.ProjectID).
+		Where("time >= ?", f.TimeGTE).
+		Where("time < ?", f.TimeLT)
+
+	switch {
+	case f.System == allSpanType:
+		q = q.Where("system != ?", internalSpanType)
+	case strings.HasSuffix(f.System, ":all"):
+		system := strings.TrimSuffix(f.System, ":all")
+		q = q.Where("startsWith(system, ?)", system)
+	default:
+		q = q.Where("system = ?", f.System)
+	}
+
+	if f.GroupID != 0 {
+		q = q.Where("group_id = ?", f.GroupID)
+	}
+
+	return q
+}
+
+func spanGroupTable(period time.Duration) string {
+	switch period {
+	case time.Minute:
+		return "span_group_minutes AS s"
+	case time.Hour:
+		return "span_group_hours AS s"
+	}
+	panic("not reached")
+}
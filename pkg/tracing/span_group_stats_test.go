@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/uql"
+)
+
+func TestBuildSpanGroupQuery(t *testing.T) {
+	conf := new(bunapp.AppConfig)
+	conf.CH.DSN = "clickhouse://default:@localhost:9000/uptrace?sslmode=disable"
+
+	app := bunapp.New(context.Background(), conf)
+	defer app.Stop()
+
+	tests := []struct {
+		name   string
+		query  string
+		filter func(f *SpanFilter)
+		ok     bool
+	}{
+		{
+			name:  "group by group id",
+			query: "group by span.group_id | span.count_per_min | span.error_pct | p99(span.duration)",
+			ok:    true,
+		},
+		{
+			name:  "group by service key and system",
+			query: "group by span.group_id | group by service.key | group by span.system | span.apdex",
+			ok:    true,
+		},
+		{
+			name:  "disabled and invalid parts are ignored",
+			query: "group by span.group_id | where foo = | span.count",
+			ok:    true,
+		},
+		{
+			name:  "group id is required",
+			query: "group by span.system | span.count",
+		},
+		{
+			name:  "function in group by",
+			query: "group by span.group_id | group by uniq(span.system)",
+		},
+		{
+			name:  "service.name is not pre-aggregated",
+			query: "group by span.group_id | group by service.name",
+		},
+		{
+			name:  "where condition",
+			query: "group by span.group_id | where http.method = 'GET'",
+		},
+		{
+			name:  "arbitrary attribute",
+			query: "group by span.group_id | any(http.method)",
+		},
+		{
+			name:  "percentile of other attribute",
+			query: "group by span.group_id | p99(http.response_content_length)",
+		},
+		{
+			name:   "kind",
+			query:  "group by span.group_id | span.count",
+			filter: func(f *SpanFilter) { f.Kind = []string{"server"} },
+		},
+		{
+			name:   "status code",
+			query:  "group by span.group_id | span.count",
+			filter: func(f *SpanFilter) { f.StatusCode = []string{"error"} },
+		},
+		{
+			name:   "sample",
+			query:  "group by span.group_id | span.count",
+			filter: func(f *SpanFilter) { f.Sample = 0.1 },
+		},
+		{
+			name:   "accuracy",
+			query:  "group by span.group_id | span.count",
+			filter: func(f *SpanFilter) { f.Accuracy = bunapp.AccuracyApprox },
+		},
+		{
+			name:  "exact quantiles",
+			query: "group by span.group_id | p99(span.duration)",
+			filter: func(f *SpanFilter) {
+				conf.CHQueryAccuracy.Quantiles = bunapp.AccuracyExact
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf.CHQueryAccuracy.Quantiles = ""
+
+			f := &SpanFilter{App: app, ProjectID: 1, System: "http:api"}
+			f.TimeGTE = time.Date(2022, time.March, 1, 0, 0, 0, 0, time.UTC)
+			f.TimeLT = f.TimeGTE.Add(time.Hour)
+			f.parts = uql.Parse(test.query)
+			if test.filter != nil {
+				test.filter(f)
+			}
+
+			q, ok := buildSpanGroupQuery(f, 60)
+			require.Equal(t, test.ok, ok)
+			if ok {
+				require.Contains(t, q.String(), "span_group_minutes")
+			}
+		})
+	}
+}
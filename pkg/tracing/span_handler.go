@@ -18,11 +18,14 @@ import (
 
 type SpanHandler struct {
 	*bunapp.App
+
+	storage SpanStorage
 }
 
-func NewSpanHandler(app *bunapp.App) *SpanHandler {
+func NewSpanHandler(app *bunapp.App, storage SpanStorage) *SpanHandler {
 	return &SpanHandler{
-		App: app,
+		App:     app,
+		storage: storage,
 	}
 }
 
@@ -36,24 +39,61 @@ func (h *SpanHandler) ListSpans(w http.ResponseWriter, req bunrouter.Request) er
 	ctx := req.Context()
 	spans := make([]*Span, 0)
 
+	const limit = 10
+
 	q := buildSpanIndexQuery(f, f.Duration().Minutes()).
 		ColumnExpr("`span.id`").
 		ColumnExpr("`span.trace_id`").
-		Apply(f.CHOrder).
-		Limit(10).
-		Offset(f.Pager.GetOffset())
+		Limit(limit)
+
+	if f.Explain {
+		if f.sortedByTime() {
+			q = orderSpansByTime(q, f.SortDir)
+		} else {
+			q = q.Apply(f.CHOrder)
+		}
+		return explainQuery(ctx, w, h.App, q)
+	}
+
+	var count int
 
-	count, err := q.ScanAndCount(ctx, &spans)
+	switch {
+	case f.cursor != nil:
+		// The total count must not depend on the cursor.
+		countq := buildSpanIndexQuery(f, f.Duration().Minutes())
+		q = orderSpansByTime(f.cursor.whereClause(q, f.SortDir), f.SortDir)
+
+		var group syncutil.Group
+		group.Go(func() error {
+			return q.Scan(ctx, &spans)
+		})
+		group.Go(func() (err error) {
+			count, err = countq.Count(ctx)
+			return err
+		})
+		err = group.Err()
+	case f.sortedByTime():
+		q = orderSpansByTime(q, f.SortDir).Offset(f.Pager.GetOffset())
+		count, err = q.ScanAndCount(ctx, &spans)
+	default:
+		q = q.Apply(f.CHOrder).Offset(f.Pager.GetOffset())
+		count, err = q.ScanAndCount(ctx, &spans)
+	}
 	if err != nil {
 		return err
 	}
 
+	var nextCursor string
+	if f.sortedByTime() && len(spans) == limit {
+		nextCursor = spanCursorFor(spans[len(spans)-1]).String()
+	}
+
 	var group syncutil.Group
 
 	for _, span := range spans {
 		span := span
 		group.Go(func() error {
-			return SelectSpan(ctx, h.App, span)
+			return h.storage.SelectSpan(ctx, span)
 		})
 	}
 
@@ -61,9 +101,15 @@ func (h *SpanHandler) ListSpans(w http.ResponseWriter, req bunrouter.Request) er
 		return err
 	}
 
+	for _, span := range spans {
+		applySpanAttrPolicy(f.attrPolicy, span)
+	}
+
 	return httputil.JSON(w, bunrouter.H{
-		"spans": spans,
-		"count": count,
+		"spans":       spans,
+		"count":       count,
+		"nextCursor":  nextCursor,
+		"queryBudget": selectQueryBudget(ctx, f),
 	})
 }
 
@@ -76,8 +122,18 @@ func (h *SpanHandler) ListGroups(w http.ResponseWriter, req bunrouter.Request) e
 	ctx := req.Context()
 	groups := make([]map[string]any, 0)
 
-	q := buildSpanIndexQuery(f, f.Duration().Minutes()).
-		Limit(1000)
+	var budget *QueryBudget
+	q, ok := buildSpanGroupQuery(f, f.Duration().Minutes())
+	if !ok {
+		q = buildSpanIndexQuery(f, f.Duration().Minutes())
+		// Pre-aggregated tables are not limited.
+		budget = selectQueryBudget(ctx, f)
+	}
+	q = q.Limit(1000)
+
+	if f.Explain {
+		return explainQuery(ctx, w, h.App, q)
+	}
 
 	if err := q.Scan(ctx, &groups); err != nil {
 		if cherr, ok := err.(*ch.Error); ok {
@@ -105,9 +161,10 @@ func (h *SpanHandler) ListGroups(w http.ResponseWriter, req bunrouter.Request) e
 	}
 
 	return httputil.JSON(w, bunrouter.H{
-		"groups":     groups,
-		"queryParts": f.parts,
-		"columns":    columns,
+		"groups":      groups,
+		"queryParts":  f.parts,
+		"columns":     columns,
+		"queryBudget": budget,
 	})
 }
 
@@ -126,7 +183,7 @@ func (h *SpanHandler) Percentiles(w http.ResponseWriter, req bunrouter.Request)
 
 	subq := h.CH().NewSelect().
 		Model((*SpanIndex)(nil)).
-		WithAlias("qsNaN", "quantilesTDigest(0.5, 0.9, 0.99)(`span.duration`)").
+		WithAlias("qsNaN", "?(0.5, 0.9, 0.99)(`span.duration`)", ch.Safe(f.quantilesFunc())).
 		WithAlias("qs", "if(isNaN(qsNaN[1]), [0, 0, 0], qsNaN)").
 		ColumnExpr("count() AS count").
 		ColumnExpr("count() / ? AS rate", minutes).
@@ -141,7 +198,7 @@ func (h *SpanHandler) Percentiles(w http.ResponseWriter, req bunrouter.Request)
 		OrderExpr("time ASC").
 		Limit(10000)
 
-	if err := h.CH().NewSelect().
+	q := h.CH().NewSelect().
 		ColumnExpr("groupArray(s.count) AS count").
 		ColumnExpr("groupArray(s.rate) AS rate").
 		ColumnExpr("groupArray(s.errorCount) AS errorCount").
@@ -152,8 +209,13 @@ func (h *SpanHandler) Percentiles(w http.ResponseWriter, req bunrouter.Request)
 		ColumnExpr("groupArray(s.time) AS time").
 		TableExpr("(?) AS s", subq).
 		GroupExpr("tuple()").
-		Limit(1000).
-		Scan(ctx, &m); err != nil {
+		Limit(1000)
+
+	if f.Explain {
+		return explainQuery(ctx, w, h.App, q)
+	}
+
+	if err := q.Scan(ctx, &m); err != nil {
 		return err
 	}
 
@@ -185,22 +247,28 @@ func (h *SpanHandler) Stats(w http.ResponseWriter, req bunrouter.Request) error
 	m := make(map[string]interface{})
 
 	subq := buildSpanIndexQuery(f, minutes)
-	subq = uqlColumn(subq, colName, minutes).
+	subq = uqlColumn(subq, colName, f.uqlContext(minutes)).
 		ColumnExpr("toStartOfInterval(`span.time`, toIntervalMinute(?)) AS time", minutes).
 		GroupExpr("time").
 		OrderExpr("time ASC")
 
-	if err := h.CH().NewSelect().
+	q := h.CH().NewSelect().
 		ColumnExpr("groupArray(?) AS ?", ch.Ident(f.Column), ch.Ident(f.Column)).
 		ColumnExpr("groupArray(s.time) AS time").
 		TableExpr("(?) AS s", subq).
 		GroupExpr("tuple()").
-		Limit(1000).
-		Scan(ctx, &m); err != nil {
+		Limit(1000)
+
+	if f.Explain {
+		return explainQuery(ctx, w, h.App, q)
+	}
+
+	if err := q.Scan(ctx, &m); err != nil {
 		return err
 	}
 
 	fillHoles(m, f.TimeGTE, f.TimeLT, groupPeriod)
+	m["queryBudget"] = selectQueryBudget(ctx, f)
 
 	return httputil.JSON(w, m)
 }
@@ -0,0 +1,162 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/urlstruct"
+)
+
+type HTTPStatsFilter struct {
+	*bunapp.App `urlstruct:"-"`
+
+	TimeFilter
+
+	ProjectID uint32
+	// Optional service name.
+	Service string
+}
+
+func DecodeHTTPStatsFilter(app *bunapp.App, req bunrouter.Request) (*HTTPStatsFilter, error) {
+	f := &HTTPStatsFilter{App: app}
+	if err := bunapp.UnmarshalValues(req, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+var _ urlstruct.ValuesUnmarshaler = (*HTTPStatsFilter)(nil)
+
+func (f *HTTPStatsFilter) UnmarshalValues(ctx context.Context, values url.Values) error {
+	if err := f.TimeFilter.UnmarshalValues(ctx, values); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (f *HTTPStatsFilter) whereClause(q *ch.SelectQuery) *ch.SelectQuery {
+	q = q.Where("project_id = ?", f.ProjectID).
+		Where("time >= ?", f.TimeGTE).
+		Where("time < ?", f.TimeLT)
+	if f.Service != "" {
+		q = q.Where("service = ?", f.Service)
+	}
+	return q
+}
+
+//------------------------------------------------------------------------------
+
+// HTTPGroupStats are stats of HTTP spans in a span group with the same method
+// and status class, for example, 2xx or 5xx. Spans without a status code have
+// an empty status class.
+type HTTPGroupStats struct {
+	System      string `json:"system"`
+	Service     string `json:"service"`
+	GroupID     uint64 `json:"groupId,string"`
+	Name        string `json:"name"`
+	HTTPMethod  string `json:"httpMethod"`
+	StatusClass string `json:"statusClass"`
+
+	Count      float64 `json:"count"`
+	ErrorCount float64 `json:"errorCount"`
+	Rate       float64 `json:"rate"`
+	P50        float64 `json:"p50"`
+	P90        float64 `json:"p90"`
+	P99        float64 `json:"p99"`
+}
+
+func spanHTTPTable(period time.Duration) string {
+	switch period {
+	case time.Minute:
+		return "span_http_minutes"
+	case time.Hour:
+		return "span_http_hours"
+	}
+	panic("not reached")
+}
+
+// selectHTTPGroupStats uses the pre-aggregated span_http_* tables so the breakdowns
+// by status class and method are selected with one query.
+func selectHTTPGroupStats(ctx context.Context, f *HTTPStatsFilter) ([]HTTPGroupStats, error) {
+	stats := make([]HTTPGroupStats, 0)
+
+	if err := f.CH().NewSelect().
+		ColumnExpr("system, service, group_id, http_method, status_class").
+		ColumnExpr("any(name) AS name").
+		ColumnExpr("toFloat64(sum(count)) AS count").
+		ColumnExpr("toFloat64(sum(error_count)) AS error_count").
+		ColumnExpr("count / ? AS rate", f.Duration().Minutes()).
+		ColumnExpr("toFloat64(quantilesTDigestWeightedMerge(0.5, 0.9, 0.99)(tdigest)[1]) AS p50").
+		ColumnExpr("toFloat64(quantilesTDigestWeightedMerge(0.5, 0.9, 0.99)(tdigest)[2]) AS p90").
+		ColumnExpr("toFloat64(quantilesTDigestWeightedMerge(0.5, 0.9, 0.99)(tdigest)[3]) AS p99").
+		TableExpr(spanHTTPTable(tablePeriod(&f.TimeFilter))).
+		Apply(f.whereClause).
+		GroupExpr("system, service, group_id, http_method, status_class").
+		OrderExpr("count DESC").
+		Limit(10000).
+		Scan(ctx, &stats); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+type HTTPStatusClassStats struct {
+	StatusClass string  `json:"statusClass"`
+	Count       float64 `json:"count"`
+	ErrorCount  float64 `json:"errorCount"`
+}
+
+// totalsByStatusClass sums the group stats by status class ordering classes
+// by name so 2xx comes before 4xx and 5xx.
+func totalsByStatusClass(stats []HTTPGroupStats) []HTTPStatusClassStats {
+	index := make(map[string]int)
+	totals := make([]HTTPStatusClassStats, 0)
+
+	for i := range stats {
+		s := &stats[i]
+
+		idx, ok := index[s.StatusClass]
+		if !ok {
+			idx = len(totals)
+			index[s.StatusClass] = idx
+			totals = append(totals, HTTPStatusClassStats{StatusClass: s.StatusClass})
+		}
+
+		total := &totals[idx]
+		total.Count += s.Count
+		total.ErrorCount += s.ErrorCount
+	}
+
+	sort.Slice(totals, func(i, j int) bool {
+		return totals[i].StatusClass < totals[j].StatusClass
+	})
+	return totals
+}
+
+// HTTPStats returns HTTP span groups broken down by method and status class.
+func (h *ServiceHandler) HTTPStats(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	f, err := DecodeHTTPStatsFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+
+	stats, err := selectHTTPGroupStats(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"groups":        stats,
+		"statusClasses": totalsByStatusClass(stats),
+	})
+}
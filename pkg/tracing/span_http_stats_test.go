@@ -0,0 +1,22 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTotalsByStatusClass(t *testing.T) {
+	stats := []HTTPGroupStats{
+		{GroupID: 1, StatusClass: "5xx", Count: 3, ErrorCount: 3},
+		{GroupID: 1, StatusClass: "2xx", Count: 10},
+		{GroupID: 2, StatusClass: "2xx", Count: 5},
+		{GroupID: 2, StatusClass: "4xx", Count: 2, ErrorCount: 1},
+	}
+
+	require.Equal(t, []HTTPStatusClassStats{
+		{StatusClass: "2xx", Count: 15},
+		{StatusClass: "4xx", Count: 2, ErrorCount: 1},
+		{StatusClass: "5xx", Count: 3, ErrorCount: 3},
+	}, totalsByStatusClass(stats))
+}
@@ -19,12 +19,19 @@ type SpanIndex struct {
 	EventErrorCount uint8 `ch:"span.event_error_count"`
 	EventLogCount   uint8 `ch:"span.event_log_count"`
 
+	// Apdex level of the span or empty for events.
+	ApdexLevel string `ch:"span.apdex_level,lc"`
+
 	AttrKeys   []string `ch:",lc"`
 	AttrValues []string `ch:",lc"`
 
 	ServiceName string `ch:"service.name,lc"`
+	ServiceKey  string `ch:"service.key,lc"` // for example, shop/api
 	HostName    string `ch:"host.name,lc"`
 
+	OtelLibraryName    string `ch:"otel.library.name,lc"`
+	OtelLibraryVersion string `ch:"otel.library.version,lc"`
+
 	DBSystem    string `ch:"db.system,lc"`
 	DBStatement string `ch:"db.statement"`
 	DBOperation string `ch:"db.operation,lc"`
@@ -44,6 +51,9 @@ func newSpanIndex(index *SpanIndex, span *Span) {
 	index.ServiceName, _ = span.Attrs[xattr.ServiceName].(string)
 	index.HostName, _ = span.Attrs[xattr.HostName].(string)
 
+	index.OtelLibraryName, _ = span.Attrs[xattr.OtelLibraryName].(string)
+	index.OtelLibraryVersion, _ = span.Attrs[xattr.OtelLibraryVersion].(string)
+
 	index.DBSystem, _ = span.Attrs[xattr.DBSystem].(string)
 	index.DBStatement, _ = span.Attrs[xattr.DBStatement].(string)
 	index.DBOperation, _ = span.Attrs[xattr.DBOperation].(string)
@@ -63,6 +73,9 @@ var (
 		xattr.ServiceName,
 		xattr.HostName,
 
+		xattr.OtelLibraryName,
+		xattr.OtelLibraryVersion,
+
 		xattr.DBSystem,
 		xattr.DBStatement,
 		xattr.DBOperation,
@@ -82,9 +95,6 @@ var (
 		xattr.TelemetrySDKName,
 		xattr.TelemetrySDKVersion,
 		xattr.TelemetrySDKLanguage,
-
-		xattr.OtelLibraryName,
-		xattr.OtelLibraryVersion,
 	}
 	ignoredAttrSet = listToSet(ignoredAttrs)
 )
@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// applySpanLimits drops attributes, events, and links over the limits and truncates
+// attribute values like OpenTelemetry SDKs do. The dropped counts are added to the
+// counts reported by the SDK. Resource attributes are not limited.
+func applySpanLimits(span *tracepb.Span, limits *bunapp.SpanLimits) {
+	var dropped int
+	span.Attributes, dropped = limitAttrs(
+		span.Attributes, limits.AttrCountLimit, limits.AttrValueLengthLimit)
+	span.DroppedAttributesCount += uint32(dropped)
+
+	if n := len(span.Events) - limits.EventCountLimit; n > 0 {
+		span.Events = span.Events[:limits.EventCountLimit]
+		span.DroppedEventsCount += uint32(n)
+	}
+	for _, event := range span.Events {
+		event.Attributes, dropped = limitAttrs(
+			event.Attributes, limits.AttrPerEventCountLimit, limits.AttrValueLengthLimit)
+		event.DroppedAttributesCount += uint32(dropped)
+	}
+
+	if n := len(span.Links) - limits.LinkCountLimit; n > 0 {
+		span.Links = span.Links[:limits.LinkCountLimit]
+		span.DroppedLinksCount += uint32(n)
+	}
+	for _, link := range span.Links {
+		link.Attributes, dropped = limitAttrs(
+			link.Attributes, limits.AttrPerLinkCountLimit, limits.AttrValueLengthLimit)
+		link.DroppedAttributesCount += uint32(dropped)
+	}
+}
+
+func limitAttrs(
+	kvs []*commonpb.KeyValue, countLimit, valueLengthLimit int,
+) ([]*commonpb.KeyValue, int) {
+	var dropped int
+	if len(kvs) > countLimit {
+		dropped = len(kvs) - countLimit
+		kvs = kvs[:countLimit]
+	}
+	if valueLengthLimit > 0 {
+		for _, kv := range kvs {
+			truncateAnyValue(kv.Value, valueLengthLimit)
+		}
+	}
+	return kvs, dropped
+}
+
+// truncateAnyValue truncates strings and byte arrays including the ones in arrays.
+func truncateAnyValue(value *commonpb.AnyValue, limit int) {
+	switch v := value.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		if len(v.StringValue) > limit {
+			v.StringValue = truncate(v.StringValue, limit)
+		}
+	case *commonpb.AnyValue_BytesValue:
+		if len(v.BytesValue) > limit {
+			v.BytesValue = v.BytesValue[:limit]
+		}
+	case *commonpb.AnyValue_ArrayValue:
+		for _, el := range v.ArrayValue.GetValues() {
+			truncateAnyValue(el, limit)
+		}
+	case *commonpb.AnyValue_KvlistValue:
+		for _, kv := range v.KvlistValue.GetValues() {
+			truncateAnyValue(kv.Value, limit)
+		}
+	}
+}
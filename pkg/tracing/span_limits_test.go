@@ -0,0 +1,47 @@
+package tracing
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func TestApplySpanLimits(t *testing.T) {
+	limits := &bunapp.SpanLimits{
+		AttrCountLimit:         2,
+		AttrValueLengthLimit:   5,
+		EventCountLimit:        1,
+		LinkCountLimit:         1,
+		AttrPerEventCountLimit: 1,
+		AttrPerLinkCountLimit:  1,
+	}
+
+	span := &tracepb.Span{
+		Attributes: []*commonpb.KeyValue{
+			otlpStringAttr("foo", strings.Repeat("x", 10)),
+			otlpIntAttr("bar", 1),
+			otlpIntAttr("baz", 2),
+		},
+		DroppedAttributesCount: 1,
+		Events: []*tracepb.Span_Event{
+			{Attributes: []*commonpb.KeyValue{otlpIntAttr("a", 1), otlpIntAttr("b", 2)}},
+			{Name: "dropped"},
+		},
+		Links: []*tracepb.Span_Link{{}, {}, {}},
+	}
+	applySpanLimits(span, limits)
+
+	require.Equal(t, AttrMap{"foo": "xxxxx", "bar": int64(1)}, otlpAttrs(span.Attributes))
+	require.Equal(t, uint32(2), span.DroppedAttributesCount)
+
+	require.Len(t, span.Events, 1)
+	require.Equal(t, uint32(1), span.DroppedEventsCount)
+	require.Equal(t, uint32(1), span.Events[0].DroppedAttributesCount)
+
+	require.Len(t, span.Links, 1)
+	require.Equal(t, uint32(2), span.DroppedLinksCount)
+}
@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/uql"
+)
+
+type MetricPoint struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// SelectSpanMetric returns the metric, for example, span.error_pct or p99(span.duration),
+// of the spans selected by the filter aggregated over the interval. Intervals without
+// spans have zero values.
+func SelectSpanMetric(
+	ctx context.Context, f *SpanFilter, metric string, interval time.Duration,
+) ([]MetricPoint, error) {
+	if interval < time.Minute || interval%time.Minute != 0 {
+		return nil, fmt.Errorf("interval must be a whole number of minutes, got %s", interval)
+	}
+
+	name, err := uql.ParseName(metric)
+	if err != nil {
+		return nil, err
+	}
+	if !isAggColumn(name) {
+		return nil, fmt.Errorf("metric %q must be an aggregate", metric)
+	}
+
+	if f.System == "" {
+		f.System = allSpanType
+	}
+	f.TimeGTE = f.TimeGTE.Truncate(interval)
+	f.TimeLT = f.TimeLT.Truncate(interval)
+	f.parts = uql.Parse(f.Query)
+	disableColumnsAndGroups(f.parts)
+
+	minutes := interval.Minutes()
+
+	var points []MetricPoint
+
+	if err := buildSpanIndexQuery(f, minutes).
+		ColumnExpr("toFloat64(?) AS value", ch.Safe(appendUQLColumn(nil, name, f.uqlContext(minutes)))).
+		ColumnExpr("toStartOfInterval(`span.time`, toIntervalMinute(?)) AS time", minutes).
+		GroupExpr("time").
+		OrderExpr("time ASC").
+		Limit(10000).
+		Scan(ctx, &points); err != nil {
+		return nil, err
+	}
+
+	return fillMetricPoints(points, f.TimeGTE, f.TimeLT, interval), nil
+}
+
+func fillMetricPoints(points []MetricPoint, gte, lt time.Time, interval time.Duration) []MetricPoint {
+	filled := make([]MetricPoint, numItem(gte, lt, interval))
+	for i := range filled {
+		filled[i].Time = gte.Add(time.Duration(i) * interval)
+	}
+
+	for _, point := range points {
+		index := int(point.Time.Sub(gte) / interval)
+		if index >= 0 && index < len(filled) {
+			filled[index].Value = point.Value
+		}
+	}
+
+	return filled
+}
@@ -0,0 +1,184 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/urlstruct"
+	"google.golang.org/grpc/codes"
+)
+
+type RPCStatsFilter struct {
+	*bunapp.App `urlstruct:"-"`
+
+	TimeFilter
+
+	ProjectID uint32
+	// Optional service name.
+	Service string
+	// Optional rpc.service, for example, helloworld.Greeter.
+	RPCService string
+}
+
+func DecodeRPCStatsFilter(app *bunapp.App, req bunrouter.Request) (*RPCStatsFilter, error) {
+	f := &RPCStatsFilter{App: app}
+	if err := bunapp.UnmarshalValues(req, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+var _ urlstruct.ValuesUnmarshaler = (*RPCStatsFilter)(nil)
+
+func (f *RPCStatsFilter) UnmarshalValues(ctx context.Context, values url.Values) error {
+	if err := f.TimeFilter.UnmarshalValues(ctx, values); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (f *RPCStatsFilter) whereClause(q *ch.SelectQuery) *ch.SelectQuery {
+	q = q.Where("project_id = ?", f.ProjectID).
+		Where("time >= ?", f.TimeGTE).
+		Where("time < ?", f.TimeLT)
+	if f.Service != "" {
+		q = q.Where("service = ?", f.Service)
+	}
+	if f.RPCService != "" {
+		q = q.Where("rpc_service = ?", f.RPCService)
+	}
+	return q
+}
+
+//------------------------------------------------------------------------------
+
+// RPCMethodStats are stats of RPC spans in a span group with the same gRPC status code.
+// Spans without a status code, for example, spans of non-gRPC systems, have an empty
+// status code.
+type RPCMethodStats struct {
+	System         string `json:"system"`
+	Service        string `json:"service"`
+	GroupID        uint64 `json:"groupId,string"`
+	Name           string `json:"name"`
+	RPCService     string `json:"rpcService"`
+	RPCMethod      string `json:"rpcMethod"`
+	GRPCStatusCode string `json:"grpcStatusCode"`
+	GRPCStatus     string `json:"grpcStatus" ch:"-"`
+
+	Count      float64 `json:"count"`
+	ErrorCount float64 `json:"errorCount"`
+	Rate       float64 `json:"rate"`
+	P50        float64 `json:"p50"`
+	P90        float64 `json:"p90"`
+	P99        float64 `json:"p99"`
+}
+
+func spanRPCTable(period time.Duration) string {
+	switch period {
+	case time.Minute:
+		return "span_rpc_minutes"
+	case time.Hour:
+		return "span_rpc_hours"
+	}
+	panic("not reached")
+}
+
+// selectRPCMethodStats uses the pre-aggregated span_rpc_* tables like
+// selectHTTPGroupStats does for HTTP spans.
+func selectRPCMethodStats(ctx context.Context, f *RPCStatsFilter) ([]RPCMethodStats, error) {
+	stats := make([]RPCMethodStats, 0)
+
+	if err := f.CH().NewSelect().
+		ColumnExpr("system, service, group_id, rpc_service, rpc_method, grpc_status_code").
+		ColumnExpr("any(name) AS name").
+		ColumnExpr("toFloat64(sum(count)) AS count").
+		ColumnExpr("toFloat64(sum(error_count)) AS error_count").
+		ColumnExpr("count / ? AS rate", f.Duration().Minutes()).
+		ColumnExpr("toFloat64(quantilesTDigestWeightedMerge(0.5, 0.9, 0.99)(tdigest)[1]) AS p50").
+		ColumnExpr("toFloat64(quantilesTDigestWeightedMerge(0.5, 0.9, 0.99)(tdigest)[2]) AS p90").
+		ColumnExpr("toFloat64(quantilesTDigestWeightedMerge(0.5, 0.9, 0.99)(tdigest)[3]) AS p99").
+		TableExpr(spanRPCTable(tablePeriod(&f.TimeFilter))).
+		Apply(f.whereClause).
+		GroupExpr("system, service, group_id, rpc_service, rpc_method, grpc_status_code").
+		OrderExpr("count DESC").
+		Limit(10000).
+		Scan(ctx, &stats); err != nil {
+		return nil, err
+	}
+
+	for i := range stats {
+		s := &stats[i]
+		s.GRPCStatus = grpcStatusName(s.GRPCStatusCode)
+	}
+
+	return stats, nil
+}
+
+// grpcStatusName returns the name of the gRPC status code, for example, NotFound.
+func grpcStatusName(code string) string {
+	n, err := strconv.ParseUint(code, 10, 32)
+	if err != nil {
+		return code
+	}
+	return codes.Code(n).String()
+}
+
+type GRPCStatusStats struct {
+	GRPCStatusCode string  `json:"grpcStatusCode"`
+	GRPCStatus     string  `json:"grpcStatus"`
+	Count          float64 `json:"count"`
+}
+
+// totalsByGRPCStatus sums the method stats by gRPC status code.
+func totalsByGRPCStatus(stats []RPCMethodStats) []GRPCStatusStats {
+	index := make(map[string]int)
+	totals := make([]GRPCStatusStats, 0)
+
+	for i := range stats {
+		s := &stats[i]
+
+		idx, ok := index[s.GRPCStatusCode]
+		if !ok {
+			idx = len(totals)
+			index[s.GRPCStatusCode] = idx
+			totals = append(totals, GRPCStatusStats{
+				GRPCStatusCode: s.GRPCStatusCode,
+				GRPCStatus:     s.GRPCStatus,
+			})
+		}
+		totals[idx].Count += s.Count
+	}
+
+	sort.Slice(totals, func(i, j int) bool {
+		return totals[i].Count > totals[j].Count
+	})
+	return totals
+}
+
+// RPCStats returns RPC methods broken down by gRPC status code.
+func (h *ServiceHandler) RPCStats(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	f, err := DecodeRPCStatsFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+
+	stats, err := selectRPCMethodStats(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"methods":      stats,
+		"grpcStatuses": totalsByGRPCStatus(stats),
+	})
+}
@@ -0,0 +1,13 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGRPCStatusName(t *testing.T) {
+	require.Equal(t, "OK", grpcStatusName("0"))
+	require.Equal(t, "NotFound", grpcStatusName("5"))
+	require.Equal(t, "", grpcStatusName(""))
+}
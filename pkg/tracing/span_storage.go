@@ -0,0 +1,181 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+// SpanStorage stores spans received by the ingest layer and loads them for the trace
+// and span views. Use RegisterSpanStorage to plug in a backend other than ClickHouse.
+//
+// Aggregations over spans_index, for example, groups and percentiles, still use
+// ClickHouse SQL.
+type SpanStorage interface {
+	// InsertSpans inserts a batch of spans. Both slices describe the same spans so
+	// backends must not store the index without the data.
+	InsertSpans(ctx context.Context, index []SpanIndex, data []SpanData) error
+
+	// SelectSpan loads the span with span.TraceID and span.ID.
+	SelectSpan(ctx context.Context, span *Span) error
+
+	// SelectTraceSpans returns up to limit spans of the trace in any order.
+	SelectTraceSpans(ctx context.Context, traceID uuid.UUID, limit int) ([]*Span, error)
+}
+
+// SpanStorageFunc creates the storage. It is called once for the ingest layer and once
+// for each API handler so backends that keep state should share it between calls.
+type SpanStorageFunc func(app *bunapp.App) (SpanStorage, error)
+
+var spanStorages = struct {
+	sync.RWMutex
+	m map[string]SpanStorageFunc
+}{
+	m: map[string]SpanStorageFunc{
+		"clickhouse": func(app *bunapp.App) (SpanStorage, error) {
+			return NewCHSpanStorage(app), nil
+		},
+	},
+}
+
+// RegisterSpanStorage makes the backend available using the span_storage.backend option.
+func RegisterSpanStorage(name string, fn SpanStorageFunc) {
+	spanStorages.Lock()
+	defer spanStorages.Unlock()
+
+	if _, ok := spanStorages.m[name]; ok {
+		panic(fmt.Errorf("span storage %q is already registered", name))
+	}
+	spanStorages.m[name] = fn
+}
+
+// NewSpanStorage creates the storage configured with the span_storage.backend option.
+func NewSpanStorage(app *bunapp.App) (SpanStorage, error) {
+	name := app.Config().SpanStorage.Backend
+
+	spanStorages.RLock()
+	fn, ok := spanStorages.m[name]
+	spanStorages.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown span_storage.backend: %q (registered: %v)",
+			name, spanStorageNames())
+	}
+
+	if app.Config().SpanStorage.Faults.Enabled() {
+		if name != "clickhouse" {
+			return nil, fmt.Errorf("span_storage.faults requires the clickhouse backend, got %q", name)
+		}
+		app.Zap(app.Context()).Warn("span_storage.faults is enabled, span inserts will fail")
+	}
+	return fn(app)
+}
+
+func spanStorageNames() []string {
+	spanStorages.RLock()
+	defer spanStorages.RUnlock()
+
+	names := make([]string, 0, len(spanStorages.m))
+	for name := range spanStorages.m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//------------------------------------------------------------------------------
+
+// CHSpanStorage stores spans in the spans_index and spans_data ClickHouse tables.
+type CHSpanStorage struct {
+	*bunapp.App
+
+	faults *insertFaults
+}
+
+var _ SpanStorage = (*CHSpanStorage)(nil)
+
+func NewCHSpanStorage(app *bunapp.App) *CHSpanStorage {
+	return &CHSpanStorage{
+		App:    app,
+		faults: newInsertFaults(&app.Config().SpanStorage.Faults),
+	}
+}
+
+// InsertSpans inserts spans_data before spans_index so the index never references
+// missing data. ClickHouse can't insert into both tables atomically, so each
+// insert is retried separately instead of inserting the data twice or leaving
+// spans that are invisible in the UI.
+func (s *CHSpanStorage) InsertSpans(
+	ctx context.Context, index []SpanIndex, data []SpanData,
+) error {
+	conf := &s.Config().SpanStorage.Retry
+
+	if err := retryInsert(ctx, conf, func(ctx context.Context) error {
+		return s.faults.insert(ctx, len(data), func(n int) error {
+			data := data[:n]
+			_, err := s.CH().NewInsert().Model(&data).Exec(ctx)
+			return err
+		})
+	}); err != nil {
+		return fmt.Errorf("insert into spans_data failed: %w", err)
+	}
+
+	if err := retryInsert(ctx, conf, func(ctx context.Context) error {
+		return s.faults.insert(ctx, len(index), func(n int) error {
+			index := index[:n]
+			_, err := s.CH().NewInsert().Model(&index).Exec(ctx)
+			return err
+		})
+	}); err != nil {
+		return fmt.Errorf("insert into spans_index failed: %w", err)
+	}
+	return nil
+}
+
+func (s *CHSpanStorage) SelectSpan(ctx context.Context, span *Span) error {
+	var data []byte
+
+	if err := s.CH().NewSelect().
+		Model((*SpanData)(nil)).
+		Column("data").
+		Where("trace_id = ?", span.TraceID).
+		Where("id = ?", span.ID).
+		Limit(1).
+		Scan(ctx, &data); err != nil {
+		return err
+	}
+
+	return unmarshalSpan(data, span)
+}
+
+func (s *CHSpanStorage) SelectTraceSpans(
+	ctx context.Context, traceID uuid.UUID, limit int,
+) ([]*Span, error) {
+	var data []SpanData
+
+	if err := s.CH().NewSelect().
+		Model(&data).
+		Column("data").
+		Where("trace_id = ?", traceID).
+		Limit(limit).
+		Scan(ctx); err != nil {
+		return nil, err
+	}
+
+	spans := make([]*Span, len(data))
+
+	for i, span := range spans {
+		span = new(Span)
+		spans[i] = span
+
+		if err := unmarshalSpan(data[i].Data, span); err != nil {
+			return nil, err
+		}
+	}
+
+	return spans, nil
+}
@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+// errInjectedFault is retried like a temporary ClickHouse error.
+var errInjectedFault = errors.New("span_storage: injected fault")
+
+// insertFaults injects the failures configured with span_storage.faults into each
+// table insert of CHSpanStorage. Faults are injected inside the retried insert so
+// they go through span_storage.retry like real ClickHouse errors.
+type insertFaults struct {
+	conf *bunapp.SpanStorageFaults
+}
+
+// newInsertFaults returns nil when the faults are disabled.
+func newInsertFaults(conf *bunapp.SpanStorageFaults) *insertFaults {
+	if !conf.Enabled() {
+		return nil
+	}
+	return &insertFaults{
+		conf: conf,
+	}
+}
+
+// insert calls fn with the number of the numRow rows to insert. Partial faults
+// insert the first half of the rows and then fail.
+func (f *insertFaults) insert(ctx context.Context, numRow int, fn func(n int) error) error {
+	if f == nil {
+		return fn(numRow)
+	}
+
+	if f.conf.Latency > 0 {
+		timer := time.NewTimer(f.conf.Latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+
+	switch r := rand.Float64(); {
+	case r < f.conf.ErrorRate:
+		return errInjectedFault
+	case r < f.conf.ErrorRate+f.conf.PartialRate:
+		n := numRow / 2
+		if err := fn(n); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: inserted %d of %d rows", errInjectedFault, n, numRow)
+	default:
+		return fn(numRow)
+	}
+}
@@ -0,0 +1,101 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+func TestInsertFaults(t *testing.T) {
+	ctx := context.Background()
+
+	var inserted int
+	insert := func(n int) error {
+		inserted += n
+		return nil
+	}
+
+	faults := newInsertFaults(&bunapp.SpanStorageFaults{ErrorRate: 1})
+	err := faults.insert(ctx, 10, insert)
+	require.True(t, errors.Is(err, errInjectedFault))
+	require.True(t, isRetryableInsertError(err))
+	require.Equal(t, 0, inserted)
+
+	faults = newInsertFaults(&bunapp.SpanStorageFaults{PartialRate: 1})
+	err = faults.insert(ctx, 10, insert)
+	require.EqualError(t, err, "span_storage: injected fault: inserted 5 of 10 rows")
+	require.True(t, isRetryableInsertError(err))
+	require.Equal(t, 5, inserted)
+
+	require.Nil(t, newInsertFaults(&bunapp.SpanStorageFaults{}))
+	faults = nil
+	require.NoError(t, faults.insert(ctx, 10, insert))
+	require.Equal(t, 15, inserted)
+}
+
+func TestInsertFaultsRetry(t *testing.T) {
+	ctx := context.Background()
+	conf := &bunapp.SpanStorageRetry{
+		MaxAttempts: 50,
+		MaxAge:      time.Minute,
+		Backoff:     time.Microsecond,
+		MaxBackoff:  time.Microsecond,
+	}
+	faults := newInsertFaults(&bunapp.SpanStorageFaults{ErrorRate: 0.5, PartialRate: 0.2})
+
+	// Batches are stored in the end, and partial faults insert some rows twice.
+	for i := 0; i < 10; i++ {
+		var attempts, inserted int
+		err := retryInsert(ctx, conf, func(ctx context.Context) error {
+			attempts++
+			return faults.insert(ctx, 10, func(n int) error {
+				inserted += n
+				return nil
+			})
+		})
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, inserted, 10)
+		require.LessOrEqual(t, attempts, conf.MaxAttempts)
+	}
+}
+
+func TestNewSpanStorageFaults(t *testing.T) {
+	ctx := context.Background()
+
+	conf := &bunapp.AppConfig{}
+	conf.CH.DSN = "clickhouse://default:@localhost:9000/uptrace?sslmode=disable"
+	conf.SpanStorage.Backend = "clickhouse"
+	conf.SpanStorage.Faults.ErrorRate = 1
+	conf.SpanStorage.Retry = bunapp.SpanStorageRetry{
+		MaxAttempts: 3,
+		MaxAge:      time.Minute,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+	}
+
+	app := bunapp.New(ctx, conf)
+	defer app.Stop()
+
+	// Injected faults are retried and never reach ClickHouse.
+	storage, err := NewSpanStorage(app)
+	require.NoError(t, err)
+	err = storage.InsertSpans(ctx, make([]SpanIndex, 10), make([]SpanData, 10))
+	require.EqualError(t, err,
+		"insert into spans_data failed: failed after 3 attempts: span_storage: injected fault")
+
+	conf.SpanStorage.Backend = "memory"
+	RegisterSpanStorage("memory", func(app *bunapp.App) (SpanStorage, error) {
+		return new(countingSpanStorage), nil
+	})
+	defer func() {
+		spanStorages.Lock()
+		delete(spanStorages.m, "memory")
+		spanStorages.Unlock()
+	}()
+	_, err = NewSpanStorage(app)
+	require.EqualError(t, err, `span_storage.faults requires the clickhouse backend, got "memory"`)
+}
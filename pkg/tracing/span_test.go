@@ -0,0 +1,23 @@
+package tracing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildSpanTreeSyntheticRoot(t *testing.T) {
+	now := time.Now()
+	spans := []*Span{
+		{ID: 2, ParentID: 1, Time: now, Duration: time.Second},
+		{ID: 3, ParentID: 2, Time: now.Add(time.Second), Duration: 2 * time.Second},
+	}
+
+	root := BuildSpanTree(&spans)
+	require.True(t, root.Synthetic)
+	require.Equal(t, now, root.Time)
+	require.Equal(t, 3*time.Second, root.Duration)
+	require.Len(t, root.Children, 1)
+	require.Equal(t, uint64(2), root.Children[0].ID)
+}
@@ -0,0 +1,165 @@
+package tracing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	maxSpanAttrKeySize   = 256
+	maxSpanAttrValueSize = 4 << 20
+)
+
+var (
+	zeroTraceID = make([]byte, 16)
+	zeroSpanID  = make([]byte, 8)
+)
+
+// validateSpan returns an error if the span can't be stored. Attribute values are
+// checked after the span limits are applied.
+func validateSpan(span *tracepb.Span) error {
+	if len(span.TraceId) != 16 || bytes.Equal(span.TraceId, zeroTraceID) {
+		return fmt.Errorf("invalid trace id: %x", span.TraceId)
+	}
+	if len(span.SpanId) != 8 || bytes.Equal(span.SpanId, zeroSpanID) {
+		return fmt.Errorf("invalid span id: %x", span.SpanId)
+	}
+	if len(span.ParentSpanId) != 0 && len(span.ParentSpanId) != 8 {
+		return fmt.Errorf("invalid parent span id: %x", span.ParentSpanId)
+	}
+	if span.StartTimeUnixNano == 0 {
+		return errors.New("start time is missing")
+	}
+	if span.EndTimeUnixNano == 0 {
+		return errors.New("end time is missing")
+	}
+
+	if err := validateSpanAttrs(span.Attributes); err != nil {
+		return err
+	}
+	for _, event := range span.Events {
+		if err := validateSpanAttrs(event.Attributes); err != nil {
+			return fmt.Errorf("event %q: %w", event.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateSpanAttrs(kvs []*commonpb.KeyValue) error {
+	for _, kv := range kvs {
+		if len(kv.Key) > maxSpanAttrKeySize {
+			return fmt.Errorf("attribute key is longer than %d bytes: %q...",
+				maxSpanAttrKeySize, kv.Key[:32])
+		}
+		if n := anyValueSize(kv.Value); n > maxSpanAttrValueSize {
+			return fmt.Errorf("attribute %q is larger than %d bytes: %d",
+				kv.Key, maxSpanAttrValueSize, n)
+		}
+	}
+	return nil
+}
+
+func anyValueSize(value *commonpb.AnyValue) int {
+	switch v := value.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return len(v.StringValue)
+	case *commonpb.AnyValue_BytesValue:
+		return len(v.BytesValue)
+	case *commonpb.AnyValue_ArrayValue:
+		var size int
+		for _, el := range v.ArrayValue.GetValues() {
+			size += anyValueSize(el)
+		}
+		return size
+	case *commonpb.AnyValue_KvlistValue:
+		var size int
+		for _, kv := range v.KvlistValue.GetValues() {
+			size += len(kv.Key) + anyValueSize(kv.Value)
+		}
+		return size
+	default:
+		return 8
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// rejectedSpans counts the spans that failed validation and keeps the first error.
+type rejectedSpans struct {
+	count int64
+	err   error
+}
+
+func (r *rejectedSpans) add(span *tracepb.Span, err error) {
+	if r.count == 0 {
+		r.err = fmt.Errorf("span %q: %w", truncate(span.Name, 100), err)
+	}
+	r.count++
+}
+
+// message returns the error message of the OTLP partial success.
+func (r *rejectedSpans) message() string {
+	if r.count == 0 {
+		return ""
+	}
+	if r.count == 1 {
+		return fmt.Sprintf("rejected 1 span: %s", r.err)
+	}
+	return fmt.Sprintf("rejected %d spans, the first error: %s", r.count, r.err)
+}
+
+// ExportTracePartialSuccess is not part of the OTLP version that Uptrace uses,
+// so the field is encoded as an unknown field that exporters decode as:
+//
+//	message ExportTraceServiceResponse {
+//	  ExportTracePartialSuccess partial_success = 1;
+//	}
+//	message ExportTracePartialSuccess {
+//	  int64 rejected_spans = 1;
+//	  string error_message = 2;
+//	}
+func (r *rejectedSpans) partialSuccess() protoreflect.RawFields {
+	if r.count == 0 {
+		return nil
+	}
+
+	var msg []byte
+	msg = protowire.AppendTag(msg, 1, protowire.VarintType)
+	msg = protowire.AppendVarint(msg, uint64(r.count))
+	msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+	msg = protowire.AppendString(msg, r.message())
+
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, msg)
+	return b
+}
+
+type otlpPartialSuccessJSON struct {
+	PartialSuccess *otlpTracePartialSuccessJSON `json:"partialSuccess,omitempty"`
+}
+
+type otlpTracePartialSuccessJSON struct {
+	RejectedSpans int64  `json:"rejectedSpans,string"`
+	ErrorMessage  string `json:"errorMessage"`
+}
+
+// partialSuccessJSON returns the OTLP JSON response that protojson can't produce
+// from the unknown field.
+func (r *rejectedSpans) partialSuccessJSON() otlpPartialSuccessJSON {
+	if r.count == 0 {
+		return otlpPartialSuccessJSON{}
+	}
+	return otlpPartialSuccessJSON{
+		PartialSuccess: &otlpTracePartialSuccessJSON{
+			RejectedSpans: r.count,
+			ErrorMessage:  r.message(),
+		},
+	}
+}
@@ -0,0 +1,87 @@
+package tracing
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestWalkOTLPSpansRejectsInvalidSpans(t *testing.T) {
+	conf := &bunapp.AppConfig{
+		Projects: []bunapp.Project{{ID: 1}},
+	}
+	conf.SpanLimits.AttrCountLimit = 128
+	conf.SpanLimits.EventCountLimit = 128
+	conf.SpanLimits.LinkCountLimit = 128
+
+	validSpan := func() *tracepb.Span {
+		return &tracepb.Span{
+			TraceId:           []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+			SpanId:            []byte{1, 2, 3, 4, 5, 6, 7, 8},
+			Name:              "GET /users",
+			StartTimeUnixNano: 1,
+			EndTimeUnixNano:   2,
+		}
+	}
+
+	noTraceID := validSpan()
+	noTraceID.Name = "no trace id"
+	noTraceID.TraceId = make([]byte, 16)
+	shortSpanID := validSpan()
+	shortSpanID.SpanId = []byte{1}
+	noTime := validSpan()
+	noTime.StartTimeUnixNano = 0
+	oversize := validSpan()
+	oversize.Attributes = []*commonpb.KeyValue{{
+		Key: "http.response.body",
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{
+			StringValue: strings.Repeat("x", maxSpanAttrValueSize+1),
+		}},
+	}}
+
+	var names []string
+	rejected := walkOTLPSpans(conf, &conf.Projects[0], []*tracepb.ResourceSpans{{
+		InstrumentationLibrarySpans: []*tracepb.InstrumentationLibrarySpans{{
+			Spans: []*tracepb.Span{noTraceID, validSpan(), shortSpanID, noTime, oversize},
+		}},
+	}}, func(span otlpSpan) {
+		names = append(names, span.Name)
+	})
+
+	require.Equal(t, []string{"GET /users"}, names)
+	require.Equal(t, int64(4), rejected.count)
+	require.Equal(t,
+		`rejected 4 spans, the first error: span "no trace id": `+
+			`invalid trace id: 00000000000000000000000000000000`,
+		rejected.message())
+
+	resp := new(collectortrace.ExportTraceServiceResponse)
+	resp.ProtoReflect().SetUnknown(rejected.partialSuccess())
+	b, err := proto.Marshal(resp)
+	require.NoError(t, err)
+
+	num, typ, n := protowire.ConsumeTag(b)
+	require.Equal(t, protowire.Number(1), num)
+	require.Equal(t, protowire.BytesType, typ)
+	msg, _ := protowire.ConsumeBytes(b[n:])
+	num, _, n = protowire.ConsumeTag(msg)
+	require.Equal(t, protowire.Number(1), num)
+	count, _ := protowire.ConsumeVarint(msg[n:])
+	require.Equal(t, uint64(4), count)
+
+	b, err = json.Marshal(rejected.partialSuccessJSON())
+	require.NoError(t, err)
+	require.Contains(t, string(b), `{"partialSuccess":{"rejectedSpans":"4","errorMessage":"rejected 4 spans`)
+
+	b, err = json.Marshal(new(rejectedSpans).partialSuccessJSON())
+	require.NoError(t, err)
+	require.Equal(t, `{}`, string(b))
+}
@@ -0,0 +1,282 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/vmihailenco/msgpack"
+	"go.uber.org/zap"
+)
+
+const walFileExt = ".wal"
+
+// walSpanStorage writes batches that the wrapped storage fails to insert to the
+// span_wal.dir directory and inserts them again in the background. Batches are
+// inserted at least once: a batch that partially failed is inserted again in full.
+type walSpanStorage struct {
+	SpanStorage
+
+	app     *bunapp.App
+	dir     string
+	maxSize int64
+
+	mu      sync.Mutex
+	seq     uint64
+	size    int64
+	batches int
+
+	droppedSpans int64
+}
+
+// walSpan keeps the span index fields that can't be restored from the span data.
+type walSpan struct {
+	Data []byte
+
+	ServiceKey      string
+	Count           float32
+	LinkCount       uint8
+	EventCount      uint8
+	EventErrorCount uint8
+	EventLogCount   uint8
+	ApdexLevel      string
+}
+
+func newWALSpanStorage(app *bunapp.App, storage SpanStorage) (*walSpanStorage, error) {
+	conf := &app.Config().SpanWAL
+	s := &walSpanStorage{
+		SpanStorage: storage,
+		app:         app,
+		dir:         conf.Dir,
+		maxSize:     conf.MaxSize,
+	}
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("span_wal: %w", err)
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return nil, fmt.Errorf("span_wal: %w", err)
+	}
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("span_wal: %w", err)
+		}
+		s.size += fi.Size()
+		s.batches++
+	}
+
+	return s, nil
+}
+
+func (s *walSpanStorage) InsertSpans(ctx context.Context, index []SpanIndex, data []SpanData) error {
+	err := s.SpanStorage.InsertSpans(ctx, index, data)
+	if err == nil {
+		return nil
+	}
+
+	if walErr := s.write(index, data); walErr != nil {
+		atomic.AddInt64(&s.droppedSpans, int64(len(index)))
+		return fmt.Errorf("%w (span_wal: %s)", err, walErr)
+	}
+
+	s.app.Zap(ctx).Warn("SpanStorage.InsertSpans failed, spans are stored in span_wal",
+		zap.Int("spans", len(index)), zap.Error(err))
+	return nil
+}
+
+func (s *walSpanStorage) write(index []SpanIndex, data []SpanData) error {
+	spans := make([]walSpan, len(index))
+	for i := range index {
+		src := &index[i]
+		spans[i] = walSpan{
+			Data:            data[i].Data,
+			ServiceKey:      src.ServiceKey,
+			Count:           src.Count,
+			LinkCount:       src.LinkCount,
+			EventCount:      src.EventCount,
+			EventErrorCount: src.EventErrorCount,
+			EventLogCount:   src.EventLogCount,
+			ApdexLevel:      src.ApdexLevel,
+		}
+	}
+
+	b, err := msgpack.Marshal(spans)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size+int64(len(b)) > s.maxSize {
+		return fmt.Errorf("max_size %d is reached", s.maxSize)
+	}
+
+	s.seq++
+	// Names sort in the order the batches were written.
+	name := fmt.Sprintf("%020d-%020d", time.Now().UnixNano(), s.seq)
+	path := filepath.Join(s.dir, name+walFileExt)
+	tmpPath := filepath.Join(s.dir, name+".tmp")
+
+	if err := os.WriteFile(tmpPath, b, 0o644); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	s.size += int64(len(b))
+	s.batches++
+	return nil
+}
+
+// Run replays the stored batches every replay_interval until the app is stopped.
+func (s *walSpanStorage) Run(ctx context.Context, app *bunapp.App) error {
+	app.WaitGroup().Add(1)
+	go func() {
+		defer app.WaitGroup().Done()
+
+		ticker := time.NewTicker(app.Config().SpanWAL.ReplayInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-app.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if err := s.Replay(app.Context()); err != nil {
+				app.Zap(ctx).Warn("span_wal replay failed", zap.Error(err))
+			}
+		}
+	}()
+	return nil
+}
+
+// Replay inserts the stored batches in the order they were written and stops
+// on the first failed insert.
+func (s *walSpanStorage) Replay(ctx context.Context) error {
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		index, data, err := decodeWALBatch(b)
+		if err != nil {
+			s.app.Zap(ctx).Error("removing corrupted span_wal file",
+				zap.String("file", file), zap.Error(err))
+		} else if err := s.SpanStorage.InsertSpans(ctx, index, data); err != nil {
+			return err
+		}
+
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		s.size -= int64(len(b))
+		s.batches--
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+func decodeWALBatch(b []byte) ([]SpanIndex, []SpanData, error) {
+	var walSpans []walSpan
+	if err := msgpack.Unmarshal(b, &walSpans); err != nil {
+		return nil, nil, err
+	}
+
+	spans := make([]Span, len(walSpans))
+	index := make([]SpanIndex, len(walSpans))
+	data := make([]SpanData, len(walSpans))
+
+	for i := range walSpans {
+		src := &walSpans[i]
+		span := &spans[i]
+
+		if err := unmarshalSpan(src.Data, span); err != nil {
+			return nil, nil, err
+		}
+
+		dest := &index[i]
+		newSpanIndex(dest, span)
+		dest.ServiceKey = src.ServiceKey
+		dest.Count = src.Count
+		dest.LinkCount = src.LinkCount
+		dest.EventCount = src.EventCount
+		dest.EventErrorCount = src.EventErrorCount
+		dest.EventLogCount = src.EventLogCount
+		dest.ApdexLevel = src.ApdexLevel
+
+		data[i] = SpanData{
+			TraceID:  span.TraceID,
+			ID:       span.ID,
+			ParentID: span.ParentID,
+			Time:     span.Time,
+			Data:     src.Data,
+		}
+	}
+
+	return index, data, nil
+}
+
+// files returns the stored batches sorted by name. Leftover temporary files of
+// interrupted writes are removed.
+func (s *walSpanStorage) files() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case strings.HasSuffix(name, walFileExt):
+			files = append(files, filepath.Join(s.dir, name))
+		case strings.HasSuffix(name, ".tmp"):
+			s.mu.Lock()
+			_ = os.Remove(filepath.Join(s.dir, name))
+			s.mu.Unlock()
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+type walStats struct {
+	batches      int
+	size         int64
+	droppedSpans int
+}
+
+func (s *walSpanStorage) stats() walStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return walStats{
+		batches:      s.batches,
+		size:         s.size,
+		droppedSpans: int(atomic.LoadInt64(&s.droppedSpans)),
+	}
+}
@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+func TestWALSpanStorage(t *testing.T) {
+	ctx := context.Background()
+
+	conf := &bunapp.AppConfig{}
+	conf.CH.DSN = "clickhouse://default:@localhost:9000/uptrace?sslmode=disable"
+	conf.SpanWAL.Dir = t.TempDir()
+	conf.SpanWAL.MaxSize = 1 << 20
+
+	app := bunapp.New(ctx, conf)
+	t.Cleanup(func() {
+		app.Stop()
+		app.WaitGroup().Wait()
+	})
+
+	span := &Span{
+		ProjectID: 1,
+		TraceID:   uuid.New(),
+		ID:        1,
+		Name:      "GET /users",
+		Time:      time.Unix(1600000000, 0).UTC(),
+		Attrs:     AttrMap{"service.name": "users"},
+	}
+	index := make([]SpanIndex, 1)
+	newSpanIndex(&index[0], span)
+	index[0].ServiceKey = "shop/users"
+	index[0].ApdexLevel = "satisfied"
+	data := make([]SpanData, 1)
+	newSpanData(&data[0], span)
+
+	inner := &failingSpanStorage{fail: true}
+	wal, err := newWALSpanStorage(app, inner)
+	require.NoError(t, err)
+
+	require.NoError(t, wal.InsertSpans(ctx, index, data))
+	require.NoError(t, wal.InsertSpans(ctx, index, data))
+	stats := wal.stats()
+	require.Equal(t, 2, stats.batches)
+	require.Greater(t, stats.size, int64(0))
+
+	// The stored batches are restored after a restart.
+	wal, err = newWALSpanStorage(app, inner)
+	require.NoError(t, err)
+	require.Equal(t, stats, wal.stats())
+
+	files, err := wal.files()
+	require.NoError(t, err)
+	b, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	index, data, err = decodeWALBatch(b)
+	require.NoError(t, err)
+	require.Equal(t, "users", index[0].ServiceName)
+	require.Equal(t, "shop/users", index[0].ServiceKey)
+	require.Equal(t, "satisfied", index[0].ApdexLevel)
+	require.Equal(t, span.TraceID, data[0].TraceID)
+
+	require.Error(t, wal.Replay(ctx))
+	require.Equal(t, 2, wal.stats().batches)
+
+	inner.fail = false
+	require.NoError(t, wal.Replay(ctx))
+	require.Equal(t, walStats{}, wal.stats())
+	require.Equal(t, int64(2), inner.spans)
+
+	// Batches are dropped when the directory is full.
+	wal.maxSize = 1
+	inner.fail = true
+	require.Error(t, wal.InsertSpans(ctx, index, data))
+	require.Equal(t, walStats{droppedSpans: 1}, wal.stats())
+}
+
+// failingSpanStorage fails inserts while fail is set.
+type failingSpanStorage struct {
+	countingSpanStorage
+	fail bool
+}
+
+func (s *failingSpanStorage) InsertSpans(
+	ctx context.Context, index []SpanIndex, data []SpanData,
+) error {
+	if s.fail {
+		return errors.New("span storage is unavailable")
+	}
+	return s.countingSpanStorage.InsertSpans(ctx, index, data)
+}
@@ -0,0 +1,310 @@
+package tracing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+const (
+	statsdCounter = "c"
+	statsdGauge   = "g"
+	statsdTimer   = "ms"
+	statsdHisto   = "h"
+	statsdDistrib = "d"
+	statsdSet     = "s"
+)
+
+// statsdTimerQuantiles are reported for timers, histograms, and distributions.
+var statsdTimerQuantiles = []float64{0, 0.5, 0.9, 0.99, 1}
+
+// statsdResourceTags are DogStatsD tags that describe the resource.
+var statsdResourceTags = map[string]string{
+	"service": xattr.ServiceName,
+	"host":    xattr.HostName,
+	"env":     "deployment.environment",
+	"version": "service.version",
+}
+
+type statsdSample struct {
+	Name string
+	Type string
+	// Value is empty for sets.
+	Value float64
+	// Gauge values with a sign are added to the current value.
+	Delta bool
+	// SetValue is the member of a set.
+	SetValue   string
+	SampleRate float64
+	Tags       []string
+}
+
+// parseStatsdLine parses "<name>:<value>|<type>[|@<sample rate>][|#<tag>,<tag>]" where
+// tags are "key:value" or "key" as sent by DogStatsD clients.
+func parseStatsdLine(line string) (*statsdSample, error) {
+	idx := strings.IndexByte(line, ':')
+	if idx <= 0 {
+		return nil, fmt.Errorf("statsd: metric name is missing: %q", line)
+	}
+	sample := &statsdSample{
+		Name:       line[:idx],
+		SampleRate: 1,
+	}
+
+	parts := strings.Split(line[idx+1:], "|")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("statsd: metric type is missing: %q", line)
+	}
+	value := parts[0]
+	sample.Type = parts[1]
+
+	for _, part := range parts[2:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			rate, err := strconv.ParseFloat(part[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("statsd: invalid sample rate: %q", part)
+			}
+			sample.SampleRate = rate
+		case strings.HasPrefix(part, "#"):
+			for _, tag := range strings.Split(part[1:], ",") {
+				if tag != "" {
+					sample.Tags = append(sample.Tags, tag)
+				}
+			}
+		}
+	}
+
+	switch sample.Type {
+	case statsdSet:
+		sample.SetValue = value
+		return sample, nil
+	case statsdCounter, statsdGauge, statsdTimer, statsdHisto, statsdDistrib:
+	default:
+		return nil, fmt.Errorf("statsd: unsupported metric type: %q", sample.Type)
+	}
+
+	if value == "" {
+		return nil, errors.New("statsd: metric value is missing")
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("statsd: invalid metric value: %q", value)
+	}
+	sample.Value = f
+	sample.Delta = sample.Type == statsdGauge && (value[0] == '+' || value[0] == '-')
+
+	return sample, nil
+}
+
+//------------------------------------------------------------------------------
+
+type statsdMetric struct {
+	name string
+	typ  string
+	tags []string
+
+	value  float64
+	values []float64
+	weight float64
+	set    map[string]struct{}
+}
+
+// statsdAggregator aggregates samples between flushes like the StatsD daemon does:
+// counters and sets are reset after each flush while gauges keep the last value.
+type statsdAggregator struct {
+	mu        sync.Mutex
+	metrics   map[string]*statsdMetric
+	startTime time.Time
+}
+
+func newStatsdAggregator(now time.Time) *statsdAggregator {
+	return &statsdAggregator{
+		metrics:   make(map[string]*statsdMetric),
+		startTime: now,
+	}
+}
+
+func (a *statsdAggregator) Add(sample *statsdSample) {
+	tags := append([]string(nil), sample.Tags...)
+	sort.Strings(tags)
+
+	typ := sample.Type
+	if typ == statsdHisto || typ == statsdDistrib {
+		typ = statsdTimer
+	}
+	key := sample.Name + "|" + typ + "|" + strings.Join(tags, ",")
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	metric, ok := a.metrics[key]
+	if !ok {
+		metric = &statsdMetric{
+			name: sample.Name,
+			typ:  typ,
+			tags: tags,
+		}
+		a.metrics[key] = metric
+	}
+
+	switch typ {
+	case statsdCounter:
+		metric.value += sample.Value / sample.SampleRate
+	case statsdGauge:
+		if sample.Delta {
+			metric.value += sample.Value
+		} else {
+			metric.value = sample.Value
+		}
+	case statsdTimer:
+		metric.values = append(metric.values, sample.Value)
+		metric.weight += 1 / sample.SampleRate
+	case statsdSet:
+		if metric.set == nil {
+			metric.set = make(map[string]struct{})
+		}
+		metric.set[sample.SetValue] = struct{}{}
+	}
+}
+
+// Flush returns the aggregated metrics grouped by resource and resets the aggregator.
+func (a *statsdAggregator) Flush(now time.Time) []*metricspb.ResourceMetrics {
+	a.mu.Lock()
+	metrics := a.metrics
+	startTime := a.startTime
+	a.metrics = make(map[string]*statsdMetric)
+	a.startTime = now
+	for key, metric := range metrics {
+		if metric.typ == statsdGauge {
+			a.metrics[key] = metric
+		}
+	}
+	a.mu.Unlock()
+
+	keys := make([]string, 0, len(metrics))
+	for key := range metrics {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var resourceMetrics []*metricspb.ResourceMetrics
+	index := make(map[string]int)
+
+	for _, key := range keys {
+		metric := metrics[key]
+
+		var resource, attrs []*commonpb.KeyValue
+		var resourceKey strings.Builder
+		for _, tag := range metric.tags {
+			k, v := tag, ""
+			if i := strings.IndexByte(tag, ':'); i >= 0 {
+				k, v = tag[:i], tag[i+1:]
+			}
+			if attrKey, ok := statsdResourceTags[k]; ok {
+				resource = append(resource, otlpStringAttr(attrKey, v))
+				resourceKey.WriteString(tag + ",")
+				continue
+			}
+			attrs = append(attrs, otlpStringAttr(k, v))
+		}
+
+		idx, ok := index[resourceKey.String()]
+		if !ok {
+			idx = len(resourceMetrics)
+			index[resourceKey.String()] = idx
+			resourceMetrics = append(resourceMetrics, &metricspb.ResourceMetrics{
+				Resource: &resourcepb.Resource{Attributes: resource},
+				InstrumentationLibraryMetrics: []*metricspb.InstrumentationLibraryMetrics{{
+					InstrumentationLibrary: &commonpb.InstrumentationLibrary{Name: "statsd"},
+				}},
+			})
+		}
+
+		ilm := resourceMetrics[idx].InstrumentationLibraryMetrics[0]
+		ilm.Metrics = append(ilm.Metrics, metric.otlpMetric(attrs, startTime, now))
+	}
+
+	return resourceMetrics
+}
+
+func (m *statsdMetric) otlpMetric(
+	attrs []*commonpb.KeyValue, startTime, now time.Time,
+) *metricspb.Metric {
+	numberDataPoint := func(value float64) []*metricspb.NumberDataPoint {
+		return []*metricspb.NumberDataPoint{{
+			Attributes:        attrs,
+			StartTimeUnixNano: uint64(startTime.UnixNano()),
+			TimeUnixNano:      uint64(now.UnixNano()),
+			Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+		}}
+	}
+
+	metric := &metricspb.Metric{Name: m.name}
+
+	switch m.typ {
+	case statsdCounter:
+		metric.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+			IsMonotonic:            true,
+			DataPoints:             numberDataPoint(m.value),
+		}}
+	case statsdGauge:
+		metric.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+			DataPoints: numberDataPoint(m.value),
+		}}
+	case statsdSet:
+		metric.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+			DataPoints: numberDataPoint(float64(len(m.set))),
+		}}
+	case statsdTimer:
+		metric.Unit = "ms"
+		metric.Data = &metricspb.Metric_Summary{Summary: &metricspb.Summary{
+			DataPoints: []*metricspb.SummaryDataPoint{m.summaryDataPoint(attrs, startTime, now)},
+		}}
+	}
+
+	return metric
+}
+
+// summaryDataPoint scales the count and the sum by the sample rate so they estimate
+// all observations.
+func (m *statsdMetric) summaryDataPoint(
+	attrs []*commonpb.KeyValue, startTime, now time.Time,
+) *metricspb.SummaryDataPoint {
+	sort.Float64s(m.values)
+
+	var sum float64
+	for _, v := range m.values {
+		sum += v
+	}
+
+	dp := &metricspb.SummaryDataPoint{
+		Attributes:        attrs,
+		StartTimeUnixNano: uint64(startTime.UnixNano()),
+		TimeUnixNano:      uint64(now.UnixNano()),
+		Count:             uint64(math.Round(m.weight)),
+		Sum:               sum * m.weight / float64(len(m.values)),
+	}
+	for _, q := range statsdTimerQuantiles {
+		idx := int(math.Ceil(q*float64(len(m.values)))) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		dp.QuantileValues = append(dp.QuantileValues, &metricspb.SummaryDataPoint_ValueAtQuantile{
+			Quantile: q,
+			Value:    m.values[idx],
+		})
+	}
+	return dp
+}
@@ -0,0 +1,139 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/org"
+	"go.uber.org/zap"
+)
+
+// StatsdServer receives StatsD and DogStatsD metrics over UDP, aggregates them,
+// and sends the aggregates to MetricsServiceServer every statsd.flush_interval.
+type StatsdServer struct {
+	*bunapp.App
+
+	metricsService *MetricsServiceServer
+	agg            *statsdAggregator
+}
+
+func NewStatsdServer(app *bunapp.App, metricsService *MetricsServiceServer) *StatsdServer {
+	return &StatsdServer{
+		App:            app,
+		metricsService: metricsService,
+		agg:            newStatsdAggregator(time.Now()),
+	}
+}
+
+func (s *StatsdServer) project(ctx context.Context) (*bunapp.Project, error) {
+	projectID := s.Config().Statsd.ProjectID
+	if projectID == 0 {
+		return nil, errors.New("statsd.project_id option is required")
+	}
+	return org.SelectIngestProjectByID(ctx, s.App, projectID)
+}
+
+func (s *StatsdServer) ListenUDP(ctx context.Context, app *bunapp.App) error {
+	addr := app.Config().Listen.Statsd
+	if addr == "" {
+		return nil
+	}
+
+	project, err := s.project(ctx)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		app.Zap(ctx).Error("net.ListenPacket failed (edit listen.statsd YAML option)",
+			zap.Error(err), zap.String("addr", addr))
+		return err
+	}
+
+	app.OnStop("statsd.Close", func(ctx context.Context, _ *bunapp.App) error {
+		return conn.Close()
+	})
+
+	app.WaitGroup().Add(2)
+	go func() {
+		defer app.WaitGroup().Done()
+
+		s.serveUDP(ctx, conn)
+	}()
+	go func() {
+		defer app.WaitGroup().Done()
+
+		s.flushLoop(project)
+	}()
+
+	return nil
+}
+
+func (s *StatsdServer) serveUDP(ctx context.Context, conn net.PacketConn) {
+	buf := make([]byte, 64<<10)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.Zap(ctx).Error("statsd: ReadFrom failed", zap.Error(err))
+			continue
+		}
+
+		s.handlePacket(ctx, buf[:n])
+	}
+}
+
+// handlePacket handles a datagram with one or more newline-separated metrics.
+func (s *StatsdServer) handlePacket(ctx context.Context, b []byte) {
+	for len(b) > 0 {
+		var line []byte
+		if idx := bytes.IndexByte(b, '\n'); idx >= 0 {
+			line, b = b[:idx], b[idx+1:]
+		} else {
+			line, b = b, nil
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		sample, err := parseStatsdLine(string(line))
+		if err != nil {
+			s.Zap(ctx).Error("statsd: invalid metric", zap.Error(err))
+			continue
+		}
+		s.agg.Add(sample)
+	}
+}
+
+func (s *StatsdServer) flushLoop(project *bunapp.Project) {
+	ticker := time.NewTicker(s.Config().Statsd.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.flush(project)
+		case <-s.Done():
+			// MetricsServiceServer stops processing on shutdown so the last
+			// interval is dropped.
+			return
+		}
+	}
+}
+
+func (s *StatsdServer) flush(project *bunapp.Project) {
+	if resourceMetrics := s.agg.Flush(time.Now()); len(resourceMetrics) > 0 {
+		if err := s.metricsService.process(project, resourceMetrics); err != nil {
+			s.Zap(s.Context()).Error("statsd: metrics are rejected", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+func TestParseStatsdLine(t *testing.T) {
+	sample, err := parseStatsdLine("page.views:2|c|@0.5|#service:web,route:/home")
+	require.NoError(t, err)
+	require.Equal(t, &statsdSample{
+		Name:       "page.views",
+		Type:       statsdCounter,
+		Value:      2,
+		SampleRate: 0.5,
+		Tags:       []string{"service:web", "route:/home"},
+	}, sample)
+
+	sample, err = parseStatsdLine("queue.size:-3|g")
+	require.NoError(t, err)
+	require.True(t, sample.Delta)
+	require.Equal(t, float64(-3), sample.Value)
+
+	sample, err = parseStatsdLine("users.unique:alice|s")
+	require.NoError(t, err)
+	require.Equal(t, "alice", sample.SetValue)
+
+	for _, line := range []string{"no-value", "name:1", "name:1|x", "name:abc|c", "name:1|c|@2"} {
+		_, err := parseStatsdLine(line)
+		require.Error(t, err, line)
+	}
+}
+
+func TestStatsdAggregator(t *testing.T) {
+	startTime := time.Unix(1000, 0)
+	agg := newStatsdAggregator(startTime)
+
+	for _, line := range []string{
+		"requests:1|c|#service:web,code:200",
+		"requests:1|c|@0.1|#code:200,service:web",
+		"queue.size:10|g",
+		"queue.size:+5|g",
+		"latency:10|ms",
+		"latency:30|ms",
+		"latency:20|h",
+		"users:alice|s",
+		"users:bob|s",
+		"users:alice|s",
+	} {
+		sample, err := parseStatsdLine(line)
+		require.NoError(t, err)
+		agg.Add(sample)
+	}
+
+	now := startTime.Add(10 * time.Second)
+	rms := agg.Flush(now)
+	require.Len(t, rms, 2)
+
+	metrics := make(map[string]*metricspb.Metric)
+	for _, rm := range rms {
+		for _, metric := range rm.InstrumentationLibraryMetrics[0].Metrics {
+			metrics[metric.Name] = metric
+		}
+	}
+
+	require.Equal(t, "web", otlpAttrs(rms[1].Resource.Attributes).ServiceName())
+	sum := metrics["requests"].GetSum()
+	require.True(t, sum.IsMonotonic)
+	require.Equal(t, float64(11), numberValue(sum.DataPoints[0]))
+	require.Equal(t, "200", otlpAttrs(sum.DataPoints[0].Attributes).Text("code"))
+	require.Equal(t, uint64(startTime.UnixNano()), sum.DataPoints[0].StartTimeUnixNano)
+
+	require.Equal(t, float64(15), numberValue(metrics["queue.size"].GetGauge().DataPoints[0]))
+	require.Equal(t, float64(2), numberValue(metrics["users"].GetGauge().DataPoints[0]))
+
+	summary := metrics["latency"].GetSummary().DataPoints[0]
+	require.Equal(t, uint64(3), summary.Count)
+	require.Equal(t, float64(60), summary.Sum)
+	require.Equal(t, float64(10), summary.QuantileValues[0].Value)
+	require.Equal(t, float64(20), summary.QuantileValues[1].Value)
+	require.Equal(t, float64(30), summary.QuantileValues[4].Value)
+
+	// Only gauges are reported again.
+	rms = agg.Flush(now.Add(10 * time.Second))
+	require.Len(t, rms, 1)
+	require.Len(t, rms[0].InstrumentationLibraryMetrics[0].Metrics, 1)
+	require.Equal(t, "queue.size", rms[0].InstrumentationLibraryMetrics[0].Metrics[0].Name)
+}
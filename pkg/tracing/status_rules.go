@@ -0,0 +1,27 @@
+package tracing
+
+import (
+	"github.com/uptrace/uptrace/pkg/bunapp"
+)
+
+// applyStatusRules overrides the span status code using the first matching project rule,
+// for example, to treat 404 responses of some routes as expected.
+func applyStatusRules(project *bunapp.Project, span *Span) {
+	for i := range project.StatusRules {
+		rule := &project.StatusRules[i]
+		if statusRuleMatches(rule, span) {
+			span.StatusCode = rule.Status
+			return
+		}
+	}
+}
+
+func statusRuleMatches(rule *bunapp.StatusRule, span *Span) bool {
+	for key, value := range rule.Attrs {
+		attr, ok := span.Attrs[key]
+		if !ok || asString(attr) != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,35 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestApplyStatusRules(t *testing.T) {
+	project := new(bunapp.Project)
+	require.NoError(t, yaml.Unmarshal([]byte(`
+status_rules:
+  - attrs: { http.status_code: 404, http.route: /users/:id }
+    status: ok
+  - attrs: { rpc.grpc.status_code: 14 }
+    status: error
+`), project))
+
+	span := &Span{StatusCode: errorStatusCode, Attrs: AttrMap{
+		"http.status_code": int64(404),
+		"http.route":       "/users/:id",
+	}}
+	applyStatusRules(project, span)
+	require.Equal(t, okStatusCode, span.StatusCode)
+
+	span = &Span{StatusCode: okStatusCode, Attrs: AttrMap{"rpc.grpc.status_code": int64(14)}}
+	applyStatusRules(project, span)
+	require.Equal(t, errorStatusCode, span.StatusCode)
+
+	span = &Span{StatusCode: errorStatusCode, Attrs: AttrMap{"http.status_code": int64(404)}}
+	applyStatusRules(project, span)
+	require.Equal(t, errorStatusCode, span.StatusCode)
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/httperror"
 	"github.com/uptrace/uptrace/pkg/httputil"
 	"github.com/uptrace/uptrace/pkg/uql"
 
@@ -70,9 +71,12 @@ func (h *SuggestionHandler) Attributes(w http.ResponseWriter, req bunrouter.Requ
 		return err
 	}
 
-	suggestions := make([]Suggestion, len(attrKeys))
-	for i, key := range attrKeys {
-		suggestions[i] = Suggestion{Text: key}
+	suggestions := make([]Suggestion, 0, len(attrKeys))
+	for _, key := range attrKeys {
+		if f.attrPolicy.Hidden(key) {
+			continue
+		}
+		suggestions = append(suggestions, Suggestion{Text: key})
 	}
 	suggestions = sortSuggestions(suggestions)
 
@@ -107,9 +111,12 @@ func (h *SuggestionHandler) Values(w http.ResponseWriter, req bunrouter.Request)
 	if err != nil {
 		return err
 	}
+	if f.attrPolicy.Restricted(colName.AttrKey) {
+		return httperror.Forbidden("access to %q is restricted", colName.AttrKey)
+	}
 
 	q := buildSpanIndexQuery(f, 0)
-	q = uqlColumn(q, colName, 0).Group(f.Column)
+	q = uqlColumn(q, colName, f.uqlContext(0)).Group(f.Column)
 	if !strings.HasPrefix(f.Column, "span.") {
 		q = q.Where("has(attr_keys, ?)", f.Column)
 	}
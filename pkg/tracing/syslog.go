@@ -0,0 +1,264 @@
+package tracing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+const (
+	syslogFacility = "syslog.facility"
+	syslogMsgID    = "syslog.msgid"
+	// Structured data params are stored as syslog.sd.<sd-id>.<param-name>.
+	syslogSDPrefix = "syslog.sd."
+)
+
+type syslogMessage struct {
+	Facility int
+	Severity int
+	Time     time.Time
+	Hostname string
+	AppName  string
+	ProcID   string
+	MsgID    string
+	// Structured data params by SD-ID.
+	StructuredData map[string]map[string]string
+	Message        string
+}
+
+// parseSyslogMessage parses RFC 5424 messages and BSD syslog messages described in
+// RFC 3164. BSD messages don't have a year and a time zone so the local time zone and
+// the current year are used.
+func parseSyslogMessage(b []byte, now time.Time) (*syslogMessage, error) {
+	b = bytes.TrimRight(b, "\r\n\x00")
+
+	if len(b) < 3 || b[0] != '<' {
+		return nil, errors.New("syslog: PRI is missing")
+	}
+	end := bytes.IndexByte(b, '>')
+	if end == -1 || end > 4 {
+		return nil, errors.New("syslog: invalid PRI")
+	}
+	pri, err := strconv.Atoi(string(b[1:end]))
+	if err != nil || pri < 0 || pri > 191 {
+		return nil, fmt.Errorf("syslog: invalid PRI: %q", b[1:end])
+	}
+	b = b[end+1:]
+
+	msg := &syslogMessage{
+		Facility: pri / 8,
+		Severity: pri % 8,
+	}
+
+	if len(b) >= 2 && b[0] == '1' && b[1] == ' ' {
+		if err := parseRFC5424(msg, string(b[2:])); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+
+	parseRFC3164(msg, string(b), now)
+	return msg, nil
+}
+
+func parseRFC5424(msg *syslogMessage, s string) error {
+	var fields [5]string
+	for i := range fields {
+		idx := strings.IndexByte(s, ' ')
+		if idx == -1 {
+			return errors.New("syslog: RFC 5424 header is truncated")
+		}
+		fields[i], s = s[:idx], s[idx+1:]
+		if fields[i] == "-" {
+			fields[i] = ""
+		}
+	}
+
+	if fields[0] != "" {
+		tm, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return fmt.Errorf("syslog: invalid timestamp: %w", err)
+		}
+		msg.Time = tm
+	}
+	msg.Hostname = fields[1]
+	msg.AppName = fields[2]
+	msg.ProcID = fields[3]
+	msg.MsgID = fields[4]
+
+	switch {
+	case s == "-" || strings.HasPrefix(s, "- "):
+		s = strings.TrimPrefix(s, "-")
+	case strings.HasPrefix(s, "["):
+		var err error
+		s, err = parseSyslogSD(msg, s)
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.New("syslog: STRUCTURED-DATA is missing")
+	}
+
+	s = strings.TrimPrefix(s, " ")
+	s = strings.TrimPrefix(s, "\ufeff")
+	msg.Message = s
+	return nil
+}
+
+// parseSyslogSD parses elements like [exampleSDID@32473 iut="3" eventSource="App"]
+// and returns the rest of the message.
+func parseSyslogSD(msg *syslogMessage, s string) (string, error) {
+	msg.StructuredData = make(map[string]map[string]string)
+
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+
+		idx := strings.IndexAny(s, " ]")
+		if idx <= 0 {
+			return "", errors.New("syslog: invalid SD-ID")
+		}
+		params := make(map[string]string)
+		msg.StructuredData[s[:idx]] = params
+		s = s[idx:]
+
+		for {
+			s = strings.TrimLeft(s, " ")
+			if strings.HasPrefix(s, "]") {
+				s = s[1:]
+				break
+			}
+
+			idx := strings.Index(s, `="`)
+			if idx <= 0 {
+				return "", errors.New("syslog: invalid SD-PARAM")
+			}
+			name := s[:idx]
+			s = s[idx+2:]
+
+			var value strings.Builder
+			for {
+				if s == "" {
+					return "", errors.New("syslog: SD-PARAM value is not terminated")
+				}
+				c := s[0]
+				s = s[1:]
+				if c == '"' {
+					break
+				}
+				// Only ", \, and ] are escaped.
+				if c == '\\' && s != "" && strings.IndexByte(`"\]`, s[0]) != -1 {
+					c = s[0]
+					s = s[1:]
+				}
+				value.WriteByte(c)
+			}
+			params[name] = value.String()
+		}
+	}
+
+	return s, nil
+}
+
+// parseRFC3164 parses "Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG". Parts that don't
+// match the format become the message.
+func parseRFC3164(msg *syslogMessage, s string, now time.Time) {
+	const stampLen = len(time.Stamp)
+
+	if len(s) >= stampLen+1 && s[stampLen] == ' ' {
+		tm, err := time.ParseInLocation(time.Stamp, s[:stampLen], now.Location())
+		if err == nil {
+			tm = tm.AddDate(now.Year(), 0, 0)
+			// Messages sent on Dec 31 can be received on Jan 1.
+			if tm.After(now.Add(24 * time.Hour)) {
+				tm = tm.AddDate(-1, 0, 0)
+			}
+			msg.Time = tm
+			s = s[stampLen+1:]
+
+			if idx := strings.IndexByte(s, ' '); idx > 0 && !strings.HasSuffix(s[:idx], ":") {
+				msg.Hostname = s[:idx]
+				s = s[idx+1:]
+			}
+		}
+	}
+
+	if idx := strings.IndexByte(s, ':'); idx > 0 && strings.IndexByte(s[:idx], ' ') == -1 {
+		tag := s[:idx]
+		if i := strings.IndexByte(tag, '['); i > 0 && strings.HasSuffix(tag, "]") {
+			msg.ProcID = tag[i+1 : len(tag)-1]
+			tag = tag[:i]
+		}
+		msg.AppName = tag
+		s = strings.TrimPrefix(s[idx+1:], " ")
+	}
+
+	msg.Message = s
+}
+
+// syslogSeverity maps syslog severities to the short severity names of logs.
+func syslogSeverity(severity int) string {
+	switch severity {
+	case 0, 1, 2: // emergency, alert, critical
+		return "FATAL"
+	case 3:
+		return "ERROR"
+	case 4:
+		return "WARN"
+	case 5, 6: // notice, informational
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
+
+func syslogResourceLogs(msg *syslogMessage) *logspb.ResourceLogs {
+	var resource []*commonpb.KeyValue
+	if msg.Hostname != "" {
+		resource = append(resource, otlpStringAttr(xattr.HostName, msg.Hostname))
+	}
+	if msg.AppName != "" {
+		resource = append(resource, otlpStringAttr(xattr.ServiceName, msg.AppName))
+	}
+	if msg.ProcID != "" {
+		if pid, err := strconv.ParseInt(msg.ProcID, 10, 64); err == nil {
+			resource = append(resource, otlpIntAttr("process.pid", pid))
+		}
+	}
+
+	record := &logspb.LogRecord{
+		SeverityText: syslogSeverity(msg.Severity),
+		Body: &commonpb.AnyValue{
+			Value: &commonpb.AnyValue_StringValue{StringValue: msg.Message},
+		},
+		Attributes: []*commonpb.KeyValue{
+			otlpIntAttr(syslogFacility, int64(msg.Facility)),
+		},
+	}
+	if !msg.Time.IsZero() {
+		record.TimeUnixNano = uint64(msg.Time.UnixNano())
+	}
+	if msg.MsgID != "" {
+		record.Attributes = append(record.Attributes, otlpStringAttr(syslogMsgID, msg.MsgID))
+	}
+	for id, params := range msg.StructuredData {
+		for name, value := range params {
+			record.Attributes = append(record.Attributes,
+				otlpStringAttr(syslogSDPrefix+id+"."+name, value))
+		}
+	}
+
+	return &logspb.ResourceLogs{
+		Resource: &resourcepb.Resource{Attributes: resource},
+		InstrumentationLibraryLogs: []*logspb.InstrumentationLibraryLogs{{
+			LogRecords: []*logspb.LogRecord{record},
+		}},
+	}
+}
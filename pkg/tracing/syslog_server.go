@@ -0,0 +1,200 @@
+package tracing
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/org"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"go.uber.org/zap"
+)
+
+const syslogMaxMessageSize = 64 << 10
+
+// SyslogServer accepts RFC 5424 and RFC 3164 messages over UDP and TCP.
+type SyslogServer struct {
+	*bunapp.App
+
+	logsService *LogsServiceServer
+}
+
+func NewSyslogServer(app *bunapp.App, logsService *LogsServiceServer) *SyslogServer {
+	return &SyslogServer{
+		App:         app,
+		logsService: logsService,
+	}
+}
+
+func (s *SyslogServer) project(ctx context.Context) (*bunapp.Project, error) {
+	projectID := s.Config().Syslog.ProjectID
+	if projectID == 0 {
+		return nil, errors.New("syslog.project_id option is required")
+	}
+	return org.SelectIngestProjectByID(ctx, s.App, projectID)
+}
+
+func (s *SyslogServer) Listen(ctx context.Context, app *bunapp.App) error {
+	conf := &app.Config().Listen
+	if conf.SyslogUDP == "" && conf.SyslogTCP == "" {
+		return nil
+	}
+
+	project, err := s.project(ctx)
+	if err != nil {
+		return err
+	}
+
+	if addr := conf.SyslogUDP; addr != "" {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			app.Zap(ctx).Error("net.ListenPacket failed (edit listen.syslog_udp YAML option)",
+				zap.Error(err), zap.String("addr", addr))
+			return err
+		}
+
+		app.OnStop("syslog.CloseUDP", func(ctx context.Context, _ *bunapp.App) error {
+			return conn.Close()
+		})
+
+		app.WaitGroup().Add(1)
+		go func() {
+			defer app.WaitGroup().Done()
+
+			s.serveUDP(ctx, conn, project)
+		}()
+	}
+
+	if addr := conf.SyslogTCP; addr != "" {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			app.Zap(ctx).Error("net.Listen failed (edit listen.syslog_tcp YAML option)",
+				zap.Error(err), zap.String("addr", addr))
+			return err
+		}
+
+		app.OnStop("syslog.CloseTCP", func(ctx context.Context, _ *bunapp.App) error {
+			return ln.Close()
+		})
+
+		app.WaitGroup().Add(1)
+		go func() {
+			defer app.WaitGroup().Done()
+
+			s.serveTCP(ctx, ln, project)
+		}()
+	}
+
+	return nil
+}
+
+func (s *SyslogServer) serveUDP(ctx context.Context, conn net.PacketConn, project *bunapp.Project) {
+	buf := make([]byte, syslogMaxMessageSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.Zap(ctx).Error("syslog: ReadFrom failed", zap.Error(err))
+			continue
+		}
+
+		s.handleMessage(ctx, project, buf[:n])
+	}
+}
+
+func (s *SyslogServer) serveTCP(ctx context.Context, ln net.Listener, project *bunapp.Project) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.Zap(ctx).Error("syslog: Accept failed", zap.Error(err))
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		// Keep connections out of the app wait group because idle senders
+		// can keep them open forever.
+		go func() {
+			defer conn.Close()
+
+			err := readSyslogFrames(conn, func(b []byte) {
+				s.handleMessage(ctx, project, b)
+			})
+			if err != nil && !errors.Is(err, net.ErrClosed) {
+				s.Zap(ctx).Error("syslog: reading TCP stream failed", zap.Error(err))
+			}
+		}()
+	}
+}
+
+func (s *SyslogServer) handleMessage(ctx context.Context, project *bunapp.Project, b []byte) {
+	msg, err := parseSyslogMessage(b, time.Now())
+	if err != nil {
+		s.Zap(ctx).Error("syslog: invalid message", zap.Error(err))
+		return
+	}
+	if err := s.logsService.process(project, []*logspb.ResourceLogs{syslogResourceLogs(msg)}); err != nil {
+		s.Zap(ctx).Error("syslog: message is rejected", zap.Error(err))
+	}
+}
+
+// readSyslogFrames splits a TCP stream into messages as described in RFC 6587.
+// Frames that start with a digit use octet counting, for example, "11 <13>1 - - -",
+// and other frames are terminated by a newline.
+func readSyslogFrames(r io.Reader, fn func(b []byte)) error {
+	rd := bufio.NewReaderSize(r, syslogMaxMessageSize)
+	for {
+		c, err := rd.Peek(1)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		if c[0] < '0' || c[0] > '9' {
+			line, err := rd.ReadSlice('\n')
+			switch {
+			case err == bufio.ErrBufferFull:
+				return errors.New("syslog: message is too large")
+			case err == io.EOF:
+				if len(bytes.TrimSpace(line)) > 0 {
+					fn(line)
+				}
+				return nil
+			case err != nil:
+				return err
+			}
+			if len(bytes.TrimSpace(line)) > 0 {
+				fn(line)
+			}
+			continue
+		}
+
+		s, err := rd.ReadString(' ')
+		if err != nil {
+			return err
+		}
+		size, err := strconv.Atoi(s[:len(s)-1])
+		if err != nil || size <= 0 || size > syslogMaxMessageSize {
+			return fmt.Errorf("syslog: invalid frame length: %q", s)
+		}
+
+		b := make([]byte, size)
+		if _, err := io.ReadFull(rd, b); err != nil {
+			return err
+		}
+		fn(b)
+	}
+}
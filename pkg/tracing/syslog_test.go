@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSyslogRFC5424(t *testing.T) {
+	msg, err := parseSyslogMessage([]byte(
+		`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog 8710 ID47 `+
+			`[exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"]`+
+			`[examplePriority@32473 class="high" note="a \"quoted\" \] value"] `+
+			"\ufeffAn application event log entry...\n"),
+		time.Now())
+	require.NoError(t, err)
+
+	require.Equal(t, 20, msg.Facility)
+	require.Equal(t, 5, msg.Severity)
+	require.Equal(t, time.Date(2003, 10, 11, 22, 14, 15, 3e6, time.UTC), msg.Time.UTC())
+	require.Equal(t, "mymachine.example.com", msg.Hostname)
+	require.Equal(t, "evntslog", msg.AppName)
+	require.Equal(t, "8710", msg.ProcID)
+	require.Equal(t, "ID47", msg.MsgID)
+	require.Equal(t, map[string]map[string]string{
+		"exampleSDID@32473":     {"iut": "3", "eventSource": "Application", "eventID": "1011"},
+		"examplePriority@32473": {"class": "high", "note": `a "quoted" ] value`},
+	}, msg.StructuredData)
+	require.Equal(t, "An application event log entry...", msg.Message)
+
+	rl := syslogResourceLogs(msg)
+	resource := otlpAttrs(rl.Resource.Attributes)
+	require.Equal(t, "evntslog", resource.ServiceName())
+	require.Equal(t, "mymachine.example.com", resource.Text("host.name"))
+	require.Equal(t, int64(8710), resource["process.pid"])
+
+	record := rl.InstrumentationLibraryLogs[0].LogRecords[0]
+	require.Equal(t, "INFO", record.SeverityText)
+	attrs := otlpAttrs(record.Attributes)
+	require.Equal(t, int64(20), attrs[syslogFacility])
+	require.Equal(t, "ID47", attrs[syslogMsgID])
+	require.Equal(t, "high", attrs["syslog.sd.examplePriority@32473.class"])
+}
+
+func TestParseSyslogRFC5424NilValues(t *testing.T) {
+	msg, err := parseSyslogMessage([]byte("<14>1 - - - - - -"), time.Now())
+	require.NoError(t, err)
+	require.True(t, msg.Time.IsZero())
+	require.Equal(t, "", msg.Hostname)
+	require.Nil(t, msg.StructuredData)
+	require.Equal(t, "", msg.Message)
+}
+
+func TestParseSyslogRFC3164(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 10, 0, time.UTC)
+
+	msg, err := parseSyslogMessage(
+		[]byte("<34>Dec 31 23:59:58 mymachine su[1234]: 'su root' failed for lonvick on /dev/pts/8"),
+		now)
+	require.NoError(t, err)
+
+	require.Equal(t, 4, msg.Facility)
+	require.Equal(t, 2, msg.Severity)
+	require.Equal(t, time.Date(2021, 12, 31, 23, 59, 58, 0, time.UTC), msg.Time)
+	require.Equal(t, "mymachine", msg.Hostname)
+	require.Equal(t, "su", msg.AppName)
+	require.Equal(t, "1234", msg.ProcID)
+	require.Equal(t, "'su root' failed for lonvick on /dev/pts/8", msg.Message)
+	require.Equal(t, "FATAL", syslogSeverity(msg.Severity))
+
+	msg, err = parseSyslogMessage([]byte("<13>just a message"), now)
+	require.NoError(t, err)
+	require.True(t, msg.Time.IsZero())
+	require.Equal(t, "just a message", msg.Message)
+
+	_, err = parseSyslogMessage([]byte("<999>1 - - - - - -"), now)
+	require.Error(t, err)
+}
+
+func TestReadSyslogFrames(t *testing.T) {
+	stream := "17 <13>1 - - - - - a\n" +
+		"<13>Jan  1 00:00:00 host app: b\n" +
+		"\n" +
+		"17 <13>1 - - - - - c" +
+		"<13>d"
+
+	var got []string
+	err := readSyslogFrames(strings.NewReader(stream), func(b []byte) {
+		got = append(got, string(b))
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"<13>1 - - - - - a",
+		"<13>Jan  1 00:00:00 host app: b\n",
+		"<13>1 - - - - - c",
+		"<13>d",
+	}, got)
+}
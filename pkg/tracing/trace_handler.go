@@ -13,11 +13,14 @@ import (
 
 type TraceHandler struct {
 	*bunapp.App
+
+	storage SpanStorage
 }
 
-func NewTraceHandler(app *bunapp.App) *TraceHandler {
+func NewTraceHandler(app *bunapp.App, storage SpanStorage) *TraceHandler {
 	return &TraceHandler{
-		App: app,
+		App:     app,
+		storage: storage,
 	}
 }
 
@@ -29,7 +32,7 @@ func (h *TraceHandler) ShowTrace(w http.ResponseWriter, req bunrouter.Request) e
 		return err
 	}
 
-	spans, err := SelectTraceSpans(ctx, h.App, traceID)
+	spans, err := h.storage.SelectTraceSpans(ctx, traceID, 10000)
 	if err != nil {
 		return err
 	}
@@ -38,6 +41,13 @@ func (h *TraceHandler) ShowTrace(w http.ResponseWriter, req bunrouter.Request) e
 		return httperror.NotFound("Trace %q not found. Try again later.", traceID)
 	}
 
+	hydrateSpanBlobs(ctx, h.App, spans)
+
+	policy := attrPolicyFromContext(ctx, h.App)
+	for _, span := range spans {
+		applySpanAttrPolicy(policy, span)
+	}
+
 	root := BuildSpanTree(&spans)
 	traceDur := root.TreeEndTime().Sub(root.Time)
 
@@ -82,11 +92,14 @@ func (h *TraceHandler) ShowSpan(w http.ResponseWriter, req bunrouter.Request) er
 	span.ID = spanID
 	span.TraceID = traceID
 
-	if err := SelectSpan(ctx, h.App, span); err != nil {
+	if err := h.storage.SelectSpan(ctx, span); err != nil {
 		return err
 	}
+	hydrateSpanBlobs(ctx, h.App, []*Span{span})
+	applySpanAttrPolicy(attrPolicyFromContext(ctx, h.App), span)
 
 	return httputil.JSON(w, bunrouter.H{
-		"span": span,
+		"span":     span,
+		"grouping": spanGrouping(span),
 	})
 }
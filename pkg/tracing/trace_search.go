@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	"golang.org/x/exp/slices"
+)
+
+// ProjectTrace is the part of a trace that was sent to a project.
+type ProjectTrace struct {
+	ProjectID   uint32        `json:"projectId"`
+	ProjectName string        `json:"projectName"`
+	SpanCount   int           `json:"spanCount"`
+	Services    []string      `json:"services"`
+	Time        time.Time     `json:"time"`
+	Duration    time.Duration `json:"duration"`
+	URL         string        `json:"url"`
+
+	endTime time.Time
+}
+
+func groupTraceByProject(spans []*Span) []*ProjectTrace {
+	projectMap := make(map[uint32]*ProjectTrace)
+	projects := make([]*ProjectTrace, 0)
+
+	for _, span := range spans {
+		if span.IsEvent() {
+			continue
+		}
+
+		project, ok := projectMap[span.ProjectID]
+		if !ok {
+			project = &ProjectTrace{
+				ProjectID: span.ProjectID,
+				Services:  make([]string, 0),
+				Time:      span.Time,
+				endTime:   span.EndTime(),
+			}
+			projectMap[span.ProjectID] = project
+			projects = append(projects, project)
+		}
+
+		project.SpanCount++
+		if span.Time.Before(project.Time) {
+			project.Time = span.Time
+		}
+		if endTime := span.EndTime(); endTime.After(project.endTime) {
+			project.endTime = endTime
+		}
+		if service := span.Attrs.Text(xattr.ServiceName); service != "" &&
+			!slices.Contains(project.Services, service) {
+			project.Services = append(project.Services, service)
+		}
+	}
+
+	for _, project := range projects {
+		project.Duration = project.endTime.Sub(project.Time)
+		sort.Strings(project.Services)
+	}
+	sort.Slice(projects, func(i, j int) bool {
+		return projects[i].Time.Before(projects[j].Time)
+	})
+	return projects
+}
+
+// SearchProjects finds the trace in all projects. Cross-service traces can span
+// multiple projects when services use different DSNs.
+func (h *TraceHandler) SearchProjects(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	traceID, err := uuid.Parse(req.Param("trace_id"))
+	if err != nil {
+		return err
+	}
+
+	spans, err := h.storage.SelectTraceSpans(ctx, traceID, 10000)
+	if err != nil {
+		return err
+	}
+
+	projects := groupTraceByProject(spans)
+	conf := h.Config()
+	for _, project := range projects {
+		for i := range conf.Projects {
+			if p := &conf.Projects[i]; p.ID == project.ProjectID {
+				project.ProjectName = p.Name
+				break
+			}
+		}
+		project.URL = conf.TraceURL(project.ProjectID, traceID.String(), 0)
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"traceId":  traceID,
+		"projects": projects,
+	})
+}
@@ -0,0 +1,284 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/go-clickhouse/ch"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	"github.com/uptrace/uptrace/pkg/urlstruct"
+)
+
+type webVital struct {
+	Name string `json:"name"`
+	Unit string `json:"unit,omitempty"`
+	// Values up to Good are good and values above Poor are poor.
+	// Values in between need improvement.
+	Good float64 `json:"good"`
+	Poor float64 `json:"poor"`
+
+	attr    string
+	aliases []string
+}
+
+func (v *webVital) rating(value float64) string {
+	switch {
+	case value <= v.Good:
+		return "good"
+	case value <= v.Poor:
+		return "needs-improvement"
+	default:
+		return "poor"
+	}
+}
+
+// webVitals use the thresholds recommended by https://web.dev/vitals/.
+var webVitals = []*webVital{
+	{
+		Name: "lcp",
+		Unit: "milliseconds",
+		Good: 2500,
+		Poor: 4000,
+
+		attr:    xattr.WebVitalsLCP,
+		aliases: []string{"lcp", "lcp.value", "web_vitals.lcp", "browser.web_vital.lcp"},
+	},
+	{
+		Name: "fid",
+		Unit: "milliseconds",
+		Good: 100,
+		Poor: 300,
+
+		attr:    xattr.WebVitalsFID,
+		aliases: []string{"fid", "fid.value", "web_vitals.fid", "browser.web_vital.fid"},
+	},
+	{
+		Name: "inp",
+		Unit: "milliseconds",
+		Good: 200,
+		Poor: 500,
+
+		attr:    xattr.WebVitalsINP,
+		aliases: []string{"inp", "inp.value", "web_vitals.inp", "browser.web_vital.inp"},
+	},
+	{
+		Name: "cls",
+		Good: 0.1,
+		Poor: 0.25,
+
+		attr:    xattr.WebVitalsCLS,
+		aliases: []string{"cls", "cls.value", "web_vitals.cls", "browser.web_vital.cls"},
+	},
+}
+
+// Attributes that browser instrumentations use for the page, from the most to
+// the least specific.
+var webVitalsPageAttrs = []string{
+	"page.route",
+	xattr.HTTPRoute,
+	"location.pathname",
+	"url.path",
+}
+
+// Attributes with the full page URL that are used when there is no page path.
+var webVitalsURLAttrs = []string{
+	"location.href",
+	"url.full",
+	xattr.HTTPURL,
+}
+
+// normalizeWebVitals copies web vitals reported by browser instrumentations to
+// webvitals.* attributes and sets webvitals.page so vitals can be aggregated
+// by page regardless of the instrumentation.
+func normalizeWebVitals(attrs AttrMap) {
+	var found bool
+	for _, vital := range webVitals {
+		if attrs.Has(vital.attr) {
+			attrs[vital.attr] = attrs.Float64(vital.attr)
+			found = true
+			continue
+		}
+		for _, key := range vital.aliases {
+			if attrs.Has(key) {
+				attrs[vital.attr] = attrs.Float64(key)
+				found = true
+				break
+			}
+		}
+	}
+	if !found || attrs.Has(xattr.WebVitalsPage) {
+		return
+	}
+
+	for _, key := range webVitalsPageAttrs {
+		if s := attrs.Text(key); s != "" {
+			attrs[xattr.WebVitalsPage] = s
+			return
+		}
+	}
+	for _, key := range webVitalsURLAttrs {
+		if s := attrs.Text(key); s != "" {
+			if u, err := url.Parse(s); err == nil && u.Path != "" {
+				attrs[xattr.WebVitalsPage] = u.Path
+				return
+			}
+		}
+	}
+}
+
+//------------------------------------------------------------------------------
+
+type WebVitalsFilter struct {
+	*bunapp.App `urlstruct:"-"`
+
+	TimeFilter
+
+	ProjectID uint32
+	// Optional service name.
+	Service string
+}
+
+func DecodeWebVitalsFilter(app *bunapp.App, req bunrouter.Request) (*WebVitalsFilter, error) {
+	f := &WebVitalsFilter{App: app}
+	if err := bunapp.UnmarshalValues(req, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+var _ urlstruct.ValuesUnmarshaler = (*WebVitalsFilter)(nil)
+
+func (f *WebVitalsFilter) UnmarshalValues(ctx context.Context, values url.Values) error {
+	if err := f.TimeFilter.UnmarshalValues(ctx, values); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (f *WebVitalsFilter) whereClause(q *ch.SelectQuery) *ch.SelectQuery {
+	q = q.Where("project_id = ?", f.ProjectID).
+		Where("`span.time` >= ?", f.TimeGTE).
+		Where("`span.time` < ?", f.TimeLT).
+		Where("has(attr_keys, ?)", xattr.WebVitalsPage)
+	if f.Service != "" {
+		q = q.Where("`service.name` = ?", f.Service)
+	}
+	return q
+}
+
+//------------------------------------------------------------------------------
+
+type webVitalsRow struct {
+	Page  string
+	Count float64
+
+	LCP      float64 `ch:"lcp"`
+	LCPCount float64 `ch:"lcp_count"`
+	FID      float64 `ch:"fid"`
+	FIDCount float64 `ch:"fid_count"`
+	INP      float64 `ch:"inp"`
+	INPCount float64 `ch:"inp_count"`
+	CLS      float64 `ch:"cls"`
+	CLSCount float64 `ch:"cls_count"`
+}
+
+func (row *webVitalsRow) value(name string) (p75, count float64) {
+	switch name {
+	case "lcp":
+		return row.LCP, row.LCPCount
+	case "fid":
+		return row.FID, row.FIDCount
+	case "inp":
+		return row.INP, row.INPCount
+	case "cls":
+		return row.CLS, row.CLSCount
+	}
+	panic("not reached")
+}
+
+type PageWebVitals struct {
+	Page   string                   `json:"page"`
+	Count  float64                  `json:"count"`
+	Vitals map[string]WebVitalValue `json:"vitals"`
+}
+
+type WebVitalValue struct {
+	P75    float64 `json:"p75"`
+	Count  float64 `json:"count"`
+	Rating string  `json:"rating"`
+}
+
+func selectPageWebVitals(ctx context.Context, f *WebVitalsFilter) ([]PageWebVitals, error) {
+	q := f.CH().NewSelect().
+		ColumnExpr("? AS page", chColumn(xattr.WebVitalsPage)).
+		ColumnExpr("toFloat64(sum(`span.count`)) AS count").
+		Model((*SpanIndex)(nil)).
+		Apply(f.whereClause).
+		GroupExpr("page").
+		OrderExpr("count DESC").
+		Limit(1000)
+	for _, vital := range webVitals {
+		q = q.ColumnExpr("quantileIf(0.75)(toFloat64OrZero(?), has(attr_keys, ?)) AS ?",
+			chColumn(vital.attr), vital.attr, ch.Ident(vital.Name)).
+			ColumnExpr("toFloat64(countIf(has(attr_keys, ?))) AS ?",
+				vital.attr, ch.Ident(vital.Name+"_count"))
+	}
+
+	var rows []webVitalsRow
+	if err := q.Scan(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	pages := make([]PageWebVitals, len(rows))
+	for i := range rows {
+		pages[i] = newPageWebVitals(&rows[i])
+	}
+	return pages, nil
+}
+
+func newPageWebVitals(row *webVitalsRow) PageWebVitals {
+	page := PageWebVitals{
+		Page:   row.Page,
+		Count:  row.Count,
+		Vitals: make(map[string]WebVitalValue, len(webVitals)),
+	}
+	for _, vital := range webVitals {
+		p75, count := row.value(vital.Name)
+		if count == 0 {
+			continue
+		}
+		page.Vitals[vital.Name] = WebVitalValue{
+			P75:    p75,
+			Count:  count,
+			Rating: vital.rating(p75),
+		}
+	}
+	return page
+}
+
+//------------------------------------------------------------------------------
+
+// WebVitals returns p75 values of Core Web Vitals by page together with the
+// thresholds used to rate them.
+func (h *ServiceHandler) WebVitals(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	f, err := DecodeWebVitalsFilter(h.App, req)
+	if err != nil {
+		return err
+	}
+
+	pages, err := selectPageWebVitals(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"pages":      pages,
+		"thresholds": webVitals,
+	})
+}
@@ -0,0 +1,39 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+)
+
+func TestNormalizeWebVitals(t *testing.T) {
+	attrs := AttrMap{
+		"lcp.value":     int64(3000),
+		"cls":           0.05,
+		"location.href": "https://example.com/products/1?ref=home",
+	}
+	normalizeWebVitals(attrs)
+	require.Equal(t, 3000.0, attrs[xattr.WebVitalsLCP])
+	require.Equal(t, 0.05, attrs[xattr.WebVitalsCLS])
+	require.Equal(t, "/products/1", attrs[xattr.WebVitalsPage])
+
+	attrs = AttrMap{xattr.HTTPURL: "https://example.com/"}
+	normalizeWebVitals(attrs)
+	require.False(t, attrs.Has(xattr.WebVitalsPage))
+}
+
+func TestNewPageWebVitals(t *testing.T) {
+	page := newPageWebVitals(&webVitalsRow{
+		Page:     "/",
+		Count:    10,
+		LCP:      3000,
+		LCPCount: 10,
+		CLS:      0.3,
+		CLSCount: 5,
+	})
+	require.Equal(t, map[string]WebVitalValue{
+		"lcp": {P75: 3000, Count: 10, Rating: "needs-improvement"},
+		"cls": {P75: 0.3, Count: 5, Rating: "poor"},
+	}, page.Vitals)
+}
@@ -25,32 +25,85 @@ const (
 	SpanCountPerMin = "span.count_per_min"
 	SpanErrorCount  = "span.error_count"
 	SpanErrorPct    = "span.error_pct"
+	SpanApdex       = "span.apdex"
+
+	SpanApdexLevel = "span.apdex_level"
 
 	SpanLinkCount       = "span.link_count"
 	SpanEventCount      = "span.event_count"
 	SpanEventErrorCount = "span.event_error_count"
 	SpanEventLogCount   = "span.event_log_count"
 
-	ServiceName = "service.name"
-	HostName    = "host.name"
+	ServiceName      = "service.name"
+	ServiceNamespace = "service.namespace"
+	ServiceVersion   = "service.version"
+	HostName         = "host.name"
+
+	// ServiceKey is built from the service_grouping attrs, for example, shop/api.
+	ServiceKey = "service.key"
+
+	CloudProvider  = "cloud.provider"
+	CloudPlatform  = "cloud.platform"
+	CloudRegion    = "cloud.region"
+	CloudAccountID = "cloud.account.id"
+
+	FaaSName      = "faas.name"
+	FaaSID        = "faas.id"
+	FaaSExecution = "faas.execution"
+
+	EnduserID = "enduser.id"
+
+	ContainerName         = "container.name"
+	ProcessExecutableName = "process.executable.name"
+	ProcessCommand        = "process.command"
+
+	K8sNodeName        = "k8s.node.name"
+	K8sDeploymentName  = "k8s.deployment.name"
+	K8sStatefulSetName = "k8s.statefulset.name"
+	K8sDaemonSetName   = "k8s.daemonset.name"
+	K8sCronJobName     = "k8s.cronjob.name"
+	K8sJobName         = "k8s.job.name"
 
 	RPCSystem  = "rpc.system"
 	RPCService = "rpc.service"
 	RPCMethod  = "rpc.method"
 
+	RPCGRPCStatusCode = "rpc.grpc.status_code"
+
+	WebVitalsLCP  = "webvitals.lcp"
+	WebVitalsFID  = "webvitals.fid"
+	WebVitalsINP  = "webvitals.inp"
+	WebVitalsCLS  = "webvitals.cls"
+	WebVitalsPage = "webvitals.page"
+
 	MessagingSystem          = "messaging.system"
 	MessagingOperation       = "messaging.operation"
 	MessagingDestination     = "messaging.destination"
 	MessagingDestinationKind = "messaging.destination_kind"
+	MessagingRedelivered     = "messaging.redelivered"
+	MessagingRetryCount      = "messaging.retry_count"
 
 	DBSystem    = "db.system"
 	DBStatement = "db.statement"
 	DBOperation = "db.operation"
 	DBSqlTable  = "db.sql.table"
 
-	HTTPMethod = "http.method" // GET
-	HTTPRoute  = "http.route"
-	HTTPTarget = "http.target"
+	DBConnectionString = "db.connection_string"
+
+	HTTPMethod    = "http.method" // GET
+	HTTPRoute     = "http.route"
+	HTTPTarget    = "http.target"
+	HTTPURL       = "http.url"
+	HTTPHost      = "http.host"
+	HTTPScheme    = "http.scheme"
+	HTTPClientIP  = "http.client_ip"
+	HTTPUserAgent = "http.user_agent"
+
+	HTTPStatusCode            = "http.status_code"
+	HTTPResponseContentLength = "http.response_content_length"
+
+	HTTPRequestBody  = "http.request.body"
+	HTTPResponseBody = "http.response.body"
 
 	LogMessage  = "log.message"
 	LogSeverity = "log.severity"
@@ -60,9 +113,17 @@ const (
 	ExceptionType       = "exception.type"
 	ExceptionMessage    = "exception.message"
 	ExceptionStacktrace = "exception.stacktrace"
+	ExceptionEscaped    = "exception.escaped"
+
+	OSName                = "os.name"
+	OSVersion             = "os.version"
+	DeviceModelIdentifier = "device.model.identifier"
+	SessionID             = "session.id"
+	AppState              = "app.state"
 
 	OtelLibraryName    = "otel.library.name"
 	OtelLibraryVersion = "otel.library.version"
+	OtelSchemaURL      = "otel.schema_url"
 
 	TelemetrySDKName     = "telemetry.sdk.name"
 	TelemetrySDKVersion  = "telemetry.sdk.version"
@@ -0,0 +1,388 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/uptrace/uptrace/pkg/tracing/xattr"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// xraySegment is an X-Ray segment or subsegment document, see
+// https://docs.aws.amazon.com/xray/latest/devguide/xray-api-segmentdocuments.html
+type xraySegment struct {
+	Name       string  `json:"name"`
+	ID         string  `json:"id"`
+	TraceID    string  `json:"trace_id"`
+	ParentID   string  `json:"parent_id"`
+	Type       string  `json:"type"`
+	StartTime  float64 `json:"start_time"`
+	EndTime    float64 `json:"end_time"`
+	InProgress bool    `json:"in_progress"`
+
+	Namespace string `json:"namespace"`
+	Origin    string `json:"origin"`
+	User      string `json:"user"`
+
+	Error    bool `json:"error"`
+	Fault    bool `json:"fault"`
+	Throttle bool `json:"throttle"`
+
+	Cause json.RawMessage `json:"cause"`
+
+	HTTP *struct {
+		Request struct {
+			Method    string `json:"method"`
+			URL       string `json:"url"`
+			ClientIP  string `json:"client_ip"`
+			UserAgent string `json:"user_agent"`
+		} `json:"request"`
+		Response struct {
+			Status        int64 `json:"status"`
+			ContentLength int64 `json:"content_length"`
+		} `json:"response"`
+	} `json:"http"`
+
+	SQL *struct {
+		URL            string `json:"url"`
+		User           string `json:"user"`
+		DatabaseType   string `json:"database_type"`
+		SanitizedQuery string `json:"sanitized_query"`
+	} `json:"sql"`
+
+	Service *struct {
+		Version string `json:"version"`
+	} `json:"service"`
+
+	AWS         map[string]any            `json:"aws"`
+	Annotations map[string]any            `json:"annotations"`
+	Metadata    map[string]map[string]any `json:"metadata"`
+
+	Subsegments []*xraySegment `json:"subsegments"`
+}
+
+type xrayCause struct {
+	Exceptions []struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+		Stack   []struct {
+			Path  string `json:"path"`
+			Line  int    `json:"line"`
+			Label string `json:"label"`
+		} `json:"stack"`
+	} `json:"exceptions"`
+}
+
+func (seg *xraySegment) isSubsegment() bool {
+	return seg.Type == "subsegment"
+}
+
+// isLambdaFunction reports whether the segment is recorded by Lambda for a function
+// invocation.
+func (seg *xraySegment) isLambdaFunction() bool {
+	return seg.Origin == "AWS::Lambda::Function" && !seg.isSubsegment()
+}
+
+func parseXRaySegment(b []byte) (*xraySegment, error) {
+	seg := new(xraySegment)
+	if err := json.Unmarshal(b, seg); err != nil {
+		return nil, err
+	}
+	return seg, nil
+}
+
+// xrayResourceSpans converts a segment and its subsegments to OTLP spans.
+// In-progress segments are skipped, because X-Ray SDKs resend them once they are complete.
+func xrayResourceSpans(seg *xraySegment) (*tracepb.ResourceSpans, error) {
+	traceID, err := xrayTraceID(seg.TraceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var parentID []byte
+	if seg.ParentID != "" {
+		parentID, err = xraySpanID(seg.ParentID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	spans, err := appendXRaySpans(nil, seg, traceID, parentID, !seg.isSubsegment())
+	if err != nil {
+		return nil, err
+	}
+
+	return &tracepb.ResourceSpans{
+		Resource: xrayResource(seg),
+		InstrumentationLibrarySpans: []*tracepb.InstrumentationLibrarySpans{{
+			InstrumentationLibrary: &commonpb.InstrumentationLibrary{Name: "aws.xray"},
+			Spans:                  spans,
+		}},
+	}, nil
+}
+
+func xrayResource(seg *xraySegment) *resourcepb.Resource {
+	attrs := []*commonpb.KeyValue{
+		otlpStringAttr(xattr.CloudProvider, "aws"),
+	}
+	if !seg.isSubsegment() {
+		attrs = append(attrs, otlpStringAttr(xattr.ServiceName, seg.Name))
+	}
+	if seg.Service != nil && seg.Service.Version != "" {
+		attrs = append(attrs, otlpStringAttr(xattr.ServiceVersion, seg.Service.Version))
+	}
+	if platform := xrayCloudPlatform(seg.Origin); platform != "" {
+		attrs = append(attrs, otlpStringAttr(xattr.CloudPlatform, platform))
+	}
+	if seg.isLambdaFunction() {
+		attrs = append(attrs, otlpStringAttr(xattr.FaaSName, seg.Name))
+		if s, _ := seg.AWS["function_arn"].(string); s != "" {
+			attrs = append(attrs, otlpStringAttr(xattr.FaaSID, s))
+		}
+		if s, _ := seg.AWS["account_id"].(string); s != "" {
+			attrs = append(attrs, otlpStringAttr(xattr.CloudAccountID, s))
+		}
+	}
+	return &resourcepb.Resource{Attributes: attrs}
+}
+
+func xrayCloudPlatform(origin string) string {
+	switch origin {
+	case "AWS::Lambda::Function":
+		return "aws_lambda"
+	case "AWS::EC2::Instance":
+		return "aws_ec2"
+	case "AWS::ECS::Container":
+		return "aws_ecs"
+	case "AWS::EKS::Container":
+		return "aws_eks"
+	case "AWS::ElasticBeanstalk::Environment":
+		return "aws_elastic_beanstalk"
+	}
+	return ""
+}
+
+func appendXRaySpans(
+	spans []*tracepb.Span, seg *xraySegment, traceID, parentID []byte, isSegment bool,
+) ([]*tracepb.Span, error) {
+	if seg.InProgress {
+		return spans, nil
+	}
+
+	spanID, err := xraySpanID(seg.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	span := &tracepb.Span{
+		TraceId:           traceID,
+		SpanId:            spanID,
+		ParentSpanId:      parentID,
+		Name:              seg.Name,
+		Kind:              xraySpanKind(seg, isSegment),
+		StartTimeUnixNano: xrayTime(seg.StartTime),
+		EndTimeUnixNano:   xrayTime(seg.EndTime),
+		Attributes:        xrayAttrs(seg, isSegment),
+		Status:            &tracepb.Status{},
+	}
+
+	if seg.Fault || (seg.Error && !isSegment) {
+		span.Status.Code = tracepb.Status_STATUS_CODE_ERROR
+	}
+	span.Events = xrayEvents(seg)
+
+	spans = append(spans, span)
+
+	for _, subseg := range seg.Subsegments {
+		spans, err = appendXRaySpans(spans, subseg, traceID, spanID, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return spans, nil
+}
+
+func xraySpanKind(seg *xraySegment, isSegment bool) tracepb.Span_SpanKind {
+	if isSegment {
+		return tracepb.Span_SPAN_KIND_SERVER
+	}
+	switch seg.Namespace {
+	case "aws", "remote":
+		return tracepb.Span_SPAN_KIND_CLIENT
+	}
+	return tracepb.Span_SPAN_KIND_INTERNAL
+}
+
+func xrayAttrs(seg *xraySegment, isSegment bool) []*commonpb.KeyValue {
+	var attrs []*commonpb.KeyValue
+
+	if http := seg.HTTP; http != nil {
+		if s := http.Request.Method; s != "" {
+			attrs = append(attrs, otlpStringAttr(xattr.HTTPMethod, s))
+		}
+		if s := http.Request.URL; s != "" {
+			attrs = append(attrs, otlpStringAttr(xattr.HTTPURL, s))
+			if u, err := url.Parse(s); err == nil && isSegment {
+				attrs = append(attrs,
+					otlpStringAttr(xattr.HTTPTarget, u.Path),
+					otlpStringAttr(xattr.HTTPHost, u.Host),
+					otlpStringAttr(xattr.HTTPScheme, u.Scheme))
+			}
+		}
+		if s := http.Request.ClientIP; s != "" {
+			attrs = append(attrs, otlpStringAttr(xattr.HTTPClientIP, s))
+		}
+		if s := http.Request.UserAgent; s != "" {
+			attrs = append(attrs, otlpStringAttr(xattr.HTTPUserAgent, s))
+		}
+		if n := http.Response.Status; n != 0 {
+			attrs = append(attrs, otlpIntAttr(xattr.HTTPStatusCode, n))
+		}
+		if n := http.Response.ContentLength; n != 0 {
+			attrs = append(attrs, otlpIntAttr(xattr.HTTPResponseContentLength, n))
+		}
+	}
+
+	if sql := seg.SQL; sql != nil {
+		system := strings.ToLower(sql.DatabaseType)
+		if system == "" {
+			system = "sql"
+		}
+		attrs = append(attrs, otlpStringAttr(xattr.DBSystem, system))
+		if sql.SanitizedQuery != "" {
+			attrs = append(attrs, otlpStringAttr(xattr.DBStatement, sql.SanitizedQuery))
+		}
+		if sql.URL != "" {
+			attrs = append(attrs, otlpStringAttr(xattr.DBConnectionString, sql.URL))
+		}
+		if sql.User != "" {
+			attrs = append(attrs, otlpStringAttr("db.user", sql.User))
+		}
+	}
+
+	if len(seg.AWS) > 0 {
+		if seg.Namespace == "aws" {
+			attrs = append(attrs,
+				otlpStringAttr(xattr.RPCSystem, "aws-api"),
+				otlpStringAttr(xattr.RPCService, seg.Name))
+		}
+		for key, value := range seg.AWS {
+			switch key {
+			case "function_arn", "account_id":
+				if seg.isLambdaFunction() {
+					continue // resource attributes
+				}
+				attrs = append(attrs, otlpAnyAttr("aws."+key, value))
+			case "request_id":
+				if seg.isLambdaFunction() {
+					attrs = append(attrs, otlpStringAttr(xattr.FaaSExecution, asString(value)))
+					continue
+				}
+				attrs = append(attrs, otlpAnyAttr("aws."+key, value))
+			case "operation":
+				attrs = append(attrs, otlpStringAttr(xattr.RPCMethod, asString(value)))
+			case "region":
+				attrs = append(attrs, otlpStringAttr(xattr.CloudRegion, asString(value)))
+			default:
+				attrs = append(attrs, otlpAnyAttr("aws."+key, value))
+			}
+		}
+	}
+
+	if seg.User != "" {
+		attrs = append(attrs, otlpStringAttr(xattr.EnduserID, seg.User))
+	}
+	if seg.Error {
+		attrs = append(attrs, otlpBoolAttr("aws.xray.error", true))
+	}
+	if seg.Throttle {
+		attrs = append(attrs, otlpBoolAttr("aws.xray.throttle", true))
+	}
+
+	for key, value := range seg.Annotations {
+		attrs = append(attrs, otlpAnyAttr(key, value))
+	}
+	for ns, m := range seg.Metadata {
+		for key, value := range m {
+			attrs = append(attrs, otlpAnyAttr("aws.xray.metadata."+ns+"."+key, value))
+		}
+	}
+
+	return attrs
+}
+
+func xrayEvents(seg *xraySegment) []*tracepb.Span_Event {
+	// The cause is either an object or an id of an exception recorded in another subsegment.
+	if !bytes.HasPrefix(bytes.TrimSpace(seg.Cause), []byte("{")) {
+		return nil
+	}
+
+	var cause xrayCause
+	if err := json.Unmarshal(seg.Cause, &cause); err != nil {
+		return nil
+	}
+
+	events := make([]*tracepb.Span_Event, 0, len(cause.Exceptions))
+	for _, exc := range cause.Exceptions {
+		var stack strings.Builder
+		for _, frame := range exc.Stack {
+			stack.WriteString(frame.Label)
+			stack.WriteString(" (")
+			stack.WriteString(frame.Path)
+			stack.WriteByte(':')
+			stack.WriteString(strconv.Itoa(frame.Line))
+			stack.WriteString(")\n")
+		}
+
+		events = append(events, &tracepb.Span_Event{
+			Name:         exceptionEventType,
+			TimeUnixNano: xrayTime(seg.EndTime),
+			Attributes: []*commonpb.KeyValue{
+				otlpStringAttr(xattr.ExceptionType, exc.Type),
+				otlpStringAttr(xattr.ExceptionMessage, exc.Message),
+				otlpStringAttr(xattr.ExceptionStacktrace, stack.String()),
+			},
+		})
+	}
+	return events
+}
+
+// xrayTraceID converts 1-58406520-a006649127e371903a2de979 to 16 bytes.
+func xrayTraceID(s string) ([]byte, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 3 || parts[0] != "1" || len(parts[1])+len(parts[2]) != 32 {
+		return nil, fmt.Errorf("xray: invalid trace_id=%q", s)
+	}
+	b, err := hex.DecodeString(parts[1] + parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("xray: invalid trace_id=%q: %w", s, err)
+	}
+	return b, nil
+}
+
+func xraySpanID(s string) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("xray: invalid id=%q: %w", s, err)
+	}
+	if len(b) != 8 {
+		return nil, fmt.Errorf("xray: invalid id=%q", s)
+	}
+	return b, nil
+}
+
+// xrayTime converts fractional seconds to nanoseconds without losing
+// microsecond precision.
+func xrayTime(sec float64) uint64 {
+	whole, frac := math.Modf(sec)
+	return uint64(whole)*1e9 + uint64(math.Round(frac*1e6))*1e3
+}
@@ -0,0 +1,189 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/uptrace/pkg/bunapp"
+	"github.com/uptrace/uptrace/pkg/httputil"
+	"github.com/uptrace/uptrace/pkg/org"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"go.uber.org/zap"
+)
+
+// XRayServer accepts segments from the X-Ray daemon (PutTraceSegments API) and
+// directly from X-Ray SDKs (daemon UDP protocol).
+type XRayServer struct {
+	*bunapp.App
+
+	traceService *TraceServiceServer
+}
+
+func NewXRayServer(app *bunapp.App, traceService *TraceServiceServer) *XRayServer {
+	return &XRayServer{
+		App:          app,
+		traceService: traceService,
+	}
+}
+
+func (s *XRayServer) project(ctx context.Context, dsn string) (*bunapp.Project, error) {
+	if dsn != "" {
+		return org.SelectProjectByDSN(ctx, s.App, dsn)
+	}
+	projectID := s.Config().XRay.ProjectID
+	if projectID == 0 {
+		return nil, errors.New("uptrace-dsn header or xray.project_id option is required")
+	}
+	return org.SelectIngestProjectByID(ctx, s.App, projectID)
+}
+
+type xrayUnprocessedSegment struct {
+	ID        string `json:"Id"`
+	ErrorCode string `json:"ErrorCode"`
+	Message   string `json:"Message"`
+}
+
+func (s *XRayServer) PutTraceSegments(w http.ResponseWriter, req bunrouter.Request) error {
+	ctx := req.Context()
+
+	project, err := s.project(ctx, org.IngestDSN(req.Request))
+	if err != nil {
+		return err
+	}
+
+	var in struct {
+		TraceSegmentDocuments []string `json:"TraceSegmentDocuments"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&in); err != nil {
+		return err
+	}
+
+	resourceSpans := make([]*tracepb.ResourceSpans, 0, len(in.TraceSegmentDocuments))
+	unprocessed := make([]xrayUnprocessedSegment, 0)
+
+	for _, doc := range in.TraceSegmentDocuments {
+		seg, err := parseXRaySegment([]byte(doc))
+		if err != nil {
+			unprocessed = append(unprocessed, xrayUnprocessedSegment{
+				ErrorCode: "InvalidSegment",
+				Message:   err.Error(),
+			})
+			continue
+		}
+
+		rs, err := xrayResourceSpans(seg)
+		if err != nil {
+			unprocessed = append(unprocessed, xrayUnprocessedSegment{
+				ID:        seg.ID,
+				ErrorCode: "InvalidSegment",
+				Message:   err.Error(),
+			})
+			continue
+		}
+
+		resourceSpans = append(resourceSpans, rs)
+	}
+
+	if _, err := s.traceService.process(project, resourceSpans); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, bunrouter.H{
+		"UnprocessedTraceSegments": unprocessed,
+	})
+}
+
+//------------------------------------------------------------------------------
+
+func (s *XRayServer) ListenUDP(ctx context.Context, app *bunapp.App) error {
+	addr := app.Config().Listen.XRay
+	if addr == "" {
+		return nil
+	}
+
+	project, err := s.project(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		app.Zap(ctx).Error("net.ListenPacket failed (edit listen.xray YAML option)",
+			zap.Error(err), zap.String("addr", addr))
+		return err
+	}
+
+	app.OnStop("xray.Close", func(ctx context.Context, _ *bunapp.App) error {
+		return conn.Close()
+	})
+
+	app.WaitGroup().Add(1)
+	go func() {
+		defer app.WaitGroup().Done()
+
+		s.serveUDP(ctx, conn, project)
+	}()
+
+	return nil
+}
+
+func (s *XRayServer) serveUDP(ctx context.Context, conn net.PacketConn, project *bunapp.Project) {
+	buf := make([]byte, 64<<10)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.Zap(ctx).Error("xray: ReadFrom failed", zap.Error(err))
+			continue
+		}
+
+		if err := s.handlePacket(project, buf[:n]); err != nil {
+			s.Zap(ctx).Error("xray: invalid segment", zap.Error(err))
+		}
+	}
+}
+
+// handlePacket handles a datagram that consists of a JSON header and a segment
+// separated by a newline, for example:
+//
+//	{"format": "json", "version": 1}
+//	{"trace_id": "1-5759e988-bd862e3fe1be46a994272793", "id": "defdfd9912dc5a56", ...}
+func (s *XRayServer) handlePacket(project *bunapp.Project, b []byte) error {
+	idx := bytes.IndexByte(b, '\n')
+	if idx == -1 {
+		return errors.New("xray: packet header is missing")
+	}
+
+	var header struct {
+		Format  string `json:"format"`
+		Version int    `json:"version"`
+	}
+	if err := json.Unmarshal(b[:idx], &header); err != nil {
+		return err
+	}
+	if header.Format != "json" {
+		return errors.New("xray: unsupported packet format")
+	}
+
+	seg, err := parseXRaySegment(b[idx+1:])
+	if err != nil {
+		return err
+	}
+
+	rs, err := xrayResourceSpans(seg)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.traceService.process(project, []*tracepb.ResourceSpans{rs}); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func TestXRayResourceSpans(t *testing.T) {
+	seg, err := parseXRaySegment([]byte(`{
+		"name": "orders",
+		"id": "70de5b6f19ff9a0a",
+		"trace_id": "1-581cf771-a006649127e371903a2de979",
+		"start_time": 1478293361.271,
+		"end_time": 1478293361.449,
+		"origin": "AWS::Lambda::Function",
+		"aws": {
+			"function_arn": "arn:aws:lambda:us-east-1:123456789012:function:orders",
+			"account_id": "123456789012",
+			"request_id": "c6af9ac6-7b61-11e6-9a41-93e8deadbeef"
+		},
+		"annotations": {"customer_tier": "gold"},
+		"http": {
+			"request": {"method": "POST", "url": "https://example.com/orders"},
+			"response": {"status": 200}
+		},
+		"subsegments": [{
+			"name": "DynamoDB",
+			"id": "53995c3f42cd8ad8",
+			"namespace": "aws",
+			"start_time": 1478293361.3,
+			"end_time": 1478293361.4,
+			"fault": true,
+			"aws": {"operation": "PutItem", "region": "us-east-1"}
+		}, {
+			"name": "pending",
+			"id": "63995c3f42cd8ad8",
+			"start_time": 1478293361.3,
+			"in_progress": true
+		}]
+	}`))
+	require.NoError(t, err)
+
+	rs, err := xrayResourceSpans(seg)
+	require.NoError(t, err)
+
+	resource := otlpAttrs(rs.Resource.Attributes)
+	require.Equal(t, "orders", resource.ServiceName())
+	require.Equal(t, "aws_lambda", resource.Text("cloud.platform"))
+	require.Equal(t, "orders", resource.Text("faas.name"))
+	require.Equal(t, "arn:aws:lambda:us-east-1:123456789012:function:orders", resource.Text("faas.id"))
+	require.Equal(t, "123456789012", resource.Text("cloud.account.id"))
+
+	spans := rs.InstrumentationLibrarySpans[0].Spans
+	require.Len(t, spans, 2)
+
+	root := spans[0]
+	require.Equal(t, tracepb.Span_SPAN_KIND_SERVER, root.Kind)
+	require.Equal(t, "581cf771-a006-6491-27e3-71903a2de979", otlpTraceID(root.TraceId).String())
+	require.Equal(t, uint64(1478293361271000000), root.StartTimeUnixNano)
+	rootAttrs := otlpAttrs(root.Attributes)
+	require.Equal(t, "/orders", rootAttrs.Text("http.target"))
+	require.Equal(t, "c6af9ac6-7b61-11e6-9a41-93e8deadbeef", rootAttrs.Text("faas.execution"))
+	require.Equal(t, "gold", rootAttrs.Text("customer_tier"))
+	require.False(t, rootAttrs.Has("aws.function_arn"))
+
+	child := spans[1]
+	require.Equal(t, root.SpanId, child.ParentSpanId)
+	require.Equal(t, tracepb.Span_SPAN_KIND_CLIENT, child.Kind)
+	require.Equal(t, tracepb.Status_STATUS_CODE_ERROR, child.Status.Code)
+
+	attrs := otlpAttrs(child.Attributes)
+	require.Equal(t, "aws-api", attrs.Text("rpc.system"))
+	require.Equal(t, "PutItem", attrs.Text("rpc.method"))
+	require.Equal(t, "us-east-1", attrs.Text("cloud.region"))
+}
+
+func TestXRayTraceID(t *testing.T) {
+	_, err := xrayTraceID("1-581cf771-a006649127e371903a2de97")
+	require.Error(t, err)
+
+	_, err = xrayTraceID("2-581cf771-a006649127e371903a2de979")
+	require.Error(t, err)
+}
@@ -1,3 +1,4 @@
+import '@/public-path'
 import Vue from 'vue'
 
 import VueCompositionApi from '@vue/composition-api'
@@ -25,6 +25,9 @@ export interface Span {
   attrs: AttrMap
   events?: Span[]
   children?: Span[]
+
+  // Placeholder root of a trace whose root span never arrived.
+  synthetic?: boolean
 }
 
 export function eventOrSpanName(span: Span, maxLength = 200): string {
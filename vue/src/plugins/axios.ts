@@ -2,12 +2,13 @@ import axios from 'axios'
 import axiosRetry from 'axios-retry'
 
 // Utilities
+import { urlPrefix } from '@/public-path'
 import { redirectToLogin } from '@/use/org'
 
 axiosRetry(axios, { retries: 2, retryDelay: axiosRetry.exponentialDelay })
 
 axios.interceptors.request.use((config) => {
-  config.baseURL = process.env.VUE_APP_BASE_URL
+  config.baseURL = urlPrefix || process.env.VUE_APP_BASE_URL
   config.withCredentials = true
   return config
 })
@@ -0,0 +1,7 @@
+// Set by the server when Uptrace is served under site.url_prefix, for example, /uptrace.
+export const urlPrefix: string = (window as any).UPTRACE_URL_PREFIX ?? ''
+
+if (urlPrefix) {
+  // eslint-disable-next-line @typescript-eslint/camelcase, no-undef
+  __webpack_public_path__ = urlPrefix + '/'
+}
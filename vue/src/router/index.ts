@@ -4,6 +4,9 @@ import VueRouter, { RouteConfig } from 'vue-router'
 // Composables
 import { useUser } from '@/use/org'
 
+// Utilities
+import { urlPrefix } from '@/public-path'
+
 import Overview from '@/views/Overview.vue'
 import SystemOverview from '@/components/SystemOverview.vue'
 import ServiceOverview from '@/components/ServiceOverview.vue'
@@ -108,7 +111,7 @@ const routes: Array<RouteConfig> = [
 
 const router = new VueRouter({
   mode: 'history',
-  base: process.env.BASE_URL,
+  base: urlPrefix || process.env.BASE_URL,
   routes,
 })
 
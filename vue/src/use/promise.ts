@@ -73,7 +73,8 @@ export function usePromise(fn: AsyncFunc, cfg: Config = {}) {
   const errorMessage = computed(() => {
     const msg = error.value?.response?.data?.message
     if (msg) {
-      return msg
+      const requestId = error.value?.response?.data?.requestId
+      return requestId ? `${msg} (request id: ${requestId})` : msg
     }
     return asString(error.value)
   })